@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib/dynatrace"
+)
+
+// dashboard-dry-run parses a Dynatrace dashboard the same way the dynatrace-service does for a get-sli event
+// and prints the generated sli.yaml, slo.yaml and SLI values without sending any Keptn events.
+// The Dynatrace tenant and API token are taken from the DT_TENANT and DT_API_TOKEN environment variables.
+func main() {
+	project := flag.String("project", "", "Keptn project")
+	stage := flag.String("stage", "", "Keptn stage")
+	service := flag.String("service", "", "Keptn service")
+	dashboard := flag.String("dashboard", common_sli.DynatraceConfigDashboardQUERY, "dashboard ID or 'query' to search for the dashboard matching project, stage and service")
+	start := flag.String("start", "", "start of the evaluation timeframe in RFC3339 format or as unix timestamp (default: end - timeframe)")
+	end := flag.String("end", "", "end of the evaluation timeframe in RFC3339 format or as unix timestamp (default: now)")
+	timeframe := flag.Duration("timeframe", 15*time.Minute, "length of the evaluation timeframe if no start is passed")
+	verbose := flag.Bool("verbose", false, "enable debug logging")
+	flag.Parse()
+
+	if *verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if err := dryRun(*project, *stage, *service, *dashboard, *start, *end, *timeframe); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func dryRun(project string, stage string, service string, dashboard string, start string, end string, timeframe time.Duration) error {
+	if project == "" || stage == "" || service == "" {
+		return fmt.Errorf("project, stage and service are required")
+	}
+
+	startUnix, endUnix, err := parseTimeframe(start, end, timeframe)
+	if err != nil {
+		return err
+	}
+
+	// in local mode resources like dashboard.json are only read from the local disk and the credentials are taken from the environment
+	common_sli.RunLocal = true
+
+	dtCredentials, err := common_sli.GetDTCredentials("dynatrace")
+	if err != nil {
+		return err
+	}
+	if dtCredentials.ApiToken == "" {
+		return fmt.Errorf("DT_TENANT and DT_API_TOKEN environment variables are required")
+	}
+
+	keptnEvent := &common_sli.BaseKeptnEvent{
+		Project: project,
+		Stage:   stage,
+		Service: service,
+	}
+
+	dynatraceHandler := dynatrace.NewDynatraceHandler(
+		dtCredentials.Tenant,
+		keptnEvent,
+		map[string]string{
+			"Authorization": "Api-Token " + dtCredentials.ApiToken,
+			"User-Agent":    "keptn-contrib/dynatrace-service:dashboard-dry-run",
+		},
+		nil, "", "")
+	dynatraceHandler.ForceDashboardParsing = true
+
+	dashboardLink, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err := dynatraceHandler.QueryDynatraceDashboardForSLIs(keptnEvent, dashboard, startUnix, endUnix)
+	if err != nil {
+		return err
+	}
+	if dashboardJSON == nil {
+		return fmt.Errorf("no dashboard found for project %s, stage %s and service %s", project, stage, service)
+	}
+
+	fmt.Printf("Dashboard: %s (%s)\n", dashboardJSON.DashboardMetadata.Name, dashboardLink)
+	fmt.Printf("Timeframe: %s - %s\n\n", startUnix.Format(time.RFC3339), endUnix.Format(time.RFC3339))
+
+	sliContent, err := yaml.Marshal(dashboardSLI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("--- %s\n%s\n", common_sli.DynatraceSLIFilename, string(sliContent))
+
+	sloContent, err := yaml.Marshal(dashboardSLO)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("--- slo.yaml\n%s\n", string(sloContent))
+
+	fmt.Println("--- SLI values")
+	for _, sliResult := range sliResults {
+		if sliResult.Success {
+			fmt.Printf("%s: %f\n", sliResult.Metric, sliResult.Value)
+		} else {
+			fmt.Printf("%s: FAILED - %s\n", sliResult.Metric, sliResult.Message)
+		}
+	}
+
+	tileReportContent, err := yaml.Marshal(dynatraceHandler.GetTileReport())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n--- %s\n%s\n", common_sli.DynatraceTileReportFilename, string(tileReportContent))
+
+	return nil
+}
+
+func parseTimeframe(start string, end string, timeframe time.Duration) (time.Time, time.Time, error) {
+	endUnix := time.Now().UTC()
+	if end != "" {
+		parsedEnd, err := common_sli.ParseUnixTimestamp(end)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("could not parse end %s: %v", end, err)
+		}
+		endUnix = parsedEnd.UTC()
+	}
+
+	startUnix := endUnix.Add(-timeframe)
+	if start != "" {
+		parsedStart, err := common_sli.ParseUnixTimestamp(start)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("could not parse start %s: %v", start, err)
+		}
+		startUnix = parsedStart.UTC()
+	}
+
+	if !startUnix.Before(endUnix) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start %s has to be before end %s", startUnix.Format(time.RFC3339), endUnix.Format(time.RFC3339))
+	}
+
+	return startUnix, endUnix, nil
+}
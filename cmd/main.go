@@ -2,10 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/deadletter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/dedup"
+	"github.com/keptn-contrib/dynatrace-service/pkg/eventlease"
+	"github.com/keptn-contrib/dynatrace-service/pkg/health"
 	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/metrics"
+	"github.com/keptn-contrib/dynatrace-service/pkg/subscription"
+	"github.com/keptn-contrib/dynatrace-service/pkg/tracing"
+	"github.com/keptn-contrib/dynatrace-service/pkg/worker"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
@@ -19,9 +32,37 @@ type envConfig struct {
 	// Port on which to listen for cloudevents
 	Port int    `envconfig:"RCV_PORT" default:"8080"`
 	Path string `envconfig:"RCV_PATH" default:"/"`
+	// Port on which to serve the health and readiness probes
+	HealthPort int `envconfig:"HEALTH_PORT" default:"8070"`
+	// Number of events that are processed concurrently
+	WorkerConcurrency int `envconfig:"WORKER_CONCURRENCY" default:"10"`
+	// Number of events that wait for a worker before further events are rejected
+	WorkerQueueLength int `envconfig:"WORKER_QUEUE_LENGTH" default:"100"`
+	// Time the IDs of processed events are kept to skip events that are delivered again, deduplication is disabled if 0
+	EventDedupTTL time.Duration `envconfig:"EVENT_DEDUP_TTL" default:"10m"`
 }
 
+// eventWorkers processes the received events
+var eventWorkers *worker.Pool
+
+// subscribedEvents restricts the events to the projects and stages this dynatrace-service handles
+var subscribedEvents *subscription.Filter
+
+// processedEvents skips events that the distributor delivers again
+var processedEvents *dedup.Cache
+
+// eventClaimer makes sure only one replica processes an event, it is nil if events don't need to be claimed
+var eventClaimer *eventlease.Claimer
+
+// deadLetters keeps the events that failed to be processed, so that they can be triggered again
+var deadLetters *deadletter.Store
+
+// claimTimeout is the time to wait for the lease of an event before it is processed anyway
+const claimTimeout = 5 * time.Second
+
 func main() {
+	logging.Configure()
+
 	var env envConfig
 	if err := envconfig.Process("", &env); err != nil {
 		log.WithError(err).Fatal("Failed to process env var")
@@ -36,14 +77,49 @@ func main() {
 
 func _main(args []string, env envConfig) int {
 
-	if lib.IsServiceSyncEnabled() {
-		cm, err := credentials.NewCredentialManager(nil)
-		if err != nil {
-			log.WithError(err).Fatal("Failed to initialize CredentialManager")
-		}
+	// the CredentialManager is created once, so that the connection to the secret backend, e.g. the Vault login, is reused by all events
+	cm, err := credentials.NewCredentialManager(nil)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize CredentialManager")
+	}
+	credentials.SetDefaultCredentialManager(cm)
+
+	if lib.IsServiceSyncEnabled(context.Background()) {
 		lib.ActivateServiceSynchronizer(cm)
 	}
 
+	eventWorkers = worker.NewPool(env.WorkerConcurrency, env.WorkerQueueLength)
+	processedEvents = dedup.NewCache(env.EventDedupTTL)
+	subscribedEvents = subscription.NewFilterFromEnv()
+
+	claimer, err := eventlease.NewClaimerFromEnv()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize the event leases")
+	}
+	if claimer != nil {
+		log.WithField("holder", claimer.Holder).Info("Claiming events with leases, so that only one replica processes an event")
+		eventClaimer = claimer
+		go eventClaimer.RunCleanup(context.Background())
+	}
+
+	deadLetters, err = deadletter.NewStoreFromEnv()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize the dead letters")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", health.NewHandler(fmt.Sprintf("127.0.0.1:%d", env.Port), getReadinessChecks()...))
+	mux.Handle("/metrics", metrics.Handler())
+	// the dead letters contain the full events and can be triggered again, so they require the Keptn API token like the Keptn API
+	keptnAPIToken := os.Getenv("KEPTN_API_TOKEN")
+	deadLetterHandler := health.RequireAPIToken(keptnAPIToken, deadletter.NewHandler(deadLetters, retryEvent))
+	mux.Handle("/dead-letters", deadLetterHandler)
+	mux.Handle("/dead-letters/", deadLetterHandler)
+	if lib.IsDashboardDebugEndpointEnabled(context.Background()) {
+		mux.Handle("/debug/dashboard", health.RequireAPIToken(keptnAPIToken, event_handler.NewDashboardDebugHandler()))
+	}
+	go health.ListenAndServe(env.HealthPort, mux)
+
 	ctx := context.Background()
 	ctx = cloudevents.WithEncodingStructured(ctx)
 
@@ -60,13 +136,139 @@ func _main(args []string, env envConfig) int {
 	return 0
 }
 
-func gotEvent(ctx context.Context, event cloudevents.Event) error {
+// claimEvent returns whether this replica processes the event - if the lease can't be created, the event is rather processed twice than not at all
+func claimEvent(event cloudevents.Event, logger *log.Entry) bool {
+	if eventClaimer == nil {
+		return true
+	}
 
-	dynatraceEventHandler, err := event_handler.NewEventHandler(event)
+	ctx, cancel := context.WithTimeout(context.Background(), claimTimeout)
+	defer cancel()
+	claimed, err := eventClaimer.Claim(ctx, event.ID())
+	if err != nil {
+		logger.WithError(err).Warn("Could not claim event - processing it anyway")
+		return true
+	}
+	return claimed
+}
+
+// releaseEvent deletes the lease of an event that couldn't be processed, so that the event isn't skipped by all replicas when it is delivered again
+func releaseEvent(event cloudevents.Event, logger *log.Entry) {
+	if eventClaimer == nil {
+		return
+	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), claimTimeout)
+	defer cancel()
+	if err := eventClaimer.Release(ctx, event.ID()); err != nil {
+		logger.WithError(err).Warn("Could not release event - it is skipped until its lease expires")
+	}
+}
+
+// getReadinessChecks returns the checks of the dependencies that are required to process events
+func getReadinessChecks() []health.ReadinessCheck {
+	checks := []health.ReadinessCheck{
+		{
+			Name: "credentials",
+			Check: func() error {
+				_, err := credentials.GetDynatraceCredentials(nil)
+				return err
+			},
+		},
+	}
+	if !common.RunLocal && !common.RunLocalTest {
+		checks = append(checks, health.ReadinessCheck{Name: "resource-service", Check: func() error {
+			return health.CheckURLIsReachable(common.GetResourceServiceURL())()
+		}})
+	}
+	return checks
+}
+
+/**
+ * gotEvent processes the received event unless it belongs to a project or stage this dynatrace-service isn't subscribed to,
+ * it has been received before or another replica has claimed it already
+ */
+func gotEvent(_ context.Context, event cloudevents.Event) error {
+	logger := logging.FromEvent(event)
+
+	if !subscribedEvents.Matches(event) {
+		logger.Debug("Skipping event as this dynatrace-service isn't subscribed to its project or stage")
+		return nil
+	}
+	if processedEvents.Seen(event.Type(), event.ID()) {
+		logger.Debug("Skipping event as it has already been received")
+		metrics.ObserveDuplicateEvent(event.Type())
+		return nil
+	}
+	if !claimEvent(event, logger) {
+		logger.Debug("Skipping event as it is processed by another replica")
+		return nil
+	}
+
+	err := processEvent(event, logger, false)
 	if err != nil {
+		// the event hasn't been processed, so it may be delivered again
+		processedEvents.Forget(event.Type(), event.ID())
+		releaseEvent(event, logger)
+	}
+	return err
+}
+
+// retryEvent processes a dead letter again - it isn't claimed again, as the replica that triggers it again is the one to process it
+func retryEvent(event cloudevents.Event) error {
+	return processEvent(event, logging.FromEvent(event).WithField("retry", true), true)
+}
+
+/**
+ * processEvent queues the event for one of the eventWorkers and returns right away.
+ * If too many events are waiting, the event is rejected and Keptn is notified if it waits for a response.
+ * An event that fails is stored as dead letter, which is removed once the event was triggered again successfully
+ */
+func processEvent(event cloudevents.Event, logger *log.Entry, isRetry bool) error {
+	received := time.Now()
+
+	// the context of the request ends when the event is acknowledged, so the processing only inherits the logger and the trace
+	ctx := logging.NewContext(context.Background(), logger)
+	ctx, span := tracing.StartEventSpan(ctx, event)
+
+	dynatraceEventHandler, err := event_handler.NewEventHandler(ctx, event)
+	if err != nil {
+		metrics.ObserveEvent(event.Type(), time.Since(received), err)
+		span.End(err)
 		return err
 	}
 
-	return dynatraceEventHandler.HandleEvent()
+	err = eventWorkers.Submit(func() {
+		metrics.ObserveEventQueueWait(event.Type(), time.Since(received))
+		// a panic is handled like a failure, so that the event is stored as dead letter and observed in the metrics and the trace
+		err := worker.Recover(dynatraceEventHandler.HandleEvent)
+		if errors.Is(err, worker.ErrPanic) {
+			// the handler didn't get the chance to respond, so Keptn is notified if it waits for a response
+			if rejectErr := event_handler.RejectEvent(dynatraceEventHandler, err); rejectErr != nil {
+				logger.WithError(rejectErr).Error("Could not respond to event that caused a panic")
+			}
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to process event")
+			if deadLetterErr := deadLetters.Add(event, err); deadLetterErr != nil {
+				logger.WithError(deadLetterErr).Error("Could not store failed event as dead letter")
+			}
+		} else if isRetry {
+			if deadLetterErr := deadLetters.Remove(event.ID()); deadLetterErr != nil && deadLetterErr != deadletter.ErrNotFound {
+				logger.WithError(deadLetterErr).Error("Could not remove dead letter of successfully processed event")
+			}
+		}
+		metrics.ObserveEvent(event.Type(), time.Since(received), err)
+		span.End(err)
+	})
+	if err != nil {
+		logger.WithError(err).WithField("queueLength", eventWorkers.QueueLength()).Error("Rejecting event")
+		metrics.ObserveRejectedEvent(event.Type())
+		if rejectErr := event_handler.RejectEvent(dynatraceEventHandler, err); rejectErr != nil {
+			logger.WithError(rejectErr).Error("Could not respond to rejected event")
+		}
+		span.End(err)
+		return err
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package adapter
 
 import (
+	"errors"
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
 	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
@@ -68,31 +69,89 @@ func (a DeploymentFinishedAdapter) GetDeploymentStrategy() string {
 
 // GetImage returns the deployed image
 func (a DeploymentFinishedAdapter) GetImage() string {
-	imageAndTag := a.getImageAndTag()
-	if imageAndTag == "n/a" {
-		return imageAndTag
+	return getImage(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
+}
+
+// GetTag returns the deployed tag
+func (a DeploymentFinishedAdapter) GetTag() string {
+	return getTag(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
+}
+
+// GetConfigurationChange returns the configuration values changed by the deployment except for the image, e.g: replicaCount=2 for a scaling remediation action
+func (a DeploymentFinishedAdapter) GetConfigurationChange() map[string]interface{} {
+	triggeredData, err := getDeploymentTriggeredEventData(a.GetProject(), a.GetStage(), a.GetService(), a.context)
+	if err != nil {
+		return nil
 	}
-	split := strings.Split(imageAndTag, ":")
-	return split[0]
+
+	configurationChange := make(map[string]interface{})
+	for key, value := range triggeredData.ConfigurationChange.Values {
+		if !strings.HasSuffix(key, "image") {
+			configurationChange[key] = value
+		}
+	}
+	return configurationChange
+}
+
+// GetGitCommit returns the git commit of the deployed version
+func (a DeploymentFinishedAdapter) GetGitCommit() string {
+	return a.event.Deployment.GitCommit
+}
+
+// IsPartOfRemediation checks wether the deployment.finished event is part of a remediation task sequence
+func (a DeploymentFinishedAdapter) IsPartOfRemediation() bool {
+	return isPartOfRemediation(a.GetProject(), a.GetStage(), a.GetService(), a.context)
+}
+
+// GetLabels returns a map of labels
+func (a DeploymentFinishedAdapter) GetLabels() map[string]string {
+	labels := a.event.Labels
+	keptnBridgeURL, err := credentials.GetKeptnBridgeURL()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if err == nil {
+		labels[common.KEPTNSBRIDGE_LABEL] = keptnBridgeURL + "/trace/" + a.GetShKeptnContext()
+	}
+	if len(a.event.Deployment.DeploymentURIsLocal) > 0 {
+		labels["deploymentURILocal"] = a.event.Deployment.DeploymentURIsLocal[0]
+	}
+	if len(a.event.Deployment.DeploymentURIsPublic) > 0 {
+		labels["deploymentURIPublic"] = a.event.Deployment.DeploymentURIsPublic[0]
+	}
+	return labels
 }
 
-func (a DeploymentFinishedAdapter) getImageAndTag() string {
+// getDeploymentTriggeredEventData returns the data of the deployment.triggered event of the passed KeptnContext
+func getDeploymentTriggeredEventData(project string, stage string, service string, keptnContext string) (*keptnv2.DeploymentTriggeredEventData, error) {
 	eventHandler := keptnapi.NewEventHandler(os.Getenv("DATASTORE"))
 
-	notAvailable := "n/a"
 	events, errObj := eventHandler.GetEvents(&keptnapi.EventFilter{
-		Project:      a.GetProject(),
-		Stage:        a.GetStage(),
-		Service:      a.GetService(),
+		Project:      project,
+		Stage:        stage,
+		Service:      service,
 		EventType:    keptnv2.GetTriggeredEventType(keptnv2.DeploymentTaskName),
-		KeptnContext: a.context,
+		KeptnContext: keptnContext,
 	})
-	if errObj != nil || events == nil || len(events) == 0 {
-		return notAvailable
+	if errObj != nil {
+		return nil, errors.New("could not retrieve deployment.triggered event: " + *errObj.Message)
+	}
+	if len(events) == 0 {
+		return nil, errors.New("could not retrieve deployment.triggered event: no events returned")
 	}
 
 	triggeredData := &keptnv2.DeploymentTriggeredEventData{}
 	err := keptnv2.Decode(events[0].Data, triggeredData)
+	if err != nil {
+		return nil, err
+	}
+	return triggeredData, nil
+}
+
+// getDeployedImageAndTag returns the image of the deployment.triggered event of the passed KeptnContext, e.g: docker.io/keptnexamples/carts:0.12.1, or n/a if it can't be found
+func getDeployedImageAndTag(project string, stage string, service string, keptnContext string) string {
+	notAvailable := "n/a"
+	triggeredData, err := getDeploymentTriggeredEventData(project, stage, service, keptnContext)
 	if err != nil {
 		return notAvailable
 	}
@@ -104,10 +163,18 @@ func (a DeploymentFinishedAdapter) getImageAndTag() string {
 	return notAvailable
 }
 
-// GetTag returns the deployed tag
-func (a DeploymentFinishedAdapter) GetTag() string {
+// getImage returns the image part of an image and tag string
+func getImage(imageAndTag string) string {
+	if imageAndTag == "n/a" {
+		return imageAndTag
+	}
+	split := strings.Split(imageAndTag, ":")
+	return split[0]
+}
+
+// getTag returns the tag part of an image and tag string or n/a if it doesn't contain a tag
+func getTag(imageAndTag string) string {
 	notAvailable := "n/a"
-	imageAndTag := a.getImageAndTag()
 	if imageAndTag == notAvailable {
 		return imageAndTag
 	}
@@ -117,22 +184,3 @@ func (a DeploymentFinishedAdapter) GetTag() string {
 	}
 	return split[1]
 }
-
-// GetLabels returns a map of labels
-func (a DeploymentFinishedAdapter) GetLabels() map[string]string {
-	labels := a.event.Labels
-	keptnBridgeURL, err := credentials.GetKeptnBridgeURL()
-	if labels == nil {
-		labels = make(map[string]string)
-	}
-	if err == nil {
-		labels[common.KEPTNSBRIDGE_LABEL] = keptnBridgeURL + "/trace/" + a.GetShKeptnContext()
-	}
-	if len(a.event.Deployment.DeploymentURIsLocal) > 0 {
-		labels["deploymentURILocal"] = a.event.Deployment.DeploymentURIsLocal[0]
-	}
-	if len(a.event.Deployment.DeploymentURIsPublic) > 0 {
-		labels["deploymentURIPublic"] = a.event.Deployment.DeploymentURIsPublic[0]
-	}
-	return labels
-}
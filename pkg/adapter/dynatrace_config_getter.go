@@ -1,6 +1,7 @@
 package adapter
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,8 @@ import (
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
 	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn/go-utils/pkg/api/models"
 	api "github.com/keptn/go-utils/pkg/api/utils"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -20,10 +23,13 @@ type DynatraceConfigGetterInterface interface {
 }
 
 type DynatraceConfigGetter struct {
+	// EventContext is the context of the processed event, it carries the logger used while loading the configuration
+	EventContext context.Context
 }
 
 // GetDynatraceConfig loads the dynatrace.conf.yaml from the GIT repo
 func (d *DynatraceConfigGetter) GetDynatraceConfig(event EventContentAdapter) (*config.DynatraceConfigFile, error) {
+	logger := logging.FromContext(d.EventContext)
 
 	// if we run in a runlocal mode we are just getting the file from the local disk
 	var fileContent string
@@ -31,7 +37,7 @@ func (d *DynatraceConfigGetter) GetDynatraceConfig(event EventContentAdapter) (*
 		localFileContent, err := ioutil.ReadFile(config.DynatraceConfigFilenameLOCAL)
 		if err != nil {
 
-			log.WithError(err).WithFields(log.Fields{
+			logger.WithError(err).WithFields(log.Fields{
 				"dynatraceConfigFilename": config.DynatraceConfigFilenameLOCAL,
 				"service":                 event.GetService(),
 				"stage":                   event.GetStage(),
@@ -39,11 +45,11 @@ func (d *DynatraceConfigGetter) GetDynatraceConfig(event EventContentAdapter) (*
 			}).Info("No configuration file was found LOCALLY")
 			return nil, nil
 		}
-		log.WithField("dynatraceConfigFilename", config.DynatraceConfigFilenameLOCAL).Info("Loaded LOCAL configuration file")
+		logger.WithField("dynatraceConfigFilename", config.DynatraceConfigFilenameLOCAL).Info("Loaded LOCAL configuration file")
 		fileContent = string(localFileContent)
 	} else {
 		var err error
-		fileContent, err = getDynatraceConfigResource(event)
+		fileContent, err = getDynatraceConfigResource(logger, event)
 		if err != nil {
 			return nil, err
 		}
@@ -52,9 +58,9 @@ func (d *DynatraceConfigGetter) GetDynatraceConfig(event EventContentAdapter) (*
 	if len(fileContent) > 0 {
 
 		// replace the placeholders
-		log.WithField("fileContent", fileContent).Debug("Original contents of configuration file")
+		logger.WithField("fileContent", fileContent).Debug("Original contents of configuration file")
 		fileContent = replaceKeptnPlaceholders(fileContent, event)
-		log.WithField("fileContent", fileContent).Debug("Contents of configuration file after replacements")
+		logger.WithField("fileContent", fileContent).Debug("Contents of configuration file after replacements")
 	}
 
 	// unmarshal the file
@@ -65,18 +71,55 @@ func (d *DynatraceConfigGetter) GetDynatraceConfig(event EventContentAdapter) (*
 		return nil, errors.New(errMsg)
 	}
 
+	if dynatraceConfFile.DtCreds == "" && !common.RunLocal {
+		dynatraceConfFile.DtCreds = replaceKeptnPlaceholders(getDtCredsOfParentConfigs(event), event)
+	}
+
 	return dynatraceConfFile, nil
 }
 
-func getDynatraceConfigResource(event EventContentAdapter) (string, error) {
+/**
+ * getDtCredsOfParentConfigs returns the dtCreds of the stage or project dynatrace.conf.yaml if the dynatrace.conf.yaml that is used doesn't define it,
+ * e.g: a service-level dynatrace.conf.yaml that only defines a dashboard still uses the credentials of the stage
+ */
+func getDtCredsOfParentConfigs(event EventContentAdapter) string {
+	if event.GetProject() == "" {
+		return ""
+	}
+	resourceHandler := common.NewResourceHandler()
+
+	var parentConfigs []func() (*models.Resource, error)
+	if event.GetStage() != "" {
+		parentConfigs = append(parentConfigs, func() (*models.Resource, error) {
+			return resourceHandler.GetStageResource(event.GetProject(), event.GetStage(), config.DynatraceConfigFilename)
+		})
+	}
+	parentConfigs = append(parentConfigs, func() (*models.Resource, error) {
+		return resourceHandler.GetProjectResource(event.GetProject(), config.DynatraceConfigFilename)
+	})
+
+	for _, getParentConfig := range parentConfigs {
+		resource, err := getParentConfig()
+		if err != nil || resource == nil {
+			continue
+		}
+		parentConfig, err := parseDynatraceConfigFile([]byte(resource.ResourceContent))
+		if err == nil && parentConfig.DtCreds != "" {
+			return parentConfig.DtCreds
+		}
+	}
+	return ""
+}
+
+func getDynatraceConfigResource(logger *log.Entry, event EventContentAdapter) (string, error) {
 
-	resourceHandler := api.NewResourceHandler(common.GetConfigurationServiceURL())
+	resourceHandler := common.NewResourceHandler()
 
 	// Lets search on SERVICE-LEVEL
 	if len(event.GetProject()) > 0 && len(event.GetStage()) > 0 && len(event.GetService()) > 0 {
 		keptnResourceContent, err := resourceHandler.GetServiceResource(event.GetProject(), event.GetStage(), event.GetService(), config.DynatraceConfigFilename)
 		if err == api.ResourceNotFoundError {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"project": event.GetProject(),
 					"stage":   event.GetStage(),
@@ -85,7 +128,7 @@ func getDynatraceConfigResource(event EventContentAdapter) (string, error) {
 		} else if err != nil {
 			return "", fmt.Errorf("failed to retrieve dynatrace.conf.yaml in project %s at stage %s for service %s: %v", event.GetProject(), event.GetStage(), event.GetService(), err)
 		} else {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"project": event.GetProject(),
 					"stage":   event.GetStage(),
@@ -98,7 +141,7 @@ func getDynatraceConfigResource(event EventContentAdapter) (string, error) {
 	if len(event.GetProject()) > 0 && len(event.GetStage()) > 0 {
 		keptnResourceContent, err := resourceHandler.GetStageResource(event.GetProject(), event.GetStage(), config.DynatraceConfigFilename)
 		if err == api.ResourceNotFoundError {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"project": event.GetProject(),
 					"stage":   event.GetStage(),
@@ -106,7 +149,7 @@ func getDynatraceConfigResource(event EventContentAdapter) (string, error) {
 		} else if err != nil {
 			return "", fmt.Errorf("failed to retrieve dynatrace.conf.yaml in project %s at stage %s: %v", event.GetProject(), event.GetStage(), err)
 		} else {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"project": event.GetProject(),
 					"stage":   event.GetStage(),
@@ -118,16 +161,16 @@ func getDynatraceConfigResource(event EventContentAdapter) (string, error) {
 	if len(event.GetProject()) > 0 {
 		keptnResourceContent, err := resourceHandler.GetProjectResource(event.GetProject(), config.DynatraceConfigFilename)
 		if err == api.ResourceNotFoundError {
-			log.WithField("project", event.GetProject()).Info("No dynatrace.conf.yaml available for project")
+			logger.WithField("project", event.GetProject()).Info("No dynatrace.conf.yaml available for project")
 		} else if err != nil {
 			return "", fmt.Errorf("failed to retrieve dynatrace.conf.yaml in project %s: %v", event.GetProject(), err)
 		} else {
-			log.WithField("project", event.GetProject()).Info("Found dynatrace.conf.yaml for project")
+			logger.WithField("project", event.GetProject()).Info("Found dynatrace.conf.yaml for project")
 			return keptnResourceContent.ResourceContent, nil
 		}
 	}
 
-	log.Info("No dynatrace.conf.yaml found")
+	logger.Info("No dynatrace.conf.yaml found")
 	return "", nil
 }
 
@@ -94,14 +94,19 @@ func (a EvaluationFinishedAdapter) GetLabels() map[string]string {
 
 // IsPartOfRemediation checks wether the evaluation.finished event is part of a remediation task sequence
 func (a EvaluationFinishedAdapter) IsPartOfRemediation() bool {
+	return isPartOfRemediation(a.GetProject(), a.GetStage(), a.GetService(), a.context)
+}
+
+// isPartOfRemediation checks whether there is a remediation.triggered event for the passed KeptnContext
+func isPartOfRemediation(project string, stage string, service string, keptnContext string) bool {
 	eventHandler := keptnapi.NewEventHandler(os.Getenv("DATASTORE"))
 
 	events, errObj := eventHandler.GetEvents(&keptnapi.EventFilter{
-		Project:      a.GetProject(),
-		Stage:        a.GetStage(),
-		Service:      a.GetService(),
+		Project:      project,
+		Stage:        stage,
+		Service:      service,
 		EventType:    keptnv2.GetTriggeredEventType("remediation"),
-		KeptnContext: a.context,
+		KeptnContext: keptnContext,
 	})
 	if errObj != nil || events == nil || len(events) == 0 {
 		return false
@@ -0,0 +1,78 @@
+package adapter
+
+import (
+	keptn "github.com/keptn/go-utils/pkg/lib"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// ProblemAdapter godoc
+type ProblemAdapter struct {
+	event   keptnv2.EventData
+	context string
+	source  string
+}
+
+// NewProblemAdapter godoc
+func NewProblemAdapter(event keptnv2.EventData, shkeptncontext, source string) ProblemAdapter {
+	return ProblemAdapter{event: event, context: shkeptncontext, source: source}
+}
+
+// GetShKeptnContext returns the shkeptncontext
+func (a ProblemAdapter) GetShKeptnContext() string {
+	return a.context
+}
+
+// GetSource returns the source specified in the CloudEvent context
+func (a ProblemAdapter) GetSource() string {
+	return a.source
+}
+
+// GetEvent returns the event type
+func (a ProblemAdapter) GetEvent() string {
+	return keptn.ProblemEventType
+}
+
+// GetProject returns the project
+func (a ProblemAdapter) GetProject() string {
+	return a.event.Project
+}
+
+// GetStage returns the stage
+func (a ProblemAdapter) GetStage() string {
+	return a.event.Stage
+}
+
+// GetService returns the service
+func (a ProblemAdapter) GetService() string {
+	return a.event.Service
+}
+
+// GetDeployment returns the name of the deployment
+func (a ProblemAdapter) GetDeployment() string {
+	return ""
+}
+
+// GetTestStrategy returns the used test strategy
+func (a ProblemAdapter) GetTestStrategy() string {
+	return ""
+}
+
+// GetDeploymentStrategy returns the used deployment strategy
+func (a ProblemAdapter) GetDeploymentStrategy() string {
+	return ""
+}
+
+// GetImage returns the deployed image
+func (a ProblemAdapter) GetImage() string {
+	return ""
+}
+
+// GetTag returns the deployed tag
+func (a ProblemAdapter) GetTag() string {
+	return ""
+}
+
+// GetLabels returns a map of labels
+func (a ProblemAdapter) GetLabels() map[string]string {
+	return a.event.Labels
+}
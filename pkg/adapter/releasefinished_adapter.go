@@ -0,0 +1,86 @@
+package adapter
+
+import (
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// ReleaseFinishedAdapter godoc
+type ReleaseFinishedAdapter struct {
+	event   keptnv2.ReleaseFinishedEventData
+	context string
+	source  string
+}
+
+// NewReleaseFinishedAdapter godoc
+func NewReleaseFinishedAdapter(event keptnv2.ReleaseFinishedEventData, shkeptncontext, source string) ReleaseFinishedAdapter {
+	return ReleaseFinishedAdapter{event: event, context: shkeptncontext}
+}
+
+// GetShKeptnContext returns the shkeptncontext
+func (a ReleaseFinishedAdapter) GetShKeptnContext() string {
+	return a.context
+}
+
+// GetSource returns the source specified in the CloudEvent context
+func (a ReleaseFinishedAdapter) GetSource() string {
+	return a.source
+}
+
+// GetEvent returns the event type
+func (a ReleaseFinishedAdapter) GetEvent() string {
+	return keptnv2.GetFinishedEventType(keptnv2.ReleaseTaskName)
+}
+
+// GetProject returns the project
+func (a ReleaseFinishedAdapter) GetProject() string {
+	return a.event.Project
+}
+
+// GetStage returns the stage
+func (a ReleaseFinishedAdapter) GetStage() string {
+	return a.event.Stage
+}
+
+// GetService returns the service
+func (a ReleaseFinishedAdapter) GetService() string {
+	return a.event.Service
+}
+
+// GetDeployment returns the name of the deployment
+func (a ReleaseFinishedAdapter) GetDeployment() string {
+	return ""
+}
+
+// GetTestStrategy returns the used Test strategy
+func (a ReleaseFinishedAdapter) GetTestStrategy() string {
+	return ""
+}
+
+// GetDeploymentStrategy returns the used Deployment strategy
+func (a ReleaseFinishedAdapter) GetDeploymentStrategy() string {
+	return ""
+}
+
+// GetImage returns the deployed image
+func (a ReleaseFinishedAdapter) GetImage() string {
+	return getImage(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
+}
+
+// GetTag returns the deployed tag
+func (a ReleaseFinishedAdapter) GetTag() string {
+	return getTag(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
+}
+
+// GetLabels returns a map of labels
+func (a ReleaseFinishedAdapter) GetLabels() map[string]string {
+	labels := a.event.Labels
+	keptnBridgeURL, err := credentials.GetKeptnBridgeURL()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if err == nil {
+		labels["Keptns Bridge"] = keptnBridgeURL + "/trace/" + a.GetShKeptnContext()
+	}
+	return labels
+}
@@ -29,7 +29,7 @@ func (a ReleaseTriggeredAdapter) GetSource() string {
 
 // GetEvent returns the event type
 func (a ReleaseTriggeredAdapter) GetEvent() string {
-	return keptnv2.GetFinishedEventType(keptnv2.ReleaseTaskName)
+	return keptnv2.GetTriggeredEventType(keptnv2.ReleaseTaskName)
 }
 
 // GetProject returns the project
@@ -64,12 +64,12 @@ func (a ReleaseTriggeredAdapter) GetDeploymentStrategy() string {
 
 // GetImage returns the deployed image
 func (a ReleaseTriggeredAdapter) GetImage() string {
-	return ""
+	return getImage(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
 }
 
 // GetTag returns the deployed tag
 func (a ReleaseTriggeredAdapter) GetTag() string {
-	return ""
+	return getTag(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
 }
 
 // GetLabels returns a map of labels
@@ -0,0 +1,86 @@
+package adapter
+
+import (
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// RollbackFinishedAdapter godoc
+type RollbackFinishedAdapter struct {
+	event   keptnv2.RollbackFinishedEventData
+	context string
+	source  string
+}
+
+// NewRollbackFinishedAdapter godoc
+func NewRollbackFinishedAdapter(event keptnv2.RollbackFinishedEventData, shkeptncontext, source string) RollbackFinishedAdapter {
+	return RollbackFinishedAdapter{event: event, context: shkeptncontext}
+}
+
+// GetShKeptnContext returns the shkeptncontext
+func (a RollbackFinishedAdapter) GetShKeptnContext() string {
+	return a.context
+}
+
+// GetSource returns the source specified in the CloudEvent context
+func (a RollbackFinishedAdapter) GetSource() string {
+	return a.source
+}
+
+// GetEvent returns the event type
+func (a RollbackFinishedAdapter) GetEvent() string {
+	return keptnv2.GetFinishedEventType(keptnv2.RollbackTaskName)
+}
+
+// GetProject returns the project
+func (a RollbackFinishedAdapter) GetProject() string {
+	return a.event.Project
+}
+
+// GetStage returns the stage
+func (a RollbackFinishedAdapter) GetStage() string {
+	return a.event.Stage
+}
+
+// GetService returns the service
+func (a RollbackFinishedAdapter) GetService() string {
+	return a.event.Service
+}
+
+// GetDeployment returns the name of the deployment
+func (a RollbackFinishedAdapter) GetDeployment() string {
+	return ""
+}
+
+// GetTestStrategy returns the used Test strategy
+func (a RollbackFinishedAdapter) GetTestStrategy() string {
+	return ""
+}
+
+// GetDeploymentStrategy returns the used Deployment strategy
+func (a RollbackFinishedAdapter) GetDeploymentStrategy() string {
+	return ""
+}
+
+// GetImage returns the image that was rolled back
+func (a RollbackFinishedAdapter) GetImage() string {
+	return getImage(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
+}
+
+// GetTag returns the tag that was rolled back
+func (a RollbackFinishedAdapter) GetTag() string {
+	return getTag(getDeployedImageAndTag(a.GetProject(), a.GetStage(), a.GetService(), a.context))
+}
+
+// GetLabels returns a map of labels
+func (a RollbackFinishedAdapter) GetLabels() map[string]string {
+	labels := a.event.Labels
+	keptnBridgeURL, err := credentials.GetKeptnBridgeURL()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if err == nil {
+		labels["Keptns Bridge"] = keptnBridgeURL + "/trace/" + a.GetShKeptnContext()
+	}
+	return labels
+}
@@ -0,0 +1,78 @@
+package adapter
+
+import (
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// TaskEventAdapter is an adapter for the common data of any task event, e.g: sh.keptn.event.deployment.triggered
+type TaskEventAdapter struct {
+	event     keptnv2.EventData
+	eventType string
+	context   string
+	source    string
+}
+
+// NewTaskEventAdapter godoc
+func NewTaskEventAdapter(event keptnv2.EventData, eventType, shkeptncontext, source string) TaskEventAdapter {
+	return TaskEventAdapter{event: event, eventType: eventType, context: shkeptncontext, source: source}
+}
+
+// GetShKeptnContext returns the shkeptncontext
+func (a TaskEventAdapter) GetShKeptnContext() string {
+	return a.context
+}
+
+// GetSource returns the source specified in the CloudEvent context
+func (a TaskEventAdapter) GetSource() string {
+	return a.source
+}
+
+// GetEvent returns the event type
+func (a TaskEventAdapter) GetEvent() string {
+	return a.eventType
+}
+
+// GetProject returns the project
+func (a TaskEventAdapter) GetProject() string {
+	return a.event.Project
+}
+
+// GetStage returns the stage
+func (a TaskEventAdapter) GetStage() string {
+	return a.event.Stage
+}
+
+// GetService returns the service
+func (a TaskEventAdapter) GetService() string {
+	return a.event.Service
+}
+
+// GetDeployment returns the name of the deployment
+func (a TaskEventAdapter) GetDeployment() string {
+	return ""
+}
+
+// GetTestStrategy returns the used test strategy
+func (a TaskEventAdapter) GetTestStrategy() string {
+	return ""
+}
+
+// GetDeploymentStrategy returns the used deployment strategy
+func (a TaskEventAdapter) GetDeploymentStrategy() string {
+	return ""
+}
+
+// GetImage returns the deployed image
+func (a TaskEventAdapter) GetImage() string {
+	return ""
+}
+
+// GetTag returns the deployed tag
+func (a TaskEventAdapter) GetTag() string {
+	return ""
+}
+
+// GetLabels returns a map of labels
+func (a TaskEventAdapter) GetLabels() map[string]string {
+	return a.event.Labels
+}
@@ -120,3 +120,34 @@ func FindProblemIDForEvent(keptnHandler *keptnv2.Keptn, labels map[string]string
 
 	return problemOpenEvent.PID, nil
 }
+
+/**
+ * Returns the test strategy of the test.triggered event of the current KeptnContext and stage
+ * This is needed because the test.finished event doesn't contain the test strategy
+ */
+func FindTestStrategyForEvent(keptnHandler *keptnv2.Keptn, stage string) (string, error) {
+	eventHandler := keptnapi.NewEventHandler(os.Getenv("DATASTORE"))
+
+	events, errObj := eventHandler.GetEvents(&keptnapi.EventFilter{
+		Project:      keptnHandler.KeptnBase.Event.GetProject(),
+		Stage:        stage,
+		EventType:    keptnv2.GetTriggeredEventType(keptnv2.TestTaskName),
+		KeptnContext: keptnHandler.KeptnContext,
+	})
+
+	if errObj != nil {
+		return "", errors.New("could not retrieve test.triggered event for incoming event: " + *errObj.Message)
+	}
+
+	if len(events) == 0 {
+		return "", errors.New("could not retrieve test.triggered event for incoming event: no events returned")
+	}
+
+	testTriggeredEvent := &keptnv2.TestTriggeredEventData{}
+	err := keptnv2.Decode(events[0].Data, testTriggeredEvent)
+	if err != nil {
+		return "", errors.New("could not decode test.triggered event: " + err.Error())
+	}
+
+	return testTriggeredEvent.Test.TestStrategy, nil
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	keptnmodels "github.com/keptn/go-utils/pkg/api/models"
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
+)
+
+const resourceService = "RESOURCE_SERVICE"
+const defaultResourceServiceURL = "http://resource-service:8080"
+
+// resourceServiceDetectionInterval is the time after which it is checked again whether the control plane runs the resource-service, e.g. after Keptn has been upgraded
+const resourceServiceDetectionInterval = 5 * time.Minute
+
+var resourceServiceDetection struct {
+	mutex      sync.Mutex
+	detectedAt time.Time
+	available  bool
+}
+
+// isResourceServiceAvailable returns true if the resource-service responds at all, the configuration-service is used if it can't be reached.
+// The request doesn't use the HTTP proxy, as the resource-service runs in the cluster
+var isResourceServiceAvailable = func() bool {
+	client := &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{}}
+	resp, err := client.Get(defaultResourceServiceURL)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+/**
+ * GetResourceServiceURL returns the endpoint of the service that stores the Keptn resources, e.g. the dynatrace.conf.yaml.
+ * RESOURCE_SERVICE and CONFIGURATION_SERVICE are used if they are set, otherwise the resource-service of current Keptn control planes
+ * is detected and the configuration-service is used for control planes that don't run it
+ */
+func GetResourceServiceURL() string {
+	if os.Getenv(resourceService) != "" {
+		return getKeptnServiceURL(resourceService, defaultResourceServiceURL)
+	}
+	if os.Getenv(configurationService) != "" {
+		return GetConfigurationServiceURL()
+	}
+
+	resourceServiceDetection.mutex.Lock()
+	defer resourceServiceDetection.mutex.Unlock()
+	if time.Since(resourceServiceDetection.detectedAt) > resourceServiceDetectionInterval {
+		resourceServiceDetection.available = isResourceServiceAvailable()
+		resourceServiceDetection.detectedAt = time.Now()
+	}
+	if resourceServiceDetection.available {
+		return defaultResourceServiceURL
+	}
+	return defaultConfigurationServiceURL
+}
+
+/**
+ * NewResourceHandler creates a ResourceHandler for the Keptn resources at GetResourceServiceURL. If RESOURCE_SERVICE is set, e.g. to the
+ * resource-service of the Keptn API at https://keptn.example.com/api/resource-service, the requests are authenticated with the KEPTN_API_TOKEN
+ */
+func NewResourceHandler() *keptnapi.ResourceHandler {
+	resourceServiceURL := GetResourceServiceURL()
+	resourceHandler := keptnapi.NewResourceHandler(strings.TrimSuffix(resourceServiceURL, "/"))
+	if parsedURL, err := url.Parse(resourceServiceURL); err == nil && parsedURL.Scheme == "https" {
+		resourceHandler.Scheme = "https"
+	}
+	if os.Getenv(resourceService) != "" && os.Getenv("KEPTN_API_TOKEN") != "" {
+		resourceHandler.AuthHeader = "x-token"
+		resourceHandler.AuthToken = os.Getenv("KEPTN_API_TOKEN")
+	}
+	return resourceHandler
+}
+
+// GetAllProjectResourceURIs returns the URIs of all resources of the project, as the ResourceHandler can only list the resources of stages and services
+func GetAllProjectResourceURIs(resourceHandler *keptnapi.ResourceHandler, project string) ([]string, error) {
+	resourceURIs := []string{}
+	nextPageKey := ""
+	for {
+		query := url.Values{}
+		if nextPageKey != "" {
+			query.Set("nextPageKey", nextPageKey)
+		}
+		req, err := http.NewRequest(http.MethodGet, resourceHandler.Scheme+"://"+resourceHandler.BaseURL+"/v1/project/"+url.PathEscape(project)+"/resource?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if resourceHandler.AuthHeader != "" && resourceHandler.AuthToken != "" {
+			req.Header.Set(resourceHandler.AuthHeader, resourceHandler.AuthToken)
+		}
+
+		resp, err := resourceHandler.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("could not list the resources of project %s: received status code %d", project, resp.StatusCode)
+		}
+
+		resources := &keptnmodels.Resources{}
+		if err := json.Unmarshal(body, resources); err != nil {
+			return nil, fmt.Errorf("could not parse the resources of project %s: %v", project, err)
+		}
+		for _, resource := range resources.Resources {
+			if resource.ResourceURI != nil {
+				resourceURIs = append(resourceURIs, *resource.ResourceURI)
+			}
+		}
+
+		if resources.NextPageKey == "" || resources.NextPageKey == "0" {
+			return resourceURIs, nil
+		}
+		nextPageKey = resources.NextPageKey
+	}
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
+)
+
+func TestGetResourceServiceURL(t *testing.T) {
+	resourceServiceAvailable := true
+	isResourceServiceAvailable = func() bool { return resourceServiceAvailable }
+
+	if got := GetResourceServiceURL(); got != defaultResourceServiceURL {
+		t.Errorf("GetResourceServiceURL() = %s, want %s if the resource-service is available", got, defaultResourceServiceURL)
+	}
+
+	resourceServiceAvailable = false
+	resourceServiceDetection.detectedAt = time.Time{}
+	if got := GetResourceServiceURL(); got != defaultConfigurationServiceURL {
+		t.Errorf("GetResourceServiceURL() = %s, want %s if the resource-service isn't available", got, defaultConfigurationServiceURL)
+	}
+
+	os.Setenv("CONFIGURATION_SERVICE", "http://localhost:8081/configuration-service")
+	defer os.Unsetenv("CONFIGURATION_SERVICE")
+	if got := GetResourceServiceURL(); got != "http://localhost:8081/configuration-service" {
+		t.Errorf("GetResourceServiceURL() = %s, want the CONFIGURATION_SERVICE", got)
+	}
+	if resourceHandler := NewResourceHandler(); resourceHandler.AuthToken != "" {
+		t.Errorf("NewResourceHandler() authenticates with %s, want no authentication for the configuration-service", resourceHandler.AuthToken)
+	}
+
+	os.Setenv("RESOURCE_SERVICE", "https://keptn.example.com/api/resource-service/")
+	defer os.Unsetenv("RESOURCE_SERVICE")
+	os.Setenv("KEPTN_API_TOKEN", "my-token")
+	defer os.Unsetenv("KEPTN_API_TOKEN")
+	resourceHandler := NewResourceHandler()
+	if resourceHandler.Scheme != "https" || resourceHandler.BaseURL != "keptn.example.com/api/resource-service" {
+		t.Errorf("NewResourceHandler() = %s://%s, want https://keptn.example.com/api/resource-service", resourceHandler.Scheme, resourceHandler.BaseURL)
+	}
+	if resourceHandler.AuthHeader != "x-token" || resourceHandler.AuthToken != "my-token" {
+		t.Errorf("NewResourceHandler() authenticates with %s: %s, want x-token: my-token", resourceHandler.AuthHeader, resourceHandler.AuthToken)
+	}
+}
+
+func TestGetAllProjectResourceURIs(t *testing.T) {
+	resourceServiceMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/project/sockshop/resource" || r.Header.Get("x-token") != "my-token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("nextPageKey") == "" {
+			w.Write([]byte(`{"nextPageKey": "1", "resources": [{"resourceURI": "/shipyard.yaml"}]}`))
+			return
+		}
+		w.Write([]byte(`{"nextPageKey": "0", "resources": [{"resourceURI": "/dynatrace/monaco/dashboard/dashboards.yaml"}]}`))
+	}))
+	defer resourceServiceMock.Close()
+
+	resourceHandler := keptnapi.NewResourceHandler(resourceServiceMock.URL)
+	resourceHandler.AuthHeader = "x-token"
+	resourceHandler.AuthToken = "my-token"
+
+	got, err := GetAllProjectResourceURIs(resourceHandler, "sockshop")
+	if err != nil {
+		t.Fatalf("GetAllProjectResourceURIs() error = %v", err)
+	}
+	if len(got) != 2 || got[0] != "/shipyard.yaml" || got[1] != "/dynatrace/monaco/dashboard/dashboards.yaml" {
+		t.Errorf("GetAllProjectResourceURIs() = %v, want the resources of both pages", got)
+	}
+
+	if _, err := GetAllProjectResourceURIs(resourceHandler, "other"); err == nil {
+		t.Errorf("GetAllProjectResourceURIs() expected an error for an unknown project")
+	}
+}
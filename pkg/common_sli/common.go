@@ -1,12 +1,17 @@
 package common_sli
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,10 +23,12 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	keptnmodels "github.com/keptn/go-utils/pkg/api/models"
-	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
 	keptncommon "github.com/keptn/go-utils/pkg/lib"
 	"github.com/keptn/go-utils/pkg/lib/keptn"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 )
 
 var RunLocal = (os.Getenv("ENV") == "local")
@@ -33,6 +40,14 @@ var RunLocalTest = (os.Getenv("ENV") == "localtest")
 const DynatraceDashboardFilename = "dynatrace/dashboard.json"
 const DynatraceSLIFilename = "dynatrace/sli.yaml"
 const KeptnSLOFilename = "slo.yaml"
+const DynatraceDashboardHistoryFolder = "dynatrace/history/"
+const DynatraceTileReportFilename = "dynatrace/tile-report.yaml"
+const DynatraceSLIResultsFolder = "dynatrace/results/"
+
+// DefaultSLIResultsExportRetention is the number of SLI results exports per format that are kept for a service if exportSLIResultsRetention isn't set
+const DefaultSLIResultsExportRetention = 20
+
+const sliResultsExportTimeFormat = "20060102T150405Z"
 
 const ConfigLevelProject = "Project"
 const ConfigLevelStage = "Stage"
@@ -44,11 +59,92 @@ const ConfigLevelService = "Service"
 const DynatraceConfigFilename = "dynatrace/dynatrace.conf.yaml"
 const DynatraceConfigFilenameLOCAL = "dynatrace/_dynatrace.conf.yaml"
 const DynatraceConfigDashboardQUERY = "query"
+const DynatraceConfigParseALWAYS = "always"
+const DynatraceParseLabel = "parse"
 
 type DynatraceConfigFile struct {
 	SpecVersion string `json:"spec_version" yaml:"spec_version"`
 	DtCreds     string `json:"dtCreds,omitempty" yaml:"dtCreds,omitempty"`
 	Dashboard   string `json:"dashboard,omitempty" yaml:"dashboard,omitempty"`
+	// Dashboards lists several dashboard IDs whose SLIs and SLOs are combined into one evaluation. Overwrites Dashboard
+	Dashboards []string `json:"dashboards,omitempty" yaml:"dashboards,omitempty"`
+	// UploadResources defines whether the dashboard.json, sli.yaml and slo.yaml generated from a dashboard are stored in the Keptn configuration repo
+	UploadResources *bool `json:"uploadResources,omitempty" yaml:"uploadResources,omitempty"`
+	// KeepDashboardHistory defines whether a snapshot of the parsed dashboard.json is stored per evaluation in dynatrace/history
+	KeepDashboardHistory bool `json:"keepDashboardHistory,omitempty" yaml:"keepDashboardHistory,omitempty"`
+	// UnitScaling defines how metric values of a specific unit are scaled, e.g: NanoSecond to MilliSecond. Overwrites the default scaling rules
+	UnitScaling []UnitScalingRule `json:"unitScaling,omitempty" yaml:"unitScaling,omitempty"`
+	// DetectMetricUnits defines whether the unit of metric queries without MV2 prefix is detected by querying the metric definition. Defaults to true
+	DetectMetricUnits *bool `json:"detectMetricUnits,omitempty" yaml:"detectMetricUnits,omitempty"`
+	// Parse set to "always" forces the dashboard to be parsed even if KQG.QueryBehavior=ParseOnChange is set and it hasn't changed
+	Parse string `json:"parse,omitempty" yaml:"parse,omitempty"`
+	// TimeframeShift moves the evaluation timeframe of all SLI queries into the past, e.g: 120s, to account for the ingest latency of Dynatrace
+	TimeframeShift string `json:"timeframeShift,omitempty" yaml:"timeframeShift,omitempty"`
+	// ManagementZone is the ID or name of a management zone all file based SLI queries are filtered by
+	ManagementZone string `json:"managementZone,omitempty" yaml:"managementZone,omitempty"`
+	// WaitForData defines how long metric queries are retried if no data points are available yet, e.g: 5m
+	WaitForData string `json:"waitForData,omitempty" yaml:"waitForData,omitempty"`
+	// PushSLIMetrics defines whether the retrieved SLI values are ingested into Dynatrace as metrics keptn.sli.<indicator>
+	PushSLIMetrics bool `json:"pushSLIMetrics,omitempty" yaml:"pushSLIMetrics,omitempty"`
+	// ExportSLIResults lists the formats, json and/or csv, in which the SLI results of each evaluation are stored in dynatrace/results
+	ExportSLIResults []string `json:"exportSLIResults,omitempty" yaml:"exportSLIResults,omitempty"`
+	// ExportSLIResultsRetention is the number of SLI results exports per format that are kept for a service, older exports are deleted. Defaults to 20
+	ExportSLIResultsRetention int `json:"exportSLIResultsRetention,omitempty" yaml:"exportSLIResultsRetention,omitempty"`
+}
+
+// UnitScalingRule defines how metric values of a specific unit are scaled. Either a target unit, e.g: MilliSecond, or a factor the value is multiplied with can be specified
+type UnitScalingRule struct {
+	Unit       string  `json:"unit" yaml:"unit"`
+	TargetUnit string  `json:"targetUnit,omitempty" yaml:"targetUnit,omitempty"`
+	Factor     float64 `json:"factor,omitempty" yaml:"factor,omitempty"`
+}
+
+// ShouldUploadResources returns true if generated resources should be stored in the Keptn configuration repo. Defaults to true
+func (c DynatraceConfigFile) ShouldUploadResources() bool {
+	if c.UploadResources == nil {
+		return true
+	}
+	return *c.UploadResources
+}
+
+// GetDashboards returns the dashboards that are processed for an evaluation: either the list of dashboards or the single dashboard setting
+func (c DynatraceConfigFile) GetDashboards() []string {
+	if len(c.Dashboards) > 0 {
+		return c.Dashboards
+	}
+	return []string{c.Dashboard}
+}
+
+// GetTimeframeShift returns the duration the evaluation timeframe is moved into the past. It can be defined as duration, e.g: 2m or 120s, or in seconds
+func (c DynatraceConfigFile) GetTimeframeShift() (time.Duration, error) {
+	return parseConfigDuration("timeframeShift", c.TimeframeShift)
+}
+
+// GetWaitForData returns how long metric queries are retried until data points are available. It can be defined as duration, e.g: 5m or 300s, or in seconds
+func (c DynatraceConfigFile) GetWaitForData() (time.Duration, error) {
+	return parseConfigDuration("waitForData", c.WaitForData)
+}
+
+// parseConfigDuration parses a non-negative duration or a number of seconds of the dynatrace.conf.yaml. An empty value returns 0
+func parseConfigDuration(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, fmt.Errorf("invalid %s %s: %v", name, value, err)
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("invalid %s %s: must not be negative", name, value)
+	}
+
+	return duration, nil
 }
 
 type DTCredentials struct {
@@ -107,30 +203,50 @@ func GetKubernetesClient() (*kubernetes.Clientset, error) {
 // $ENV.XXXX    -> will replace that with an env variable called XXXX
 // $SECRET.YYYY -> will replace that with the k8s secret called YYYY
 //
-func ReplaceKeptnPlaceholders(input string, keptnEvent *BaseKeptnEvent) string {
-	result := input
-
+func ReplaceKeptnPlaceholders(ctx context.Context, input string, keptnEvent *BaseKeptnEvent) string {
 	// FIXING on 27.5.2020: URL Escaping of parameters as described in https://github.com/keptn-contrib/dynatrace-sli-service/issues/54
+	return replaceKeptnPlaceholders(ctx, input, keptnEvent, url.QueryEscape)
+}
 
-	// first we do the regular keptn values
-	result = strings.Replace(result, "$CONTEXT", url.QueryEscape(keptnEvent.Context), -1)
-	result = strings.Replace(result, "$EVENT", url.QueryEscape(keptnEvent.Event), -1)
-	result = strings.Replace(result, "$SOURCE", url.QueryEscape(keptnEvent.Source), -1)
-	result = strings.Replace(result, "$PROJECT", url.QueryEscape(keptnEvent.Project), -1)
-	result = strings.Replace(result, "$STAGE", url.QueryEscape(keptnEvent.Stage), -1)
-	result = strings.Replace(result, "$SERVICE", url.QueryEscape(keptnEvent.Service), -1)
-	result = strings.Replace(result, "$DEPLOYMENT", url.QueryEscape(keptnEvent.Deployment), -1)
-	result = strings.Replace(result, "$TESTSTRATEGY", url.QueryEscape(keptnEvent.TestStrategy), -1)
+//
+// same as ReplaceKeptnPlaceholders but without URL escaping the values
+// this is needed for queries that are escaped as a whole later on, e.g: USQL or log queries
+//
+func ReplaceKeptnPlaceholdersUnescaped(ctx context.Context, input string, keptnEvent *BaseKeptnEvent) string {
+	return replaceKeptnPlaceholders(ctx, input, keptnEvent, func(value string) string { return value })
+}
 
-	// now we do the labels
-	for key, value := range keptnEvent.Labels {
-		result = strings.Replace(result, "$LABEL."+key, url.QueryEscape(value), -1)
+func replaceKeptnPlaceholders(ctx context.Context, input string, keptnEvent *BaseKeptnEvent, escape func(string) string) string {
+	result := input
+
+	// first we do the regular keptn values
+	result = strings.Replace(result, "$CONTEXT", escape(keptnEvent.Context), -1)
+	result = strings.Replace(result, "$EVENT", escape(keptnEvent.Event), -1)
+	result = strings.Replace(result, "$SOURCE", escape(keptnEvent.Source), -1)
+	result = strings.Replace(result, "$PROJECT", escape(keptnEvent.Project), -1)
+	result = strings.Replace(result, "$STAGE", escape(keptnEvent.Stage), -1)
+	result = strings.Replace(result, "$SERVICE", escape(keptnEvent.Service), -1)
+	result = strings.Replace(result, "$DEPLOYMENT", escape(keptnEvent.Deployment), -1)
+	result = strings.Replace(result, "$TESTSTRATEGY", escape(keptnEvent.TestStrategy), -1)
+
+	// now we do the labels - longer names first so that e.g. $LABEL.regionName is not replaced by the value of label region
+	labelKeys := make([]string, 0, len(keptnEvent.Labels))
+	for key := range keptnEvent.Labels {
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Slice(labelKeys, func(i, j int) bool { return len(labelKeys[i]) > len(labelKeys[j]) })
+	for _, key := range labelKeys {
+		result = strings.Replace(result, "$LABEL."+key, escape(keptnEvent.Labels[key]), -1)
 	}
 
 	// now we do all environment variables
 	for _, env := range os.Environ() {
 		pair := strings.SplitN(env, "=", 2)
-		result = strings.Replace(result, "$ENV."+pair[0], url.QueryEscape(pair[1]), -1)
+		result = strings.Replace(result, "$ENV."+pair[0], escape(pair[1]), -1)
+	}
+
+	if strings.Contains(result, "$LABEL.") {
+		logging.FromContext(ctx).WithField("input", input).Warn("Query contains $LABEL placeholders for labels that are not set on the event")
 	}
 
 	// TODO: iterate through k8s secrets!
@@ -138,18 +254,12 @@ func ReplaceKeptnPlaceholders(input string, keptnEvent *BaseKeptnEvent) string {
 	return result
 }
 
-func GetConfigurationServiceURL() string {
-	if os.Getenv("CONFIGURATION_SERVICE") != "" {
-		return os.Getenv("CONFIGURATION_SERVICE")
-	}
-	return "configuration-service:8080"
-}
-
 //
 // Downloads a resource from the Keptn Configuration Repo based on the level (Project, Stage, Service)
 // In RunLocal mode it gets it from the local disk
 //
-func GetKeptnResourceOnConfigLevel(keptnEvent *BaseKeptnEvent, resourceURI string, level string) (string, error) {
+func GetKeptnResourceOnConfigLevel(ctx context.Context, keptnEvent *BaseKeptnEvent, resourceURI string, level string) (string, error) {
+	logger := logging.FromContext(ctx)
 
 	// if we run in a runlocal mode we are just getting the file from the local disk
 	var fileContent string
@@ -157,7 +267,7 @@ func GetKeptnResourceOnConfigLevel(keptnEvent *BaseKeptnEvent, resourceURI strin
 		resourceURI = strings.ToLower(strings.ReplaceAll(resourceURI, "dynatrace/", "../../../dynatrace/"+level+"_"))
 		localFileContent, err := ioutil.ReadFile(resourceURI)
 		if err != nil {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"resourceURI": resourceURI,
 					"service":     keptnEvent.Service,
@@ -166,10 +276,10 @@ func GetKeptnResourceOnConfigLevel(keptnEvent *BaseKeptnEvent, resourceURI strin
 				}).Info("File not found locally")
 			return "", nil
 		}
-		log.WithField("resourceURI", resourceURI).Info("Loaded LOCAL file")
+		logger.WithField("resourceURI", resourceURI).Info("Loaded LOCAL file")
 		fileContent = string(localFileContent)
 	} else {
-		resourceHandler := keptnapi.NewResourceHandler(GetConfigurationServiceURL())
+		resourceHandler := common.NewResourceHandler()
 
 		var keptnResourceContent *keptnmodels.Resource
 		var err error
@@ -202,14 +312,15 @@ func GetKeptnResourceOnConfigLevel(keptnEvent *BaseKeptnEvent, resourceURI strin
 // In RunLocal mode it gets it from the local disk
 // In normal mode it first tries to find it on service level, then stage and then project level
 //
-func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, error) {
+func GetKeptnResource(ctx context.Context, keptnEvent *BaseKeptnEvent, resourceURI string) (string, error) {
+	logger := logging.FromContext(ctx)
 
 	// if we run in a runlocal mode we are just getting the file from the local disk
 	var fileContent string
 	if RunLocal {
 		localFileContent, err := ioutil.ReadFile(resourceURI)
 		if err != nil {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"resourceURI": resourceURI,
 					"service":     keptnEvent.Service,
@@ -218,10 +329,10 @@ func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, e
 				}).Info("File not found locally")
 			return "", nil
 		}
-		log.WithField("resourceURI", resourceURI).Info("Loaded LOCAL file")
+		logger.WithField("resourceURI", resourceURI).Info("Loaded LOCAL file")
 		fileContent = string(localFileContent)
 	} else {
-		resourceHandler := keptnapi.NewResourceHandler(GetConfigurationServiceURL())
+		resourceHandler := common.NewResourceHandler()
 
 		// Lets search on SERVICE-LEVEL
 		keptnResourceContent, err := resourceHandler.GetServiceResource(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, resourceURI)
@@ -236,13 +347,13 @@ func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, e
 					return "", err
 				}
 
-				log.WithFields(
+				logger.WithFields(
 					log.Fields{
 						"resourceURI": resourceURI,
 						"project":     keptnEvent.Project,
 					}).Debug("Found resource on project level")
 			} else {
-				log.WithFields(
+				logger.WithFields(
 					log.Fields{
 						"resourceURI": resourceURI,
 						"project":     keptnEvent.Project,
@@ -250,7 +361,7 @@ func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, e
 					}).Debug("Found resource on stage level")
 			}
 		} else {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"resourceURI": resourceURI,
 					"project":     keptnEvent.Project,
@@ -267,15 +378,16 @@ func GetKeptnResource(keptnEvent *BaseKeptnEvent, resourceURI string) (string, e
 /**
  * Loads SLIs from a local file and adds it to the SLI map
  */
-func AddResourceContentToSLIMap(SLIs map[string]string, sliFilePath string, sliFileContent string) (map[string]string, error) {
+func AddResourceContentToSLIMap(ctx context.Context, SLIs map[string]string, sliFilePath string, sliFileContent string) (map[string]string, error) {
+	logger := logging.FromContext(ctx)
 
 	if sliFilePath != "" {
 		localFileContent, err := ioutil.ReadFile(sliFilePath)
 		if err != nil {
-			log.WithField("sliFilePath", sliFilePath).Info("Could not load file")
+			logger.WithField("sliFilePath", sliFilePath).Info("Could not load file")
 			return nil, nil
 		}
-		log.WithField("sliFilePath", sliFilePath).Info("Loaded LOCAL file")
+		logger.WithField("sliFilePath", sliFilePath).Info("Loaded LOCAL file")
 		sliFileContent = string(localFileContent)
 	}
 
@@ -297,10 +409,12 @@ func AddResourceContentToSLIMap(SLIs map[string]string, sliFilePath string, sliF
  * getCustomQueries loads custom SLIs from dynatrace/sli.yaml
  * if there is no sli.yaml it will just return an empty map
  */
-func GetCustomQueries(keptnEvent *BaseKeptnEvent) (map[string]string, error) {
+func GetCustomQueries(ctx context.Context, keptnEvent *BaseKeptnEvent) (map[string]string, error) {
+	logger := logging.FromContext(ctx)
+
 	var sliMap = map[string]string{}
 	/*if common.RunLocal || common.RunLocalTest {
-		sliMap, _ = AddResourceContentToSLIMap(sliMap, "dynatrace/sli.yaml", "")
+		sliMap, _ = AddResourceContentToSLIMap(ctx, sliMap, "dynatrace/sli.yaml", "")
 		return sliMap, nil
 	}*/
 
@@ -309,36 +423,36 @@ func GetCustomQueries(keptnEvent *BaseKeptnEvent) (map[string]string, error) {
 
 	// Step 1: Load Project Level
 	foundLocation := ""
-	sliContent, err := GetKeptnResourceOnConfigLevel(keptnEvent, DynatraceSLIFilename, ConfigLevelProject)
+	sliContent, err := GetKeptnResourceOnConfigLevel(ctx, keptnEvent, DynatraceSLIFilename, ConfigLevelProject)
 	if err == nil && sliContent != "" {
-		sliMap, _ = AddResourceContentToSLIMap(sliMap, "", sliContent)
+		sliMap, _ = AddResourceContentToSLIMap(ctx, sliMap, "", sliContent)
 		foundLocation = "project,"
 	}
 
 	// Step 2: Load Stage Level
-	sliContent, err = GetKeptnResourceOnConfigLevel(keptnEvent, DynatraceSLIFilename, ConfigLevelStage)
+	sliContent, err = GetKeptnResourceOnConfigLevel(ctx, keptnEvent, DynatraceSLIFilename, ConfigLevelStage)
 	if err == nil && sliContent != "" {
-		sliMap, _ = AddResourceContentToSLIMap(sliMap, "", sliContent)
+		sliMap, _ = AddResourceContentToSLIMap(ctx, sliMap, "", sliContent)
 		foundLocation = foundLocation + "stage,"
 	}
 
 	// Step 3: Load Service Level
-	sliContent, err = GetKeptnResourceOnConfigLevel(keptnEvent, DynatraceSLIFilename, ConfigLevelService)
+	sliContent, err = GetKeptnResourceOnConfigLevel(ctx, keptnEvent, DynatraceSLIFilename, ConfigLevelService)
 	if err == nil && sliContent != "" {
-		sliMap, _ = AddResourceContentToSLIMap(sliMap, "", sliContent)
+		sliMap, _ = AddResourceContentToSLIMap(ctx, sliMap, "", sliContent)
 		foundLocation = foundLocation + "service"
 	}
 
 	// couldnt load any SLIs
 	if len(sliMap) == 0 {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"project": keptnEvent.Project,
 				"stage":   keptnEvent.Stage,
 				"service": keptnEvent.Service,
 			}).Info("No custom SLI queries found as no dynatrace/sli.yaml in repo, using defaults")
 	} else {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"project":   keptnEvent.Project,
 				"stage":     keptnEvent.Stage,
@@ -353,17 +467,36 @@ func GetCustomQueries(keptnEvent *BaseKeptnEvent) (map[string]string, error) {
 
 // GetDynatraceConfig loads dynatrace.conf for the current service.
 // If none is found, it returns a default configuration.
-func GetDynatraceConfig(keptnEvent *BaseKeptnEvent) DynatraceConfigFile {
-	dynatraceConfFile := getBaseDynatraceConfig(keptnEvent)
+func GetDynatraceConfig(ctx context.Context, keptnEvent *BaseKeptnEvent) DynatraceConfigFile {
+	dynatraceConfFile := getBaseDynatraceConfig(ctx, keptnEvent)
+	if dynatraceConfFile.DtCreds == "" {
+		dynatraceConfFile.DtCreds = getDtCredsOfParentConfigs(ctx, keptnEvent)
+	}
 	if dynatraceConfFile.DtCreds == "" {
 		dynatraceConfFile.DtCreds = "dynatrace"
 	}
 	// implementing https://github.com/keptn-contrib/dynatrace-sli-service/issues/90
-	dynatraceConfFile.DtCreds = ReplaceKeptnPlaceholders(dynatraceConfFile.DtCreds, keptnEvent)
+	dynatraceConfFile.DtCreds = ReplaceKeptnPlaceholders(ctx, dynatraceConfFile.DtCreds, keptnEvent)
 	return dynatraceConfFile
 }
 
-func getBaseDynatraceConfig(keptnEvent *BaseKeptnEvent) DynatraceConfigFile {
+// getDtCredsOfParentConfigs returns the dtCreds of the stage or project dynatrace.conf.yaml if the dynatrace.conf.yaml that is used doesn't define it
+func getDtCredsOfParentConfigs(ctx context.Context, keptnEvent *BaseKeptnEvent) string {
+	for _, level := range []string{ConfigLevelStage, ConfigLevelProject} {
+		yamlString, err := GetKeptnResourceOnConfigLevel(ctx, keptnEvent, DynatraceConfigFilename, level)
+		if err != nil || yamlString == "" {
+			continue
+		}
+		parentConfig, err := parseDynatraceConfigFile(yamlString)
+		if err == nil && parentConfig.DtCreds != "" {
+			return parentConfig.DtCreds
+		}
+	}
+	return ""
+}
+
+func getBaseDynatraceConfig(ctx context.Context, keptnEvent *BaseKeptnEvent) DynatraceConfigFile {
+	logger := logging.FromContext(ctx)
 
 	var defaultDynatraceConfigFile = DynatraceConfigFile{
 		SpecVersion: "0.1.0",
@@ -371,9 +504,9 @@ func getBaseDynatraceConfig(keptnEvent *BaseKeptnEvent) DynatraceConfigFile {
 		Dashboard:   "",
 	}
 
-	yamlString, err := GetKeptnResource(keptnEvent, DynatraceConfigFilename)
+	yamlString, err := GetKeptnResource(ctx, keptnEvent, DynatraceConfigFilename)
 	if err != nil {
-		log.WithError(err).WithFields(
+		logger.WithError(err).WithFields(
 			log.Fields{
 				"service": keptnEvent.Service,
 				"stage":   keptnEvent.Stage,
@@ -383,7 +516,7 @@ func getBaseDynatraceConfig(keptnEvent *BaseKeptnEvent) DynatraceConfigFile {
 	}
 	dynatraceConfFile, err := parseDynatraceConfigFile(yamlString)
 	if err != nil {
-		log.WithError(err).WithFields(
+		logger.WithError(err).WithFields(
 			log.Fields{
 				"yaml":    yamlString,
 				"service": keptnEvent.Service,
@@ -396,7 +529,14 @@ func getBaseDynatraceConfig(keptnEvent *BaseKeptnEvent) DynatraceConfigFile {
 }
 
 // UploadKeptnResource uploads a file to the Keptn Configuration Service
-func UploadKeptnResource(contentToUpload []byte, remoteResourceURI string, keptnEvent *BaseKeptnEvent) error {
+func UploadKeptnResource(ctx context.Context, contentToUpload []byte, remoteResourceURI string, keptnEvent *BaseKeptnEvent) error {
+	return UploadKeptnResourceWithCommitMessage(ctx, contentToUpload, remoteResourceURI, keptnEvent, "")
+}
+
+// UploadKeptnResourceWithCommitMessage uploads a file to the Keptn Configuration Service and passes a commit message describing the change.
+// Configuration services that do not support commit messages simply ignore it
+func UploadKeptnResourceWithCommitMessage(ctx context.Context, contentToUpload []byte, remoteResourceURI string, keptnEvent *BaseKeptnEvent, commitMessage string) error {
+	logger := logging.FromContext(ctx)
 
 	// if we run in a runlocal mode we are just getting the file from the local disk
 	if RunLocal || RunLocalTest {
@@ -404,18 +544,162 @@ func UploadKeptnResource(contentToUpload []byte, remoteResourceURI string, keptn
 		if err != nil {
 			return fmt.Errorf("Couldnt write local file %s: %v", remoteResourceURI, err)
 		}
-		log.WithField("remoteResourceURI", remoteResourceURI).Info("Local file written")
+		logger.WithField("remoteResourceURI", remoteResourceURI).Info("Local file written")
 	} else {
-		resourceHandler := keptnapi.NewResourceHandler(GetConfigurationServiceURL())
+		if commitMessage != "" {
+			err := createServiceResourceWithCommitMessage(contentToUpload, remoteResourceURI, keptnEvent, commitMessage)
+			if err != nil {
+				return fmt.Errorf("Couldnt upload remote resource %s: %v", remoteResourceURI, err)
+			}
+		} else {
+			resourceHandler := common.NewResourceHandler()
 
-		// lets upload it
-		resources := []*keptnmodels.Resource{{ResourceContent: string(contentToUpload), ResourceURI: &remoteResourceURI}}
-		_, err := resourceHandler.CreateResources(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, resources)
-		if err != nil {
-			return fmt.Errorf("Couldnt upload remote resource %s: %s", remoteResourceURI, *err.Message)
+			// lets upload it
+			resources := []*keptnmodels.Resource{{ResourceContent: string(contentToUpload), ResourceURI: &remoteResourceURI}}
+			_, err := resourceHandler.CreateResources(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, resources)
+			if err != nil {
+				return fmt.Errorf("Couldnt upload remote resource %s: %s", remoteResourceURI, *err.Message)
+			}
+		}
+
+		logger.WithFields(
+			log.Fields{
+				"remoteResourceURI": remoteResourceURI,
+				"commitMessage":     commitMessage,
+			}).Info("Uploaded file")
+	}
+
+	return nil
+}
+
+type resourcesWithCommitMessage struct {
+	CommitMessage string                  `json:"commitMessage"`
+	Resources     []*keptnmodels.Resource `json:"resources"`
+}
+
+/**
+ * posts a service resource to the configuration service including a commit message
+ */
+func createServiceResourceWithCommitMessage(contentToUpload []byte, remoteResourceURI string, keptnEvent *BaseKeptnEvent, commitMessage string) error {
+	payload, err := json.Marshal(resourcesWithCommitMessage{
+		CommitMessage: commitMessage,
+		Resources: []*keptnmodels.Resource{
+			{
+				ResourceContent: base64.StdEncoding.EncodeToString(contentToUpload),
+				ResourceURI:     &remoteResourceURI,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resourceHandler := common.NewResourceHandler()
+	resourceURL := fmt.Sprintf("%s://%s/v1/project/%s/stage/%s/service/%s/resource",
+		resourceHandler.Scheme, resourceHandler.BaseURL, keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service)
+
+	req, err := http.NewRequest(http.MethodPost, resourceURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if resourceHandler.AuthToken != "" {
+		req.Header.Set(resourceHandler.AuthHeader, resourceHandler.AuthToken)
+	}
+
+	resp, err := resourceHandler.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("resource service returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// ShouldDetectMetricUnits returns true if the unit of metric queries without MV2 prefix should be detected. Defaults to true
+func (c DynatraceConfigFile) ShouldDetectMetricUnits() bool {
+	if c.DetectMetricUnits == nil {
+		return true
+	}
+	return *c.DetectMetricUnits
+}
+
+// IsDashboardParsingForced returns true if either the dynatrace.conf.yaml or a label (parse=always) on the event requests that the dashboard is always parsed
+func IsDashboardParsingForced(dynatraceConfigFile *DynatraceConfigFile, keptnEvent *BaseKeptnEvent) bool {
+	if dynatraceConfigFile != nil && strings.EqualFold(dynatraceConfigFile.Parse, DynatraceConfigParseALWAYS) {
+		return true
+	}
+
+	if keptnEvent != nil {
+		for labelName, labelValue := range keptnEvent.Labels {
+			if strings.EqualFold(labelName, DynatraceParseLabel) && strings.EqualFold(labelValue, DynatraceConfigParseALWAYS) {
+				return true
+			}
 		}
+	}
+
+	return false
+}
+
+// GetDashboardHistoryFilename returns the resource URI of the dashboard snapshot for the passed keptnContext, e.g: dynatrace/history/<context>-dashboard.json
+func GetDashboardHistoryFilename(keptnContext string) string {
+	return DynatraceDashboardHistoryFolder + keptnContext + "-dashboard.json"
+}
 
-		log.WithField("remoteResourceURI", remoteResourceURI).Info("Uploaded file")
+// GetSLIResultsExportRetention returns the number of SLI results exports per format that are kept for a service. Defaults to 20
+func (c DynatraceConfigFile) GetSLIResultsExportRetention() int {
+	if c.ExportSLIResultsRetention <= 0 {
+		return DefaultSLIResultsExportRetention
+	}
+	return c.ExportSLIResultsRetention
+}
+
+// GetSLIResultsExportFilename returns the resource URI of the SLI results export of the passed keptnContext and format, e.g: dynatrace/results/20200115T141200Z_<context>.json
+// the file name starts with the time of the export so that the exports are sorted by their age
+func GetSLIResultsExportFilename(keptnContext string, format string, exportedAt time.Time) string {
+	return DynatraceSLIResultsFolder + exportedAt.UTC().Format(sliResultsExportTimeFormat) + "_" + keptnContext + "." + format
+}
+
+/**
+ * Deletes the oldest SLI results exports of the passed format of the service, so that at most retention exports are kept
+ * The exports are sorted by their file name, which starts with the time of the export
+ */
+func DeleteExpiredSLIResultsExports(ctx context.Context, keptnEvent *BaseKeptnEvent, format string, retention int) error {
+	if RunLocal || RunLocalTest {
+		return nil
+	}
+
+	resourceHandler := common.NewResourceHandler()
+	resources, err := resourceHandler.GetAllServiceResources(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service)
+	if err != nil {
+		return fmt.Errorf("could not list the resources of service %s: %v", keptnEvent.Service, err)
+	}
+
+	exports := []string{}
+	for _, resource := range resources {
+		if resource.ResourceURI == nil {
+			continue
+		}
+		resourceURI := strings.TrimPrefix(*resource.ResourceURI, "/")
+		if strings.HasPrefix(resourceURI, DynatraceSLIResultsFolder) && strings.HasSuffix(resourceURI, "."+format) {
+			exports = append(exports, resourceURI)
+		}
+	}
+	if len(exports) <= retention {
+		return nil
+	}
+
+	sort.Strings(exports)
+	for _, resourceURI := range exports[:len(exports)-retention] {
+		if err := resourceHandler.DeleteServiceResource(keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service, resourceURI); err != nil {
+			return fmt.Errorf("could not delete SLI results export %s: %v", resourceURI, err)
+		}
+		logging.FromContext(ctx).WithField("resourceURI", resourceURI).Info("Deleted expired SLI results export")
 	}
 
 	return nil
@@ -443,6 +727,9 @@ func GetDTCredentials(dynatraceSecretName string) (*DTCredentials, error) {
 		// if we RunLocal we take it from the env-variables
 		dtCreds.Tenant = os.Getenv("DT_TENANT")
 		dtCreds.ApiToken = os.Getenv("DT_API_TOKEN")
+		if sliAPIToken := os.Getenv("DT_SLI_API_TOKEN"); sliAPIToken != "" {
+			dtCreds.ApiToken = sliAPIToken
+		}
 	} else {
 		kubeAPI, err := GetKubernetesClient()
 		if err != nil {
@@ -461,6 +748,10 @@ func GetDTCredentials(dynatraceSecretName string) (*DTCredentials, error) {
 
 		dtCreds.Tenant = string(secret.Data["DT_TENANT"])
 		dtCreds.ApiToken = string(secret.Data["DT_API_TOKEN"])
+		// a read-only token for the SLIs takes precedence over the token with all scopes
+		if sliAPIToken := string(secret.Data["DT_SLI_API_TOKEN"]); sliAPIToken != "" {
+			dtCreds.ApiToken = sliAPIToken
+		}
 	}
 
 	// ensure URL always has http or https in front
@@ -566,6 +857,31 @@ func ParsePassAndWarningFromString(customName string, defaultPass []string, defa
 	return sliName, passCriteria, warnCriteria, weight, keySli
 }
 
+// ParseTargetUnitFromString returns the target unit defined in a tile name such as
+// Response time (P95);sli=svc_rt_p95;unit=MilliSecond;pass=<+10%,<600
+// It returns an empty string if no unit is specified
+func ParseTargetUnitFromString(customName string) string {
+	return ParseTileSettingFromString(customName, "unit")
+}
+
+// ParseTileSettingFromString returns the value of the setting with the given (case insensitive) name defined in a tile name such as
+// Problems;breakdown=severityLevel
+// It returns an empty string if the setting is not specified
+func ParseTileSettingFromString(customName string, settingName string) string {
+	for _, nameValueSplit := range strings.Split(customName, ";") {
+		nameValueDividerIndex := strings.Index(nameValueSplit, "=")
+		if nameValueDividerIndex < 0 {
+			continue
+		}
+
+		if strings.ToLower(nameValueSplit[:nameValueDividerIndex]) == strings.ToLower(settingName) {
+			return nameValueSplit[nameValueDividerIndex+1:]
+		}
+	}
+
+	return ""
+}
+
 // ParseMarkdownConfiguration parses a text that can be used in a Markdown tile to specify global SLO properties
 func ParseMarkdownConfiguration(markdown string, slo *keptncommon.ServiceLevelObjectives) {
 	markdownSplits := strings.Split(markdown, ";")
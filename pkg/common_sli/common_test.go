@@ -1,11 +1,18 @@
 package common_sli
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_parseDynatraceConfigFile(t *testing.T) {
+	falseValue := false
 	tests := []struct {
 		name       string
 		yamlString string
@@ -42,6 +49,56 @@ dashboard: dash`,
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid yaml with upload of resources disabled",
+			yamlString: `
+spec_version: '0.1.0'
+dtCreds: dyna
+dashboard: query
+uploadResources: false`,
+			want: DynatraceConfigFile{
+				SpecVersion:     "0.1.0",
+				DtCreds:         "dyna",
+				Dashboard:       "query",
+				UploadResources: &falseValue,
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid yaml with dashboard history",
+			yamlString: `
+spec_version: '0.1.0'
+dtCreds: dyna
+dashboard: query
+keepDashboardHistory: true`,
+			want: DynatraceConfigFile{
+				SpecVersion:          "0.1.0",
+				DtCreds:              "dyna",
+				Dashboard:            "query",
+				KeepDashboardHistory: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid yaml with unit scaling rules",
+			yamlString: `
+spec_version: '0.1.0'
+dtCreds: dyna
+unitScaling:
+  - unit: NanoSecond
+    targetUnit: MilliSecond
+  - unit: Count
+    factor: 0.001`,
+			want: DynatraceConfigFile{
+				SpecVersion: "0.1.0",
+				DtCreds:     "dyna",
+				UnitScaling: []UnitScalingRule{
+					{Unit: "NanoSecond", TargetUnit: "MilliSecond"},
+					{Unit: "Count", Factor: 0.001},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid yaml",
 			yamlString: `
@@ -78,3 +135,173 @@ dashboard: '****'`,
 		})
 	}
 }
+
+func TestReplaceKeptnPlaceholders(t *testing.T) {
+	keptnEvent := &BaseKeptnEvent{
+		Project: "sockshop",
+		Stage:   "staging",
+		Service: "carts",
+		Labels: map[string]string{
+			"region":     "eu west",
+			"regionName": "europe",
+			"canary":     "canary-1",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		unescaped bool
+		want      string
+	}{
+		{
+			name:  "keptn values and labels are escaped",
+			input: "entitySelector=tag(keptn_service:$SERVICE),tag(region:$LABEL.region),tag(canary:$LABEL.canary)",
+			want:  "entitySelector=tag(keptn_service:carts),tag(region:eu+west),tag(canary:canary-1)",
+		},
+		{
+			name:  "labels with a common prefix",
+			input: "$LABEL.regionName/$LABEL.region",
+			want:  "europe/eu+west",
+		},
+		{
+			name:      "unescaped values",
+			input:     "SELECT count(*) FROM usersession WHERE region = \"$LABEL.region\" AND stage = \"$STAGE\"",
+			unescaped: true,
+			want:      "SELECT count(*) FROM usersession WHERE region = \"eu west\" AND stage = \"staging\"",
+		},
+		{
+			name:  "unknown labels are kept",
+			input: "tag($LABEL.unknown)",
+			want:  "tag($LABEL.unknown)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReplaceKeptnPlaceholders(context.TODO(), tt.input, keptnEvent)
+			if tt.unescaped {
+				got = ReplaceKeptnPlaceholdersUnescaped(context.TODO(), tt.input, keptnEvent)
+			}
+			if got != tt.want {
+				t.Errorf("ReplaceKeptnPlaceholders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseConfigDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "not set",
+			want: 0,
+		},
+		{
+			name:  "duration",
+			value: "120s",
+			want:  120 * time.Second,
+		},
+		{
+			name:  "duration in minutes",
+			value: "2m",
+			want:  2 * time.Minute,
+		},
+		{
+			name:  "seconds without unit",
+			value: "90",
+			want:  90 * time.Second,
+		},
+		{
+			name:    "negative duration",
+			value:   "-1m",
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			value:   "two minutes",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfigDuration("timeframeShift", tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseConfigDuration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseConfigDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSLIResultsExportFilename(t *testing.T) {
+	exportedAt := time.Date(2020, 1, 15, 14, 12, 0, 0, time.FixedZone("CET", 3600))
+	want := "dynatrace/results/20200115T131200Z_08735340-6f9e-4b32-97ff-3b6c292bc509.json"
+	if got := GetSLIResultsExportFilename("08735340-6f9e-4b32-97ff-3b6c292bc509", "json", exportedAt); got != want {
+		t.Errorf("GetSLIResultsExportFilename() = %v, want %v", got, want)
+	}
+}
+
+func TestDeleteExpiredSLIResultsExports(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		retention   int
+		wantDeleted []string
+	}{
+		{
+			name:        "oldest exports of the format are deleted",
+			format:      "json",
+			retention:   1,
+			wantDeleted: []string{"dynatrace/results/20200115T131200Z_ctx-1.json", "dynatrace/results/20200116T080000Z_ctx-2.json"},
+		},
+		{
+			name:      "exports within the retention are kept",
+			format:    "csv",
+			retention: 1,
+		},
+		{
+			name:      "retention larger than the number of exports",
+			format:    "json",
+			retention: 20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			resourceService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					w.Write([]byte(`{"resources": [
+						{"resourceURI": "/dynatrace/results/20200117T090000Z_ctx-3.json"},
+						{"resourceURI": "/dynatrace/results/20200115T131200Z_ctx-1.json"},
+						{"resourceURI": "/dynatrace/results/20200116T080000Z_ctx-2.json"},
+						{"resourceURI": "/dynatrace/results/20200117T090000Z_ctx-3.csv"},
+						{"resourceURI": "/dynatrace/history/ctx-1-dashboard.json"},
+						{"resourceURI": "/dynatrace/sli.yaml"}
+					]}`))
+				case http.MethodDelete:
+					resourceURI, _ := url.QueryUnescape(r.URL.RawPath[len("/v1/project/sockshop/stage/dev/service/carts/resource/"):])
+					deleted = append(deleted, resourceURI)
+				}
+			}))
+			defer resourceService.Close()
+			os.Setenv("RESOURCE_SERVICE", resourceService.URL)
+			defer os.Unsetenv("RESOURCE_SERVICE")
+
+			err := DeleteExpiredSLIResultsExports(context.TODO(), &BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}, tt.format, tt.retention)
+			if err != nil {
+				t.Fatalf("DeleteExpiredSLIResultsExports() error = %v", err)
+			}
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				t.Errorf("DeleteExpiredSLIResultsExports() deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
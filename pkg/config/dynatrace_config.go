@@ -1,5 +1,7 @@
 package config
 
+import "strings"
+
 // DynatraceConfigFilename is the resource path for the dynatrace.conf.yaml
 const DynatraceConfigFilename = "dynatrace/dynatrace.conf.yaml"
 
@@ -21,7 +23,205 @@ type DtTagRule struct {
 
 // DtAttachRules defines a Dynatrace configuration structure
 type DtAttachRules struct {
-	TagRule []DtTagRule `json:"tagRule" yaml:"tagRule"`
+	TagRule []DtTagRule `json:"tagRule,omitempty" yaml:"tagRule,omitempty"`
+	// EntityIds are the IDs of the entities an event is attached to, e.g: the entities resolved from EntitySelector
+	EntityIds []string `json:"entityIds,omitempty" yaml:"entityIds,omitempty"`
+	// EntitySelector is resolved to EntityIds via the Dynatrace entities API right before an event is sent and is removed from the event itself
+	EntitySelector string `json:"entitySelector,omitempty" yaml:"entitySelector,omitempty"`
+}
+
+// DtRemediationRule defines which remediation sequence is triggered for Dynatrace problems of a specific severity and impact level
+type DtRemediationRule struct {
+	// SeverityLevel of the problem, e.g: AVAILABILITY, ERROR, PERFORMANCE, RESOURCE_CONTENTION or CUSTOM_ALERT. Matches any severity if empty
+	SeverityLevel string `json:"severityLevel,omitempty" yaml:"severityLevel,omitempty"`
+	// ImpactLevel of the problem, e.g: APPLICATION, SERVICES or INFRASTRUCTURE. Matches any impact if empty
+	ImpactLevel string `json:"impactLevel,omitempty" yaml:"impactLevel,omitempty"`
+	// Sequence is the name of the remediation sequence that is triggered, defaults to remediation
+	Sequence string `json:"sequence,omitempty" yaml:"sequence,omitempty"`
+	// ProblemType overwrites the problem title that is used to match the problemType in remediation.yaml
+	ProblemType string `json:"problemType,omitempty" yaml:"problemType,omitempty"`
+}
+
+// Matches returns true if the rule applies to a problem with the passed severity and impact level
+func (r DtRemediationRule) Matches(severityLevel string, impactLevel string) bool {
+	return (r.SeverityLevel == "" || r.SeverityLevel == severityLevel) && (r.ImpactLevel == "" || r.ImpactLevel == impactLevel)
+}
+
+// DtProblemComments defines Go templates for the comments that are posted on Dynatrace problems during a remediation, the default comment is used if a template is empty
+type DtProblemComments struct {
+	ActionTriggered string `json:"actionTriggered,omitempty" yaml:"actionTriggered,omitempty"`
+	ActionStarted   string `json:"actionStarted,omitempty" yaml:"actionStarted,omitempty"`
+	ActionFinished  string `json:"actionFinished,omitempty" yaml:"actionFinished,omitempty"`
+	Evaluation      string `json:"evaluation,omitempty" yaml:"evaluation,omitempty"`
+	TaskProgress    string `json:"taskProgress,omitempty" yaml:"taskProgress,omitempty"`
+}
+
+// DtProblemSink is a webhook that Dynatrace problems are forwarded to in addition to Keptn, e.g: of a chat or ITSM system
+type DtProblemSink struct {
+	// Name identifies the sink in the logs
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	URL  string `json:"url" yaml:"url"`
+	// Method is the HTTP method of the request, POST if empty
+	Method  string            `json:"method,omitempty" yaml:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// SecretHeaders are headers whose values are read from a secret like dtCreds, e.g: Authorization: {secret: itsm-webhook, key: AUTHORIZATION}
+	SecretHeaders map[string]DtSecretKeyRef `json:"secretHeaders,omitempty" yaml:"secretHeaders,omitempty"`
+	// Payload is a Go template of the request body, e.g: {"text": {{json .Problem.ProblemTitle}}} - the problem is sent as JSON if it is empty
+	Payload string `json:"payload,omitempty" yaml:"payload,omitempty"`
+	// States are the states of the problems that are forwarded, e.g: [OPEN] - problems of all states are forwarded if it is empty
+	States []string `json:"states,omitempty" yaml:"states,omitempty"`
+}
+
+// DtSecretKeyRef references a key of a secret of the secret backend of the dynatrace-service
+type DtSecretKeyRef struct {
+	Secret string `json:"secret" yaml:"secret"`
+	Key    string `json:"key" yaml:"key"`
+}
+
+// Matches returns true if problems with the passed state are forwarded to the sink
+func (s DtProblemSink) Matches(state string) bool {
+	if len(s.States) == 0 {
+		return true
+	}
+	for _, sinkState := range s.States {
+		if strings.EqualFold(sinkState, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertingProfileScopeProject creates a single alerting profile and problem notification for the management zone of the project
+const AlertingProfileScopeProject = "project"
+
+// DtAlertingProfile defines the severity rules of the alerting profiles that are created for the stages of a project
+type DtAlertingProfile struct {
+	// Scope is one of stage (default) and project
+	Scope         string                          `json:"scope,omitempty" yaml:"scope,omitempty"`
+	SeverityRules []DtAlertingProfileSeverityRule `json:"severityRules,omitempty" yaml:"severityRules,omitempty"`
+}
+
+// DtAlertingProfileSeverityRule defines which problems of a severity level are sent to Keptn, e.g: AVAILABILITY problems after 5 minutes
+type DtAlertingProfileSeverityRule struct {
+	SeverityLevel  string `json:"severityLevel" yaml:"severityLevel"`
+	DelayInMinutes int    `json:"delayInMinutes,omitempty" yaml:"delayInMinutes,omitempty"`
+	// TagFilterIncludeMode is one of NONE, INCLUDE_ANY and INCLUDE_ALL
+	TagFilterIncludeMode string   `json:"tagFilterIncludeMode,omitempty" yaml:"tagFilterIncludeMode,omitempty"`
+	TagFilters           []string `json:"tagFilters,omitempty" yaml:"tagFilters,omitempty"`
+}
+
+// DtAnomalyDetection defines anomaly detection settings that overwrite the tenant defaults for the Keptn-tagged services of a project
+type DtAnomalyDetection struct {
+	Services []DtServiceAnomalyDetection `json:"services,omitempty" yaml:"services,omitempty"`
+}
+
+// DtServiceAnomalyDetection defines the anomaly detection of the services matching stage and service - empty values match all stages or services of the project
+type DtServiceAnomalyDetection struct {
+	Stage        string                          `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Service      string                          `json:"service,omitempty" yaml:"service,omitempty"`
+	ResponseTime *DtResponseTimeAnomalyDetection `json:"responseTime,omitempty" yaml:"responseTime,omitempty"`
+	FailureRate  *DtFailureRateAnomalyDetection  `json:"failureRate,omitempty" yaml:"failureRate,omitempty"`
+}
+
+// DtResponseTimeAnomalyDetection defines when a response time degradation is detected
+type DtResponseTimeAnomalyDetection struct {
+	// DetectionMode is one of auto, fixed and disabled
+	DetectionMode string `json:"detectionMode" yaml:"detectionMode"`
+	// DegradationMilliseconds is the absolute degradation (auto) or threshold (fixed) of the median response time
+	DegradationMilliseconds float64 `json:"degradationMilliseconds,omitempty" yaml:"degradationMilliseconds,omitempty"`
+	// DegradationPercent is the relative degradation of the median response time, only used by auto
+	DegradationPercent float64 `json:"degradationPercent,omitempty" yaml:"degradationPercent,omitempty"`
+	// SlowestDegradationMilliseconds is the absolute degradation (auto) or threshold (fixed) of the slowest 10% response time
+	SlowestDegradationMilliseconds float64 `json:"slowestDegradationMilliseconds,omitempty" yaml:"slowestDegradationMilliseconds,omitempty"`
+	// SlowestDegradationPercent is the relative degradation of the slowest 10% response time, only used by auto
+	SlowestDegradationPercent float64 `json:"slowestDegradationPercent,omitempty" yaml:"slowestDegradationPercent,omitempty"`
+	// Sensitivity is one of low, medium and high, only used by fixed
+	Sensitivity string `json:"sensitivity,omitempty" yaml:"sensitivity,omitempty"`
+}
+
+// DtFailureRateAnomalyDetection defines when an increase of the failure rate is detected
+type DtFailureRateAnomalyDetection struct {
+	// DetectionMode is one of auto, fixed and disabled
+	DetectionMode string `json:"detectionMode" yaml:"detectionMode"`
+	// AbsoluteIncrease is the absolute increase of failing service calls in percent, only used by auto
+	AbsoluteIncrease float64 `json:"absoluteIncrease,omitempty" yaml:"absoluteIncrease,omitempty"`
+	// RelativeIncrease is the relative increase of failing service calls in percent, only used by auto
+	RelativeIncrease float64 `json:"relativeIncrease,omitempty" yaml:"relativeIncrease,omitempty"`
+	// Threshold is the failure rate in percent above which a problem is raised, only used by fixed
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	// Sensitivity is one of low, medium and high, only used by fixed
+	Sensitivity string `json:"sensitivity,omitempty" yaml:"sensitivity,omitempty"`
+}
+
+// DtGenerate defines which entities are generated for the project when monitoring is configured - unset fields fall back to the settings of the dynatrace-service
+type DtGenerate struct {
+	TaggingRules         *bool `json:"taggingRules,omitempty" yaml:"taggingRules,omitempty"`
+	ProblemNotifications *bool `json:"problemNotifications,omitempty" yaml:"problemNotifications,omitempty"`
+	ManagementZones      *bool `json:"managementZones,omitempty" yaml:"managementZones,omitempty"`
+	Dashboards           *bool `json:"dashboards,omitempty" yaml:"dashboards,omitempty"`
+	MetricEvents         *bool `json:"metricEvents,omitempty" yaml:"metricEvents,omitempty"`
+	SLOs                 *bool `json:"slos,omitempty" yaml:"slos,omitempty"`
+	CalculatedMetrics    *bool `json:"calculatedMetrics,omitempty" yaml:"calculatedMetrics,omitempty"`
+	ServiceNamingRules   *bool `json:"serviceNamingRules,omitempty" yaml:"serviceNamingRules,omitempty"`
+}
+
+// MetricEventModelAutoAdaptive creates metric events that use the auto-adaptive baseline of Dynatrace instead of the threshold of the slo.yaml
+const MetricEventModelAutoAdaptive = "autoAdaptive"
+
+// DtMetricEvents defines how the metric events of the SLIs of a project are created
+type DtMetricEvents struct {
+	Indicators []DtMetricEventIndicator `json:"indicators,omitempty" yaml:"indicators,omitempty"`
+}
+
+// DtMetricEventIndicator defines the monitoring model of the metric events of an SLI, e.g: response_time_p90
+type DtMetricEventIndicator struct {
+	SLI string `json:"sli" yaml:"sli"`
+	// Model is one of staticThreshold (default) and autoAdaptive
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+	// SignalFluctuation is the number of signal fluctuations the auto-adaptive baseline tolerates, the default is 1
+	SignalFluctuation float64 `json:"signalFluctuation,omitempty" yaml:"signalFluctuation,omitempty"`
+}
+
+// DtManagementZones defines additional scoping of the management zones of the stages of a project
+type DtManagementZones struct {
+	// StageFilters add tag conditions to the management zones of the stages
+	StageFilters []DtManagementZoneFilter `json:"stageFilters,omitempty" yaml:"stageFilters,omitempty"`
+	// Additional are management zones that are created per stage in addition to the management zone of the stage, e.g. for the primary deployments only
+	Additional []DtAdditionalManagementZone `json:"additional,omitempty" yaml:"additional,omitempty"`
+}
+
+// DtManagementZoneFilter defines the tags the services of the management zones of a stage need to have, e.g: keptn_deployment:primary
+type DtManagementZoneFilter struct {
+	// Stage is the name of the stage, the filter applies to all stages if it is empty
+	Stage string   `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Tags  []string `json:"tags" yaml:"tags"`
+}
+
+// DtAdditionalManagementZone defines a management zone that is created per stage and only includes the services with the tags
+type DtAdditionalManagementZone struct {
+	// Name is appended to the name of the management zone of the stage, e.g: primary for Keptn: sockshop production primary
+	Name string `json:"name" yaml:"name"`
+	// Stage is the name of the stage, the management zone is created for all stages if it is empty
+	Stage string   `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Tags  []string `json:"tags" yaml:"tags"`
+}
+
+// DtManagementZoneNames defines the name templates of the management zones of a project and its stages, e.g: $PROJECT-$STAGE
+type DtManagementZoneNames struct {
+	// Project is the name template of the management zone of the project, it must contain $PROJECT
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+	// Stage is the name template of the management zones of the stages, it must contain $PROJECT and $STAGE
+	Stage string `json:"stage,omitempty" yaml:"stage,omitempty"`
+}
+
+// DtMaintenanceWindows defines for which tasks a Dynatrace maintenance window is created while they are executed
+type DtMaintenanceWindows struct {
+	// Tasks are the names of the tasks, e.g: deployment, test
+	Tasks []string `json:"tasks,omitempty" yaml:"tasks,omitempty"`
+	// Suppression is one of DETECT_PROBLEMS_DONT_ALERT, DONT_DETECT_PROBLEMS and DETECT_PROBLEMS_AND_ALERT
+	Suppression string `json:"suppression,omitempty" yaml:"suppression,omitempty"`
+	// DurationMinutes limits the maintenance window in case the task never finishes
+	DurationMinutes int `json:"durationMinutes,omitempty" yaml:"durationMinutes,omitempty"`
 }
 
 // DynatraceConfigFile defines the Dynatrace configuration structure
@@ -29,4 +229,36 @@ type DynatraceConfigFile struct {
 	SpecVersion string         `json:"spec_version" yaml:"spec_version"`
 	DtCreds     string         `json:"dtCreds,omitempty" yaml:"dtCreds,omitempty"`
 	AttachRules *DtAttachRules `json:"attachRules,omitempty" yaml:"attachRules,omitempty"`
+	// CustomProperties are added to all events sent to Dynatrace, values can use placeholders such as $LABEL.jira
+	CustomProperties map[string]string `json:"customProperties,omitempty" yaml:"customProperties,omitempty"`
+	// RemediationRules map the severity and impact level of Dynatrace problems to remediation sequences - the first matching rule is used
+	RemediationRules []DtRemediationRule `json:"remediationRules,omitempty" yaml:"remediationRules,omitempty"`
+	// CloseProblems defines whether a Dynatrace problem is closed when the evaluation of its remediation passes
+	CloseProblems bool `json:"closeProblems,omitempty" yaml:"closeProblems,omitempty"`
+	// RemediationProgressComments defines whether a comment is posted on the Dynatrace problem when a task of its remediation sequence is started or finished
+	RemediationProgressComments bool `json:"remediationProgressComments,omitempty" yaml:"remediationProgressComments,omitempty"`
+	// Generate overwrites which entities are generated for the project when monitoring is configured
+	Generate *DtGenerate `json:"generate,omitempty" yaml:"generate,omitempty"`
+	// MetricEvents defines how the metric events of the SLIs of the project are created
+	MetricEvents *DtMetricEvents `json:"metricEvents,omitempty" yaml:"metricEvents,omitempty"`
+	// ManagementZones defines additional scoping of the management zones of the stages of the project
+	ManagementZones *DtManagementZones `json:"managementZones,omitempty" yaml:"managementZones,omitempty"`
+	// ManagementZoneNames overwrite the names of the management zones that are created for the project and its stages
+	ManagementZoneNames *DtManagementZoneNames `json:"managementZoneNames,omitempty" yaml:"managementZoneNames,omitempty"`
+	// DashboardTemplate is the resource URI of a dashboard JSON template of the project that replaces the default dashboard, e.g: dynatrace/dashboard-template.json
+	DashboardTemplate string `json:"dashboardTemplate,omitempty" yaml:"dashboardTemplate,omitempty"`
+	// AlertingProfile defines the alerting profiles that are created for the stages of the project together with a problem notification
+	AlertingProfile *DtAlertingProfile `json:"alertingProfile,omitempty" yaml:"alertingProfile,omitempty"`
+	// ConfigureMonitoringDryRun defines whether configure monitoring only reports the changes it would make to the tenant without applying them
+	ConfigureMonitoringDryRun bool `json:"configureMonitoringDryRun,omitempty" yaml:"configureMonitoringDryRun,omitempty"`
+	// AnomalyDetection overwrites the anomaly detection of the Keptn-tagged services of the project
+	AnomalyDetection *DtAnomalyDetection `json:"anomalyDetection,omitempty" yaml:"anomalyDetection,omitempty"`
+	// MaintenanceWindows defines the tasks during which problems are suppressed with a maintenance window
+	MaintenanceWindows *DtMaintenanceWindows `json:"maintenanceWindows,omitempty" yaml:"maintenanceWindows,omitempty"`
+	// ProblemComments overwrite the comments that are posted on Dynatrace problems
+	ProblemComments *DtProblemComments `json:"problemComments,omitempty" yaml:"problemComments,omitempty"`
+	// ProblemSinks are webhooks that Dynatrace problems are forwarded to in addition to Keptn
+	ProblemSinks []DtProblemSink `json:"problemSinks,omitempty" yaml:"problemSinks,omitempty"`
+	// EventMeTypes restrict the entity types of the attachRules per Dynatrace event type, e.g: CUSTOM_DEPLOYMENT: [SERVICE]
+	EventMeTypes map[string][]string `json:"eventMeTypes,omitempty" yaml:"eventMeTypes,omitempty"`
 }
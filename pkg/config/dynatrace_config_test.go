@@ -0,0 +1,90 @@
+package config
+
+import "testing"
+
+func TestDtProblemSink_Matches(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []string
+		state  string
+		want   bool
+	}{
+		{
+			name:  "sink without states matches all problems",
+			state: "RESOLVED",
+			want:  true,
+		},
+		{
+			name:   "sink matches state of problem",
+			states: []string{"OPEN"},
+			state:  "OPEN",
+			want:   true,
+		},
+		{
+			name:   "states are case insensitive",
+			states: []string{"open", "resolved"},
+			state:  "RESOLVED",
+			want:   true,
+		},
+		{
+			name:   "sink doesn't match other state",
+			states: []string{"OPEN"},
+			state:  "RESOLVED",
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := DtProblemSink{URL: "https://chat.mydomain.com/hooks/abc123", States: tt.states}
+			if got := sink.Matches(tt.state); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDtRemediationRule_Matches(t *testing.T) {
+	tests := []struct {
+		name          string
+		rule          DtRemediationRule
+		severityLevel string
+		impactLevel   string
+		want          bool
+	}{
+		{
+			name:          "rule without levels matches all problems",
+			rule:          DtRemediationRule{Sequence: "remediation-all"},
+			severityLevel: "PERFORMANCE",
+			impactLevel:   "SERVICES",
+			want:          true,
+		},
+		{
+			name:          "rule matches severity and impact",
+			rule:          DtRemediationRule{SeverityLevel: "AVAILABILITY", ImpactLevel: "APPLICATION"},
+			severityLevel: "AVAILABILITY",
+			impactLevel:   "APPLICATION",
+			want:          true,
+		},
+		{
+			name:          "rule doesn't match other severity",
+			rule:          DtRemediationRule{SeverityLevel: "AVAILABILITY"},
+			severityLevel: "ERROR",
+			impactLevel:   "APPLICATION",
+			want:          false,
+		},
+		{
+			name:          "rule doesn't match other impact",
+			rule:          DtRemediationRule{SeverityLevel: "AVAILABILITY", ImpactLevel: "APPLICATION"},
+			severityLevel: "AVAILABILITY",
+			impactLevel:   "INFRASTRUCTURE",
+			want:          false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.severityLevel, tt.impactLevel); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+// ProblemContextMappingRule maps Dynatrace problems without Keptn tags to a Keptn project, stage and service, e.g: by the name of a management zone
+type ProblemContextMappingRule struct {
+	// ManagementZone is the name of a management zone of the problem - only available for problems in the Problems API v2 format
+	ManagementZone string `json:"managementZone,omitempty" yaml:"managementZone,omitempty"`
+	// Tag is a tag of the impacted entities, either key:value or only the key, e.g: hostgroup:frontend
+	Tag     string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+	Stage   string `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+}
+
+// Matches returns true if the rule applies to a problem with the passed management zones and tags. A rule without conditions never matches
+func (r ProblemContextMappingRule) Matches(managementZones []string, tags []string) bool {
+	if r.ManagementZone == "" && r.Tag == "" {
+		return false
+	}
+	return (r.ManagementZone == "" || contains(managementZones, r.ManagementZone)) && (r.Tag == "" || containsTag(tags, r.Tag))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsTag returns true if the tags contain the passed tag or a tag with the passed key
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag || (len(t) > len(tag) && t[:len(tag)+1] == tag+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package credentials
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const secretBackendAWS = "aws"
+
+// AWSCredentials are the credentials of an IAM user or an assumed role used to sign the requests to AWS
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+/**
+ * AWSSecretsManagerReader reads secrets from AWS Secrets Manager. Each secret is stored as JSON object of its keys with the name <SecretPrefix><secretName>,
+ * e.g: the key DT_API_TOKEN of the secret dynatrace is read from {"DT_TENANT": "...", "DT_API_TOKEN": "..."} of the AWS secret keptn/dynatrace
+ */
+type AWSSecretsManagerReader struct {
+	Region       string
+	Endpoint     string
+	SecretPrefix string
+	// RoleARN and WebIdentityTokenFile are used to assume a role, e.g. of an IAM role for service accounts, if no static Credentials are set
+	RoleARN              string
+	WebIdentityTokenFile string
+	STSEndpoint          string
+	Credentials          *AWSCredentials
+	HTTPClient           *http.Client
+
+	// mutex guards the cache of the secrets, credentialsMutex the assumed Credentials - neither is held while a secret is read
+	mutex            sync.Mutex
+	secrets          secretCache
+	credentialsMutex sync.Mutex
+}
+
+// NewAWSSecretsManagerReaderFromEnv creates an AWSSecretsManagerReader configured by the AWS_* environment variables
+func NewAWSSecretsManagerReaderFromEnv() (*AWSSecretsManagerReader, error) {
+	region := getEnvWithDefault("AWS_REGION", os.Getenv("AWS_DEFAULT_REGION"))
+	if region == "" {
+		return nil, fmt.Errorf("could not initialize AWSSecretsManagerReader: AWS_REGION is not set")
+	}
+
+	asr := &AWSSecretsManagerReader{
+		Region:               region,
+		Endpoint:             strings.TrimSuffix(getEnvWithDefault("AWS_SECRETS_MANAGER_ENDPOINT", "https://secretsmanager."+region+".amazonaws.com"), "/"),
+		SecretPrefix:         getEnvWithDefault("AWS_SECRET_PREFIX", "keptn/"),
+		RoleARN:              os.Getenv("AWS_ROLE_ARN"),
+		WebIdentityTokenFile: os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+		STSEndpoint:          strings.TrimSuffix(getEnvWithDefault("AWS_STS_ENDPOINT", "https://sts."+region+".amazonaws.com"), "/"),
+		HTTPClient:           &http.Client{Timeout: secretBackendTimeout},
+	}
+	if accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyID != "" {
+		asr.Credentials = &AWSCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if asr.Credentials == nil && (asr.RoleARN == "" || asr.WebIdentityTokenFile == "") {
+		return nil, fmt.Errorf("could not initialize AWSSecretsManagerReader: either AWS_ACCESS_KEY_ID or AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE have to be set")
+	}
+	return asr, nil
+}
+
+// ReadSecret reads the key of the secret from AWS Secrets Manager - the namespace is ignored as the secrets of all namespaces share the same prefix
+func (asr *AWSSecretsManagerReader) ReadSecret(secretName, namespace, secretKey string) (string, error) {
+	data, err := asr.getSecretData(secretName)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[secretKey]
+	if !ok || value == "" {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// ReadSecretData reads all keys of the secret from AWS Secrets Manager
+func (asr *AWSSecretsManagerReader) ReadSecretData(secretName, namespace string) (map[string]string, error) {
+	return asr.getSecretData(secretName)
+}
+
+// InvalidateSecret removes the secret from the cache, so that e.g. a rotated API token is read again from AWS Secrets Manager
+func (asr *AWSSecretsManagerReader) InvalidateSecret(secretName string) {
+	asr.mutex.Lock()
+	defer asr.mutex.Unlock()
+	asr.secrets.invalidate(secretName)
+}
+
+/**
+ * getSecretData returns the keys of the secret - they are cached for the secretCacheTTL, as all keys of a secret are stored in the same AWS secret.
+ * The cache is only locked to read and store the secret, so that a slow request to AWS doesn't block the secrets that are already cached
+ */
+func (asr *AWSSecretsManagerReader) getSecretData(secretName string) (map[string]string, error) {
+	asr.mutex.Lock()
+	data, ok := asr.secrets.get(secretName)
+	asr.mutex.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	creds, err := asr.getCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(map[string]string{"SecretId": asr.SecretPrefix + secretName})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, asr.Endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, payload, creds, asr.Region, "secretsmanager", time.Now())
+
+	statusCode, body, err := doHTTPRequest(asr.HTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret %s from AWS Secrets Manager: %v", secretName, err)
+	}
+	if statusCode != http.StatusOK {
+		awsErr := &struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}{}
+		_ = json.Unmarshal(body, awsErr)
+		if strings.HasSuffix(awsErr.Type, "ResourceNotFoundException") {
+			return nil, ErrSecretNotFound
+		}
+		return nil, fmt.Errorf("could not read secret %s from AWS Secrets Manager: received status code %d: %s", secretName, statusCode, awsErr.Message)
+	}
+
+	secretValue := &struct {
+		SecretString string `json:"SecretString"`
+	}{}
+	if err := json.Unmarshal(body, secretValue); err != nil {
+		return nil, fmt.Errorf("could not parse secret %s from AWS Secrets Manager: %v", secretName, err)
+	}
+	data = map[string]string{}
+	if err := json.Unmarshal([]byte(secretValue.SecretString), &data); err != nil {
+		return nil, fmt.Errorf("could not parse secret %s from AWS Secrets Manager: the secret string has to be a JSON object of its keys", secretName)
+	}
+
+	asr.mutex.Lock()
+	asr.secrets.set(secretName, data)
+	asr.mutex.Unlock()
+	return data, nil
+}
+
+// getCredentials returns the static credentials or assumes the role with the web identity token, if there are none or the assumed ones expire soon.
+// Concurrent reads of secrets wait for the same role to be assumed instead of assuming it several times
+func (asr *AWSSecretsManagerReader) getCredentials() (*AWSCredentials, error) {
+	asr.credentialsMutex.Lock()
+	defer asr.credentialsMutex.Unlock()
+
+	if asr.Credentials != nil && (asr.Credentials.Expiration.IsZero() || time.Now().Add(time.Minute).Before(asr.Credentials.Expiration)) {
+		return asr.Credentials, nil
+	}
+
+	webIdentityToken, err := ioutil.ReadFile(asr.WebIdentityTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read web identity token to assume role %s: %v", asr.RoleARN, err)
+	}
+
+	query := url.Values{}
+	query.Set("Action", "AssumeRoleWithWebIdentity")
+	query.Set("Version", "2011-06-15")
+	query.Set("RoleArn", asr.RoleARN)
+	query.Set("RoleSessionName", "dynatrace-service")
+	query.Set("WebIdentityToken", strings.TrimSpace(string(webIdentityToken)))
+	req, err := http.NewRequest(http.MethodGet, asr.STSEndpoint+"/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode, body, err := doHTTPRequest(asr.HTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not assume role %s: %v", asr.RoleARN, err)
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not assume role %s: received status code %d", asr.RoleARN, statusCode)
+	}
+
+	response := &struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}{}
+	if err := xml.Unmarshal(body, response); err != nil || response.Credentials.AccessKeyID == "" {
+		return nil, fmt.Errorf("could not assume role %s: no credentials received", asr.RoleARN)
+	}
+
+	asr.Credentials = &AWSCredentials{
+		AccessKeyID:     response.Credentials.AccessKeyID,
+		SecretAccessKey: response.Credentials.SecretAccessKey,
+		SessionToken:    response.Credentials.SessionToken,
+		Expiration:      response.Credentials.Expiration,
+	}
+	return asr.Credentials, nil
+}
+
+/**
+ * signAWSRequest adds the Authorization header of the AWS Signature Version 4 to the request, see https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+ * The signature is implemented here instead of using the AWS SDK, as only GetSecretValue and AssumeRoleWithWebIdentity are needed and the SDK would add
+ * a large dependency tree to the dynatrace-service. Changes to it have to keep TestSignAWSRequest passing
+ */
+func signAWSRequest(req *http.Request, payload []byte, creds *AWSCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date"}
+	if creds.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	signedHeaders = append(signedHeaders, "x-amz-target")
+
+	canonicalHeaders := ""
+	for _, header := range signedHeaders {
+		value := req.Header.Get(header)
+		if header == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders += header + ":" + strings.TrimSpace(value) + "\n"
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+", SignedHeaders="+strings.Join(signedHeaders, ";")+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func doHTTPRequest(client *http.Client, req *http.Request) (int, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
@@ -0,0 +1,157 @@
+package credentials
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAWSSecretsManagerReader_ReadSecret(t *testing.T) {
+	assumedRoles := 0
+	secretRequests := 0
+	awsMockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("Action") == "AssumeRoleWithWebIdentity" {
+			assumedRoles++
+			if r.URL.Query().Get("WebIdentityToken") != "service-account-jwt" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+				<AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>
+				<Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+			return
+		}
+
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		secretRequests++
+		request := struct{ SecretId string }{}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		if request.SecretId != "keptn/dynatrace" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."}`))
+			return
+		}
+		w.Write([]byte(`{"Name": "keptn/dynatrace", "SecretString": "{\"DT_TENANT\": \"my-tenant.live.dynatrace.com\", \"DT_API_TOKEN\": \"my-token\"}"}`))
+	}))
+	defer awsMockServer.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	asr := &AWSSecretsManagerReader{
+		Region:               "eu-central-1",
+		Endpoint:             awsMockServer.URL,
+		SecretPrefix:         "keptn/",
+		RoleARN:              "arn:aws:iam::123456789012:role/dynatrace-service",
+		WebIdentityTokenFile: tokenFile,
+		STSEndpoint:          awsMockServer.URL,
+		HTTPClient:           awsMockServer.Client(),
+	}
+	cm, err := NewCredentialManager(asr)
+	if err != nil {
+		t.Fatalf("NewCredentialManager() error = %v", err)
+	}
+
+	got, err := cm.GetDynatraceCredentials(nil)
+	if err != nil {
+		t.Fatalf("GetDynatraceCredentials() error = %v", err)
+	}
+	want := &DTCredentials{Tenant: "https://my-tenant.live.dynatrace.com", ApiToken: "my-token", SecretName: "dynatrace"}
+	if *got != *want {
+		t.Errorf("GetDynatraceCredentials() = %v, want %v", got, want)
+	}
+	if _, err := cm.GetDynatraceCredentials(nil); err != nil {
+		t.Fatalf("GetDynatraceCredentials() error = %v", err)
+	}
+	if assumedRoles != 1 || secretRequests != 1 {
+		t.Errorf("GetDynatraceCredentials() assumed role %d times and read the secret %d times, want 1 each", assumedRoles, secretRequests)
+	}
+
+	asr.InvalidateSecret("dynatrace")
+	if _, err := cm.GetDynatraceCredentials(nil); err != nil {
+		t.Fatalf("GetDynatraceCredentials() error = %v", err)
+	}
+	if secretRequests != 2 {
+		t.Errorf("GetDynatraceCredentials() read the secret %d times, want 2 after it has been invalidated", secretRequests)
+	}
+
+	if _, err := asr.ReadSecret("other", namespace, "DT_TENANT"); err != ErrSecretNotFound {
+		t.Errorf("ReadSecret() error = %v, want %v for a missing secret", err, ErrSecretNotFound)
+	}
+}
+
+func TestAWSSecretsManagerReader_ReadSecret_CachedWhileReading(t *testing.T) {
+	blockRequest := make(chan struct{})
+	awsMockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct{ SecretId string }{}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		if request.SecretId == "keptn/slow" {
+			<-blockRequest
+		}
+		w.Write([]byte(`{"SecretString": "{\"DT_TENANT\": \"my-tenant.live.dynatrace.com\"}"}`))
+	}))
+	defer awsMockServer.Close()
+	defer close(blockRequest)
+
+	asr := &AWSSecretsManagerReader{
+		Region:       "eu-central-1",
+		Endpoint:     awsMockServer.URL,
+		SecretPrefix: "keptn/",
+		Credentials:  &AWSCredentials{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"},
+		HTTPClient:   awsMockServer.Client(),
+	}
+	if _, err := asr.ReadSecret("dynatrace", namespace, "DT_TENANT"); err != nil {
+		t.Fatalf("ReadSecret() error = %v", err)
+	}
+
+	go asr.ReadSecret("slow", namespace, "DT_TENANT")
+
+	read := make(chan error, 1)
+	go func() {
+		// give the read of the slow secret time to send its request
+		time.Sleep(50 * time.Millisecond)
+		_, err := asr.ReadSecret("dynatrace", namespace, "DT_TENANT")
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Errorf("ReadSecret() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ReadSecret() of a cached secret is blocked by the read of another secret")
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://secretsmanager.eu-central-1.amazonaws.com/", nil)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	creds := &AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, []byte(`{"SecretId":"keptn/dynatrace"}`), creds, "eu-central-1", "secretsmanager", time.Date(2021, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	if got := req.Header.Get("X-Amz-Date"); got != "20210830T123600Z" {
+		t.Errorf("X-Amz-Date = %s, want 20210830T123600Z", got)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20210830/eu-central-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-target, " +
+		"Signature=b803f97b0854187752fb5f1710fbf2d49fdecbc6a15db4cc178eaf91e6cb4846"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const secretBackendAzure = "azure"
+
+const azureKeyVaultResource = "https://vault.azure.net"
+
+// defaultAzureIMDSEndpoint is the endpoint of the Azure Instance Metadata Service that provides the tokens of managed identities
+const defaultAzureIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// invalidAzureSecretNameChars matches all characters that aren't allowed in the name of a Key Vault secret
+var invalidAzureSecretNameChars = regexp.MustCompile("[^0-9a-zA-Z-]")
+
+/**
+ * AzureKeyVaultReader reads secrets from Azure Key Vault. Each secret is stored as JSON object of its keys with the name <SecretPrefix><secretName>,
+ * where all characters that aren't allowed by Key Vault are replaced by -, e.g: the key DT_API_TOKEN of the secret dynatrace_other is read from
+ * {"DT_TENANT": "...", "DT_API_TOKEN": "..."} of the Key Vault secret keptn-dynatrace-other
+ */
+type AzureKeyVaultReader struct {
+	VaultURL     string
+	SecretPrefix string
+	// ClientID is the client ID of the user-assigned managed identity or of the application of the workload identity
+	ClientID string
+	// TenantID and FederatedTokenFile are used to log in with a workload identity, otherwise the token of the managed identity is requested from the IMDSEndpoint
+	TenantID           string
+	FederatedTokenFile string
+	AuthorityHost      string
+	IMDSEndpoint       string
+	HTTPClient         *http.Client
+
+	// mutex guards the cache of the secrets, tokenMutex the access token - neither is held while a secret is read
+	mutex          sync.Mutex
+	secrets        secretCache
+	tokenMutex     sync.Mutex
+	token          string
+	tokenExpiresAt time.Time
+}
+
+// NewAzureKeyVaultReaderFromEnv creates an AzureKeyVaultReader configured by the AZURE_* environment variables
+func NewAzureKeyVaultReaderFromEnv() (*AzureKeyVaultReader, error) {
+	vaultURL := strings.TrimSuffix(os.Getenv("AZURE_KEYVAULT_URL"), "/")
+	if vaultURL == "" {
+		return nil, fmt.Errorf("could not initialize AzureKeyVaultReader: AZURE_KEYVAULT_URL is not set")
+	}
+
+	return &AzureKeyVaultReader{
+		VaultURL:           vaultURL,
+		SecretPrefix:       getEnvWithDefault("AZURE_KEYVAULT_SECRET_PREFIX", "keptn-"),
+		ClientID:           os.Getenv("AZURE_CLIENT_ID"),
+		TenantID:           os.Getenv("AZURE_TENANT_ID"),
+		FederatedTokenFile: os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		AuthorityHost:      strings.TrimSuffix(getEnvWithDefault("AZURE_AUTHORITY_HOST", "https://login.microsoftonline.com"), "/"),
+		IMDSEndpoint:       defaultAzureIMDSEndpoint,
+		HTTPClient:         &http.Client{Timeout: secretBackendTimeout},
+	}, nil
+}
+
+// ReadSecret reads the key of the secret from Azure Key Vault - the namespace is ignored as the secrets of all namespaces share the same prefix
+func (akr *AzureKeyVaultReader) ReadSecret(secretName, namespace, secretKey string) (string, error) {
+	data, err := akr.getSecretData(secretName)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[secretKey]
+	if !ok || value == "" {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// ReadSecretData reads all keys of the secret from Azure Key Vault
+func (akr *AzureKeyVaultReader) ReadSecretData(secretName, namespace string) (map[string]string, error) {
+	return akr.getSecretData(secretName)
+}
+
+func (akr *AzureKeyVaultReader) secretURL(secretName string) string {
+	name := invalidAzureSecretNameChars.ReplaceAllString(akr.SecretPrefix+secretName, "-")
+	return akr.VaultURL + "/secrets/" + name + "?api-version=7.3"
+}
+
+// InvalidateSecret removes the secret from the cache, so that e.g. a rotated API token is read again from Azure Key Vault
+func (akr *AzureKeyVaultReader) InvalidateSecret(secretName string) {
+	akr.mutex.Lock()
+	defer akr.mutex.Unlock()
+	akr.secrets.invalidate(secretName)
+}
+
+/**
+ * getSecretData returns the keys of the secret - they are cached for the secretCacheTTL, as all keys of a secret are stored in the same Key Vault secret.
+ * The cache is only locked to read and store the secret, so that a slow request to Key Vault doesn't block the secrets that are already cached
+ */
+func (akr *AzureKeyVaultReader) getSecretData(secretName string) (map[string]string, error) {
+	akr.mutex.Lock()
+	data, ok := akr.secrets.get(secretName)
+	akr.mutex.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	token, err := akr.getToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, akr.secretURL(secretName), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	statusCode, body, err := doHTTPRequest(akr.HTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret %s from Azure Key Vault: %v", secretName, err)
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, ErrSecretNotFound
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not read secret %s from Azure Key Vault: received status code %d", secretName, statusCode)
+	}
+
+	secret := &struct {
+		Value string `json:"value"`
+	}{}
+	if err := json.Unmarshal(body, secret); err != nil {
+		return nil, fmt.Errorf("could not parse secret %s from Azure Key Vault: %v", secretName, err)
+	}
+	data = map[string]string{}
+	if err := json.Unmarshal([]byte(secret.Value), &data); err != nil {
+		return nil, fmt.Errorf("could not parse secret %s from Azure Key Vault: the value has to be a JSON object of its keys", secretName)
+	}
+
+	akr.mutex.Lock()
+	akr.secrets.set(secretName, data)
+	akr.mutex.Unlock()
+	return data, nil
+}
+
+// getToken returns the cached access token for Key Vault or requests a new one with the workload identity or the managed identity.
+// Only these two token flows are supported, so they are implemented here instead of adding the Azure SDK and its dependencies
+func (akr *AzureKeyVaultReader) getToken() (string, error) {
+	akr.tokenMutex.Lock()
+	defer akr.tokenMutex.Unlock()
+
+	if akr.token != "" && time.Now().Add(time.Minute).Before(akr.tokenExpiresAt) {
+		return akr.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if akr.FederatedTokenFile != "" {
+		req, err = akr.newWorkloadIdentityTokenRequest()
+	} else {
+		req, err = akr.newManagedIdentityTokenRequest()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	statusCode, body, err := doHTTPRequest(akr.HTTPClient, req)
+	if err != nil {
+		return "", fmt.Errorf("could not get access token for Azure Key Vault: %v", err)
+	}
+	if statusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get access token for Azure Key Vault: received status code %d", statusCode)
+	}
+
+	token := &struct {
+		AccessToken string `json:"access_token"`
+		// ExpiresIn is a number for workload identities and a string for managed identities
+		ExpiresIn json.RawMessage `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(body, token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("could not get access token for Azure Key Vault: no access token received")
+	}
+	expiresIn, err := strconv.Atoi(strings.Trim(string(token.ExpiresIn), `"`))
+	if err != nil {
+		expiresIn = 0
+	}
+
+	akr.token = token.AccessToken
+	akr.tokenExpiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	return akr.token, nil
+}
+
+func (akr *AzureKeyVaultReader) newWorkloadIdentityTokenRequest() (*http.Request, error) {
+	assertion, err := ioutil.ReadFile(akr.FederatedTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read federated token for Azure Key Vault: %v", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", akr.ClientID)
+	form.Set("scope", azureKeyVaultResource+"/.default")
+	form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+
+	req, err := http.NewRequest(http.MethodPost, akr.AuthorityHost+"/"+akr.TenantID+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+func (akr *AzureKeyVaultReader) newManagedIdentityTokenRequest() (*http.Request, error) {
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", azureKeyVaultResource)
+	if akr.ClientID != "" {
+		query.Set("client_id", akr.ClientID)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, akr.IMDSEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
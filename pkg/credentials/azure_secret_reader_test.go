@@ -0,0 +1,61 @@
+package credentials
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+)
+
+func TestAzureKeyVaultReader_ReadSecret(t *testing.T) {
+	tokenRequests := 0
+	azureMockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			tokenRequests++
+			if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != "https://vault.azure.net" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token": "access-token", "expires_in": "3599", "token_type": "Bearer"}`))
+		case "/secrets/keptn-dynatrace-other":
+			if r.Header.Get("Authorization") != "Bearer access-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"value": "{\"DT_TENANT\": \"other.live.dynatrace.com\", \"DT_API_TOKEN\": \"other-token\"}", "id": "https://myvault.vault.azure.net/secrets/keptn-dynatrace-other/1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer azureMockServer.Close()
+
+	akr := &AzureKeyVaultReader{
+		VaultURL:     azureMockServer.URL,
+		SecretPrefix: "keptn-",
+		IMDSEndpoint: azureMockServer.URL + "/metadata/identity/oauth2/token",
+		HTTPClient:   azureMockServer.Client(),
+	}
+	cm, err := NewCredentialManager(akr)
+	if err != nil {
+		t.Fatalf("NewCredentialManager() error = %v", err)
+	}
+
+	got, err := cm.GetDynatraceCredentials(nil)
+	if err == nil {
+		t.Errorf("GetDynatraceCredentials() = %v, want an error for the missing secret dynatrace", got)
+	}
+
+	got, err = cm.GetDynatraceCredentials(&config.DynatraceConfigFile{DtCreds: "dynatrace_other"})
+	if err != nil {
+		t.Fatalf("GetDynatraceCredentials() error = %v", err)
+	}
+	want := &DTCredentials{Tenant: "https://other.live.dynatrace.com", ApiToken: "other-token", SecretName: "dynatrace_other"}
+	if *got != *want {
+		t.Errorf("GetDynatraceCredentials() = %v, want %v", got, want)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("GetDynatraceCredentials() requested %d tokens, want 1", tokenRequests)
+	}
+}
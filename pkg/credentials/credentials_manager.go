@@ -3,12 +3,15 @@ package credentials
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
@@ -20,6 +23,81 @@ import (
 type DTCredentials struct {
 	Tenant   string `json:"DT_TENANT" yaml:"DT_TENANT"`
 	ApiToken string `json:"DT_API_TOKEN" yaml:"DT_API_TOKEN"`
+	// ConfigApiToken is an optional token that is used instead of the ApiToken to write the Dynatrace configuration
+	ConfigApiToken string `json:"DT_CONFIG_API_TOKEN,omitempty" yaml:"DT_CONFIG_API_TOKEN,omitempty"`
+	// SLIApiToken is an optional, usually read-only token that is used instead of the ApiToken to retrieve SLIs
+	SLIApiToken string `json:"DT_SLI_API_TOKEN,omitempty" yaml:"DT_SLI_API_TOKEN,omitempty"`
+	// ClientCert and ClientKey are an optional PEM encoded client certificate and its key, e.g. for an ActiveGate that requires mutual TLS
+	ClientCert string `json:"DT_CLIENT_CERT,omitempty" yaml:"DT_CLIENT_CERT,omitempty"`
+	ClientKey  string `json:"DT_CLIENT_KEY,omitempty" yaml:"DT_CLIENT_KEY,omitempty"`
+	// CACert is an optional PEM encoded certificate of the CA that signed the server certificate of the tenant or ActiveGate
+	CACert string `json:"DT_CA_CERT,omitempty" yaml:"DT_CA_CERT,omitempty"`
+	// PlatformURL and PlatformToken are the optional URL of the Dynatrace platform, e.g. https://abc12345.apps.dynatrace.com, and the platform token that DQL queries are sent with
+	PlatformURL   string `json:"DT_PLATFORM_URL,omitempty" yaml:"DT_PLATFORM_URL,omitempty"`
+	PlatformToken string `json:"DT_PLATFORM_TOKEN,omitempty" yaml:"DT_PLATFORM_TOKEN,omitempty"`
+	// SecretName is the name of the secret the credentials were read from, so that they can be read again after a rotation
+	SecretName string `json:"-" yaml:"-"`
+
+	purpose tokenPurpose
+}
+
+// tokenPurpose is the capability the ApiToken of DTCredentials has been selected for
+type tokenPurpose int
+
+const (
+	purposeDefault tokenPurpose = iota
+	purposeConfiguration
+	purposeSLI
+)
+
+// ForConfiguration returns a copy of the credentials that uses the ConfigApiToken as ApiToken, or the ApiToken if no ConfigApiToken is set
+func (c *DTCredentials) ForConfiguration() *DTCredentials {
+	return c.withPurpose(purposeConfiguration)
+}
+
+// ForSLI returns a copy of the credentials that uses the SLIApiToken as ApiToken, or the ApiToken if no SLIApiToken is set
+func (c *DTCredentials) ForSLI() *DTCredentials {
+	return c.withPurpose(purposeSLI)
+}
+
+func (c *DTCredentials) withPurpose(purpose tokenPurpose) *DTCredentials {
+	creds := *c
+	creds.purpose = purpose
+	switch {
+	case purpose == purposeConfiguration && c.ConfigApiToken != "":
+		creds.ApiToken = c.ConfigApiToken
+	case purpose == purposeSLI && c.SLIApiToken != "":
+		creds.ApiToken = c.SLIApiToken
+	}
+	return &creds
+}
+
+// NewTLSConfig returns the TLS configuration for requests with the credentials, which presents the client certificate and trusts the CA certificate if they are set
+func (c *DTCredentials) NewTLSConfig(insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if c == nil {
+		return tlsConfig, nil
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		certificate, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate in secret \"%s\": %v", c.SecretName, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if c.CACert != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, fmt.Errorf("invalid CA certificate in secret \"%s\"", c.SecretName)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	return tlsConfig, nil
 }
 
 type KeptnAPICredentials struct {
@@ -40,12 +118,26 @@ func getPodNamespace() string {
 	return ns
 }
 
+// getSecretBackend returns where the secrets are read from: kubernetes (default) or vault
+func getSecretBackend() string {
+	return strings.ToLower(getEnvWithDefault("SECRET_BACKEND", "kubernetes"))
+}
+
 type SecretReader interface {
 	ReadSecret(secretName, namespace, secretKey string) (string, error)
 }
 
+// secretDataReader is implemented by SecretReaders that read all keys of a secret at once, so that e.g. the Dynatrace credentials are read with a single request
+type secretDataReader interface {
+	ReadSecretData(secretName, namespace string) (map[string]string, error)
+}
+
+// K8sCredentialReader reads secrets from Kubernetes - the keys of a secret are cached for the secretCacheTTL, so that a secret is read once for all its keys
 type K8sCredentialReader struct {
 	K8sClient kubernetes.Interface
+
+	mutex   sync.Mutex
+	secrets secretCache
 }
 
 func NewK8sCredentialReader(k8sClient kubernetes.Interface) (*K8sCredentialReader, error) {
@@ -63,14 +155,46 @@ func NewK8sCredentialReader(k8sClient kubernetes.Interface) (*K8sCredentialReade
 }
 
 func (kcr *K8sCredentialReader) ReadSecret(secretName, namespace, secretKey string) (string, error) {
-	secret, err := kcr.K8sClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	data, err := kcr.ReadSecretData(secretName, namespace)
 	if err != nil {
 		return "", err
 	}
-	if string(secret.Data[secretKey]) == "" {
+	if data[secretKey] == "" {
 		return "", ErrSecretNotFound
 	}
-	return string(secret.Data[secretKey]), nil
+	return data[secretKey], nil
+}
+
+// ReadSecretData reads all keys of the secret with a single request or returns them from the cache
+func (kcr *K8sCredentialReader) ReadSecretData(secretName, namespace string) (map[string]string, error) {
+	cacheKey := namespace + "/" + secretName
+	kcr.mutex.Lock()
+	data, ok := kcr.secrets.get(cacheKey)
+	kcr.mutex.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	secret, err := kcr.K8sClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data = make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+
+	kcr.mutex.Lock()
+	kcr.secrets.set(cacheKey, data)
+	kcr.mutex.Unlock()
+	return data, nil
+}
+
+// InvalidateSecret removes the secret from the cache, so that e.g. a rotated API token is read again from Kubernetes - the secrets are read from the namespace of the dynatrace-service
+func (kcr *K8sCredentialReader) InvalidateSecret(secretName string) {
+	kcr.mutex.Lock()
+	defer kcr.mutex.Unlock()
+	kcr.secrets.invalidate(namespace + "/" + secretName)
 }
 
 type OSEnvCredentialReader struct{}
@@ -100,50 +224,217 @@ func NewCredentialManager(sr SecretReader) (*CredentialManager, error) {
 	} else if common.RunLocal || common.RunLocalTest {
 		cm.SecretReader = &OSEnvCredentialReader{}
 	} else {
-		sr, err := NewK8sCredentialReader(nil)
+		sr, err := newSecretReader(getSecretBackend())
 		if err != nil {
 			return nil, fmt.Errorf("could not initialize CredentialManager: %s", err.Error())
 		}
-		cm.SecretReader = sr
+		cm.SecretReader = withSecretFiles(sr)
 	}
 	return cm, nil
 }
 
+// defaultCredentialManager is the CredentialManager of the package-level functions like GetDynatraceCredentials. It is created only once, so that its
+// SecretReader is reused together with e.g. the Vault token or the cached secrets of AWS Secrets Manager and Azure Key Vault
+var defaultCredentialManager struct {
+	mutex sync.Mutex
+	cm    *CredentialManager
+}
+
+// SetDefaultCredentialManager sets the CredentialManager used by the package-level functions, e.g. the one created at the start of the dynatrace-service
+func SetDefaultCredentialManager(cm *CredentialManager) {
+	defaultCredentialManager.mutex.Lock()
+	defer defaultCredentialManager.mutex.Unlock()
+	defaultCredentialManager.cm = cm
+}
+
+// getDefaultCredentialManager returns the CredentialManager of the package-level functions and creates it on first use if none has been set
+func getDefaultCredentialManager() (*CredentialManager, error) {
+	defaultCredentialManager.mutex.Lock()
+	defer defaultCredentialManager.mutex.Unlock()
+	if defaultCredentialManager.cm == nil {
+		cm, err := NewCredentialManager(nil)
+		if err != nil {
+			return nil, err
+		}
+		defaultCredentialManager.cm = cm
+	}
+	return defaultCredentialManager.cm, nil
+}
+
+// newSecretReader creates the SecretReader of the secret backend configured by SECRET_BACKEND, Kubernetes secrets are used by default
+func newSecretReader(secretBackend string) (SecretReader, error) {
+	switch secretBackend {
+	case secretBackendVault:
+		return NewVaultSecretReaderFromEnv()
+	case secretBackendAWS:
+		return NewAWSSecretsManagerReaderFromEnv()
+	case secretBackendAzure:
+		return NewAzureKeyVaultReaderFromEnv()
+	default:
+		return NewK8sCredentialReader(nil)
+	}
+}
+
 func (cm *CredentialManager) GetDynatraceCredentials(dynatraceConfig *config.DynatraceConfigFile) (*DTCredentials, error) {
 	secretName := "dynatrace"
 	if dynatraceConfig != nil && len(dynatraceConfig.DtCreds) > 0 {
 		secretName = dynatraceConfig.DtCreds
 	}
+	return cm.readDynatraceCredentials(secretName)
+}
+
+/**
+ * GetDynatraceCredentialsForStage reads the Dynatrace credentials of a stage, so that e.g. production can point to a different tenant than dev.
+ * The secret defined by dtCreds of the dynatrace.conf.yaml is used if it is set, otherwise the secret dynatrace-<project>-<stage> if it exists
+ * and finally the default secret dynatrace. A stage secret that exists but can't be read, e.g. because the secret backend isn't reachable,
+ * results in an error instead, so that the stage isn't silently connected to the tenant of the default secret
+ */
+func (cm *CredentialManager) GetDynatraceCredentialsForStage(dynatraceConfig *config.DynatraceConfigFile, project string, stage string) (*DTCredentials, error) {
+	if (dynatraceConfig != nil && len(dynatraceConfig.DtCreds) > 0) || project == "" || stage == "" {
+		return cm.GetDynatraceCredentials(dynatraceConfig)
+	}
+
+	stageSecretName := GetStageSecretName(project, stage)
+	// a stage secret that isn't allowed as dtCreds is treated like a missing one, as it is only used by convention
+	if cm.checkSecretIsAllowed(stageSecretName) != nil {
+		return cm.GetDynatraceCredentials(dynatraceConfig)
+	}
+
+	creds, err := cm.readDynatraceCredentials(stageSecretName)
+	if err == nil {
+		return creds, nil
+	}
+	if !isSecretNotFound(err) {
+		return nil, err
+	}
+	return cm.GetDynatraceCredentials(dynatraceConfig)
+}
 
-	dtTenant, err := cm.SecretReader.ReadSecret(secretName, namespace, "DT_TENANT")
+// isSecretNotFound returns true if the error of a SecretReader means that the secret or its key doesn't exist, in contrast to e.g. a failed request
+func isSecretNotFound(err error) bool {
+	return errors.Is(err, ErrSecretNotFound) || k8serrors.IsNotFound(err)
+}
+
+// GetStageSecretName returns the name of the secret with the Dynatrace credentials of a stage by convention, e.g: dynatrace-sockshop-production
+func GetStageSecretName(project string, stage string) string {
+	return "dynatrace-" + project + "-" + stage
+}
+
+func (cm *CredentialManager) readDynatraceCredentials(secretName string) (*DTCredentials, error) {
+	if err := cm.checkSecretIsAllowed(secretName); err != nil {
+		return nil, err
+	}
+
+	data, err := cm.readSecretData(secretName, dynatraceCredentialKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	dtTenant, err := getRequiredSecretKey(data, secretName, "DT_TENANT")
 	if err != nil {
-		return nil, fmt.Errorf("key DT_TENANT was not found in secret \"%s\"", secretName)
+		return nil, err
 	}
 
-	dtAPIToken, err := cm.SecretReader.ReadSecret(secretName, namespace, "DT_API_TOKEN")
+	dtAPIToken, err := getRequiredSecretKey(data, secretName, "DT_API_TOKEN")
 	if err != nil {
-		return nil, fmt.Errorf("key DT_API_TOKEN was not found in secret \"%s\"", secretName)
+		return nil, err
+	}
+
+	creds := &DTCredentials{Tenant: getCleanURL(dtTenant), ApiToken: getCleanToken(dtAPIToken), SecretName: secretName}
+
+	// the tokens per capability are optional, the DT_API_TOKEN is used for everything that doesn't have its own token
+	creds.ConfigApiToken = getCleanToken(data["DT_CONFIG_API_TOKEN"])
+	creds.SLIApiToken = getCleanToken(data["DT_SLI_API_TOKEN"])
+
+	creds.ClientCert = data["DT_CLIENT_CERT"]
+	creds.ClientKey = data["DT_CLIENT_KEY"]
+	creds.CACert = data["DT_CA_CERT"]
+
+	// DQL queries are only accepted by the platform URL of the tenant and with a platform token instead of an API token
+	if platformURL := data["DT_PLATFORM_URL"]; platformURL != "" {
+		creds.PlatformURL = getCleanURL(platformURL)
+	}
+	creds.PlatformToken = getCleanToken(data["DT_PLATFORM_TOKEN"])
+
+	return creds, nil
+}
+
+// GetProblemSinkSecretValue reads a key of a secret that is referenced by a secretHeader of a problem sink - only secrets with the problemSinkSecretLabel are allowed
+func (cm *CredentialManager) GetProblemSinkSecretValue(secretName string, secretKey string) (string, error) {
+	if err := cm.checkProblemSinkSecretIsAllowed(secretName); err != nil {
+		return "", err
+	}
+	value, err := cm.SecretReader.ReadSecret(secretName, namespace, secretKey)
+	if err != nil {
+		return "", fmt.Errorf("key %s was not found in secret \"%s\"", secretKey, secretName)
+	}
+	return value, nil
+}
+
+// dynatraceCredentialKeys are all keys of a secret with Dynatrace credentials
+var dynatraceCredentialKeys = []string{
+	"DT_TENANT", "DT_API_TOKEN", "DT_CONFIG_API_TOKEN", "DT_SLI_API_TOKEN", "DT_CLIENT_CERT", "DT_CLIENT_KEY", "DT_CA_CERT", "DT_PLATFORM_URL", "DT_PLATFORM_TOKEN",
+}
+
+/**
+ * readSecretData returns the keys of the secret - a SecretReader that reads whole secrets is asked once, any other one once per key.
+ * A missing secret results in no keys, whereas the error of a failed read is wrapped, so that a missing secret can be told apart from a failed read
+ */
+func (cm *CredentialManager) readSecretData(secretName string, keys []string) (map[string]string, error) {
+	if dataReader, ok := cm.SecretReader.(secretDataReader); ok {
+		data, err := dataReader.ReadSecretData(secretName, namespace)
+		if err != nil && !isSecretNotFound(err) {
+			return nil, fmt.Errorf("could not read secret \"%s\": %w", secretName, err)
+		}
+		return data, nil
 	}
 
-	return &DTCredentials{Tenant: getCleanURL(dtTenant), ApiToken: getCleanToken(dtAPIToken)}, nil
+	data := map[string]string{}
+	for _, key := range keys {
+		value, err := cm.SecretReader.ReadSecret(secretName, namespace, key)
+		if err == nil {
+			data[key] = value
+			continue
+		}
+		if !isSecretNotFound(err) {
+			return nil, fmt.Errorf("could not read key %s of secret \"%s\": %w", key, secretName, err)
+		}
+	}
+	return data, nil
+}
+
+// getRequiredSecretKey returns the value of the key of the secret data or an error wrapping ErrSecretNotFound if it isn't set
+func getRequiredSecretKey(data map[string]string, secretName string, secretKey string) (string, error) {
+	if value := data[secretKey]; value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("key %s was not found in secret \"%s\": %w", secretKey, secretName, ErrSecretNotFound)
 }
 
+// GetKeptnAPICredentials reads the Keptn API URL and token from the secret "dynatrace" or the environment variables,
+// if they aren't configured there, the internal api-gateway-nginx service and the keptn-api-token secret of the Keptn installation are used
 func (cm *CredentialManager) GetKeptnAPICredentials() (*KeptnAPICredentials, error) {
 	secretName := "dynatrace"
 
 	apiURL, err := cm.SecretReader.ReadSecret(secretName, namespace, "KEPTN_API_URL")
 	if err != nil {
 		apiURL = os.Getenv("KEPTN_API_URL")
-		if apiURL == "" {
-			return nil, fmt.Errorf("key KEPTN_API_URL was not found in secret \"%s\" or environment variables", secretName)
+	}
+	if apiURL == "" {
+		apiURL, err = cm.discoverKeptnAPIURL()
+		if err != nil {
+			return nil, fmt.Errorf("key KEPTN_API_URL was not found in secret \"%s\" or environment variables and the service %s could not be discovered: %v", secretName, keptnAPIGatewayService, err)
 		}
 	}
 
 	apiToken, err := cm.SecretReader.ReadSecret(secretName, namespace, "KEPTN_API_TOKEN")
 	if err != nil {
 		apiToken = os.Getenv("KEPTN_API_TOKEN")
-		if apiToken == "" {
-			return nil, fmt.Errorf("key KEPTN_API_TOKEN was not found in secret \"%s\" or environment variables", secretName)
+	}
+	if apiToken == "" {
+		apiToken, err = cm.discoverKeptnAPIToken()
+		if err != nil {
+			return nil, fmt.Errorf("key KEPTN_API_TOKEN was not found in secret \"%s\", environment variables or secret \"%s\"", secretName, keptnAPITokenSecret)
 		}
 	}
 
@@ -185,17 +476,56 @@ func getCleanToken(token string) string {
 // GetDynatraceCredentials reads the Dynatrace credentials from the secret. Therefore, it first checks
 // if a secret is specified in the dynatrace.conf.yaml and if not defaults to the secret "dynatrace"
 func GetDynatraceCredentials(dynatraceConfig *config.DynatraceConfigFile) (*DTCredentials, error) {
-
-	cm, err := NewCredentialManager(nil)
+	cm, err := getDefaultCredentialManager()
 	if err != nil {
 		return nil, err
 	}
 	return cm.GetDynatraceCredentials(dynatraceConfig)
 }
 
+// GetDynatraceCredentialsForStage reads the Dynatrace credentials of the stage of a project from the dtCreds secret of the dynatrace.conf.yaml,
+// the secret dynatrace-<project>-<stage> or the secret "dynatrace" - the first one that is defined is used
+func GetDynatraceCredentialsForStage(dynatraceConfig *config.DynatraceConfigFile, project string, stage string) (*DTCredentials, error) {
+	cm, err := getDefaultCredentialManager()
+	if err != nil {
+		return nil, err
+	}
+	return cm.GetDynatraceCredentialsForStage(dynatraceConfig, project, stage)
+}
+
+// RefreshDynatraceCredentials reads the Dynatrace credentials again from the secret they were read from, e.g: after the API token has been rotated.
+// A cached secret is invalidated first, so that the rotated token is read from the secret backend
+// The refreshed credentials use the token of the same capability as the passed ones
+func RefreshDynatraceCredentials(creds *DTCredentials) (*DTCredentials, error) {
+	if creds == nil || creds.SecretName == "" {
+		return nil, errors.New("the secret of the Dynatrace credentials is unknown")
+	}
+	cm, err := getDefaultCredentialManager()
+	if err != nil {
+		return nil, err
+	}
+	if invalidator, ok := cm.SecretReader.(secretInvalidator); ok {
+		invalidator.InvalidateSecret(creds.SecretName)
+	}
+	refreshedCreds, err := cm.GetDynatraceCredentials(&config.DynatraceConfigFile{DtCreds: creds.SecretName})
+	if err != nil {
+		return nil, err
+	}
+	return refreshedCreds.withPurpose(creds.purpose), nil
+}
+
+// GetProblemSinkSecretValue reads a key of a secret that is referenced by a secretHeader of a problem sink with the CredentialManager of the dynatrace-service
+func GetProblemSinkSecretValue(secretName string, secretKey string) (string, error) {
+	cm, err := getDefaultCredentialManager()
+	if err != nil {
+		return "", err
+	}
+	return cm.GetProblemSinkSecretValue(secretName, secretKey)
+}
+
 // GetKeptnCredentials retrieves the Keptn Credentials from the "dynatrace" secret
 func GetKeptnCredentials() (*KeptnAPICredentials, error) {
-	cm, err := NewCredentialManager(nil)
+	cm, err := getDefaultCredentialManager()
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +559,7 @@ func CheckKeptnConnection(keptnCredentials *KeptnAPICredentials) error {
 
 // GetKeptnBridgeURL returns the bridge URL
 func GetKeptnBridgeURL() (string, error) {
-	cm, err := NewCredentialManager(nil)
+	cm, err := getDefaultCredentialManager()
 	if err != nil {
 		return "", err
 	}
@@ -1,16 +1,28 @@
 package credentials
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/config"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestCheckKeptnConnection(t *testing.T) {
@@ -240,8 +252,9 @@ func TestCredentialManager_GetDynatraceCredentials(t *testing.T) {
 				dynatraceConfig: nil,
 			},
 			want: &DTCredentials{
-				Tenant:   "https://mySampleEnv.live.dynatrace.com",
-				ApiToken: "abc123",
+				Tenant:     "https://mySampleEnv.live.dynatrace.com",
+				ApiToken:   "abc123",
+				SecretName: "dynatrace",
 			},
 			wantErr: false,
 		},
@@ -254,8 +267,9 @@ func TestCredentialManager_GetDynatraceCredentials(t *testing.T) {
 				},
 			},
 			want: &DTCredentials{
-				Tenant:   "https://mySampleEnv.live.dynatrace.com",
-				ApiToken: "abc123",
+				Tenant:     "https://mySampleEnv.live.dynatrace.com",
+				ApiToken:   "abc123",
+				SecretName: "dynatrace_other",
 			},
 			wantErr: false,
 		},
@@ -304,6 +318,308 @@ func TestCredentialManager_GetDynatraceCredentials(t *testing.T) {
 	}
 }
 
+func TestCredentialManager_GetDynatraceCredentialsForStage(t *testing.T) {
+	defaultSecret := createDynatraceDTSecret("dynatrace", "keptn", "https://dev.live.dynatrace.com", "abc123")
+	stageSecret := createDynatraceDTSecret("dynatrace-sockshop-production", "keptn", "https://prod.live.dynatrace.com", "xyz000")
+	otherSecret := createDynatraceDTSecret("dynatrace_other", "keptn", "https://other.live.dynatrace.com", "def456")
+
+	tests := []struct {
+		name            string
+		dynatraceConfig *config.DynatraceConfigFile
+		stage           string
+		wantSecret      string
+		wantTenant      string
+	}{
+		{
+			name:       "stage secret exists",
+			stage:      "production",
+			wantSecret: "dynatrace-sockshop-production",
+			wantTenant: "https://prod.live.dynatrace.com",
+		},
+		{
+			name:       "no stage secret falls back to default secret",
+			stage:      "dev",
+			wantSecret: "dynatrace",
+			wantTenant: "https://dev.live.dynatrace.com",
+		},
+		{
+			name:            "dtCreds takes precedence over stage secret",
+			dynatraceConfig: &config.DynatraceConfigFile{DtCreds: "dynatrace_other"},
+			stage:           "production",
+			wantSecret:      "dynatrace_other",
+			wantTenant:      "https://other.live.dynatrace.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretReader, err := NewK8sCredentialReader(fake.NewSimpleClientset(defaultSecret, stageSecret, otherSecret))
+			if err != nil {
+				t.Fatalf("NewK8sCredentialReader() error = %v", err)
+			}
+			cm, err := NewCredentialManager(secretReader)
+			if err != nil {
+				t.Fatalf("NewCredentialManager() error = %v", err)
+			}
+
+			got, err := cm.GetDynatraceCredentialsForStage(tt.dynatraceConfig, "sockshop", tt.stage)
+			if err != nil {
+				t.Fatalf("CredentialManager.GetDynatraceCredentialsForStage() error = %v", err)
+			}
+			if got.SecretName != tt.wantSecret || got.Tenant != tt.wantTenant {
+				t.Errorf("CredentialManager.GetDynatraceCredentialsForStage() = %v, want tenant %s of secret %s", got, tt.wantTenant, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestCredentialManager_GetDynatraceCredentialsForStage_ReadError(t *testing.T) {
+	defaultSecret := createDynatraceDTSecret("dynatrace", "keptn", "https://dev.live.dynatrace.com", "abc123")
+	stageSecret := createDynatraceDTSecret("dynatrace-sockshop-production", "keptn", "https://prod.live.dynatrace.com", "xyz000")
+
+	k8sClient := fake.NewSimpleClientset(defaultSecret, stageSecret)
+	readError := errors.New("connection refused")
+	k8sClient.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.GetAction).GetName() == "dynatrace-sockshop-production" {
+			return true, nil, readError
+		}
+		return false, nil, nil
+	})
+	secretReader, err := NewK8sCredentialReader(k8sClient)
+	if err != nil {
+		t.Fatalf("NewK8sCredentialReader() error = %v", err)
+	}
+	cm, err := NewCredentialManager(secretReader)
+	if err != nil {
+		t.Fatalf("NewCredentialManager() error = %v", err)
+	}
+
+	// the stage secret exists, so the default secret of another tenant must not be used instead
+	got, err := cm.GetDynatraceCredentialsForStage(nil, "sockshop", "production")
+	if !errors.Is(err, readError) {
+		t.Errorf("CredentialManager.GetDynatraceCredentialsForStage() = %v, error = %v, want error %v", got, err, readError)
+	}
+}
+
+func TestCredentialManager_GetDynatraceCredentials_SingleRead(t *testing.T) {
+	secret := createDynatraceDTSecret("dynatrace", "keptn", "https://mySampleEnv.live.dynatrace.com", "abc123")
+	secret.Data["DT_SLI_API_TOKEN"] = []byte("sli789")
+
+	k8sClient := fake.NewSimpleClientset(secret)
+	secretReader, err := NewK8sCredentialReader(k8sClient)
+	if err != nil {
+		t.Fatalf("NewK8sCredentialReader() error = %v", err)
+	}
+	cm, err := NewCredentialManager(secretReader)
+	if err != nil {
+		t.Fatalf("NewCredentialManager() error = %v", err)
+	}
+
+	got, err := cm.GetDynatraceCredentials(nil)
+	if err != nil {
+		t.Fatalf("CredentialManager.GetDynatraceCredentials() error = %v", err)
+	}
+	if got.ForSLI().ApiToken != "sli789" {
+		t.Errorf("ForSLI().ApiToken = %s, want sli789", got.ForSLI().ApiToken)
+	}
+	// all keys, including the optional ones, are taken from a single read of the secret
+	if reads := len(k8sClient.Actions()); reads != 1 {
+		t.Errorf("CredentialManager.GetDynatraceCredentials() read the secret %d times, want 1", reads)
+	}
+}
+
+func TestCredentialManager_GetDynatraceCredentials_TokensPerCapability(t *testing.T) {
+	singleTokenSecret := createDynatraceDTSecret("dynatrace", "keptn", "https://mySampleEnv.live.dynatrace.com", "abc123")
+	separateTokensSecret := createDynatraceDTSecret("dynatrace_separate", "keptn", "https://mySampleEnv.live.dynatrace.com", "abc123")
+	separateTokensSecret.Data["DT_CONFIG_API_TOKEN"] = []byte("config456\n")
+	separateTokensSecret.Data["DT_SLI_API_TOKEN"] = []byte("sli789")
+
+	tests := []struct {
+		name                string
+		secretName          string
+		wantConfigAPIToken  string
+		wantSLIAPIToken     string
+		wantDefaultAPIToken string
+	}{
+		{
+			name:                "single token is used for all capabilities",
+			secretName:          "dynatrace",
+			wantConfigAPIToken:  "abc123",
+			wantSLIAPIToken:     "abc123",
+			wantDefaultAPIToken: "abc123",
+		},
+		{
+			name:                "separate tokens per capability",
+			secretName:          "dynatrace_separate",
+			wantConfigAPIToken:  "config456",
+			wantSLIAPIToken:     "sli789",
+			wantDefaultAPIToken: "abc123",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretReader, err := NewK8sCredentialReader(fake.NewSimpleClientset(singleTokenSecret, separateTokensSecret))
+			if err != nil {
+				t.Fatalf("NewK8sCredentialReader() error = %v", err)
+			}
+			cm, err := NewCredentialManager(secretReader)
+			if err != nil {
+				t.Fatalf("NewCredentialManager() error = %v", err)
+			}
+
+			got, err := cm.GetDynatraceCredentials(&config.DynatraceConfigFile{DtCreds: tt.secretName})
+			if err != nil {
+				t.Fatalf("CredentialManager.GetDynatraceCredentials() error = %v", err)
+			}
+			if got.ApiToken != tt.wantDefaultAPIToken {
+				t.Errorf("ApiToken = %s, want %s", got.ApiToken, tt.wantDefaultAPIToken)
+			}
+			if got.ForConfiguration().ApiToken != tt.wantConfigAPIToken {
+				t.Errorf("ForConfiguration().ApiToken = %s, want %s", got.ForConfiguration().ApiToken, tt.wantConfigAPIToken)
+			}
+			if got.ForSLI().ApiToken != tt.wantSLIAPIToken {
+				t.Errorf("ForSLI().ApiToken = %s, want %s", got.ForSLI().ApiToken, tt.wantSLIAPIToken)
+			}
+		})
+	}
+}
+
+func TestCredentialManager_GetDynatraceCredentials_Platform(t *testing.T) {
+	classicSecret := createDynatraceDTSecret("dynatrace", "keptn", "https://abc12345.live.dynatrace.com", "abc123")
+	platformSecret := createDynatraceDTSecret("dynatrace_platform", "keptn", "https://abc12345.live.dynatrace.com", "abc123")
+	platformSecret.Data["DT_PLATFORM_URL"] = []byte("abc12345.apps.dynatrace.com/\n")
+	platformSecret.Data["DT_PLATFORM_TOKEN"] = []byte("dt0s16.platform\n")
+
+	tests := []struct {
+		name              string
+		secretName        string
+		wantPlatformURL   string
+		wantPlatformToken string
+	}{
+		{
+			name:       "no platform credentials",
+			secretName: "dynatrace",
+		},
+		{
+			name:              "platform credentials are cleaned",
+			secretName:        "dynatrace_platform",
+			wantPlatformURL:   "https://abc12345.apps.dynatrace.com",
+			wantPlatformToken: "dt0s16.platform",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretReader, err := NewK8sCredentialReader(fake.NewSimpleClientset(classicSecret, platformSecret))
+			if err != nil {
+				t.Fatalf("NewK8sCredentialReader() error = %v", err)
+			}
+			cm, err := NewCredentialManager(secretReader)
+			if err != nil {
+				t.Fatalf("NewCredentialManager() error = %v", err)
+			}
+
+			got, err := cm.GetDynatraceCredentials(&config.DynatraceConfigFile{DtCreds: tt.secretName})
+			if err != nil {
+				t.Fatalf("CredentialManager.GetDynatraceCredentials() error = %v", err)
+			}
+			if got.ForSLI().PlatformURL != tt.wantPlatformURL {
+				t.Errorf("PlatformURL = %s, want %s", got.ForSLI().PlatformURL, tt.wantPlatformURL)
+			}
+			if got.ForSLI().PlatformToken != tt.wantPlatformToken {
+				t.Errorf("PlatformToken = %s, want %s", got.ForSLI().PlatformToken, tt.wantPlatformToken)
+			}
+		})
+	}
+}
+
+func TestDTCredentials_NewTLSConfig(t *testing.T) {
+	clientCert, clientKey := createClientCertificate(t)
+
+	activeGateMockServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM([]byte(clientCert))
+	activeGateMockServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	activeGateMockServer.StartTLS()
+	defer activeGateMockServer.Close()
+
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: activeGateMockServer.Certificate().Raw}))
+
+	tests := []struct {
+		name         string
+		creds        *DTCredentials
+		wantErr      bool
+		wantRejected bool
+	}{
+		{
+			name:  "client certificate is presented",
+			creds: &DTCredentials{ClientCert: clientCert, ClientKey: clientKey, CACert: caCert},
+		},
+		{
+			name:         "no client certificate is rejected",
+			creds:        &DTCredentials{CACert: caCert},
+			wantRejected: true,
+		},
+		{
+			name:    "invalid client key",
+			creds:   &DTCredentials{ClientCert: clientCert, ClientKey: "invalid", CACert: caCert},
+			wantErr: true,
+		},
+		{
+			name:    "invalid CA certificate",
+			creds:   &DTCredentials{CACert: "invalid"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := tt.creds.NewTLSConfig(false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DTCredentials.NewTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Get(activeGateMockServer.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantRejected {
+				t.Errorf("request to ActiveGate error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+		})
+	}
+}
+
+// createClientCertificate returns a self-signed PEM encoded client certificate and its key
+func createClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dynatrace-service"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})), string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
 func createDynatraceDTSecret(name string, namespace string, dtTenant string, dtAPIToken string) *v1.Secret {
 	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -506,3 +822,34 @@ func createDynatraceKeptnSecret(name string, namespace string, keptnAPIURL strin
 		},
 	}
 }
+
+func TestSetDefaultCredentialManager(t *testing.T) {
+	defer SetDefaultCredentialManager(nil)
+
+	k8sSecretReader, _ := NewK8sCredentialReader(fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dynatrace",
+			Namespace: "keptn",
+		},
+		Data: map[string][]byte{
+			"KEPTN_BRIDGE_URL": []byte("bridge.keptn"),
+		},
+	}))
+	cm, err := NewCredentialManager(k8sSecretReader)
+	if err != nil {
+		t.Fatalf("could not initialize CredentialManager: %s", err.Error())
+	}
+	SetDefaultCredentialManager(cm)
+
+	got, err := getDefaultCredentialManager()
+	if err != nil || got != cm {
+		t.Errorf("getDefaultCredentialManager() = %v, %v, want the CredentialManager that has been set", got, err)
+	}
+	bridgeURL, err := GetKeptnBridgeURL()
+	if err != nil {
+		t.Fatalf("GetKeptnBridgeURL() error = %v", err)
+	}
+	if bridgeURL != "https://bridge.keptn" {
+		t.Errorf("GetKeptnBridgeURL() = %s, want https://bridge.keptn", bridgeURL)
+	}
+}
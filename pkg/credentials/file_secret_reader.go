@@ -0,0 +1,163 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSecretName is the name of the secret that is used if no dtCreds are configured
+const defaultSecretName = "dynatrace"
+
+/**
+ * FileSecretReader reads secrets from files mounted into the pod, e.g. by the Secrets Store CSI driver or the Vault agent injector.
+ * The key DT_API_TOKEN of the secret dynatrace-preprod is read from <Path>/dynatrace-preprod/DT_API_TOKEN,
+ * the keys of the default secret dynatrace can also be mounted directly as <Path>/DT_API_TOKEN
+ */
+type FileSecretReader struct {
+	Path string
+}
+
+// ReadSecret reads the key of the secret from its file - the namespace is ignored as the files are mounted into the pod
+func (fsr *FileSecretReader) ReadSecret(secretName, namespace, secretKey string) (string, error) {
+	if !isValidSecretFileName(secretName) || !isValidSecretFileName(secretKey) {
+		return "", ErrSecretNotFound
+	}
+	filenames := []string{filepath.Join(fsr.Path, secretName, secretKey)}
+	if secretName == defaultSecretName {
+		filenames = append(filenames, filepath.Join(fsr.Path, secretKey))
+	}
+
+	for _, filename := range filenames {
+		if !fsr.isBelowPath(filename) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		if value := strings.TrimSpace(string(content)); value != "" {
+			return value, nil
+		}
+	}
+	return "", ErrSecretNotFound
+}
+
+// ReadSecretData reads all keys of the secret from the files of its directory - keys of the default secret mounted directly are read as well
+func (fsr *FileSecretReader) ReadSecretData(secretName, namespace string) (map[string]string, error) {
+	if !isValidSecretFileName(secretName) {
+		return nil, ErrSecretNotFound
+	}
+	directories := []string{filepath.Join(fsr.Path, secretName)}
+	if secretName == defaultSecretName {
+		directories = append(directories, fsr.Path)
+	}
+
+	data := map[string]string{}
+	for _, directory := range directories {
+		if !fsr.isBelowPath(directory) {
+			continue
+		}
+		files, err := ioutil.ReadDir(directory)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || data[file.Name()] != "" {
+				continue
+			}
+			content, err := ioutil.ReadFile(filepath.Join(directory, file.Name()))
+			if err != nil {
+				continue
+			}
+			if value := strings.TrimSpace(string(content)); value != "" {
+				data[file.Name()] = value
+			}
+		}
+	}
+	if len(data) == 0 {
+		return nil, ErrSecretNotFound
+	}
+	return data, nil
+}
+
+// isValidSecretFileName returns whether the name of a secret or key can be used as a file name, so that e.g. dtCreds can't read files outside of the mounted secrets
+func isValidSecretFileName(name string) bool {
+	return name != "" && name != "." && !strings.Contains(name, "..") && !strings.ContainsAny(name, `/\`)
+}
+
+// isBelowPath returns whether the cleaned filename is the Path of the mounted secrets or a file or directory below it
+func (fsr *FileSecretReader) isBelowPath(filename string) bool {
+	relativePath, err := filepath.Rel(filepath.Clean(fsr.Path), filepath.Clean(filename))
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// fallbackSecretReader reads a secret from the first of its SecretReaders that contains it
+type fallbackSecretReader struct {
+	secretReaders []SecretReader
+}
+
+func (fsr *fallbackSecretReader) ReadSecret(secretName, namespace, secretKey string) (string, error) {
+	var lastErr error = ErrSecretNotFound
+	for _, secretReader := range fsr.secretReaders {
+		value, err := secretReader.ReadSecret(secretName, namespace, secretKey)
+		if err == nil {
+			return value, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+/**
+ * ReadSecretData merges the keys of the secret of all SecretReaders, a key is taken from the first SecretReader that contains it.
+ * SecretReaders that can't read whole secrets are skipped - the error of a failed read is only returned if no SecretReader contains the secret
+ */
+func (fsr *fallbackSecretReader) ReadSecretData(secretName, namespace string) (map[string]string, error) {
+	var lastErr error = ErrSecretNotFound
+	data := map[string]string{}
+	for _, secretReader := range fsr.secretReaders {
+		dataReader, ok := secretReader.(secretDataReader)
+		if !ok {
+			continue
+		}
+		secretData, err := dataReader.ReadSecretData(secretName, namespace)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for key, value := range secretData {
+			if _, exists := data[key]; !exists {
+				data[key] = value
+			}
+		}
+	}
+	if len(data) == 0 {
+		return nil, lastErr
+	}
+	return data, nil
+}
+
+// InvalidateSecret invalidates the secret in all SecretReaders that cache secrets
+func (fsr *fallbackSecretReader) InvalidateSecret(secretName string) {
+	for _, secretReader := range fsr.secretReaders {
+		if invalidator, ok := secretReader.(secretInvalidator); ok {
+			invalidator.InvalidateSecret(secretName)
+		}
+	}
+}
+
+// getSecretFilesPath returns the directory of the mounted secret files or an empty string if credentials are not read from files
+func getSecretFilesPath() string {
+	return os.Getenv("SECRET_FILES_PATH")
+}
+
+// withSecretFiles returns a SecretReader that reads the mounted secret files first and falls back to the passed SecretReader if SECRET_FILES_PATH is set
+func withSecretFiles(sr SecretReader) SecretReader {
+	path := getSecretFilesPath()
+	if path == "" {
+		return sr
+	}
+	return &fallbackSecretReader{secretReaders: []SecretReader{&FileSecretReader{Path: path}, sr}}
+}
@@ -0,0 +1,127 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFileSecretReader_ReadSecret(t *testing.T) {
+	path := t.TempDir()
+	writeSecretFile(t, filepath.Join(path, "DT_TENANT"), "https://mounted.live.dynatrace.com\n")
+	writeSecretFile(t, filepath.Join(path, "DT_API_TOKEN"), "mounted-token\n")
+	writeSecretFile(t, filepath.Join(path, "dynatrace-preprod", "DT_TENANT"), "https://preprod.live.dynatrace.com")
+	writeSecretFile(t, filepath.Join(path, "dynatrace-preprod", "DT_API_TOKEN"), "preprod-token")
+
+	k8sSecretReader, err := NewK8sCredentialReader(fake.NewSimpleClientset(createDynatraceDTSecret("dynatrace-other", "keptn", "https://other.live.dynatrace.com", "other-token")))
+	if err != nil {
+		t.Fatalf("NewK8sCredentialReader() error = %v", err)
+	}
+
+	os.Setenv("SECRET_FILES_PATH", path)
+	defer os.Unsetenv("SECRET_FILES_PATH")
+
+	cm, err := NewCredentialManager(withSecretFiles(k8sSecretReader))
+	if err != nil {
+		t.Fatalf("NewCredentialManager() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		dtCreds    string
+		wantTenant string
+		wantToken  string
+	}{
+		{
+			name:       "default secret mounted directly",
+			wantTenant: "https://mounted.live.dynatrace.com",
+			wantToken:  "mounted-token",
+		},
+		{
+			name:       "dtCreds secret mounted as directory",
+			dtCreds:    "dynatrace-preprod",
+			wantTenant: "https://preprod.live.dynatrace.com",
+			wantToken:  "preprod-token",
+		},
+		{
+			name:       "secret that isn't mounted is read from Kubernetes",
+			dtCreds:    "dynatrace-other",
+			wantTenant: "https://other.live.dynatrace.com",
+			wantToken:  "other-token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cm.GetDynatraceCredentials(&config.DynatraceConfigFile{DtCreds: tt.dtCreds})
+			if err != nil {
+				t.Fatalf("GetDynatraceCredentials() error = %v", err)
+			}
+			if got.Tenant != tt.wantTenant || got.ApiToken != tt.wantToken {
+				t.Errorf("GetDynatraceCredentials() = %v, want tenant %s and token %s", got, tt.wantTenant, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestFileSecretReader_ReadSecret_OutsideOfPath(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "secrets")
+	writeSecretFile(t, filepath.Join(path, "dynatrace", "DT_API_TOKEN"), "mounted-token")
+	writeSecretFile(t, filepath.Join(root, "other", "DT_API_TOKEN"), "other-token")
+	writeSecretFile(t, filepath.Join(root, "DT_API_TOKEN"), "root-token")
+
+	fsr := &FileSecretReader{Path: path}
+	tests := []struct {
+		name       string
+		secretName string
+		secretKey  string
+	}{
+		{
+			name:       "secret name with parent directory",
+			secretName: "../other",
+			secretKey:  "DT_API_TOKEN",
+		},
+		{
+			name:       "secret name of the parent directory",
+			secretName: "..",
+			secretKey:  "DT_API_TOKEN",
+		},
+		{
+			name:       "secret key with parent directory",
+			secretName: "dynatrace",
+			secretKey:  "../../other/DT_API_TOKEN",
+		},
+		{
+			name:       "secret key with path separator",
+			secretName: "dynatrace",
+			secretKey:  "sub/DT_API_TOKEN",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := fsr.ReadSecret(tt.secretName, namespace, tt.secretKey); err != ErrSecretNotFound {
+				t.Errorf("ReadSecret() = %s, %v, want %v", got, err, ErrSecretNotFound)
+			}
+		})
+	}
+
+	if got, err := fsr.ReadSecretData("../other", namespace); err != ErrSecretNotFound {
+		t.Errorf("ReadSecretData() = %v, %v, want %v", got, err, ErrSecretNotFound)
+	}
+	if got, err := fsr.ReadSecret("dynatrace", namespace, "DT_API_TOKEN"); err != nil || got != "mounted-token" {
+		t.Errorf("ReadSecret() = %s, %v, want mounted-token", got, err)
+	}
+}
+
+func writeSecretFile(t *testing.T, filename string, content string) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// keptnAPIGatewayService is the name of the service of the Keptn API gateway that is installed with the Keptn control plane
+const keptnAPIGatewayService = "api-gateway-nginx"
+
+// keptnAPITokenSecret is the name of the secret and its key that contain the Keptn API token created by the Keptn installation
+const keptnAPITokenSecret = "keptn-api-token"
+
+// discoverKeptnAPIURL returns the cluster-internal URL of the Keptn API if the api-gateway-nginx service is found in the namespace of the dynatrace-service
+func (cm *CredentialManager) discoverKeptnAPIURL() (string, error) {
+	k8sClient, err := getK8sClientOf(cm.SecretReader)
+	if err != nil {
+		return "", err
+	}
+
+	service, err := k8sClient.CoreV1().Services(namespace).Get(context.TODO(), keptnAPIGatewayService, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	address := fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace)
+	if len(service.Spec.Ports) > 0 && service.Spec.Ports[0].Port != 80 {
+		address = fmt.Sprintf("%s:%d", address, service.Spec.Ports[0].Port)
+	}
+	return "http://" + address + "/api", nil
+}
+
+// discoverKeptnAPIToken reads the Keptn API token from the keptn-api-token secret that is created by the Keptn installation
+func (cm *CredentialManager) discoverKeptnAPIToken() (string, error) {
+	return cm.SecretReader.ReadSecret(keptnAPITokenSecret, namespace, keptnAPITokenSecret)
+}
+
+// getK8sClientOf returns the Kubernetes client of the SecretReader if it reads Kubernetes secrets, or creates a new one otherwise
+func getK8sClientOf(sr SecretReader) (kubernetes.Interface, error) {
+	switch secretReader := sr.(type) {
+	case *K8sCredentialReader:
+		return secretReader.K8sClient, nil
+	case *fallbackSecretReader:
+		for _, r := range secretReader.secretReaders {
+			if k8sSecretReader, ok := r.(*K8sCredentialReader); ok {
+				return k8sSecretReader.K8sClient, nil
+			}
+		}
+	}
+	k8sClient, err := common.GetKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	if k8sClient == nil {
+		return nil, errors.New("no Kubernetes client is available when running locally")
+	}
+	return k8sClient, nil
+}
@@ -0,0 +1,77 @@
+package credentials
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCredentialManager_GetKeptnAPICredentials_Discovery(t *testing.T) {
+	apiGatewayService := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-gateway-nginx", Namespace: "keptn"},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	apiTokenSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "keptn-api-token", Namespace: "keptn"},
+		Data:       map[string][]byte{"keptn-api-token": []byte("discovered-token")},
+	}
+	dynatraceSecret := createDynatraceKeptnSecret("dynatrace", "keptn", "https://keptn.example.com/api", "abc123", "")
+
+	tests := []struct {
+		name           string
+		objects        []runtime.Object
+		apiTokenEnvVar string
+		want           *KeptnAPICredentials
+		wantErr        bool
+	}{
+		{
+			name:    "discover service and token",
+			objects: []runtime.Object{apiGatewayService, apiTokenSecret},
+			want:    &KeptnAPICredentials{APIURL: "http://api-gateway-nginx.keptn.svc.cluster.local/api", APIToken: "discovered-token"},
+		},
+		{
+			name:           "discover service and use token of environment variable",
+			objects:        []runtime.Object{apiGatewayService},
+			apiTokenEnvVar: "env-token",
+			want:           &KeptnAPICredentials{APIURL: "http://api-gateway-nginx.keptn.svc.cluster.local/api", APIToken: "env-token"},
+		},
+		{
+			name:    "configured credentials take precedence",
+			objects: []runtime.Object{apiGatewayService, apiTokenSecret, dynatraceSecret},
+			want:    &KeptnAPICredentials{APIURL: "https://keptn.example.com/api", APIToken: "abc123"},
+		},
+		{
+			name:    "no service to discover",
+			objects: []runtime.Object{apiTokenSecret},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("KEPTN_API_TOKEN", tt.apiTokenEnvVar)
+			defer os.Unsetenv("KEPTN_API_TOKEN")
+
+			secretReader, err := NewK8sCredentialReader(fake.NewSimpleClientset(tt.objects...))
+			if err != nil {
+				t.Fatalf("NewK8sCredentialReader() error = %v", err)
+			}
+			cm, err := NewCredentialManager(secretReader)
+			if err != nil {
+				t.Fatalf("NewCredentialManager() error = %v", err)
+			}
+
+			got, err := cm.GetKeptnAPICredentials()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CredentialManager.GetKeptnAPICredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CredentialManager.GetKeptnAPICredentials() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
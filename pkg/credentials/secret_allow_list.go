@@ -0,0 +1,101 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// problemSinkSecretLabel is the label a Kubernetes secret needs to be referenced by a secretHeader of a problem sink
+const problemSinkSecretLabel = "dynatrace-service/problem-sink"
+
+// getAllowedSecrets returns the patterns of the secret names that may be referenced by dtCreds, e.g: dynatrace-*. If none are configured, all secrets are allowed
+func getAllowedSecrets() []string {
+	var patterns []string
+	for _, pattern := range strings.Split(os.Getenv("DTCREDS_ALLOWED_SECRETS"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// getRequiredSecretLabel returns the label in the format key=value that a Kubernetes secret needs to be used as dtCreds, or an empty key if none is required
+func getRequiredSecretLabel() (string, string) {
+	label := strings.TrimSpace(os.Getenv("DTCREDS_REQUIRED_SECRET_LABEL"))
+	if label == "" {
+		return "", ""
+	}
+	keyAndValue := strings.SplitN(label, "=", 2)
+	if len(keyAndValue) == 1 {
+		return keyAndValue[0], ""
+	}
+	return keyAndValue[0], keyAndValue[1]
+}
+
+/**
+ * checkSecretIsAllowed returns an error if the secret must not be used for Dynatrace credentials, as it isn't part of DTCREDS_ALLOWED_SECRETS
+ * or doesn't have the label DTCREDS_REQUIRED_SECRET_LABEL. The default secret dynatrace is always allowed, as it is configured by the admin of the installation
+ */
+func (cm *CredentialManager) checkSecretIsAllowed(secretName string) error {
+	if secretName == defaultSecretName {
+		return nil
+	}
+
+	if patterns := getAllowedSecrets(); len(patterns) > 0 && !matchesAnyPattern(secretName, patterns) {
+		return fmt.Errorf("secret \"%s\" is not allowed as dtCreds: it doesn't match %s", secretName, strings.Join(patterns, ","))
+	}
+
+	labelKey, labelValue := getRequiredSecretLabel()
+	if labelKey == "" {
+		return nil
+	}
+	k8sClient, err := getK8sClientOf(cm.SecretReader)
+	if err != nil {
+		return fmt.Errorf("could not check the labels of secret \"%s\": %v", secretName, err)
+	}
+	secret, err := k8sClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not check the labels of secret \"%s\": %v", secretName, err)
+	}
+	if value, ok := secret.Labels[labelKey]; !ok || (labelValue != "" && value != labelValue) {
+		return fmt.Errorf("secret \"%s\" is not allowed as dtCreds: it doesn't have the label %s", secretName, os.Getenv("DTCREDS_REQUIRED_SECRET_LABEL"))
+	}
+	return nil
+}
+
+/**
+ * checkProblemSinkSecretIsAllowed returns an error if the secret must not be sent to a problem sink. As the dynatrace.conf.yaml is stored in the Git repository of the project,
+ * only Kubernetes secrets with the label problemSinkSecretLabel=true are allowed, and never the secret dynatrace or the dynatrace-* secrets of the Dynatrace credentials
+ */
+func (cm *CredentialManager) checkProblemSinkSecretIsAllowed(secretName string) error {
+	if secretName == defaultSecretName || strings.HasPrefix(secretName, defaultSecretName+"-") {
+		return fmt.Errorf("secret \"%s\" is not allowed for problem sinks: it may contain Dynatrace credentials", secretName)
+	}
+
+	k8sClient, err := getK8sClientOf(cm.SecretReader)
+	if err != nil {
+		return fmt.Errorf("could not check the labels of secret \"%s\": %v", secretName, err)
+	}
+	secret, err := k8sClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not check the labels of secret \"%s\": %v", secretName, err)
+	}
+	if secret.Labels[problemSinkSecretLabel] != "true" {
+		return fmt.Errorf("secret \"%s\" is not allowed for problem sinks: it doesn't have the label %s=true", secretName, problemSinkSecretLabel)
+	}
+	return nil
+}
+
+func matchesAnyPattern(secretName string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, secretName); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
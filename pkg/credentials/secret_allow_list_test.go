@@ -0,0 +1,153 @@
+package credentials
+
+import (
+	"os"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCredentialManager_GetDynatraceCredentials_AllowedSecrets(t *testing.T) {
+	defaultSecret := createDynatraceDTSecret("dynatrace", "keptn", "https://dev.live.dynatrace.com", "abc123")
+	teamSecret := createDynatraceDTSecret("dynatrace-team-a", "keptn", "https://team-a.live.dynatrace.com", "def456")
+	teamSecret.Labels = map[string]string{"dynatrace-service/dtcreds": "true"}
+	otherSecret := createDynatraceDTSecret("keptn-api-token", "keptn", "https://other.live.dynatrace.com", "xyz000")
+
+	tests := []struct {
+		name           string
+		allowedSecrets string
+		requiredLabel  string
+		dtCreds        string
+		wantErr        bool
+	}{
+		{
+			name:    "all secrets are allowed by default",
+			dtCreds: "keptn-api-token",
+		},
+		{
+			name:           "secret matches allowed pattern",
+			allowedSecrets: "dynatrace-prod, dynatrace-team-*",
+			dtCreds:        "dynatrace-team-a",
+		},
+		{
+			name:           "secret doesn't match allowed pattern",
+			allowedSecrets: "dynatrace-team-*",
+			dtCreds:        "keptn-api-token",
+			wantErr:        true,
+		},
+		{
+			name:           "default secret is always allowed",
+			allowedSecrets: "dynatrace-team-*",
+			requiredLabel:  "dynatrace-service/dtcreds=true",
+		},
+		{
+			name:          "secret has required label",
+			requiredLabel: "dynatrace-service/dtcreds=true",
+			dtCreds:       "dynatrace-team-a",
+		},
+		{
+			name:          "secret has required label key",
+			requiredLabel: "dynatrace-service/dtcreds",
+			dtCreds:       "dynatrace-team-a",
+		},
+		{
+			name:          "secret has label with other value",
+			requiredLabel: "dynatrace-service/dtcreds=false",
+			dtCreds:       "dynatrace-team-a",
+			wantErr:       true,
+		},
+		{
+			name:          "secret doesn't have required label",
+			requiredLabel: "dynatrace-service/dtcreds=true",
+			dtCreds:       "keptn-api-token",
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("DTCREDS_ALLOWED_SECRETS", tt.allowedSecrets)
+			defer os.Unsetenv("DTCREDS_ALLOWED_SECRETS")
+			os.Setenv("DTCREDS_REQUIRED_SECRET_LABEL", tt.requiredLabel)
+			defer os.Unsetenv("DTCREDS_REQUIRED_SECRET_LABEL")
+
+			secretReader, err := NewK8sCredentialReader(fake.NewSimpleClientset(defaultSecret, teamSecret, otherSecret))
+			if err != nil {
+				t.Fatalf("NewK8sCredentialReader() error = %v", err)
+			}
+			cm, err := NewCredentialManager(secretReader)
+			if err != nil {
+				t.Fatalf("NewCredentialManager() error = %v", err)
+			}
+
+			_, err = cm.GetDynatraceCredentials(&config.DynatraceConfigFile{DtCreds: tt.dtCreds})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CredentialManager.GetDynatraceCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCredentialManager_GetProblemSinkSecretValue(t *testing.T) {
+	sinkSecret := createDynatraceDTSecret("itsm-webhook", "keptn", "", "")
+	sinkSecret.Labels = map[string]string{"dynatrace-service/problem-sink": "true"}
+	sinkSecret.Data["AUTHORIZATION"] = []byte("Bearer my-itsm-token")
+	labeledDynatraceSecret := createDynatraceDTSecret("dynatrace-team-a", "keptn", "https://team-a.live.dynatrace.com", "def456")
+	labeledDynatraceSecret.Labels = map[string]string{"dynatrace-service/problem-sink": "true"}
+	unlabeledSecret := createDynatraceDTSecret("other-webhook", "keptn", "", "")
+	unlabeledSecret.Data["AUTHORIZATION"] = []byte("Bearer my-other-token")
+
+	tests := []struct {
+		name       string
+		secretName string
+		secretKey  string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "secret has problem sink label",
+			secretName: "itsm-webhook",
+			secretKey:  "AUTHORIZATION",
+			want:       "Bearer my-itsm-token",
+		},
+		{
+			name:       "secret doesn't have problem sink label",
+			secretName: "other-webhook",
+			secretKey:  "AUTHORIZATION",
+			wantErr:    true,
+		},
+		{
+			name:       "default secret is never allowed",
+			secretName: "dynatrace",
+			secretKey:  "DT_API_TOKEN",
+			wantErr:    true,
+		},
+		{
+			name:       "dynatrace-* secret is never allowed, even with the label",
+			secretName: "dynatrace-team-a",
+			secretKey:  "DT_API_TOKEN",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultSecret := createDynatraceDTSecret("dynatrace", "keptn", "https://dev.live.dynatrace.com", "abc123")
+			secretReader, err := NewK8sCredentialReader(fake.NewSimpleClientset(defaultSecret, sinkSecret, labeledDynatraceSecret, unlabeledSecret))
+			if err != nil {
+				t.Fatalf("NewK8sCredentialReader() error = %v", err)
+			}
+			cm, err := NewCredentialManager(secretReader)
+			if err != nil {
+				t.Fatalf("NewCredentialManager() error = %v", err)
+			}
+
+			got, err := cm.GetProblemSinkSecretValue(tt.secretName, tt.secretKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CredentialManager.GetProblemSinkSecretValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CredentialManager.GetProblemSinkSecretValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package credentials
+
+import (
+	"time"
+)
+
+// secretCacheTTL is the time the keys of a secret are reused before they are read again, so that a rotated secret is picked up within a minute
+const secretCacheTTL = time.Minute
+
+// secretInvalidator is implemented by SecretReaders that cache secrets, so that a secret is read again after its credentials have been rejected
+type secretInvalidator interface {
+	InvalidateSecret(secretName string)
+}
+
+type secretCacheEntry struct {
+	data      map[string]string
+	expiresAt time.Time
+}
+
+// secretCache stores the keys of the secrets read from a secret backend for the secretCacheTTL - it has to be guarded by the mutex of its SecretReader
+type secretCache struct {
+	entries map[string]secretCacheEntry
+	// now returns the current time and can be replaced in tests
+	now func() time.Time
+}
+
+func (sc *secretCache) get(secretName string) (map[string]string, bool) {
+	entry, ok := sc.entries[secretName]
+	if !ok || !sc.currentTime().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+func (sc *secretCache) set(secretName string, data map[string]string) {
+	if sc.entries == nil {
+		sc.entries = map[string]secretCacheEntry{}
+	}
+	sc.entries[secretName] = secretCacheEntry{data: data, expiresAt: sc.currentTime().Add(secretCacheTTL)}
+}
+
+func (sc *secretCache) invalidate(secretName string) {
+	delete(sc.entries, secretName)
+}
+
+func (sc *secretCache) currentTime() time.Time {
+	if sc.now != nil {
+		return sc.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,70 @@
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecretCache(t *testing.T) {
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	sc := &secretCache{now: func() time.Time { return now }}
+
+	if _, ok := sc.get("dynatrace"); ok {
+		t.Errorf("get() found a secret in an empty cache")
+	}
+
+	sc.set("dynatrace", map[string]string{"DT_API_TOKEN": "my-token"})
+	if data, ok := sc.get("dynatrace"); !ok || data["DT_API_TOKEN"] != "my-token" {
+		t.Errorf("get() = %v, %v, want the cached secret", data, ok)
+	}
+
+	now = now.Add(secretCacheTTL)
+	if _, ok := sc.get("dynatrace"); ok {
+		t.Errorf("get() found the secret after the secretCacheTTL")
+	}
+
+	sc.set("dynatrace", map[string]string{"DT_API_TOKEN": "rotated-token"})
+	sc.invalidate("dynatrace")
+	if _, ok := sc.get("dynatrace"); ok {
+		t.Errorf("get() found the secret after it has been invalidated")
+	}
+}
+
+func TestFallbackSecretReader_InvalidateSecret(t *testing.T) {
+	asr := &AWSSecretsManagerReader{}
+	asr.secrets.set("dynatrace", map[string]string{"DT_API_TOKEN": "my-token"})
+
+	fsr := &fallbackSecretReader{secretReaders: []SecretReader{&FileSecretReader{Path: t.TempDir()}, asr}}
+	fsr.InvalidateSecret("dynatrace")
+
+	if _, ok := asr.secrets.get("dynatrace"); ok {
+		t.Errorf("InvalidateSecret() did not invalidate the secret of the AWSSecretsManagerReader")
+	}
+}
+
+func TestK8sCredentialReader_CachesSecret(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(createDynatraceDTSecret("dynatrace", namespace, "https://mySampleEnv.live.dynatrace.com", "abc123"))
+	kcr, err := NewK8sCredentialReader(k8sClient)
+	if err != nil {
+		t.Fatalf("NewK8sCredentialReader() error = %v", err)
+	}
+
+	for _, secretKey := range []string{"DT_TENANT", "DT_API_TOKEN", "DT_TENANT"} {
+		if _, err := kcr.ReadSecret("dynatrace", namespace, secretKey); err != nil {
+			t.Fatalf("ReadSecret() error = %v", err)
+		}
+	}
+	if reads := len(k8sClient.Actions()); reads != 1 {
+		t.Errorf("ReadSecret() read the secret %d times, want 1 for all its keys", reads)
+	}
+
+	kcr.InvalidateSecret("dynatrace")
+	if _, err := kcr.ReadSecret("dynatrace", namespace, "DT_API_TOKEN"); err != nil {
+		t.Fatalf("ReadSecret() error = %v", err)
+	}
+	if reads := len(k8sClient.Actions()); reads != 2 {
+		t.Errorf("ReadSecret() read the secret %d times, want 2 after it has been invalidated", reads)
+	}
+}
@@ -0,0 +1,236 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const secretBackendVault = "vault"
+
+// secretBackendTimeout is the time to wait for a response of a secret backend, so that an outage doesn't block the processing of events
+const secretBackendTimeout = 10 * time.Second
+
+// defaultServiceAccountTokenPath is the path of the token of the service account of the pod, used to log in at the Vault kubernetes auth method
+const defaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultSecretReader reads secrets from a kv v2 secrets engine of HashiCorp Vault, e.g: the key DT_API_TOKEN of the secret dynatrace is read from <kvMount>/data/<pathPrefix>/dynatrace
+type VaultSecretReader struct {
+	Address    string
+	KVMount    string
+	PathPrefix string
+	// Role is the role of the kubernetes auth method used to log in - it is not used if a Token is set
+	Role     string
+	AuthPath string
+	// JWTPath is the path of the service account token that is sent to Vault to log in
+	JWTPath string
+	// Token is the Vault token used to read the secrets, it is replaced when the login with the Role is renewed
+	Token      string
+	HTTPClient *http.Client
+
+	mutex sync.Mutex
+	// loggedIn is set if the Token has been created by a login with the Role, so that it is revoked when it is replaced by a new login
+	loggedIn bool
+	secrets  secretCache
+}
+
+// NewVaultSecretReaderFromEnv creates a VaultSecretReader configured by the VAULT_* environment variables
+func NewVaultSecretReaderFromEnv() (*VaultSecretReader, error) {
+	address := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if address == "" {
+		return nil, fmt.Errorf("could not initialize VaultSecretReader: VAULT_ADDR is not set")
+	}
+
+	vsr := &VaultSecretReader{
+		Address:    address,
+		KVMount:    getEnvWithDefault("VAULT_KV_MOUNT", "secret"),
+		PathPrefix: strings.Trim(getEnvWithDefault("VAULT_SECRET_PATH", "keptn"), "/"),
+		Role:       os.Getenv("VAULT_ROLE"),
+		AuthPath:   getEnvWithDefault("VAULT_AUTH_PATH", "kubernetes"),
+		JWTPath:    getEnvWithDefault("VAULT_JWT_PATH", defaultServiceAccountTokenPath),
+		Token:      os.Getenv("VAULT_TOKEN"),
+		HTTPClient: &http.Client{Timeout: secretBackendTimeout},
+	}
+	if vsr.Token == "" && vsr.Role == "" {
+		return nil, fmt.Errorf("could not initialize VaultSecretReader: either VAULT_ROLE or VAULT_TOKEN has to be set")
+	}
+	return vsr, nil
+}
+
+// ReadSecret reads the key of the secret from Vault - the namespace is ignored as the secrets of all namespaces are stored below the same path
+func (vsr *VaultSecretReader) ReadSecret(secretName, namespace, secretKey string) (string, error) {
+	data, err := vsr.ReadSecretData(secretName, namespace)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[secretKey]
+	if !ok || value == "" {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// ReadSecretData reads all keys of the latest version of the secret from Vault - they are cached for the secretCacheTTL, so that a secret is read once for all its keys
+func (vsr *VaultSecretReader) ReadSecretData(secretName, namespace string) (map[string]string, error) {
+	vsr.mutex.Lock()
+	data, ok := vsr.secrets.get(secretName)
+	vsr.mutex.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	secretData, err := vsr.readSecretData(secretName)
+	if err != nil {
+		return nil, err
+	}
+	data = make(map[string]string, len(secretData))
+	for key, value := range secretData {
+		if stringValue, ok := value.(string); ok {
+			data[key] = stringValue
+		}
+	}
+
+	vsr.mutex.Lock()
+	vsr.secrets.set(secretName, data)
+	vsr.mutex.Unlock()
+	return data, nil
+}
+
+// InvalidateSecret removes the secret from the cache, so that e.g. a rotated API token is read again from Vault
+func (vsr *VaultSecretReader) InvalidateSecret(secretName string) {
+	vsr.mutex.Lock()
+	defer vsr.mutex.Unlock()
+	vsr.secrets.invalidate(secretName)
+}
+
+// readSecretData returns the data of the latest version of the secret - if the token has expired, it logs in again and retries once
+func (vsr *VaultSecretReader) readSecretData(secretName string) (map[string]interface{}, error) {
+	token, err := vsr.getToken(false)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode, body, err := vsr.sendRequest(http.MethodGet, vsr.secretURL(secretName), token, nil)
+	if err == nil && statusCode == http.StatusForbidden && vsr.Role != "" {
+		if token, err = vsr.getToken(true); err != nil {
+			return nil, err
+		}
+		statusCode, body, err = vsr.sendRequest(http.MethodGet, vsr.secretURL(secretName), token, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret %s from Vault: %v", secretName, err)
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, ErrSecretNotFound
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not read secret %s from Vault: received status code %d", secretName, statusCode)
+	}
+
+	secret := &struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, secret); err != nil {
+		return nil, fmt.Errorf("could not parse secret %s from Vault: %v", secretName, err)
+	}
+	return secret.Data.Data, nil
+}
+
+func (vsr *VaultSecretReader) secretURL(secretName string) string {
+	path := secretName
+	if vsr.PathPrefix != "" {
+		path = vsr.PathPrefix + "/" + secretName
+	}
+	return vsr.Address + "/v1/" + vsr.KVMount + "/data/" + path
+}
+
+// getToken returns the cached Vault token or logs in with the role of the kubernetes auth method if there is none or a new one is forced.
+// The token of a previous login is revoked, so that only the lease of the current token remains
+func (vsr *VaultSecretReader) getToken(forceLogin bool) (string, error) {
+	vsr.mutex.Lock()
+	defer vsr.mutex.Unlock()
+
+	if vsr.Token != "" && !forceLogin {
+		return vsr.Token, nil
+	}
+
+	jwt, err := ioutil.ReadFile(vsr.JWTPath)
+	if err != nil {
+		return "", fmt.Errorf("could not read service account token for Vault login: %v", err)
+	}
+	payload, err := json.Marshal(map[string]string{"role": vsr.Role, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return "", err
+	}
+
+	statusCode, body, err := vsr.sendRequest(http.MethodPost, vsr.Address+"/v1/auth/"+vsr.AuthPath+"/login", "", payload)
+	if err != nil {
+		return "", fmt.Errorf("could not log in at Vault: %v", err)
+	}
+	if statusCode != http.StatusOK {
+		return "", fmt.Errorf("could not log in at Vault with role %s: received status code %d", vsr.Role, statusCode)
+	}
+
+	login := &struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}{}
+	if err := json.Unmarshal(body, login); err != nil || login.Auth.ClientToken == "" {
+		return "", fmt.Errorf("could not log in at Vault with role %s: no client token received", vsr.Role)
+	}
+	if vsr.loggedIn && vsr.Token != "" {
+		vsr.revokeToken(vsr.Token)
+	}
+	vsr.Token = login.Auth.ClientToken
+	vsr.loggedIn = true
+	return vsr.Token, nil
+}
+
+// revokeToken revokes the token of a previous login - it may have expired already, so a failure is only logged
+func (vsr *VaultSecretReader) revokeToken(token string) {
+	statusCode, _, err := vsr.sendRequest(http.MethodPost, vsr.Address+"/v1/auth/token/revoke-self", token, nil)
+	if err != nil || (statusCode != http.StatusOK && statusCode != http.StatusNoContent) {
+		log.WithError(err).WithField("statusCode", statusCode).Debug("Could not revoke the previous Vault token")
+	}
+}
+
+func (vsr *VaultSecretReader) sendRequest(method string, url string, token string, payload []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := vsr.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+func getEnvWithDefault(env string, defaultValue string) string {
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,157 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVaultSecretReader_ReadSecret(t *testing.T) {
+	validToken := "client-token"
+	logins := 0
+	vaultMockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			logins++
+			w.Write([]byte(`{"auth": {"client_token": "` + validToken + `"}}`))
+		case "/v1/secret/data/keptn/dynatrace":
+			if r.Header.Get("X-Vault-Token") != validToken {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"data": {"data": {"DT_TENANT": "my-tenant.live.dynatrace.com", "DT_API_TOKEN": "my-token"}, "metadata": {"version": 2}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vaultMockServer.Close()
+
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(jwtPath, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULT_ADDR", vaultMockServer.URL)
+	defer os.Unsetenv("VAULT_ADDR")
+	os.Setenv("VAULT_ROLE", "dynatrace-service")
+	defer os.Unsetenv("VAULT_ROLE")
+	os.Setenv("VAULT_JWT_PATH", jwtPath)
+	defer os.Unsetenv("VAULT_JWT_PATH")
+	os.Setenv("VAULT_TOKEN", "expired-token")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	vsr, err := NewVaultSecretReaderFromEnv()
+	if err != nil {
+		t.Fatalf("NewVaultSecretReaderFromEnv() error = %v", err)
+	}
+	cm, err := NewCredentialManager(vsr)
+	if err != nil {
+		t.Fatalf("NewCredentialManager() error = %v", err)
+	}
+
+	got, err := cm.GetDynatraceCredentials(nil)
+	if err != nil {
+		t.Fatalf("GetDynatraceCredentials() error = %v", err)
+	}
+	want := &DTCredentials{Tenant: "https://my-tenant.live.dynatrace.com", ApiToken: "my-token", SecretName: "dynatrace"}
+	if *got != *want {
+		t.Errorf("GetDynatraceCredentials() = %v, want %v", got, want)
+	}
+	if logins != 1 {
+		t.Errorf("GetDynatraceCredentials() logins = %d, want 1 after the token has expired", logins)
+	}
+
+	if _, err := vsr.ReadSecret("dynatrace", namespace, "KEPTN_API_URL"); err != ErrSecretNotFound {
+		t.Errorf("ReadSecret() error = %v, want %v for a missing key", err, ErrSecretNotFound)
+	}
+	if _, err := vsr.ReadSecret("other", namespace, "DT_TENANT"); err != ErrSecretNotFound {
+		t.Errorf("ReadSecret() error = %v, want %v for a missing secret", err, ErrSecretNotFound)
+	}
+}
+
+func TestNewVaultSecretReaderFromEnv(t *testing.T) {
+	os.Setenv("VAULT_ADDR", "https://vault:8200/")
+	defer os.Unsetenv("VAULT_ADDR")
+
+	if _, err := NewVaultSecretReaderFromEnv(); err == nil {
+		t.Errorf("NewVaultSecretReaderFromEnv() expected an error without VAULT_ROLE and VAULT_TOKEN")
+	}
+
+	os.Setenv("VAULT_ROLE", "dynatrace-service")
+	defer os.Unsetenv("VAULT_ROLE")
+
+	vsr, err := NewVaultSecretReaderFromEnv()
+	if err != nil {
+		t.Fatalf("NewVaultSecretReaderFromEnv() error = %v", err)
+	}
+	if got := vsr.secretURL("dynatrace"); got != "https://vault:8200/v1/secret/data/keptn/dynatrace" {
+		t.Errorf("secretURL() = %s, want https://vault:8200/v1/secret/data/keptn/dynatrace", got)
+	}
+}
+
+func TestVaultSecretReader_RevokesReplacedToken(t *testing.T) {
+	validToken := "client-token-1"
+	logins := 0
+	var revokedTokens []string
+	vaultMockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			logins++
+			w.Write([]byte(`{"auth": {"client_token": "` + validToken + `"}}`))
+		case "/v1/auth/token/revoke-self":
+			revokedTokens = append(revokedTokens, r.Header.Get("X-Vault-Token"))
+			w.WriteHeader(http.StatusNoContent)
+		case "/v1/secret/data/keptn/dynatrace":
+			if r.Header.Get("X-Vault-Token") != validToken {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"data": {"data": {"DT_TENANT": "my-tenant.live.dynatrace.com"}, "metadata": {"version": 1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vaultMockServer.Close()
+
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(jwtPath, []byte("service-account-jwt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("VAULT_ADDR", vaultMockServer.URL)
+	defer os.Unsetenv("VAULT_ADDR")
+	os.Setenv("VAULT_ROLE", "dynatrace-service")
+	defer os.Unsetenv("VAULT_ROLE")
+	os.Setenv("VAULT_JWT_PATH", jwtPath)
+	defer os.Unsetenv("VAULT_JWT_PATH")
+
+	vsr, err := NewVaultSecretReaderFromEnv()
+	if err != nil {
+		t.Fatalf("NewVaultSecretReaderFromEnv() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := vsr.ReadSecret("dynatrace", namespace, "DT_TENANT"); err != nil {
+			t.Fatalf("ReadSecret() error = %v", err)
+		}
+	}
+	if logins != 1 || len(revokedTokens) != 0 {
+		t.Errorf("ReadSecret() logins = %d, revoked tokens = %v, want the token of the first login to be reused", logins, revokedTokens)
+	}
+
+	// the cached secret is invalidated like after rejected credentials, so that it is read again with the expired token
+	validToken = "client-token-2"
+	vsr.InvalidateSecret("dynatrace")
+	if _, err := vsr.ReadSecret("dynatrace", namespace, "DT_TENANT"); err != nil {
+		t.Fatalf("ReadSecret() error = %v", err)
+	}
+	if logins != 2 {
+		t.Errorf("ReadSecret() logins = %d, want 2 after the token has been rejected", logins)
+	}
+	if len(revokedTokens) != 1 || revokedTokens[0] != "client-token-1" {
+		t.Errorf("ReadSecret() revoked tokens = %v, want [client-token-1]", revokedTokens)
+	}
+}
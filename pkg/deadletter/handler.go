@@ -0,0 +1,71 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+/**
+ * NewHandler returns the handler of the dead letter endpoints:
+ * GET /dead-letters lists the failed events,
+ * POST /dead-letters/<event ID>/retry triggers the processing of the event again by passing it to retry,
+ * DELETE /dead-letters/<event ID> discards the event
+ */
+func NewHandler(s *Store, retry func(event cloudevents.Event) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/dead-letters"), "/")
+
+		switch {
+		case path == "" && r.Method == http.MethodGet:
+			entries, err := s.List()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(entries)
+
+		case strings.HasSuffix(path, "/retry") && r.Method == http.MethodPost:
+			eventID := strings.TrimSuffix(path, "/retry")
+			event, err := s.GetEvent(eventID)
+			if err != nil {
+				writeLookupError(w, err)
+				return
+			}
+			if err := retry(*event); err != nil {
+				writeError(w, http.StatusServiceUnavailable, err)
+				return
+			}
+			log.WithField("eventId", eventID).Info("Triggered dead letter again")
+			w.WriteHeader(http.StatusAccepted)
+
+		case path != "" && !strings.Contains(path, "/") && r.Method == http.MethodDelete:
+			if err := s.Remove(path); err != nil {
+				writeLookupError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func writeLookupError(w http.ResponseWriter, err error) {
+	if err == ErrNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
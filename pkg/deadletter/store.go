@@ -0,0 +1,273 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+)
+
+const defaultConfigMapName = "dynatrace-service-dead-letters"
+
+// defaultMaxEntries keeps the ConfigMap well below its size limit of 1MB
+const defaultMaxEntries = 50
+
+// ErrNotFound is returned if there is no dead letter for an event ID
+var ErrNotFound = errors.New("dead letter not found")
+
+// invalidKeyChars matches all characters that aren't allowed in the keys of a ConfigMap
+var invalidKeyChars = regexp.MustCompile("[^-._a-zA-Z0-9]")
+
+// Entry is an event that failed to be processed
+type Entry struct {
+	EventID      string          `json:"eventId"`
+	EventType    string          `json:"eventType"`
+	KeptnContext string          `json:"keptnContext,omitempty"`
+	Reason       string          `json:"reason"`
+	FailedAt     time.Time       `json:"failedAt"`
+	Attempts     int             `json:"attempts"`
+	Event        json.RawMessage `json:"event"`
+}
+
+/**
+ * Store keeps the events that failed to be processed, so that they can be triggered again once the cause is fixed.
+ * The entries are persisted in a ConfigMap if a Kubernetes client is set, otherwise they are lost on restart.
+ * If there are more than MaxEntries, the entries that failed first are dropped
+ */
+type Store struct {
+	K8sClient     kubernetes.Interface
+	Namespace     string
+	ConfigMapName string
+	MaxEntries    int
+
+	mutex   sync.Mutex
+	entries map[string]*Entry
+	// configMapExists and resourceVersion describe the ConfigMap the entries were loaded from, so that changes of other replicas in the meantime aren't overwritten
+	configMapExists bool
+	resourceVersion string
+}
+
+// NewStoreFromEnv creates a Store that persists its entries in the ConfigMap dynatrace-service-dead-letters of the namespace of the dynatrace-service, which the RBAC of the chart grants access to
+func NewStoreFromEnv() (*Store, error) {
+	k8sClient, err := common.GetKubernetesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create Kubernetes client for the dead letters: %v", err)
+	}
+
+	store := &Store{
+		Namespace:     os.Getenv("POD_NAMESPACE"),
+		ConfigMapName: defaultConfigMapName,
+		MaxEntries:    defaultMaxEntries,
+	}
+	// the Kubernetes client is nil when running locally
+	if k8sClient != nil {
+		store.K8sClient = k8sClient
+	}
+	if value := os.Getenv("DEAD_LETTER_MAX_ENTRIES"); value != "" {
+		maxEntries, err := strconv.Atoi(value)
+		if err != nil || maxEntries < 1 {
+			return nil, fmt.Errorf("invalid DEAD_LETTER_MAX_ENTRIES %s: has to be a positive number", value)
+		}
+		store.MaxEntries = maxEntries
+	}
+	return store, nil
+}
+
+// Add stores the failed event - if it failed before, e.g. after it was triggered again, the attempts are counted up
+func (s *Store) Add(event cloudevents.Event, reason error) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("could not serialize event %s: %v", event.ID(), err)
+	}
+
+	var keptnContext string
+	event.Context.ExtensionAs("shkeptncontext", &keptnContext)
+
+	return s.update(func() error {
+		entry := &Entry{
+			EventID:      event.ID(),
+			EventType:    event.Type(),
+			KeptnContext: keptnContext,
+			Reason:       reason.Error(),
+			FailedAt:     time.Now().UTC(),
+			Attempts:     1,
+			Event:        eventJSON,
+		}
+		if previous, ok := s.entries[event.ID()]; ok {
+			entry.Attempts = previous.Attempts + 1
+		}
+		s.entries[event.ID()] = entry
+
+		for len(s.entries) > s.MaxEntries {
+			delete(s.entries, s.oldestEntry().EventID)
+		}
+		return nil
+	})
+}
+
+// List returns all entries, the one that failed last first
+func (s *Store) List() ([]*Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FailedAt.After(entries[j].FailedAt)
+	})
+	return entries, nil
+}
+
+// GetEvent returns the failed event with the ID or ErrNotFound
+func (s *Store) GetEvent(eventID string) (*cloudevents.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	entry, ok := s.entries[eventID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	event := cloudevents.NewEvent()
+	if err := json.Unmarshal(entry.Event, &event); err != nil {
+		return nil, fmt.Errorf("could not parse event %s: %v", eventID, err)
+	}
+	return &event, nil
+}
+
+// Remove deletes the entry of the event, e.g. after it was processed successfully
+func (s *Store) Remove(eventID string) error {
+	return s.update(func() error {
+		if _, ok := s.entries[eventID]; !ok {
+			return ErrNotFound
+		}
+		delete(s.entries, eventID)
+		return nil
+	})
+}
+
+/**
+ * update loads the entries, applies the change and saves them. If another replica changed the ConfigMap in the meantime,
+ * the save fails with a conflict and the change is applied again to the entries of the other replica
+ */
+func (s *Store) update(change func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return retry.OnError(retry.DefaultRetry, isConflict, func() error {
+		if err := s.load(); err != nil {
+			return err
+		}
+		if err := change(); err != nil {
+			return err
+		}
+		return s.save()
+	})
+}
+
+// isConflict returns whether the ConfigMap was updated or created by another replica since it was loaded
+func isConflict(err error) bool {
+	return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+}
+
+func (s *Store) oldestEntry() *Entry {
+	var oldest *Entry
+	for _, entry := range s.entries {
+		if oldest == nil || entry.FailedAt.Before(oldest.FailedAt) {
+			oldest = entry
+		}
+	}
+	return oldest
+}
+
+// load reads the entries from the ConfigMap, so that the entries of other replicas and from before a restart are included
+func (s *Store) load() error {
+	if s.K8sClient == nil {
+		if s.entries == nil {
+			s.entries = map[string]*Entry{}
+		}
+		return nil
+	}
+
+	configMap, err := s.K8sClient.CoreV1().ConfigMaps(s.Namespace).Get(context.TODO(), s.ConfigMapName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		s.entries = map[string]*Entry{}
+		s.configMapExists = false
+		s.resourceVersion = ""
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read dead letters from ConfigMap %s: %v", s.ConfigMapName, err)
+	}
+
+	s.entries = map[string]*Entry{}
+	s.configMapExists = true
+	s.resourceVersion = configMap.ResourceVersion
+	for key, value := range configMap.Data {
+		entry := &Entry{}
+		if err := json.Unmarshal([]byte(value), entry); err != nil {
+			return fmt.Errorf("could not parse dead letter %s of ConfigMap %s: %v", key, s.ConfigMapName, err)
+		}
+		s.entries[entry.EventID] = entry
+	}
+	return nil
+}
+
+// save writes the entries to the ConfigMap they were loaded from - a conflict is returned unwrapped, so that the update is retried
+func (s *Store) save() error {
+	if s.K8sClient == nil {
+		return nil
+	}
+
+	data := map[string]string{}
+	for _, entry := range s.entries {
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data[invalidKeyChars.ReplaceAllString(entry.EventID, "-")] = string(entryJSON)
+	}
+
+	// the update is rejected with a conflict if the ConfigMap has been changed since it was loaded
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: s.ConfigMapName, Namespace: s.Namespace, ResourceVersion: s.resourceVersion},
+		Data:       data,
+	}
+	configMaps := s.K8sClient.CoreV1().ConfigMaps(s.Namespace)
+	var err error
+	if !s.configMapExists {
+		_, err = configMaps.Create(context.TODO(), configMap, metav1.CreateOptions{})
+	} else {
+		_, err = configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	}
+	if isConflict(err) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("could not store dead letters in ConfigMap %s: %v", s.ConfigMapName, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStore_Add(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	store := &Store{K8sClient: k8sClient, Namespace: "keptn", ConfigMapName: defaultConfigMapName, MaxEntries: 2}
+
+	for _, eventID := range []string{"event-1", "event-2", "event-2", "event-3"} {
+		if err := store.Add(newEvent(eventID), errors.New("invalid dashboard")); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	// a new Store reads the entries from the ConfigMap, e.g. after a restart
+	entries, err := (&Store{K8sClient: k8sClient, Namespace: "keptn", ConfigMapName: defaultConfigMapName, MaxEntries: 2}).List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].EventID != "event-3" || entries[1].EventID != "event-2" {
+		t.Fatalf("List() = %v, want event-3 and event-2 as event-1 is the oldest entry", entries)
+	}
+	if entries[1].Attempts != 2 || entries[1].Reason != "invalid dashboard" || entries[1].KeptnContext != "my-keptn-context" {
+		t.Errorf("List() entry = %v, want 2 attempts with the reason and keptnContext", entries[1])
+	}
+
+	event, err := store.GetEvent("event-2")
+	if err != nil {
+		t.Fatalf("GetEvent() error = %v", err)
+	}
+	if event.Type() != "sh.keptn.event.configure-monitoring.triggered" {
+		t.Errorf("GetEvent() type = %s, want sh.keptn.event.configure-monitoring.triggered", event.Type())
+	}
+
+	if err := store.Remove("event-2"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := store.Remove("event-2"); err != ErrNotFound {
+		t.Errorf("Remove() error = %v, want %v", err, ErrNotFound)
+	}
+	configMap, err := k8sClient.CoreV1().ConfigMaps("keptn").Get(context.TODO(), defaultConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("could not get ConfigMap: %v", err)
+	}
+	if len(configMap.Data) != 1 {
+		t.Errorf("ConfigMap data = %v, want only event-3", configMap.Data)
+	}
+}
+
+func TestStore_Add_Conflict(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	store := &Store{K8sClient: k8sClient, Namespace: "keptn", ConfigMapName: defaultConfigMapName, MaxEntries: defaultMaxEntries}
+	if err := store.Add(newEvent("event-1"), errors.New("invalid dashboard")); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// another replica stores event-2 after the ConfigMap has been loaded, so the first update is rejected with a conflict
+	conflicts := 0
+	k8sClient.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		otherReplica := &Store{K8sClient: fake.NewSimpleClientset(), Namespace: "keptn", ConfigMapName: defaultConfigMapName, MaxEntries: defaultMaxEntries}
+		otherReplica.Add(newEvent("event-2"), errors.New("invalid dashboard"))
+		configMap, _ := otherReplica.K8sClient.CoreV1().ConfigMaps("keptn").Get(context.TODO(), defaultConfigMapName, metav1.GetOptions{})
+		existing, _ := k8sClient.Tracker().Get(corev1.SchemeGroupVersion.WithResource("configmaps"), "keptn", defaultConfigMapName)
+		existingConfigMap := existing.(*corev1.ConfigMap)
+		for key, value := range configMap.Data {
+			existingConfigMap.Data[key] = value
+		}
+		k8sClient.Tracker().Update(corev1.SchemeGroupVersion.WithResource("configmaps"), existingConfigMap, "keptn")
+		return true, nil, k8serrors.NewConflict(corev1.Resource("configmaps"), defaultConfigMapName, errors.New("the object has been modified"))
+	})
+
+	if err := store.Add(newEvent("event-3"), errors.New("invalid dashboard")); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if conflicts != 1 || len(entries) != 3 {
+		t.Errorf("List() = %v after %d conflicts, want the entries of both replicas", entries, conflicts)
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	store := &Store{MaxEntries: defaultMaxEntries}
+	store.Add(newEvent("event-1"), errors.New("invalid dashboard"))
+
+	var retried []string
+	handler := NewHandler(store, func(event cloudevents.Event) error {
+		retried = append(retried, event.ID())
+		return nil
+	})
+
+	tests := []struct {
+		method         string
+		path           string
+		wantStatusCode int
+	}{
+		{method: http.MethodGet, path: "/dead-letters", wantStatusCode: http.StatusOK},
+		{method: http.MethodPost, path: "/dead-letters/event-1/retry", wantStatusCode: http.StatusAccepted},
+		{method: http.MethodPost, path: "/dead-letters/unknown/retry", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/dead-letters/event-1", wantStatusCode: http.StatusNoContent},
+		{method: http.MethodDelete, path: "/dead-letters/event-1", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodPut, path: "/dead-letters", wantStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+		if recorder.Code != tt.wantStatusCode {
+			t.Errorf("%s %s status code = %d, want %d", tt.method, tt.path, recorder.Code, tt.wantStatusCode)
+		}
+	}
+	if len(retried) != 1 || retried[0] != "event-1" {
+		t.Errorf("retried events = %v, want event-1", retried)
+	}
+}
+
+func newEvent(eventID string) cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID(eventID)
+	event.SetType("sh.keptn.event.configure-monitoring.triggered")
+	event.SetSource("shipyard-controller")
+	event.SetExtension("shkeptncontext", "my-keptn-context")
+	event.SetData(cloudevents.ApplicationJSON, map[string]string{"project": "sockshop"})
+	return event
+}
@@ -0,0 +1,68 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+ * Cache remembers the IDs of the events a handler has processed for TTL, so that an event the distributor delivers again is skipped.
+ * The IDs are kept per handler, i.e. per event type, so that only an event delivered again to the same handler is skipped
+ */
+type Cache struct {
+	TTL time.Duration
+
+	mutex     sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewCache creates a Cache that remembers event IDs for the ttl
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{TTL: ttl, seen: map[string]time.Time{}, now: time.Now}
+}
+
+// Seen returns true if the handler has already seen the event within the TTL, otherwise it remembers the event and returns false
+func (c *Cache) Seen(handler string, eventID string) bool {
+	if c == nil || c.TTL <= 0 || eventID == "" {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	c.prune(now)
+
+	key := handler + "/" + eventID
+	if seenAt, ok := c.seen[key]; ok && now.Sub(seenAt) < c.TTL {
+		return true
+	}
+	c.seen[key] = now
+	return false
+}
+
+// Forget removes the event so that it is processed again if it is delivered again, e.g. because it was rejected
+func (c *Cache) Forget(handler string, eventID string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.seen, handler+"/"+eventID)
+}
+
+// prune removes the expired event IDs at most once per TTL, so that the cache doesn't grow with every event
+func (c *Cache) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < c.TTL {
+		return
+	}
+	for key, seenAt := range c.seen {
+		if now.Sub(seenAt) >= c.TTL {
+			delete(c.seen, key)
+		}
+	}
+	c.lastPrune = now
+}
@@ -0,0 +1,40 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_Seen(t *testing.T) {
+	now := time.Date(2021, 10, 14, 8, 0, 0, 0, time.UTC)
+	cache := NewCache(10 * time.Minute)
+	cache.now = func() time.Time { return now }
+
+	if cache.Seen("sh.keptn.event.problem.open", "event-1") {
+		t.Errorf("Seen() = true, want false for a new event")
+	}
+	if !cache.Seen("sh.keptn.event.problem.open", "event-1") {
+		t.Errorf("Seen() = false, want true for a duplicate event")
+	}
+	if cache.Seen("sh.keptn.event.get-sli.triggered", "event-1") {
+		t.Errorf("Seen() = true, want false for the same event ID of another handler")
+	}
+
+	cache.Forget("sh.keptn.event.problem.open", "event-1")
+	if cache.Seen("sh.keptn.event.problem.open", "event-1") {
+		t.Errorf("Seen() = true, want false for a forgotten event")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if cache.Seen("sh.keptn.event.problem.open", "event-1") {
+		t.Errorf("Seen() = true, want false after the TTL has expired")
+	}
+	if len(cache.seen) != 1 {
+		t.Errorf("len(seen) = %d, want 1 as the expired events have been pruned", len(cache.seen))
+	}
+
+	var disabled *Cache
+	if disabled.Seen("sh.keptn.event.problem.open", "event-1") || disabled.Seen("sh.keptn.event.problem.open", "event-1") {
+		t.Errorf("Seen() = true, want false if deduplication is disabled")
+	}
+}
@@ -1,6 +1,7 @@
 package event_handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -10,14 +11,15 @@ import (
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
 	keptncommon "github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 )
 
 type ActionHandler struct {
+	ctx            context.Context
 	Event          cloudevents.Event
 	dtConfigGetter adapter.DynatraceConfigGetterInterface
 }
@@ -26,14 +28,15 @@ type ActionHandler struct {
  * Retrieves Dynatrace Credential information
  */
 func (eh ActionHandler) GetDynatraceCredentials(keptnEvent adapter.EventContentAdapter) (*config.DynatraceConfigFile, *credentials.DTCredentials, error) {
+	logger := logging.FromContext(eh.ctx)
 	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
 	if err != nil {
-		log.WithError(err).Error("Failed to load Dynatrace config")
+		logger.WithError(err).Error("Failed to load Dynatrace config")
 		return nil, nil, err
 	}
-	creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
+	creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
 	if err != nil {
-		log.WithError(err).Error("Failed to load Dynatrace credentials")
+		logger.WithError(err).Error("Failed to load Dynatrace credentials")
 		return nil, nil, err
 	}
 
@@ -41,10 +44,11 @@ func (eh ActionHandler) GetDynatraceCredentials(keptnEvent adapter.EventContentA
 }
 
 func (eh ActionHandler) HandleEvent() error {
+	logger := logging.FromContext(eh.ctx)
 
 	keptnHandler, err := keptnv2.NewKeptn(&eh.Event, keptncommon.KeptnOpts{})
 	if err != nil {
-		log.WithError(err).Error("Could not initialize Keptn handler")
+		logger.WithError(err).Error("Could not initialize Keptn handler")
 		return err
 	}
 
@@ -55,44 +59,48 @@ func (eh ActionHandler) HandleEvent() error {
 
 		err = eh.Event.DataAs(actionTriggeredData)
 		if err != nil {
-			log.WithError(err).Error("Cannot parse incoming event")
+			logger.WithError(err).Error("Cannot parse incoming event")
 			return err
 		}
 
 		keptnEvent := adapter.NewActionTriggeredAdapter(*actionTriggeredData, keptnHandler.KeptnContext, eh.Event.Source())
 
+		// the attachRules are checked before a Dynatrace action is executed, so that a warning can be added to its action.finished event
+		dynatraceConfig, creds, credsErr := eh.GetDynatraceCredentials(keptnEvent)
+		var dtHelper *lib.DynatraceHelper
+		attachRulesWarning := ""
+		if credsErr == nil {
+			dtHelper = lib.NewDynatraceHelper(keptnHandler, creds)
+			dtHelper.EventContext = eh.ctx
+			if attachRulesWarning, err = prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+				logger.WithError(err).Error("Failed to check attachRules")
+			}
+		}
+
+		if isDynatraceAction(actionTriggeredData.Action.Action) {
+			if err := eh.executeDynatraceAction(actionTriggeredData, keptnEvent, attachRulesWarning); err != nil {
+				logger.WithError(err).Error("Could not send action.finished event")
+			}
+		}
+
 		pid, err := common.FindProblemIDForEvent(keptnHandler, keptnEvent.GetLabels())
 		if err != nil {
-			log.WithError(err).Error("Could not find problem ID for event")
+			logger.WithError(err).Error("Could not find problem ID for event")
 			return err
 		}
 
 		if pid == "" {
-			log.Error("Cannot send DT problem comment: No problem ID is included in the event.")
+			logger.Error("Cannot send DT problem comment: No problem ID is included in the event.")
 			return errors.New("cannot send DT problem comment: No problem ID is included in the event")
 		}
 
-		comment = "Keptn triggered action " + actionTriggeredData.Action.Action
-		if actionTriggeredData.Action.Description != "" {
-			comment = comment + ": " + actionTriggeredData.Action.Description
+		if credsErr != nil {
+			return credsErr
 		}
 
-		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
-		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace config")
-			return err
-		}
-
-		creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
-		if err != nil {
-			log.WithError(err).Error("failed to load Dynatrace credentials")
-			return err
-		}
-		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
-
 		// https://github.com/keptn-contrib/dynatrace-service/issues/174
 		// Additionall to the problem comment, send Info and Configuration Change Event to the entities in Dynatrace to indicate that remediation actions have been executed
-		dtInfoEvent := createInfoEvent(keptnEvent, dynatraceConfig)
+		dtInfoEvent := createInfoEvent(eh.ctx, keptnEvent, dynatraceConfig)
 		dtInfoEvent.Title = "Keptn Remediation Action Triggered"
 		dtInfoEvent.Description = actionTriggeredData.Action.Action
 		dtHelper.SendEvent(dtInfoEvent)
@@ -102,6 +110,13 @@ func (eh ActionHandler) HandleEvent() error {
 		if actionTriggeredData.Action.Description != "" {
 			comment = comment + ": " + actionTriggeredData.Action.Description
 		}
+		comment = renderProblemComment(eh.ctx, getProblemComments(dynatraceConfig).ActionTriggered, problemCommentData{
+			Event:   actionTriggeredData,
+			Labels:  keptnEvent.GetLabels(),
+			Bridge:  keptnEvent.GetLabels()[common.KEPTNSBRIDGE_LABEL],
+			Source:  eh.Event.Source(),
+			Comment: comment,
+		})
 
 		err = dtHelper.SendProblemComment(pid, comment)
 	} else if eh.Event.Type() == keptnv2.GetStartedEventType(keptnv2.ActionTaskName) {
@@ -109,7 +124,7 @@ func (eh ActionHandler) HandleEvent() error {
 
 		err = eh.Event.DataAs(actionStartedData)
 		if err != nil {
-			log.WithError(err).Error("Cannot parse incoming Event")
+			logger.WithError(err).Error("Cannot parse incoming Event")
 			return err
 		}
 
@@ -117,22 +132,29 @@ func (eh ActionHandler) HandleEvent() error {
 
 		pid, err := common.FindProblemIDForEvent(keptnHandler, keptnEvent.GetLabels())
 		if err != nil {
-			log.WithError(err).Error("Could not find problem ID for event")
+			logger.WithError(err).Error("Could not find problem ID for event")
 			return err
 		}
 
 		// lets get our dynatrace credentials - if we have none - no need to continue
-		/*dynatraceConfig*/
-		_, creds, err := eh.GetDynatraceCredentials(keptnEvent)
+		dynatraceConfig, creds, err := eh.GetDynatraceCredentials(keptnEvent)
 		if err != nil {
 			return err
 		}
 
 		// Create our DTHelper
 		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
 
 		// Comment we push over
 		comment = fmt.Sprintf("[Keptn remediation action](%s) started execution by: %s", keptnEvent.GetLabels()[common.KEPTNSBRIDGE_LABEL], eh.Event.Source())
+		comment = renderProblemComment(eh.ctx, getProblemComments(dynatraceConfig).ActionStarted, problemCommentData{
+			Event:   actionStartedData,
+			Labels:  keptnEvent.GetLabels(),
+			Bridge:  keptnEvent.GetLabels()[common.KEPTNSBRIDGE_LABEL],
+			Source:  eh.Event.Source(),
+			Comment: comment,
+		})
 
 		// this is posting the Event on the problem as a comment
 		err = dtHelper.SendProblemComment(pid, comment)
@@ -141,7 +163,7 @@ func (eh ActionHandler) HandleEvent() error {
 
 		err = eh.Event.DataAs(actionFinishedData)
 		if err != nil {
-			log.WithError(err).Error("Cannot parse incoming Event")
+			logger.WithError(err).Error("Cannot parse incoming Event")
 			return err
 		}
 
@@ -150,17 +172,21 @@ func (eh ActionHandler) HandleEvent() error {
 		// lets get our dynatrace credentials - if we have none - no need to continue
 		dynatraceConfig, creds, err := eh.GetDynatraceCredentials(keptnEvent)
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace config")
+			logger.WithError(err).Error("Failed to load Dynatrace config")
 			return err
 		}
 
 		// lets find our dynatrace problem details for this remediaiton workflow
 		pid, err := common.FindProblemIDForEvent(keptnHandler, keptnEvent.GetLabels())
 		if err != nil {
-			log.WithError(err).Error("Could not find problem ID for event")
+			logger.WithError(err).Error("Could not find problem ID for event")
 			return err
 		}
 		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
 
 		// Comment text we want to push over
 		comment = fmt.Sprintf("[Keptn finished execution](%s) of action by: %s\nResult: %s\nStatus: %s",
@@ -168,16 +194,23 @@ func (eh ActionHandler) HandleEvent() error {
 			eh.Event.Source(),
 			actionFinishedData.Result,
 			actionFinishedData.Status)
+		comment = renderProblemComment(eh.ctx, getProblemComments(dynatraceConfig).ActionFinished, problemCommentData{
+			Event:   actionFinishedData,
+			Labels:  keptnEvent.GetLabels(),
+			Bridge:  keptnEvent.GetLabels()[common.KEPTNSBRIDGE_LABEL],
+			Source:  eh.Event.Source(),
+			Comment: comment,
+		})
 
 		// https://github.com/keptn-contrib/dynatrace-service/issues/174
 		// Additionally to the problem comment, send Info and Configuration Change Event to the entities in Dynatrace to indicate that remediation actions have been executed
 		if actionFinishedData.Status == keptnv2.StatusSucceeded {
-			dtConfigEvent := createConfigurationEvent(keptnEvent, dynatraceConfig)
+			dtConfigEvent := createConfigurationEvent(eh.ctx, keptnEvent, dynatraceConfig)
 			dtConfigEvent.Description = "Keptn Remediation Action Finished"
 			dtConfigEvent.Configuration = "successful"
 			dtHelper.SendEvent(dtConfigEvent)
 		} else {
-			dtInfoEvent := createInfoEvent(keptnEvent, dynatraceConfig)
+			dtInfoEvent := createInfoEvent(eh.ctx, keptnEvent, dynatraceConfig)
 			dtInfoEvent.Title = "Keptn Remediation Action Finished"
 			dtInfoEvent.Description = "error during execution"
 			dtHelper.SendEvent(dtInfoEvent)
@@ -0,0 +1,33 @@
+package event_handler
+
+import (
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+)
+
+/**
+ * Creates the business event of a milestone of a Keptn sequence, e.g: a finished deployment or evaluation
+ * The fields shared by all milestones are set here, the milestones add their own, e.g: keptn.deployment.version or keptn.evaluation.score
+ * Labels of the Keptn event are added as keptn.label.<name>, except for the link to the Keptn bridge, which is added as keptn.bridge_url
+ */
+func createBizEvent(a adapter.EventContentAdapter, result keptnv2.ResultType) map[string]interface{} {
+	bizEvent := map[string]interface{}{
+		"event.type":    a.GetEvent(),
+		"keptn.context": a.GetShKeptnContext(),
+		"keptn.project": a.GetProject(),
+		"keptn.stage":   a.GetStage(),
+		"keptn.service": a.GetService(),
+		"keptn.result":  string(result),
+		"keptn.source":  a.GetSource(),
+	}
+	for key, value := range a.GetLabels() {
+		if key == common.KEPTNSBRIDGE_LABEL {
+			bizEvent["keptn.bridge_url"] = value
+			continue
+		}
+		bizEvent["keptn.label."+key] = value
+	}
+	return bizEvent
+}
@@ -1,12 +1,17 @@
 package event_handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/keptn/go-utils/pkg/api/models"
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
 	keptnevents "github.com/keptn/go-utils/pkg/lib"
 	keptncommon "github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
@@ -14,26 +19,33 @@ import (
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 )
 
 type CDEventHandler struct {
+	ctx            context.Context
 	Event          cloudevents.Event
 	dtConfigGetter adapter.DynatraceConfigGetterInterface
 }
 
 func (eh CDEventHandler) HandleEvent() error {
+	logger := logging.FromContext(eh.ctx)
 	var shkeptncontext string
 	_ = eh.Event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
 
 	keptnHandler, err := keptnv2.NewKeptn(&eh.Event, keptncommon.KeptnOpts{})
 	if err != nil {
-		log.WithError(err).Error("Could not create Keptn handler")
+		logger.WithError(err).Error("Could not create Keptn handler")
 	}
+
+	eh.commentRemediationProgress(keptnHandler, shkeptncontext)
+	eh.handleMaintenanceWindow(keptnHandler, shkeptncontext)
+
 	if eh.Event.Type() == keptnv2.GetFinishedEventType(keptnv2.DeploymentTaskName) {
 		dfData := &keptnv2.DeploymentFinishedEventData{}
 		err := eh.Event.DataAs(dfData)
 		if err != nil {
-			log.WithError(err).Error("Could not parse event payload")
+			logger.WithError(err).Error("Could not parse event payload")
 			return err
 		}
 
@@ -42,24 +54,52 @@ func (eh CDEventHandler) HandleEvent() error {
 
 		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace config")
+			logger.WithError(err).Error("Failed to load Dynatrace config")
 			return err
 		}
-		creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
+		creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
 		if err != nil {
-			log.WithError(err).Error("failed to load Dynatrace credentials")
+			logger.WithError(err).Error("failed to load Dynatrace credentials")
 			return err
 		}
 		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
 
 		// send Deployment Event
-		de := createDeploymentEvent(keptnEvent, dynatraceConfig)
+		de := createDeploymentEvent(eh.ctx, keptnEvent, dynatraceConfig)
+
+		// the deployed version is the image tag - if the image is not known we fall back to the git commit
+		if de.DeploymentVersion == "n/a" && keptnEvent.GetGitCommit() != "" {
+			de.DeploymentVersion = keptnEvent.GetGitCommit()
+		}
+
+		// configuration changes, e.g: replicaCount for scaling, are what Davis correlates with a changed behavior of the service
+		if configurationChange := formatConfigurationChange(keptnEvent.GetConfigurationChange()); configurationChange != "" {
+			de.CustomProperties["Configuration Change"] = configurationChange
+		}
+
+		// deployments triggered by a remediation link to the remediation sequence in the Keptn bridge
+		if de.RemediationAction == "" && keptnEvent.IsPartOfRemediation() {
+			de.RemediationAction = de.CustomProperties[common.KEPTNSBRIDGE_LABEL]
+		}
 		dtHelper.SendEvent(de)
+
+		if lib.IsBizEventsEnabled(eh.ctx) {
+			bizEvent := createBizEvent(keptnEvent, dfData.Result)
+			bizEvent["keptn.deployment.version"] = de.DeploymentVersion
+			bizEvent["keptn.deployment.image"] = keptnEvent.GetImage()
+			bizEvent["keptn.deployment.strategy"] = dfData.Deployment.DeploymentStrategy
+			bizEvent["keptn.remediation"] = keptnEvent.IsPartOfRemediation()
+			dtHelper.SendBizEvent(bizEvent)
+		}
 	} else if eh.Event.Type() == keptnv2.GetTriggeredEventType(keptnv2.TestTaskName) {
 		ttData := &keptnv2.TestTriggeredEventData{}
 		err := eh.Event.DataAs(ttData)
 		if err != nil {
-			log.WithError(err).Error("Could not parse event payload")
+			logger.WithError(err).Error("Could not parse event payload")
 			return err
 		}
 
@@ -68,18 +108,22 @@ func (eh CDEventHandler) HandleEvent() error {
 
 		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
 		if err != nil {
-			log.WithError(err).Error("failed to load Dynatrace config")
+			logger.WithError(err).Error("failed to load Dynatrace config")
 			return err
 		}
-		creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
+		creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
 		if err != nil {
-			log.WithError(err).Error("failed to load Dynatrace credentials")
+			logger.WithError(err).Error("failed to load Dynatrace credentials")
 			return err
 		}
 		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
 
 		// Send Annotation Event
-		ie := createAnnotationEvent(keptnEvent, dynatraceConfig)
+		ie := createAnnotationEvent(eh.ctx, keptnEvent, dynatraceConfig)
 		if ie.AnnotationType == "" {
 			ie.AnnotationType = "Start Tests: " + ttData.Test.TestStrategy
 		}
@@ -91,7 +135,7 @@ func (eh CDEventHandler) HandleEvent() error {
 		tfData := &keptnv2.TestFinishedEventData{}
 		err := eh.Event.DataAs(tfData)
 		if err != nil {
-			log.WithError(err).Error("Could not parse event payload")
+			logger.WithError(err).Error("Could not parse event payload")
 			return err
 		}
 
@@ -100,31 +144,58 @@ func (eh CDEventHandler) HandleEvent() error {
 
 		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace config")
+			logger.WithError(err).Error("Failed to load Dynatrace config")
 			return err
 		}
-		creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
+		creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace credentials")
+			logger.WithError(err).Error("Failed to load Dynatrace credentials")
 			return err
 		}
 		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
+
+		// the test.finished event doesn't contain the test strategy - so we take it from the labels or from the test.triggered event
+		testStrategy := getValueFromLabels(keptnEvent, "testStrategy", "")
+		if testStrategy == "" && keptnHandler != nil {
+			testStrategy, err = common.FindTestStrategyForEvent(keptnHandler, tfData.Stage)
+			if err != nil {
+				logger.WithError(err).Warn("Could not find test strategy for test.finished event")
+			}
+		}
 
 		// Send Annotation Event
-		ie := createAnnotationEvent(keptnEvent, dynatraceConfig)
+		ie := createAnnotationEvent(eh.ctx, keptnEvent, dynatraceConfig)
+		ie.CustomProperties["TestStrategy"] = testStrategy
+		ie.CustomProperties["Test Result"] = string(tfData.Result)
+		ie.CustomProperties["Test Start"] = tfData.Test.Start
+		ie.CustomProperties["Test End"] = tfData.Test.End
+
+		testDuration, err := getTestDuration(tfData.Test.Start, tfData.Test.End)
+		if err != nil {
+			logger.WithError(err).Warn("Could not calculate test duration")
+		} else {
+			ie.CustomProperties["Test Duration"] = testDuration.String()
+		}
 
 		if ie.AnnotationType == "" {
-			ie.AnnotationType = "Stop Tests"
+			ie.AnnotationType = "Stop Tests: " + testStrategy
 		}
 		if ie.AnnotationDescription == "" {
-			ie.AnnotationDescription = "Stop running tests: against " + tfData.Service
+			ie.AnnotationDescription = "Stop running tests: " + testStrategy + " against " + tfData.Service + " with result " + string(tfData.Result)
+			if err == nil {
+				ie.AnnotationDescription = ie.AnnotationDescription + " (duration " + testDuration.String() + ")"
+			}
 		}
 		dtHelper.SendEvent(ie)
 	} else if eh.Event.Type() == keptnv2.GetFinishedEventType(keptnv2.EvaluationTaskName) {
 		edData := &keptnv2.EvaluationFinishedEventData{}
 		err := eh.Event.DataAs(edData)
 		if err != nil {
-			log.WithError(err).Error("Error while parsing JSON payload")
+			logger.WithError(err).Error("Error while parsing JSON payload")
 			return err
 		}
 		// initialize our objects
@@ -132,21 +203,28 @@ func (eh CDEventHandler) HandleEvent() error {
 
 		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace config")
+			logger.WithError(err).Error("Failed to load Dynatrace config")
 			return err
 		}
-		creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
+		creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace credentials")
+			logger.WithError(err).Error("Failed to load Dynatrace credentials")
 			return err
 		}
 		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
 
 		// Send Info Event
-		ie := createInfoEvent(keptnEvent, dynatraceConfig)
+		ie := createInfoEvent(eh.ctx, keptnEvent, dynatraceConfig)
 		qualityGateDescription := fmt.Sprintf("Quality Gate Result in stage %s: %s (%.2f/100)", edData.Stage, edData.Result, edData.Evaluation.Score)
 		ie.Title = fmt.Sprintf("Evaluation result: %s", edData.Result)
 
+		// add the per-SLI breakdown so the Dynatrace event explains why a quality gate failed
+		scorecard, scorecardProperties := createEvaluationScorecard(edData.Evaluation.IndicatorResults)
+
 		if keptnEvent.IsPartOfRemediation() {
 			if edData.Result == keptnv2.ResultPass || edData.Result == keptnv2.ResultWarning {
 				ie.Title = "Remediation action successful"
@@ -155,43 +233,80 @@ func (eh CDEventHandler) HandleEvent() error {
 			}
 			// If evaluation was done in context of a problem remediation workflow then post comments to the Dynatrace Problem
 			pid, err := common.FindProblemIDForEvent(keptnHandler, keptnEvent.GetLabels())
-			if err == nil && pid != "" {
-				// Comment we push over
-				comment := fmt.Sprintf("[Keptn remediation evaluation](%s) resulted in %s (%.2f/100)", keptnEvent.GetLabels()[common.KEPTNSBRIDGE_LABEL], edData.Result, edData.Evaluation.Score)
+			if err != nil {
+				logger.WithError(err).Error("Could not find the Dynatrace problem of the remediation")
+			} else if pid != "" {
+				comment := renderProblemComment(eh.ctx, getProblemComments(dynatraceConfig).Evaluation, problemCommentData{
+					Event:   edData,
+					Labels:  keptnEvent.GetLabels(),
+					Bridge:  keptnEvent.GetLabels()[common.KEPTNSBRIDGE_LABEL],
+					Source:  eh.Event.Source(),
+					Comment: createRemediationEvaluationComment(edData, keptnEvent.GetLabels()[common.KEPTNSBRIDGE_LABEL], scorecard),
+				})
 
 				// this is posting the Event on the problem as a comment
-				err = dtHelper.SendProblemComment(pid, comment)
+				if err := dtHelper.SendProblemComment(pid, comment); err != nil {
+					logger.WithError(err).WithField("PID", pid).Error("Could not send remediation evaluation result as problem comment")
+				}
+
+				// the remediation was successful - so there is no need to wait until Davis closes the problem
+				if dynatraceConfig != nil && dynatraceConfig.CloseProblems && edData.Result == keptnv2.ResultPass {
+					eh.closeRemediatedProblem(dtHelper, keptnEvent, pid, comment)
+				}
 			}
 		}
+
+		for key, value := range scorecardProperties {
+			ie.CustomProperties[key] = value
+		}
+		if len(scorecard) > 0 {
+			qualityGateDescription = qualityGateDescription + "\n" + strings.Join(scorecard, "\n")
+		}
+		if bridgeURL := ie.CustomProperties[common.KEPTNSBRIDGE_LABEL]; bridgeURL != "" {
+			qualityGateDescription = qualityGateDescription + "\nDetails: " + bridgeURL
+		}
+
 		ie.Description = qualityGateDescription
 		dtHelper.SendEvent(ie)
+
+		if lib.IsBizEventsEnabled(eh.ctx) {
+			bizEvent := createBizEvent(keptnEvent, edData.Result)
+			bizEvent["keptn.evaluation.score"] = edData.Evaluation.Score
+			bizEvent["keptn.evaluation.result"] = edData.Evaluation.Result
+			bizEvent["keptn.remediation"] = keptnEvent.IsPartOfRemediation()
+			dtHelper.SendBizEvent(bizEvent)
+		}
 	} else if eh.Event.Type() == keptnv2.GetTriggeredEventType(keptnv2.ReleaseTaskName) {
 		rtData := &keptnv2.ReleaseTriggeredEventData{}
 		err := eh.Event.DataAs(rtData)
 		if err != nil {
-			log.WithError(err).Error("Error while parsing JSON payload")
+			logger.WithError(err).Error("Error while parsing JSON payload")
 			return err
 		}
 		keptnEvent := adapter.NewReleaseTriggeredAdapter(*rtData, shkeptncontext, eh.Event.Source())
 
 		strategy, err := keptnevents.GetDeploymentStrategy(rtData.Deployment.DeploymentStrategy)
 		if err != nil {
-			log.WithError(err).Error("Could not determine deployment strategy")
+			logger.WithError(err).Error("Could not determine deployment strategy")
 			return err
 		}
 		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace config")
+			logger.WithError(err).Error("Failed to load Dynatrace config")
 			return err
 		}
-		creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
+		creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
 		if err != nil {
-			log.WithError(err).Error("Failed to load Dynatrace credentials")
+			logger.WithError(err).Error("Failed to load Dynatrace credentials")
 			return err
 		}
 		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
 
-		ie := createInfoEvent(keptnEvent, dynatraceConfig)
+		ie := createInfoEvent(eh.ctx, keptnEvent, dynatraceConfig)
 		if strategy == keptnevents.Direct && rtData.Result == keptnv2.ResultPass || rtData.Result == keptnv2.ResultWarning {
 			title := fmt.Sprintf("PROMOTING from %s to next stage", rtData.Stage)
 			ie.Title = title
@@ -207,11 +322,164 @@ func (eh CDEventHandler) HandleEvent() error {
 				ie.Description = title
 			}
 		}
+		addReleaseVersionProperties(ie.CustomProperties, keptnEvent, rtData.Deployment.GitCommit)
 		dtHelper.SendEvent(ie)
 	} else if eh.Event.Type() == keptnv2.GetFinishedEventType(keptnv2.ReleaseTaskName) {
+		rfData := &keptnv2.ReleaseFinishedEventData{}
+		err := eh.Event.DataAs(rfData)
+		if err != nil {
+			logger.WithError(err).Error("Error while parsing JSON payload")
+			return err
+		}
+
+		// only successful releases are reported as new versions
+		if rfData.Result != keptnv2.ResultPass && rfData.Result != keptnv2.ResultWarning {
+			logger.WithField("result", rfData.Result).Info("Not sending release event for unsuccessful release")
+			return nil
+		}
+
+		keptnEvent := adapter.NewReleaseFinishedAdapter(*rfData, shkeptncontext, eh.Event.Source())
+
+		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
+		if err != nil {
+			logger.WithError(err).Error("Failed to load Dynatrace config")
+			return err
+		}
+		creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
+		if err != nil {
+			logger.WithError(err).Error("Failed to load Dynatrace credentials")
+			return err
+		}
+		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
+
+		// Send Deployment Event carrying the released version so that it shows up in the Dynatrace release inventory
+		de := createDeploymentEvent(eh.ctx, keptnEvent, dynatraceConfig)
+		if de.CustomProperties["deploymentName"] == "" {
+			de.DeploymentName = "Release " + rfData.Service + " " + keptnEvent.GetTag() + " in " + rfData.Stage
+		}
+		if de.DeploymentVersion == "" || de.DeploymentVersion == "n/a" {
+			de.DeploymentVersion = rfData.Release.GitCommit
+		}
+		addReleaseVersionProperties(de.CustomProperties, keptnEvent, rfData.Release.GitCommit)
+		dtHelper.SendEvent(de)
+	} else if eh.Event.Type() == keptnv2.GetFinishedEventType(keptnv2.RollbackTaskName) {
+		rbData := &keptnv2.RollbackFinishedEventData{}
+		err := eh.Event.DataAs(rbData)
+		if err != nil {
+			logger.WithError(err).Error("Error while parsing JSON payload")
+			return err
+		}
+
+		keptnEvent := adapter.NewRollbackFinishedAdapter(*rbData, shkeptncontext, eh.Event.Source())
+
+		dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
+		if err != nil {
+			logger.WithError(err).Error("Failed to load Dynatrace config")
+			return err
+		}
+		creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
+		if err != nil {
+			logger.WithError(err).Error("Failed to load Dynatrace credentials")
+			return err
+		}
+		dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+		dtHelper.EventContext = eh.ctx
+		if _, err := prepareAttachRules(dtHelper, keptnEvent, dynatraceConfig); err != nil {
+			logger.WithError(err).Error("Failed to check attachRules")
+		}
+
+		// the tag of the adapter is the version that was deployed in this sequence and is now reverted
+		revertedVersion := keptnEvent.GetTag()
+
+		if rbData.Result == keptnv2.ResultFailed {
+			ie := createInfoEvent(eh.ctx, keptnEvent, dynatraceConfig)
+			ie.CustomProperties["Rollback"] = "true"
+			ie.CustomProperties["Reverted Version"] = revertedVersion
+			if ie.Title == "" {
+				ie.Title = "Rollback of " + rbData.Service + " in " + rbData.Stage + " failed"
+			}
+			if ie.Description == "" {
+				ie.Description = "Rollback of " + rbData.Service + " " + revertedVersion + " in " + rbData.Stage + " failed: " + rbData.Message
+			}
+			dtHelper.SendEvent(ie)
+			return nil
+		}
 
+		// Send Deployment Event flagged as rollback so that the reverted version is visible on the entities
+		de := createDeploymentEvent(eh.ctx, keptnEvent, dynatraceConfig)
+		de.CustomProperties["Rollback"] = "true"
+		de.CustomProperties["Reverted Version"] = revertedVersion
+		if de.CustomProperties["deploymentName"] == "" {
+			de.DeploymentName = "Rollback " + rbData.Service + " " + revertedVersion + " in " + rbData.Stage
+		}
+		if de.CustomProperties["deploymentVersion"] == "" {
+			de.DeploymentVersion = "rollback of " + revertedVersion
+		}
+		dtHelper.SendEvent(de)
 	} else {
-		log.WithField("EventType", eh.Event.Type()).Info("Ignoring event")
+		logger.WithField("EventType", eh.Event.Type()).Info("Ignoring event")
 	}
 	return nil
 }
+
+/**
+ * Closes the Dynatrace problem after its remediation passed the evaluation. The problem ID of the labels of the event isn't sufficient, as labels
+ * are copied between sequences - so the problem is only closed if the KeptnContext of the evaluation is a remediation sequence triggered for it
+ */
+func (eh CDEventHandler) closeRemediatedProblem(dtHelper *lib.DynatraceHelper, keptnEvent adapter.EventContentAdapter, pid string, comment string) {
+	logger := logging.FromContext(eh.ctx).WithField("PID", pid)
+	isRemediation, err := isRemediationOfProblem(keptnEvent.GetProject(), keptnEvent.GetStage(), keptnEvent.GetShKeptnContext(), pid)
+	if err != nil {
+		logger.WithError(err).Error("Could not check whether the evaluation belongs to the remediation of the problem")
+		return
+	}
+	if !isRemediation {
+		logger.Info("Not closing problem as the evaluation doesn't belong to a remediation sequence of the problem")
+		return
+	}
+
+	if err := dtHelper.CloseProblem(pid, comment); err != nil {
+		logger.WithError(err).Error("Could not close problem after successful remediation")
+	}
+}
+
+// getSequenceEvents returns the events of the stage in the KeptnContext - it is a variable so that it can be replaced in tests
+var getSequenceEvents = func(project string, stage string, keptnContext string) ([]*models.KeptnContextExtendedCE, error) {
+	eventHandler := keptnapi.NewEventHandler(os.Getenv("DATASTORE"))
+	events, errObj := eventHandler.GetEvents(&keptnapi.EventFilter{
+		Project:      project,
+		Stage:        stage,
+		KeptnContext: keptnContext,
+	})
+	if errObj != nil {
+		return nil, errors.New("could not retrieve events of the sequence: " + *errObj.Message)
+	}
+	return events, nil
+}
+
+// isRemediationOfProblem returns whether a sequence of the stage was triggered for the problem in the KeptnContext, as the problem handler does for open problems
+func isRemediationOfProblem(project string, stage string, keptnContext string, pid string) (bool, error) {
+	events, err := getSequenceEvents(project, stage, keptnContext)
+	if err != nil {
+		return false, err
+	}
+
+	sequencePrefix := "sh.keptn.event." + stage + "."
+	for _, event := range events {
+		if event == nil || event.Type == nil || !strings.HasPrefix(*event.Type, sequencePrefix) || !strings.HasSuffix(*event.Type, ".triggered") {
+			continue
+		}
+		data := &remediationTriggeredEventData{}
+		if err := keptnv2.Decode(event.Data, data); err != nil {
+			continue
+		}
+		if data.Problem.PID == pid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,65 @@
+package event_handler
+
+import (
+	"testing"
+
+	"github.com/keptn/go-utils/pkg/api/models"
+)
+
+func TestIsRemediationOfProblem(t *testing.T) {
+	newEvent := func(eventType string, pid string) *models.KeptnContextExtendedCE {
+		return &models.KeptnContextExtendedCE{
+			Type: &eventType,
+			Data: map[string]interface{}{"project": "sockshop", "stage": "production", "problem": map[string]interface{}{"PID": pid}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		events []*models.KeptnContextExtendedCE
+		want   bool
+	}{
+		{
+			name:   "remediation was triggered for the problem",
+			events: []*models.KeptnContextExtendedCE{newEvent("sh.keptn.event.production.remediation.triggered", "123_456V2")},
+			want:   true,
+		},
+		{
+			name:   "remediation sequence of a remediation rule was triggered for the problem",
+			events: []*models.KeptnContextExtendedCE{newEvent("sh.keptn.event.production.remediation-critical.triggered", "123_456V2")},
+			want:   true,
+		},
+		{
+			name:   "remediation was triggered for another problem",
+			events: []*models.KeptnContextExtendedCE{newEvent("sh.keptn.event.production.remediation.triggered", "789_000V2")},
+			want:   false,
+		},
+		{
+			name:   "problem ID only in a finished event",
+			events: []*models.KeptnContextExtendedCE{newEvent("sh.keptn.event.production.remediation.finished", "123_456V2")},
+			want:   false,
+		},
+		{
+			name: "no remediation in the keptn context",
+			want: false,
+		},
+	}
+	getSequenceEventsOrig := getSequenceEvents
+	defer func() { getSequenceEvents = getSequenceEventsOrig }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getSequenceEvents = func(project string, stage string, keptnContext string) ([]*models.KeptnContextExtendedCE, error) {
+				return tt.events, nil
+			}
+
+			got, err := isRemediationOfProblem("sockshop", "production", "my-keptn-context", "123_456V2")
+			if err != nil {
+				t.Fatalf("isRemediationOfProblem() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isRemediationOfProblem() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,28 +1,44 @@
 package event_handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	keptncommon "github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/tracing"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
-	"github.com/gorilla/websocket"
+	"github.com/keptn-contrib/dynatrace-service/pkg/keptnevents"
 	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 	keptn "github.com/keptn/go-utils/pkg/lib"
 )
 
 type ConfigureMonitoringEventHandler struct {
-	Event            cloudevents.Event
-	IsCombinedLogger bool
-	WebSocket        *websocket.Conn
-	KeptnHandler     *keptnv2.Keptn
-	dtConfigGetter   adapter.DynatraceConfigGetterInterface
+	ctx            context.Context
+	Event          cloudevents.Event
+	KeptnHandler   *keptnv2.Keptn
+	dtConfigGetter adapter.DynatraceConfigGetterInterface
+}
+
+// configureMonitoringDryRunData is the part of the configure monitoring event data that requests a dry run
+type configureMonitoringDryRunData struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// configureMonitoringFinishedEventData adds the results of the configured entities in a machine-readable form to the data of the finished event
+type configureMonitoringFinishedEventData struct {
+	keptnv2.ConfigureMonitoringFinishedEventData
+	ConfiguredEntities []lib.ConfiguredEntityResult `json:"configuredEntities,omitempty"`
+	DryRun             bool                         `json:"dryRun,omitempty"`
+	PlannedChanges     []string                     `json:"plannedChanges,omitempty"`
+	ConfigurationDrift []string                     `json:"configurationDrift,omitempty"`
 }
 
 type KeptnAPIConnectionCheck struct {
@@ -44,15 +60,16 @@ func (eh ConfigureMonitoringEventHandler) HandleEvent() error {
 			return nil
 		}
 	}
-	err := eh.configureMonitoring()
-	if err != nil {
-		log.WithError(err).Error("Configure monitoring failed")
+	// the error is returned after the failed finished event has been sent, so that the event is stored as dead letter and can be triggered again
+	if err := eh.configureMonitoring(); err != nil {
+		return fmt.Errorf("configure monitoring failed: %w", err)
 	}
 	return nil
 }
 
 func (eh *ConfigureMonitoringEventHandler) configureMonitoring() error {
-	log.Info("Configuring Dynatrace monitoring")
+	logger := logging.FromContext(eh.ctx)
+	logger.Info("Configuring Dynatrace monitoring")
 	e := &keptn.ConfigureMonitoringEventData{}
 	err := eh.Event.DataAs(e)
 	if err != nil {
@@ -66,19 +83,19 @@ func (eh *ConfigureMonitoringEventHandler) configureMonitoring() error {
 	// check the connection to the Keptn API
 	keptnCredentials, err := credentials.GetKeptnCredentials()
 	if err != nil {
-		log.WithError(err).Error("Failed to get Keptn API credentials")
+		logger.WithError(err).Error("Failed to get Keptn API credentials")
 		keptnAPICheck.Message = "Failed to get Keptn API Credentials"
 		keptnAPICheck.ConnectionSuccessful = false
 		keptnAPICheck.APIURL = "unknown"
 	} else {
 		keptnAPICheck.APIURL = keptnCredentials.APIURL
-		log.WithField("apiUrl", keptnCredentials.APIURL).Print("Verifying access to Keptn API")
+		logger.WithField("apiUrl", keptnCredentials.APIURL).Print("Verifying access to Keptn API")
 
 		err = credentials.CheckKeptnConnection(keptnCredentials)
 		if err != nil {
 			keptnAPICheck.ConnectionSuccessful = false
 			keptnAPICheck.Message = "Warning: Keptn API connection cannot be verified. This might be due to a no-loopback policy of your LoadBalancer. The endpoint might still be reachable from outside the cluster."
-			log.WithError(err).Warn(keptnAPICheck.Message)
+			logger.WithError(err).Warn(keptnAPICheck.Message)
 		} else {
 			keptnAPICheck.ConnectionSuccessful = true
 		}
@@ -101,7 +118,9 @@ func (eh *ConfigureMonitoringEventHandler) configureMonitoring() error {
 
 	keptnEvent := adapter.NewConfigureMonitoringAdapter(*e, keptnHandler.KeptnContext, eh.Event.Source())
 
+	_, configSpan := tracing.StartSpan(eh.ctx, "get dynatrace.conf.yaml")
 	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
+	configSpan.End(err)
 	if err != nil {
 		msg := fmt.Sprintf("failed to load Dynatrace config: %v", err)
 		return eh.handleError(e, msg)
@@ -111,17 +130,27 @@ func (eh *ConfigureMonitoringEventHandler) configureMonitoring() error {
 		msg := fmt.Sprintf("failed to load Dynatrace credentials: %v", err)
 		return eh.handleError(e, msg)
 	}
-	dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+	dtHelper := lib.NewDynatraceHelper(keptnHandler, creds.ForConfiguration())
+	dtHelper.DryRun = eh.isDryRun(dynatraceConfig)
+	dtHelper.EventContext = eh.ctx
+
+	requiredScopes, err := dtHelper.GetConfigurationScopes(!dtHelper.DryRun)
+	if err != nil {
+		return eh.handleError(e, err.Error())
+	}
+	if err := dtHelper.ValidateCredentials(requiredScopes...); err != nil {
+		return eh.handleError(e, err.Error())
+	}
 
-	configuredEntities, err := dtHelper.ConfigureMonitoring(e.Project, shipyard)
+	configuredEntities, err := dtHelper.ConfigureMonitoring(e.Project, shipyard, dynatraceConfig)
 	if err != nil {
 		return eh.handleError(e, err.Error())
 	}
 
-	log.Info("Dynatrace Monitoring setup done")
+	logger.Info("Dynatrace Monitoring setup done")
 
-	if err := eh.sendConfigureMonitoringFinishedEvent(e, keptnv2.StatusSucceeded, keptnv2.ResultPass, getConfigureMonitoringResultMessage(keptnAPICheck, configuredEntities)); err != nil {
-		log.WithError(err).Error("Failed to send configure monitoring finished event")
+	if err := eh.sendConfigureMonitoringFinishedEvent(e, keptnv2.StatusSucceeded, keptnv2.ResultPass, getConfigureMonitoringResultMessage(keptnAPICheck, configuredEntities), configuredEntities); err != nil {
+		logger.WithError(err).Error("Failed to send configure monitoring finished event")
 	}
 	return nil
 }
@@ -130,7 +159,11 @@ func getConfigureMonitoringResultMessage(apiCheck *KeptnAPIConnectionCheck, enti
 	if entities == nil {
 		return ""
 	}
+	if entities.DryRun {
+		return getConfigureMonitoringDryRunMessage(entities)
+	}
 	msg := "Dynatrace monitoring setup done.\nThe following entities have been configured:\n\n"
+	msg = msg + getConfigurationDriftMessage(entities)
 
 	if entities.ManagementZonesEnabled && len(entities.ManagementZones) > 0 {
 		msg = msg + "---Management Zones:--- \n"
@@ -156,12 +189,48 @@ func getConfigureMonitoringResultMessage(apiCheck *KeptnAPIConnectionCheck, enti
 		msg = msg + "\n\n"
 	}
 
+	if entities.ServiceNamingRulesEnabled && len(entities.ServiceNamingRules) > 0 {
+		msg = msg + "---Service Naming Rules:--- \n"
+		for _, nr := range entities.ServiceNamingRules {
+			if nr.Success {
+				msg = msg + "  - " + nr.Name + ": Created successfully \n"
+			} else {
+				msg = msg + "  - " + nr.Name + ": Error: " + nr.Message + "\n"
+			}
+		}
+		msg = msg + "\n\n"
+	}
+
 	if entities.ProblemNotificationsEnabled {
 		msg = msg + "---Problem Notification:--- \n"
 		msg = msg + "  - " + entities.ProblemNotifications.Message
 		msg = msg + "\n\n"
 	}
 
+	if len(entities.AlertingProfiles) > 0 {
+		msg = msg + "---Alerting Profiles:--- \n"
+		for _, ap := range entities.AlertingProfiles {
+			if ap.Success {
+				msg = msg + "  - " + ap.Name + ": Created successfully \n"
+			} else {
+				msg = msg + "  - " + ap.Name + ": Error: " + ap.Message + "\n"
+			}
+		}
+		msg = msg + "\n\n"
+	}
+
+	if len(entities.AnomalyDetection) > 0 {
+		msg = msg + "---Anomaly Detection:--- \n"
+		for _, ad := range entities.AnomalyDetection {
+			if ad.Success {
+				msg = msg + "  - " + ad.Name + ": " + ad.Message + " \n"
+			} else {
+				msg = msg + "  - " + ad.Name + ": Error: " + ad.Message + "\n"
+			}
+		}
+		msg = msg + "\n\n"
+	}
+
 	if entities.MetricEventsEnabled && len(entities.MetricEvents) > 0 {
 		msg = msg + "---Metric Events:--- \n"
 		for _, mz := range entities.MetricEvents {
@@ -174,12 +243,48 @@ func getConfigureMonitoringResultMessage(apiCheck *KeptnAPIConnectionCheck, enti
 		msg = msg + "\n\n"
 	}
 
+	if entities.SLOsEnabled && len(entities.SLOs) > 0 {
+		msg = msg + "---SLOs:--- \n"
+		for _, slo := range entities.SLOs {
+			if slo.Success {
+				msg = msg + "  - " + slo.Name + ": Created successfully \n"
+			} else {
+				msg = msg + "  - " + slo.Name + ": Error: " + slo.Message + "\n"
+			}
+		}
+		msg = msg + "\n\n"
+	}
+
+	if entities.CalculatedMetricsEnabled && len(entities.CalculatedMetrics) > 0 {
+		msg = msg + "---Calculated Metrics:--- \n"
+		for _, cm := range entities.CalculatedMetrics {
+			if cm.Success {
+				msg = msg + "  - " + cm.Name + ": Created successfully \n"
+			} else {
+				msg = msg + "  - " + cm.Name + ": Error: " + cm.Message + "\n"
+			}
+		}
+		msg = msg + "\n\n"
+	}
+
 	if entities.DashboardEnabled && entities.Dashboard.Message != "" {
 		msg = msg + "---Dashboard:--- \n"
 		msg = msg + "  - " + entities.Dashboard.Message
 		msg = msg + "\n\n"
 	}
 
+	if len(entities.MonacoConfigs) > 0 {
+		msg = msg + "---Monaco Configurations:--- \n"
+		for _, mc := range entities.MonacoConfigs {
+			if mc.Success {
+				msg = msg + "  - " + mc.Name + ": " + mc.Message + " \n"
+			} else {
+				msg = msg + "  - " + mc.Name + ": Error: " + mc.Message + "\n"
+			}
+		}
+		msg = msg + "\n\n"
+	}
+
 	if apiCheck != nil {
 		msg = msg + "---Keptn API Connection Check:--- \n"
 		msg = msg + "  - Keptn API URL: " + apiCheck.APIURL + "\n"
@@ -190,39 +295,75 @@ func getConfigureMonitoringResultMessage(apiCheck *KeptnAPIConnectionCheck, enti
 	return msg
 }
 
-func (eh *ConfigureMonitoringEventHandler) handleError(e *keptn.ConfigureMonitoringEventData, msg string) error {
-	log.Error(msg)
-	if err := eh.sendConfigureMonitoringFinishedEvent(e, keptnv2.StatusErrored, keptnv2.ResultFailed, msg); err != nil {
-		log.WithError(err).Error("Failed to send configure monitoring finished event")
+// isDryRun returns whether the dry run was requested by the dryRun flag of the event data or by configureMonitoringDryRun of the dynatrace.conf.yaml
+func (eh *ConfigureMonitoringEventHandler) isDryRun(dynatraceConfig *config.DynatraceConfigFile) bool {
+	if dynatraceConfig != nil && dynatraceConfig.ConfigureMonitoringDryRun {
+		return true
 	}
-	return errors.New(msg)
+	dryRunData := &configureMonitoringDryRunData{}
+	if err := eh.Event.DataAs(dryRunData); err != nil {
+		return false
+	}
+	return dryRunData.DryRun
 }
 
-func (eh *ConfigureMonitoringEventHandler) sendConfigureMonitoringFinishedEvent(configureMonitoringData *keptn.ConfigureMonitoringEventData, status keptnv2.StatusType, result keptnv2.ResultType, message string) error {
-
-	cmFinishedEvent := &keptnv2.ConfigureMonitoringFinishedEventData{
-		EventData: keptnv2.EventData{
-			Project: configureMonitoringData.Project,
-			Service: configureMonitoringData.Service,
-			Status:  status,
-			Result:  result,
-			Message: message,
-		},
+func getConfigureMonitoringDryRunMessage(entities *lib.ConfiguredEntities) string {
+	if len(entities.PlannedChanges) == 0 {
+		return "Dynatrace monitoring dry run done. The configuration of the tenant is up to date - no changes would be made.\n"
+	}
+	msg := "Dynatrace monitoring dry run done. No changes have been applied.\n\n"
+	msg = msg + getConfigurationDriftMessage(entities)
+	msg = msg + "The following changes would be made:\n\n"
+	for _, change := range entities.PlannedChanges {
+		msg = msg + "  - " + change + "\n"
 	}
+	return msg
+}
 
-	keptnContext, _ := eh.Event.Context.GetExtension("shkeptncontext")
+// getConfigurationDriftMessage lists the entities that were changed in the tenant since monitoring was last configured
+func getConfigurationDriftMessage(entities *lib.ConfiguredEntities) string {
+	if len(entities.ConfigurationDrift) == 0 {
+		return ""
+	}
+	msg := "---Configuration Drift:--- \n"
+	for _, drift := range entities.ConfigurationDrift {
+		msg = msg + "  - " + drift + "\n"
+	}
+	return msg + "\n\n"
+}
 
-	event := cloudevents.NewEvent()
-	event.SetSource("dynatrace-service")
-	event.SetDataContentType(cloudevents.ApplicationJSON)
-	event.SetType(keptnv2.GetFinishedEventType(keptnv2.ConfigureMonitoringTaskName))
-	event.SetData(cloudevents.ApplicationJSON, cmFinishedEvent)
-	event.SetExtension("shkeptncontext", keptnContext)
-	event.SetExtension("triggeredid", eh.Event.Context.GetID())
+func (eh *ConfigureMonitoringEventHandler) handleError(e *keptn.ConfigureMonitoringEventData, msg string) error {
+	logger := logging.FromContext(eh.ctx)
+	logger.Error(msg)
+	if err := eh.sendConfigureMonitoringFinishedEvent(e, keptnv2.StatusErrored, keptnv2.ResultFailed, msg, nil); err != nil {
+		logger.WithError(err).Error("Failed to send configure monitoring finished event")
+	}
+	return errors.New(msg)
+}
 
-	if err := eh.KeptnHandler.SendCloudEvent(event); err != nil {
-		return fmt.Errorf("could not send %s event: %s", keptnv2.GetFinishedEventType(keptnv2.ConfigureMonitoringTaskName), err.Error())
+func (eh *ConfigureMonitoringEventHandler) sendConfigureMonitoringFinishedEvent(configureMonitoringData *keptn.ConfigureMonitoringEventData, status keptnv2.StatusType, result keptnv2.ResultType, message string, configuredEntities *lib.ConfiguredEntities) error {
+
+	cmFinishedEvent := &configureMonitoringFinishedEventData{
+		ConfigureMonitoringFinishedEventData: keptnv2.ConfigureMonitoringFinishedEventData{
+			EventData: keptnv2.EventData{
+				Project: configureMonitoringData.Project,
+				Service: configureMonitoringData.Service,
+				Status:  status,
+				Result:  result,
+				Message: message,
+			},
+		},
+	}
+	if configuredEntities != nil {
+		cmFinishedEvent.ConfiguredEntities = configuredEntities.GetResults()
+		cmFinishedEvent.DryRun = configuredEntities.DryRun
+		cmFinishedEvent.PlannedChanges = configuredEntities.PlannedChanges
+		cmFinishedEvent.ConfigurationDrift = configuredEntities.ConfigurationDrift
 	}
 
-	return nil
+	event, err := keptnevents.NewEvent(eh.Event, keptnv2.GetFinishedEventType(keptnv2.ConfigureMonitoringTaskName), cmFinishedEvent)
+	if err != nil {
+		return err
+	}
+	return keptnevents.Send(eh.ctx, event)
 }
@@ -1,71 +1,75 @@
 package event_handler
 
 import (
+	"context"
+
 	"encoding/base64"
 
 	"github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 
-	log "github.com/sirupsen/logrus"
-
 	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 	"gopkg.in/yaml.v2"
 )
 
 type CreateProjectEventHandler struct {
+	ctx            context.Context
 	Event          cloudevents.Event
 	dtConfigGetter adapter.DynatraceConfigGetterInterface
 }
 
 func (eh CreateProjectEventHandler) HandleEvent() error {
+	logger := logging.FromContext(eh.ctx)
 	var shkeptncontext string
 	_ = eh.Event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
 
 	e := &keptnv2.ProjectCreateFinishedEventData{}
 	err := eh.Event.DataAs(e)
 	if err != nil {
-		log.WithError(err).Error("Could not parse event payload")
+		logger.WithError(err).Error("Could not parse event payload")
 		return err
 	}
 
 	shipyard := &keptnv2.Shipyard{}
 	decodedShipyard, err := base64.StdEncoding.DecodeString(e.CreatedProject.Shipyard)
 	if err != nil {
-		log.WithError(err).Error("Could not decode shipyard")
+		logger.WithError(err).Error("Could not decode shipyard")
 	}
 	err = yaml.Unmarshal(decodedShipyard, shipyard)
 	if err != nil {
-		log.WithError(err).Error("Could not parse shipyard")
+		logger.WithError(err).Error("Could not parse shipyard")
 	}
 
 	keptnHandler, err := keptnv2.NewKeptn(&eh.Event, keptn.KeptnOpts{})
 	if err != nil {
-		log.WithError(err).Error("Could not create Keptn handler")
+		logger.WithError(err).Error("Could not create Keptn handler")
 	}
 
 	keptnEvent := adapter.NewProjectCreateAdapter(*e, keptnHandler.KeptnContext, eh.Event.Source())
 
 	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
 	if err != nil {
-		log.WithError(err).Error("failed to load Dynatrace config")
+		logger.WithError(err).Error("failed to load Dynatrace config")
 		return err
 	}
 	creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
 	if err != nil {
-		log.WithError(err).Error("Failed to load Dynatrace credentials")
+		logger.WithError(err).Error("Failed to load Dynatrace credentials")
 		return err
 	}
-	dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+	dtHelper := lib.NewDynatraceHelper(keptnHandler, creds.ForConfiguration())
+	dtHelper.EventContext = eh.ctx
 
-	_, err = dtHelper.ConfigureMonitoring(e.Project, shipyard)
+	_, err = dtHelper.ConfigureMonitoring(e.Project, shipyard, dynatraceConfig)
 	if err != nil {
 		return err
 	}
 
-	log.Info("Dynatrace Monitoring setup done")
+	logger.Info("Dynatrace Monitoring setup done")
 	return nil
 }
@@ -0,0 +1,178 @@
+package event_handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	keptncommon "github.com/keptn/go-utils/pkg/lib"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib/dynatrace"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+// defaultDashboardDebugTimeframe is the length of the timeframe the dashboard is evaluated for if no start is passed
+const defaultDashboardDebugTimeframe = 15 * time.Minute
+
+// dashboardDebugResult is the response of the dashboard debug endpoint with everything that a get-sli event would generate from the dashboards
+type dashboardDebugResult struct {
+	Dashboards []string                            `json:"dashboards"`
+	Start      string                              `json:"start"`
+	End        string                              `json:"end"`
+	SLI        map[string]string                   `json:"sli"`
+	SLO        *keptncommon.ServiceLevelObjectives `json:"slo"`
+	SLIResults []*keptnv2.SLIResult                `json:"sliResults"`
+	TileReport []*dynatrace.TileProcessingResult   `json:"tileReport"`
+}
+
+/**
+ * NewDashboardDebugHandler returns the handler of GET /debug/dashboard?project=<project>&stage=<stage>&service=<service>, which parses the dashboards
+ * of the dynatrace.conf.yaml of the service - or the passed dashboard ID - like a get-sli event and returns the generated SLIs, SLOs, SLI values and tile report
+ * Optional parameters are dashboard, start and end in RFC3339 format or as unix timestamp and the timeframe, e.g: 30m, if no start is passed
+ * Nothing is uploaded to the Keptn configuration repo and no Keptn events are sent
+ */
+func NewDashboardDebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		keptnEvent := &common_sli.BaseKeptnEvent{
+			Project: query.Get("project"),
+			Stage:   query.Get("stage"),
+			Service: query.Get("service"),
+		}
+		if keptnEvent.Project == "" || keptnEvent.Stage == "" || keptnEvent.Service == "" {
+			writeDashboardDebugError(w, http.StatusBadRequest, errors.New("project, stage and service are required"))
+			return
+		}
+
+		timeframe := defaultDashboardDebugTimeframe
+		if query.Get("timeframe") != "" {
+			parsedTimeframe, err := time.ParseDuration(query.Get("timeframe"))
+			if err != nil || parsedTimeframe <= 0 {
+				writeDashboardDebugError(w, http.StatusBadRequest, fmt.Errorf("invalid timeframe %s", query.Get("timeframe")))
+				return
+			}
+			timeframe = parsedTimeframe
+		}
+		startUnix, endUnix, err := parseDashboardDebugTimeframe(query.Get("start"), query.Get("end"), timeframe)
+		if err != nil {
+			writeDashboardDebugError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := debugDashboards(r.Context(), keptnEvent, query.Get("dashboard"), startUnix, endUnix)
+		if err != nil {
+			writeDashboardDebugError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		logging.FromContext(r.Context()).WithFields(
+			log.Fields{
+				"project":    keptnEvent.Project,
+				"stage":      keptnEvent.Stage,
+				"service":    keptnEvent.Service,
+				"dashboards": result.Dashboards,
+			}).Info("Parsed dashboards for debug request")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// debugDashboards parses the dashboards with the dynatrace.conf.yaml and credentials of the service the same way as for a get-sli event
+func debugDashboards(ctx context.Context, keptnEvent *common_sli.BaseKeptnEvent, dashboard string, startUnix time.Time, endUnix time.Time) (*dashboardDebugResult, error) {
+	dynatraceConfigFile := common_sli.GetDynatraceConfig(ctx, keptnEvent)
+	dashboards := dynatraceConfigFile.GetDashboards()
+	if dashboard != "" {
+		dashboards = []string{dashboard}
+	}
+
+	dtCredentials, err := getDynatraceCredentials(ctx, dynatraceConfigFile.DtCreds, keptnEvent.Project, keptnEvent.Stage)
+	if err != nil {
+		return nil, err
+	}
+
+	dynatraceHandler := dynatrace.NewDynatraceHandler(
+		dtCredentials.Tenant,
+		keptnEvent,
+		map[string]string{
+			"Authorization": "Api-Token " + dtCredentials.ApiToken,
+			"User-Agent":    "keptn-contrib/dynatrace-service:" + os.Getenv("version"),
+		},
+		nil, "", "")
+	tlsConfig, err := dtCredentials.NewTLSConfig(!dynatrace.IsHttpSSLVerificationEnabled())
+	if err != nil {
+		return nil, err
+	}
+	dynatraceHandler.UseTLSConfig(tlsConfig)
+	dynatraceHandler.EventContext = ctx
+	// the dashboard is parsed even if it hasn't changed since the last evaluation, as the result is the point of the request
+	dynatraceHandler.ForceDashboardParsing = true
+	dynatraceHandler.UnitScalingRules = dynatraceConfigFile.UnitScaling
+	dynatraceHandler.DetectMetricUnits = dynatraceConfigFile.ShouldDetectMetricUnits()
+	dynatraceHandler.ManagementZone = dynatraceConfigFile.ManagementZone
+	dynatraceHandler.PlatformURL = dtCredentials.PlatformURL
+	dynatraceHandler.PlatformToken = dtCredentials.PlatformToken
+
+	dashboardLinks, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err := dynatraceHandler.QueryDynatraceDashboardsForSLIs(keptnEvent, dashboards, startUnix, endUnix)
+	if err != nil {
+		return nil, err
+	}
+	if dashboardJSON == nil {
+		return nil, fmt.Errorf("no dashboard found for project %s, stage %s and service %s", keptnEvent.Project, keptnEvent.Stage, keptnEvent.Service)
+	}
+
+	result := &dashboardDebugResult{
+		Dashboards: dashboardLinks,
+		Start:      startUnix.Format(time.RFC3339),
+		End:        endUnix.Format(time.RFC3339),
+		SLO:        dashboardSLO,
+		SLIResults: sliResults,
+		TileReport: dynatraceHandler.GetTileReport(),
+	}
+	if dashboardSLI != nil {
+		result.SLI = dashboardSLI.Indicators
+	}
+	return result, nil
+}
+
+// parseDashboardDebugTimeframe returns the passed start and end or the timeframe before the end, which defaults to now
+func parseDashboardDebugTimeframe(start string, end string, timeframe time.Duration) (time.Time, time.Time, error) {
+	endUnix := time.Now().UTC()
+	if end != "" {
+		parsedEnd, err := common_sli.ParseUnixTimestamp(end)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("could not parse end %s: %v", end, err)
+		}
+		endUnix = parsedEnd.UTC()
+	}
+
+	startUnix := endUnix.Add(-timeframe)
+	if start != "" {
+		parsedStart, err := common_sli.ParseUnixTimestamp(start)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("could not parse start %s: %v", start, err)
+		}
+		startUnix = parsedStart.UTC()
+	}
+
+	if !startUnix.Before(endUnix) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start %s has to be before end %s", startUnix.Format(time.RFC3339), endUnix.Format(time.RFC3339))
+	}
+	return startUnix, endUnix, nil
+}
+
+func writeDashboardDebugError(w http.ResponseWriter, statusCode int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
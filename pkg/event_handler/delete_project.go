@@ -0,0 +1,94 @@
+package event_handler
+
+import (
+	"context"
+
+	"github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+type DeleteProjectEventHandler struct {
+	ctx            context.Context
+	Event          cloudevents.Event
+	dtConfigGetter adapter.DynatraceConfigGetterInterface
+}
+
+// HandleEvent removes the Dynatrace configuration of a project once it was deleted in Keptn
+func (eh DeleteProjectEventHandler) HandleEvent() error {
+	logger := logging.FromContext(eh.ctx)
+	e := &keptnv2.ProjectDeleteFinishedEventData{}
+	err := eh.Event.DataAs(e)
+	if err != nil {
+		logger.WithError(err).Error("Could not parse event payload")
+		return err
+	}
+	if e.Status != keptnv2.StatusSucceeded || e.Project == "" {
+		logger.WithField("project", e.Project).Info("Project was not deleted - keeping its Dynatrace configuration")
+		return nil
+	}
+
+	keptnHandler, err := keptnv2.NewKeptn(&eh.Event, keptn.KeptnOpts{})
+	if err != nil {
+		logger.WithError(err).Error("Could not create Keptn handler")
+	}
+
+	// the dynatrace.conf.yaml is usually deleted together with the project, in that case the default credentials are used for the project
+	keptnEvent := adapter.NewTaskEventAdapter(e.EventData, eh.Event.Type(), keptnHandler.KeptnContext, eh.Event.Source())
+	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
+	if err != nil {
+		logger.WithError(err).Info("Could not load Dynatrace config of deleted project - using the default credentials")
+		dynatraceConfig = nil
+	}
+	creds, err := credentials.GetDynatraceCredentials(dynatraceConfig)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load Dynatrace credentials")
+		return err
+	}
+	dtHelper := lib.NewDynatraceHelper(keptnHandler, creds.ForConfiguration())
+	dtHelper.EventContext = eh.ctx
+
+	// the stages have to be determined before the management zones are deleted, their credentials may point to other tenants
+	tenantCreds := []*credentials.DTCredentials{creds}
+	for _, stage := range dtHelper.GetProjectStages(e.Project) {
+		stageCreds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, e.Project, stage)
+		if err != nil {
+			logger.WithError(err).WithField("stage", stage).Error("Failed to load Dynatrace credentials of stage - its Dynatrace configuration is kept")
+			continue
+		}
+		if !containsTenant(tenantCreds, stageCreds.Tenant) {
+			tenantCreds = append(tenantCreds, stageCreds)
+		}
+	}
+
+	for _, tenantCred := range tenantCreds {
+		dtHelper := lib.NewDynatraceHelper(keptnHandler, tenantCred.ForConfiguration())
+		dtHelper.EventContext = eh.ctx
+		for _, result := range dtHelper.DeleteProjectConfiguration(e.Project) {
+			if result.Success {
+				logger.WithField("name", result.Name).Info("Deleted Dynatrace configuration of project")
+			} else {
+				logger.WithField("name", result.Name).Error(result.Message)
+			}
+		}
+	}
+
+	logger.WithField("project", e.Project).Info("Dynatrace configuration of project deleted")
+	return nil
+}
+
+// containsTenant returns whether the project configuration of the tenant is already deleted with one of the credentials
+func containsTenant(creds []*credentials.DTCredentials, tenant string) bool {
+	for _, c := range creds {
+		if c.Tenant == tenant {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package event_handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/keptnevents"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// triggerSyntheticMonitorsAction is the action of a remediation that is executed by the dynatrace-service itself
+const triggerSyntheticMonitorsAction = "trigger-synthetic-monitors"
+
+// syntheticMonitorsActionValue is the value of a trigger-synthetic-monitors action as specified in the remediation.yaml
+type syntheticMonitorsActionValue struct {
+	Monitors []string `json:"monitors"`
+	Tags     []string `json:"tags"`
+}
+
+// isDynatraceAction returns true if the action is executed against Dynatrace by the dynatrace-service
+func isDynatraceAction(action string) bool {
+	return action == triggerSyntheticMonitorsAction
+}
+
+/**
+ * Executes an action that is provided by the dynatrace-service, e.g: an on-demand execution of synthetic monitors
+ * Sends the action.started and action.finished events for the action.triggered event so that Keptn can continue the remediation.
+ * The attachRulesWarning of the check of the attachRules is added to the message of a successful action.finished event with the result warning
+ */
+func (eh ActionHandler) executeDynatraceAction(actionTriggeredData *keptnv2.ActionTriggeredEventData, keptnEvent adapter.EventContentAdapter, attachRulesWarning string) error {
+	logger := logging.FromContext(eh.ctx)
+	if err := eh.sendActionEvent(keptnv2.GetStartedEventType(keptnv2.ActionTaskName), keptnv2.ActionStartedEventData{
+		EventData: keptnv2.EventData{
+			Project: actionTriggeredData.Project,
+			Stage:   actionTriggeredData.Stage,
+			Service: actionTriggeredData.Service,
+			Labels:  actionTriggeredData.Labels,
+			Status:  keptnv2.StatusSucceeded,
+		},
+	}); err != nil {
+		logger.WithError(err).Error("Could not send action.started event")
+	}
+
+	message, err := eh.triggerSyntheticMonitors(actionTriggeredData, keptnEvent)
+
+	actionFinishedData := keptnv2.ActionFinishedEventData{
+		EventData: keptnv2.EventData{
+			Project: actionTriggeredData.Project,
+			Stage:   actionTriggeredData.Stage,
+			Service: actionTriggeredData.Service,
+			Labels:  actionTriggeredData.Labels,
+			Status:  keptnv2.StatusSucceeded,
+			Result:  keptnv2.ResultPass,
+			Message: message,
+		},
+	}
+	if err != nil {
+		logger.WithError(err).WithField("action", actionTriggeredData.Action.Action).Error("Failed to execute Dynatrace action")
+		actionFinishedData.Status = keptnv2.StatusErrored
+		actionFinishedData.Result = keptnv2.ResultFailed
+		actionFinishedData.Message = err.Error()
+	} else if attachRulesWarning != "" {
+		actionFinishedData.Result = keptnv2.ResultWarning
+		actionFinishedData.Message = message + "\n" + attachRulesWarning
+	}
+
+	return eh.sendActionEvent(keptnv2.GetFinishedEventType(keptnv2.ActionTaskName), actionFinishedData)
+}
+
+func (eh ActionHandler) triggerSyntheticMonitors(actionTriggeredData *keptnv2.ActionTriggeredEventData, keptnEvent adapter.EventContentAdapter) (string, error) {
+	// the value is an arbitrary YAML object in the remediation.yaml - it's converted to the expected structure via JSON
+	value := syntheticMonitorsActionValue{}
+	if actionTriggeredData.Action.Value != nil {
+		rawValue, err := json.Marshal(actionTriggeredData.Action.Value)
+		if err != nil {
+			return "", fmt.Errorf("could not parse value of action %s: %v", triggerSyntheticMonitorsAction, err)
+		}
+		if err := json.Unmarshal(rawValue, &value); err != nil {
+			return "", fmt.Errorf("could not parse value of action %s: %v", triggerSyntheticMonitorsAction, err)
+		}
+	}
+
+	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
+	if err != nil {
+		return "", fmt.Errorf("failed to load Dynatrace config: %v", err)
+	}
+	creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
+	if err != nil {
+		return "", fmt.Errorf("failed to load Dynatrace credentials: %v", err)
+	}
+
+	dtHelper := lib.NewDynatraceHelper(nil, creds)
+	dtHelper.EventContext = eh.ctx
+	if err := dtHelper.ValidateCredentials(lib.ScopeExternalSyntheticIntegration); err != nil {
+		return "", err
+	}
+	result, err := dtHelper.TriggerSyntheticExecutions(value.Monitors, value.Tags)
+	if err != nil {
+		return "", err
+	}
+
+	if result.TriggeredCount == 0 {
+		return "", fmt.Errorf("no synthetic monitor was triggered - %d monitors could not be triggered", result.TriggeringProblemsCount)
+	}
+
+	message := "Triggered " + strconv.Itoa(result.TriggeredCount) + " synthetic monitor executions"
+	if result.TriggeringProblemsCount > 0 {
+		message = message + ", " + strconv.Itoa(result.TriggeringProblemsCount) + " monitors could not be triggered"
+	}
+	return message, nil
+}
+
+func (eh ActionHandler) sendActionEvent(eventType string, data interface{}) error {
+	event, err := keptnevents.NewEvent(eh.Event, eventType, data)
+	if err != nil {
+		return err
+	}
+	return keptnevents.Send(eh.ctx, event)
+}
@@ -1,10 +1,10 @@
 package event_handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -14,13 +14,18 @@ import (
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
 	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/keptnevents"
 	"github.com/keptn-contrib/dynatrace-service/pkg/lib/dynatrace"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/metrics"
+	"github.com/keptn-contrib/dynatrace-service/pkg/tracing"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 
 	"gopkg.in/yaml.v2"
 
-	"github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	// configutils "github.com/keptn/go-utils/pkg/configuration-service/utils"
 	// keptnevents "github.com/keptn/go-utils/pkg/events"
@@ -31,6 +36,7 @@ import (
 const ProblemOpenSLI = "problem_open"
 
 type GetSLIEventHandler struct {
+	ctx            context.Context
 	event          cloudevents.Event
 	dtConfigGetter adapter.DynatraceConfigGetterInterface
 }
@@ -49,9 +55,19 @@ func (eh GetSLIEventHandler) HandleEvent() error {
 		return nil
 	}
 
-	go retrieveMetrics(eh.event, eventData)
+	return retrieveMetrics(eh.ctx, eh.event, eventData)
+}
 
-	return nil
+// RejectEvent sends a failed get-sli.finished event, so that the evaluation doesn't wait for the SLIs until it times out
+func (eh GetSLIEventHandler) RejectEvent(reason error) error {
+	eventData := &keptnv2.GetSLITriggeredEventData{}
+	if err := eh.event.DataAs(eventData); err != nil {
+		return err
+	}
+	if eventData.GetSLI.SLIProvider != "dynatrace" {
+		return nil
+	}
+	return sendGetSLIFinishedEvent(eh.ctx, eh.event, eventData, nil, reason)
 }
 
 /**
@@ -60,7 +76,8 @@ func (eh GetSLIEventHandler) HandleEvent() error {
  *              to circumvent this issue I am changing the check to also allow a time difference of up to 2 minutes (120 seconds). This shouldnt be a problem as our SLI Service retries the DYnatrace API anyway
  * Here is the issue: https://github.com/keptn-contrib/dynatrace-sli-service/issues/55
  */
-func ensureRightTimestamps(start string, end string) (time.Time, time.Time, error) {
+func ensureRightTimestamps(ctx context.Context, start string, end string, timeframeShift time.Duration) (time.Time, time.Time, error) {
+	logger := logging.FromContext(ctx)
 
 	startUnix, err := common_sli.ParseUnixTimestamp(start)
 	if err != nil {
@@ -71,6 +88,13 @@ func ensureRightTimestamps(start string, end string) (time.Time, time.Time, erro
 		return startUnix, time.Now(), errors.New("Error parsing end date: " + err.Error())
 	}
 
+	// move the timeframe into the past to account for the ingest latency - this also shortens the time we have to wait below
+	if timeframeShift > 0 {
+		logger.WithField("timeframeShift", timeframeShift.String()).Info("Shifting evaluation timeframe into the past")
+		startUnix = startUnix.Add(-timeframeShift)
+		endUnix = endUnix.Add(-timeframeShift)
+	}
+
 	// ensure end time is not in the future
 	now := time.Now()
 	timeDiffInSeconds := now.Sub(endUnix).Seconds()
@@ -97,12 +121,12 @@ func ensureRightTimestamps(start string, end string) (time.Time, time.Time, erro
 
 	// log output while we are waiting
 	if time.Now().Sub(endUnix).Seconds() < waitForSeconds {
-		log.Debug("As the end date is too close to Now() we are going to wait to make sure we have all the data for the requested timeframe(start-end)")
+		logger.Debug("As the end date is too close to Now() we are going to wait to make sure we have all the data for the requested timeframe(start-end)")
 	}
 
 	// make sure the end timestamp is at least waitForSeconds seconds in the past such that dynatrace metrics API has processed data
 	for time.Now().Sub(endUnix).Seconds() < waitForSeconds {
-		log.WithField("sleepSeconds", int(waitForSeconds-time.Now().Sub(endUnix).Seconds())).Debug("Sleeping while waiting for Dynatrace Metrics API")
+		logger.WithField("sleepSeconds", int(waitForSeconds-time.Now().Sub(endUnix).Seconds())).Debug("Sleeping while waiting for Dynatrace Metrics API")
 		time.Sleep(10 * time.Second)
 	}
 
@@ -112,7 +136,7 @@ func ensureRightTimestamps(start string, end string) (time.Time, time.Time, erro
 /**
  * Adds an SLO Entry to the SLO.yaml
  */
-func addSLO(keptnEvent *common_sli.BaseKeptnEvent, newSLO *keptncommon.SLO) error {
+func addSLO(ctx context.Context, keptnEvent *common_sli.BaseKeptnEvent, newSLO *keptncommon.SLO) error {
 
 	// this is the default SLO in case none has yet been uploaded
 	dashboardSLO := &keptncommon.ServiceLevelObjectives{
@@ -122,7 +146,7 @@ func addSLO(keptnEvent *common_sli.BaseKeptnEvent, newSLO *keptncommon.SLO) erro
 	}
 
 	// first - lets load the SLO.yaml from the config repo
-	sloContent, err := common_sli.GetKeptnResource(keptnEvent, common_sli.KeptnSLOFilename)
+	sloContent, err := common_sli.GetKeptnResource(ctx, keptnEvent, common_sli.KeptnSLOFilename)
 	if err == nil && sloContent != "" {
 		err := json.Unmarshal([]byte(sloContent), dashboardSLO)
 		if err != nil {
@@ -144,7 +168,7 @@ func addSLO(keptnEvent *common_sli.BaseKeptnEvent, newSLO *keptncommon.SLO) erro
 	if dashboardSLO != nil {
 		yamlAsByteArray, _ := yaml.Marshal(dashboardSLO)
 
-		err := common_sli.UploadKeptnResource(yamlAsByteArray, common_sli.KeptnSLOFilename, keptnEvent)
+		err := common_sli.UploadKeptnResource(ctx, yamlAsByteArray, common_sli.KeptnSLOFilename, keptnEvent)
 		if err != nil {
 			return fmt.Errorf("could not store %s : %v", common_sli.KeptnSLOFilename, err)
 		}
@@ -154,60 +178,102 @@ func addSLO(keptnEvent *common_sli.BaseKeptnEvent, newSLO *keptncommon.SLO) erro
 }
 
 /**
- * Tries to find a dynatrace dashboard that matches our project. If so - returns the SLI, SLO and SLIResults
+ * Tries to find the dynatrace dashboards that match our project. If so - returns the dashboard links, the SLIs and the SLIResults
  */
-func getDataFromDynatraceDashboard(dynatraceHandler *dynatrace.Handler, keptnEvent *common_sli.BaseKeptnEvent, startUnix time.Time, endUnix time.Time, dashboardConfig string) (string, []*keptnv2.SLIResult, error) {
+func getDataFromDynatraceDashboard(dynatraceHandler *dynatrace.Handler, keptnEvent *common_sli.BaseKeptnEvent, startUnix time.Time, endUnix time.Time, dynatraceConfigFile *common_sli.DynatraceConfigFile) ([]string, *dynatrace.SLI, []*keptnv2.SLIResult, error) {
+	logger := logging.FromContext(dynatraceHandler.EventContext)
 
 	//
 	// Option 1: We query the data from a dashboard instead of the uploaded SLI.yaml
 	// ==============================================================================
 	// Lets see if we have a Dashboard in Dynatrace that we should parse
-	dashboardLinkAsLabel, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err := dynatraceHandler.QueryDynatraceDashboardForSLIs(keptnEvent, dashboardConfig, startUnix, endUnix)
+	dashboardLinks, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err := dynatraceHandler.QueryDynatraceDashboardsForSLIs(keptnEvent, dynatraceConfigFile.GetDashboards(), startUnix, endUnix)
 	if err != nil {
-		return dashboardLinkAsLabel, sliResults, fmt.Errorf("could not query Dynatrace dashboard for SLIs: %v", err)
+		return dashboardLinks, dashboardSLI, sliResults, fmt.Errorf("could not query Dynatrace dashboard for SLIs: %v", err)
 	}
 
-	// lets store the dashboard as well
-	if dashboardJSON != nil {
-		jsonAsByteArray, _ := json.MarshalIndent(dashboardJSON, "", "  ")
+	if !dynatraceConfigFile.ShouldUploadResources() {
+		logger.Info("Uploading of generated resources is disabled in dynatrace.conf.yaml")
+	} else {
+		commitMessage := getDashboardCommitMessage(keptnEvent, dashboardJSON)
 
-		err := common_sli.UploadKeptnResource(jsonAsByteArray, common_sli.DynatraceDashboardFilename, keptnEvent)
-		if err != nil {
-			return dashboardLinkAsLabel, sliResults, fmt.Errorf("could not store %s : %v", common_sli.DynatraceDashboardFilename, err)
+		// lets store the dashboard as well
+		if dashboardJSON != nil {
+			jsonAsByteArray, _ := json.MarshalIndent(dashboardJSON, "", "  ")
+
+			err := common_sli.UploadKeptnResourceWithCommitMessage(dynatraceHandler.EventContext, jsonAsByteArray, common_sli.DynatraceDashboardFilename, keptnEvent, commitMessage)
+			if err != nil {
+				return dashboardLinks, dashboardSLI, sliResults, fmt.Errorf("could not store %s : %v", common_sli.DynatraceDashboardFilename, err)
+			}
 		}
-	}
 
-	// lets write the SLI to the config repo
-	if dashboardSLI != nil {
-		yamlAsByteArray, _ := yaml.Marshal(dashboardSLI)
+		// lets keep a snapshot of the dashboard that was used for this evaluation
+		if dashboardJSON != nil && dynatraceConfigFile.KeepDashboardHistory {
+			jsonAsByteArray, _ := json.MarshalIndent(dashboardJSON, "", "  ")
 
-		err := common_sli.UploadKeptnResource(yamlAsByteArray, common_sli.DynatraceSLIFilename, keptnEvent)
-		if err != nil {
-			return dashboardLinkAsLabel, sliResults, fmt.Errorf("could not store %s : %v", common_sli.DynatraceSLIFilename, err)
+			historyFilename := common_sli.GetDashboardHistoryFilename(keptnEvent.Context)
+			err := common_sli.UploadKeptnResourceWithCommitMessage(dynatraceHandler.EventContext, jsonAsByteArray, historyFilename, keptnEvent, commitMessage)
+			if err != nil {
+				// a missing snapshot should not fail the evaluation
+				logger.WithError(err).WithField("resourceURI", historyFilename).Error("Could not store dashboard snapshot")
+			}
 		}
-	}
 
-	// lets write the SLO to the config repo
-	if dashboardSLO != nil {
-		yamlAsByteArray, _ := yaml.Marshal(dashboardSLO)
+		// lets write the SLI to the config repo
+		if dashboardSLI != nil {
+			yamlAsByteArray, _ := yaml.Marshal(dashboardSLI)
 
-		err := common_sli.UploadKeptnResource(yamlAsByteArray, common_sli.KeptnSLOFilename, keptnEvent)
-		if err != nil {
-			return dashboardLinkAsLabel, sliResults, fmt.Errorf("could not store %s : %v", common_sli.KeptnSLOFilename, err)
+			err := common_sli.UploadKeptnResourceWithCommitMessage(dynatraceHandler.EventContext, yamlAsByteArray, common_sli.DynatraceSLIFilename, keptnEvent, commitMessage)
+			if err != nil {
+				return dashboardLinks, dashboardSLI, sliResults, fmt.Errorf("could not store %s : %v", common_sli.DynatraceSLIFilename, err)
+			}
+		}
+
+		// lets write the SLO to the config repo
+		if dashboardSLO != nil {
+			yamlAsByteArray, _ := yaml.Marshal(dashboardSLO)
+
+			err := common_sli.UploadKeptnResourceWithCommitMessage(dynatraceHandler.EventContext, yamlAsByteArray, common_sli.KeptnSLOFilename, keptnEvent, commitMessage)
+			if err != nil {
+				return dashboardLinks, dashboardSLI, sliResults, fmt.Errorf("could not store %s : %v", common_sli.KeptnSLOFilename, err)
+			}
+		}
+
+		// lets also store how each tile was processed
+		if tileReport := dynatraceHandler.GetTileReport(); len(tileReport) > 0 {
+			yamlAsByteArray, _ := yaml.Marshal(tileReport)
+
+			err := common_sli.UploadKeptnResourceWithCommitMessage(dynatraceHandler.EventContext, yamlAsByteArray, common_sli.DynatraceTileReportFilename, keptnEvent, commitMessage)
+			if err != nil {
+				// a missing report should not fail the evaluation
+				logger.WithError(err).WithField("resourceURI", common_sli.DynatraceTileReportFilename).Error("Could not store tile report")
+			}
 		}
 	}
 
 	// lets also write the result to a local file in local test mode
 	if sliResults != nil {
 		if common_sli.RunLocal || common_sli.RunLocalTest {
-			log.Info("(RunLocal Output) Write SLIResult to sliresult.json")
+			logger.Info("(RunLocal Output) Write SLIResult to sliresult.json")
 			jsonAsByteArray, _ := json.MarshalIndent(sliResults, "", "  ")
 
-			common_sli.UploadKeptnResource(jsonAsByteArray, "sliresult.json", keptnEvent)
+			common_sli.UploadKeptnResource(dynatraceHandler.EventContext, jsonAsByteArray, "sliresult.json", keptnEvent)
 		}
 	}
 
-	return dashboardLinkAsLabel, sliResults, nil
+	return dashboardLinks, dashboardSLI, sliResults, nil
+}
+
+/**
+ * Returns the commit message used when storing resources generated from a dashboard, e.g:
+ * Dynatrace dashboard 311f4aa7-5257-41d7-abd1-70420500e1c8 (version 3.2) parsed for keptnContext 1234
+ */
+func getDashboardCommitMessage(keptnEvent *common_sli.BaseKeptnEvent, dashboardJSON *dynatrace.DynatraceDashboard) string {
+	if dashboardJSON == nil {
+		return fmt.Sprintf("Dynatrace dashboard parsed for keptnContext %s", keptnEvent.Context)
+	}
+
+	return fmt.Sprintf("Dynatrace dashboard %s (version %s) parsed for keptnContext %s", dashboardJSON.ID, dashboardJSON.GetConfigurationVersion(), keptnEvent.Context)
 }
 
 /**
@@ -243,22 +309,27 @@ func getDynatraceProblemContext(eventData *keptnv2.GetSLITriggeredEventData) str
  * First tries to find a Dynatrace dashboard and then parses it for SLIs and SLOs
  * Second will go to parse the SLI.yaml and returns the SLI as passed in by the event
  */
-func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggeredEventData) error {
+func retrieveMetrics(ctx context.Context, event cloudevents.Event, eventData *keptnv2.GetSLITriggeredEventData) (err error) {
+	logger := logging.FromContext(ctx)
 	// extract keptn context id
 	var shkeptncontext string
 	event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
 
+	// trace the retrieval of the SLIs with the project, stage and service of the evaluation
+	ctx, span := tracing.StartSpan(ctx, "retrieve SLIs",
+		tracing.Attr("keptn.project", eventData.Project),
+		tracing.Attr("keptn.stage", eventData.Stage),
+		tracing.Attr("keptn.service", eventData.Service))
+	defer func() {
+		span.End(err)
+	}()
+
 	// send get-sli.started event
-	if err := sendGetSLIStartedEvent(event, eventData); err != nil {
-		return sendGetSLIFinishedEvent(event, eventData, nil, err)
+	if err := sendGetSLIStartedEvent(ctx, event, eventData); err != nil {
+		return finishGetSLI(ctx, event, eventData, nil, err)
 	}
 
-	log.WithFields(
-		log.Fields{
-			"project": eventData.Project,
-			"stage":   eventData.Stage,
-			"service": eventData.Service,
-		}).Info("Processing sh.keptn.internal.event.get-sli")
+	logger.Info("Processing sh.keptn.internal.event.get-sli")
 
 	keptnEvent := &common_sli.BaseKeptnEvent{}
 	keptnEvent.Project = eventData.Project
@@ -268,7 +339,10 @@ func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggered
 	keptnEvent.Deployment = eventData.Deployment
 	keptnEvent.Context = shkeptncontext
 
-	dynatraceConfigFile := common_sli.GetDynatraceConfig(keptnEvent)
+	_, configSpan := tracing.StartSpan(ctx, "get dynatrace.conf.yaml")
+	dynatraceConfigFile := common_sli.GetDynatraceConfig(ctx, keptnEvent)
+	configSpan.SetAttribute("dynatrace.dt_creds", dynatraceConfigFile.DtCreds)
+	configSpan.End(nil)
 
 	// Adding DtCreds as a label so users know which DtCreds was used
 	if eventData.Labels == nil {
@@ -276,11 +350,11 @@ func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggered
 	}
 	eventData.Labels["DtCreds"] = dynatraceConfigFile.DtCreds
 
-	dtCredentials, err := getDynatraceCredentials(dynatraceConfigFile.DtCreds, eventData.Project)
+	dtCredentials, err := getDynatraceCredentials(ctx, dynatraceConfigFile.DtCreds, eventData.Project, eventData.Stage)
 	if err != nil {
-		log.WithError(err).Error("Failed to fetch Dynatrace credentials")
+		logger.WithError(err).Error("Failed to fetch Dynatrace credentials")
 		// Implementing: https://github.com/keptn-contrib/dynatrace-sli-service/issues/49
-		return sendGetSLIFinishedEvent(event, eventData, nil, err)
+		return finishGetSLI(ctx, event, eventData, nil, err)
 	}
 
 	//
@@ -293,13 +367,37 @@ func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggered
 			"User-Agent":    "keptn-contrib/dynatrace-service:" + os.Getenv("version"),
 		},
 		eventData.GetSLI.CustomFilters, shkeptncontext, event.ID())
+	tlsConfig, err := dtCredentials.NewTLSConfig(!dynatrace.IsHttpSSLVerificationEnabled())
+	if err != nil {
+		logger.WithError(err).Error("Failed to configure the TLS client of the Dynatrace API")
+		return finishGetSLI(ctx, event, eventData, nil, err)
+	}
+	dynatraceHandler.UseTLSConfig(tlsConfig)
+	dynatraceHandler.EventContext = ctx
+	dynatraceHandler.ForceDashboardParsing = common_sli.IsDashboardParsingForced(&dynatraceConfigFile, keptnEvent)
+	dynatraceHandler.UnitScalingRules = dynatraceConfigFile.UnitScaling
+	dynatraceHandler.DetectMetricUnits = dynatraceConfigFile.ShouldDetectMetricUnits()
+	dynatraceHandler.ManagementZone = dynatraceConfigFile.ManagementZone
+	dynatraceHandler.PlatformURL = dtCredentials.PlatformURL
+	dynatraceHandler.PlatformToken = dtCredentials.PlatformToken
+	dynatraceHandler.WaitForDataTimeout, err = dynatraceConfigFile.GetWaitForData()
+	if err != nil {
+		logger.WithError(err).Error("Invalid waitForData in dynatrace.conf.yaml")
+		return finishGetSLI(ctx, event, eventData, nil, err)
+	}
 
 	//
 	// parse start and end (which are datetime strings) and convert them into unix timestamps
-	startUnix, endUnix, err := ensureRightTimestamps(eventData.GetSLI.Start, eventData.GetSLI.End)
+	timeframeShift, err := dynatraceConfigFile.GetTimeframeShift()
+	if err != nil {
+		logger.WithError(err).Error("Invalid timeframeShift in dynatrace.conf.yaml")
+		return finishGetSLI(ctx, event, eventData, nil, err)
+	}
+
+	startUnix, endUnix, err := ensureRightTimestamps(ctx, eventData.GetSLI.Start, eventData.GetSLI.End, timeframeShift)
 	if err != nil {
-		log.WithError(err).Error("ensureRightTimestamps failed")
-		return sendGetSLIFinishedEvent(event, eventData, nil, err)
+		logger.WithError(err).Error("ensureRightTimestamps failed")
+		return finishGetSLI(ctx, event, eventData, nil, err)
 	}
 
 	//
@@ -309,25 +407,45 @@ func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggered
 
 	//
 	// Option 1 - see if we can get the data from a Dnatrace Dashboard
-	dashboardLinkAsLabel, sliResults, err := getDataFromDynatraceDashboard(dynatraceHandler, keptnEvent, startUnix, endUnix, dynatraceConfigFile.Dashboard)
+	endDashboardSpan := dynatraceHandler.StartSpan("query dashboard", tracing.Attr("dynatrace.dashboard", dynatraceConfigFile.Dashboard))
+	dashboardLinks, dashboardSLI, sliResults, err := getDataFromDynatraceDashboard(dynatraceHandler, keptnEvent, startUnix, endUnix, &dynatraceConfigFile)
+	endDashboardSpan(err)
 	if err != nil {
 		// log the error, but continue with loading sli.yaml
-		log.WithError(err).Error("getDataFromDynatraceDashboard failed")
+		logger.WithError(err).Error("getDataFromDynatraceDashboard failed")
 	}
 
-	// add link to dynatrace dashboard to labels
-	if dashboardLinkAsLabel != "" {
+	// add a summary of the processed dashboard tiles to the event message
+	if tileReportSummary := dynatrace.GetTileReportSummary(dynatraceHandler.GetTileReport()); tileReportSummary != "" {
+		logger.Info(tileReportSummary)
+		eventData.Message = tileReportSummary
+	}
+
+	// add links to dynatrace dashboards to labels - additional dashboards are numbered, e.g: Dashboard Link 2
+	for i, dashboardLink := range dashboardLinks {
 		if eventData.Labels == nil {
 			eventData.Labels = make(map[string]string)
 		}
-		eventData.Labels["Dashboard Link"] = dashboardLinkAsLabel
+		if i == 0 {
+			eventData.Labels["Dashboard Link"] = dashboardLink
+		} else {
+			eventData.Labels[fmt.Sprintf("Dashboard Link %d", i+1)] = dashboardLink
+		}
+	}
+
+	// the queries of the SLIs by their name for the export of the SLI results
+	sliQueries := map[string]string{}
+	sliExecutedQueries := map[string][]string{}
+	if sliResults != nil && dashboardSLI != nil {
+		sliQueries = dashboardSLI.Indicators
+		sliExecutedQueries = dynatraceHandler.GetDashboardExecutedQueries()
 	}
 
 	//
 	// Option 2: If we have not received any data via a Dynatrace Dashboard lets query the SLIs based on the SLI.yaml definition
 	if sliResults == nil {
 		// get custom metrics for project if they exist
-		projectCustomQueries, _ := common_sli.GetCustomQueries(keptnEvent)
+		projectCustomQueries, _ := common_sli.GetCustomQueries(ctx, keptnEvent)
 
 		// set our list of queries on the handler
 		if projectCustomQueries != nil {
@@ -335,34 +453,10 @@ func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggered
 		}
 
 		// query all indicators
-		for _, indicator := range eventData.GetSLI.Indicators {
-			if strings.Compare(indicator, ProblemOpenSLI) == 0 {
-				log.WithField("indicator", indicator).Info("Skipping indicator as it is handled later")
-			} else {
-				log.WithField("indicator", indicator).Info("Fetching indicator")
-				sliValue, err := dynatraceHandler.GetSLIValue(indicator, startUnix, endUnix)
-				if err != nil {
-					log.WithError(err).Error("GetSLIValue failed")
-					// failed to fetch metric
-					sliResults = append(sliResults, &keptnv2.SLIResult{
-						Metric:  indicator,
-						Value:   0,
-						Success: false, // Mark as failure
-						Message: err.Error(),
-					})
-				} else {
-					// successfully fetched metric
-					sliResults = append(sliResults, &keptnv2.SLIResult{
-						Metric:  indicator,
-						Value:   sliValue,
-						Success: true, // mark as success
-					})
-				}
-			}
-		}
+		sliResults = queryIndicators(ctx, dynatraceHandler, eventData.GetSLI.Indicators, startUnix, endUnix, sliQueries, sliExecutedQueries)
 
 		if common_sli.RunLocal || common_sli.RunLocalTest {
-			log.WithField("sliResults", sliResults).Print("(RunLocal Output) sliResults")
+			logger.WithField("sliResults", sliResults).Print("(RunLocal Output) sliResults")
 			return nil
 		}
 	}
@@ -409,7 +503,7 @@ func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggered
 			Pass:    passSLOs,
 			Warning: warningSLOs,
 		}
-		addSLO(keptnEvent, sloDefinition)
+		addSLO(ctx, keptnEvent, sloDefinition)
 	}
 
 	// now - lets see if we have captured any result values - if not - return send an error
@@ -418,33 +512,52 @@ func retrieveMetrics(event cloudevents.Event, eventData *keptnv2.GetSLITriggered
 		err = errors.New("Couldn't retrieve any SLI Results")
 	}
 
-	log.Info("Finished fetching metrics; Sending SLIDone event now ...")
+	// optionally store the SLI results for external reporting tools
+	if len(dynatraceConfigFile.ExportSLIResults) > 0 && sliResults != nil {
+		export := newSLIResultsExport(keptnEvent, eventData, dashboardLinks, sliResults, sliQueries, sliExecutedQueries)
+		storeSLIResultsExport(ctx, keptnEvent, dynatraceConfigFile.ExportSLIResults, dynatraceConfigFile.GetSLIResultsExportRetention(), export)
+	}
+
+	// optionally push the SLI values to Dynatrace so they can be charted across builds
+	if dynatraceConfigFile.PushSLIMetrics && sliResults != nil {
+		if ingestErr := dynatraceHandler.IngestSLIMetrics(sliResults, endUnix); ingestErr != nil {
+			// log the error, but don't fail the evaluation
+			logger.WithError(ingestErr).Error("Failed to push SLI values to Dynatrace")
+		}
+	}
+
+	logger.Info("Finished fetching metrics; Sending SLIDone event now ...")
 
-	return sendGetSLIFinishedEvent(event, eventData, sliResults, err)
+	return finishGetSLI(ctx, event, eventData, sliResults, err)
 }
 
 /**
  * returns the DTCredentials
  * First looks at the passed secretName. If null, validates if there is a dynatrace-credentials-%PROJECT% - if not - defaults to "dynatrace" global secret
+ * If no dtCreds are configured (secretName is the default "dynatrace"), the secret dynatrace-%PROJECT%-%STAGE% of the stage is looked up first
  */
-func getDynatraceCredentials(secretName string, project string) (*common_sli.DTCredentials, error) {
+func getDynatraceCredentials(ctx context.Context, secretName string, project string, stage string) (*credentials.DTCredentials, error) {
 
 	secretNames := []string{secretName, fmt.Sprintf("dynatrace-credentials-%s", project), "dynatrace-credentials", "dynatrace"}
+	if secretName == "dynatrace" && project != "" && stage != "" {
+		secretNames = append([]string{credentials.GetStageSecretName(project, stage)}, secretNames...)
+	}
 
 	for _, secret := range secretNames {
 		if secret == "" {
 			continue
 		}
 
-		dtCredentials, err := common_sli.GetDTCredentials(secret)
+		// the shared credential manager is used, so that e.g. the Vault token and the cached secrets are reused across evaluations
+		dtCredentials, err := credentials.GetDynatraceCredentials(&config.DynatraceConfigFile{DtCreds: secret})
 		if err == nil && dtCredentials != nil {
 
-			log.WithFields(
+			logging.FromContext(ctx).WithFields(
 				log.Fields{
 					"secret": secret,
 					"tenant": dtCredentials.Tenant,
 				}).Info("Found secret with credentials")
-			return dtCredentials, nil
+			return dtCredentials.ForSLI(), nil
 		}
 	}
 
@@ -452,11 +565,83 @@ func getDynatraceCredentials(secretName string, project string) (*common_sli.DTC
 }
 
 /**
- * Sends the SLI Done Event. If err != nil it will send an error message
+ * Queries the indicators of the sli.yaml one after another - an indicator that can't be retrieved is reported as failed SLI result,
+ * so that the other indicators are still evaluated. The queries of the indicators are added to sliQueries and sliExecutedQueries
+ */
+func queryIndicators(ctx context.Context, dynatraceHandler *dynatrace.Handler, indicators []string, startUnix time.Time, endUnix time.Time, sliQueries map[string]string, sliExecutedQueries map[string][]string) []*keptnv2.SLIResult {
+	logger := logging.FromContext(ctx)
+	var sliResults []*keptnv2.SLIResult
+	for _, indicator := range indicators {
+		if strings.Compare(indicator, ProblemOpenSLI) == 0 {
+			logger.WithField("indicator", indicator).Info("Skipping indicator as it is handled later")
+			continue
+		}
+
+		logger.WithField("indicator", indicator).Info("Fetching indicator")
+		dynatraceHandler.ResetExecutedQueries()
+		sliValue, err := getSLIValue(dynatraceHandler, indicator, startUnix, endUnix)
+		executedQueries := dynatraceHandler.GetExecutedQueries()
+		sliQueries[indicator] = dynatraceHandler.GetSLIQuery(indicator)
+		sliExecutedQueries[indicator] = executedQueries
+		deepLink := dynatraceHandler.GetSLIDeepLink(indicator, startUnix, endUnix)
+		if err != nil {
+			logger.WithError(err).WithField("indicator", indicator).Error("GetSLIValue failed")
+			// failed to fetch metric
+			sliResults = append(sliResults, &keptnv2.SLIResult{
+				Metric:  indicator,
+				Value:   0,
+				Success: false, // Mark as failure
+				Message: dynatrace.AppendQueriesToMessage(dynatrace.AppendDeepLinkToMessage(err.Error(), deepLink), executedQueries),
+			})
+		} else {
+			// successfully fetched metric
+			sliResults = append(sliResults, &keptnv2.SLIResult{
+				Metric:  indicator,
+				Value:   sliValue,
+				Success: true, // mark as success
+				Message: dynatrace.AppendQueriesToMessage(dynatrace.AppendDeepLinkToMessage("", deepLink), executedQueries),
+			})
+		}
+	}
+	return sliResults
+}
+
+// querySLIValue queries the value of a single SLI - it is a variable so that it can be replaced in tests
+var querySLIValue = func(dynatraceHandler *dynatrace.Handler, indicator string, startUnix time.Time, endUnix time.Time) (float64, error) {
+	return dynatraceHandler.GetSLIValue(indicator, startUnix, endUnix)
+}
+
+/**
+ * Queries a single SLI and records the duration and the outcome of the query in the metrics and the trace of the event.
+ * A panic while processing the indicator, e.g. because of an unexpected result of the Dynatrace API, is returned as error of this indicator
  */
-func sendGetSLIFinishedEvent(inputEvent cloudevents.Event, eventData *keptnv2.GetSLITriggeredEventData, indicatorValues []*keptnv2.SLIResult, err error) error {
+func getSLIValue(dynatraceHandler *dynatrace.Handler, indicator string, startUnix time.Time, endUnix time.Time) (value float64, err error) {
+	start := time.Now()
+	endSpan := dynatraceHandler.StartSpan("query SLI", tracing.Attr("keptn.sli", indicator))
+	defer func() {
+		if r := recover(); r != nil {
+			value = 0
+			err = fmt.Errorf("unexpected error while processing the result for indicator %s: %v", indicator, r)
+		}
+		metrics.ObserveSLIQuery(time.Since(start), err)
+		endSpan(err)
+	}()
+
+	return querySLIValue(dynatraceHandler, indicator, startUnix, endUnix)
+}
 
-	source, _ := url.Parse("dynatrace-service")
+// finishGetSLI sends the get-sli.finished event and returns err afterwards, so that an evaluation without SLIs is stored as dead letter and can be triggered again
+func finishGetSLI(ctx context.Context, inputEvent cloudevents.Event, eventData *keptnv2.GetSLITriggeredEventData, indicatorValues []*keptnv2.SLIResult, err error) error {
+	if sendErr := sendGetSLIFinishedEvent(ctx, inputEvent, eventData, indicatorValues, err); sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+/**
+ * Sends the SLI Done Event. If err != nil it will send an error message
+ */
+func sendGetSLIFinishedEvent(ctx context.Context, inputEvent cloudevents.Event, eventData *keptnv2.GetSLITriggeredEventData, indicatorValues []*keptnv2.SLIResult, err error) error {
 
 	// if an error was set - the indicators will be set to failed and error message is set to each
 	if err != nil {
@@ -468,12 +653,10 @@ func sendGetSLIFinishedEvent(inputEvent cloudevents.Event, eventData *keptnv2.Ge
 			}
 
 			for _, indicatorName := range eventData.GetSLI.Indicators {
-				indicatorValues = []*keptnv2.SLIResult{
-					{
-						Metric: indicatorName,
-						Value:  0.0,
-					},
-				}
+				indicatorValues = append(indicatorValues, &keptnv2.SLIResult{
+					Metric: indicatorName,
+					Value:  0.0,
+				})
 			}
 		}
 
@@ -491,6 +674,7 @@ func sendGetSLIFinishedEvent(inputEvent cloudevents.Event, eventData *keptnv2.Ge
 			Labels:  eventData.Labels,
 			Status:  keptnv2.StatusSucceeded,
 			Result:  keptnv2.ResultPass,
+			Message: eventData.Message,
 		},
 
 		GetSLI: keptnv2.GetSLIFinished{
@@ -500,26 +684,14 @@ func sendGetSLIFinishedEvent(inputEvent cloudevents.Event, eventData *keptnv2.Ge
 		},
 	}
 
-	keptnContext, err := inputEvent.Context.GetExtension("shkeptncontext")
-
+	event, err := keptnevents.NewEvent(inputEvent, keptnv2.GetFinishedEventType(keptnv2.GetSLITaskName), getSLIEvent)
 	if err != nil {
-		return fmt.Errorf("could not determine keptnContext of input event: %s", err.Error())
+		return err
 	}
-
-	event := cloudevents.NewEvent()
-	event.SetType(keptnv2.GetFinishedEventType(keptnv2.GetSLITaskName))
-	event.SetSource(source.String())
-	event.SetDataContentType(cloudevents.ApplicationJSON)
-	event.SetExtension("shkeptncontext", keptnContext)
-	event.SetExtension("triggeredid", inputEvent.ID())
-	event.SetData(cloudevents.ApplicationJSON, getSLIEvent)
-
-	return sendEvent(event)
+	return keptnevents.Send(ctx, event)
 }
 
-func sendGetSLIStartedEvent(inputEvent cloudevents.Event, eventData *keptnv2.GetSLITriggeredEventData) error {
-
-	source, _ := url.Parse("dynatrace-service")
+func sendGetSLIStartedEvent(ctx context.Context, inputEvent cloudevents.Event, eventData *keptnv2.GetSLITriggeredEventData) error {
 
 	getSLIStartedEvent := keptnv2.GetSLIStartedEventData{
 		EventData: keptnv2.EventData{
@@ -532,34 +704,9 @@ func sendGetSLIStartedEvent(inputEvent cloudevents.Event, eventData *keptnv2.Get
 		},
 	}
 
-	keptnContext, err := inputEvent.Context.GetExtension("shkeptncontext")
-
-	if err != nil {
-		return fmt.Errorf("could not determine keptnContext of input event: %s", err.Error())
-	}
-
-	event := cloudevents.NewEvent()
-	event.SetType(keptnv2.GetStartedEventType(keptnv2.GetSLITaskName))
-	event.SetSource(source.String())
-	event.SetDataContentType(cloudevents.ApplicationJSON)
-	event.SetExtension("shkeptncontext", keptnContext)
-	event.SetExtension("triggeredid", inputEvent.ID())
-	event.SetData(cloudevents.ApplicationJSON, getSLIStartedEvent)
-
-	return sendEvent(event)
-}
-
-/**
- * sends cloud event back to keptn
- */
-func sendEvent(event cloudevents.Event) error {
-
-	keptnHandler, err := keptnv2.NewKeptn(&event, keptn.KeptnOpts{})
+	event, err := keptnevents.NewEvent(inputEvent, keptnv2.GetStartedEventType(keptnv2.GetSLITaskName), getSLIStartedEvent)
 	if err != nil {
 		return err
 	}
-
-	_ = keptnHandler.SendCloudEvent(event)
-
-	return nil
+	return keptnevents.Send(ctx, event)
 }
@@ -0,0 +1,143 @@
+package event_handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/keptnevents"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib/dynatrace"
+)
+
+type countingSecretReader struct {
+	secrets map[string]map[string]string
+	reads   int
+}
+
+func (r *countingSecretReader) ReadSecret(secretName, namespace, secretKey string) (string, error) {
+	r.reads++
+	value, ok := r.secrets[secretName][secretKey]
+	if !ok {
+		return "", credentials.ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func TestGetDynatraceCredentialsUsesDefaultCredentialManager(t *testing.T) {
+	secretReader := &countingSecretReader{
+		secrets: map[string]map[string]string{
+			"dynatrace": {"DT_TENANT": "abc12345.live.dynatrace.com", "DT_API_TOKEN": "api-token"},
+		},
+	}
+	cm, err := credentials.NewCredentialManager(secretReader)
+	if err != nil {
+		t.Fatalf("NewCredentialManager() error = %v", err)
+	}
+	credentials.SetDefaultCredentialManager(cm)
+	defer credentials.SetDefaultCredentialManager(nil)
+
+	// each event has to read the secrets with the shared CredentialManager instead of building a new one
+	for i := 0; i < 2; i++ {
+		readsBefore := secretReader.reads
+		dtCredentials, err := getDynatraceCredentials(context.Background(), "dynatrace", "sockshop", "dev")
+		if err != nil {
+			t.Fatalf("getDynatraceCredentials() error = %v", err)
+		}
+		if dtCredentials.Tenant != "https://abc12345.live.dynatrace.com" {
+			t.Errorf("getDynatraceCredentials() tenant = %s, want https://abc12345.live.dynatrace.com", dtCredentials.Tenant)
+		}
+		if secretReader.reads == readsBefore {
+			t.Errorf("getDynatraceCredentials() didn't read the secrets with the default CredentialManager")
+		}
+	}
+}
+
+func TestFinishGetSLI(t *testing.T) {
+	sender := &fake.EventSender{}
+	keptnevents.SetSender(sender)
+
+	triggeredEvent := cloudevents.NewEvent()
+	triggeredEvent.SetID("get-sli-triggered-id")
+	triggeredEvent.SetType(keptnv2.GetTriggeredEventType(keptnv2.GetSLITaskName))
+	triggeredEvent.SetSource("lighthouse-service")
+	triggeredEvent.SetExtension("shkeptncontext", "my-keptn-context")
+	eventData := &keptnv2.GetSLITriggeredEventData{
+		EventData: keptnv2.EventData{Project: "sockshop", Stage: "dev", Service: "carts"},
+		GetSLI:    keptnv2.GetSLI{SLIProvider: "dynatrace", Indicators: []string{"response_time_p95"}},
+	}
+
+	// the failure is returned after the failed finished event has been sent, so that the event is stored as dead letter
+	failure := errors.New("could not find any Dynatrace specific secrets")
+	if err := finishGetSLI(context.Background(), triggeredEvent, eventData, nil, failure); err != failure {
+		t.Errorf("finishGetSLI() error = %v, want %v", err, failure)
+	}
+	if err := sender.AssertSentEventTypes([]string{keptnv2.GetFinishedEventType(keptnv2.GetSLITaskName)}); err != nil {
+		t.Fatalf("finishGetSLI() %v", err)
+	}
+	finishedData := &keptnv2.GetSLIFinishedEventData{}
+	if err := sender.SentEvents[0].DataAs(finishedData); err != nil {
+		t.Fatalf("could not parse get-sli.finished event: %v", err)
+	}
+	if len(finishedData.GetSLI.IndicatorValues) != 1 || finishedData.GetSLI.IndicatorValues[0].Success {
+		t.Errorf("finishGetSLI() sent indicator values %v, want a failed response_time_p95", finishedData.GetSLI.IndicatorValues)
+	}
+
+	sender.SentEvents = nil
+	if err := finishGetSLI(context.Background(), triggeredEvent, eventData, []*keptnv2.SLIResult{{Metric: "response_time_p95", Value: 250, Success: true}}, nil); err != nil {
+		t.Errorf("finishGetSLI() error = %v, want nil", err)
+	}
+}
+
+func TestQueryIndicators_RecoversFromPanicOfSingleIndicator(t *testing.T) {
+	querySLIValueOrig := querySLIValue
+	defer func() { querySLIValue = querySLIValueOrig }()
+
+	querySLIValue = func(dynatraceHandler *dynatrace.Handler, indicator string, startUnix time.Time, endUnix time.Time) (float64, error) {
+		switch indicator {
+		case "throughput":
+			var dataPoints []float64
+			return dataPoints[0], nil
+		case "error_rate":
+			return 0, errors.New("no result values")
+		default:
+			return 250, nil
+		}
+	}
+
+	dynatraceHandler := dynatrace.NewDynatraceHandler("https://mytenant.live.dynatrace.com", &common_sli.BaseKeptnEvent{}, nil, nil, "", "")
+	dynatraceHandler.EventContext = context.Background()
+
+	indicators := []string{"response_time_p95", "throughput", ProblemOpenSLI, "error_rate", "response_time_p50"}
+	sliResults := queryIndicators(context.Background(), dynatraceHandler, indicators, time.Now().Add(-5*time.Minute), time.Now(), map[string]string{}, map[string][]string{})
+
+	want := []struct {
+		metric  string
+		value   float64
+		success bool
+	}{
+		{metric: "response_time_p95", value: 250, success: true},
+		{metric: "throughput", value: 0, success: false},
+		{metric: "error_rate", value: 0, success: false},
+		{metric: "response_time_p50", value: 250, success: true},
+	}
+	if len(sliResults) != len(want) {
+		t.Fatalf("queryIndicators() returned %d results, want %d", len(sliResults), len(want))
+	}
+	for i, w := range want {
+		got := sliResults[i]
+		if got.Metric != w.metric || got.Value != w.value || got.Success != w.success {
+			t.Errorf("queryIndicators() result %d = {%s %v %v}, want {%s %v %v}", i, got.Metric, got.Value, got.Success, w.metric, w.value, w.success)
+		}
+	}
+	if !strings.Contains(sliResults[1].Message, "unexpected error while processing the result for indicator throughput") {
+		t.Errorf("queryIndicators() message of the panicking indicator = %q", sliResults[1].Message)
+	}
+}
@@ -1,36 +1,53 @@
 package event_handler
 
 import (
+	"context"
+
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 	keptnevents "github.com/keptn/go-utils/pkg/lib"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
-	log "github.com/sirupsen/logrus"
 )
 
 type DynatraceEventHandler interface {
 	HandleEvent() error
 }
 
-func NewEventHandler(event cloudevents.Event) (DynatraceEventHandler, error) {
-	log.WithField("eventType", event.Type()).Debug("Received event")
-	dtConfigGetter := &adapter.DynatraceConfigGetter{}
+// rejectableEventHandler is implemented by event handlers that have to respond to an event they can't process, so that Keptn doesn't wait for it
+type rejectableEventHandler interface {
+	RejectEvent(reason error) error
+}
+
+// RejectEvent responds to an event that won't be processed, e.g. because the service is overloaded, if Keptn is waiting for a response
+func RejectEvent(eh DynatraceEventHandler, reason error) error {
+	if rejectable, ok := eh.(rejectableEventHandler); ok {
+		return rejectable.RejectEvent(reason)
+	}
+	return nil
+}
+
+func NewEventHandler(ctx context.Context, event cloudevents.Event) (DynatraceEventHandler, error) {
+	logging.FromContext(ctx).Debug("Received event")
+	dtConfigGetter := &adapter.DynatraceConfigGetter{EventContext: ctx}
 	switch event.Type() {
 	case keptnevents.ConfigureMonitoringEventType:
-		return &ConfigureMonitoringEventHandler{Event: event, dtConfigGetter: dtConfigGetter}, nil
+		return &ConfigureMonitoringEventHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
 	case keptnv2.GetFinishedEventType(keptnv2.ProjectCreateTaskName):
-		return &CreateProjectEventHandler{Event: event, dtConfigGetter: dtConfigGetter}, nil
+		return &CreateProjectEventHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
+	case keptnv2.GetFinishedEventType(keptnv2.ProjectDeleteTaskName):
+		return &DeleteProjectEventHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
 	case keptnevents.ProblemEventType:
-		return &ProblemEventHandler{Event: event}, nil
+		return &ProblemEventHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
 	case keptnv2.GetTriggeredEventType(keptnv2.ActionTaskName):
-		return &ActionHandler{Event: event, dtConfigGetter: dtConfigGetter}, nil
+		return &ActionHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
 	case keptnv2.GetStartedEventType(keptnv2.ActionTaskName):
-		return &ActionHandler{Event: event, dtConfigGetter: dtConfigGetter}, nil
+		return &ActionHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
 	case keptnv2.GetFinishedEventType(keptnv2.ActionTaskName):
-		return &ActionHandler{Event: event, dtConfigGetter: dtConfigGetter}, nil
+		return &ActionHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
 	case keptnv2.GetTriggeredEventType(keptnv2.GetSLITaskName):
-		return &GetSLIEventHandler{event: event, dtConfigGetter: dtConfigGetter}, nil
+		return &GetSLIEventHandler{ctx: ctx, event: event, dtConfigGetter: dtConfigGetter}, nil
 	default:
-		return &CDEventHandler{Event: event, dtConfigGetter: dtConfigGetter}, nil
+		return &CDEventHandler{ctx: ctx, Event: event, dtConfigGetter: dtConfigGetter}, nil
 	}
 }
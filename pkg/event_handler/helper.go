@@ -1,8 +1,23 @@
 package event_handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	log "github.com/sirupsen/logrus"
+
 	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
 	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 )
 
 type dtConfigurationEvent struct {
@@ -25,8 +40,8 @@ type dtDeploymentEvent struct {
 	DeploymentVersion string            `json:"deploymentVersion"`
 	DeploymentName    string            `json:"deploymentName"`
 	DeploymentProject string            `json:"deploymentProject"`
-	CiBackLink        string            `json:"ciBackLink",omitempty`
-	RemediationAction string            `json:"remediationAction",omitempty`
+	CiBackLink        string            `json:"ciBackLink,omitempty"`
+	RemediationAction string            `json:"remediationAction,omitempty"`
 }
 
 type dtInfoEvent struct {
@@ -85,10 +100,112 @@ func createAttachRules(a adapter.EventContentAdapter, dynatraceConfig *config.Dy
 	return ar
 }
 
+// entitySelectorTypeRegex finds the entity type of an entity selector, e.g: SERVICE for type(SERVICE),tag("keptn_service:carts")
+var entitySelectorTypeRegex = regexp.MustCompile(`type\("?([A-Za-z_]+)"?\)`)
+
+/**
+ * Restricts the attachRules to the entity types configured for the event type in eventMeTypes of dynatrace.conf.yaml, e.g: only SERVICE for CUSTOM_DEPLOYMENT events
+ * Tag rules keep only these types and are dropped if none is left, entity IDs are filtered by their type prefix, e.g: SERVICE-1234567890ABCDEF
+ * The entitySelector is dropped if it selects another entity type
+ */
+func restrictAttachRulesToMeTypes(ctx context.Context, attachRules config.DtAttachRules, dynatraceConfig *config.DynatraceConfigFile, eventType string) config.DtAttachRules {
+	if dynatraceConfig == nil {
+		return attachRules
+	}
+	meTypes, ok := dynatraceConfig.EventMeTypes[eventType]
+	if !ok {
+		return attachRules
+	}
+
+	restricted := config.DtAttachRules{}
+	if match := entitySelectorTypeRegex.FindStringSubmatch(attachRules.EntitySelector); match == nil || containsString(meTypes, match[1]) {
+		restricted.EntitySelector = attachRules.EntitySelector
+	}
+	for _, tagRule := range attachRules.TagRule {
+		var ruleMeTypes []string
+		for _, meType := range tagRule.MeTypes {
+			if containsString(meTypes, meType) {
+				ruleMeTypes = append(ruleMeTypes, meType)
+			}
+		}
+		if len(ruleMeTypes) > 0 {
+			restricted.TagRule = append(restricted.TagRule, config.DtTagRule{MeTypes: ruleMeTypes, Tags: tagRule.Tags})
+		}
+	}
+	for _, entityID := range attachRules.EntityIds {
+		for _, meType := range meTypes {
+			if strings.HasPrefix(entityID, meType+"-") {
+				restricted.EntityIds = append(restricted.EntityIds, entityID)
+				break
+			}
+		}
+	}
+
+	if len(restricted.TagRule) == 0 && len(restricted.EntityIds) == 0 && restricted.EntitySelector == "" {
+		logging.FromContext(ctx).WithFields(
+			log.Fields{
+				"eventType": eventType,
+				"meTypes":   meTypes,
+			}).Warn("No attachRules are left for the entity types of the event type - the Dynatrace event will not be attached to any entity")
+	}
+	return restricted
+}
+
+/**
+ * Checks the attachRules in dynatrace.conf.yaml - if they don't match any entity, a warning with the evaluated rules is logged and returned,
+ * so that it can be added to the finished event of a task, as the events would silently land nowhere.
+ * The entitySelector of the attachRules is resolved to entity IDs when an event is sent
+ */
+func prepareAttachRules(dtHelper *lib.DynatraceHelper, a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) (string, error) {
+	// no requests are sent to Dynatrace when running locally
+	if common.RunLocal || common.RunLocalTest {
+		return "", nil
+	}
+
+	attachRules := createAttachRules(a, dynatraceConfig)
+	if len(attachRules.EntityIds) > 0 {
+		return "", nil
+	}
+
+	selectors := lib.GetAttachRuleSelectors(attachRules)
+	if attachRules.EntitySelector != "" {
+		selectors = append([]string{attachRules.EntitySelector}, selectors...)
+	}
+	for _, selector := range selectors {
+		count, err := dtHelper.GetEntityCount(selector)
+		if err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return "", nil
+		}
+	}
+
+	logging.FromContext(dtHelper.EventContext).WithFields(
+		log.Fields{
+			"project":        a.GetProject(),
+			"stage":          a.GetStage(),
+			"service":        a.GetService(),
+			"event":          a.GetEvent(),
+			"entitySelector": attachRulesEntitySelector(dynatraceConfig),
+			"tagRules":       strings.Join(selectors, " OR "),
+		}).Warn("No Dynatrace entity matches the attachRules - the Dynatrace event will not be attached to any entity")
+	return fmt.Sprintf("No Dynatrace entity matches the attachRules %s - the Dynatrace event is not attached to any entity", strings.Join(selectors, " OR ")), nil
+}
+
+// attachRulesEntitySelector returns the entity selector of the attachRules in dynatrace.conf.yaml if there is one
+func attachRulesEntitySelector(dynatraceConfig *config.DynatraceConfigFile) string {
+	if dynatraceConfig == nil || dynatraceConfig.AttachRules == nil {
+		return ""
+	}
+	return dynatraceConfig.AttachRules.EntitySelector
+}
+
 /**
  * Change with #115_116: parse labels and move them into custom properties
+ * Additionally the customProperties of the dynatrace.conf.yaml are added - properties whose label placeholders couldn't be replaced are skipped
  */
-func createCustomProperties(a adapter.EventContentAdapter) map[string]string {
+func createCustomProperties(ctx context.Context, a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) map[string]string {
 	// TODO: AG - parse labels and push them through
 
 	// var customProperties dtCustomProperties
@@ -115,11 +232,25 @@ func createCustomProperties(a adapter.EventContentAdapter) map[string]string {
 		customProperties[key] = value
 	}
 
+	// and the custom properties from dynatrace.conf.yaml - placeholders are already replaced when loading the file
+	if dynatraceConfig != nil {
+		for key, value := range dynatraceConfig.CustomProperties {
+			if strings.Contains(value, "$LABEL.") {
+				logging.FromContext(ctx).WithFields(log.Fields{
+					"property": key,
+					"value":    value,
+				}).Debug("Skipping custom property as the label is not set on the event")
+				continue
+			}
+			customProperties[key] = value
+		}
+	}
+
 	return customProperties
 }
 
 // createInfoEvent creates a new Info event
-func createInfoEvent(a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtInfoEvent {
+func createInfoEvent(ctx context.Context, a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtInfoEvent {
 
 	// we fill the Dynatrace Info Event with values from the labels or use our defaults
 	var ie dtInfoEvent
@@ -130,17 +261,86 @@ func createInfoEvent(a adapter.EventContentAdapter, dynatraceConfig *config.Dyna
 
 	// now we create our attach rules
 	ar := createAttachRules(a, dynatraceConfig)
-	ie.AttachRules = ar
+	ie.AttachRules = restrictAttachRulesToMeTypes(ctx, ar, dynatraceConfig, ie.EventType)
 
 	// and add the rest of the labels and info as custom properties
-	customProperties := createCustomProperties(a)
+	customProperties := createCustomProperties(ctx, a, dynatraceConfig)
 	ie.CustomProperties = customProperties
 
 	return ie
 }
 
+/**
+ * Returns the scorecard of an evaluation: one line per SLI with its status, value and the violated targets - failed SLIs first, then warnings and passed SLIs, e.g:
+ * response_time_p95: fail (value: 812.50, violated: <=600) [key SLI]
+ * Also returns the scorecard lines as custom properties, e.g: SLI response_time_p95 = fail (value: 812.50, violated: <=600) [key SLI]
+ */
+func createEvaluationScorecard(indicatorResults []*keptnv2.SLIEvaluationResult) ([]string, map[string]string) {
+	var lines []string
+	properties := make(map[string]string)
+
+	for _, status := range []string{"fail", "warning", "pass"} {
+		for _, indicatorResult := range indicatorResults {
+			if indicatorResult == nil || indicatorResult.Value == nil || indicatorResult.Status != status {
+				continue
+			}
+
+			result := fmt.Sprintf("%s (value: %.2f", indicatorResult.Status, indicatorResult.Value.Value)
+			violatedTargets := getViolatedTargets(indicatorResult)
+			if len(violatedTargets) > 0 {
+				result = result + ", violated: " + strings.Join(violatedTargets, ", ")
+			}
+			if !indicatorResult.Value.Success && indicatorResult.Value.Message != "" {
+				result = result + ", error: " + indicatorResult.Value.Message
+			}
+			result = result + ")"
+			if indicatorResult.KeySLI {
+				result = result + " [key SLI]"
+			}
+
+			lines = append(lines, indicatorResult.Value.Metric+": "+result)
+			properties["SLI "+indicatorResult.Value.Metric] = result
+		}
+	}
+
+	return lines, properties
+}
+
+/**
+ * Returns the markdown comment that is posted on the Dynatrace problem for the evaluation of a remediation, e.g:
+ * [Keptn remediation evaluation](https://bridge/trace/ctx) in stage production resulted in pass (100.00/100)
+ * followed by the scorecard of the evaluation
+ */
+func createRemediationEvaluationComment(edData *keptnv2.EvaluationFinishedEventData, bridgeURL string, scorecard []string) string {
+	comment := fmt.Sprintf("Keptn remediation evaluation in stage %s resulted in %s (%.2f/100)", edData.Stage, edData.Result, edData.Evaluation.Score)
+	if bridgeURL != "" {
+		comment = fmt.Sprintf("[Keptn remediation evaluation](%s) in stage %s resulted in %s (%.2f/100)", bridgeURL, edData.Stage, edData.Result, edData.Evaluation.Score)
+	}
+
+	for _, line := range scorecard {
+		comment = comment + "\n- " + line
+	}
+	return comment
+}
+
+// getViolatedTargets returns the criteria of all violated pass and warning targets of an SLI - for failed SLIs the pass targets are not reported again if they are the same as the warning targets
+func getViolatedTargets(indicatorResult *keptnv2.SLIEvaluationResult) []string {
+	targets := indicatorResult.PassTargets
+	if indicatorResult.Status == "fail" && len(indicatorResult.WarningTargets) > 0 {
+		targets = indicatorResult.WarningTargets
+	}
+
+	var violatedTargets []string
+	for _, target := range targets {
+		if target != nil && target.Violated {
+			violatedTargets = append(violatedTargets, target.Criteria)
+		}
+	}
+	return violatedTargets
+}
+
 // createAnnotationEvent creates a Dynatrace ANNOTATION event
-func createAnnotationEvent(a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtAnnotationEvent {
+func createAnnotationEvent(ctx context.Context, a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtAnnotationEvent {
 
 	// we fill the Dynatrace Info Event with values from the labels or use our defaults
 	var ie dtAnnotationEvent
@@ -151,10 +351,10 @@ func createAnnotationEvent(a adapter.EventContentAdapter, dynatraceConfig *confi
 
 	// now we create our attach rules
 	ar := createAttachRules(a, dynatraceConfig)
-	ie.AttachRules = ar
+	ie.AttachRules = restrictAttachRulesToMeTypes(ctx, ar, dynatraceConfig, ie.EventType)
 
 	// and add the rest of the labels and info as custom properties
-	customProperties := createCustomProperties(a)
+	customProperties := createCustomProperties(ctx, a, dynatraceConfig)
 	ie.CustomProperties = customProperties
 
 	return ie
@@ -168,7 +368,23 @@ func getValueFromLabels(a adapter.EventContentAdapter, key string, defaultValue
 	return defaultValue
 }
 
-func createDeploymentEvent(a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtDeploymentEvent {
+// getTestDuration returns the duration between the start and end timestamps of a test.finished event
+func getTestDuration(start string, end string) (time.Duration, error) {
+	if start == "" || end == "" {
+		return 0, errors.New("test start or end is missing")
+	}
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return 0, err
+	}
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return 0, err
+	}
+	return endTime.Sub(startTime), nil
+}
+
+func createDeploymentEvent(ctx context.Context, a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtDeploymentEvent {
 
 	// we fill the Dynatrace Deployment Event with values from the labels or use our defaults
 	var de dtDeploymentEvent
@@ -182,17 +398,45 @@ func createDeploymentEvent(a adapter.EventContentAdapter, dynatraceConfig *confi
 
 	// now we create our attach rules
 	ar := createAttachRules(a, dynatraceConfig)
-	de.AttachRules = ar
+	de.AttachRules = restrictAttachRulesToMeTypes(ctx, ar, dynatraceConfig, de.EventType)
 
 	// and add the rest of the labels and info as custom properties
 	// TODO: event.Project, event.Stage, event.Service, event.TestStrategy, event.Image, event.Tag, event.Labels, keptnContext
-	customProperties := createCustomProperties(a)
+	customProperties := createCustomProperties(ctx, a, dynatraceConfig)
 	de.CustomProperties = customProperties
 
 	return de
 }
 
-func createConfigurationEvent(a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtConfigurationEvent {
+// formatConfigurationChange returns the changed configuration values as sorted, comma separated key=value pairs, e.g: replicaCount=2, resources.limits.cpu=500m
+func formatConfigurationChange(configurationChange map[string]interface{}) string {
+	var values []string
+	for key, value := range configurationChange {
+		values = append(values, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(values)
+	return strings.Join(values, ", ")
+}
+
+/**
+ * Adds the properties Dynatrace uses to detect the released version of the attached entities for the release inventory
+ * The version is the deployed tag or - if the tag is not known - the passed git commit
+ */
+func addReleaseVersionProperties(customProperties map[string]string, a adapter.EventContentAdapter, gitCommit string) {
+	version := a.GetTag()
+	if version == "" || version == "n/a" {
+		version = gitCommit
+	}
+	if version == "" {
+		return
+	}
+
+	customProperties["releasesVersion"] = version
+	customProperties["releasesStage"] = a.GetStage()
+	customProperties["releasesProduct"] = a.GetProject()
+}
+
+func createConfigurationEvent(ctx context.Context, a adapter.EventContentAdapter, dynatraceConfig *config.DynatraceConfigFile) dtConfigurationEvent {
 
 	// we fill the Dynatrace Deployment Event with values from the labels or use our defaults
 	var de dtConfigurationEvent
@@ -201,12 +445,57 @@ func createConfigurationEvent(a adapter.EventContentAdapter, dynatraceConfig *co
 
 	// now we create our attach rules
 	ar := createAttachRules(a, dynatraceConfig)
-	de.AttachRules = ar
+	de.AttachRules = restrictAttachRulesToMeTypes(ctx, ar, dynatraceConfig, de.EventType)
 
 	// and add the rest of the labels and info as custom properties
 	// TODO: event.Project, event.Stage, event.Service, event.TestStrategy, event.Image, event.Tag, event.Labels, keptnContext
-	customProperties := createCustomProperties(a)
+	customProperties := createCustomProperties(ctx, a, dynatraceConfig)
 	de.CustomProperties = customProperties
 
 	return de
 }
+
+// problemCommentData is passed to the templates of the problem comments defined in the dynatrace.conf.yaml
+type problemCommentData struct {
+	// Event is the data of the Keptn event, e.g: keptnv2.ActionTriggeredEventData
+	Event interface{}
+	// Labels are the labels of the Keptn event
+	Labels map[string]string
+	// Bridge is the link to the sequence in the Keptn bridge
+	Bridge string
+	// Source is the source of the Keptn event
+	Source string
+	// Comment is the default comment
+	Comment string
+}
+
+// getProblemComments returns the templates of the problem comments of the dynatrace.conf.yaml
+func getProblemComments(dynatraceConfig *config.DynatraceConfigFile) config.DtProblemComments {
+	if dynatraceConfig == nil || dynatraceConfig.ProblemComments == nil {
+		return config.DtProblemComments{}
+	}
+	return *dynatraceConfig.ProblemComments
+}
+
+/**
+ * Renders the Go template of a problem comment, e.g: Keptn executed {{.Event.Action.Action}} for {{index .Labels "owner"}}
+ * Returns the default comment if the template is empty or can't be rendered
+ */
+func renderProblemComment(ctx context.Context, commentTemplate string, data problemCommentData) string {
+	if commentTemplate == "" {
+		return data.Comment
+	}
+
+	tmpl, err := template.New("comment").Parse(commentTemplate)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Could not parse problem comment template - using default comment")
+		return data.Comment
+	}
+
+	var comment strings.Builder
+	if err := tmpl.Execute(&comment, data); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Could not render problem comment template - using default comment")
+		return data.Comment
+	}
+	return comment.String()
+}
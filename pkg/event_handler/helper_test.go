@@ -0,0 +1,112 @@
+package event_handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+)
+
+func TestPrepareAttachRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		totalCount  int
+		wantWarning string
+	}{
+		{
+			name:       "entities match the attachRules",
+			totalCount: 2,
+		},
+		{
+			name:        "no entity matches the attachRules",
+			totalCount:  0,
+			wantWarning: `No Dynatrace entity matches the attachRules type(SERVICE),tag("keptn_project:sockshop"),tag("keptn_stage:staging"),tag("keptn_service:carts")`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.URL.Path != "/api/v2/entities" {
+					t.Errorf("prepareAttachRules(): unexpected request %s %s", request.Method, request.URL.Path)
+				}
+				writer.Write([]byte(fmt.Sprintf(`{"totalCount": %d, "entities": []}`, tt.totalCount)))
+			}))
+			defer dtMockServer.Close()
+
+			dtHelper := lib.NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL, ApiToken: "token"})
+			keptnEvent := adapter.NewDeploymentFinishedAdapter(keptnv2.DeploymentFinishedEventData{
+				EventData: keptnv2.EventData{Project: "sockshop", Stage: "staging", Service: "carts"},
+			}, "my-keptn-context", "helm-service")
+
+			warning, err := prepareAttachRules(dtHelper, keptnEvent, nil)
+			if err != nil {
+				t.Fatalf("prepareAttachRules() error = %v", err)
+			}
+			if tt.wantWarning == "" && warning != "" {
+				t.Errorf("prepareAttachRules() warning = %q, want none", warning)
+			}
+			if !strings.HasPrefix(warning, tt.wantWarning) {
+				t.Errorf("prepareAttachRules() warning = %q, want %q", warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestRenderProblemComment(t *testing.T) {
+	data := problemCommentData{
+		Event: keptnv2.ActionTriggeredEventData{
+			EventData: keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts"},
+			Action:    keptnv2.ActionInfo{Name: "scale up", Action: "scaling"},
+		},
+		Labels:  map[string]string{"owner": "team-a"},
+		Bridge:  "https://bridge/trace/my-keptn-context",
+		Source:  "unleash-service",
+		Comment: "Keptn triggered action scaling",
+	}
+
+	tests := []struct {
+		name            string
+		commentTemplate string
+		want            string
+	}{
+		{
+			name: "no template returns the default comment",
+			want: "Keptn triggered action scaling",
+		},
+		{
+			name:            "template with event, labels, bridge and source",
+			commentTemplate: `{{.Source}} executed {{.Event.Action.Action}} in {{.Event.Stage}} for {{index .Labels "owner"}}: {{.Bridge}}`,
+			want:            "unleash-service executed scaling in production for team-a: https://bridge/trace/my-keptn-context",
+		},
+		{
+			name:            "template with the default comment",
+			commentTemplate: `{{.Comment}} ({{.Event.Project}})`,
+			want:            "Keptn triggered action scaling (sockshop)",
+		},
+		{
+			name:            "template that can't be parsed returns the default comment",
+			commentTemplate: `{{.Event.Action.Action`,
+			want:            "Keptn triggered action scaling",
+		},
+		{
+			name:            "template that can't be executed returns the default comment",
+			commentTemplate: `{{.Event.Unknown}}`,
+			want:            "Keptn triggered action scaling",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderProblemComment(context.Background(), tt.commentTemplate, data); got != tt.want {
+				t.Errorf("renderProblemComment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
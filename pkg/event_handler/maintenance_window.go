@@ -0,0 +1,129 @@
+package event_handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const defaultMaintenanceWindowSuppression = "DETECT_PROBLEMS_DONT_ALERT"
+const defaultMaintenanceWindowDurationMinutes = 60
+
+/**
+ * Creates a Dynatrace maintenance window when a task configured in maintenanceWindows of the dynatrace.conf.yaml is triggered, e.g: deployment or test,
+ * and closes it when the task is finished, so that planned disruptive activities don't cause alerts or problems
+ */
+func (eh CDEventHandler) handleMaintenanceWindow(keptnHandler *keptnv2.Keptn, shkeptncontext string) {
+	logger := logging.FromContext(eh.ctx)
+	task, kind, err := keptnv2.ParseTaskEventType(eh.Event.Type())
+	if err != nil || (kind != "triggered" && kind != "finished") {
+		return
+	}
+
+	eventData := &keptnv2.EventData{}
+	if err := eh.Event.DataAs(eventData); err != nil {
+		return
+	}
+
+	keptnEvent := adapter.NewTaskEventAdapter(*eventData, eh.Event.Type(), shkeptncontext, eh.Event.Source())
+	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load Dynatrace config")
+		return
+	}
+	if dynatraceConfig == nil || dynatraceConfig.MaintenanceWindows == nil || !containsString(dynatraceConfig.MaintenanceWindows.Tasks, task) {
+		return
+	}
+
+	creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
+	if err != nil {
+		logger.WithError(err).Error("Failed to load Dynatrace credentials")
+		return
+	}
+	dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+	dtHelper.EventContext = eh.ctx
+
+	name := getMaintenanceWindowName(task, eventData, shkeptncontext)
+	if kind == "finished" {
+		if err := dtHelper.CloseMaintenanceWindow(name); err != nil {
+			logger.WithError(err).WithField("name", name).Error("Could not close maintenance window")
+		}
+		return
+	}
+
+	scope, err := createMaintenanceWindowScope(dtHelper, createAttachRules(keptnEvent, dynatraceConfig))
+	if err != nil {
+		logger.WithError(err).WithField("name", name).Error("Could not determine scope of maintenance window")
+		return
+	}
+
+	suppression, duration := getMaintenanceWindowSettings(dynatraceConfig.MaintenanceWindows)
+	description := fmt.Sprintf("Keptn %s of service %s in stage %s of project %s", task, eventData.Service, eventData.Stage, eventData.Project)
+	if err := dtHelper.CreateMaintenanceWindow(name, description, suppression, scope, duration); err != nil {
+		logger.WithError(err).WithField("name", name).Error("Could not create maintenance window")
+	}
+}
+
+// getMaintenanceWindowName returns the name of the maintenance window of a task, which is unique per Keptn context, e.g: Keptn deployment sockshop.dev.carts (1234-5678)
+func getMaintenanceWindowName(task string, eventData *keptnv2.EventData, shkeptncontext string) string {
+	return fmt.Sprintf("Keptn %s %s.%s.%s (%s)", task, eventData.Project, eventData.Stage, eventData.Service, shkeptncontext)
+}
+
+func getMaintenanceWindowSettings(maintenanceWindows *config.DtMaintenanceWindows) (string, time.Duration) {
+	suppression := maintenanceWindows.Suppression
+	if suppression == "" {
+		suppression = defaultMaintenanceWindowSuppression
+	}
+	durationMinutes := maintenanceWindows.DurationMinutes
+	if durationMinutes <= 0 {
+		durationMinutes = defaultMaintenanceWindowDurationMinutes
+	}
+	return suppression, time.Duration(durationMinutes) * time.Minute
+}
+
+// createMaintenanceWindowScope converts the attachRules of events to the scope of a maintenance window - an entitySelector is resolved to entity IDs
+func createMaintenanceWindowScope(dtHelper *lib.DynatraceHelper, attachRules config.DtAttachRules) (*lib.MaintenanceWindowScope, error) {
+	scope := &lib.MaintenanceWindowScope{
+		Entities: append([]string{}, attachRules.EntityIds...),
+		Matches:  []lib.MaintenanceWindowMatch{},
+	}
+
+	if attachRules.EntitySelector != "" {
+		entityIDs, err := dtHelper.GetEntityIDs(attachRules.EntitySelector)
+		if err != nil {
+			return nil, err
+		}
+		scope.Entities = append(scope.Entities, entityIDs...)
+	}
+
+	for _, tagRule := range attachRules.TagRule {
+		var tags []lib.MaintenanceWindowTag
+		for _, tag := range tagRule.Tags {
+			tags = append(tags, lib.MaintenanceWindowTag{
+				Context: tag.Context,
+				Key:     tag.Key,
+				Value:   tag.Value,
+			})
+		}
+		for _, meType := range tagRule.MeTypes {
+			scope.Matches = append(scope.Matches, lib.MaintenanceWindowMatch{
+				Type:           meType,
+				Tags:           tags,
+				TagCombination: "AND",
+			})
+		}
+	}
+
+	// a maintenance window without scope would suppress the problems of the whole environment
+	if len(scope.Entities) == 0 && len(scope.Matches) == 0 {
+		return nil, errors.New("no entities or tags are defined by the attachRules")
+	}
+	return scope, nil
+}
@@ -1,6 +1,8 @@
 package event_handler
 
 import (
+	"context"
+
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,22 +11,40 @@ import (
 	"strings"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
-	keptn "github.com/keptn/go-utils/pkg/lib"
-	keptncommon "github.com/keptn/go-utils/pkg/lib/keptn"
+	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/keptnevents"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib/dynatrace"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/subscription"
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	log "github.com/sirupsen/logrus"
 )
 
+type dtProblemEntity struct {
+	Entity string `json:"entity"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+// String returns the name and ID of the entity, e.g: carts (SERVICE-1234567890ABCDEF)
+func (e dtProblemEntity) String() string {
+	if e.Name == "" {
+		return e.Entity
+	}
+	return e.Name + " (" + e.Entity + ")"
+}
+
 type DTProblemEvent struct {
-	ImpactedEntities []struct {
-		Entity string `json:"entity"`
-		Name   string `json:"name"`
-		Type   string `json:"type"`
-	} `json:"ImpactedEntities"`
-	ImpactedEntity string `json:"ImpactedEntity"`
-	PID            string `json:"PID"`
-	ProblemDetails struct {
+	ImpactedEntities []dtProblemEntity `json:"ImpactedEntities"`
+	ImpactedEntity   string            `json:"ImpactedEntity"`
+	PID              string            `json:"PID"`
+	ProblemDetails   struct {
 		DisplayName   string `json:"displayName"`
 		EndTime       int    `json:"endTime"`
 		HasRootCause  bool   `json:"hasRootCause"`
@@ -33,6 +53,9 @@ type DTProblemEvent struct {
 		SeverityLevel string `json:"severityLevel"`
 		StartTime     int64  `json:"startTime"`
 		Status        string `json:"status"`
+		// ManagementZones and RootCauseEntity are only part of the problem details if they are sent as {ProblemDetailsJSONv2}
+		ManagementZones []dtProblemV2ManagementZone `json:"managementZones,omitempty"`
+		RootCauseEntity *dtProblemV2Entity          `json:"rootCauseEntity,omitempty"`
 	} `json:"ProblemDetails"`
 	ProblemID    string `json:"ProblemID"`
 	ProblemTitle string `json:"ProblemTitle"`
@@ -46,10 +69,18 @@ type DTProblemEvent struct {
 	KeptnProject string `json:"KeptnProject"`
 	KeptnService string `json:"KeptnService"`
 	KeptnStage   string `json:"KeptnStage"`
+	// ManagementZones are the names of the management zones of the problem - only available for problems in the Problems API v2 format
+	ManagementZones []string `json:"-"`
+	// RootCauseEntity is the root cause of the problem if Dynatrace found one
+	RootCauseEntity *dtProblemEntity `json:"-"`
+	// ProblemFilters are the names of the alerting profiles of the problem - only available for problems in the Problems API v2 format
+	ProblemFilters []string `json:"-"`
 }
 
 type ProblemEventHandler struct {
-	Event cloudevents.Event
+	ctx            context.Context
+	Event          cloudevents.Event
+	dtConfigGetter adapter.DynatraceConfigGetterInterface
 }
 
 type remediationTriggeredEventData struct {
@@ -59,11 +90,21 @@ type remediationTriggeredEventData struct {
 	Problem ProblemDetails `json:"problem"`
 }
 
+type remediationFinishedEventData struct {
+	keptnv2.EventData
+
+	// Problem contains details about the resolved problem
+	Problem ProblemDetails `json:"problem"`
+}
+
 const remediationTaskName = "remediation"
 
+const rootCauseEntityLabel = "Root Cause Entity"
+const impactedEntitiesLabel = "Impacted Entities"
+
 type ProblemDetails struct {
 	// State is the state of the problem; possible values are: OPEN, RESOLVED
-	State string `json:"State,omitempty jsonschema:"enum=open,enum=resolved"`
+	State string `json:"State,omitempty" jsonschema:"enum=open,enum=resolved"`
 	// ProblemID is a unique system identifier of the reported problem
 	ProblemID string `json:"ProblemID"`
 	// ProblemTitle is the display number of the reported problem.
@@ -78,79 +119,227 @@ type ProblemDetails struct {
 	ImpactedEntity string `json:"ImpactedEntity,omitempty"`
 	// Tags is a comma separated list of tags that are defined for all impacted entities.
 	Tags string `json:"Tags,omitempty"`
+	// ImpactedEntities are all entities impacted by the problem
+	ImpactedEntities []dtProblemEntity `json:"ImpactedEntities,omitempty"`
+	// RootCauseEntity is the root cause entity of the problem if Dynatrace found one
+	RootCauseEntity *dtProblemEntity `json:"RootCauseEntity,omitempty"`
+	// ProblemFilters are the names of the alerting profiles of the problem
+	ProblemFilters []string `json:"ProblemFilters,omitempty"`
 }
 
-const eventbroker = "EVENTBROKER"
-
 func (eh ProblemEventHandler) HandleEvent() error {
+	logger := logging.FromContext(eh.ctx)
 
 	if eh.Event.Source() != "dynatrace" {
-		log.WithField("eventSource", eh.Event.Source()).Debug("Will not handle problem event that did not come from a Dynatrace Problem Notification")
+		logger.WithField("eventSource", eh.Event.Source()).Debug("Will not handle problem event that did not come from a Dynatrace Problem Notification")
 		return nil
 	}
 	var shkeptncontext string
 	_ = eh.Event.Context.ExtensionAs("shkeptncontext", &shkeptncontext)
-	dtProblemEvent := &DTProblemEvent{}
-	err := eh.Event.DataAs(dtProblemEvent)
-
+	dtProblemEvent, err := parseDynatraceProblemEvent(eh.Event.Data())
 	if err != nil {
-		log.WithError(err).Error("Could not map received event to datastructure")
+		logger.WithError(err).Error("Could not map received event to datastructure")
 		return err
 	}
 
 	// Log the problem ID and state for better troubleshooting
-	log.WithFields(
+	logger.WithFields(
 		log.Fields{
 			"PID":       dtProblemEvent.PID,
 			"problemId": dtProblemEvent.ProblemID,
 			"state":     dtProblemEvent.State,
 		}).Info("Received event")
 
-	// ignore problem events if they are closed
+	// the notification only contains limited details - so we optionally fetch the complete problem from the Problems API v2
+	if lib.IsProblemEnrichmentEnabled(eh.ctx) {
+		if err := eh.enrichDynatraceProblem(dtProblemEvent); err != nil {
+			logger.WithError(err).WithField("PID", dtProblemEvent.PID).Error("Could not enrich problem with details of the Problems API v2")
+		}
+	}
+
+	// only handle problems of the configured management zones
+	if !lib.IsManagementZoneAllowed(dtProblemEvent.ManagementZones) {
+		logger.WithFields(
+			log.Fields{
+				"PID":             dtProblemEvent.PID,
+				"managementZones": dtProblemEvent.ManagementZones,
+			}).Info("Ignoring problem as its management zones are not allowed")
+		return nil
+	}
+
+	project, stage, service := eh.extractContextFromDynatraceProblem(dtProblemEvent)
+
+	// the subscription filter can't be applied before the problem is handled, as the project and stage are only known once they have been mapped from the tags
+	if !subscription.NewFilterFromEnv().MatchesProjectAndStage(project, stage) {
+		logger.WithFields(
+			log.Fields{
+				"PID":     dtProblemEvent.PID,
+				"project": project,
+				"stage":   stage,
+			}).Debug("Ignoring problem as this dynatrace-service isn't subscribed to its project or stage")
+		return nil
+	}
+
+	if project == "" || stage == "" || service == "" {
+		logger := logger.WithFields(
+			log.Fields{
+				"PID":     dtProblemEvent.PID,
+				"project": project,
+				"stage":   stage,
+				"service": service,
+			})
+		if lib.IsDropUnmappedProblemsEnabled(eh.ctx) {
+			logger.Info("Ignoring problem as it can't be mapped to a Keptn project, stage and service")
+			return nil
+		}
+		logger.Warn("Problem can't be mapped to a Keptn project, stage and service")
+	}
+
+	// the dynatrace.conf.yaml of the project, stage and service is loaded once for the sinks, the remediation rules and the link to Keptn
+	dynatraceConfig := eh.getDynatraceConfig(project, stage, service, shkeptncontext)
+
+	// the problem fans out to the configured sinks, e.g: chat or ITSM systems, in addition to Keptn
+	eh.forwardProblemToSinks(dynatraceConfig, dtProblemEvent, project, stage, service, shkeptncontext)
+
+	// resolved problems finish the remediation that was triggered for them
 	if dtProblemEvent.State == "RESOLVED" {
-		return eh.handleClosedProblemFromDT(dtProblemEvent, shkeptncontext)
+		return eh.handleClosedProblemFromDT(dynatraceConfig, dtProblemEvent, project, stage, service, shkeptncontext)
 	}
 
-	return eh.handleOpenedProblemFromDT(dtProblemEvent, shkeptncontext)
+	return eh.handleOpenedProblemFromDT(dynatraceConfig, dtProblemEvent, project, stage, service, shkeptncontext)
 }
 
-func (eh ProblemEventHandler) handleClosedProblemFromDT(dtProblemEvent *DTProblemEvent, shkeptncontext string) error {
-	problemDetailsString, err := json.Marshal(dtProblemEvent.ProblemDetails)
+// getDynatraceConfig returns the dynatrace.conf.yaml the problem was mapped to or nil if it can't be loaded
+func (eh ProblemEventHandler) getDynatraceConfig(project string, stage string, service string, shkeptncontext string) *config.DynatraceConfigFile {
+	logger := logging.FromContext(eh.ctx)
+	if eh.dtConfigGetter == nil {
+		return nil
+	}
 
-	project, stage, service := eh.extractContextFromDynatraceProblem(dtProblemEvent)
+	eventData := keptnv2.EventData{Project: project, Stage: stage, Service: service}
+	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(adapter.NewProblemAdapter(eventData, shkeptncontext, eh.Event.Source()))
+	if err != nil {
+		logger.WithError(err).Error("Failed to load Dynatrace config - using the default remediation sequence and not forwarding problem to sinks")
+		return nil
+	}
+	return dynatraceConfig
+}
 
-	newProblemData := keptn.ProblemEventData{
-		State:          "CLOSED",
-		PID:            dtProblemEvent.PID,
-		ProblemID:      dtProblemEvent.ProblemID,
-		ProblemTitle:   dtProblemEvent.ProblemTitle,
-		ProblemDetails: json.RawMessage(problemDetailsString),
-		ProblemURL:     dtProblemEvent.ProblemURL,
-		ImpactedEntity: dtProblemEvent.ImpactedEntity,
-		Tags:           dtProblemEvent.Tags,
-		Project:        project,
-		Stage:          stage,
-		Service:        service,
+func (eh ProblemEventHandler) handleClosedProblemFromDT(dynatraceConfig *config.DynatraceConfigFile, dtProblemEvent *DTProblemEvent, project string, stage string, service string, shkeptncontext string) error {
+	logger := logging.FromContext(eh.ctx)
+	problemDetailsString, err := json.Marshal(dtProblemEvent.ProblemDetails)
+
+	remediationFinishedEventData := remediationFinishedEventData{
+		EventData: keptnv2.EventData{
+			Project: project,
+			Stage:   stage,
+			Service: service,
+			Status:  keptnv2.StatusSucceeded,
+			Result:  keptnv2.ResultPass,
+			Message: fmt.Sprintf("Problem %s was resolved in Dynatrace", dtProblemEvent.ProblemID),
+		},
+		Problem: ProblemDetails{
+			State:            "RESOLVED",
+			PID:              dtProblemEvent.PID,
+			ProblemID:        dtProblemEvent.ProblemID,
+			ProblemTitle:     dtProblemEvent.ProblemTitle,
+			ProblemDetails:   json.RawMessage(problemDetailsString),
+			ProblemURL:       dtProblemEvent.ProblemURL,
+			ImpactedEntity:   dtProblemEvent.ImpactedEntity,
+			Tags:             dtProblemEvent.Tags,
+			ImpactedEntities: dtProblemEvent.ImpactedEntities,
+			RootCauseEntity:  dtProblemEvent.RootCauseEntity,
+			ProblemFilters:   dtProblemEvent.ProblemFilters,
+		},
 	}
 
 	// https://github.com/keptn-contrib/dynatrace-service/issues/176
 	// add problem URL as label so it becomes clickable
-	newProblemData.Labels = make(map[string]string)
-	newProblemData.Labels[common.PROBLEMURL_LABEL] = dtProblemEvent.ProblemURL
+	remediationFinishedEventData.Labels = make(map[string]string)
+	remediationFinishedEventData.Labels[common.PROBLEMURL_LABEL] = dtProblemEvent.ProblemURL
+	addProblemEntityLabels(remediationFinishedEventData.Labels, dtProblemEvent)
 
-	err = createAndSendCE(newProblemData, shkeptncontext, keptn.ProblemEventType)
+	// the problem is already closed - so there is no need to keep the remediation running
+	err = eh.finishOpenRemediation(dynatraceConfig, dtProblemEvent, remediationFinishedEventData, shkeptncontext)
 	if err != nil {
-		log.WithError(err).Error("Could not send cloud event")
+		logger.WithError(err).WithField("PID", dtProblemEvent.PID).Error("Could not finish remediation of resolved problem")
 		return err
 	}
-	log.WithField("PID", dtProblemEvent.PID).Debug("Successfully sent Keptn PROBLEM CLOSED event")
 	return nil
 }
 
-func (eh ProblemEventHandler) handleOpenedProblemFromDT(dtProblemEvent *DTProblemEvent, shkeptncontext string) error {
-	problemDetailsString, err := json.Marshal(dtProblemEvent.ProblemDetails)
+/**
+ * Sends the finished event of the remediation sequence that was triggered for the problem if it is still running
+ * The remediation is correlated via the KeptnContext and the PID of the problem - the sequence is determined by the same remediationRules as for the open problem
+ */
+func (eh ProblemEventHandler) finishOpenRemediation(dynatraceConfig *config.DynatraceConfigFile, dtProblemEvent *DTProblemEvent, remediationFinished remediationFinishedEventData, shkeptncontext string) error {
+	logger := logging.FromContext(eh.ctx)
+	project := remediationFinished.Project
+	stage := remediationFinished.Stage
+	sequence := getRemediationSequence(eh.findRemediationRule(dynatraceConfig, dtProblemEvent))
+	sequenceName := fmt.Sprintf("%s.%s", stage, sequence)
+
+	eventHandler := keptnapi.NewEventHandler(os.Getenv("DATASTORE"))
+	triggeredEvents, errObj := eventHandler.GetEvents(&keptnapi.EventFilter{
+		Project:      project,
+		Stage:        stage,
+		EventType:    keptnv2.GetTriggeredEventType(sequenceName),
+		KeptnContext: shkeptncontext,
+	})
+	if errObj != nil {
+		return errors.New("could not retrieve " + sequence + ".triggered event: " + *errObj.Message)
+	}
 
-	project, stage, service := eh.extractContextFromDynatraceProblem(dtProblemEvent)
+	// the finished event refers to the triggered event of the remediation, so that the shipyard controller can link it to the sequence
+	remediationTriggeredID := ""
+	for _, event := range triggeredEvents {
+		data := &remediationTriggeredEventData{}
+		if err := keptnv2.Decode(event.Data, data); err != nil {
+			return errors.New("could not decode " + sequence + ".triggered event: " + err.Error())
+		}
+		if data.Problem.PID == dtProblemEvent.PID {
+			remediationTriggeredID = event.ID
+			break
+		}
+	}
+	if remediationTriggeredID == "" {
+		logger.WithField("PID", dtProblemEvent.PID).Debug("No remediation was triggered for the resolved problem")
+		return nil
+	}
+
+	finishedEvents, errObj := eventHandler.GetEvents(&keptnapi.EventFilter{
+		Project:      project,
+		Stage:        stage,
+		EventType:    keptnv2.GetFinishedEventType(sequenceName),
+		KeptnContext: shkeptncontext,
+	})
+	if errObj != nil {
+		return errors.New("could not retrieve " + sequence + ".finished event: " + *errObj.Message)
+	}
+	if len(finishedEvents) > 0 {
+		logger.WithField("PID", dtProblemEvent.PID).Debug("Remediation of the resolved problem is already finished")
+		return nil
+	}
+
+	event, err := keptnevents.NewEventWithKeptnContext(shkeptncontext, keptnv2.GetFinishedEventType(sequenceName), remediationFinished)
+	if err != nil {
+		return err
+	}
+	event.SetExtension("triggeredid", remediationTriggeredID)
+	if err := keptnevents.Send(eh.ctx, event); err != nil {
+		return err
+	}
+	logger.WithFields(
+		log.Fields{
+			"PID":      dtProblemEvent.PID,
+			"sequence": sequenceName,
+		}).Info("Finished remediation of resolved problem")
+	return nil
+}
+
+func (eh ProblemEventHandler) handleOpenedProblemFromDT(dynatraceConfig *config.DynatraceConfigFile, dtProblemEvent *DTProblemEvent, project string, stage string, service string, shkeptncontext string) error {
+	logger := logging.FromContext(eh.ctx)
+	problemDetailsString, err := json.Marshal(dtProblemEvent.ProblemDetails)
 
 	remediationEventData := remediationTriggeredEventData{
 		EventData: keptnv2.EventData{
@@ -159,14 +348,17 @@ func (eh ProblemEventHandler) handleOpenedProblemFromDT(dtProblemEvent *DTProble
 			Service: service,
 		},
 		Problem: ProblemDetails{
-			State:          "OPEN",
-			PID:            dtProblemEvent.PID,
-			ProblemID:      dtProblemEvent.ProblemID,
-			ProblemTitle:   dtProblemEvent.ProblemTitle,
-			ProblemDetails: json.RawMessage(problemDetailsString),
-			ProblemURL:     dtProblemEvent.ProblemURL,
-			ImpactedEntity: dtProblemEvent.ImpactedEntity,
-			Tags:           dtProblemEvent.Tags,
+			State:            "OPEN",
+			PID:              dtProblemEvent.PID,
+			ProblemID:        dtProblemEvent.ProblemID,
+			ProblemTitle:     dtProblemEvent.ProblemTitle,
+			ProblemDetails:   json.RawMessage(problemDetailsString),
+			ProblemURL:       dtProblemEvent.ProblemURL,
+			ImpactedEntity:   dtProblemEvent.ImpactedEntity,
+			Tags:             dtProblemEvent.Tags,
+			ImpactedEntities: dtProblemEvent.ImpactedEntities,
+			RootCauseEntity:  dtProblemEvent.RootCauseEntity,
+			ProblemFilters:   dtProblemEvent.ProblemFilters,
 		},
 	}
 
@@ -174,19 +366,147 @@ func (eh ProblemEventHandler) handleOpenedProblemFromDT(dtProblemEvent *DTProble
 	// add problem URL as label so it becomes clickable
 	remediationEventData.Labels = make(map[string]string)
 	remediationEventData.Labels[common.PROBLEMURL_LABEL] = dtProblemEvent.ProblemURL
+	addProblemEntityLabels(remediationEventData.Labels, dtProblemEvent)
+
+	// find the remediation sequence for the severity and impact of the problem
+	rule := eh.findRemediationRule(dynatraceConfig, dtProblemEvent)
+	sequence := getRemediationSequence(rule)
+	if rule != nil && rule.ProblemType != "" {
+		// the problem title is matched against the problemType in remediation.yaml - so we keep the original title as label
+		remediationEventData.Labels["Problem Title"] = dtProblemEvent.ProblemTitle
+		remediationEventData.Problem.ProblemTitle = rule.ProblemType
+	}
 
-	// Send a sh.keptn.event.${STAGE}.remediation.triggered event
-	err = createAndSendCE(remediationEventData, shkeptncontext, keptnv2.GetTriggeredEventType(
-		fmt.Sprintf("%s.%s", stage, remediationTaskName),
+	// Send a sh.keptn.event.${STAGE}.${SEQUENCE}.triggered event
+	err = createAndSendCE(eh.ctx, remediationEventData, shkeptncontext, keptnv2.GetTriggeredEventType(
+		fmt.Sprintf("%s.%s", stage, sequence),
 	))
 	if err != nil {
-		log.WithError(err).Error("Could not send cloud event")
+		logger.WithError(err).Error("Could not send cloud event")
 		return err
 	}
-	log.WithField("PID", dtProblemEvent.PID).Debug("Successfully sent Keptn PROBLEM OPEN event")
+	logger.WithField("PID", dtProblemEvent.PID).Debug("Successfully sent Keptn PROBLEM OPEN event")
+
+	if err := eh.linkProblemToKeptn(dynatraceConfig, dtProblemEvent, remediationEventData.EventData, shkeptncontext); err != nil {
+		logger.WithError(err).WithField("PID", dtProblemEvent.PID).Error("Could not link problem to Keptn sequence")
+	}
+	return nil
+}
+
+/**
+ * Adds the root cause entity and the impacted entities of the problem as labels, e.g: Root Cause Entity = carts (SERVICE-1234567890ABCDEF)
+ * so that remediation sequences can make entity-aware decisions
+ */
+func addProblemEntityLabels(labels map[string]string, dtProblemEvent *DTProblemEvent) {
+	if dtProblemEvent.RootCauseEntity != nil {
+		labels[rootCauseEntityLabel] = dtProblemEvent.RootCauseEntity.String()
+	}
+
+	var impactedEntities []string
+	for _, entity := range dtProblemEvent.ImpactedEntities {
+		impactedEntities = append(impactedEntities, entity.String())
+	}
+	if len(impactedEntities) > 0 {
+		labels[impactedEntitiesLabel] = strings.Join(impactedEntities, ", ")
+	}
+}
+
+// findRemediationRule returns the first remediation rule of the dynatrace.conf.yaml that matches the severity and impact level of the problem or nil if none matches
+func (eh ProblemEventHandler) findRemediationRule(dynatraceConfig *config.DynatraceConfigFile, dtProblemEvent *DTProblemEvent) *config.DtRemediationRule {
+	logger := logging.FromContext(eh.ctx)
+	if dynatraceConfig == nil {
+		return nil
+	}
+
+	for _, rule := range dynatraceConfig.RemediationRules {
+		if rule.Matches(dtProblemEvent.ProblemDetails.SeverityLevel, dtProblemEvent.ProblemDetails.ImpactLevel) {
+			logger.WithFields(
+				log.Fields{
+					"PID":           dtProblemEvent.PID,
+					"severityLevel": dtProblemEvent.ProblemDetails.SeverityLevel,
+					"impactLevel":   dtProblemEvent.ProblemDetails.ImpactLevel,
+					"sequence":      rule.Sequence,
+					"problemType":   rule.ProblemType,
+				}).Info("Found remediation rule for problem")
+			return &rule
+		}
+	}
+	return nil
+}
+
+// linkProblemToKeptn adds the keptnContext and the Keptn bridge URL of the triggered remediation to the Dynatrace problem
+func (eh ProblemEventHandler) linkProblemToKeptn(dynatraceConfig *config.DynatraceConfigFile, dtProblemEvent *DTProblemEvent, eventData keptnv2.EventData, shkeptncontext string) error {
+	if eh.dtConfigGetter == nil {
+		return nil
+	}
+
+	creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, eventData.Project, eventData.Stage)
+	if err != nil {
+		return err
+	}
+
+	bridgeURL := ""
+	if keptnBridgeURL, err := credentials.GetKeptnBridgeURL(); err == nil && keptnBridgeURL != "" {
+		bridgeURL = keptnBridgeURL + "/trace/" + shkeptncontext
+	}
+
+	dtHelper := lib.NewDynatraceHelper(nil, creds)
+	dtHelper.EventContext = eh.ctx
+	return dtHelper.SendProblemKeptnLink(dtProblemEvent.PID, shkeptncontext, bridgeURL)
+}
+
+// enrichDynatraceProblem fetches the problem from the Problems API v2 of the default Dynatrace tenant and merges its details into the problem event
+func (eh ProblemEventHandler) enrichDynatraceProblem(dtProblemEvent *DTProblemEvent) error {
+	logger := logging.FromContext(eh.ctx)
+	// the Keptn project isn't known before the problem is mapped - so we use the default credentials
+	dtCredentials, err := credentials.GetDynatraceCredentials(nil)
+	if err != nil {
+		return err
+	}
+
+	dynatraceHandler := dynatrace.NewDynatraceHandler(
+		dtCredentials.Tenant,
+		&common_sli.BaseKeptnEvent{},
+		map[string]string{
+			"Authorization": "Api-Token " + dtCredentials.ApiToken,
+			"User-Agent":    "keptn-contrib/dynatrace-service:" + os.Getenv("version"),
+		},
+		nil, dtProblemEvent.EventContext.KeptnContext, eh.Event.ID())
+	tlsConfig, err := dtCredentials.NewTLSConfig(!dynatrace.IsHttpSSLVerificationEnabled())
+	if err != nil {
+		return err
+	}
+	dynatraceHandler.UseTLSConfig(tlsConfig)
+	dynatraceHandler.EventContext = eh.ctx
+
+	dynatraceProblem, err := dynatraceHandler.ExecuteGetDynatraceProblemById(dtProblemEvent.PID)
+	if err != nil {
+		return err
+	}
+
+	// the problem of the API has the same format as problem notifications in the Problems API v2 format
+	problemJSON, err := json.Marshal(dynatraceProblem)
+	if err != nil {
+		return err
+	}
+	dtProblemV2 := &dtProblemV2Event{}
+	if err := json.Unmarshal(problemJSON, dtProblemV2); err != nil {
+		return err
+	}
+
+	dtProblemEvent.merge(dtProblemV2.toDTProblemEvent())
+	logger.WithField("PID", dtProblemEvent.PID).Debug("Enriched problem with details of the Problems API v2")
 	return nil
 }
 
+// getRemediationSequence returns the sequence of the remediation rule or the default remediation sequence
+func getRemediationSequence(rule *config.DtRemediationRule) string {
+	if rule != nil && rule.Sequence != "" {
+		return rule.Sequence
+	}
+	return remediationTaskName
+}
+
 func (eh ProblemEventHandler) extractContextFromDynatraceProblem(dtProblemEvent *DTProblemEvent) (string, string, string) {
 
 	// First we look if project, stage and service was passed in via the problem data fields and use them as defaults
@@ -195,46 +515,68 @@ func (eh ProblemEventHandler) extractContextFromDynatraceProblem(dtProblemEvent
 	service := dtProblemEvent.KeptnService
 
 	// Second we analyze the tag list as its possible that the problem was raised for a specific monitored service that has keptn tags
-	splittedTags := strings.Split(dtProblemEvent.Tags, ",")
+	// The tag keys default to keptn_project, keptn_stage and keptn_service and can be configured
+	projectTag := lib.GetProblemProjectTag()
+	stageTag := lib.GetProblemStageTag()
+	serviceTag := lib.GetProblemServiceTag()
 
-	for _, tag := range splittedTags {
+	var tags []string
+	for _, tag := range strings.Split(dtProblemEvent.Tags, ",") {
 		tag = strings.TrimSpace(tag)
+		tags = append(tags, tag)
 		split := strings.Split(tag, ":")
 		if len(split) > 1 {
-			if split[0] == "keptn_project" {
+			if split[0] == projectTag {
 				project = split[1]
 			}
-			if split[0] == "keptn_stage" {
+			if split[0] == stageTag {
 				stage = split[1]
 			}
-			if split[0] == "keptn_service" {
+			if split[0] == serviceTag {
 				service = split[1]
 			}
 		}
 	}
-	return project, stage, service
-}
-
-func createAndSendCE(problemData interface{}, shkeptncontext string, eventType string) error {
-	source, _ := url.Parse("dynatrace-service")
-
-	ce := cloudevents.NewEvent()
-	ce.SetType(eventType)
-	ce.SetSource(source.String())
-	ce.SetDataContentType(cloudevents.ApplicationJSON)
-	ce.SetData(cloudevents.ApplicationJSON, problemData)
-	ce.SetExtension("shkeptncontext", shkeptncontext)
 
-	keptnHandler, err := keptnv2.NewKeptn(&ce, keptncommon.KeptnOpts{})
-	if err != nil {
-		return errors.New("Could not create Keptn Handler: " + err.Error())
+	// Third we apply the first matching fallback rule to fill in what's still missing, e.g: for brownfield environments without Keptn tags
+	if project == "" || stage == "" || service == "" {
+		for _, rule := range lib.GetProblemContextMapping(eh.ctx) {
+			if !rule.Matches(dtProblemEvent.ManagementZones, tags) {
+				continue
+			}
+			if project == "" {
+				project = rule.Project
+			}
+			if stage == "" {
+				stage = rule.Stage
+			}
+			if service == "" {
+				service = rule.Service
+			}
+			break
+		}
 	}
 
-	if err := keptnHandler.SendCloudEvent(ce); err != nil {
-		return errors.New("Failed to send cloudevent:, " + err.Error())
+	// Finally we use the configured defaults, e.g: to start a catch-all remediation for generic problems
+	if project == "" {
+		project = lib.GetProblemDefaultProject()
 	}
+	if stage == "" {
+		stage = lib.GetProblemDefaultStage()
+	}
+	if service == "" {
+		service = lib.GetProblemDefaultService()
+	}
+	return project, stage, service
+}
 
-	return nil
+// createAndSendCE sends an event of the eventType with the problemData in the Keptn context of the problem
+func createAndSendCE(ctx context.Context, problemData interface{}, shkeptncontext string, eventType string) error {
+	event, err := keptnevents.NewEventWithKeptnContext(shkeptncontext, eventType, problemData)
+	if err != nil {
+		return err
+	}
+	return keptnevents.Send(ctx, event)
 }
 
 func getServiceEndpoint(service string) (url.URL, error) {
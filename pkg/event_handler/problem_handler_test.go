@@ -0,0 +1,351 @@
+package event_handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/keptnevents"
+)
+
+func TestFinishOpenRemediation(t *testing.T) {
+	criticalProblem := &DTProblemEvent{PID: "93327"}
+	criticalProblem.ProblemDetails.SeverityLevel = "AVAILABILITY"
+
+	tests := []struct {
+		name            string
+		dynatraceConfig *config.DynatraceConfigFile
+		dtProblemEvent  *DTProblemEvent
+		// events returned by the datastore for each event type
+		events          map[string]string
+		wantEventTypes  []string
+		wantTriggeredID string
+	}{
+		{
+			name:           "open remediation of the problem is finished",
+			dtProblemEvent: &DTProblemEvent{PID: "93327"},
+			events: map[string]string{
+				keptnv2.GetTriggeredEventType("production.remediation"): `[
+					{"id": "other-triggered-id", "data": {"project": "sockshop", "stage": "production", "problem": {"PID": "other"}}},
+					{"id": "remediation-triggered-id", "data": {"project": "sockshop", "stage": "production", "problem": {"PID": "93327"}}}
+				]`,
+			},
+			wantEventTypes:  []string{keptnv2.GetFinishedEventType("production.remediation")},
+			wantTriggeredID: "remediation-triggered-id",
+		},
+		{
+			name:           "no remediation was triggered for the problem",
+			dtProblemEvent: &DTProblemEvent{PID: "93327"},
+			events: map[string]string{
+				keptnv2.GetTriggeredEventType("production.remediation"): `[
+					{"id": "other-triggered-id", "data": {"project": "sockshop", "stage": "production", "problem": {"PID": "other"}}}
+				]`,
+			},
+			wantEventTypes: []string{},
+		},
+		{
+			name:           "remediation of the problem is already finished",
+			dtProblemEvent: &DTProblemEvent{PID: "93327"},
+			events: map[string]string{
+				keptnv2.GetTriggeredEventType("production.remediation"): `[
+					{"id": "remediation-triggered-id", "data": {"project": "sockshop", "stage": "production", "problem": {"PID": "93327"}}}
+				]`,
+				keptnv2.GetFinishedEventType("production.remediation"): `[
+					{"id": "remediation-finished-id", "triggeredid": "remediation-triggered-id", "data": {"project": "sockshop", "stage": "production"}}
+				]`,
+			},
+			wantEventTypes: []string{},
+		},
+		{
+			name: "remediation sequence of the matching remediation rule is finished",
+			dynatraceConfig: &config.DynatraceConfigFile{
+				RemediationRules: []config.DtRemediationRule{{SeverityLevel: "AVAILABILITY", Sequence: "remediation-critical"}},
+			},
+			dtProblemEvent: criticalProblem,
+			events: map[string]string{
+				keptnv2.GetTriggeredEventType("production.remediation"): `[
+					{"id": "remediation-triggered-id", "data": {"project": "sockshop", "stage": "production", "problem": {"PID": "93327"}}}
+				]`,
+				keptnv2.GetTriggeredEventType("production.remediation-critical"): `[
+					{"id": "remediation-critical-triggered-id", "data": {"project": "sockshop", "stage": "production", "problem": {"PID": "93327"}}}
+				]`,
+			},
+			wantEventTypes:  []string{keptnv2.GetFinishedEventType("production.remediation-critical")},
+			wantTriggeredID: "remediation-critical-triggered-id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datastore := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if events, ok := tt.events[r.URL.Query().Get("type")]; ok {
+					w.Write([]byte(`{"events": ` + events + `}`))
+					return
+				}
+				w.Write([]byte(`{"events": []}`))
+			}))
+			defer datastore.Close()
+			os.Setenv("DATASTORE", datastore.URL)
+			defer os.Unsetenv("DATASTORE")
+
+			sender := &fake.EventSender{}
+			keptnevents.SetSender(sender)
+
+			remediationFinished := remediationFinishedEventData{
+				EventData: keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts", Status: keptnv2.StatusSucceeded, Result: keptnv2.ResultPass},
+			}
+			eh := ProblemEventHandler{ctx: context.Background()}
+			err := eh.finishOpenRemediation(tt.dynatraceConfig, tt.dtProblemEvent, remediationFinished, "my-keptn-context")
+			if err != nil {
+				t.Fatalf("finishOpenRemediation() error = %v", err)
+			}
+
+			if err := sender.AssertSentEventTypes(tt.wantEventTypes); err != nil {
+				t.Fatalf("finishOpenRemediation() %v", err)
+			}
+			if len(tt.wantEventTypes) == 0 {
+				return
+			}
+			extensions := sender.SentEvents[0].Extensions()
+			if extensions["triggeredid"] != tt.wantTriggeredID {
+				t.Errorf("finishOpenRemediation() sent triggeredid %v, want %s", extensions["triggeredid"], tt.wantTriggeredID)
+			}
+			if extensions["shkeptncontext"] != "my-keptn-context" {
+				t.Errorf("finishOpenRemediation() sent shkeptncontext %v, want my-keptn-context", extensions["shkeptncontext"])
+			}
+		})
+	}
+}
+
+func TestProblemEventHandler_HandleEvent_SubscribedProjects(t *testing.T) {
+	os.Setenv("SUBSCRIBED_PROJECTS", "sockshop")
+	defer os.Unsetenv("SUBSCRIBED_PROJECTS")
+
+	tests := []struct {
+		name           string
+		tags           string
+		wantEventTypes []string
+	}{
+		{
+			name:           "problem of a subscribed project",
+			tags:           "keptn_project:sockshop, keptn_stage:production, keptn_service:carts",
+			wantEventTypes: []string{keptnv2.GetTriggeredEventType("production.remediation")},
+		},
+		{
+			name:           "problem of a project outside the filter",
+			tags:           "keptn_project:other, keptn_stage:production, keptn_service:carts",
+			wantEventTypes: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fake.EventSender{}
+			keptnevents.SetSender(sender)
+
+			// the project of a problem event is only known after it has been mapped from the tags of the problem
+			event := cloudevents.NewEvent()
+			event.SetID("problem-event-id")
+			event.SetType("sh.keptn.events.problem")
+			event.SetSource("dynatrace")
+			event.SetData(cloudevents.ApplicationJSON, map[string]string{"PID": "93327", "ProblemID": "P-1234", "State": "OPEN", "Tags": tt.tags})
+
+			eh := ProblemEventHandler{ctx: context.Background(), Event: event}
+			if err := eh.HandleEvent(); err != nil {
+				t.Fatalf("HandleEvent() error = %v", err)
+			}
+			if err := sender.AssertSentEventTypes(tt.wantEventTypes); err != nil {
+				t.Errorf("HandleEvent() %v", err)
+			}
+		})
+	}
+}
+
+func TestProblemEventHandler_findRemediationRule(t *testing.T) {
+	dynatraceConfig := &config.DynatraceConfigFile{
+		RemediationRules: []config.DtRemediationRule{
+			{SeverityLevel: "AVAILABILITY", ImpactLevel: "APPLICATION", Sequence: "remediation-critical"},
+			{SeverityLevel: "AVAILABILITY", Sequence: "remediation-availability", ProblemType: "Availability"},
+			{ImpactLevel: "INFRASTRUCTURE", Sequence: "remediation-infrastructure"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		dynatraceConfig *config.DynatraceConfigFile
+		severityLevel   string
+		impactLevel     string
+		wantSequence    string
+		wantProblemType string
+	}{
+		{
+			name:          "first rule matching severity and impact",
+			severityLevel: "AVAILABILITY",
+			impactLevel:   "APPLICATION",
+			wantSequence:  "remediation-critical",
+		},
+		{
+			name:            "rule matching any impact",
+			severityLevel:   "AVAILABILITY",
+			impactLevel:     "SERVICES",
+			wantSequence:    "remediation-availability",
+			wantProblemType: "Availability",
+		},
+		{
+			name:          "rule matching any severity",
+			severityLevel: "RESOURCE_CONTENTION",
+			impactLevel:   "INFRASTRUCTURE",
+			wantSequence:  "remediation-infrastructure",
+		},
+		{
+			name:          "no matching rule uses the default sequence",
+			severityLevel: "PERFORMANCE",
+			impactLevel:   "SERVICES",
+			wantSequence:  "remediation",
+		},
+		{
+			name:            "no dynatrace.conf.yaml uses the default sequence",
+			dynatraceConfig: &config.DynatraceConfigFile{},
+			severityLevel:   "AVAILABILITY",
+			impactLevel:     "APPLICATION",
+			wantSequence:    "remediation",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dynatraceConfig == nil {
+				tt.dynatraceConfig = dynatraceConfig
+			}
+			dtProblemEvent := &DTProblemEvent{PID: "93327"}
+			dtProblemEvent.ProblemDetails.SeverityLevel = tt.severityLevel
+			dtProblemEvent.ProblemDetails.ImpactLevel = tt.impactLevel
+
+			eh := ProblemEventHandler{ctx: context.Background()}
+			rule := eh.findRemediationRule(tt.dynatraceConfig, dtProblemEvent)
+			if got := getRemediationSequence(rule); got != tt.wantSequence {
+				t.Errorf("findRemediationRule() sequence = %s, want %s", got, tt.wantSequence)
+			}
+			problemType := ""
+			if rule != nil {
+				problemType = rule.ProblemType
+			}
+			if problemType != tt.wantProblemType {
+				t.Errorf("findRemediationRule() problemType = %s, want %s", problemType, tt.wantProblemType)
+			}
+		})
+	}
+}
+
+func TestProblemEventHandler_extractContextFromDynatraceProblem(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		tags            string
+		keptnProject    string
+		keptnStage      string
+		keptnService    string
+		managementZones []string
+		wantProject     string
+		wantStage       string
+		wantService     string
+	}{
+		{
+			name:        "context from tags with the default keys",
+			tags:        "keptn_project:sockshop, keptn_stage:production, keptn_service:carts, app:carts",
+			wantProject: "sockshop",
+			wantStage:   "production",
+			wantService: "carts",
+		},
+		{
+			name: "context from tags with custom keys",
+			env: map[string]string{
+				"PROBLEM_PROJECT_TAG": "project",
+				"PROBLEM_STAGE_TAG":   "environment",
+				"PROBLEM_SERVICE_TAG": "app",
+			},
+			tags:        "keptn_project:other, project:sockshop, environment:production, app:carts",
+			wantProject: "sockshop",
+			wantStage:   "production",
+			wantService: "carts",
+		},
+		{
+			name:         "problem data fields are used as defaults and overridden by tags",
+			tags:         "keptn_service:carts",
+			keptnProject: "sockshop",
+			keptnStage:   "production",
+			keptnService: "orders",
+			wantProject:  "sockshop",
+			wantStage:    "production",
+			wantService:  "carts",
+		},
+		{
+			name: "context mapping rule matching the management zone",
+			env: map[string]string{
+				"PROBLEM_CONTEXT_MAPPING": `[{"tag": "hostgroup:backend", "project": "backend", "stage": "production", "service": "db"}, {"managementZone": "Frontend", "project": "frontend", "stage": "production", "service": "web"}]`,
+			},
+			tags:            "hostgroup:frontend",
+			managementZones: []string{"Frontend"},
+			wantProject:     "frontend",
+			wantStage:       "production",
+			wantService:     "web",
+		},
+		{
+			name: "context mapping rule matching the tag fills in what's missing",
+			env: map[string]string{
+				"PROBLEM_CONTEXT_MAPPING": `[{"tag": "hostgroup", "project": "backend", "stage": "production", "service": "db"}]`,
+			},
+			tags:        "hostgroup:backend, keptn_service:carts",
+			wantProject: "backend",
+			wantStage:   "production",
+			wantService: "carts",
+		},
+		{
+			name: "defaults for problems that can't be mapped",
+			env: map[string]string{
+				"PROBLEM_CONTEXT_MAPPING": `[{"managementZone": "Frontend", "project": "frontend", "stage": "production", "service": "web"}]`,
+				"PROBLEM_DEFAULT_PROJECT": "dynatrace",
+				"PROBLEM_DEFAULT_STAGE":   "quality-gate",
+				"PROBLEM_DEFAULT_SERVICE": "problems",
+			},
+			tags:            "hostgroup:backend, keptn_stage:production",
+			managementZones: []string{"Backend"},
+			wantProject:     "dynatrace",
+			wantStage:       "production",
+			wantService:     "problems",
+		},
+		{
+			name:        "no context without tags and defaults",
+			tags:        "hostgroup:backend",
+			wantProject: "",
+			wantStage:   "",
+			wantService: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				os.Setenv(name, value)
+				defer os.Unsetenv(name)
+			}
+			dtProblemEvent := &DTProblemEvent{
+				PID:             "93327",
+				Tags:            tt.tags,
+				KeptnProject:    tt.keptnProject,
+				KeptnStage:      tt.keptnStage,
+				KeptnService:    tt.keptnService,
+				ManagementZones: tt.managementZones,
+			}
+
+			eh := ProblemEventHandler{ctx: context.Background()}
+			project, stage, service := eh.extractContextFromDynatraceProblem(dtProblemEvent)
+			if project != tt.wantProject || stage != tt.wantStage || service != tt.wantService {
+				t.Errorf("extractContextFromDynatraceProblem() = %s/%s/%s, want %s/%s/%s", project, stage, service, tt.wantProject, tt.wantStage, tt.wantService)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package event_handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/worker"
+	log "github.com/sirupsen/logrus"
+)
+
+// problemSinkClient sends the requests to the problem sinks - the timeout keeps a slow sink from blocking the remediation
+var problemSinkClient = &http.Client{Timeout: 10 * time.Second}
+
+// problemSinkPool sends the requests to the problem sinks with a limited number of workers, so that a burst of problems can't start an unlimited number of requests
+var problemSinkPool = worker.NewPool(4, 100)
+
+// getSecretValue reads the values of the secretHeaders of the sinks - it is a variable so that it can be replaced in tests
+var getSecretValue = credentials.GetProblemSinkSecretValue
+
+// problemSinkData is passed to the payload templates of the problem sinks and is sent as JSON to sinks without payload template
+type problemSinkData struct {
+	Problem      ProblemDetails `json:"problem"`
+	Project      string         `json:"project"`
+	Stage        string         `json:"stage"`
+	Service      string         `json:"service"`
+	KeptnContext string         `json:"keptnContext"`
+}
+
+// problemSinkFuncs are the functions available in the payload templates, e.g: {"text": {{json .Problem.ProblemTitle}}} to escape the title as JSON string
+var problemSinkFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		jsonValue, err := json.Marshal(value)
+		return string(jsonValue), err
+	},
+}
+
+/**
+ * Forwards the problem to the problemSinks of the dynatrace.conf.yaml of the project, stage and service it was mapped to
+ * The sinks are called by the problemSinkPool, so that slow sinks don't delay the remediation. A failing sink is retried like the requests to the Dynatrace API
+ */
+func (eh ProblemEventHandler) forwardProblemToSinks(dynatraceConfig *config.DynatraceConfigFile, dtProblemEvent *DTProblemEvent, project string, stage string, service string, shkeptncontext string) {
+	logger := logging.FromContext(eh.ctx)
+	if dynatraceConfig == nil || len(dynatraceConfig.ProblemSinks) == 0 {
+		return
+	}
+
+	problemDetailsString, _ := json.Marshal(dtProblemEvent.ProblemDetails)
+	data := problemSinkData{
+		Problem: ProblemDetails{
+			State:            dtProblemEvent.State,
+			PID:              dtProblemEvent.PID,
+			ProblemID:        dtProblemEvent.ProblemID,
+			ProblemTitle:     dtProblemEvent.ProblemTitle,
+			ProblemDetails:   json.RawMessage(problemDetailsString),
+			ProblemURL:       dtProblemEvent.ProblemURL,
+			ImpactedEntity:   dtProblemEvent.ImpactedEntity,
+			Tags:             dtProblemEvent.Tags,
+			ImpactedEntities: dtProblemEvent.ImpactedEntities,
+			RootCauseEntity:  dtProblemEvent.RootCauseEntity,
+			ProblemFilters:   dtProblemEvent.ProblemFilters,
+		},
+		Project:      project,
+		Stage:        stage,
+		Service:      service,
+		KeptnContext: shkeptncontext,
+	}
+
+	for i, sink := range dynatraceConfig.ProblemSinks {
+		if !sink.Matches(dtProblemEvent.State) {
+			continue
+		}
+		name := sink.Name
+		if name == "" {
+			name = fmt.Sprintf("problemSinks[%d]", i)
+		}
+		sinkLogger := logger.WithFields(
+			log.Fields{
+				"PID":  dtProblemEvent.PID,
+				"sink": name,
+			})
+
+		sink := sink
+		err := problemSinkPool.Submit(func() {
+			forwardProblemToSink(sinkLogger, name, sink, data)
+		})
+		if err != nil {
+			sinkLogger.WithError(err).Error("Could not forward problem to sink")
+		}
+	}
+}
+
+// forwardProblemToSink sends the problem to the sink and queues it for retries if the sink fails
+func forwardProblemToSink(logger *log.Entry, name string, sink config.DtProblemSink, data problemSinkData) {
+	send := func() error {
+		return sendProblemToSink(sink, data)
+	}
+	if err := send(); err != nil {
+		logger.WithError(err).Warn("Could not forward problem to sink - will be retried")
+		lib.RetryInBackground(logger, "forward problem "+data.Problem.PID+" to sink "+name, err, send, func(err error) {
+			logger.WithError(err).Error("Could not forward problem to sink")
+		})
+		return
+	}
+	logger.Info("Forwarded problem to sink")
+}
+
+// sendProblemToSink sends the rendered payload of the sink or the problem as JSON to the URL of the sink
+func sendProblemToSink(sink config.DtProblemSink, data problemSinkData) error {
+	payload, err := renderProblemSinkPayload(sink.Payload, data)
+	if err != nil {
+		return err
+	}
+
+	method := sink.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), sink.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range sink.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, secretKeyRef := range sink.SecretHeaders {
+		value, err := getSecretValue(secretKeyRef.Secret, secretKeyRef.Key)
+		if err != nil {
+			return fmt.Errorf("could not read header %s: %v", key, err)
+		}
+		req.Header.Set(key, value)
+	}
+
+	resp, err := problemSinkClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("sink responded with status %s: %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// renderProblemSinkPayload renders the Go template of the payload of a sink - without template the data is sent as JSON
+func renderProblemSinkPayload(payloadTemplate string, data problemSinkData) ([]byte, error) {
+	if payloadTemplate == "" {
+		return json.Marshal(data)
+	}
+
+	tmpl, err := template.New("payload").Funcs(problemSinkFuncs).Parse(payloadTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse payload template: %v", err)
+	}
+
+	var payload bytes.Buffer
+	if err := tmpl.Execute(&payload, data); err != nil {
+		return nil, fmt.Errorf("could not render payload template: %v", err)
+	}
+	return payload.Bytes(), nil
+}
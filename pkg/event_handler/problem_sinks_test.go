@@ -0,0 +1,102 @@
+package event_handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+)
+
+func TestRenderProblemSinkPayload(t *testing.T) {
+	data := problemSinkData{
+		Problem: ProblemDetails{
+			State:        "OPEN",
+			ProblemID:    "P-1234",
+			ProblemTitle: `Response time "degradation"`,
+			PID:          "93327",
+			ProblemURL:   "https://my-tenant.live.dynatrace.com/#problems/problemdetails;pid=93327",
+		},
+		Project:      "sockshop",
+		Stage:        "production",
+		Service:      "carts",
+		KeptnContext: "my-keptn-context",
+	}
+
+	tests := []struct {
+		name            string
+		payloadTemplate string
+		want            string
+		wantErr         bool
+	}{
+		{
+			name:            "render template",
+			payloadTemplate: `{"text": {{json (printf "Problem %s: %s in %s" .Problem.ProblemID .Problem.ProblemTitle .Stage)}}}`,
+			want:            `{"text": "Problem P-1234: Response time \"degradation\" in production"}`,
+		},
+		{
+			name:            "send data as JSON without template",
+			payloadTemplate: "",
+			want: `{"problem":{"State":"OPEN","ProblemID":"P-1234","ProblemTitle":"Response time \"degradation\"","ProblemDetails":null,"PID":"93327",` +
+				`"ProblemURL":"https://my-tenant.live.dynatrace.com/#problems/problemdetails;pid=93327"},"project":"sockshop","stage":"production","service":"carts","keptnContext":"my-keptn-context"}`,
+		},
+		{
+			name:            "invalid template",
+			payloadTemplate: `{"text": {{json .Problem.ProblemTitle}`,
+			wantErr:         true,
+		},
+		{
+			name:            "unknown field",
+			payloadTemplate: `{{.Problem.Unknown}}`,
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderProblemSinkPayload(tt.payloadTemplate, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderProblemSinkPayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("renderProblemSinkPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendProblemToSink(t *testing.T) {
+	originalGetSecretValue := getSecretValue
+	defer func() { getSecretValue = originalGetSecretValue }()
+	getSecretValue = func(secretName string, secretKey string) (string, error) {
+		if secretName == "itsm-webhook" && secretKey == "AUTHORIZATION" {
+			return "Bearer my-itsm-token", nil
+		}
+		return "", errors.New("secret not found")
+	}
+
+	var received *http.Request
+	sinkMockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer sinkMockServer.Close()
+
+	sink := config.DtProblemSink{
+		URL:           sinkMockServer.URL,
+		Method:        "put",
+		Headers:       map[string]string{"X-Source": "keptn"},
+		SecretHeaders: map[string]config.DtSecretKeyRef{"Authorization": {Secret: "itsm-webhook", Key: "AUTHORIZATION"}},
+	}
+	if err := sendProblemToSink(sink, problemSinkData{Project: "sockshop"}); err != nil {
+		t.Fatalf("sendProblemToSink() error = %v", err)
+	}
+	if received.Method != http.MethodPut || received.Header.Get("X-Source") != "keptn" || received.Header.Get("Authorization") != "Bearer my-itsm-token" {
+		t.Errorf("sendProblemToSink() sent %s with headers %v, want PUT with the headers and the secret headers of the sink", received.Method, received.Header)
+	}
+
+	sink.SecretHeaders = map[string]config.DtSecretKeyRef{"Authorization": {Secret: "missing", Key: "AUTHORIZATION"}}
+	if err := sendProblemToSink(sink, problemSinkData{Project: "sockshop"}); err == nil {
+		t.Errorf("sendProblemToSink() expected an error for a missing secret")
+	}
+}
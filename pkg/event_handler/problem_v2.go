@@ -0,0 +1,245 @@
+package event_handler
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// dtProblemV2Entity is an entity as referenced in the problem object of the Dynatrace Problems API v2
+type dtProblemV2Entity struct {
+	EntityID struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"entityId"`
+	Name string `json:"name"`
+}
+
+// toDTProblemEntity converts the entity to the format of the legacy problem notification, returns nil for a nil entity
+func (e *dtProblemV2Entity) toDTProblemEntity() *dtProblemEntity {
+	if e == nil {
+		return nil
+	}
+	return &dtProblemEntity{
+		Entity: e.EntityID.ID,
+		Name:   e.Name,
+		Type:   e.EntityID.Type,
+	}
+}
+
+// dtProblemV2ManagementZone is a management zone as referenced in the problem object of the Dynatrace Problems API v2
+type dtProblemV2ManagementZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// dtProblemV2ProblemFilter is an alerting profile as referenced in the problem object of the Dynatrace Problems API v2
+type dtProblemV2ProblemFilter struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// dtProblemV2Tag is an entity tag as referenced in the problem object of the Dynatrace Problems API v2
+type dtProblemV2Tag struct {
+	Context              string `json:"context"`
+	Key                  string `json:"key"`
+	Value                string `json:"value,omitempty"`
+	StringRepresentation string `json:"stringRepresentation"`
+}
+
+// String returns the tag as string of the form [context]key:value as used by the legacy problem notification
+func (t dtProblemV2Tag) String() string {
+	if t.StringRepresentation != "" {
+		return t.StringRepresentation
+	}
+	tag := t.Key
+	if t.Value != "" {
+		tag = tag + ":" + t.Value
+	}
+	if t.Context != "" && t.Context != "CONTEXTLESS" {
+		tag = "[" + t.Context + "]" + tag
+	}
+	return tag
+}
+
+// dtProblemV2Event is a problem notification in the JSON format of the problem object of the Dynatrace Problems API v2
+type dtProblemV2Event struct {
+	ProblemID        string                      `json:"problemId"`
+	DisplayID        string                      `json:"displayId"`
+	Title            string                      `json:"title"`
+	ImpactLevel      string                      `json:"impactLevel"`
+	SeverityLevel    string                      `json:"severityLevel"`
+	Status           string                      `json:"status"`
+	StartTime        int64                       `json:"startTime"`
+	EndTime          int64                       `json:"endTime"`
+	AffectedEntities []dtProblemV2Entity         `json:"affectedEntities"`
+	ImpactedEntities []dtProblemV2Entity         `json:"impactedEntities"`
+	RootCauseEntity  *dtProblemV2Entity          `json:"rootCauseEntity"`
+	ManagementZones  []dtProblemV2ManagementZone `json:"managementZones"`
+	EntityTags       []dtProblemV2Tag            `json:"entityTags"`
+	ProblemFilters   []dtProblemV2ProblemFilter  `json:"problemFilters"`
+	ProblemURL       string                      `json:"problemUrl"`
+	EventContext     struct {
+		KeptnContext string `json:"keptnContext"`
+		Token        string `json:"token"`
+	} `json:"eventContext"`
+	KeptnProject string `json:"keptnProject"`
+	KeptnService string `json:"keptnService"`
+	KeptnStage   string `json:"keptnStage"`
+}
+
+/**
+ * Parses a Dynatrace problem notification - either in the legacy custom integration format (PID, ProblemDetails, Tags as string)
+ * or in the format of the problem object of the Problems API v2 (problemId, entityTags, managementZones, ...), which may also be wrapped into a "problem" field
+ * Problems in the v2 format are converted to the legacy format so that they are handled the same way
+ */
+func parseDynatraceProblemEvent(data []byte) (*DTProblemEvent, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	// the legacy format always contains the PID - field names are compared case sensitive as v2 uses the same names in camel case
+	if _, isLegacy := fields["PID"]; !isLegacy {
+		if problem, isWrapped := fields["problem"]; isWrapped {
+			data = problem
+			fields = map[string]json.RawMessage{}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				return nil, err
+			}
+		}
+		if _, isV2 := fields["problemId"]; isV2 {
+			dtProblemV2 := &dtProblemV2Event{}
+			if err := json.Unmarshal(data, dtProblemV2); err != nil {
+				return nil, err
+			}
+			return dtProblemV2.toDTProblemEvent(), nil
+		}
+	}
+
+	dtProblemEvent := &DTProblemEvent{}
+	if err := json.Unmarshal(data, dtProblemEvent); err != nil {
+		return nil, err
+	}
+	for _, managementZone := range dtProblemEvent.ProblemDetails.ManagementZones {
+		dtProblemEvent.ManagementZones = append(dtProblemEvent.ManagementZones, managementZone.Name)
+	}
+	dtProblemEvent.RootCauseEntity = dtProblemEvent.ProblemDetails.RootCauseEntity.toDTProblemEntity()
+	return dtProblemEvent, nil
+}
+
+// toDTProblemEvent converts a v2 problem to the legacy problem notification format
+func (p *dtProblemV2Event) toDTProblemEvent() *DTProblemEvent {
+	dtProblemEvent := &DTProblemEvent{
+		PID:          p.ProblemID,
+		ProblemID:    p.DisplayID,
+		ProblemTitle: p.Title,
+		ProblemURL:   p.ProblemURL,
+		State:        p.Status,
+		KeptnProject: p.KeptnProject,
+		KeptnStage:   p.KeptnStage,
+		KeptnService: p.KeptnService,
+		EventContext: p.EventContext,
+	}
+
+	// v2 problems are CLOSED while the legacy notification reports them as RESOLVED
+	if p.Status == "CLOSED" {
+		dtProblemEvent.State = "RESOLVED"
+	}
+
+	dtProblemEvent.ProblemDetails.ID = p.ProblemID
+	dtProblemEvent.ProblemDetails.DisplayName = p.DisplayID
+	dtProblemEvent.ProblemDetails.ImpactLevel = p.ImpactLevel
+	dtProblemEvent.ProblemDetails.SeverityLevel = p.SeverityLevel
+	dtProblemEvent.ProblemDetails.Status = p.Status
+	dtProblemEvent.ProblemDetails.StartTime = p.StartTime
+	dtProblemEvent.ProblemDetails.EndTime = int(p.EndTime)
+	dtProblemEvent.ProblemDetails.HasRootCause = p.RootCauseEntity != nil
+	dtProblemEvent.ProblemDetails.RootCauseEntity = p.RootCauseEntity
+	dtProblemEvent.RootCauseEntity = p.RootCauseEntity.toDTProblemEntity()
+
+	impactedEntities := p.ImpactedEntities
+	if len(impactedEntities) == 0 {
+		impactedEntities = p.AffectedEntities
+	}
+	var impactedEntityNames []string
+	for _, entity := range impactedEntities {
+		dtProblemEvent.ImpactedEntities = append(dtProblemEvent.ImpactedEntities, *entity.toDTProblemEntity())
+		impactedEntityNames = append(impactedEntityNames, entity.Name)
+	}
+	dtProblemEvent.ImpactedEntity = strings.Join(impactedEntityNames, ", ")
+
+	var tags []string
+	for _, tag := range p.EntityTags {
+		tags = append(tags, tag.String())
+	}
+	dtProblemEvent.Tags = strings.Join(tags, ", ")
+
+	for _, managementZone := range p.ManagementZones {
+		dtProblemEvent.ManagementZones = append(dtProblemEvent.ManagementZones, managementZone.Name)
+	}
+
+	for _, problemFilter := range p.ProblemFilters {
+		dtProblemEvent.ProblemFilters = append(dtProblemEvent.ProblemFilters, problemFilter.Name)
+	}
+
+	return dtProblemEvent
+}
+
+/**
+ * Merges the details of the problem fetched from the Problems API v2 into the problem notification
+ * Fields of the notification are kept - only details that are missing are added while tags, management zones and problem filters are combined
+ */
+func (e *DTProblemEvent) merge(details *DTProblemEvent) {
+	if len(e.ImpactedEntities) == 0 {
+		e.ImpactedEntities = details.ImpactedEntities
+	}
+	if e.ImpactedEntity == "" {
+		e.ImpactedEntity = details.ImpactedEntity
+	}
+	if e.RootCauseEntity == nil {
+		e.RootCauseEntity = details.RootCauseEntity
+		e.ProblemDetails.RootCauseEntity = details.ProblemDetails.RootCauseEntity
+		e.ProblemDetails.HasRootCause = details.ProblemDetails.HasRootCause
+	}
+	if e.ProblemDetails.SeverityLevel == "" {
+		e.ProblemDetails.SeverityLevel = details.ProblemDetails.SeverityLevel
+	}
+	if e.ProblemDetails.ImpactLevel == "" {
+		e.ProblemDetails.ImpactLevel = details.ProblemDetails.ImpactLevel
+	}
+
+	tags := strings.Split(e.Tags, ",")
+	for i := range tags {
+		tags[i] = strings.TrimSpace(tags[i])
+	}
+	for _, tag := range strings.Split(details.Tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !containsString(tags, tag) {
+			if e.Tags != "" {
+				e.Tags = e.Tags + ", "
+			}
+			e.Tags = e.Tags + tag
+			tags = append(tags, tag)
+		}
+	}
+
+	for _, managementZone := range details.ManagementZones {
+		if !containsString(e.ManagementZones, managementZone) {
+			e.ManagementZones = append(e.ManagementZones, managementZone)
+		}
+	}
+	for _, problemFilter := range details.ProblemFilters {
+		if !containsString(e.ProblemFilters, problemFilter) {
+			e.ProblemFilters = append(e.ProblemFilters, problemFilter)
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package event_handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDynatraceProblemEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    func() *DTProblemEvent
+		wantErr bool
+	}{
+		{
+			name: "legacy format",
+			data: `{"PID": "93327", "ProblemID": "P-1234", "ProblemTitle": "Response time degradation", "State": "OPEN", "Tags": "keptn_project:sockshop, keptn_stage:production",
+				"ImpactedEntity": "carts", "ProblemDetails": {"id": "93327", "displayName": "P-1234", "severityLevel": "PERFORMANCE", "startTime": 1571649084000},
+				"KeptnProject": "sockshop", "KeptnStage": "production", "KeptnService": "carts"}`,
+			want: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					PID:            "93327",
+					ProblemID:      "P-1234",
+					ProblemTitle:   "Response time degradation",
+					State:          "OPEN",
+					Tags:           "keptn_project:sockshop, keptn_stage:production",
+					ImpactedEntity: "carts",
+					KeptnProject:   "sockshop",
+					KeptnStage:     "production",
+					KeptnService:   "carts",
+				}
+				e.ProblemDetails.ID = "93327"
+				e.ProblemDetails.DisplayName = "P-1234"
+				e.ProblemDetails.SeverityLevel = "PERFORMANCE"
+				e.ProblemDetails.StartTime = 1571649084000
+				return e
+			},
+		},
+		{
+			name: "legacy format with problem details in the v2 format",
+			data: `{"PID": "93327", "ProblemID": "P-1234", "State": "OPEN",
+				"ProblemDetails": {"id": "93327", "managementZones": [{"id": "1", "name": "Keptn: sockshop production"}], "rootCauseEntity": {"entityId": {"id": "SERVICE-1", "type": "SERVICE"}, "name": "carts"}}}`,
+			want: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					PID:             "93327",
+					ProblemID:       "P-1234",
+					State:           "OPEN",
+					ManagementZones: []string{"Keptn: sockshop production"},
+					RootCauseEntity: &dtProblemEntity{Entity: "SERVICE-1", Name: "carts", Type: "SERVICE"},
+				}
+				e.ProblemDetails.ID = "93327"
+				e.ProblemDetails.ManagementZones = []dtProblemV2ManagementZone{{ID: "1", Name: "Keptn: sockshop production"}}
+				e.ProblemDetails.RootCauseEntity = &dtProblemV2Entity{Name: "carts"}
+				e.ProblemDetails.RootCauseEntity.EntityID.ID = "SERVICE-1"
+				e.ProblemDetails.RootCauseEntity.EntityID.Type = "SERVICE"
+				return e
+			},
+		},
+		{
+			name: "v2 format",
+			data: `{"problemId": "-123_456V2", "displayId": "P-1234", "title": "Response time degradation", "status": "CLOSED", "impactLevel": "SERVICES", "severityLevel": "PERFORMANCE",
+				"startTime": 1571649084000, "endTime": 1571649085000,
+				"affectedEntities": [{"entityId": {"id": "SERVICE-1", "type": "SERVICE"}, "name": "carts"}, {"entityId": {"id": "SERVICE-2", "type": "SERVICE"}, "name": "orders"}],
+				"entityTags": [{"context": "CONTEXTLESS", "key": "keptn_project", "value": "sockshop"}, {"context": "ENVIRONMENT", "key": "team"}, {"key": "ignored", "stringRepresentation": "keptn_stage:production"}],
+				"managementZones": [{"id": "1", "name": "Keptn: sockshop production"}], "problemFilters": [{"id": "2", "name": "Keptn"}],
+				"keptnProject": "sockshop", "keptnStage": "production", "keptnService": "carts"}`,
+			want: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					PID:          "-123_456V2",
+					ProblemID:    "P-1234",
+					ProblemTitle: "Response time degradation",
+					State:        "RESOLVED",
+					ImpactedEntities: []dtProblemEntity{
+						{Entity: "SERVICE-1", Name: "carts", Type: "SERVICE"},
+						{Entity: "SERVICE-2", Name: "orders", Type: "SERVICE"},
+					},
+					ImpactedEntity:  "carts, orders",
+					Tags:            "keptn_project:sockshop, [ENVIRONMENT]team, keptn_stage:production",
+					ManagementZones: []string{"Keptn: sockshop production"},
+					ProblemFilters:  []string{"Keptn"},
+					KeptnProject:    "sockshop",
+					KeptnStage:      "production",
+					KeptnService:    "carts",
+				}
+				e.ProblemDetails.ID = "-123_456V2"
+				e.ProblemDetails.DisplayName = "P-1234"
+				e.ProblemDetails.ImpactLevel = "SERVICES"
+				e.ProblemDetails.SeverityLevel = "PERFORMANCE"
+				e.ProblemDetails.Status = "CLOSED"
+				e.ProblemDetails.StartTime = 1571649084000
+				e.ProblemDetails.EndTime = 1571649085000
+				return e
+			},
+		},
+		{
+			name: "v2 format wrapped into a problem field prefers the impacted entities",
+			data: `{"problem": {"problemId": "-123_456V2", "displayId": "P-1234", "status": "OPEN",
+				"affectedEntities": [{"entityId": {"id": "SERVICE-1", "type": "SERVICE"}, "name": "carts"}],
+				"impactedEntities": [{"entityId": {"id": "APPLICATION-1", "type": "APPLICATION"}, "name": "sockshop"}],
+				"rootCauseEntity": {"entityId": {"id": "SERVICE-1", "type": "SERVICE"}, "name": "carts"}}}`,
+			want: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					PID:              "-123_456V2",
+					ProblemID:        "P-1234",
+					State:            "OPEN",
+					ImpactedEntities: []dtProblemEntity{{Entity: "APPLICATION-1", Name: "sockshop", Type: "APPLICATION"}},
+					ImpactedEntity:   "sockshop",
+					RootCauseEntity:  &dtProblemEntity{Entity: "SERVICE-1", Name: "carts", Type: "SERVICE"},
+				}
+				e.ProblemDetails.ID = "-123_456V2"
+				e.ProblemDetails.DisplayName = "P-1234"
+				e.ProblemDetails.Status = "OPEN"
+				e.ProblemDetails.HasRootCause = true
+				e.ProblemDetails.RootCauseEntity = &dtProblemV2Entity{Name: "carts"}
+				e.ProblemDetails.RootCauseEntity.EntityID.ID = "SERVICE-1"
+				e.ProblemDetails.RootCauseEntity.EntityID.Type = "SERVICE"
+				return e
+			},
+		},
+		{
+			name:    "invalid JSON",
+			data:    `{"PID": "93327"`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			data:    `["93327"]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid problem field",
+			data:    `{"problem": "P-1234"}`,
+			wantErr: true,
+		},
+		{
+			name:    "v2 format with invalid field type",
+			data:    `{"problemId": "-123_456V2", "startTime": "yesterday"}`,
+			wantErr: true,
+		},
+		{
+			name:    "legacy format with invalid field type",
+			data:    `{"PID": 93327}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDynatraceProblemEvent([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDynatraceProblemEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := tt.want(); !reflect.DeepEqual(got, want) {
+				t.Errorf("parseDynatraceProblemEvent() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDTProblemEvent_merge(t *testing.T) {
+	rootCause := &dtProblemEntity{Entity: "SERVICE-1", Name: "carts", Type: "SERVICE"}
+
+	tests := []struct {
+		name    string
+		event   func() *DTProblemEvent
+		details func() *DTProblemEvent
+		want    func() *DTProblemEvent
+	}{
+		{
+			name: "missing details are added",
+			event: func() *DTProblemEvent {
+				return &DTProblemEvent{PID: "93327", Tags: "keptn_project:sockshop"}
+			},
+			details: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					PID:              "-123_456V2",
+					ImpactedEntities: []dtProblemEntity{*rootCause},
+					ImpactedEntity:   "carts",
+					RootCauseEntity:  rootCause,
+					Tags:             "keptn_project:sockshop, keptn_stage:production",
+					ManagementZones:  []string{"Keptn: sockshop production"},
+					ProblemFilters:   []string{"Keptn"},
+				}
+				e.ProblemDetails.HasRootCause = true
+				e.ProblemDetails.SeverityLevel = "PERFORMANCE"
+				e.ProblemDetails.ImpactLevel = "SERVICES"
+				return e
+			},
+			want: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					PID:              "93327",
+					ImpactedEntities: []dtProblemEntity{*rootCause},
+					ImpactedEntity:   "carts",
+					RootCauseEntity:  rootCause,
+					Tags:             "keptn_project:sockshop, keptn_stage:production",
+					ManagementZones:  []string{"Keptn: sockshop production"},
+					ProblemFilters:   []string{"Keptn"},
+				}
+				e.ProblemDetails.HasRootCause = true
+				e.ProblemDetails.SeverityLevel = "PERFORMANCE"
+				e.ProblemDetails.ImpactLevel = "SERVICES"
+				return e
+			},
+		},
+		{
+			name: "fields of the notification are kept and lists are combined without duplicates",
+			event: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					ImpactedEntity:  "orders",
+					RootCauseEntity: &dtProblemEntity{Entity: "SERVICE-2", Name: "orders", Type: "SERVICE"},
+					Tags:            "keptn_project:sockshop,team:a",
+					ManagementZones: []string{"Keptn: sockshop production"},
+					ProblemFilters:  []string{"Keptn"},
+				}
+				e.ProblemDetails.SeverityLevel = "ERROR"
+				return e
+			},
+			details: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					ImpactedEntity:  "carts",
+					RootCauseEntity: rootCause,
+					Tags:            "team:a, team:b",
+					ManagementZones: []string{"Keptn: sockshop production", "Production"},
+					ProblemFilters:  []string{"Keptn", "Default"},
+				}
+				e.ProblemDetails.SeverityLevel = "PERFORMANCE"
+				return e
+			},
+			want: func() *DTProblemEvent {
+				e := &DTProblemEvent{
+					ImpactedEntity:  "orders",
+					RootCauseEntity: &dtProblemEntity{Entity: "SERVICE-2", Name: "orders", Type: "SERVICE"},
+					Tags:            "keptn_project:sockshop,team:a, team:b",
+					ManagementZones: []string{"Keptn: sockshop production", "Production"},
+					ProblemFilters:  []string{"Keptn", "Default"},
+				}
+				e.ProblemDetails.SeverityLevel = "ERROR"
+				return e
+			},
+		},
+		{
+			name: "empty details",
+			event: func() *DTProblemEvent {
+				return &DTProblemEvent{PID: "93327"}
+			},
+			details: func() *DTProblemEvent {
+				return &DTProblemEvent{}
+			},
+			want: func() *DTProblemEvent {
+				return &DTProblemEvent{PID: "93327"}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.event()
+			got.merge(tt.details())
+			if want := tt.want(); !reflect.DeepEqual(got, want) {
+				t.Errorf("merge() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
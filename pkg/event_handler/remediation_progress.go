@@ -0,0 +1,86 @@
+package event_handler
+
+import (
+	"fmt"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/adapter"
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/lib"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+/**
+ * Posts a comment on the Dynatrace problem when a task of its remediation sequence is started or finished, e.g: Keptn task deployment finished with result pass
+ * Only events of sequences that were triggered for a Dynatrace problem, i.e. that have the Problem URL label, are considered
+ * and only if remediationProgressComments is enabled in the dynatrace.conf.yaml
+ */
+func (eh CDEventHandler) commentRemediationProgress(keptnHandler *keptnv2.Keptn, shkeptncontext string) {
+	logger := logging.FromContext(eh.ctx)
+	task, kind, err := keptnv2.ParseTaskEventType(eh.Event.Type())
+	if err != nil || keptnHandler == nil || (kind != "started" && kind != "finished") {
+		return
+	}
+	// the remediation evaluation already has its own comment
+	if task == keptnv2.EvaluationTaskName && kind == "finished" {
+		return
+	}
+
+	eventData := &keptnv2.EventData{}
+	if err := eh.Event.DataAs(eventData); err != nil {
+		return
+	}
+	if _, isProblemSequence := eventData.Labels[common.PROBLEMURL_LABEL]; !isProblemSequence {
+		return
+	}
+
+	keptnEvent := adapter.NewTaskEventAdapter(*eventData, eh.Event.Type(), shkeptncontext, eh.Event.Source())
+	dynatraceConfig, err := eh.dtConfigGetter.GetDynatraceConfig(keptnEvent)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load Dynatrace config")
+		return
+	}
+	if dynatraceConfig == nil || !dynatraceConfig.RemediationProgressComments {
+		return
+	}
+
+	pid, err := common.FindProblemIDForEvent(keptnHandler, eventData.Labels)
+	if err != nil || pid == "" {
+		logger.WithError(err).Error("Could not find the Dynatrace problem of the remediation")
+		return
+	}
+
+	creds, err := credentials.GetDynatraceCredentialsForStage(dynatraceConfig, keptnEvent.GetProject(), keptnEvent.GetStage())
+	if err != nil {
+		logger.WithError(err).Error("Failed to load Dynatrace credentials")
+		return
+	}
+
+	bridgeURL := eventData.Labels[common.KEPTNSBRIDGE_LABEL]
+	comment := renderProblemComment(eh.ctx, getProblemComments(dynatraceConfig).TaskProgress, problemCommentData{
+		Event:   eventData,
+		Labels:  eventData.Labels,
+		Bridge:  bridgeURL,
+		Source:  eh.Event.Source(),
+		Comment: createTaskProgressComment(task, kind, eventData, eh.Event.Source(), bridgeURL),
+	})
+
+	dtHelper := lib.NewDynatraceHelper(keptnHandler, creds)
+	dtHelper.EventContext = eh.ctx
+	if err := dtHelper.SendProblemComment(pid, comment); err != nil {
+		logger.WithError(err).WithField("PID", pid).Error("Could not send remediation progress as problem comment")
+	}
+}
+
+// createTaskProgressComment returns the default comment for a started or finished task, e.g: [Keptn task](bridge) deployment finished by helm-service with result pass
+func createTaskProgressComment(task string, kind string, eventData *keptnv2.EventData, source string, bridgeURL string) string {
+	comment := fmt.Sprintf("[Keptn task](%s) %s %s by %s", bridgeURL, task, kind, source)
+	if kind == "finished" {
+		comment = comment + " with result " + string(eventData.Result)
+		if eventData.Message != "" {
+			comment = comment + ": " + eventData.Message
+		}
+	}
+	return comment
+}
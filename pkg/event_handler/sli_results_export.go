@@ -0,0 +1,135 @@
+package event_handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+const sliResultsExportFormatJSON = "json"
+const sliResultsExportFormatCSV = "csv"
+
+// sliResultsExport is the machine-readable export of the SLI results of an evaluation, e.g: for external reporting tools
+type sliResultsExport struct {
+	KeptnContext string            `json:"keptnContext"`
+	Project      string            `json:"project"`
+	Stage        string            `json:"stage"`
+	Service      string            `json:"service"`
+	Start        string            `json:"start"`
+	End          string            `json:"end"`
+	Dashboards   []string          `json:"dashboards,omitempty"`
+	Results      []sliResultExport `json:"results"`
+}
+
+// sliResultExport is the result of a single SLI with the query it is defined by and the query URLs that were executed against the Dynatrace API
+type sliResultExport struct {
+	Metric          string   `json:"metric"`
+	Value           float64  `json:"value"`
+	Success         bool     `json:"success"`
+	Message         string   `json:"message,omitempty"`
+	Query           string   `json:"query,omitempty"`
+	ExecutedQueries []string `json:"executedQueries,omitempty"`
+}
+
+// newSLIResultsExport creates the export of the SLI results - queries and executedQueries contain the queries of the SLIs by their name
+func newSLIResultsExport(keptnEvent *common_sli.BaseKeptnEvent, eventData *keptnv2.GetSLITriggeredEventData, dashboardLinks []string, sliResults []*keptnv2.SLIResult, queries map[string]string, executedQueries map[string][]string) sliResultsExport {
+	export := sliResultsExport{
+		KeptnContext: keptnEvent.Context,
+		Project:      keptnEvent.Project,
+		Stage:        keptnEvent.Stage,
+		Service:      keptnEvent.Service,
+		Start:        eventData.GetSLI.Start,
+		End:          eventData.GetSLI.End,
+		Dashboards:   dashboardLinks,
+		Results:      []sliResultExport{},
+	}
+	for _, sliResult := range sliResults {
+		export.Results = append(export.Results, sliResultExport{
+			Metric:          sliResult.Metric,
+			Value:           sliResult.Value,
+			Success:         sliResult.Success,
+			Message:         sliResult.Message,
+			Query:           queries[sliResult.Metric],
+			ExecutedQueries: executedQueries[sliResult.Metric],
+		})
+	}
+	return export
+}
+
+/**
+ * Stores the SLI results export in each of the formats of exportSLIResults in the dynatrace.conf.yaml as dynatrace/results/<time>_<keptnContext>.<format> on service level
+ * Only the last retention exports per format are kept. A failed export is only logged, as it should not fail the evaluation
+ */
+func storeSLIResultsExport(ctx context.Context, keptnEvent *common_sli.BaseKeptnEvent, formats []string, retention int, export sliResultsExport) {
+	logger := logging.FromContext(ctx)
+	commitMessage := "SLI results of keptnContext " + keptnEvent.Context
+	exportedAt := time.Now()
+
+	for _, format := range formats {
+		format = strings.ToLower(format)
+
+		var content []byte
+		var err error
+		switch format {
+		case sliResultsExportFormatJSON:
+			content, err = json.MarshalIndent(export, "", "  ")
+		case sliResultsExportFormatCSV:
+			content, err = export.toCSV()
+		default:
+			logger.WithField("format", format).Warn("Unknown format of exportSLIResults in dynatrace.conf.yaml - use json or csv")
+			continue
+		}
+		if err != nil {
+			logger.WithError(err).WithField("format", format).Error("Could not export SLI results")
+			continue
+		}
+
+		resourceURI := common_sli.GetSLIResultsExportFilename(keptnEvent.Context, format, exportedAt)
+		if err := common_sli.UploadKeptnResourceWithCommitMessage(ctx, content, resourceURI, keptnEvent, commitMessage); err != nil {
+			logger.WithError(err).WithField("resourceURI", resourceURI).Error("Could not store SLI results export")
+			continue
+		}
+
+		if err := common_sli.DeleteExpiredSLIResultsExports(ctx, keptnEvent, format, retention); err != nil {
+			logger.WithError(err).WithField("format", format).Warn("Could not delete expired SLI results exports")
+		}
+	}
+}
+
+// toCSV returns one row per SLI result, which repeats the Keptn context and evaluation timeframe so that the rows of several exports can be concatenated
+func (e sliResultsExport) toCSV() ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	rows := [][]string{{"keptnContext", "project", "stage", "service", "start", "end", "metric", "value", "success", "message", "query", "executedQueries"}}
+	for _, result := range e.Results {
+		rows = append(rows, []string{
+			e.KeptnContext,
+			e.Project,
+			e.Stage,
+			e.Service,
+			e.Start,
+			e.End,
+			result.Metric,
+			strconv.FormatFloat(result.Value, 'f', -1, 64),
+			strconv.FormatBool(result.Success),
+			result.Message,
+			result.Query,
+			strings.Join(result.ExecutedQueries, " "),
+		})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("could not write CSV: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
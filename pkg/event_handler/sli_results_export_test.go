@@ -0,0 +1,135 @@
+package event_handler
+
+import (
+	"reflect"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+)
+
+func TestNewSLIResultsExport(t *testing.T) {
+	keptnEvent := &common_sli.BaseKeptnEvent{Context: "my-keptn-context", Project: "sockshop", Stage: "staging", Service: "carts"}
+	eventData := &keptnv2.GetSLITriggeredEventData{}
+	eventData.GetSLI.Start = "2020-01-15T13:57:00.000Z"
+	eventData.GetSLI.End = "2020-01-15T14:12:00.000Z"
+
+	tests := []struct {
+		name            string
+		dashboardLinks  []string
+		sliResults      []*keptnv2.SLIResult
+		queries         map[string]string
+		executedQueries map[string][]string
+		want            []sliResultExport
+	}{
+		{
+			name: "results with their queries",
+			sliResults: []*keptnv2.SLIResult{
+				{Metric: "response_time_p95", Value: 312.5, Success: true},
+				{Metric: "error_rate", Success: false, Message: "query failed"},
+			},
+			queries: map[string]string{
+				"response_time_p95": "metricSelector=builtin:service.response.time:merge(0):percentile(95)",
+				"error_rate":        "metricSelector=builtin:service.errors.total.rate:merge(0):avg",
+			},
+			executedQueries: map[string][]string{
+				"response_time_p95": {"https://abc12345.live.dynatrace.com/api/v2/metrics/query?metricSelector=builtin:service.response.time"},
+			},
+			want: []sliResultExport{
+				{
+					Metric:          "response_time_p95",
+					Value:           312.5,
+					Success:         true,
+					Query:           "metricSelector=builtin:service.response.time:merge(0):percentile(95)",
+					ExecutedQueries: []string{"https://abc12345.live.dynatrace.com/api/v2/metrics/query?metricSelector=builtin:service.response.time"},
+				},
+				{
+					Metric:  "error_rate",
+					Message: "query failed",
+					Query:   "metricSelector=builtin:service.errors.total.rate:merge(0):avg",
+				},
+			},
+		},
+		{
+			name:           "results without queries, e.g: the open problem SLI",
+			dashboardLinks: []string{"https://abc12345.live.dynatrace.com/#dashboard;id=12345"},
+			sliResults:     []*keptnv2.SLIResult{{Metric: "problem_open", Value: 1, Success: true}},
+			want:           []sliResultExport{{Metric: "problem_open", Value: 1, Success: true}},
+		},
+		{
+			name: "no results",
+			want: []sliResultExport{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newSLIResultsExport(keptnEvent, eventData, tt.dashboardLinks, tt.sliResults, tt.queries, tt.executedQueries)
+			if got.KeptnContext != "my-keptn-context" || got.Project != "sockshop" || got.Stage != "staging" || got.Service != "carts" {
+				t.Errorf("newSLIResultsExport() = %+v, want the context, project, stage and service of the event", got)
+			}
+			if got.Start != eventData.GetSLI.Start || got.End != eventData.GetSLI.End {
+				t.Errorf("newSLIResultsExport() timeframe = %s - %s, want %s - %s", got.Start, got.End, eventData.GetSLI.Start, eventData.GetSLI.End)
+			}
+			if !reflect.DeepEqual(got.Dashboards, tt.dashboardLinks) {
+				t.Errorf("newSLIResultsExport() dashboards = %v, want %v", got.Dashboards, tt.dashboardLinks)
+			}
+			if !reflect.DeepEqual(got.Results, tt.want) {
+				t.Errorf("newSLIResultsExport() results = %+v, want %+v", got.Results, tt.want)
+			}
+		})
+	}
+}
+
+func TestSLIResultsExport_toCSV(t *testing.T) {
+	header := "keptnContext,project,stage,service,start,end,metric,value,success,message,query,executedQueries\n"
+
+	tests := []struct {
+		name    string
+		results []sliResultExport
+		want    string
+	}{
+		{
+			name: "one row per result",
+			results: []sliResultExport{
+				{Metric: "response_time_p95", Value: 312.5, Success: true, Query: "metricSelector=builtin:service.response.time", ExecutedQueries: []string{"query1", "query2"}},
+				{Metric: "error_rate", Value: 0, Success: false, Message: "query failed"},
+			},
+			want: header +
+				"ctx,sockshop,staging,carts,2020-01-15T13:57:00.000Z,2020-01-15T14:12:00.000Z,response_time_p95,312.5,true,,metricSelector=builtin:service.response.time,query1 query2\n" +
+				"ctx,sockshop,staging,carts,2020-01-15T13:57:00.000Z,2020-01-15T14:12:00.000Z,error_rate,0,false,query failed,,\n",
+		},
+		{
+			name: "fields with separators and quotes are quoted",
+			results: []sliResultExport{
+				{Metric: "usql", Value: 1e6, Success: false, Message: "line 1,\n\"line 2\""},
+			},
+			want: header +
+				"ctx,sockshop,staging,carts,2020-01-15T13:57:00.000Z,2020-01-15T14:12:00.000Z,usql,1000000,false,\"line 1,\n\"\"line 2\"\"\",,\n",
+		},
+		{
+			name: "no results",
+			want: header,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := sliResultsExport{
+				KeptnContext: "ctx",
+				Project:      "sockshop",
+				Stage:        "staging",
+				Service:      "carts",
+				Start:        "2020-01-15T13:57:00.000Z",
+				End:          "2020-01-15T14:12:00.000Z",
+				Results:      tt.results,
+			}
+			got, err := export.toCSV()
+			if err != nil {
+				t.Fatalf("toCSV() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("toCSV() = %q, want %q", string(got), tt.want)
+			}
+		})
+	}
+}
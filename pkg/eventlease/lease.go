@@ -0,0 +1,157 @@
+package eventlease
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+)
+
+// leaseLabel marks the leases of events, so that expired ones can be found and deleted
+const leaseLabel = "dynatrace-service/event-lease"
+
+const defaultLeaseDuration = time.Hour
+
+/**
+ * Claimer makes sure that only one replica of the dynatrace-service processes an event. As all replicas receive all events,
+ * each replica tries to create a Kubernetes lease named after the ID of the event - only the replica that creates the lease processes the event
+ */
+type Claimer struct {
+	K8sClient kubernetes.Interface
+	Namespace string
+	// Holder identifies the replica, e.g. by the name of its pod
+	Holder string
+	// LeaseDuration is the time after which the lease of an event is deleted
+	LeaseDuration time.Duration
+}
+
+/**
+ * NewClaimerFromEnv creates a Claimer if EVENT_LEASES_ENABLED is true, otherwise it returns nil as a single replica doesn't need to claim events.
+ * EVENT_LEASE_DURATION overwrites the time leases are kept, e.g: 30m
+ */
+func NewClaimerFromEnv() (*Claimer, error) {
+	enabled, _ := strconv.ParseBool(os.Getenv("EVENT_LEASES_ENABLED"))
+	if !enabled {
+		return nil, nil
+	}
+
+	leaseDuration := defaultLeaseDuration
+	if value := os.Getenv("EVENT_LEASE_DURATION"); value != "" {
+		parsedDuration, err := time.ParseDuration(value)
+		if err != nil || parsedDuration <= 0 {
+			return nil, fmt.Errorf("invalid EVENT_LEASE_DURATION %s: has to be a positive duration, e.g. 30m", value)
+		}
+		leaseDuration = parsedDuration
+	}
+
+	k8sClient, err := common.GetKubernetesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create Kubernetes client to claim events: %v", err)
+	}
+	if k8sClient == nil {
+		return nil, nil
+	}
+
+	holder, _ := os.Hostname()
+	if podName := os.Getenv("POD_NAME"); podName != "" {
+		holder = podName
+	}
+
+	return &Claimer{
+		K8sClient:     k8sClient,
+		Namespace:     os.Getenv("POD_NAMESPACE"),
+		Holder:        holder,
+		LeaseDuration: leaseDuration,
+	}, nil
+}
+
+// Claim returns true if this replica has to process the event or false if another replica already claimed it
+func (c *Claimer) Claim(ctx context.Context, eventID string) (bool, error) {
+	now := metav1.NewMicroTime(time.Now())
+	leaseDurationSeconds := int32(c.LeaseDuration.Seconds())
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        leaseName(eventID),
+			Namespace:   c.Namespace,
+			Labels:      map[string]string{leaseLabel: "true"},
+			Annotations: map[string]string{"dynatrace-service/event-id": eventID},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &c.Holder,
+			LeaseDurationSeconds: &leaseDurationSeconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+
+	_, err := c.K8sClient.CoordinationV1().Leases(c.Namespace).Create(ctx, lease, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not create lease of event %s: %v", eventID, err)
+	}
+	return true, nil
+}
+
+// Release deletes the lease of an event that couldn't be processed, so that any replica may claim the event when it is delivered again
+func (c *Claimer) Release(ctx context.Context, eventID string) error {
+	err := c.K8sClient.CoordinationV1().Leases(c.Namespace).Delete(ctx, leaseName(eventID), metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete lease of event %s: %v", eventID, err)
+	}
+	return nil
+}
+
+// DeleteExpiredLeases deletes the leases that are older than the LeaseDuration, so that they don't pile up
+func (c *Claimer) DeleteExpiredLeases(ctx context.Context) error {
+	leases, err := c.K8sClient.CoordinationV1().Leases(c.Namespace).List(ctx, metav1.ListOptions{LabelSelector: leaseLabel + "=true"})
+	if err != nil {
+		return fmt.Errorf("could not list event leases: %v", err)
+	}
+
+	expiredBefore := time.Now().Add(-c.LeaseDuration)
+	for _, lease := range leases.Items {
+		if lease.Spec.AcquireTime != nil && lease.Spec.AcquireTime.Time.After(expiredBefore) {
+			continue
+		}
+		err := c.K8sClient.CoordinationV1().Leases(c.Namespace).Delete(ctx, lease.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("could not delete event lease %s: %v", lease.Name, err)
+		}
+	}
+	return nil
+}
+
+// RunCleanup deletes the expired leases periodically until the context is done
+func (c *Claimer) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(c.LeaseDuration / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.DeleteExpiredLeases(ctx); err != nil {
+				log.WithError(err).Warn("Could not clean up event leases")
+			}
+		}
+	}
+}
+
+// leaseName returns a valid name for the lease of an event, as event IDs may contain characters that aren't allowed in names of Kubernetes resources
+func leaseName(eventID string) string {
+	hash := sha256.Sum256([]byte(eventID))
+	return "dynatrace-service-event-" + hex.EncodeToString(hash[:16])
+}
@@ -0,0 +1,100 @@
+package eventlease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClaimer_Claim(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	replica1 := &Claimer{K8sClient: k8sClient, Namespace: "keptn", Holder: "dynatrace-service-1", LeaseDuration: time.Hour}
+	replica2 := &Claimer{K8sClient: k8sClient, Namespace: "keptn", Holder: "dynatrace-service-2", LeaseDuration: time.Hour}
+
+	claimed, err := replica1.Claim(context.TODO(), "8d7c2a6e-0f5d-4a3b-9b0e-2f1c6a1b7e11")
+	if err != nil || !claimed {
+		t.Fatalf("Claim() = %v, %v, want the first replica to claim the event", claimed, err)
+	}
+	claimed, err = replica2.Claim(context.TODO(), "8d7c2a6e-0f5d-4a3b-9b0e-2f1c6a1b7e11")
+	if err != nil || claimed {
+		t.Errorf("Claim() = %v, %v, want the event to be claimed already", claimed, err)
+	}
+	claimed, err = replica2.Claim(context.TODO(), "other-event")
+	if err != nil || !claimed {
+		t.Errorf("Claim() = %v, %v, want the second replica to claim another event", claimed, err)
+	}
+
+	lease, err := k8sClient.CoordinationV1().Leases("keptn").Get(context.TODO(), leaseName("8d7c2a6e-0f5d-4a3b-9b0e-2f1c6a1b7e11"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("could not get lease: %v", err)
+	}
+	if *lease.Spec.HolderIdentity != "dynatrace-service-1" {
+		t.Errorf("lease holder = %s, want dynatrace-service-1", *lease.Spec.HolderIdentity)
+	}
+}
+
+func TestClaimer_Release(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	replica1 := &Claimer{K8sClient: k8sClient, Namespace: "keptn", Holder: "dynatrace-service-1", LeaseDuration: time.Hour}
+	replica2 := &Claimer{K8sClient: k8sClient, Namespace: "keptn", Holder: "dynatrace-service-2", LeaseDuration: time.Hour}
+
+	claimed, err := replica1.Claim(context.TODO(), "failed-event")
+	if err != nil || !claimed {
+		t.Fatalf("Claim() = %v, %v, want the first replica to claim the event", claimed, err)
+	}
+	if err := replica1.Release(context.TODO(), "failed-event"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	// the event is delivered again and may be claimed by any replica
+	claimed, err = replica2.Claim(context.TODO(), "failed-event")
+	if err != nil || !claimed {
+		t.Errorf("Claim() = %v, %v, want the released event to be claimed again", claimed, err)
+	}
+
+	if err := replica1.Release(context.TODO(), "unknown-event"); err != nil {
+		t.Errorf("Release() error = %v, want no error for an event without lease", err)
+	}
+}
+
+func TestClaimer_DeleteExpiredLeases(t *testing.T) {
+	expired := metav1.NewMicroTime(time.Now().Add(-2 * time.Hour))
+	k8sClient := fake.NewSimpleClientset(
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: leaseName("expired-event"), Namespace: "keptn", Labels: map[string]string{leaseLabel: "true"}},
+			Spec:       coordinationv1.LeaseSpec{AcquireTime: &expired},
+		},
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-lease", Namespace: "keptn"},
+			Spec:       coordinationv1.LeaseSpec{AcquireTime: &expired},
+		},
+	)
+	claimer := &Claimer{K8sClient: k8sClient, Namespace: "keptn", Holder: "dynatrace-service-1", LeaseDuration: time.Hour}
+	if _, err := claimer.Claim(context.TODO(), "new-event"); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+
+	if err := claimer.DeleteExpiredLeases(context.TODO()); err != nil {
+		t.Fatalf("DeleteExpiredLeases() error = %v", err)
+	}
+
+	leases, _ := k8sClient.CoordinationV1().Leases("keptn").List(context.TODO(), metav1.ListOptions{})
+	got := map[string]bool{}
+	for _, lease := range leases.Items {
+		got[lease.Name] = true
+	}
+	if len(got) != 2 || !got[leaseName("new-event")] || !got["other-lease"] {
+		t.Errorf("DeleteExpiredLeases() kept %v, want the lease of new-event and the lease that isn't an event lease", got)
+	}
+}
+
+func TestLeaseName(t *testing.T) {
+	name := leaseName("event ID with / invalid characters")
+	if len(name) > 63 || name != leaseName("event ID with / invalid characters") {
+		t.Errorf("leaseName() = %s, want a stable name of at most 63 characters", name)
+	}
+}
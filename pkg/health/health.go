@@ -0,0 +1,125 @@
+package health
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dialTimeout is the time the liveness probe waits for the connection to the CloudEvents receiver
+const dialTimeout = 2 * time.Second
+
+// ReadinessCheck is a dependency that has to be available before the dynatrace-service is ready to process events
+type ReadinessCheck struct {
+	Name  string
+	Check func() error
+}
+
+// probeResult is the response body of the health and readiness endpoints
+type probeResult struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+/**
+ * NewHandler returns the handler of the probe endpoints:
+ * /health is successful as long as the CloudEvents receiver accepts connections at receiverAddress,
+ * /ready additionally requires all readiness checks to succeed
+ */
+func NewHandler(receiverAddress string, readinessChecks ...ReadinessCheck) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		result := &probeResult{Status: "OK"}
+		if err := checkReceiver(receiverAddress); err != nil {
+			result = &probeResult{Status: "unhealthy", Checks: map[string]string{"receiver": err.Error()}}
+		}
+		writeProbeResult(w, result)
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		writeProbeResult(w, checkReadiness(receiverAddress, readinessChecks))
+	})
+	return mux
+}
+
+// ListenAndServe serves the probe endpoints at the port until the server fails
+func ListenAndServe(port int, handler http.Handler) {
+	log.WithField("port", port).Info("Serving health and readiness probes")
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), handler); err != nil {
+		log.WithError(err).Error("Health and readiness probes failed")
+	}
+}
+
+func checkReadiness(receiverAddress string, readinessChecks []ReadinessCheck) *probeResult {
+	result := &probeResult{Status: "ready", Checks: map[string]string{"receiver": "OK"}}
+	if err := checkReceiver(receiverAddress); err != nil {
+		result.Status = "not ready"
+		result.Checks["receiver"] = err.Error()
+	}
+
+	for _, readinessCheck := range readinessChecks {
+		if err := readinessCheck.Check(); err != nil {
+			log.WithError(err).WithField("check", readinessCheck.Name).Warn("Readiness check failed")
+			result.Status = "not ready"
+			result.Checks[readinessCheck.Name] = err.Error()
+			continue
+		}
+		result.Checks[readinessCheck.Name] = "OK"
+	}
+	return result
+}
+
+func checkReceiver(receiverAddress string) error {
+	conn, err := net.DialTimeout("tcp", receiverAddress, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("CloudEvents receiver is not listening: %v", err)
+	}
+	return conn.Close()
+}
+
+func writeProbeResult(w http.ResponseWriter, result *probeResult) {
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status != "OK" && result.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.WithError(err).Error("Could not write probe result")
+	}
+}
+
+// CheckURLIsReachable returns a check that succeeds if the URL responds without a server error, e.g: to verify the configuration-service is reachable
+func CheckURLIsReachable(url string) func() error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func() error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return fmt.Errorf("%s is not reachable: %v", url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s responded with status code %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+/**
+ * RequireAPIToken only passes requests to the handler that send the apiToken in the x-token header, like the Keptn API does. All other requests are
+ * rejected with 401 Unauthorized, as are all requests if no apiToken is set, so that the endpoints on the probe port aren't open to everyone who can reach it
+ */
+func RequireAPIToken(apiToken string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("x-token")
+		if apiToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "missing or invalid x-token"})
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
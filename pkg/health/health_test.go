@@ -0,0 +1,157 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHandler(t *testing.T) {
+	receiver, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	closedReceiver, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedReceiver.Close()
+
+	successfulCheck := ReadinessCheck{Name: "credentials", Check: func() error { return nil }}
+	failingCheck := ReadinessCheck{Name: "configuration-service", Check: func() error { return errors.New("not reachable") }}
+
+	tests := []struct {
+		name            string
+		receiverAddress string
+		readinessChecks []ReadinessCheck
+		path            string
+		wantStatusCode  int
+		wantChecks      map[string]string
+	}{
+		{
+			name:            "healthy receiver",
+			receiverAddress: receiver.Addr().String(),
+			readinessChecks: []ReadinessCheck{failingCheck},
+			path:            "/health",
+			wantStatusCode:  http.StatusOK,
+		},
+		{
+			name:            "receiver not listening",
+			receiverAddress: closedReceiver.Addr().String(),
+			path:            "/health",
+			wantStatusCode:  http.StatusServiceUnavailable,
+		},
+		{
+			name:            "ready",
+			receiverAddress: receiver.Addr().String(),
+			readinessChecks: []ReadinessCheck{successfulCheck},
+			path:            "/ready",
+			wantStatusCode:  http.StatusOK,
+			wantChecks:      map[string]string{"receiver": "OK", "credentials": "OK"},
+		},
+		{
+			name:            "failing readiness check",
+			receiverAddress: receiver.Addr().String(),
+			readinessChecks: []ReadinessCheck{successfulCheck, failingCheck},
+			path:            "/ready",
+			wantStatusCode:  http.StatusServiceUnavailable,
+			wantChecks:      map[string]string{"receiver": "OK", "credentials": "OK", "configuration-service": "not reachable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			NewHandler(tt.receiverAddress, tt.readinessChecks...).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if recorder.Code != tt.wantStatusCode {
+				t.Errorf("%s status code = %d, want %d", tt.path, recorder.Code, tt.wantStatusCode)
+			}
+			if tt.wantChecks == nil {
+				return
+			}
+
+			result := &probeResult{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+				t.Fatalf("could not parse %s response: %v", tt.path, err)
+			}
+			for name, want := range tt.wantChecks {
+				if result.Checks[name] != want {
+					t.Errorf("%s check %s = %s, want %s", tt.path, name, result.Checks[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckURLIsReachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/failing" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if err := CheckURLIsReachable(server.URL)(); err != nil {
+		t.Errorf("CheckURLIsReachable() error = %v, want nil for a client error", err)
+	}
+	if err := CheckURLIsReachable(server.URL + "/failing")(); err == nil {
+		t.Errorf("CheckURLIsReachable() expected an error for a server error")
+	}
+}
+
+func TestRequireAPIToken(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name           string
+		apiToken       string
+		token          string
+		wantStatusCode int
+	}{
+		{
+			name:           "valid token",
+			apiToken:       "my-token",
+			token:          "my-token",
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "invalid token",
+			apiToken:       "my-token",
+			token:          "other-token",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing token",
+			apiToken:       "my-token",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "no API token configured",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/dead-letters", nil)
+			if tt.token != "" {
+				request.Header.Set("x-token", tt.token)
+			}
+			recorder := httptest.NewRecorder()
+
+			RequireAPIToken(tt.apiToken, handler).ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatusCode {
+				t.Errorf("RequireAPIToken() status code = %d, want %d", recorder.Code, tt.wantStatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package keptnevents
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/uuid"
+	"github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/tracing"
+)
+
+// Source is the source of all events the dynatrace-service sends
+const Source = "dynatrace-service"
+
+const keptnSpecVersion = "0.2.1"
+
+// maxSendAttempts is the number of attempts to send an event to the distributor before it is given up
+const maxSendAttempts = 4
+
+// sendBackoff is the time to wait after the first failed attempt, it grows with each further attempt
+var sendBackoff = 1500 * time.Millisecond
+
+var (
+	senderOnce sync.Once
+	sender     keptn.EventSender
+	senderErr  error
+)
+
+// NewEvent creates an event of the eventType with the data as response to the incoming event, it carries the shkeptncontext of the incoming event and its ID as triggeredid
+func NewEvent(incoming cloudevents.Event, eventType string, data interface{}) (cloudevents.Event, error) {
+	var keptnContext string
+	if err := incoming.Context.ExtensionAs("shkeptncontext", &keptnContext); err != nil || keptnContext == "" {
+		return cloudevents.Event{}, fmt.Errorf("could not determine keptnContext of %s event", incoming.Type())
+	}
+
+	event, err := NewEventWithKeptnContext(keptnContext, eventType, data)
+	if err != nil {
+		return event, err
+	}
+	event.SetExtension("triggeredid", incoming.ID())
+	return event, nil
+}
+
+// NewEventWithKeptnContext creates an event of the eventType with the data that isn't a response to another event, e.g. a remediation triggered for a Dynatrace problem.
+// The ID is set when the event is created, so that an event sent again by Send keeps its ID
+func NewEventWithKeptnContext(keptnContext string, eventType string, data interface{}) (cloudevents.Event, error) {
+	event := cloudevents.NewEvent()
+	event.SetID(uuid.New().String())
+	event.SetType(eventType)
+	event.SetSource(Source)
+	event.SetExtension("shkeptncontext", keptnContext)
+	event.SetExtension("shkeptnspecversion", keptnSpecVersion)
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return event, fmt.Errorf("could not encode data of %s event: %v", eventType, err)
+	}
+	return event, nil
+}
+
+/**
+ * Send sends the event to Keptn via the distributor. The event continues the trace of the context, so that the services handling it can join the trace.
+ * An event the distributor doesn't accept because it is unavailable or responds with a server error is sent again up to maxSendAttempts times
+ */
+func Send(ctx context.Context, event cloudevents.Event) error {
+	if traceParent := tracing.SpanFromContext(ctx).TraceParent(); traceParent != "" {
+		event.SetExtension("traceparent", traceParent)
+	}
+	if common.RunLocal || common.RunLocalTest {
+		logging.FromContext(ctx).WithField("eventType", event.Type()).Info("Not sending event when running locally: " + string(event.Data()))
+		return nil
+	}
+
+	s, err := getSender()
+	if err != nil {
+		return err
+	}
+	if err := s.SendEvent(event); err != nil {
+		return fmt.Errorf("could not send %s event: %v", event.Type(), err)
+	}
+	return nil
+}
+
+// SetSender replaces the sender of the events, e.g. by a fake.EventSender in tests
+func SetSender(s keptn.EventSender) {
+	senderOnce.Do(func() {})
+	sender = s
+	senderErr = nil
+}
+
+func getSender() (keptn.EventSender, error) {
+	senderOnce.Do(func() {
+		sender, senderErr = newHTTPSender(keptnv2.DefaultHTTPEventEndpoint)
+	})
+	return sender, senderErr
+}
+
+// httpSender sends events in the structured encoding to the endpoint of the distributor
+type httpSender struct {
+	endpoint string
+	client   cloudevents.Client
+}
+
+func newHTTPSender(endpoint string) (*httpSender, error) {
+	protocol, err := cloudevents.NewHTTP()
+	if err != nil {
+		return nil, fmt.Errorf("could not create CloudEvents protocol: %v", err)
+	}
+	client, err := cloudevents.NewClient(protocol, cloudevents.WithTimeNow(), cloudevents.WithUUIDs())
+	if err != nil {
+		return nil, fmt.Errorf("could not create CloudEvents client: %v", err)
+	}
+	return &httpSender{endpoint: endpoint, client: client}, nil
+}
+
+func (s *httpSender) SendEvent(event cloudevents.Event) error {
+	ctx := cloudevents.ContextWithTarget(context.Background(), s.endpoint)
+	ctx = cloudevents.WithEncodingStructured(ctx)
+
+	var result error
+	for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+		result = s.client.Send(ctx, event)
+		if cloudevents.IsACK(result) {
+			return nil
+		}
+		if !isRetryable(result) {
+			return result
+		}
+		if attempt < maxSendAttempts {
+			time.Sleep(time.Duration(attempt) * sendBackoff)
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %v", maxSendAttempts, result)
+}
+
+// isRetryable returns true if the event wasn't delivered or the distributor responded with a server error or 429 Too Many Requests
+func isRetryable(result error) bool {
+	var httpResult *cehttp.Result
+	if cloudevents.ResultAs(result, &httpResult) {
+		return httpResult.StatusCode >= http.StatusInternalServerError || httpResult.StatusCode == http.StatusTooManyRequests
+	}
+	return cloudevents.IsUndelivered(result)
+}
@@ -0,0 +1,112 @@
+package keptnevents
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestNewEvent(t *testing.T) {
+	incoming := cloudevents.NewEvent()
+	incoming.SetID("triggered-event-id")
+	incoming.SetType("sh.keptn.event.get-sli.triggered")
+	incoming.SetExtension("shkeptncontext", "my-keptn-context")
+
+	event, err := NewEvent(incoming, "sh.keptn.event.get-sli.started", map[string]string{"project": "sockshop"})
+	if err != nil {
+		t.Fatalf("NewEvent() error = %v", err)
+	}
+	for extension, want := range map[string]string{"shkeptncontext": "my-keptn-context", "triggeredid": "triggered-event-id", "shkeptnspecversion": keptnSpecVersion} {
+		var got string
+		if err := event.ExtensionAs(extension, &got); err != nil || got != want {
+			t.Errorf("NewEvent() extension %s = %s, want %s", extension, got, want)
+		}
+	}
+	if event.Source() != Source || event.DataContentType() != cloudevents.ApplicationJSON {
+		t.Errorf("NewEvent() source = %s and content type = %s, want %s and %s", event.Source(), event.DataContentType(), Source, cloudevents.ApplicationJSON)
+	}
+
+	if _, err := NewEvent(cloudevents.NewEvent(), "sh.keptn.event.get-sli.started", nil); err == nil {
+		t.Errorf("NewEvent() expected an error for an incoming event without keptnContext")
+	}
+}
+
+func TestHTTPSender_SendEvent(t *testing.T) {
+	sendBackoff = time.Millisecond
+	defer func() { sendBackoff = 1500 * time.Millisecond }()
+
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "accepted",
+			statusCodes:  []int{http.StatusOK},
+			wantAttempts: 1,
+		},
+		{
+			name:         "accepted after distributor was unavailable",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusAccepted},
+			wantAttempts: 3,
+		},
+		{
+			name:         "invalid event is not sent again",
+			statusCodes:  []int{http.StatusBadRequest},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "giving up",
+			statusCodes:  []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			wantAttempts: maxSendAttempts,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			var eventIDs []string
+			distributor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				received := map[string]interface{}{}
+				if err := json.Unmarshal(body, &received); err != nil || received["shkeptncontext"] != "my-keptn-context" {
+					t.Errorf("distributor received %s, want structured event with shkeptncontext", body)
+				}
+				eventID, _ := received["id"].(string)
+				eventIDs = append(eventIDs, eventID)
+				w.WriteHeader(tt.statusCodes[attempts])
+				attempts++
+			}))
+			defer distributor.Close()
+
+			sender, err := newHTTPSender(distributor.URL)
+			if err != nil {
+				t.Fatalf("newHTTPSender() error = %v", err)
+			}
+			SetSender(sender)
+
+			event, _ := NewEventWithKeptnContext("my-keptn-context", "sh.keptn.event.get-sli.finished", map[string]string{"project": "sockshop"})
+			err = Send(context.Background(), event)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Send() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			for _, eventID := range eventIDs {
+				if eventID == "" || eventID != event.ID() {
+					t.Errorf("Send() sent event IDs %v, want the ID %s of the event for every attempt", eventIDs, event.ID())
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+/**
+ * CreateAlertingProfiles creates or updates an alerting profile per stage of the project that is scoped to the management zone of the stage
+ * and uses the severity rules of the alertingProfile of the dynatrace.conf.yaml. Each alerting profile gets its own problem notification,
+ * so that only problems of the project reach Keptn. With the scope project, a single alerting profile and problem notification is created
+ * for the management zone of the project instead
+ */
+func (dt *DynatraceHelper) CreateAlertingProfiles(project string, shipyard keptnv2.Shipyard, alertingProfileConfig *config.DtAlertingProfile) {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isProblemNotificationsGenerationEnabled() || alertingProfileConfig == nil {
+		return
+	}
+
+	keptnCredentials, err := getKeptnCredentials()
+	if err != nil {
+		logger.WithError(err).Error("Failed to retrieve Keptn API credentials")
+		dt.configuredEntities.AlertingProfiles = append(dt.configuredEntities.AlertingProfiles, ConfigResult{
+			Name:    "Keptn: " + project,
+			Success: false,
+			Message: "failed to retrieve Keptn API credentials: " + err.Error(),
+		})
+		return
+	}
+
+	var alertingProfiles []*AlertingProfile
+	var mzNames []string
+	if alertingProfileConfig.Scope == config.AlertingProfileScopeProject {
+		alertingProfiles = append(alertingProfiles, createProjectAlertingProfile(project, alertingProfileConfig))
+		mzNames = append(mzNames, dt.getProjectManagementZoneName(project))
+	} else {
+		for _, stage := range shipyard.Spec.Stages {
+			alertingProfiles = append(alertingProfiles, createStageAlertingProfile(project, stage.Name, alertingProfileConfig))
+			mzNames = append(mzNames, dt.getStageManagementZoneName(project, stage.Name))
+		}
+	}
+
+	managementZones := dt.getManagementZones()
+	for i, alertingProfile := range alertingProfiles {
+		mzName := mzNames[i]
+
+		mzID := ""
+		for _, mz := range managementZones {
+			if mz.Name == mzName {
+				mzID = mz.ID
+			}
+		}
+		if mzID == "" {
+			dt.configuredEntities.AlertingProfiles = append(dt.configuredEntities.AlertingProfiles, ConfigResult{
+				Name:    alertingProfile.DisplayName,
+				Success: false,
+				Message: "Management Zone '" + mzName + "' is not available in your Tenant",
+			})
+			continue
+		}
+
+		if err := dt.createOrUpdateScopedAlertingProfile(alertingProfile, mzID, keptnCredentials); err != nil {
+			// Error occurred but continue
+			logger.WithError(err).WithField("name", alertingProfile.DisplayName).Error("Could not set up alerting profile")
+			dt.configuredEntities.AlertingProfiles = append(dt.configuredEntities.AlertingProfiles, ConfigResult{
+				Name:    alertingProfile.DisplayName,
+				Success: false,
+				Message: "Could not set up alerting profile: " + err.Error(),
+			})
+			continue
+		}
+		dt.configuredEntities.AlertingProfiles = append(dt.configuredEntities.AlertingProfiles, ConfigResult{
+			Name:    alertingProfile.DisplayName,
+			Success: true,
+		})
+	}
+
+	dt.configuredEntities.AlertingProfiles = append(dt.configuredEntities.AlertingProfiles, dt.deleteAlertingProfilesOfOtherScope(project, shipyard, alertingProfileConfig)...)
+}
+
+/**
+ * deleteAlertingProfilesOfOtherScope removes the alerting profiles and problem notifications of the project that were created for the other scope,
+ * e.g. the ones of the stages after the scope has been changed to project, so that a problem is only sent to Keptn by a single problem notification
+ */
+func (dt *DynatraceHelper) deleteAlertingProfilesOfOtherScope(project string, shipyard keptnv2.Shipyard, alertingProfileConfig *config.DtAlertingProfile) []ConfigResult {
+	logger := logging.FromContext(dt.EventContext)
+
+	var alertingProfileNames []string
+	if alertingProfileConfig.Scope == config.AlertingProfileScopeProject {
+		for _, stage := range shipyard.Spec.Stages {
+			alertingProfileNames = append(alertingProfileNames, createStageAlertingProfile(project, stage.Name, alertingProfileConfig).DisplayName)
+		}
+	} else {
+		alertingProfileNames = append(alertingProfileNames, createProjectAlertingProfile(project, alertingProfileConfig).DisplayName)
+	}
+	var notificationNames []string
+	for _, name := range alertingProfileNames {
+		notificationNames = append(notificationNames, getScopedProblemNotificationName(name))
+	}
+
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		logger.WithError(err).Error("Could not delete alerting profiles of other scope")
+		return []ConfigResult{{Name: "Keptn: " + project, Success: false, Message: "Could not delete alerting profiles of other scope: " + err.Error()}}
+	}
+
+	var results []ConfigResult
+	if useSettingsAPI {
+		results = append(results, dt.deleteMatchingSettingsObjects(problemNotificationSchemaID, "displayName", nameIsOneOf(notificationNames))...)
+		results = append(results, dt.deleteMatchingSettingsObjects(alertingProfileSchemaID, "name", nameIsOneOf(alertingProfileNames))...)
+	} else {
+		results = append(results, dt.deleteMatchingConfigEntities("/api/config/v1/notifications", nameIsOneOf(notificationNames))...)
+		results = append(results, dt.deleteMatchingConfigEntities("/api/config/v1/alertingProfiles", nameIsOneOf(alertingProfileNames))...)
+	}
+	for i := range results {
+		results[i].Action = ConfigActionDeleted
+	}
+	return results
+}
+
+// createOrUpdateScopedAlertingProfile sets up the alerting profile and its problem notification via the Settings 2.0 API or the configuration API v1
+func (dt *DynatraceHelper) createOrUpdateScopedAlertingProfile(alertingProfile *AlertingProfile, mzID string, keptnCredentials *credentials.KeptnAPICredentials) error {
+	notificationName := getScopedProblemNotificationName(alertingProfile.DisplayName)
+
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		return err
+	}
+	if useSettingsAPI {
+		alertingProfileSettings := alertingProfile.toSettings()
+		alertingProfileSettings.ManagementZone = mzID
+
+		existingAlertingProfiles, err := dt.getSettingsObjects(alertingProfileSchemaID, settingsEnvironmentScope)
+		if err != nil {
+			return err
+		}
+		objectID := ""
+		if existingAlertingProfile := findSettingsObject(existingAlertingProfiles, "name", alertingProfileSettings.Name); existingAlertingProfile != nil {
+			objectID = existingAlertingProfile.ObjectID
+		}
+		alertingProfileID, err := dt.upsertSettingsObject(alertingProfileSchemaID, settingsEnvironmentScope, objectID, alertingProfileSettings)
+		if err != nil {
+			return err
+		}
+
+		notification, err := createProblemNotificationSettings(keptnCredentials.APIURL, keptnCredentials.APIToken, alertingProfileID)
+		if err != nil {
+			return err
+		}
+		notification.DisplayName = notificationName
+
+		existingNotifications, err := dt.getSettingsObjects(problemNotificationSchemaID, settingsEnvironmentScope)
+		if err != nil {
+			return err
+		}
+		objectID = ""
+		if existingNotification := findSettingsObject(existingNotifications, "displayName", notificationName); existingNotification != nil {
+			objectID = existingNotification.ObjectID
+		}
+		_, err = dt.upsertSettingsObject(problemNotificationSchemaID, settingsEnvironmentScope, objectID, notification)
+		return err
+	}
+
+	managementZoneID, err := strconv.ParseInt(mzID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid management zone ID %s: %v", mzID, err)
+	}
+	alertingProfile.ManagementZoneID = managementZoneID
+
+	alertingProfileID, err := dt.createOrUpdateAlertingProfile(alertingProfile)
+	if err != nil {
+		return err
+	}
+
+	problemNotification, err := createProblemNotificationPayload(notificationName, keptnCredentials.APIURL, keptnCredentials.APIToken, alertingProfileID)
+	if err != nil {
+		return err
+	}
+
+	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/notifications", "GET", nil)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve notifications: %v", err)
+	}
+	existingNotifications := DTAPIListResponse{}
+	if err := json.Unmarshal([]byte(response), &existingNotifications); err != nil {
+		return fmt.Errorf("failed to unmarshal notifications: %v", err)
+	}
+	for _, notification := range existingNotifications.Values {
+		if notification.Name == notificationName {
+			_, err = dt.sendDynatraceAPIRequest("/api/config/v1/notifications/"+notification.ID, "PUT", []byte(problemNotification))
+			return err
+		}
+	}
+	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/notifications", "POST", []byte(problemNotification))
+	return err
+}
+
+// createOrUpdateAlertingProfile creates or updates the alerting profile with the same name via the configuration API v1 and returns its ID
+func (dt *DynatraceHelper) createOrUpdateAlertingProfile(alertingProfile *AlertingProfile) (string, error) {
+	alertingProfilePayload, err := json.Marshal(alertingProfile)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal alerting profile: %v", err)
+	}
+
+	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/alertingProfiles", "GET", nil)
+	if err != nil {
+		return "", fmt.Errorf("could not get alerting profiles: %v", err)
+	}
+	existingAlertingProfiles := DTAPIListResponse{}
+	if err := json.Unmarshal([]byte(response), &existingAlertingProfiles); err != nil {
+		return "", fmt.Errorf("failed to unmarshal alerting profiles: %v", err)
+	}
+	for _, ap := range existingAlertingProfiles.Values {
+		if ap.Name == alertingProfile.DisplayName {
+			_, err = dt.sendDynatraceAPIRequest("/api/config/v1/alertingProfiles/"+ap.ID, "PUT", alertingProfilePayload)
+			if err != nil {
+				return "", fmt.Errorf("failed to update alerting profile: %v", err)
+			}
+			return ap.ID, nil
+		}
+	}
+
+	response, err = dt.sendDynatraceAPIRequest("/api/config/v1/alertingProfiles", "POST", alertingProfilePayload)
+	if err != nil {
+		return "", fmt.Errorf("failed to create alerting profile: %v", err)
+	}
+	createdItem := &Values{}
+	if err := json.Unmarshal([]byte(response), createdItem); err != nil {
+		return "", fmt.Errorf("failed to unmarshal alerting profile: %v", checkForUnexpectedHTMLResponseError(err))
+	}
+	if createdItem.ID == "" {
+		return "", errors.New("no alerting profile was created")
+	}
+	return createdItem.ID, nil
+}
+
+// createStageAlertingProfile returns the alerting profile of a stage - the severity rules of the Keptn alerting profile are used if none are configured
+func createStageAlertingProfile(project string, stage string, alertingProfileConfig *config.DtAlertingProfile) *AlertingProfile {
+	return createConfiguredAlertingProfile(getManagementZoneNameForStage(project, stage), alertingProfileConfig)
+}
+
+// createProjectAlertingProfile returns the alerting profile of a project, e.g: Keptn: sockshop
+func createProjectAlertingProfile(project string, alertingProfileConfig *config.DtAlertingProfile) *AlertingProfile {
+	return createConfiguredAlertingProfile("Keptn: "+project, alertingProfileConfig)
+}
+
+func createConfiguredAlertingProfile(name string, alertingProfileConfig *config.DtAlertingProfile) *AlertingProfile {
+	alertingProfile := CreateKeptnAlertingProfile()
+	alertingProfile.DisplayName = name
+
+	if len(alertingProfileConfig.SeverityRules) == 0 {
+		return alertingProfile
+	}
+
+	alertingProfile.Rules = []AlertingProfileRules{}
+	for _, rule := range alertingProfileConfig.SeverityRules {
+		includeMode := rule.TagFilterIncludeMode
+		if includeMode == "" {
+			includeMode = "NONE"
+		}
+		alertingProfile.Rules = append(alertingProfile.Rules, AlertingProfileRules{
+			SeverityLevel: rule.SeverityLevel,
+			TagFilter: AlertingProfileTagFilter{
+				IncludeMode: includeMode,
+				TagFilters:  rule.TagFilters,
+			},
+			DelayInMinutes: rule.DelayInMinutes,
+		})
+	}
+	return alertingProfile
+}
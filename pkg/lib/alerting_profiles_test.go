@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+)
+
+func TestCreateStageAlertingProfile(t *testing.T) {
+	tests := []struct {
+		name                  string
+		alertingProfileConfig *config.DtAlertingProfile
+		wantRules             []AlertingProfileRules
+	}{
+		{
+			name:                  "default severity rules",
+			alertingProfileConfig: &config.DtAlertingProfile{},
+			wantRules:             CreateKeptnAlertingProfile().Rules,
+		},
+		{
+			name: "configured severity rules",
+			alertingProfileConfig: &config.DtAlertingProfile{
+				SeverityRules: []config.DtAlertingProfileSeverityRule{
+					{SeverityLevel: "AVAILABILITY"},
+					{SeverityLevel: "PERFORMANCE", DelayInMinutes: 10, TagFilterIncludeMode: "INCLUDE_ANY", TagFilters: []string{"keptn_managed"}},
+				},
+			},
+			wantRules: []AlertingProfileRules{
+				{SeverityLevel: "AVAILABILITY", TagFilter: AlertingProfileTagFilter{IncludeMode: "NONE"}},
+				{SeverityLevel: "PERFORMANCE", TagFilter: AlertingProfileTagFilter{IncludeMode: "INCLUDE_ANY", TagFilters: []string{"keptn_managed"}}, DelayInMinutes: 10},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := createStageAlertingProfile("sockshop", "dev", tt.alertingProfileConfig)
+			if got.DisplayName != "Keptn: sockshop dev" {
+				t.Errorf("createStageAlertingProfile() displayName = %s, want %s", got.DisplayName, "Keptn: sockshop dev")
+			}
+
+			gotRules, _ := json.Marshal(got.Rules)
+			wantRules, _ := json.Marshal(tt.wantRules)
+			if string(gotRules) != string(wantRules) {
+				t.Errorf("createStageAlertingProfile() rules = %s, want %s", gotRules, wantRules)
+			}
+		})
+	}
+}
+
+func TestCreateProjectAlertingProfile(t *testing.T) {
+	alertingProfileConfig := &config.DtAlertingProfile{
+		Scope:         config.AlertingProfileScopeProject,
+		SeverityRules: []config.DtAlertingProfileSeverityRule{{SeverityLevel: "AVAILABILITY"}},
+	}
+
+	got := createProjectAlertingProfile("sockshop", alertingProfileConfig)
+	if got.DisplayName != "Keptn: sockshop" {
+		t.Errorf("createProjectAlertingProfile() displayName = %s, want %s", got.DisplayName, "Keptn: sockshop")
+	}
+	if len(got.Rules) != 1 || got.Rules[0].SeverityLevel != "AVAILABILITY" {
+		t.Errorf("createProjectAlertingProfile() rules = %v, want the configured severity rule", got.Rules)
+	}
+}
+
+func TestCreateProblemNotificationPayload(t *testing.T) {
+	payload, err := createProblemNotificationPayload("Keptn Problem Notification: sockshop dev", "https://keptn", "my-token", "profile-id")
+	if err != nil {
+		t.Errorf("createProblemNotificationPayload() error = %v", err)
+		return
+	}
+
+	notification := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		t.Errorf("createProblemNotificationPayload() returned invalid JSON: %v", err)
+		return
+	}
+	if notification["name"] != "Keptn Problem Notification: sockshop dev" {
+		t.Errorf("createProblemNotificationPayload() name = %v, want %s", notification["name"], "Keptn Problem Notification: sockshop dev")
+	}
+	if notification["alertingProfile"] != "profile-id" {
+		t.Errorf("createProblemNotificationPayload() alertingProfile = %v, want %s", notification["alertingProfile"], "profile-id")
+	}
+	if notification["url"] != "https://keptn/v1/event" {
+		t.Errorf("createProblemNotificationPayload() url = %v, want %s", notification["url"], "https://keptn/v1/event")
+	}
+}
@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+var defaultOverAlertingProtection = ServiceAnomalyDetectionOverAlerting{
+	RequestsPerMinute:    10,
+	MinutesAbnormalState: 1,
+}
+
+/**
+ * ApplyAnomalyDetection overwrites the anomaly detection of the services matching the anomalyDetection of the dynatrace.conf.yaml,
+ * so that quality-gated services get stricter thresholds than the tenant default. The services are found via their keptn_project,
+ * keptn_stage and keptn_service tags and configured via the builtin:anomaly-detection.services schema of the Settings 2.0 API
+ */
+func (dt *DynatraceHelper) ApplyAnomalyDetection(project string, anomalyDetection *config.DtAnomalyDetection) {
+	logger := logging.FromContext(dt.EventContext)
+	if anomalyDetection == nil {
+		return
+	}
+
+	for _, serviceAnomalyDetection := range anomalyDetection.Services {
+		entitySelector := getServiceAnomalyDetectionEntitySelector(project, serviceAnomalyDetection)
+		result := ConfigResult{
+			Name: entitySelector,
+		}
+
+		count, err := dt.applyServiceAnomalyDetection(entitySelector, serviceAnomalyDetection)
+		if err != nil {
+			// Error occurred but continue
+			logger.WithError(err).WithField("entitySelector", entitySelector).Error("Could not apply anomaly detection settings")
+			result.Message = err.Error()
+		} else {
+			result.Success = true
+			result.Message = fmt.Sprintf("Applied to %d services", count)
+		}
+		dt.configuredEntities.AnomalyDetection = append(dt.configuredEntities.AnomalyDetection, result)
+	}
+}
+
+// applyServiceAnomalyDetection applies the anomaly detection to all services matching the entity selector and returns the number of updated services
+func (dt *DynatraceHelper) applyServiceAnomalyDetection(entitySelector string, serviceAnomalyDetection config.DtServiceAnomalyDetection) (int, error) {
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		return 0, err
+	}
+	if !useSettingsAPI {
+		return 0, errors.New("anomaly detection settings of services require the Settings 2.0 API")
+	}
+
+	sections, err := createServiceAnomalyDetectionSections(serviceAnomalyDetection)
+	if err != nil {
+		return 0, err
+	}
+
+	entityIDs, err := dt.GetEntityIDs(entitySelector)
+	if err != nil {
+		return 0, err
+	}
+	if len(entityIDs) == 0 {
+		return 0, errors.New("no services are tagged accordingly")
+	}
+
+	for _, entityID := range entityIDs {
+		existingObjects, err := dt.getSettingsObjects(serviceAnomalyDetectionSchemaID, entityID)
+		if err != nil {
+			return 0, err
+		}
+		objectID := ""
+		var existingValue json.RawMessage
+		if len(existingObjects) > 0 {
+			objectID = existingObjects[0].ObjectID
+			existingValue = existingObjects[0].Value
+		}
+
+		value := mergeServiceAnomalyDetectionSettings(existingValue, sections)
+		if _, err := dt.upsertSettingsObject(serviceAnomalyDetectionSchemaID, entityID, objectID, value); err != nil {
+			return 0, fmt.Errorf("could not update anomaly detection of %s: %v", entityID, err)
+		}
+	}
+	return len(entityIDs), nil
+}
+
+// getServiceAnomalyDetectionEntitySelector returns the entity selector of the services, e.g: type(SERVICE),tag(keptn_project:sockshop),tag(keptn_service:carts)
+func getServiceAnomalyDetectionEntitySelector(project string, serviceAnomalyDetection config.DtServiceAnomalyDetection) string {
+	entitySelector := "type(SERVICE),tag(keptn_project:" + project + ")"
+	if serviceAnomalyDetection.Stage != "" {
+		entitySelector += ",tag(keptn_stage:" + serviceAnomalyDetection.Stage + ")"
+	}
+	if serviceAnomalyDetection.Service != "" {
+		entitySelector += ",tag(keptn_service:" + serviceAnomalyDetection.Service + ")"
+	}
+	return entitySelector
+}
+
+// createServiceAnomalyDetectionSections converts the configured response time and failure rate detection to the sections of the builtin:anomaly-detection.services schema
+func createServiceAnomalyDetectionSections(serviceAnomalyDetection config.DtServiceAnomalyDetection) (map[string]interface{}, error) {
+	sections := map[string]interface{}{}
+
+	if serviceAnomalyDetection.ResponseTime != nil {
+		responseTime, err := createResponseTimeAnomalyDetection(serviceAnomalyDetection.ResponseTime)
+		if err != nil {
+			return nil, err
+		}
+		sections["responseTime"] = responseTime
+	}
+	if serviceAnomalyDetection.FailureRate != nil {
+		failureRate, err := createFailureRateAnomalyDetection(serviceAnomalyDetection.FailureRate)
+		if err != nil {
+			return nil, err
+		}
+		sections["failureRate"] = failureRate
+	}
+
+	if len(sections) == 0 {
+		return nil, errors.New("neither responseTime nor failureRate is defined")
+	}
+	return sections, nil
+}
+
+func createResponseTimeAnomalyDetection(responseTime *config.DtResponseTimeAnomalyDetection) (*ServiceAnomalyDetectionResponseTime, error) {
+	switch responseTime.DetectionMode {
+	case "auto":
+		return &ServiceAnomalyDetectionResponseTime{
+			Enabled:       true,
+			DetectionMode: "auto",
+			AutoDetection: &ServiceAnomalyDetectionResponseTimeAuto{
+				ResponseTimeAll: ServiceAnomalyDetectionResponseTimeAll{
+					DegradationMilliseconds: valueOrDefault(responseTime.DegradationMilliseconds, 100),
+					DegradationPercent:      valueOrDefault(responseTime.DegradationPercent, 50),
+				},
+				ResponseTimeSlowest: ServiceAnomalyDetectionResponseTimeSlowest{
+					SlowestDegradationMilliseconds: valueOrDefault(responseTime.SlowestDegradationMilliseconds, 1000),
+					SlowestDegradationPercent:      valueOrDefault(responseTime.SlowestDegradationPercent, 100),
+				},
+				OverAlertingProtection: defaultOverAlertingProtection,
+			},
+		}, nil
+	case "fixed":
+		return &ServiceAnomalyDetectionResponseTime{
+			Enabled:       true,
+			DetectionMode: "fixed",
+			FixedDetection: &ServiceAnomalyDetectionResponseTimeFixed{
+				ResponseTimeAll: ServiceAnomalyDetectionResponseTimeAll{
+					DegradationMilliseconds: valueOrDefault(responseTime.DegradationMilliseconds, 100),
+				},
+				ResponseTimeSlowest: ServiceAnomalyDetectionResponseTimeSlowest{
+					SlowestDegradationMilliseconds: valueOrDefault(responseTime.SlowestDegradationMilliseconds, 1000),
+				},
+				OverAlertingProtection: defaultOverAlertingProtection,
+				Sensitivity:            sensitivityOrDefault(responseTime.Sensitivity),
+			},
+		}, nil
+	case "disabled":
+		return &ServiceAnomalyDetectionResponseTime{Enabled: false}, nil
+	}
+	return nil, fmt.Errorf("invalid detection mode of responseTime: %s", responseTime.DetectionMode)
+}
+
+func createFailureRateAnomalyDetection(failureRate *config.DtFailureRateAnomalyDetection) (*ServiceAnomalyDetectionFailureRate, error) {
+	switch failureRate.DetectionMode {
+	case "auto":
+		return &ServiceAnomalyDetectionFailureRate{
+			Enabled:       true,
+			DetectionMode: "auto",
+			AutoDetection: &ServiceAnomalyDetectionFailureRateAuto{
+				AbsoluteIncrease:       failureRate.AbsoluteIncrease,
+				RelativeIncrease:       valueOrDefault(failureRate.RelativeIncrease, 50),
+				OverAlertingProtection: defaultOverAlertingProtection,
+			},
+		}, nil
+	case "fixed":
+		return &ServiceAnomalyDetectionFailureRate{
+			Enabled:       true,
+			DetectionMode: "fixed",
+			FixedDetection: &ServiceAnomalyDetectionFailureRateFixed{
+				Threshold:              failureRate.Threshold,
+				Sensitivity:            sensitivityOrDefault(failureRate.Sensitivity),
+				OverAlertingProtection: defaultOverAlertingProtection,
+			},
+		}, nil
+	case "disabled":
+		return &ServiceAnomalyDetectionFailureRate{Enabled: false}, nil
+	}
+	return nil, fmt.Errorf("invalid detection mode of failureRate: %s", failureRate.DetectionMode)
+}
+
+/**
+ * mergeServiceAnomalyDetectionSettings overwrites the sections of the existing settings of a service with the configured ones,
+ * so that e.g. the failure rate detection isn't reset if only the response time is configured
+ * Services without settings get the defaults of Dynatrace for the sections that are not configured
+ */
+func mergeServiceAnomalyDetectionSettings(existingValue json.RawMessage, sections map[string]interface{}) map[string]interface{} {
+	value := map[string]interface{}{
+		"responseTime": createDefaultResponseTimeAnomalyDetection(),
+		"failureRate":  createDefaultFailureRateAnomalyDetection(),
+		"loadDrops":    map[string]interface{}{"enabled": false},
+		"loadSpikes":   map[string]interface{}{"enabled": false},
+	}
+
+	if len(existingValue) > 0 {
+		existingSections := map[string]json.RawMessage{}
+		if err := json.Unmarshal(existingValue, &existingSections); err == nil {
+			for name, section := range existingSections {
+				value[name] = section
+			}
+		}
+	}
+
+	for name, section := range sections {
+		value[name] = section
+	}
+	return value
+}
+
+func createDefaultResponseTimeAnomalyDetection() *ServiceAnomalyDetectionResponseTime {
+	responseTime, _ := createResponseTimeAnomalyDetection(&config.DtResponseTimeAnomalyDetection{DetectionMode: "auto"})
+	return responseTime
+}
+
+func createDefaultFailureRateAnomalyDetection() *ServiceAnomalyDetectionFailureRate {
+	failureRate, _ := createFailureRateAnomalyDetection(&config.DtFailureRateAnomalyDetection{DetectionMode: "auto"})
+	return failureRate
+}
+
+func valueOrDefault(value float64, defaultValue float64) float64 {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func sensitivityOrDefault(sensitivity string) string {
+	if sensitivity == "" {
+		return "low"
+	}
+	return sensitivity
+}
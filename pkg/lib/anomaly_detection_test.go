@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+)
+
+func TestGetServiceAnomalyDetectionEntitySelector(t *testing.T) {
+	tests := []struct {
+		name                    string
+		serviceAnomalyDetection config.DtServiceAnomalyDetection
+		want                    string
+	}{
+		{
+			name:                    "all services of the project",
+			serviceAnomalyDetection: config.DtServiceAnomalyDetection{},
+			want:                    "type(SERVICE),tag(keptn_project:sockshop)",
+		},
+		{
+			name:                    "service in stage",
+			serviceAnomalyDetection: config.DtServiceAnomalyDetection{Stage: "production", Service: "carts"},
+			want:                    "type(SERVICE),tag(keptn_project:sockshop),tag(keptn_stage:production),tag(keptn_service:carts)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getServiceAnomalyDetectionEntitySelector("sockshop", tt.serviceAnomalyDetection); got != tt.want {
+				t.Errorf("getServiceAnomalyDetectionEntitySelector() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateServiceAnomalyDetectionSections(t *testing.T) {
+	tests := []struct {
+		name                    string
+		serviceAnomalyDetection config.DtServiceAnomalyDetection
+		want                    string
+		wantErr                 bool
+	}{
+		{
+			name: "fixed response time",
+			serviceAnomalyDetection: config.DtServiceAnomalyDetection{
+				ResponseTime: &config.DtResponseTimeAnomalyDetection{DetectionMode: "fixed", DegradationMilliseconds: 300, Sensitivity: "high"},
+			},
+			want: `{"responseTime":{"enabled":true,"detectionMode":"fixed","fixedDetection":{"responseTimeAll":{"degradationMilliseconds":300},"responseTimeSlowest":{"slowestDegradationMilliseconds":1000},"overAlertingProtection":{"requestsPerMinute":10,"minutesAbnormalState":1},"sensitivity":"high"}}}`,
+		},
+		{
+			name: "automatic failure rate and disabled response time",
+			serviceAnomalyDetection: config.DtServiceAnomalyDetection{
+				ResponseTime: &config.DtResponseTimeAnomalyDetection{DetectionMode: "disabled"},
+				FailureRate:  &config.DtFailureRateAnomalyDetection{DetectionMode: "auto", AbsoluteIncrease: 2},
+			},
+			want: `{"failureRate":{"enabled":true,"detectionMode":"auto","autoDetection":{"absoluteIncrease":2,"relativeIncrease":50,"overAlertingProtection":{"requestsPerMinute":10,"minutesAbnormalState":1}}},"responseTime":{"enabled":false}}`,
+		},
+		{
+			name: "invalid detection mode",
+			serviceAnomalyDetection: config.DtServiceAnomalyDetection{
+				FailureRate: &config.DtFailureRateAnomalyDetection{DetectionMode: "strict"},
+			},
+			wantErr: true,
+		},
+		{
+			name:                    "nothing configured",
+			serviceAnomalyDetection: config.DtServiceAnomalyDetection{Service: "carts"},
+			wantErr:                 true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createServiceAnomalyDetectionSections(tt.serviceAnomalyDetection)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createServiceAnomalyDetectionSections() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			gotJSON, _ := json.Marshal(got)
+			if string(gotJSON) != tt.want {
+				t.Errorf("createServiceAnomalyDetectionSections() = %s, want %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeServiceAnomalyDetectionSettings(t *testing.T) {
+	existingValue := json.RawMessage(`{"responseTime":{"enabled":false},"failureRate":{"enabled":false},"loadDrops":{"enabled":true},"loadSpikes":{"enabled":false}}`)
+	sections := map[string]interface{}{
+		"responseTime": &ServiceAnomalyDetectionResponseTime{Enabled: true, DetectionMode: "auto"},
+	}
+
+	got, _ := json.Marshal(mergeServiceAnomalyDetectionSettings(existingValue, sections))
+	want := `{"failureRate":{"enabled":false},"loadDrops":{"enabled":true},"loadSpikes":{"enabled":false},"responseTime":{"enabled":true,"detectionMode":"auto"}}`
+	if string(got) != want {
+		t.Errorf("mergeServiceAnomalyDetectionSettings() = %s, want %s", got, want)
+	}
+
+	got, _ = json.Marshal(mergeServiceAnomalyDetectionSettings(nil, sections))
+	value := map[string]json.RawMessage{}
+	json.Unmarshal(got, &value)
+	if string(value["failureRate"]) != `{"enabled":true,"detectionMode":"auto","autoDetection":{"absoluteIncrease":0,"relativeIncrease":50,"overAlertingProtection":{"requestsPerMinute":10,"minutesAbnormalState":1}}}` {
+		t.Errorf("mergeServiceAnomalyDetectionSettings() failureRate = %s, want the default", value["failureRate"])
+	}
+}
@@ -2,22 +2,46 @@ package lib
 
 import (
 	"encoding/json"
+	"sort"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
 )
 
+// taggingRuleNames are the tags that are set up by the dynatrace-service
+var taggingRuleNames = []string{"keptn_service", "keptn_stage", "keptn_project", "keptn_deployment"}
+
 // EnsureDTTaggingRulesAreSetUp ensures that the tagging rules are set up
 func (dt *DynatraceHelper) EnsureDTTaggingRulesAreSetUp() {
-	if !IsTaggingRulesGenerationEnabled() {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isTaggingRulesGenerationEnabled() {
 		return
 	}
 
-	log.Info("Setting up auto-tagging rules in Dynatrace Tenant")
+	logger.Info("Setting up auto-tagging rules in Dynatrace Tenant")
+
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		logger.WithError(err).Error("Could not set up auto tagging rules")
+		for _, ruleName := range taggingRuleNames {
+			dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, ConfigResult{
+				Name:    ruleName,
+				Success: false,
+				Message: "Could not set up auto tagging rule: " + err.Error(),
+			})
+		}
+		return
+	}
+	if useSettingsAPI {
+		dt.ensureTaggingRulesInSettings()
+		return
+	}
 
 	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/autoTags", "GET", nil)
 	if err != nil {
 		// Error occurred but continue
-		log.WithError(err).Error("Could not get existing tagging rules")
+		logger.WithError(err).Error("Could not get existing tagging rules")
 	}
 
 	existingDTRules := &DTAPIListResponse{}
@@ -25,12 +49,33 @@ func (dt *DynatraceHelper) EnsureDTTaggingRulesAreSetUp() {
 	err = json.Unmarshal([]byte(response), existingDTRules)
 	if err != nil {
 		// Error occurred but continue
-		log.WithError(err).Error("Failed to unmarshal Dynatrace tagging rules")
+		logger.WithError(err).Error("Failed to unmarshal Dynatrace tagging rules")
 	}
 
-	for _, ruleName := range []string{"keptn_service", "keptn_stage", "keptn_project", "keptn_deployment"} {
-		if !dt.taggingRuleExists(ruleName, existingDTRules) {
-			rule := createAutoTaggingRule(ruleName)
+	namespaces := dt.getKubernetesNamespacesOfKeptnStages()
+	for _, ruleName := range taggingRuleNames {
+		rule := createAutoTaggingRule(ruleName)
+		addKubernetesNamespaceRules(rule, namespaces)
+		existingRule := dt.findTaggingRule(ruleName, existingDTRules)
+		if existingRule != nil {
+			existingDTRule, err := dt.getDTTaggingRule(existingRule.ID)
+			if err != nil {
+				// Error occurred but continue
+				dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, ConfigResult{
+					Name:    ruleName,
+					Success: false,
+					Message: "Could not check existing auto tagging rule: " + err.Error(),
+				})
+				logger.WithError(err).Error("Could not check existing auto tagging rule")
+				continue
+			}
+			if !isManagedTaggingRule(existingDTRule.Name, existingDTRule.Description, existingDTRule.valueFormats()) {
+				dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, newUnmanagedTaggingRuleResult(ruleName))
+				logger.WithField("ruleName", ruleName).Warn("Tagging rule exists but is not managed by the dynatrace-service - it is not updated")
+				continue
+			}
+		}
+		if existingRule == nil {
 			err = dt.createDTTaggingRule(rule)
 			if err != nil {
 				// Error occurred but continue
@@ -39,7 +84,7 @@ func (dt *DynatraceHelper) EnsureDTTaggingRulesAreSetUp() {
 					Success: false,
 					Message: "Could not create auto tagging rule: " + err.Error(),
 				})
-				log.WithError(err).Error("Could not create auto tagging rule")
+				logger.WithError(err).Error("Could not create auto tagging rule")
 			} else {
 				dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, ConfigResult{
 					Name:    ruleName,
@@ -47,19 +92,31 @@ func (dt *DynatraceHelper) EnsureDTTaggingRulesAreSetUp() {
 				})
 			}
 		} else {
-			log.WithField("ruleName", ruleName).Info("Tagging rule already exists")
-			dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, ConfigResult{
-				Name:    ruleName,
-				Message: "Tagging rule " + ruleName + " already exists",
-				Success: true,
-			})
+			err = dt.updateDTTaggingRule(existingRule.ID, rule)
+			if err != nil {
+				// Error occurred but continue
+				dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, ConfigResult{
+					Name:    ruleName,
+					Success: false,
+					Message: "Could not update auto tagging rule: " + err.Error(),
+				})
+				logger.WithError(err).Error("Could not update auto tagging rule")
+			} else {
+				logger.WithField("ruleName", ruleName).Info("Tagging rule already exists and has been updated")
+				dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, ConfigResult{
+					Name:    ruleName,
+					Message: "Tagging rule " + ruleName + " already exists and has been updated",
+					Success: true,
+				})
+			}
 		}
 	}
 	return
 }
 
 func (dt *DynatraceHelper) createDTTaggingRule(rule *DTTaggingRule) error {
-	log.WithField("name", rule.Name).Info("Creating DT tagging rule")
+	logger := logging.FromContext(dt.EventContext)
+	logger.WithField("name", rule.Name).Info("Creating DT tagging rule")
 	payload, err := json.Marshal(rule)
 	if err != nil {
 		return err
@@ -68,29 +125,129 @@ func (dt *DynatraceHelper) createDTTaggingRule(rule *DTTaggingRule) error {
 	return err
 }
 
-func (dt *DynatraceHelper) taggingRuleExists(ruleName string, existingRules *DTAPIListResponse) bool {
-	for _, rule := range existingRules.Values {
+// updateDTTaggingRule overwrites an existing tagging rule so that changes of the rule are applied to the tenant
+func (dt *DynatraceHelper) updateDTTaggingRule(id string, rule *DTTaggingRule) error {
+	logger := logging.FromContext(dt.EventContext)
+	logger.WithField("name", rule.Name).Info("Updating DT tagging rule")
+	payload, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/autoTags/"+id, "PUT", payload)
+	return err
+}
+
+// getDTTaggingRule returns the tagging rule with its description and rules, as the list of tagging rules only contains their names
+func (dt *DynatraceHelper) getDTTaggingRule(id string) (*DTTaggingRule, error) {
+	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/autoTags/"+id, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	rule := &DTTaggingRule{}
+	if err := json.Unmarshal([]byte(response), rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (dt *DynatraceHelper) findTaggingRule(ruleName string, existingRules *DTAPIListResponse) *Values {
+	for i, rule := range existingRules.Values {
 		if rule.Name == ruleName {
-			return true
+			return &existingRules.Values[i]
+		}
+	}
+	return nil
+}
+
+// ensureTaggingRulesInSettings creates or updates the tagging rules via the Settings 2.0 API
+func (dt *DynatraceHelper) ensureTaggingRulesInSettings() {
+	logger := logging.FromContext(dt.EventContext)
+	existingRules, err := dt.getSettingsObjects(autoTaggingSchemaID, settingsEnvironmentScope)
+	if err != nil {
+		// Error occurred but continue
+		logger.WithError(err).Error("Could not get existing tagging rules")
+	}
+
+	namespaces := dt.getKubernetesNamespacesOfKeptnStages()
+	for _, ruleName := range taggingRuleNames {
+		rule := createAutoTaggingRule(ruleName)
+		addKubernetesNamespaceRules(rule, namespaces)
+
+		objectID := ""
+		if existingRule := findSettingsObject(existingRules, "name", ruleName); existingRule != nil {
+			existingSettings := &AutoTaggingSettings{}
+			if err := json.Unmarshal(existingRule.Value, existingSettings); err != nil || !isManagedTaggingRule(existingSettings.Name, existingSettings.Description, existingSettings.valueFormats()) {
+				dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, newUnmanagedTaggingRuleResult(ruleName))
+				logger.WithField("ruleName", ruleName).Warn("Tagging rule exists but is not managed by the dynatrace-service - it is not updated")
+				continue
+			}
+			objectID = existingRule.ObjectID
+		}
+
+		_, err := dt.upsertSettingsObject(autoTaggingSchemaID, settingsEnvironmentScope, objectID, rule.toSettings())
+		if err != nil {
+			// Error occurred but continue
+			logger.WithError(err).Error("Could not create or update auto tagging rule")
+			dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, ConfigResult{
+				Name:    ruleName,
+				Success: false,
+				Message: "Could not create or update auto tagging rule: " + err.Error(),
+			})
+			continue
+		}
+
+		result := ConfigResult{
+			Name:    ruleName,
+			Success: true,
 		}
+		if objectID != "" {
+			result.Message = "Tagging rule " + ruleName + " already exists and has been updated"
+		}
+		dt.configuredEntities.TaggingRules = append(dt.configuredEntities.TaggingRules, result)
+	}
+}
+
+/**
+ * isManagedTaggingRule returns whether a tagging rule was created by the dynatrace-service, so that it may be updated: it has the ownership marker as description
+ * or - as rules created before the marker was introduced - no description and the value of the environment variable of its name as tag value.
+ * A rule of a user with the same name isn't overwritten
+ */
+func isManagedTaggingRule(ruleName string, description string, valueFormats []string) bool {
+	if hasOwnershipMarker(description) {
+		return true
+	}
+	return description == "" && containsString(valueFormats, getTaggingRuleValueFormat(ruleName))
+}
+
+// newUnmanagedTaggingRuleResult returns the result of a tagging rule that isn't set up, as a rule with the same name that isn't managed by the dynatrace-service exists
+func newUnmanagedTaggingRuleResult(ruleName string) ConfigResult {
+	return ConfigResult{
+		Name:    ruleName,
+		Success: false,
+		Message: "Tagging rule " + ruleName + " already exists but is not managed by the dynatrace-service - it has not been changed",
 	}
-	return false
+}
+
+// getTaggingRuleValueFormat returns the tag value of the tagging rule, the value of the environment variable of the process group with the name of the rule
+func getTaggingRuleValueFormat(ruleName string) string {
+	return "{ProcessGroup:Environment:" + ruleName + "}"
 }
 
 func createAutoTaggingRule(ruleName string) *DTTaggingRule {
 	return &DTTaggingRule{
-		Name: ruleName,
+		Name:        ruleName,
+		Description: keptnOwnershipMarker,
 		Rules: []Rules{
 			{
 				Type:             "SERVICE",
 				Enabled:          true,
-				ValueFormat:      "{ProcessGroup:Environment:" + ruleName + "}",
+				ValueFormat:      getTaggingRuleValueFormat(ruleName),
 				PropagationTypes: []string{"SERVICE_TO_PROCESS_GROUP_LIKE"},
 				Conditions: []Conditions{
 					{
 						Key: Key{
 							Attribute: "PROCESS_GROUP_CUSTOM_METADATA",
-							DynamicKey: DynamicKey{
+							DynamicKey: &DynamicKey{
 								Source: "ENVIRONMENT",
 								Key:    ruleName,
 							},
@@ -109,3 +266,95 @@ func createAutoTaggingRule(ruleName string) *DTTaggingRule {
 		},
 	}
 }
+
+// keptnNamespace is the Kubernetes namespace Keptn deploys the services of a stage to, e.g: sockshop-dev
+type keptnNamespace struct {
+	project string
+	stage   string
+}
+
+func (ns keptnNamespace) name() string {
+	return ns.project + "-" + ns.stage
+}
+
+// getKeptnStages returns the names of the stages per Keptn project - it is a variable so that it can be replaced in tests
+var getKeptnStages = func() (map[string][]string, error) {
+	projects, err := keptnapi.NewProjectHandler(common.GetShipyardControllerURL()).GetAllProjects()
+	if err != nil {
+		return nil, err
+	}
+	stages := map[string][]string{}
+	for _, project := range projects {
+		for _, stage := range project.Stages {
+			stages[project.ProjectName] = append(stages[project.ProjectName], stage.StageName)
+		}
+	}
+	return stages, nil
+}
+
+// getKubernetesNamespacesOfKeptnStages returns the namespaces of all stages of all Keptn projects, so that the tagging rules converge for all projects
+func (dt *DynatraceHelper) getKubernetesNamespacesOfKeptnStages() []keptnNamespace {
+	logger := logging.FromContext(dt.EventContext)
+	if !IsKubernetesTaggingRulesGenerationEnabled(dt.EventContext) {
+		return nil
+	}
+	stages, err := getKeptnStages()
+	if err != nil {
+		logger.WithError(err).Error("Could not retrieve Keptn projects - tagging rules for Kubernetes namespaces are not set up")
+		return nil
+	}
+
+	var projects []string
+	for project := range stages {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+
+	var namespaces []keptnNamespace
+	for _, project := range projects {
+		for _, stage := range stages[project] {
+			namespaces = append(namespaces, keptnNamespace{project: project, stage: stage})
+		}
+	}
+	return namespaces
+}
+
+/**
+ * addKubernetesNamespaceRules adds a rule per namespace to the keptn_project and keptn_stage tagging rules, so that the cloud applications
+ * deployed to the namespace <project>-<stage> are tagged without DT_TAGS, e.g: keptn_project:sockshop and keptn_stage:dev for sockshop-dev
+ */
+func addKubernetesNamespaceRules(rule *DTTaggingRule, namespaces []keptnNamespace) {
+	for _, namespace := range namespaces {
+		valueFormat := ""
+		switch rule.Name {
+		case "keptn_project":
+			valueFormat = namespace.project
+		case "keptn_stage":
+			valueFormat = namespace.stage
+		default:
+			return
+		}
+
+		rule.Rules = append(rule.Rules, Rules{
+			Type:             "CLOUD_APPLICATION",
+			Enabled:          true,
+			ValueFormat:      valueFormat,
+			PropagationTypes: []string{},
+			Conditions: []Conditions{
+				{
+					Key: Key{
+						Attribute: "CLOUD_APPLICATION_NAMESPACE_NAME",
+						Type:      "STATIC",
+					},
+					ComparisonInfo: ComparisonInfo{
+						Type:          "STRING",
+						Operator:      "EQUALS",
+						Value:         namespace.name(),
+						Negate:        false,
+						CaseSensitive: true,
+					},
+				},
+			},
+		})
+	}
+}
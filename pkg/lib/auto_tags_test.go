@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_addKubernetesNamespaceRules(t *testing.T) {
+	namespaces := []keptnNamespace{{project: "sockshop", stage: "dev"}, {project: "sockshop", stage: "prod"}}
+
+	tests := []struct {
+		ruleName       string
+		wantValues     []string
+		wantNamespaces []string
+		wantTotalRules int
+	}{
+		{
+			ruleName:       "keptn_project",
+			wantValues:     []string{"sockshop", "sockshop"},
+			wantNamespaces: []string{"sockshop-dev", "sockshop-prod"},
+			wantTotalRules: 3,
+		},
+		{
+			ruleName:       "keptn_stage",
+			wantValues:     []string{"dev", "prod"},
+			wantNamespaces: []string{"sockshop-dev", "sockshop-prod"},
+			wantTotalRules: 3,
+		},
+		{
+			ruleName:       "keptn_service",
+			wantTotalRules: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ruleName, func(t *testing.T) {
+			rule := createAutoTaggingRule(tt.ruleName)
+			addKubernetesNamespaceRules(rule, namespaces)
+
+			if len(rule.Rules) != tt.wantTotalRules {
+				t.Fatalf("addKubernetesNamespaceRules() rules = %d, want %d", len(rule.Rules), tt.wantTotalRules)
+			}
+			for i, r := range rule.Rules[1:] {
+				if r.Type != "CLOUD_APPLICATION" {
+					t.Errorf("addKubernetesNamespaceRules() type = %s, want CLOUD_APPLICATION", r.Type)
+				}
+				if r.ValueFormat != tt.wantValues[i] {
+					t.Errorf("addKubernetesNamespaceRules() valueFormat = %s, want %s", r.ValueFormat, tt.wantValues[i])
+				}
+				if r.Conditions[0].ComparisonInfo.Value != tt.wantNamespaces[i] {
+					t.Errorf("addKubernetesNamespaceRules() namespace = %v, want %s", r.Conditions[0].ComparisonInfo.Value, tt.wantNamespaces[i])
+				}
+			}
+
+			settings := rule.toSettings()
+			for i, r := range settings.Rules[1:] {
+				condition := r.AttributeRule.Conditions[0]
+				if condition.Key != "CLOUD_APPLICATION_NAMESPACE_NAME" || condition.StringValue != tt.wantNamespaces[i] || condition.DynamicKey != "" {
+					t.Errorf("toSettings() condition = %+v, want namespace %s", condition, tt.wantNamespaces[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_getKubernetesNamespacesOfKeptnStages(t *testing.T) {
+	originalGetKeptnStages := getKeptnStages
+	getKeptnStages = func() (map[string][]string, error) {
+		return map[string][]string{"sockshop": {"dev", "prod"}, "carts": {"staging"}}, nil
+	}
+	defer func() { getKeptnStages = originalGetKeptnStages }()
+
+	dt := &DynatraceHelper{}
+
+	if namespaces := dt.getKubernetesNamespacesOfKeptnStages(); namespaces != nil {
+		t.Errorf("getKubernetesNamespacesOfKeptnStages() = %v, want none if disabled", namespaces)
+	}
+
+	os.Setenv("GENERATE_KUBERNETES_TAGGING_RULES", "true")
+	defer os.Unsetenv("GENERATE_KUBERNETES_TAGGING_RULES")
+
+	want := []string{"carts-staging", "sockshop-dev", "sockshop-prod"}
+	namespaces := dt.getKubernetesNamespacesOfKeptnStages()
+	if len(namespaces) != len(want) {
+		t.Fatalf("getKubernetesNamespacesOfKeptnStages() = %v, want %v", namespaces, want)
+	}
+	for i, namespace := range namespaces {
+		if namespace.name() != want[i] {
+			t.Errorf("getKubernetesNamespacesOfKeptnStages() [%d] = %s, want %s", i, namespace.name(), want[i])
+		}
+	}
+}
+
+func Test_isManagedTaggingRule(t *testing.T) {
+	tests := []struct {
+		name         string
+		description  string
+		valueFormats []string
+		want         bool
+	}{
+		{
+			name:         "rule with ownership marker",
+			description:  keptnOwnershipMarker,
+			valueFormats: []string{"{ProcessGroup:Environment:keptn_service}"},
+			want:         true,
+		},
+		{
+			name:         "rule created before the ownership marker was introduced",
+			valueFormats: []string{"{ProcessGroup:Environment:keptn_service}"},
+			want:         true,
+		},
+		{
+			name:         "rule of a user with the same name",
+			valueFormats: []string{"{Service:DetectedName}"},
+			want:         false,
+		},
+		{
+			name:         "rule of a user with the same name and the same tag value",
+			description:  "Service tag of team A",
+			valueFormats: []string{"{ProcessGroup:Environment:keptn_service}"},
+			want:         false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isManagedTaggingRule("keptn_service", tt.description, tt.valueFormats); got != tt.want {
+				t.Errorf("isManagedTaggingRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
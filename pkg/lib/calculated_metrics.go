@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+const testStepRequestAttribute = "TSN"
+const testStepDimensionName = "Test Step"
+
+// testStepMetric defines a calculated service metric that is split by the test step of the requests
+type testStepMetric struct {
+	keyPrefix   string
+	name        string
+	baseMetric  string
+	unit        string
+	aggregation string
+}
+
+var testStepMetrics = []testStepMetric{
+	{keyPrefix: "calc:service.teststepservicecalls", name: "Test Step Service Calls", baseMetric: "REQUEST_COUNT", unit: "COUNT", aggregation: "SUM"},
+	{keyPrefix: "calc:service.teststepresponsetime", name: "Test Step Response Time", baseMetric: "RESPONSE_TIME", unit: "MICRO_SECOND", aggregation: "AVERAGE"},
+	{keyPrefix: "calc:service.teststepfailedcalls", name: "Test Step Failed Calls", baseMetric: "FAILED_REQUEST_COUNT", unit: "COUNT", aggregation: "SUM"},
+}
+
+/**
+ * CreateCalculatedTestStepMetrics creates or updates calculated service metrics of the services of the project that are split by the
+ * test step request attribute TSN, as required by the Performance-as-a-Self-Service pattern, e.g: calc:service.teststepresponsetime<project>
+ * The request attribute itself is not created - it has to capture the TSN part of the x-dynatrace-test header of the load tests
+ */
+func (dt *DynatraceHelper) CreateCalculatedTestStepMetrics(project string) {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isCalculatedMetricsGenerationEnabled() {
+		return
+	}
+
+	for _, metric := range testStepMetrics {
+		calculatedMetric := createCalculatedTestStepMetric(project, metric)
+
+		if err := dt.upsertCalculatedServiceMetric(calculatedMetric); err != nil {
+			// Error occurred but continue
+			logger.WithError(err).WithField("metricKey", calculatedMetric.TsmMetricKey).Error("Could not create calculated service metric")
+			dt.configuredEntities.CalculatedMetrics = append(dt.configuredEntities.CalculatedMetrics, ConfigResult{
+				Name:    calculatedMetric.TsmMetricKey,
+				Success: false,
+				Message: err.Error(),
+			})
+			continue
+		}
+		dt.configuredEntities.CalculatedMetrics = append(dt.configuredEntities.CalculatedMetrics, ConfigResult{
+			Name:    calculatedMetric.TsmMetricKey,
+			Success: true,
+		})
+	}
+}
+
+// upsertCalculatedServiceMetric creates the calculated service metric or updates the existing one with the same metric key
+func (dt *DynatraceHelper) upsertCalculatedServiceMetric(calculatedMetric CalculatedMetric) error {
+	payload, err := json.Marshal(calculatedMetric)
+	if err != nil {
+		return fmt.Errorf("could not marshal calculated service metric: %v", err)
+	}
+
+	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/calculatedMetrics/service/"+calculatedMetric.TsmMetricKey, "PUT", payload)
+	return err
+}
+
+// createCalculatedTestStepMetric returns the calculated service metric of the services tagged with keptn_project:<project> that is split by test step
+func createCalculatedTestStepMetric(project string, metric testStepMetric) CalculatedMetric {
+	return CreateCalculatedTestStepMetric(
+		metric.keyPrefix+project,
+		metric.name+" ("+project+")",
+		metric.baseMetric,
+		metric.unit,
+		"CONTEXTLESS",
+		"keptn_project",
+		project,
+		testStepDimensionName,
+		"{RequestAttribute:"+testStepRequestAttribute+"}",
+		metric.aggregation,
+	)
+}
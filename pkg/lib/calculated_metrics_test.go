@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestCreateCalculatedTestStepMetric(t *testing.T) {
+	got := createCalculatedTestStepMetric("sockshop", testStepMetrics[1])
+
+	if got.TsmMetricKey != "calc:service.teststepresponsetimesockshop" {
+		t.Errorf("createCalculatedTestStepMetric() metric key = %s, want %s", got.TsmMetricKey, "calc:service.teststepresponsetimesockshop")
+	}
+	if got.MetricDefinition.Metric != "RESPONSE_TIME" || got.Unit != "MICRO_SECOND" {
+		t.Errorf("createCalculatedTestStepMetric() metric = %s in %s, want RESPONSE_TIME in MICRO_SECOND", got.MetricDefinition.Metric, got.Unit)
+	}
+	if got.DimensionDefinition.Name != "Test Step" || got.DimensionDefinition.Dimension != "{RequestAttribute:TSN}" || got.DimensionDefinition.TopXAggregation != "AVERAGE" {
+		t.Errorf("createCalculatedTestStepMetric() dimension = %v, want Test Step split by {RequestAttribute:TSN}", got.DimensionDefinition)
+	}
+	if len(got.Conditions) != 2 {
+		t.Errorf("createCalculatedTestStepMetric() returned %d conditions, want 2", len(got.Conditions))
+		return
+	}
+	if got.Conditions[0].ComparisonInfo.RequestAttribute != "TSN" || got.Conditions[0].ComparisonInfo.Comparison != "EXISTS" {
+		t.Errorf("createCalculatedTestStepMetric() first condition = %v, want the existence of TSN", got.Conditions[0])
+	}
+	tag := got.Conditions[1].ComparisonInfo.Value
+	if tag.Key != "keptn_project" || tag.Value != "sockshop" {
+		t.Errorf("createCalculatedTestStepMetric() tag = %s:%s, want keptn_project:sockshop", tag.Key, tag.Value)
+	}
+}
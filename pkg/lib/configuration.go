@@ -1,57 +1,298 @@
 package lib
 
 import (
+	"context"
+	"encoding/json"
 	"os"
 	"strconv"
+	"strings"
 
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 	log "github.com/sirupsen/logrus"
 )
 
 // IsTaggingRulesGenerationEnabled returns whether tagging rules should be generated when configuring the monitoring
-func IsTaggingRulesGenerationEnabled() bool {
-	return readEnvAsBool("GENERATE_TAGGING_RULES", false)
+func IsTaggingRulesGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_TAGGING_RULES", false)
 }
 
 // IsProblemNotificationsGenerationEnabled returns whether problem notifications should be generated when configuring the monitoring
-func IsProblemNotificationsGenerationEnabled() bool {
-	return readEnvAsBool("GENERATE_PROBLEM_NOTIFICATIONS", false)
+func IsProblemNotificationsGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_PROBLEM_NOTIFICATIONS", false)
 }
 
 // IsManagementZonesGenerationEnabled returns whether management zones should be generated when configuring the monitoring
-func IsManagementZonesGenerationEnabled() bool {
-	return readEnvAsBool("GENERATE_MANAGEMENT_ZONES", false)
+func IsManagementZonesGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_MANAGEMENT_ZONES", false)
 }
 
 // IsDashboardsGenerationEnabled returns whether dashboards should be generated when configuring the monitoring
-func IsDashboardsGenerationEnabled() bool {
-	return readEnvAsBool("GENERATE_DASHBOARDS", false)
+func IsDashboardsGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_DASHBOARDS", false)
 }
 
 // IsMetricEventsGenerationEnabled returns whether metric events should be generated when configuring the monitoring
-func IsMetricEventsGenerationEnabled() bool {
-	return readEnvAsBool("GENERATE_METRIC_EVENTS", false)
+func IsMetricEventsGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_METRIC_EVENTS", false)
+}
+
+// IsSLOsGenerationEnabled returns whether Dynatrace SLOs should be generated from the slo.yaml files when configuring the monitoring
+func IsSLOsGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_SLOS", false)
+}
+
+// IsCalculatedMetricsGenerationEnabled returns whether calculated service metrics per test step should be generated when configuring the monitoring
+func IsCalculatedMetricsGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_CALCULATED_METRICS", false)
+}
+
+// IsServiceNamingRulesGenerationEnabled returns whether a service naming rule for the services deployed by Keptn should be generated when configuring the monitoring
+func IsServiceNamingRulesGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_SERVICE_NAMING_RULES", false)
+}
+
+// IsKubernetesTaggingRulesGenerationEnabled returns whether the tagging rules should also tag the cloud applications in the Kubernetes namespaces of the Keptn stages
+func IsKubernetesTaggingRulesGenerationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "GENERATE_KUBERNETES_TAGGING_RULES", false)
+}
+
+// isGenerationEnabled returns the setting of the dynatrace.conf.yaml of the project if it is set, otherwise the setting of the service
+func isGenerationEnabled(ctx context.Context, projectSetting *bool, isEnabledForService func(context.Context) bool) bool {
+	if projectSetting != nil {
+		return *projectSetting
+	}
+	return isEnabledForService(ctx)
+}
+
+func (dt *DynatraceHelper) getGenerateSettings() config.DtGenerate {
+	if dt.generate == nil {
+		return config.DtGenerate{}
+	}
+	return *dt.generate
+}
+
+func (dt *DynatraceHelper) isTaggingRulesGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().TaggingRules, IsTaggingRulesGenerationEnabled)
+}
+
+func (dt *DynatraceHelper) isProblemNotificationsGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().ProblemNotifications, IsProblemNotificationsGenerationEnabled)
+}
+
+func (dt *DynatraceHelper) isManagementZonesGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().ManagementZones, IsManagementZonesGenerationEnabled)
+}
+
+func (dt *DynatraceHelper) isDashboardsGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().Dashboards, IsDashboardsGenerationEnabled)
+}
+
+func (dt *DynatraceHelper) isMetricEventsGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().MetricEvents, IsMetricEventsGenerationEnabled)
+}
+
+func (dt *DynatraceHelper) isSLOsGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().SLOs, IsSLOsGenerationEnabled)
+}
+
+func (dt *DynatraceHelper) isCalculatedMetricsGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().CalculatedMetrics, IsCalculatedMetricsGenerationEnabled)
+}
+
+func (dt *DynatraceHelper) isServiceNamingRulesGenerationEnabled() bool {
+	return isGenerationEnabled(dt.EventContext, dt.getGenerateSettings().ServiceNamingRules, IsServiceNamingRulesGenerationEnabled)
+}
+
+// GetInstallationID returns the ID of the Keptn installation that is added to the ownership marker of the entities created by the dynatrace-service,
+// so that several Keptn installations can share a tenant without deleting each other's entities
+func GetInstallationID() string {
+	return readEnvAsString("KEPTN_INSTALLATION_ID", "")
+}
+
+// IsDeletedProjectsCleanupEnabled returns whether configure monitoring also deletes the management zones of projects that no longer exist in Keptn
+func IsDeletedProjectsCleanupEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "CLEANUP_DELETED_PROJECTS", false)
+}
+
+// IsTaggingRulesCleanupEnabled returns whether the tagging rules shared by all projects are deleted together with the last Keptn project.
+// They may also be used by other Keptn installations on the same tenant, so they are kept by default
+func IsTaggingRulesCleanupEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "CLEANUP_TAGGING_RULES", false)
+}
+
+// IsMonacoEnabled returns whether configure monitoring applies the monaco projects of the project resources, it is disabled by default
+// as everybody who can add resources to a project could change the configuration of the tenant otherwise
+func IsMonacoEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "APPLY_MONACO_PROJECTS", false)
+}
+
+// GetMonacoAllowedAPIPaths returns the comma separated API paths the monaco projects may change, e.g: /api/config/v1/managementZones - none are allowed if it is empty
+func GetMonacoAllowedAPIPaths() []string {
+	return readEnvAsList("MONACO_ALLOWED_API_PATHS")
+}
+
+// GetConfigurationAPI returns which API is used to configure tagging rules, problem notifications and metric events: auto, settings or v1.
+// auto detects whether the tenant supports the Settings 2.0 API and falls back to the configuration API v1 otherwise.
+func GetConfigurationAPI() string {
+	return readEnvAsString("CONFIGURATION_API", "auto")
+}
+
+// GetEventsAPI returns which API is used to send events to Dynatrace: v1 (default), v2 or auto.
+// auto uses the Events API v2 and falls back to the events API v1 if the tenant doesn't support it.
+func GetEventsAPI() string {
+	return readEnvAsString("EVENTS_API", "v1")
+}
+
+// IsBizEventsEnabled returns whether finished deployments and evaluations are sent to Dynatrace as business events
+func IsBizEventsEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "SEND_BIZ_EVENTS", false)
+}
+
+// IsDashboardDebugEndpointEnabled returns whether dashboards can be parsed ad hoc with GET /debug/dashboard on the health port
+func IsDashboardDebugEndpointEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "DASHBOARD_DEBUG_ENDPOINT", false)
 }
 
 // IsHttpSSLVerificationEnabled returns whether the SSL verification is enabled or disabled
-func IsHttpSSLVerificationEnabled() bool {
-	return readEnvAsBool("HTTP_SSL_VERIFY", true)
+func IsHttpSSLVerificationEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "HTTP_SSL_VERIFY", true)
 }
 
 // IsServiceSyncEnabled returns wether the service synchronization is enabled or disabled
-func IsServiceSyncEnabled() bool {
-	return readEnvAsBool("SYNCHRONIZE_DYNATRACE_SERVICES", false)
+func IsServiceSyncEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "SYNCHRONIZE_DYNATRACE_SERVICES", false)
 }
 
 // GetServiceSyncInterval returns the number of seconds the service synchronizer should sleep between synchronization runs.
 // If the environment variable is empty or cannot be parsed, a default sync interval is used.
-func GetServiceSyncInterval() int {
-	return readEnvAsInt("SYNCHRONIZE_DYNATRACE_SERVICES_INTERVAL_SECONDS", 60)
+func GetServiceSyncInterval(ctx context.Context) int {
+	return readEnvAsInt(ctx, "SYNCHRONIZE_DYNATRACE_SERVICES_INTERVAL_SECONDS", 60)
+}
+
+// GetEventBatchSize returns the maximum number of entity IDs an event is attached to per request to the Dynatrace events API.
+// If the environment variable is empty or cannot be parsed, a default batch size is used.
+func GetEventBatchSize(ctx context.Context) int {
+	return readEnvAsInt(ctx, "EVENT_BATCH_SIZE", 100)
+}
+
+// GetRetryAttempts returns how often failed events and problem comments are retried.
+// If the environment variable is empty or cannot be parsed, a default number of retries is used.
+func GetRetryAttempts(ctx context.Context) int {
+	return readEnvAsInt(ctx, "RETRY_ATTEMPTS", 3)
+}
+
+// GetProblemProjectTag returns the key of the tag that defines the Keptn project of an incoming Dynatrace problem
+func GetProblemProjectTag() string {
+	return readEnvAsString("PROBLEM_PROJECT_TAG", "keptn_project")
+}
+
+// GetProblemStageTag returns the key of the tag that defines the Keptn stage of an incoming Dynatrace problem
+func GetProblemStageTag() string {
+	return readEnvAsString("PROBLEM_STAGE_TAG", "keptn_stage")
+}
+
+// GetProblemServiceTag returns the key of the tag that defines the Keptn service of an incoming Dynatrace problem
+func GetProblemServiceTag() string {
+	return readEnvAsString("PROBLEM_SERVICE_TAG", "keptn_service")
+}
+
+// GetProblemContextMapping returns the rules that map problems without Keptn tags to a Keptn project, stage and service.
+// The rules are defined as JSON array, if the environment variable is empty or cannot be parsed no rules are used.
+func GetProblemContextMapping(ctx context.Context) []config.ProblemContextMappingRule {
+	envValue := os.Getenv("PROBLEM_CONTEXT_MAPPING")
+	if envValue == "" {
+		return nil
+	}
+
+	var rules []config.ProblemContextMappingRule
+	if err := json.Unmarshal([]byte(envValue), &rules); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("name", "PROBLEM_CONTEXT_MAPPING").Error("Unable to parse environment variable. Using no rules.")
+		return nil
+	}
+	return rules
+}
+
+// IsProblemEnrichmentEnabled returns whether incoming problems are enriched with the details of the Dynatrace Problems API v2
+func IsProblemEnrichmentEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "PROBLEM_ENRICHMENT", false)
+}
+
+// GetProblemDefaultProject returns the Keptn project of problems that can't be mapped to a project via tags or the context mapping
+func GetProblemDefaultProject() string {
+	return os.Getenv("PROBLEM_DEFAULT_PROJECT")
+}
+
+// GetProblemDefaultStage returns the Keptn stage of problems that can't be mapped to a stage via tags or the context mapping
+func GetProblemDefaultStage() string {
+	return os.Getenv("PROBLEM_DEFAULT_STAGE")
+}
+
+// GetProblemDefaultService returns the Keptn service of problems that can't be mapped to a service via tags or the context mapping
+func GetProblemDefaultService() string {
+	return os.Getenv("PROBLEM_DEFAULT_SERVICE")
+}
+
+// IsDropUnmappedProblemsEnabled returns whether problems that can't be mapped to a Keptn project, stage and service are ignored
+func IsDropUnmappedProblemsEnabled(ctx context.Context) bool {
+	return readEnvAsBool(ctx, "PROBLEM_DROP_UNMAPPED", false)
+}
+
+/**
+ * IsManagementZoneAllowed returns whether problems of the passed management zones are converted into Keptn problem events.
+ * If PROBLEM_MANAGEMENT_ZONES_ALLOW is set, at least one of the management zones has to be in this comma separated list - problems without management zones are ignored in this case.
+ * Problems of a management zone in the comma separated list PROBLEM_MANAGEMENT_ZONES_DENY are always ignored.
+ */
+func IsManagementZoneAllowed(managementZones []string) bool {
+	allowList := readEnvAsList("PROBLEM_MANAGEMENT_ZONES_ALLOW")
+	denyList := readEnvAsList("PROBLEM_MANAGEMENT_ZONES_DENY")
+
+	allowed := len(allowList) == 0
+	for _, managementZone := range managementZones {
+		if containsString(denyList, managementZone) {
+			return false
+		}
+		if containsString(allowList, managementZone) {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// readEnvAsList returns the values of a comma separated environment variable
+func readEnvAsList(env string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(env), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func readEnvAsString(env string, defaultValue string) string {
+	envValue := os.Getenv(env)
+	if envValue == "" {
+		return defaultValue
+	}
+	return envValue
 }
 
-func readEnvAsBool(env string, defaultValue bool) bool {
+func readEnvAsBool(ctx context.Context, env string, defaultValue bool) bool {
+	logger := logging.FromContext(ctx)
 	envValue := os.Getenv(env)
 	if envValue == "" {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"name":    env,
 				"default": defaultValue,
@@ -61,7 +302,7 @@ func readEnvAsBool(env string, defaultValue bool) bool {
 
 	boolValue, err := strconv.ParseBool(envValue)
 	if err != nil {
-		log.WithError(err).WithFields(
+		logger.WithError(err).WithFields(
 			log.Fields{
 				"name":    env,
 				"value":   envValue,
@@ -73,10 +314,11 @@ func readEnvAsBool(env string, defaultValue bool) bool {
 	return boolValue
 }
 
-func readEnvAsInt(env string, defaultValue int) int {
+func readEnvAsInt(ctx context.Context, env string, defaultValue int) int {
+	logger := logging.FromContext(ctx)
 	envValue := os.Getenv(env)
 	if envValue == "" {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"name":    env,
 				"default": defaultValue,
@@ -86,7 +328,7 @@ func readEnvAsInt(env string, defaultValue int) int {
 
 	parseInt, err := strconv.ParseInt(envValue, 10, 32)
 	if err != nil {
-		log.WithError(err).WithFields(
+		logger.WithError(err).WithFields(
 			log.Fields{
 				"name":    env,
 				"value":   envValue,
@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+)
+
+func TestIsManagementZoneAllowed(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowList       string
+		denyList        string
+		managementZones []string
+		want            bool
+	}{
+		{
+			name:            "no lists",
+			managementZones: []string{"sockshop"},
+			want:            true,
+		},
+		{
+			name:            "no lists and no management zones",
+			managementZones: nil,
+			want:            true,
+		},
+		{
+			name:            "allowed management zone",
+			allowList:       "sockshop, carts",
+			managementZones: []string{"other", "carts"},
+			want:            true,
+		},
+		{
+			name:            "management zone not allowed",
+			allowList:       "sockshop",
+			managementZones: []string{"other"},
+			want:            false,
+		},
+		{
+			name:            "no management zones with allow list",
+			allowList:       "sockshop",
+			managementZones: nil,
+			want:            false,
+		},
+		{
+			name:            "denied management zone",
+			denyList:        "other",
+			managementZones: []string{"sockshop", "other"},
+			want:            false,
+		},
+		{
+			name:            "deny list wins over allow list",
+			allowList:       "sockshop",
+			denyList:        "other",
+			managementZones: []string{"sockshop", "other"},
+			want:            false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("PROBLEM_MANAGEMENT_ZONES_ALLOW", tt.allowList)
+			os.Setenv("PROBLEM_MANAGEMENT_ZONES_DENY", tt.denyList)
+			defer os.Unsetenv("PROBLEM_MANAGEMENT_ZONES_ALLOW")
+			defer os.Unsetenv("PROBLEM_MANAGEMENT_ZONES_DENY")
+
+			if got := IsManagementZoneAllowed(tt.managementZones); got != tt.want {
+				t.Errorf("IsManagementZoneAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_isGenerationEnabled(t *testing.T) {
+	os.Setenv("GENERATE_MANAGEMENT_ZONES", "true")
+	defer os.Unsetenv("GENERATE_MANAGEMENT_ZONES")
+
+	enabled := true
+	disabled := false
+	tests := []struct {
+		name           string
+		generate       *config.DtGenerate
+		wantMZs        bool
+		wantDashboards bool
+	}{
+		{
+			name:           "settings of the service",
+			generate:       nil,
+			wantMZs:        true,
+			wantDashboards: false,
+		},
+		{
+			name:           "settings of the project",
+			generate:       &config.DtGenerate{ManagementZones: &disabled, Dashboards: &enabled},
+			wantMZs:        false,
+			wantDashboards: true,
+		},
+		{
+			name:           "unset settings of the project",
+			generate:       &config.DtGenerate{TaggingRules: &enabled},
+			wantMZs:        true,
+			wantDashboards: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := NewDynatraceHelper(nil, nil)
+			dt.generate = tt.generate
+			if got := dt.isManagementZonesGenerationEnabled(); got != tt.wantMZs {
+				t.Errorf("isManagementZonesGenerationEnabled() = %v, want %v", got, tt.wantMZs)
+			}
+			if got := dt.isDashboardsGenerationEnabled(); got != tt.wantDashboards {
+				t.Errorf("isDashboardsGenerationEnabled() = %v, want %v", got, tt.wantDashboards)
+			}
+		})
+	}
+}
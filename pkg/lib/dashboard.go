@@ -6,48 +6,69 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
-	log "github.com/sirupsen/logrus"
 )
 
 // CreateDashboard creates a new dashboard for the provided project
 func (dt *DynatraceHelper) CreateDashboard(project string, shipyard keptnv2.Shipyard) {
-	if !IsDashboardsGenerationEnabled() {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isDashboardsGenerationEnabled() {
 		return
 	}
 
 	// first, check if dashboard for this project already exists and delete that
 	err := dt.DeleteExistingDashboard(project)
 	if err != nil {
-		log.WithError(err).Error("Could not delete existing dashboard")
+		logger.WithError(err).Error("Could not delete existing dashboard")
 		dt.configuredEntities.Dashboard.Success = false
 		dt.configuredEntities.Dashboard.Message = "Could not delete existing dashboard: " + err.Error()
 		return
 	}
 
-	log.WithField("project", project).Info("Creating Dashboard for project")
-	dashboard := createDynatraceDashboard(project, shipyard)
-	dashboardPayload, err := json.Marshal(dashboard)
-	if err != nil {
-		log.WithError(err).Error("Failed to unmarshal Dynatrace dashboards")
-		dt.configuredEntities.Dashboard.Success = false
-		dt.configuredEntities.Dashboard.Message = fmt.Sprintf("failed to unmarshal Dynatrace dashboards: %v", err)
-		return
+	logger.WithField("project", project).Info("Creating Dashboard for project")
+	var dashboardPayload []byte
+	if dt.dashboardTemplate != "" {
+		dashboardPayload, err = dt.createDashboardPayloadFromTemplate(project, shipyard)
+		if err != nil {
+			logger.WithError(err).WithField("dashboardTemplate", dt.dashboardTemplate).Error("Failed to create Dynatrace dashboard from template")
+			dt.configuredEntities.Dashboard.Success = false
+			dt.configuredEntities.Dashboard.Message = fmt.Sprintf("failed to create Dynatrace dashboard from template %s: %v", dt.dashboardTemplate, err)
+			return
+		}
+	} else {
+		dashboard := createDynatraceDashboard(project, shipyard)
+		dashboardPayload, err = json.Marshal(dashboard)
+		if err != nil {
+			logger.WithError(err).Error("Failed to unmarshal Dynatrace dashboards")
+			dt.configuredEntities.Dashboard.Success = false
+			dt.configuredEntities.Dashboard.Message = fmt.Sprintf("failed to unmarshal Dynatrace dashboards: %v", err)
+			return
+		}
 	}
 
 	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/dashboards", "POST", dashboardPayload)
 	if err != nil {
-		log.WithError(err).Error("Failed to create Dynatrace dashboards")
+		logger.WithError(err).Error("Failed to create Dynatrace dashboards")
 		dt.configuredEntities.Dashboard.Success = false
 		dt.configuredEntities.Dashboard.Message = fmt.Sprintf("failed to create Dynatrace dashboards: %v", err)
 		return
 	}
-	log.WithField("dashboardUrl", "https://"+dt.DynatraceCreds.Tenant+"/#dashboards").Info("Dynatrace dashboard created successfully")
-	dt.configuredEntities.Dashboard.Success = false
+	logger.WithField("dashboardUrl", "https://"+dt.DynatraceCreds.Tenant+"/#dashboards").Info("Dynatrace dashboard created successfully")
+	dt.configuredEntities.Dashboard.Name = project + dashboardNameSuffix
+	dt.configuredEntities.Dashboard.Success = true
 	dt.configuredEntities.Dashboard.Message = "Dynatrace dashboard created successfully. You can view it here: https://" + dt.DynatraceCreds.Tenant + "/#dashboards"
 	return
 }
 
+func (dt *DynatraceHelper) createDashboardPayloadFromTemplate(project string, shipyard keptnv2.Shipyard) ([]byte, error) {
+	template, err := getDashboardTemplate(project, dt.dashboardTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve dashboard template: %v", err)
+	}
+	return createDashboardFromTemplate(template, project, shipyard)
+}
+
 const dashboardNameSuffix = "@keptn: Digital Delivery & Operations Dashboard"
 
 // DeleteExistingDashboard deletes an existing dashboard for the provided project
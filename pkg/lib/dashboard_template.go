@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// getDashboardTemplate returns the content of the dashboard template that is stored as a resource of the project
+var getDashboardTemplate = func(project string, resourceURI string) (string, error) {
+	resourceHandler := common.NewResourceHandler()
+	resource, err := resourceHandler.GetProjectResource(project, resourceURI)
+	if err != nil {
+		return "", err
+	}
+	if resource.ResourceContent == "" {
+		return "", fmt.Errorf("resource %s of project %s is empty", resourceURI, project)
+	}
+	return resource.ResourceContent, nil
+}
+
+/**
+ * createDashboardFromTemplate instantiates the dashboard JSON template for the project: $PROJECT is replaced by the name of the project and tiles containing $STAGE
+ * are repeated for every stage of the shipyard - like the default dashboard, the copy of the n-th stage is moved n times the width of the tile to the right.
+ * The name of the dashboard is always set to <project>@keptn: Digital Delivery & Operations Dashboard, so that it is replaced when monitoring is configured again
+ */
+func createDashboardFromTemplate(template string, project string, shipyard keptnv2.Shipyard) ([]byte, error) {
+	dashboard := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(template), &dashboard); err != nil {
+		return nil, fmt.Errorf("failed to parse dashboard template: %v", err)
+	}
+
+	templateTiles, _ := dashboard["tiles"].([]interface{})
+	tiles := []interface{}{}
+	for _, templateTile := range templateTiles {
+		tileJSON, err := json.Marshal(templateTile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse tile of dashboard template: %v", err)
+		}
+		tileTemplate := strings.ReplaceAll(string(tileJSON), "$PROJECT", project)
+
+		if !strings.Contains(tileTemplate, "$STAGE") {
+			tiles = append(tiles, templateTile)
+			continue
+		}
+		for index, stage := range shipyard.Spec.Stages {
+			tile := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(strings.ReplaceAll(tileTemplate, "$STAGE", stage.Name)), &tile); err != nil {
+				return nil, fmt.Errorf("failed to instantiate tile of dashboard template for stage %s: %v", stage.Name, err)
+			}
+			if bounds, ok := tile["bounds"].(map[string]interface{}); ok {
+				left, _ := bounds["left"].(float64)
+				width, _ := bounds["width"].(float64)
+				bounds["left"] = left + float64(index)*width
+			}
+			tiles = append(tiles, tile)
+		}
+	}
+	dashboard["tiles"] = tiles
+
+	dashboardJSON, err := json.Marshal(dashboard)
+	if err != nil {
+		return nil, err
+	}
+	// replace the remaining placeholders, e.g. in the dashboard filter
+	dashboard = map[string]interface{}{}
+	if err := json.Unmarshal([]byte(strings.ReplaceAll(string(dashboardJSON), "$PROJECT", project)), &dashboard); err != nil {
+		return nil, fmt.Errorf("failed to instantiate dashboard template: %v", err)
+	}
+
+	metadata, ok := dashboard["dashboardMetadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{"shared": true}
+		dashboard["dashboardMetadata"] = metadata
+	}
+	metadata["name"] = project + dashboardNameSuffix
+
+	return json.Marshal(dashboard)
+}
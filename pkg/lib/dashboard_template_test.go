@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestCreateDashboardFromTemplate(t *testing.T) {
+	template := `{
+		"dashboardMetadata": {"name": "My dashboard", "shared": true},
+		"tiles": [
+			{"name": "Markdown", "tileType": "MARKDOWN", "markdown": "Project $PROJECT", "bounds": {"top": 0, "left": 0, "width": 304, "height": 38}},
+			{"name": "Services $STAGE", "tileType": "SERVICES", "assignedEntities": ["$PROJECT-$STAGE"], "bounds": {"top": 38, "left": 0, "width": 304, "height": 152}}
+		]
+	}`
+	shipyard := keptnv2.Shipyard{}
+	shipyard.Spec.Stages = []keptnv2.Stage{{Name: "dev"}, {Name: "prod"}}
+
+	payload, err := createDashboardFromTemplate(template, "sockshop", shipyard)
+	if err != nil {
+		t.Fatalf("createDashboardFromTemplate() error = %v", err)
+	}
+	dashboard := &DynatraceDashboard{}
+	if err := json.Unmarshal(payload, dashboard); err != nil {
+		t.Fatalf("createDashboardFromTemplate() returned invalid dashboard: %v", err)
+	}
+
+	if dashboard.DashboardMetadata.Name != "sockshop"+dashboardNameSuffix {
+		t.Errorf("createDashboardFromTemplate() name = %s, want %s", dashboard.DashboardMetadata.Name, "sockshop"+dashboardNameSuffix)
+	}
+	if len(dashboard.Tiles) != 3 {
+		t.Fatalf("createDashboardFromTemplate() returned %d tiles, want 3", len(dashboard.Tiles))
+	}
+	if dashboard.Tiles[0].Markdown != "Project sockshop" {
+		t.Errorf("createDashboardFromTemplate() markdown = %s, want Project sockshop", dashboard.Tiles[0].Markdown)
+	}
+	for i, stage := range []string{"dev", "prod"} {
+		tile := dashboard.Tiles[i+1]
+		if tile.Name != "Services "+stage || tile.AssignedEntities[0] != "sockshop-"+stage {
+			t.Errorf("createDashboardFromTemplate() tile = %s %v, want the tile of stage %s", tile.Name, tile.AssignedEntities, stage)
+		}
+		if tile.Bounds.Left != i*304 {
+			t.Errorf("createDashboardFromTemplate() left of tile %s = %d, want %d", tile.Name, tile.Bounds.Left, i*304)
+		}
+	}
+}
+
+func TestCreateDashboardFromInvalidTemplate(t *testing.T) {
+	if _, err := createDashboardFromTemplate("{", "sockshop", keptnv2.Shipyard{}); err == nil {
+		t.Errorf("createDashboardFromTemplate() error = nil, want an error for an invalid template")
+	}
+}
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const (
+	managedEntityTaggingRule         = "tagging rule"
+	managedEntityProblemNotification = "problem notification"
+	managedEntityManagementZone      = "management zone"
+	managedEntityDashboard           = "dashboard"
+)
+
+// managedEntity is an entity the dynatrace-service creates when monitoring is configured, e.g: the management zone Keptn: sockshop dev
+type managedEntity struct {
+	kind string
+	name string
+}
+
+/**
+ * DetectConfigurationDrift compares the tagging rules, problem notification, management zones and dashboard the dynatrace-service creates for the project
+ * with the entities of the tenant and returns the ones that have been deleted or renamed since monitoring was last configured. As nothing is missing
+ * on purpose if none of the entities exists, e.g. when the project is configured for the first time, no drift is reported in that case
+ */
+func (dt *DynatraceHelper) DetectConfigurationDrift(project string, shipyard keptnv2.Shipyard) []string {
+	logger := logging.FromContext(dt.EventContext)
+	expectedEntities := dt.getExpectedManagedEntities(project, shipyard)
+
+	existingEntityNames := map[string][]string{}
+	for _, entity := range expectedEntities {
+		if _, ok := existingEntityNames[entity.kind]; ok {
+			continue
+		}
+		names, err := dt.getExistingEntityNames(entity.kind)
+		if err != nil {
+			logger.WithError(err).WithField("kind", entity.kind).Warn("Could not check configuration drift")
+			return nil
+		}
+		existingEntityNames[entity.kind] = names
+	}
+
+	drift := getConfigurationDrift(expectedEntities, existingEntityNames)
+	for _, message := range drift {
+		logger.WithField("project", project).Warn("Configuration drift detected: " + message)
+	}
+	return drift
+}
+
+// getExpectedManagedEntities returns the entities that are created for the project with the current settings
+func (dt *DynatraceHelper) getExpectedManagedEntities(project string, shipyard keptnv2.Shipyard) []managedEntity {
+	var entities []managedEntity
+	if dt.isTaggingRulesGenerationEnabled() {
+		for _, ruleName := range taggingRuleNames {
+			entities = append(entities, managedEntity{kind: managedEntityTaggingRule, name: ruleName})
+		}
+	}
+	if dt.isProblemNotificationsGenerationEnabled() {
+		for _, name := range dt.getProblemNotificationNames(project, shipyard) {
+			entities = append(entities, managedEntity{kind: managedEntityProblemNotification, name: name})
+		}
+	}
+	if dt.isManagementZonesGenerationEnabled() {
+		entities = append(entities, managedEntity{kind: managedEntityManagementZone, name: dt.getProjectManagementZoneName(project)})
+		for _, stage := range shipyard.Spec.Stages {
+			entities = append(entities, managedEntity{kind: managedEntityManagementZone, name: dt.getStageManagementZoneName(project, stage.Name)})
+		}
+	}
+	if dt.isDashboardsGenerationEnabled() {
+		entities = append(entities, managedEntity{kind: managedEntityDashboard, name: project + dashboardNameSuffix})
+	}
+	return entities
+}
+
+func (dt *DynatraceHelper) getExistingEntityNames(kind string) ([]string, error) {
+	switch kind {
+	case managedEntityTaggingRule:
+		useSettingsAPI, err := dt.useSettingsAPI()
+		if err != nil {
+			return nil, err
+		}
+		if useSettingsAPI {
+			return dt.getSettingsObjectNames(autoTaggingSchemaID, "name")
+		}
+		return dt.getConfigEntityNames("/api/config/v1/autoTags")
+	case managedEntityProblemNotification:
+		useSettingsAPI, err := dt.useSettingsAPI()
+		if err != nil {
+			return nil, err
+		}
+		if useSettingsAPI {
+			return dt.getSettingsObjectNames(problemNotificationSchemaID, "displayName")
+		}
+		return dt.getConfigEntityNames("/api/config/v1/notifications")
+	case managedEntityManagementZone:
+		return dt.getConfigEntityNames("/api/config/v1/managementZones")
+	case managedEntityDashboard:
+		response, err := dt.sendDynatraceAPIRequest("/api/config/v1/dashboards", "GET", nil)
+		if err != nil {
+			return nil, err
+		}
+		dashboards := &DTDashboardsResponse{}
+		if err := json.Unmarshal([]byte(response), dashboards); err != nil {
+			return nil, checkForUnexpectedHTMLResponseError(err)
+		}
+		var names []string
+		for _, dashboard := range dashboards.Dashboards {
+			names = append(names, dashboard.Name)
+		}
+		return names, nil
+	}
+	return nil, fmt.Errorf("unknown entity kind %s", kind)
+}
+
+func (dt *DynatraceHelper) getConfigEntityNames(apiPath string) ([]string, error) {
+	response, err := dt.sendDynatraceAPIRequest(apiPath, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	entities := &DTAPIListResponse{}
+	if err := json.Unmarshal([]byte(response), entities); err != nil {
+		return nil, checkForUnexpectedHTMLResponseError(err)
+	}
+	var names []string
+	for _, entity := range entities.Values {
+		names = append(names, entity.Name)
+	}
+	return names, nil
+}
+
+func (dt *DynatraceHelper) getSettingsObjectNames(schemaID string, field string) ([]string, error) {
+	objects, err := dt.getSettingsObjects(schemaID, settingsEnvironmentScope)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, object := range objects {
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(object.Value, &fields); err != nil {
+			continue
+		}
+		if name, ok := fields[field].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// getConfigurationDrift returns a message for every expected entity that doesn't exist, e.g: management zone Keptn: sockshop dev is missing
+func getConfigurationDrift(expectedEntities []managedEntity, existingEntityNames map[string][]string) []string {
+	var drift []string
+	for _, entity := range expectedEntities {
+		if !containsString(existingEntityNames[entity.kind], entity.name) {
+			drift = append(drift, entity.kind+" "+entity.name+" is missing")
+		}
+	}
+	if len(drift) == len(expectedEntities) {
+		return nil
+	}
+	return drift
+}
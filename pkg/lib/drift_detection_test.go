@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetConfigurationDrift(t *testing.T) {
+	expectedEntities := []managedEntity{
+		{kind: managedEntityManagementZone, name: "Keptn: sockshop"},
+		{kind: managedEntityManagementZone, name: "Keptn: sockshop dev"},
+		{kind: managedEntityDashboard, name: "sockshop" + dashboardNameSuffix},
+	}
+	tests := []struct {
+		name                string
+		existingEntityNames map[string][]string
+		want                []string
+	}{
+		{
+			name: "no drift",
+			existingEntityNames: map[string][]string{
+				managedEntityManagementZone: {"Keptn: sockshop", "Keptn: sockshop dev", "Production"},
+				managedEntityDashboard:      {"sockshop" + dashboardNameSuffix},
+			},
+			want: nil,
+		},
+		{
+			name: "deleted entities",
+			existingEntityNames: map[string][]string{
+				managedEntityManagementZone: {"Keptn: sockshop"},
+			},
+			want: []string{"management zone Keptn: sockshop dev is missing", "dashboard sockshop" + dashboardNameSuffix + " is missing"},
+		},
+		{
+			name:                "project not configured yet",
+			existingEntityNames: map[string][]string{},
+			want:                nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getConfigurationDrift(expectedEntities, tt.existingEntityNames)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("getConfigurationDrift() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+const dryRunEntityID = "dry-run"
+
+/**
+ * recordPlannedChange records a write request that is not sent to Dynatrace because the DynatraceHelper runs in dry run mode, e.g: create /api/config/v1/managementZones (Keptn: sockshop dev)
+ * It returns a response as if the entity was created, so that the configuration of dependent entities can be computed as well
+ */
+func (dt *DynatraceHelper) recordPlannedChange(apiPath string, method string, body []byte) string {
+	logger := logging.FromContext(dt.EventContext)
+	change := getPlannedChangeAction(method) + " " + strings.Split(apiPath, "?")[0]
+	if name := getPlannedChangeEntityName(body); name != "" {
+		change = change + " (" + name + ")"
+	}
+
+	logger.WithField("change", change).Info("Dry run - not sending request to Dynatrace")
+	if dt.configuredEntities != nil {
+		dt.configuredEntities.PlannedChanges = append(dt.configuredEntities.PlannedChanges, change)
+	}
+
+	if method == "POST" && strings.HasPrefix(apiPath, "/api/v2/settings/objects") {
+		return `[{"code": 200, "objectId": "` + dryRunEntityID + `"}]`
+	}
+	return `{"id": "` + dryRunEntityID + `"}`
+}
+
+func getPlannedChangeAction(method string) string {
+	switch method {
+	case "POST":
+		return "create"
+	case "PUT":
+		return "update"
+	case "DELETE":
+		return "delete"
+	}
+	return strings.ToLower(method)
+}
+
+// getPlannedChangeEntityName returns the name of the entity in the request body - settings objects are wrapped into a list of objects with a value
+func getPlannedChangeEntityName(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var entity map[string]json.RawMessage
+	var settingsObjects []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &settingsObjects); err == nil && len(settingsObjects) > 0 {
+		entity = settingsObjects[0]
+	} else if err := json.Unmarshal(body, &entity); err != nil {
+		return ""
+	}
+	if value, ok := entity["value"]; ok {
+		var settingsValue map[string]json.RawMessage
+		if err := json.Unmarshal(value, &settingsValue); err == nil {
+			entity = settingsValue
+		}
+	}
+
+	for _, field := range []string{"name", "displayName", "summary", "tsmMetricKey"} {
+		var name string
+		if err := json.Unmarshal(entity[field], &name); err == nil && name != "" {
+			return name
+		}
+	}
+	if metadata, ok := entity["dashboardMetadata"]; ok {
+		return getPlannedChangeEntityName(metadata)
+	}
+	return ""
+}
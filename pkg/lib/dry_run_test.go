@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestGetPlannedChangeEntityName(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "configuration API v1 entity",
+			body: `{"name": "Keptn: sockshop dev", "rules": []}`,
+			want: "Keptn: sockshop dev",
+		},
+		{
+			name: "settings object",
+			body: `[{"schemaId": "builtin:problem.notifications", "scope": "environment", "value": {"displayName": "Keptn Problem Notification"}}]`,
+			want: "Keptn Problem Notification",
+		},
+		{
+			name: "dashboard",
+			body: `{"dashboardMetadata": {"name": "sockshop@keptn: Digital Delivery & Operations Dashboard"}, "tiles": []}`,
+			want: "sockshop@keptn: Digital Delivery & Operations Dashboard",
+		},
+		{
+			name: "no body",
+			body: "",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getPlannedChangeEntityName([]byte(tt.body)); got != tt.want {
+				t.Errorf("getPlannedChangeEntityName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_sendDynatraceAPIRequestInDryRun(t *testing.T) {
+	// no request may be sent to the tenant in dry run mode
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: "http://127.0.0.1:1"})
+	dt.DryRun = true
+	dt.configuredEntities = &ConfiguredEntities{}
+
+	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/managementZones", "POST", []byte(`{"name": "Keptn: sockshop dev"}`))
+	if err != nil || response != `{"id": "dry-run"}` {
+		t.Errorf("sendDynatraceAPIRequest() = %s, %v, want the response of a created entity", response, err)
+	}
+	response, err = dt.sendDynatraceAPIRequest("/api/v2/settings/objects", "POST", []byte(`[{"value": {"name": "keptn_service"}}]`))
+	if err != nil || response != `[{"code": 200, "objectId": "dry-run"}]` {
+		t.Errorf("sendDynatraceAPIRequest() = %s, %v, want the response of a created settings object", response, err)
+	}
+	_, _ = dt.sendDynatraceAPIRequest("/api/config/v1/dashboards/1234", "DELETE", nil)
+
+	want := []string{
+		"create /api/config/v1/managementZones (Keptn: sockshop dev)",
+		"create /api/v2/settings/objects (keptn_service)",
+		"delete /api/config/v1/dashboards/1234",
+	}
+	if len(dt.configuredEntities.PlannedChanges) != len(want) {
+		t.Errorf("sendDynatraceAPIRequest() planned changes = %v, want %v", dt.configuredEntities.PlannedChanges, want)
+		return
+	}
+	for i, change := range dt.configuredEntities.PlannedChanges {
+		if change != want[i] {
+			t.Errorf("sendDynatraceAPIRequest() planned change = %s, want %s", change, want[i])
+		}
+	}
+}
@@ -2,19 +2,27 @@ package lib
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/metrics"
+	"github.com/keptn-contrib/dynatrace-service/pkg/tracing"
 	keptnutils "github.com/keptn/go-utils/pkg/api/utils"
 )
 
@@ -48,6 +56,26 @@ type DynatraceHelper struct {
 	KeptnHandler       *keptnv2.Keptn
 	KeptnBridge        string
 	configuredEntities *ConfiguredEntities
+	// settingsAPISupported caches whether the tenant supports the Settings 2.0 API
+	settingsAPISupported *bool
+	// managementZones defines the additional scoping of the management zones of the stages of the dynatrace.conf.yaml
+	managementZones *config.DtManagementZones
+	// managementZoneNames are the name templates of the management zones of the dynatrace.conf.yaml
+	managementZoneNames *config.DtManagementZoneNames
+	// metricEvents defines how the metric events of the SLIs are created according to the dynatrace.conf.yaml
+	metricEvents *config.DtMetricEvents
+	// generate are the settings of the dynatrace.conf.yaml that overwrite which entities are generated for the project
+	generate *config.DtGenerate
+	// dashboardTemplate is the resource URI of the dashboard template of the dynatrace.conf.yaml
+	dashboardTemplate string
+	// alertingProfile defines the scoped alerting profiles and problem notifications of the dynatrace.conf.yaml that replace the Keptn Problem Notification
+	alertingProfile *config.DtAlertingProfile
+	// credentialsMutex guards the refresh of the DynatraceCreds, which may be used by retries in the background
+	credentialsMutex sync.Mutex
+	// DryRun only records the requests that would change the configuration of the tenant instead of sending them
+	DryRun bool
+	// EventContext is the context of the processed event, it carries the logger and the parent span of the Dynatrace API requests
+	EventContext context.Context
 }
 
 // ConfigResult godoc
@@ -55,6 +83,25 @@ type ConfigResult struct {
 	Name    string
 	Success bool
 	Message string
+	// Action is one of ConfigActionCreated, ConfigActionUpdated and ConfigActionDeleted if it is known whether the entity existed before
+	Action string
+}
+
+const (
+	ConfigActionCreated    = "created"
+	ConfigActionUpdated    = "updated"
+	ConfigActionDeleted    = "deleted"
+	ConfigActionConfigured = "configured"
+)
+
+// ConfiguredEntityResult is the machine-readable result of the configuration of an entity, e.g: {"type": "managementZone", "name": "Keptn: sockshop dev", "action": "created", "success": true}
+type ConfiguredEntityResult struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
 }
 
 // ConfiguredEntities contains information about the entities configures in Dynatrace
@@ -63,12 +110,81 @@ type ConfiguredEntities struct {
 	TaggingRules                []ConfigResult
 	ProblemNotificationsEnabled bool
 	ProblemNotifications        ConfigResult
+	AlertingProfiles            []ConfigResult
+	AnomalyDetection            []ConfigResult
 	ManagementZonesEnabled      bool
 	ManagementZones             []ConfigResult
 	DashboardEnabled            bool
 	Dashboard                   ConfigResult
 	MetricEventsEnabled         bool
 	MetricEvents                []ConfigResult
+	SLOsEnabled                 bool
+	SLOs                        []ConfigResult
+	CalculatedMetricsEnabled    bool
+	CalculatedMetrics           []ConfigResult
+	ServiceNamingRulesEnabled   bool
+	ServiceNamingRules          []ConfigResult
+	MonacoConfigs               []ConfigResult
+	DryRun                      bool
+	PlannedChanges              []string
+	ConfigurationDrift          []string
+}
+
+// GetResults returns the results of the entity types that were configured in the same order as the result message of configure monitoring
+func (ce *ConfiguredEntities) GetResults() []ConfiguredEntityResult {
+	results := []ConfiguredEntityResult{}
+	addResults := func(entityType string, configResults ...ConfigResult) {
+		for _, configResult := range configResults {
+			result := ConfiguredEntityResult{
+				Type:    entityType,
+				Name:    configResult.Name,
+				Action:  configResult.Action,
+				Success: configResult.Success,
+			}
+			if result.Action == "" {
+				result.Action = ConfigActionConfigured
+			}
+			if configResult.Success {
+				result.Message = configResult.Message
+			} else {
+				result.Error = configResult.Message
+			}
+			results = append(results, result)
+		}
+	}
+
+	if ce.ManagementZonesEnabled {
+		addResults("managementZone", ce.ManagementZones...)
+	}
+	if ce.TaggingRulesEnabled {
+		addResults("taggingRule", ce.TaggingRules...)
+	}
+	if ce.ServiceNamingRulesEnabled {
+		addResults("serviceNamingRule", ce.ServiceNamingRules...)
+	}
+	if ce.ProblemNotificationsEnabled {
+		problemNotification := ce.ProblemNotifications
+		if problemNotification.Name == "" {
+			problemNotification.Name = globalProblemNotificationName
+		}
+		addResults("problemNotification", problemNotification)
+	}
+	addResults("alertingProfile", ce.AlertingProfiles...)
+	addResults("anomalyDetection", ce.AnomalyDetection...)
+	if ce.MetricEventsEnabled {
+		addResults("metricEvent", ce.MetricEvents...)
+	}
+	if ce.SLOsEnabled {
+		addResults("slo", ce.SLOs...)
+	}
+	if ce.CalculatedMetricsEnabled {
+		addResults("calculatedMetric", ce.CalculatedMetrics...)
+	}
+	if ce.DashboardEnabled && ce.Dashboard.Message != "" {
+		addResults("dashboard", ce.Dashboard)
+	}
+	addResults("monaco", ce.MonacoConfigs...)
+	return results
 }
 
 // NewDynatraceHelper creates a new DynatraceHelper
@@ -80,39 +196,81 @@ func NewDynatraceHelper(keptnHandler *keptnv2.Keptn, dynatraceCreds *credentials
 }
 
 // ConfigureMonitoring configures Dynatrace for a Keptn project
-func (dt *DynatraceHelper) ConfigureMonitoring(project string, shipyard *keptnv2.Shipyard) (*ConfiguredEntities, error) {
+func (dt *DynatraceHelper) ConfigureMonitoring(project string, shipyard *keptnv2.Shipyard, dynatraceConfig *config.DynatraceConfigFile) (*ConfiguredEntities, error) {
+	if dynatraceConfig != nil {
+		dt.generate = dynatraceConfig.Generate
+		dt.metricEvents = dynatraceConfig.MetricEvents
+		dt.managementZones = dynatraceConfig.ManagementZones
+		dt.managementZoneNames = dynatraceConfig.ManagementZoneNames
+		dt.dashboardTemplate = dynatraceConfig.DashboardTemplate
+		dt.alertingProfile = dynatraceConfig.AlertingProfile
+	}
 
 	dt.configuredEntities = &ConfiguredEntities{
-		TaggingRulesEnabled:         IsTaggingRulesGenerationEnabled(),
+		TaggingRulesEnabled:         dt.isTaggingRulesGenerationEnabled(),
 		TaggingRules:                []ConfigResult{},
-		ProblemNotificationsEnabled: IsProblemNotificationsGenerationEnabled(),
+		ProblemNotificationsEnabled: dt.isProblemNotificationsGenerationEnabled(),
 		ProblemNotifications:        ConfigResult{},
-		ManagementZonesEnabled:      IsManagementZonesGenerationEnabled(),
+		AlertingProfiles:            []ConfigResult{},
+		AnomalyDetection:            []ConfigResult{},
+		ManagementZonesEnabled:      dt.isManagementZonesGenerationEnabled(),
 		ManagementZones:             []ConfigResult{},
-		DashboardEnabled:            IsDashboardsGenerationEnabled(),
+		DashboardEnabled:            dt.isDashboardsGenerationEnabled(),
 		Dashboard:                   ConfigResult{},
-		MetricEventsEnabled:         IsMetricEventsGenerationEnabled(),
+		MetricEventsEnabled:         dt.isMetricEventsGenerationEnabled(),
 		MetricEvents:                []ConfigResult{},
+		SLOsEnabled:                 dt.isSLOsGenerationEnabled(),
+		SLOs:                        []ConfigResult{},
+		CalculatedMetricsEnabled:    dt.isCalculatedMetricsGenerationEnabled(),
+		CalculatedMetrics:           []ConfigResult{},
+		ServiceNamingRulesEnabled:   dt.isServiceNamingRulesGenerationEnabled(),
+		ServiceNamingRules:          []ConfigResult{},
+		MonacoConfigs:               []ConfigResult{},
+		DryRun:                      dt.DryRun,
+		PlannedChanges:              []string{},
+		ConfigurationDrift:          []string{},
+	}
+	if project != "" && shipyard != nil {
+		// the drift has to be detected before the entities are set up again
+		dt.configuredEntities.ConfigurationDrift = dt.DetectConfigurationDrift(project, *shipyard)
 	}
+
 	dt.EnsureDTTaggingRulesAreSetUp()
 
-	dt.EnsureProblemNotificationsAreSetUp()
+	dt.EnsureServiceNamingRulesAreSetUp()
+
+	if dt.usesScopedProblemNotifications(project, shipyard) {
+		dt.skipProblemNotification()
+	} else {
+		dt.EnsureProblemNotificationsAreSetUp()
+	}
 
 	if project != "" && shipyard != nil {
 		dt.CreateManagementZones(project, *shipyard)
 
+		if dynatraceConfig != nil {
+			dt.CreateAlertingProfiles(project, *shipyard, dynatraceConfig.AlertingProfile)
+			dt.ApplyAnomalyDetection(project, dynatraceConfig.AnomalyDetection)
+		}
+
 		configHandler := keptnutils.NewServiceHandler("shipyard-controller:8080")
+		dt.CreateCalculatedTestStepMetrics(project)
 		dt.CreateDashboard(project, *shipyard)
+		dt.ApplyMonacoProjects(project)
 
-		// try to create metric events - if one fails, don't fail the whole setup
+		// try to create metric events and SLOs - if one fails, don't fail the whole setup
 		for _, stage := range shipyard.Spec.Stages {
-			if shouldCreateMetricEvents(stage) {
+			createMetricEvents := shouldCreateMetricEvents(stage)
+			if createMetricEvents || dt.isSLOsGenerationEnabled() {
 				services, err := configHandler.GetAllServices(project, stage.Name)
 				if err != nil {
 					return nil, fmt.Errorf("failed to retrieve services of project %s: %v", project, err.Error())
 				}
 				for _, service := range services {
-					dt.CreateMetricEvents(project, stage.Name, service.ServiceName)
+					if createMetricEvents {
+						dt.CreateMetricEvents(project, stage.Name, service.ServiceName)
+					}
+					dt.CreateSLOs(project, stage.Name, service.ServiceName)
 				}
 			}
 		}
@@ -134,9 +292,10 @@ func shouldCreateMetricEvents(stage keptnv2.Stage) bool {
  * if dtCredsSecretName is passed and it is not dynatrace (=default) then we try to pull the secret based on that name and is it for this API Call
  */
 func (dt *DynatraceHelper) sendDynatraceAPIRequest(apiPath string, method string, body []byte) (string, error) {
+	logger := logging.FromContext(dt.EventContext)
 
 	if common.RunLocal || common.RunLocalTest {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"tenant": dt.DynatraceCreds.Tenant,
 				"body":   string(body),
@@ -144,6 +303,10 @@ func (dt *DynatraceHelper) sendDynatraceAPIRequest(apiPath string, method string
 		return "", nil
 	}
 
+	if dt.DryRun && method != "GET" {
+		return dt.recordPlannedChange(apiPath, method, body), nil
+	}
+
 	req, err := dt.createRequest(apiPath, method, body)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %v", err)
@@ -155,8 +318,12 @@ func (dt *DynatraceHelper) sendDynatraceAPIRequest(apiPath string, method string
 	}
 
 	response, err := dt.doRequest(client, req)
+	if isUnauthorizedError(err) && dt.refreshCredentials() {
+		// the API token has been rotated since the credentials were read
+		return dt.sendDynatraceAPIRequest(apiPath, method, body)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to do request: %v", err)
+		return "", fmt.Errorf("failed to do request: %w", err)
 	}
 
 	return response, nil
@@ -164,11 +331,12 @@ func (dt *DynatraceHelper) sendDynatraceAPIRequest(apiPath string, method string
 
 // creates http request for api call with appropriate headers including authorization
 func (dt *DynatraceHelper) createRequest(apiPath string, method string, body []byte) (*http.Request, error) {
+	creds := dt.getCredentials()
 	var url string
-	if !strings.HasPrefix(dt.DynatraceCreds.Tenant, "http://") && !strings.HasPrefix(dt.DynatraceCreds.Tenant, "https://") {
-		url = "https://" + dt.DynatraceCreds.Tenant + apiPath
+	if !strings.HasPrefix(creds.Tenant, "http://") && !strings.HasPrefix(creds.Tenant, "https://") {
+		url = "https://" + creds.Tenant + apiPath
 	} else {
-		url = dt.DynatraceCreds.Tenant + apiPath
+		url = creds.Tenant + apiPath
 	}
 
 	req, err := http.NewRequest(method, url, bytes.NewReader(body))
@@ -177,7 +345,7 @@ func (dt *DynatraceHelper) createRequest(apiPath string, method string, body []b
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Api-Token "+dt.DynatraceCreds.ApiToken)
+	req.Header.Set("Authorization", "Api-Token "+creds.ApiToken)
 	req.Header.Set("User-Agent", "keptn-contrib/dynatrace-service:"+os.Getenv("version"))
 
 	return req, nil
@@ -185,8 +353,12 @@ func (dt *DynatraceHelper) createRequest(apiPath string, method string, body []b
 
 // creates http client with proxy and TLS configuration
 func (dt *DynatraceHelper) createClient(req *http.Request) (*http.Client, error) {
+	tlsConfig, err := dt.getCredentials().NewTLSConfig(!IsHttpSSLVerificationEnabled(dt.EventContext))
+	if err != nil {
+		return nil, err
+	}
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: !IsHttpSSLVerificationEnabled()},
+		TLSClientConfig: tlsConfig,
 		Proxy:           http.ProxyFromEnvironment,
 	}
 	client := &http.Client{Transport: tr}
@@ -196,9 +368,22 @@ func (dt *DynatraceHelper) createClient(req *http.Request) (*http.Client, error)
 
 // performs the request and reads the response
 func (dt *DynatraceHelper) doRequest(client *http.Client, req *http.Request) (string, error) {
+	ctx, span := tracing.StartClientSpan(dt.EventContext, "HTTP "+req.Method, tracing.Attr("http.method", req.Method), tracing.Attr("http.url", req.URL.String()))
+	tracing.Inject(ctx, req)
+
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send Dynatrace API request: %v", err)
+		metrics.ObserveDynatraceAPIRequest(metrics.ClientConfiguration, req.Method, 0, time.Since(start), err)
+		span.End(err)
+		return "", fmt.Errorf("failed to send Dynatrace API request: %w", err)
+	}
+	metrics.ObserveDynatraceAPIRequest(metrics.ClientConfiguration, req.Method, resp.StatusCode, time.Since(start), nil)
+	span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.End(fmt.Errorf("Dynatrace API returned status %s", resp.Status))
+	} else {
+		span.End(nil)
 	}
 
 	defer resp.Body.Close()
@@ -208,8 +393,56 @@ func (dt *DynatraceHelper) doRequest(client *http.Client, req *http.Request) (st
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return string(responseBody), fmt.Errorf("api request failed with status %s and response %s", resp.Status, string(responseBody))
+		return string(responseBody), &apiRequestError{status: resp.Status, statusCode: resp.StatusCode, response: string(responseBody)}
 	}
 
 	return string(responseBody), nil
 }
+
+// apiRequestError is returned by doRequest if the Dynatrace API responds with an unsuccessful status code
+type apiRequestError struct {
+	status     string
+	statusCode int
+	response   string
+}
+
+func (e *apiRequestError) Error() string {
+	return fmt.Sprintf("api request failed with status %s and response %s", e.status, e.response)
+}
+
+func (dt *DynatraceHelper) getCredentials() *credentials.DTCredentials {
+	dt.credentialsMutex.Lock()
+	defer dt.credentialsMutex.Unlock()
+	return dt.DynatraceCreds
+}
+
+func isUnauthorizedError(err error) bool {
+	var requestErr *apiRequestError
+	return errors.As(err, &requestErr) && requestErr.statusCode == http.StatusUnauthorized
+}
+
+// refreshDynatraceCredentials reads the credentials again from their secret - it is a variable so that it can be replaced in tests
+var refreshDynatraceCredentials = credentials.RefreshDynatraceCredentials
+
+/**
+ * refreshCredentials reads the credentials of the DynatraceHelper again after the API token was rejected, so that rotated tokens
+ * take effect without a restart, e.g: for requests in the retry queue. Returns whether the credentials have changed.
+ */
+func (dt *DynatraceHelper) refreshCredentials() bool {
+	logger := logging.FromContext(dt.EventContext)
+	dt.credentialsMutex.Lock()
+	defer dt.credentialsMutex.Unlock()
+
+	refreshedCreds, err := refreshDynatraceCredentials(dt.DynatraceCreds)
+	if err != nil {
+		logger.WithError(err).Warn("Could not read Dynatrace credentials again after the API token was rejected")
+		return false
+	}
+	if refreshedCreds.Tenant == dt.DynatraceCreds.Tenant && refreshedCreds.ApiToken == dt.DynatraceCreds.ApiToken {
+		return false
+	}
+
+	logger.WithField("secretName", refreshedCreds.SecretName).Info("Dynatrace credentials have been rotated - using the new credentials")
+	dt.DynatraceCreds = refreshedCreds
+	return true
+}
@@ -0,0 +1,345 @@
+package dynatrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+const dqlExecutePath = "/platform/storage/query/v1/query:execute"
+const dqlPollPath = "/platform/storage/query/v1/query:poll"
+
+// maximum number of times a running DQL query is polled - each poll waits up to dqlPollTimeoutMilliseconds on the server side
+const dqlMaxPolls = 12
+const dqlPollTimeoutMilliseconds = 5000
+
+// DQLQueryRequest defines the payload of a query:execute call of the Grail query API
+type DQLQueryRequest struct {
+	Query                 string `json:"query"`
+	DefaultTimeframeStart string `json:"defaultTimeframeStart"`
+	DefaultTimeframeEnd   string `json:"defaultTimeframeEnd"`
+}
+
+// DQLQueryResponse defines the response of a query:execute or query:poll call of the Grail query API
+type DQLQueryResponse struct {
+	State        string          `json:"state"`
+	RequestToken string          `json:"requestToken"`
+	Result       *DQLQueryResult `json:"result"`
+}
+
+// DQLTableVariant is used in DQL SLI queries to select one record of a table result by its dimension, e.g: DQL;TABLE;dimension;query
+const DQLTableVariant = "TABLE"
+
+// DQLQueryResult contains the records returned by a DQL query
+type DQLQueryResult struct {
+	Records []map[string]interface{} `json:"records"`
+
+	// names of the fields of each record in the order they are returned, e.g: the fields of summarize ... by:{} before the aggregations
+	fieldNames [][]string
+}
+
+// UnmarshalJSON decodes the records and keeps the order of their fields, as the leading fields are the dimensions of a table result
+func (r *DQLQueryResult) UnmarshalJSON(data []byte) error {
+	var result struct {
+		Records []json.RawMessage `json:"records"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+
+	r.Records = make([]map[string]interface{}, 0, len(result.Records))
+	r.fieldNames = make([][]string, 0, len(result.Records))
+	for _, rawRecord := range result.Records {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(rawRecord, &record); err != nil {
+			return err
+		}
+		fieldNames, err := getJSONObjectKeys(rawRecord)
+		if err != nil {
+			return err
+		}
+		r.Records = append(r.Records, record)
+		r.fieldNames = append(r.fieldNames, fieldNames)
+	}
+	return nil
+}
+
+// getJSONObjectKeys returns the keys of a JSON object in the order they appear
+func getJSONObjectKeys(data []byte) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected key %v in DQL record", token)
+		}
+		keys = append(keys, key)
+
+		// skip the value of the field
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// getFieldNames returns the field names of a record in the order they were returned - sorted by name if the result wasn't decoded from JSON
+func (r *DQLQueryResult) getFieldNames(recordIndex int) []string {
+	if recordIndex < len(r.fieldNames) {
+		return r.fieldNames[recordIndex]
+	}
+
+	fieldNames := []string{}
+	for fieldName := range r.Records[recordIndex] {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+	return fieldNames
+}
+
+// DQLIndicatorQuery is a parsed DQL SLI query - DQL;<query> for single value results or DQL;TABLE;<dimension>;[valueColumn=<field>;]<query> for table results
+type DQLIndicatorQuery struct {
+	Query       string
+	IsTable     bool
+	Dimension   string
+	ValueColumn string
+}
+
+/**
+ * Parses a DQL SLI query, e.g: DQL;fetch logs | summarize count() or DQL;TABLE;ERROR;fetch logs | summarize count(), by:{loglevel}
+ * The query is the last part, so that it may contain semicolons
+ */
+func ParseDQLIndicatorQuery(metricsQuery string) (*DQLIndicatorQuery, error) {
+	query := strings.TrimPrefix(metricsQuery, "DQL;")
+	if !strings.HasPrefix(query, DQLTableVariant+";") {
+		if query == "" {
+			return nil, fmt.Errorf("DQL Indicator query has wrong format. Should be DQL;<query> but is: %s", metricsQuery)
+		}
+		return &DQLIndicatorQuery{Query: query}, nil
+	}
+
+	querySplits := strings.SplitN(strings.TrimPrefix(query, DQLTableVariant+";"), ";", 2)
+	if len(querySplits) != 2 {
+		return nil, fmt.Errorf("DQL Indicator query has wrong format. Should be DQL;TABLE;<dimension>;[valueColumn=<field>;]<query> but is: %s", metricsQuery)
+	}
+	dqlQuery := &DQLIndicatorQuery{IsTable: true, Dimension: querySplits[0], Query: querySplits[1]}
+
+	if strings.HasPrefix(dqlQuery.Query, USQLValueColumnPrefix) {
+		valueColumnSplits := strings.SplitN(dqlQuery.Query, ";", 2)
+		if len(valueColumnSplits) != 2 {
+			return nil, fmt.Errorf("DQL Indicator query has wrong format. Should be DQL;TABLE;<dimension>;[valueColumn=<field>;]<query> but is: %s", metricsQuery)
+		}
+		dqlQuery.ValueColumn = strings.TrimPrefix(valueColumnSplits[0], USQLValueColumnPrefix)
+		dqlQuery.Query = valueColumnSplits[1]
+	}
+
+	if dqlQuery.Dimension == "" || dqlQuery.Query == "" {
+		return nil, fmt.Errorf("DQL Indicator query has wrong format. Should be DQL;TABLE;<dimension>;[valueColumn=<field>;]<query> but is: %s", metricsQuery)
+	}
+	return dqlQuery, nil
+}
+
+/**
+ * ExecuteDQLQuery executes the passed DQL query for the given timeframe against the Grail query API and waits for its result
+ */
+func (ph *Handler) ExecuteDQLQuery(dqlQuery string, startUnix time.Time, endUnix time.Time) (*DQLQueryResult, error) {
+	logger := logging.FromContext(ph.EventContext)
+	if ph.PlatformURL == "" || ph.PlatformToken == "" {
+		return nil, errors.New("DQL queries require the keys DT_PLATFORM_URL and DT_PLATFORM_TOKEN in the secret of the Dynatrace credentials")
+	}
+
+	// the Grail query API doesn't accept API tokens, so the authorization header of the handler is replaced by the platform token
+	headers := map[string]string{
+		"Authorization": "Bearer " + ph.PlatformToken,
+		"Content-Type":  "application/json",
+	}
+
+	requestBody, err := json.Marshal(DQLQueryRequest{
+		Query:                 dqlQuery,
+		DefaultTimeframeStart: startUnix.UTC().Format(time.RFC3339),
+		DefaultTimeframeEnd:   endUnix.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	targetURL := ph.PlatformURL + dqlExecutePath
+	resp, body, err := ph.executeDynatraceRESTWithBody("POST", targetURL, requestBody, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	queryResponse, err := parseDQLQueryResponse(resp, body)
+	if err != nil {
+		return nil, fmt.Errorf("DQL API request %s was not successful: %w", targetURL, err)
+	}
+
+	// long running queries have to be polled until they are finished
+	for poll := 0; queryResponse.State != "SUCCEEDED"; poll++ {
+		if queryResponse.State != "RUNNING" && queryResponse.State != "NOT_STARTED" {
+			return nil, fmt.Errorf("DQL query finished with state %s", queryResponse.State)
+		}
+		if poll >= dqlMaxPolls {
+			return nil, errors.New("DQL query did not finish in time")
+		}
+
+		pollURL := fmt.Sprintf("%s%s?request-token=%s&request-timeout-milliseconds=%d", ph.PlatformURL, dqlPollPath, url.QueryEscape(queryResponse.RequestToken), dqlPollTimeoutMilliseconds)
+		logger.WithField("pollURL", pollURL).Debug("Polling DQL query")
+
+		resp, body, err = ph.executeDynatraceRESTWithBody("GET", pollURL, nil, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		queryResponse, err = parseDQLQueryResponse(resp, body)
+		if err != nil {
+			return nil, fmt.Errorf("DQL API request %s was not successful: %w", pollURL, err)
+		}
+	}
+
+	if queryResponse.Result == nil {
+		return nil, errors.New("DQL query returned no result")
+	}
+
+	return queryResponse.Result, nil
+}
+
+func parseDQLQueryResponse(resp *http.Response, body []byte) (*DQLQueryResponse, error) {
+	// the query API returns 202 if the query is still running
+	if resp == nil || resp.StatusCode != http.StatusAccepted {
+		if err := checkApiResponse(resp, body); err != nil {
+			return nil, err
+		}
+	}
+
+	var queryResponse DQLQueryResponse
+	err := json.Unmarshal(body, &queryResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queryResponse, nil
+}
+
+/**
+ * Returns the value of a DQL result that has to consist of exactly one record with exactly one numeric field, e.g: fetch logs | summarize count()
+ */
+func getSingleValueFromDQLResult(result *DQLQueryResult) (float64, error) {
+	if len(result.Records) != 1 {
+		return 0, fmt.Errorf("expected exactly 1 record but got %d", len(result.Records))
+	}
+
+	values := []float64{}
+	for _, fieldValue := range result.Records[0] {
+		switch v := fieldValue.(type) {
+		case float64:
+			values = append(values, v)
+		case string:
+			// large numbers are returned as strings
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				values = append(values, f)
+			}
+		}
+	}
+
+	if len(values) != 1 {
+		return 0, fmt.Errorf("expected exactly 1 numeric field but got %d", len(values))
+	}
+
+	return values[0], nil
+}
+
+/**
+ * Returns the value of the record of a DQL table result with the passed dimension, e.g: ERROR for fetch logs | summarize count(), by:{loglevel}
+ * As for USQL tables, the leading text fields of a record are the dimensions and the last field is the value unless valueColumn names another field.
+ * Multiple dimensions are concatenated into a composite key, e.g: carts_ERROR
+ */
+func getTableValueFromDQLResult(result *DQLQueryResult, dimension string, valueColumn string) (float64, error) {
+	// records without dimension or value are skipped like USQL result rows, but the reason is kept in case no record matches
+	var recordErr error
+	for i, record := range result.Records {
+		recordDimension, value, err := getDQLDimensionAndValue(record, result.getFieldNames(i), valueColumn)
+		if err != nil {
+			recordErr = err
+			continue
+		}
+		if recordDimension == dimension {
+			return value, nil
+		}
+	}
+
+	if recordErr != nil {
+		return 0, fmt.Errorf("no record with dimension %s in %d records: %v", dimension, len(result.Records), recordErr)
+	}
+	return 0, fmt.Errorf("no record with dimension %s in %d records", dimension, len(result.Records))
+}
+
+/**
+ * Returns the dimension and the value of a record of a DQL table result, the fields have to be in the order they were returned
+ */
+func getDQLDimensionAndValue(record map[string]interface{}, fieldNames []string, valueColumn string) (string, float64, error) {
+	if len(fieldNames) == 0 {
+		return "", 0, errors.New("empty DQL record")
+	}
+
+	valueIndex := len(fieldNames) - 1
+	if valueColumn != "" {
+		valueIndex = -1
+		for i, fieldName := range fieldNames {
+			if strings.EqualFold(fieldName, valueColumn) {
+				valueIndex = i
+				break
+			}
+		}
+		if valueIndex < 0 {
+			return "", 0, fmt.Errorf("DQL record doesn't contain value column %s - available fields are: %s", valueColumn, strings.Join(fieldNames, ", "))
+		}
+	}
+
+	var value float64
+	switch v := record[fieldNames[valueIndex]].(type) {
+	case float64:
+		value = v
+	case string:
+		// large numbers are returned as strings
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("DQL value %s of field %s is not a number", v, fieldNames[valueIndex])
+		}
+		value = f
+	default:
+		return "", 0, fmt.Errorf("DQL value %v of field %s is not a number", v, fieldNames[valueIndex])
+	}
+
+	dimensions := []string{}
+	for _, fieldName := range fieldNames[:valueIndex] {
+		dimension, ok := record[fieldName].(string)
+		if !ok {
+			break
+		}
+		dimensions = append(dimensions, dimension)
+	}
+	if len(dimensions) == 0 {
+		return "", 0, fmt.Errorf("DQL record %v has no dimension", record)
+	}
+
+	return strings.Join(dimensions, USQLDimensionSeparator), value, nil
+}
@@ -1,10 +1,13 @@
 package dynatrace
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -18,6 +21,9 @@ import (
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/metrics"
+	"github.com/keptn-contrib/dynatrace-service/pkg/tracing"
 
 	keptncommon "github.com/keptn/go-utils/pkg/lib"
 )
@@ -141,8 +147,8 @@ type DynatraceDashboard struct {
 		Configured bool   `json:"configured"`
 		Query      string `json:"query"`
 		Type       string `json:"type"`
-		CustomName string `json:"customName`
-		Markdown   string `json:"markdown`
+		CustomName string `json:"customName"`
+		Markdown   string `json:"markdown"`
 		Bounds     struct {
 			Top    int `json:"top"`
 			Left   int `json:"left"`
@@ -215,6 +221,15 @@ type DynatraceDashboard struct {
 	} `json:"tiles"`
 }
 
+// GetConfigurationVersion returns the configuration versions of the dashboard as a dot separated string, e.g. 3.2
+func (dashboard *DynatraceDashboard) GetConfigurationVersion() string {
+	versions := make([]string, len(dashboard.Metadata.ConfigurationVersions))
+	for i, version := range dashboard.Metadata.ConfigurationVersions {
+		versions[i] = strconv.Itoa(version)
+	}
+	return strings.Join(versions, ".")
+}
+
 // MetricDefinition defines the output of /metrics/<metricID>
 type MetricDefinition struct {
 	MetricID           string   `json:"metricId"`
@@ -255,6 +270,48 @@ type DynatraceSLOResult struct {
 	EvaluationType      string  `json:"evaluationType"`
 	TimeWindow          string  `json:"timeWindow"`
 	Filter              string  `json:"filter"`
+
+	ErrorBudgetBurnRate *DynatraceSLOErrorBudgetBurnRate `json:"errorBudgetBurnRate"`
+}
+
+// Burn rate of the error budget as returned by newer versions of /api/v2/slo
+type DynatraceSLOErrorBudgetBurnRate struct {
+	BurnRateVisualizationEnabled      bool    `json:"burnRateVisualizationEnabled"`
+	BurnRateValue                     float64 `json:"burnRateValue"`
+	BurnRateType                      string  `json:"burnRateType"`
+	EstimatedTimeToConsumeErrorBudget float64 `json:"estimatedTimeToConsumeErrorBudget"`
+}
+
+const sloValueEvaluatedPercentage = "evaluatedPercentage"
+const sloValueErrorBudget = "errorBudget"
+const sloValueBurnRate = "burnRate"
+
+/**
+ * Returns the requested value of an SLO: evaluatedPercentage (default), errorBudget or burnRate
+ */
+func (sloResult *DynatraceSLOResult) getValue(valueName string) (float64, error) {
+	switch valueName {
+	case "", sloValueEvaluatedPercentage:
+		return sloResult.EvaluatedPercentage, nil
+	case sloValueErrorBudget:
+		return sloResult.ErrorBudget, nil
+	case sloValueBurnRate:
+		if sloResult.ErrorBudgetBurnRate != nil {
+			return sloResult.ErrorBudgetBurnRate.BurnRateValue, nil
+		}
+
+		// older Dynatrace versions don't return the burn rate - so we calculate it as ratio of the actual to the allowed error rate
+		target := sloResult.Target
+		if target == 0 {
+			target = sloResult.TargetSuccessOLD
+		}
+		if target >= 100 {
+			return 0, fmt.Errorf("cannot calculate burn rate of SLO %s with target %f", sloResult.ID, target)
+		}
+		return (100 - sloResult.EvaluatedPercentage) / (100 - target), nil
+	default:
+		return 0, fmt.Errorf("unsupported SLO value %s - use %s, %s or %s", valueName, sloValueEvaluatedPercentage, sloValueErrorBudget, sloValueBurnRate)
+	}
 }
 
 type DtEnvAPIv2Error struct {
@@ -356,7 +413,7 @@ type DynatraceSecurityProblem struct {
 	RiskAssessment       struct {
 		RiskCategory string `json:"riskCategory"`
 		RiskScore    struct {
-			Value int `json:"value"`
+			Value float64 `json:"value"`
 		} `json:"riskScore"`
 		Exposed                bool `json:"exposed"`
 		SensitiveDataAffected  bool `json:"sensitiveDataAffected"`
@@ -408,6 +465,18 @@ type DynatraceSecurityProblemQueryResult struct {
 	SecurityProblems []DynatraceSecurityProblem `json:"securityProblems"`
 }
 
+// Result of /api/v2/entities
+type DynatraceEntityQueryResult struct {
+	TotalCount  int    `json:"totalCount"`
+	PageSize    int    `json:"pageSize"`
+	NextPageKey string `json:"nextPageKey"`
+}
+
+// Result of /api/v2/logs/aggregate - maps the values of the groupBy field to the number of matching log records
+type DynatraceLogAggregationResult struct {
+	AggregationResult map[string]map[string]float64 `json:"aggregationResult"`
+}
+
 // Handler interacts with a dynatrace API endpoint
 type Handler struct {
 	ApiURL        string
@@ -418,6 +487,96 @@ type Handler struct {
 	Headers       map[string]string
 	CustomQueries map[string]string
 	CustomFilters []*keptnv2.SLIFilter
+
+	// ForceDashboardParsing ignores KQG.QueryBehavior=ParseOnChange and always parses the dashboard
+	ForceDashboardParsing bool
+
+	// UnitScalingRules overwrite the default scaling of metric values by unit
+	UnitScalingRules []common_sli.UnitScalingRule
+
+	// DetectMetricUnits queries the metric definition to find out the unit of metric queries without MV2 prefix
+	DetectMetricUnits bool
+
+	// ManagementZone is the ID or name of the management zone all file based SLI queries are filtered by
+	ManagementZone string
+
+	// PlatformURL and PlatformToken are used for DQL queries, which Grail only accepts on the platform URL of the tenant with a platform token
+	PlatformURL   string
+	PlatformToken string
+
+	// WaitForDataTimeout defines how long metric queries are retried if the Metrics API didn't return any data points yet, 0 disables retries
+	WaitForDataTimeout time.Duration
+
+	// WaitForDataInterval is the time between two retries of a metric query
+	WaitForDataInterval time.Duration
+
+	// EventContext is the context of the processed event, it carries the logger and the parent span of the Dynatrace API requests
+	EventContext context.Context
+
+	detectedMetricUnits map[string]string
+
+	// query URLs executed against the Dynatrace API since the last call of ResetExecutedQueries
+	executedQueries []string
+
+	// query URLs executed for the SLIs of the processed dashboards by their name
+	dashboardExecutedQueries map[string][]string
+
+	// how the tiles of all processed dashboards were processed
+	tileReport []*TileProcessingResult
+}
+
+// ResetExecutedQueries clears the list of executed query URLs, e.g: before querying the next indicator
+func (ph *Handler) ResetExecutedQueries() {
+	ph.executedQueries = nil
+}
+
+// GetExecutedQueries returns the query URLs executed against the Dynatrace API since the last call of ResetExecutedQueries
+func (ph *Handler) GetExecutedQueries() []string {
+	return ph.executedQueries
+}
+
+// GetSLIQuery returns the query of the sli.yaml or the default query of the indicator, or an empty string if there is none
+func (ph *Handler) GetSLIQuery(metric string) string {
+	query, err := ph.getTimeseriesConfig(metric)
+	if err != nil {
+		return ""
+	}
+	return query
+}
+
+func (ph *Handler) recordExecutedQuery(queryURL string) {
+	ph.executedQueries = append(ph.executedQueries, queryURL)
+}
+
+// UseTLSConfig replaces the TLS configuration of the HTTP client, e.g. to present a client certificate to an ActiveGate
+func (ph *Handler) UseTLSConfig(tlsConfig *tls.Config) {
+	if tr, ok := ph.HTTPClient.Transport.(*http.Transport); ok {
+		tr.TLSClientConfig = tlsConfig
+	}
+}
+
+// StartSpan starts a span that is the parent of all Dynatrace API requests until it is ended by the returned function
+func (ph *Handler) StartSpan(name string, attributes ...tracing.Attribute) func(err error) {
+	parentContext := ph.EventContext
+	ctx, span := tracing.StartSpan(parentContext, name, attributes...)
+	ph.EventContext = ctx
+	return func(err error) {
+		span.End(err)
+		ph.EventContext = parentContext
+	}
+}
+
+/**
+ * Adds the passed executed Dynatrace query URLs to an SLI result message
+ */
+func AppendQueriesToMessage(message string, queries []string) string {
+	if len(queries) == 0 {
+		return message
+	}
+	if message == "" {
+		return "Dynatrace query: " + strings.Join(queries, ", ")
+	}
+	return message + " - Dynatrace query: " + strings.Join(queries, ", ")
 }
 
 // NewDynatraceHandler returns a new dynatrace handler that interacts with the Dynatrace REST API
@@ -427,11 +586,13 @@ func NewDynatraceHandler(apiURL string, keptnEvent *common_sli.BaseKeptnEvent, h
 		Proxy:           http.ProxyFromEnvironment,
 	}
 	ph := &Handler{
-		ApiURL:        strings.TrimSuffix(apiURL, "/"),
-		KeptnEvent:    keptnEvent,
-		HTTPClient:    &http.Client{Transport: tr},
-		Headers:       headers,
-		CustomFilters: customFilters,
+		ApiURL:              strings.TrimSuffix(apiURL, "/"),
+		KeptnEvent:          keptnEvent,
+		HTTPClient:          &http.Client{Transport: tr},
+		Headers:             headers,
+		CustomFilters:       customFilters,
+		DetectMetricUnits:   true,
+		WaitForDataInterval: defaultWaitForDataInterval,
 	}
 
 	return ph
@@ -444,9 +605,25 @@ func NewDynatraceHandler(apiURL string, keptnEvent *common_sli.BaseKeptnEvent, h
  * Returns the Response Object, the body byte array, error
  */
 func (ph *Handler) executeDynatraceREST(httpMethod string, requestUrl string, addHeaders map[string]string) (*http.Response, []byte, error) {
+	return ph.executeDynatraceRESTWithBody(httpMethod, requestUrl, nil, addHeaders)
+}
+
+/**
+ * executeDynatraceRESTWithBody
+ * Same as executeDynatraceREST but also sends the passed request body
+ */
+func (ph *Handler) executeDynatraceRESTWithBody(httpMethod string, requestUrl string, requestBody []byte, addHeaders map[string]string) (*http.Response, []byte, error) {
+
+	var bodyReader io.Reader
+	if requestBody != nil {
+		bodyReader = bytes.NewReader(requestBody)
+	}
 
 	// new request to our URL
-	req, err := http.NewRequest(httpMethod, requestUrl, nil)
+	req, err := http.NewRequest(httpMethod, requestUrl, bodyReader)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// add our default headers, e.g: authentication
 	for headerName, headerValue := range ph.Headers {
@@ -460,8 +637,23 @@ func (ph *Handler) executeDynatraceREST(httpMethod string, requestUrl string, ad
 		}
 	}
 
+	ctx, span := tracing.StartClientSpan(ph.EventContext, "HTTP "+httpMethod, tracing.Attr("http.method", httpMethod), tracing.Attr("http.url", requestUrl))
+	tracing.Inject(ctx, req)
+
 	// perform the request
+	start := time.Now()
 	resp, err := ph.HTTPClient.Do(req)
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+		span.SetAttribute("http.status_code", strconv.Itoa(statusCode))
+	}
+	metrics.ObserveDynatraceAPIRequest(metrics.ClientSLI, httpMethod, statusCode, time.Since(start), err)
+	if err == nil && statusCode >= 400 {
+		span.End(fmt.Errorf("Dynatrace API returned status code %d", statusCode))
+	} else {
+		span.End(err)
+	}
 	if err != nil {
 		return resp, nil, err
 	}
@@ -569,19 +761,20 @@ func (ph *Handler) findDynatraceDashboard(keptnEvent *common_sli.BaseKeptnEvent)
  * Returns: parsed Dynatrace Dashboard and actual dashboard ID in case we queried a dashboard
  */
 func (ph *Handler) loadDynatraceDashboard(keptnEvent *common_sli.BaseKeptnEvent, dashboard string) (*DynatraceDashboard, string, error) {
+	logger := logging.FromContext(ph.EventContext)
 
 	// Option 1: Query dashboards
 	if dashboard == common_sli.DynatraceConfigDashboardQUERY {
 		dashboard, _ = ph.findDynatraceDashboard(keptnEvent)
 		if dashboard == "" {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"project": keptnEvent.Project,
 					"stage":   keptnEvent.Stage,
 					"service": keptnEvent.Service,
 				}).Debug("Dashboard option query but couldnt find KQG dashboard")
 		} else {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"project":   keptnEvent.Project,
 					"stage":     keptnEvent.Stage,
@@ -603,7 +796,7 @@ func (ph *Handler) loadDynatraceDashboard(keptnEvent *common_sli.BaseKeptnEvent,
 	}
 
 	// We have a valid Dashboard UUID - now lets query it!
-	log.WithField("dashboard", dashboard).Debug("Query dashboard")
+	logger.WithField("dashboard", dashboard).Debug("Query dashboard")
 	dashboardAPIUrl := ph.ApiURL + fmt.Sprintf("/api/config/v1/dashboards/%s", dashboard)
 	resp, body, err := ph.executeDynatraceREST("GET", dashboardAPIUrl, nil)
 
@@ -636,6 +829,7 @@ func (ph *Handler) ExecuteGetDynatraceSLO(sloID string, startUnix time.Time, end
 		common_sli.TimestampToString(startUnix),
 		common_sli.TimestampToString(endUnix))
 
+	ph.recordExecutedQuery(targetURL)
 	resp, body, err := ph.executeDynatraceREST("GET", targetURL, nil)
 
 	if err != nil {
@@ -672,6 +866,7 @@ func (ph *Handler) ExecuteGetDynatraceProblems(problemQuery string, startUnix ti
 		common_sli.TimestampToString(endUnix),
 		problemQuery)
 
+	ph.recordExecutedQuery(targetURL)
 	resp, body, err := ph.executeDynatraceREST("GET", targetURL, nil)
 
 	if err != nil {
@@ -702,6 +897,39 @@ func (ph *Handler) ExecuteGetDynatraceSecurityProblems(problemQuery string, star
 		common_sli.TimestampToString(endUnix),
 		problemQuery)
 
+	ph.recordExecutedQuery(targetURL)
+	return ph.executeGetDynatraceSecurityProblemsPage(targetURL)
+}
+
+/**
+ * ExecuteGetDynatraceSecurityProblemsRiskScore
+ * Pages through all security problems for that timeframe and returns the sum of their risk scores
+ */
+func (ph *Handler) ExecuteGetDynatraceSecurityProblemsRiskScore(problemQuery string, startUnix time.Time, endUnix time.Time) (float64, error) {
+	result, err := ph.ExecuteGetDynatraceSecurityProblems(problemQuery, startUnix, endUnix)
+	if err != nil {
+		return 0, err
+	}
+
+	riskScore := 0.0
+	for {
+		for _, securityProblem := range result.SecurityProblems {
+			riskScore += securityProblem.RiskAssessment.RiskScore.Value
+		}
+
+		if result.NextPageKey == "" {
+			return riskScore, nil
+		}
+
+		// the nextPageKey already contains all other query parameters
+		result, err = ph.executeGetDynatraceSecurityProblemsPage(ph.ApiURL + "/api/v2/securityProblems?nextPageKey=" + url.QueryEscape(result.NextPageKey))
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (ph *Handler) executeGetDynatraceSecurityProblemsPage(targetURL string) (*DynatraceSecurityProblemQueryResult, error) {
 	resp, body, err := ph.executeDynatraceREST("GET", targetURL, nil)
 
 	if err != nil {
@@ -722,6 +950,219 @@ func (ph *Handler) ExecuteGetDynatraceSecurityProblems(problemQuery string, star
 	return &result, nil
 }
 
+const securityProblemValueCount = "count"
+const securityProblemValueRiskScore = "riskScore"
+
+/**
+ * Translates the risk filters riskLevel=<level> and minRiskScore=<score> of a SECPV2 query into securityProblemSelector conditions
+ * and extracts the requested value (value=count or value=riskScore) - all other query parameters are passed as they are
+ */
+func buildSecurityProblemQuery(query string) (string, string, error) {
+	queryParts := []string{}
+	selectorConditions := []string{}
+	valueType := securityProblemValueCount
+
+	for _, queryPart := range strings.Split(query, "&") {
+		keyValue := strings.SplitN(queryPart, "=", 2)
+		if len(keyValue) != 2 {
+			queryParts = append(queryParts, queryPart)
+			continue
+		}
+
+		switch keyValue[0] {
+		case "riskLevel":
+			selectorConditions = append(selectorConditions, fmt.Sprintf("riskLevel(\"%s\")", strings.ToUpper(keyValue[1])))
+		case "minRiskScore":
+			if _, err := strconv.ParseFloat(keyValue[1], 64); err != nil {
+				return "", "", fmt.Errorf("minRiskScore %s is not a number", keyValue[1])
+			}
+			selectorConditions = append(selectorConditions, fmt.Sprintf("minRiskScore(\"%s\")", keyValue[1]))
+		case "value":
+			if keyValue[1] != securityProblemValueCount && keyValue[1] != securityProblemValueRiskScore {
+				return "", "", fmt.Errorf("unsupported value %s - use %s or %s", keyValue[1], securityProblemValueCount, securityProblemValueRiskScore)
+			}
+			valueType = keyValue[1]
+		default:
+			queryParts = append(queryParts, queryPart)
+		}
+	}
+
+	return strings.Join(addSelectorConditions(queryParts, "securityProblemSelector", selectorConditions), "&"), valueType, nil
+}
+
+/**
+ * Adds the conditions to the selector query parameter with the given name - if there is no such parameter yet it gets added
+ */
+func addSelectorConditions(queryParts []string, selectorName string, selectorConditions []string) []string {
+	if len(selectorConditions) == 0 {
+		return queryParts
+	}
+
+	for i, queryPart := range queryParts {
+		if strings.HasPrefix(queryPart, selectorName+"=") {
+			queryParts[i] += "," + strings.Join(selectorConditions, ",")
+			return queryParts
+		}
+	}
+
+	return append(queryParts, selectorName+"="+strings.Join(selectorConditions, ","))
+}
+
+/**
+ * Adds a condition for the configured management zone to the selector query parameter with the given name
+ * entitySelector gets mzId(<id>) or mzName("<name>"), problem selectors get managementZoneIds(<id>) or managementZones("<name>")
+ * The query is returned unchanged if no management zone is configured or if the selector already filters by management zone
+ */
+func (ph *Handler) addManagementZoneFilter(query string, selectorName string) string {
+	if ph.ManagementZone == "" {
+		return query
+	}
+
+	queryParts := strings.Split(query, "&")
+	for _, queryPart := range queryParts {
+		if strings.HasPrefix(queryPart, selectorName+"=") && isFilteredByManagementZone(queryPart) {
+			return query
+		}
+	}
+
+	_, err := strconv.ParseInt(ph.ManagementZone, 10, 64)
+	isID := err == nil
+
+	var condition string
+	switch {
+	case selectorName == "entitySelector" && isID:
+		condition = fmt.Sprintf("mzId(%s)", ph.ManagementZone)
+	case selectorName == "entitySelector":
+		condition = fmt.Sprintf("mzName(\"%s\")", url.QueryEscape(ph.ManagementZone))
+	case isID:
+		condition = fmt.Sprintf("managementZoneIds(%s)", ph.ManagementZone)
+	default:
+		condition = fmt.Sprintf("managementZones(\"%s\")", url.QueryEscape(ph.ManagementZone))
+	}
+
+	return strings.Join(addSelectorConditions(queryParts, selectorName, []string{condition}), "&")
+}
+
+func isFilteredByManagementZone(selector string) bool {
+	for _, condition := range []string{"mzId(", "mzName(", "managementZoneIds(", "managementZones("} {
+		if strings.Contains(selector, condition) {
+			return true
+		}
+	}
+	return false
+}
+
+const problemBreakdownSeverityLevel = "severityLevel"
+const problemBreakdownImpactLevel = "impactLevel"
+
+// problem severity and impact levels and the suffix of the indicator name used when breaking down problems by that level
+var problemBreakdownLevels = map[string][][2]string{
+	problemBreakdownSeverityLevel: {
+		{"AVAILABILITY", "availability"},
+		{"ERROR", "error"},
+		{"PERFORMANCE", "performance"},
+		{"RESOURCE_CONTENTION", "resource"},
+		{"CUSTOM_ALERT", "custom"},
+	},
+	problemBreakdownImpactLevel: {
+		{"APPLICATION", "application"},
+		{"SERVICE", "service"},
+		{"INFRASTRUCTURE", "infrastructure"},
+		{"ENVIRONMENT", "environment"},
+	},
+}
+
+/**
+ * Translates the filters severityLevel=<level> and impactLevel=<level> of a PV2 query into problemSelector conditions - all other query parameters are passed as they are
+ */
+func buildProblemQuery(query string) string {
+	queryParts := []string{}
+	selectorConditions := []string{}
+
+	for _, queryPart := range strings.Split(query, "&") {
+		keyValue := strings.SplitN(queryPart, "=", 2)
+		if len(keyValue) == 2 && (keyValue[0] == problemBreakdownSeverityLevel || keyValue[0] == problemBreakdownImpactLevel) {
+			selectorConditions = append(selectorConditions, fmt.Sprintf("%s(\"%s\")", keyValue[0], strings.ToUpper(keyValue[1])))
+			continue
+		}
+		queryParts = append(queryParts, queryPart)
+	}
+
+	return strings.Join(addSelectorConditions(queryParts, "problemSelector", selectorConditions), "&")
+}
+
+/**
+ * ExecuteGetDynatraceEntities
+ * Calls the /entities API call to retrieve the number of entities matching the entity selector in that timeframe
+ * If successful returns the DynatraceEntityQueryResult object
+ */
+func (ph *Handler) ExecuteGetDynatraceEntities(entityQuery string, startUnix time.Time, endUnix time.Time) (*DynatraceEntityQueryResult, error) {
+	// we are only interested in totalCount, so there is no need to page through the entities
+	targetURL := ph.ApiURL + fmt.Sprintf("/api/v2/entities?from=%s&to=%s&pageSize=1&%s",
+		common_sli.TimestampToString(startUnix),
+		common_sli.TimestampToString(endUnix),
+		entityQuery)
+
+	ph.recordExecutedQuery(targetURL)
+	resp, body, err := ph.executeDynatraceREST("GET", targetURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkApiResponse(resp, body); err != nil {
+		return nil, fmt.Errorf("Entities API request %s was not successful: %w", targetURL, err)
+	}
+
+	// parse response json
+	var result DynatraceEntityQueryResult
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+/**
+ * ExecuteGetDynatraceLogCount
+ * Calls the /logs/aggregate API call to retrieve the number of log records matching the query in that timeframe
+ */
+func (ph *Handler) ExecuteGetDynatraceLogCount(logQuery string, startUnix time.Time, endUnix time.Time) (float64, error) {
+	// all log records have a status, so grouping by it lets us sum up the total count
+	targetURL := ph.ApiURL + fmt.Sprintf("/api/v2/logs/aggregate?from=%s&to=%s&timeBuckets=1&groupBy=status&query=%s",
+		common_sli.TimestampToString(startUnix),
+		common_sli.TimestampToString(endUnix),
+		url.QueryEscape(logQuery))
+
+	ph.recordExecutedQuery(targetURL)
+	resp, body, err := ph.executeDynatraceREST("GET", targetURL, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkApiResponse(resp, body); err != nil {
+		return 0, fmt.Errorf("Logs API request %s was not successful: %w", targetURL, err)
+	}
+
+	// parse response json
+	var result DynatraceLogAggregationResult
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0.0
+	for _, groupCounts := range result.AggregationResult {
+		for _, groupCount := range groupCounts {
+			count += groupCount
+		}
+	}
+
+	return count, nil
+}
+
 /**
  * ExecuteMetricAPIDescribe
  * Calls the /metrics/<metricID> API call to retrieve Metric Definition Details
@@ -748,8 +1189,67 @@ func (ph *Handler) ExecuteMetricAPIDescribe(metricID string) (*MetricDefinition,
 	return &result, nil
 }
 
+// defaultWaitForDataInterval is the default time between two retries of a metric query without data points
+const defaultWaitForDataInterval = 30 * time.Second
+
 // ExecuteMetricsAPIQuery executes the passed Metrics API Call, validates that the call returns data and returns the data set
+// If WaitForDataTimeout is set the query is retried until data points are available or the timeout is reached
 func (ph *Handler) ExecuteMetricsAPIQuery(metricsQuery string) (*DynatraceMetricsQueryResult, error) {
+	logger := logging.FromContext(ph.EventContext)
+	ph.recordExecutedQuery(metricsQuery)
+
+	deadline := time.Now().Add(ph.WaitForDataTimeout)
+	for {
+		result, err := ph.executeMetricsAPIQuery(metricsQuery)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := time.Until(deadline)
+		if hasDataPoints(result) || remaining <= 0 {
+			if len(result.Result) == 0 {
+				return nil, errors.New("Dynatrace Metrics API returned no DataPoints")
+			}
+			return result, nil
+		}
+
+		// wait for the next interval but not longer than the timeout
+		wait := ph.WaitForDataInterval
+		if wait <= 0 || wait > remaining {
+			wait = remaining
+		}
+
+		logger.WithFields(log.Fields{
+			"query": metricsQuery,
+			"wait":  wait.String(),
+		}).Info("Dynatrace Metrics API returned no data points yet, retrying")
+
+		// the wait ends early if the processing of the event is cancelled
+		ctx := ph.EventContext
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for data points of Dynatrace Metrics API: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// hasDataPoints returns true if at least one metric of the result contains a value
+func hasDataPoints(result *DynatraceMetricsQueryResult) bool {
+	for _, metricResult := range result.Result {
+		for _, data := range metricResult.Data {
+			if len(data.Values) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (ph *Handler) executeMetricsAPIQuery(metricsQuery string) (*DynatraceMetricsQueryResult, error) {
 	// now we execute the query against the Dynatrace API
 	resp, body, err := ph.executeDynatraceREST("GET", metricsQuery, map[string]string{"Content-Type": "application/json"})
 
@@ -768,11 +1268,6 @@ func (ph *Handler) ExecuteMetricsAPIQuery(metricsQuery string) (*DynatraceMetric
 		return nil, err
 	}
 
-	if len(result.Result) == 0 {
-		// datapoints is empty - try again?
-		return nil, errors.New("Dynatrace Metrics API returned no DataPoints")
-	}
-
 	return &result, nil
 }
 
@@ -807,6 +1302,8 @@ func (ph *Handler) ExecuteGetDynatraceProblemById(problemId string) (*DynatraceP
 
 // ExecuteUSQLQuery executes the passed Metrics API Call, validates that the call returns data and returns the data set
 func (ph *Handler) ExecuteUSQLQuery(usql string) (*DTUSQLResult, error) {
+	ph.recordExecutedQuery(usql)
+
 	// now we execute the query against the Dynatrace API
 	resp, body, err := ph.executeDynatraceREST("GET", usql, map[string]string{"Content-Type": "application/json"})
 
@@ -834,12 +1331,93 @@ func (ph *Handler) ExecuteUSQLQuery(usql string) (*DTUSQLResult, error) {
 	return &result, nil
 }
 
+// USQLDimensionSeparator is used to concatenate the values of multiple dimensions of a USQL result into a composite key
+const USQLDimensionSeparator = "_"
+
+// USQLValueColumnPrefix is used in USQL SLI queries to select the value column by name, e.g: USQL;TABLE;dimension;valueColumn=avg(duration);query
+const USQLValueColumnPrefix = "valueColumn="
+
+/**
+ * Returns the index of the value column with the passed name in the USQL result or -1 if no value column is specified
+ * only TABLE tiles can select the value column, the value of the other tile types is always in a fixed column
+ */
+func getUSQLValueColumnIndex(tileType string, usqlResult *DTUSQLResult, valueColumn string) (int, error) {
+	if valueColumn == "" {
+		return -1, nil
+	}
+	if tileType != "TABLE" {
+		return -1, fmt.Errorf("value column %s can only be selected for USQL tile type TABLE, not for %s", valueColumn, tileType)
+	}
+
+	for i, columnName := range usqlResult.ColumnNames {
+		if strings.EqualFold(columnName, valueColumn) {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("USQL result doesn't contain value column %s - available columns are: %s", valueColumn, strings.Join(usqlResult.ColumnNames, ", "))
+}
+
+/**
+ * Returns the dimension name and the value of a USQL result row based on the type of the tile
+ * SINGLE_VALUE: the first column is the value
+ * PIE_CHART, COLUMN_CHART: the first column is the dimension and the second column is the value
+ * TABLE: the leading text columns are the dimensions and the last column is the value
+ * multiple dimensions of a TABLE, e.g: from multiple GROUP BY columns, are concatenated into a composite key, e.g: usa_chrome
+ * if valueColumnIndex is not negative that column is used as value of a TABLE instead of the last one
+ */
+func getUSQLDimensionAndValue(tileType string, rowValue []interface{}, valueColumnIndex int) (string, float64, error) {
+	if tileType != "SINGLE_VALUE" && tileType != "PIE_CHART" && tileType != "COLUMN_CHART" && tileType != "TABLE" {
+		return "", 0, fmt.Errorf("unsupported USQL tile type %s", tileType)
+	}
+	if len(rowValue) == 0 {
+		return "", 0, errors.New("empty USQL result row")
+	}
+	switch {
+	case tileType == "SINGLE_VALUE":
+		valueColumnIndex = 0
+	case tileType == "PIE_CHART" || tileType == "COLUMN_CHART":
+		valueColumnIndex = 1
+	case valueColumnIndex < 0:
+		valueColumnIndex = len(rowValue) - 1
+	}
+	if valueColumnIndex >= len(rowValue) {
+		return "", 0, fmt.Errorf("USQL result row %v has no column %d", rowValue, valueColumnIndex)
+	}
+
+	dimensionValue, ok := rowValue[valueColumnIndex].(float64)
+	if !ok {
+		return "", 0, fmt.Errorf("USQL value %v is not a number", rowValue[valueColumnIndex])
+	}
+	if tileType == "SINGLE_VALUE" {
+		return "", dimensionValue, nil
+	}
+
+	dimensionNames := []string{}
+	for i, column := range rowValue[:len(rowValue)-1] {
+		if i == valueColumnIndex {
+			break
+		}
+		dimensionName, ok := column.(string)
+		if !ok {
+			break
+		}
+		dimensionNames = append(dimensionNames, dimensionName)
+	}
+	if len(dimensionNames) == 0 {
+		return "", 0, fmt.Errorf("USQL result row %v has no dimension", rowValue)
+	}
+
+	return strings.Join(dimensionNames, USQLDimensionSeparator), dimensionValue, nil
+}
+
 // BuildDynatraceUSQLQuery builds a USQL query based on the incoming values
 func (ph *Handler) BuildDynatraceUSQLQuery(query string, startUnix time.Time, endUnix time.Time) string {
-	log.WithField("query", query).Debug("Finalize USQL query")
+	logger := logging.FromContext(ph.EventContext)
+	logger.WithField("query", query).Debug("Finalize USQL query")
 
 	// replace query params (e.g., $PROJECT, $STAGE, $SERVICE ...)
-	usql := ph.replaceQueryParameters(query)
+	usql := ph.replaceQueryParametersUnescaped(query)
 
 	// default query params that are required: resolution, from and to
 	queryParams := map[string]string{
@@ -861,7 +1439,7 @@ func (ph *Handler) BuildDynatraceUSQLQuery(query string, startUnix time.Time, en
 	}
 
 	u.RawQuery = q.Encode()
-	log.WithField("query", u.String()).Debug("Final USQL Query")
+	logger.WithField("query", u.String()).Debug("Final USQL Query")
 
 	return u.String()
 }
@@ -873,11 +1451,17 @@ func (ph *Handler) BuildDynatraceUSQLQuery(query string, startUnix time.Time, en
 //  #2: MetricID that this query will return, e.g: builtin:host.cpu
 //  #3: error
 func (ph *Handler) BuildDynatraceMetricsQuery(metricquery string, startUnix time.Time, endUnix time.Time) (string, string, error) {
+	return ph.buildDynatraceMetricsQueryWithResolution(metricquery, startUnix, endUnix, defaultMetricsResolution)
+}
+
+// buildDynatraceMetricsQueryWithResolution builds the complete query string like BuildDynatraceMetricsQuery but with the passed resolution, e.g: 1m
+func (ph *Handler) buildDynatraceMetricsQueryWithResolution(metricquery string, startUnix time.Time, endUnix time.Time, resolution string) (string, string, error) {
+	logger := logging.FromContext(ph.EventContext)
 	// replace query params (e.g., $PROJECT, $STAGE, $SERVICE ...)
 	metricquery = ph.replaceQueryParameters(metricquery)
 
 	if strings.HasPrefix(metricquery, "?metricSelector=") {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"query":        metricquery,
 				"helpDocument": MetricsAPIOldFormatNewFormatDoc,
@@ -896,7 +1480,7 @@ func (ph *Handler) BuildDynatraceMetricsQuery(metricquery string, startUnix time
 		// new format without "?" -> everything within the query string are query parameters
 		metricQueryParams = querySplit[0]
 	} else {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"query":        metricQueryParams,
 				"helpDocument": MetricsAPIOldFormatNewFormatDoc,
@@ -912,7 +1496,7 @@ func (ph *Handler) BuildDynatraceMetricsQuery(metricquery string, startUnix time
 
 	// default query params that are required: resolution, from and to
 	queryParams := map[string]string{
-		"resolution": "Inf", // resolution=Inf means that we only get 1 datapoint (per service)
+		"resolution": resolution,
 		"from":       common_sli.TimestampToString(startUnix),
 		"to":         common_sli.TimestampToString(endUnix),
 	}
@@ -935,10 +1519,10 @@ func (ph *Handler) BuildDynatraceMetricsQuery(metricquery string, startUnix time
 
 	// compatibility with old scope=... custom queries
 	if scopeData != "" {
-		log.WithField("helpDocument", MetricsAPIOldFormatNewFormatDoc).Debug("COMPATIBILITY WARNING: querying the new metrics API requires use of entitySelector rather than scope")
+		logger.WithField("helpDocument", MetricsAPIOldFormatNewFormatDoc).Debug("COMPATIBILITY WARNING: querying the new metrics API requires use of entitySelector rather than scope")
 		// scope is no longer supported in the new API, it needs to be called "entitySelector" and contain type(SERVICE)
 		if !strings.Contains(scopeData, "type(SERVICE)") {
-			log.WithField("helpDocument", MetricsAPIOldFormatNewFormatDoc).Debug("COMPATIBILITY WARNING: Automatically adding type(SERVICE) to entitySelector for compatibility with the new Metrics API")
+			logger.WithField("helpDocument", MetricsAPIOldFormatNewFormatDoc).Debug("COMPATIBILITY WARNING: Automatically adding type(SERVICE) to entitySelector for compatibility with the new Metrics API")
 			scopeData = fmt.Sprintf("%s,type(SERVICE)", scopeData)
 		}
 		// add scope as entitySelector
@@ -951,7 +1535,7 @@ func (ph *Handler) BuildDynatraceMetricsQuery(metricquery string, startUnix time
 	}
 
 	u.RawQuery = q.Encode()
-	log.WithField("query", u.String()).Debug("Final Query")
+	logger.WithField("query", u.String()).Debug("Final Query")
 
 	return u.String(), metricSelector, nil
 }
@@ -962,13 +1546,14 @@ func (ph *Handler) BuildDynatraceMetricsQuery(metricquery string, startUnix time
  * WHILE NOT PERFECT - HERE IS THE FIRST IMPLEMENTATION
  */
 func (ph *Handler) isMatchingMetricID(singleResultMetricID string, queryMetricID string) bool {
+	logger := logging.FromContext(ph.EventContext)
 	if strings.Compare(singleResultMetricID, queryMetricID) == 0 {
 		return true
 	}
 
 	// lets do some basic fuzzy matching
 	if strings.Contains(singleResultMetricID, "~") {
-		log.WithFields(
+		logger.WithFields(
 			log.Fields{
 				"singleResultMetricID": singleResultMetricID,
 				"queryMetricID":        queryMetricID,
@@ -977,12 +1562,12 @@ func (ph *Handler) isMatchingMetricID(singleResultMetricID string, queryMetricID
 		//
 		// lets just see whether everything until the first : matches
 		if strings.Contains(singleResultMetricID, ":") {
-			log.Debug("Just compare before first")
+			logger.Debug("Just compare before first")
 
 			fuzzyResultMetricID := strings.Split(singleResultMetricID, ":")[0]
 			fuzzyQueryMetricID := strings.Split(queryMetricID, ":")[0]
 			if strings.Compare(fuzzyResultMetricID, fuzzyQueryMetricID) == 0 {
-				log.Debug("FUZZY MATCH")
+				logger.Debug("FUZZY MATCH")
 				return true
 			}
 		}
@@ -993,11 +1578,119 @@ func (ph *Handler) isMatchingMetricID(singleResultMetricID string, queryMetricID
 	return false
 }
 
+/**
+ * Returns a link into the Dynatrace data explorer that is pre-filled with the metricSelector and entitySelector of the passed metric query as well as the timeframe
+ * metricQuery is expected in the form of metricSelector=...&entitySelector=... - from and to are unix timestamps in milliseconds
+ */
+func (ph *Handler) getDataExplorerDeepLink(metricQuery string, from string, to string) string {
+	logger := logging.FromContext(ph.EventContext)
+	queryParams, err := url.ParseQuery(metricQuery)
+	if err != nil || queryParams.Get("metricSelector") == "" {
+		logger.WithField("metricQuery", metricQuery).Debug("Could not generate data explorer link for query")
+		return ""
+	}
+
+	linkParams := url.Values{}
+	linkParams.Add("metricSelector", queryParams.Get("metricSelector"))
+	if entitySelector := queryParams.Get("entitySelector"); entitySelector != "" {
+		linkParams.Add("entitySelector", entitySelector)
+	}
+
+	return fmt.Sprintf("%s/ui/data-explorer?gtf=c_%s_%s&%s", ph.ApiURL, from, to, linkParams.Encode())
+}
+
+/**
+ * Returns a link into the Dynatrace data explorer for the passed metrics API query URL as returned by BuildDynatraceMetricsQuery
+ */
+func (ph *Handler) getDataExplorerDeepLinkFromQueryURL(metricsQueryURL string) string {
+	u, err := url.Parse(metricsQueryURL)
+	if err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	return ph.getDataExplorerDeepLink(u.RawQuery, q.Get("from"), q.Get("to"))
+}
+
+/**
+ * GetSLIDeepLink returns a link into Dynatrace that allows to investigate the passed SLI for the given timeframe
+ * Returns an empty string if no link can be generated for that type of SLI
+ */
+func (ph *Handler) GetSLIDeepLink(metric string, startUnix time.Time, endUnix time.Time) string {
+	metricsQuery, err := ph.getTimeseriesConfig(metric)
+	if err != nil {
+		return ""
+	}
+
+	timeframe := fmt.Sprintf("gtf=c_%s_%s", common_sli.TimestampToString(startUnix), common_sli.TimestampToString(endUnix))
+
+	if strings.HasPrefix(metricsQuery, "SYNTHETIC;") {
+		metricsQuery, err = buildSyntheticMetricsQuery(metricsQuery)
+		if err != nil {
+			return ""
+		}
+	}
+
+	if strings.HasPrefix(metricsQuery, "USQL;") {
+		return fmt.Sprintf("%s/#usql;%s", ph.ApiURL, timeframe)
+	} else if strings.HasPrefix(metricsQuery, "SLO;") {
+		return fmt.Sprintf("%s/#slos;%s", ph.ApiURL, timeframe)
+	} else if strings.HasPrefix(metricsQuery, "PV2;") {
+		return fmt.Sprintf("%s/#problems;%s", ph.ApiURL, timeframe)
+	} else if strings.HasPrefix(metricsQuery, "SECPV2;") {
+		return fmt.Sprintf("%s/#securityProblems;%s", ph.ApiURL, timeframe)
+	} else if strings.HasPrefix(metricsQuery, "LOG;") {
+		logQuery := strings.TrimPrefix(strings.TrimPrefix(metricsQuery, "LOG;"), "query=")
+		return fmt.Sprintf("%s/ui/log-monitoring?%s&query=%s", ph.ApiURL, timeframe, url.QueryEscape(ph.replaceQueryParametersUnescaped(logQuery)))
+	} else if strings.HasPrefix(metricsQuery, "DQL;") || strings.HasPrefix(metricsQuery, "ENTITYCOUNT;") {
+		// there is no stable deep link for ad-hoc DQL or entity queries
+		return ""
+	}
+
+	resolution := defaultMetricsResolution
+	if strings.HasPrefix(metricsQuery, "MV2;") {
+		metricsQuery = metricsQuery[4:]
+		metricsQuery = metricsQuery[strings.Index(metricsQuery, ";")+1:]
+
+		settings, query, err := parseMV2QuerySettings(metricsQuery)
+		if err != nil {
+			return ""
+		}
+		resolution = settings.resolution
+		metricsQuery = query
+	}
+
+	metricsQueryURL, _, err := ph.buildDynatraceMetricsQueryWithResolution(metricsQuery, startUnix, endUnix, resolution)
+	if err != nil {
+		return ""
+	}
+
+	return ph.getDataExplorerDeepLinkFromQueryURL(metricsQueryURL)
+}
+
+/**
+ * Adds the passed Dynatrace link to an SLI result message
+ */
+func AppendDeepLinkToMessage(message string, link string) string {
+	if link == "" {
+		return message
+	}
+	if message == "" {
+		return "Dynatrace link: " + link
+	}
+	return message + " - Dynatrace link: " + link
+}
+
 /**
  * This function will validate if the current dashboard.json stored in the configuration repo is the same as the one passed as parameter
  */
 func (ph *Handler) HasDashboardChanged(keptnEvent *common_sli.BaseKeptnEvent, dashboardJSON *DynatraceDashboard, existingDashboardContent string) bool {
 
+	// a forced re-parse via dynatrace.conf.yaml or the parse=always label always counts as a change - the caller sets ForceDashboardParsing accordingly
+	if ph.ForceDashboardParsing {
+		return true
+	}
+
 	jsonAsByteArray, _ := json.MarshalIndent(dashboardJSON, "", "  ")
 	newDashboardContent := string(jsonAsByteArray)
 
@@ -1044,6 +1737,7 @@ func (ph *Handler) GetEntitySelectorFromEntityFilter(filtersPerEntityType map[st
  * If successful returns sliResult, sliIndicatorName, sliQuery & sloDefinition
  */
 func (ph *Handler) ProcessSLOTile(sloID string, startUnix time.Time, endUnix time.Time) (*keptnv2.SLIResult, string, string, *keptncommon.SLO, error) {
+	logger := logging.FromContext(ph.EventContext)
 
 	// Step 1: Query the Dynatrace API to get the actual value for this sloID
 	sloResult, err := ph.ExecuteGetDynatraceSLO(sloID, startUnix, endUnix)
@@ -1062,7 +1756,7 @@ func (ph *Handler) ProcessSLOTile(sloID string, startUnix time.Time, endUnix tim
 		Success: true,
 	}
 
-	log.WithFields(
+	logger.WithFields(
 		log.Fields{
 			"indicatorName": indicatorName,
 			"value":         value,
@@ -1103,6 +1797,44 @@ func (ph *Handler) ProcessSLOTile(sloID string, startUnix time.Time, endUnix tim
  * If successful returns sliResult, sliIndicatorName, sliQuery & sloDefinition
  */
 func (ph *Handler) ProcessOpenProblemTile(problemSelector string, entitySelector string, startUnix time.Time, endUnix time.Time) (*keptnv2.SLIResult, string, string, *keptncommon.SLO, error) {
+	return ph.processOpenProblemTile("problems", "sli=problems;pass=<=0;key=true", problemSelector, entitySelector, startUnix, endUnix)
+}
+
+/**
+ * Processes an Open Problem Tile broken down by severityLevel or impactLevel and queries the number of open problems for each level
+ * The indicators are named after the level, e.g: problems_availability, problems_resource and have a pass criteria of <= 0
+ */
+func (ph *Handler) ProcessOpenProblemTileBreakdown(breakdown string, problemSelector string, entitySelector string, startUnix time.Time, endUnix time.Time) ([]*keptnv2.SLIResult, map[string]string, []*keptncommon.SLO, error) {
+	levels, ok := problemBreakdownLevels[breakdown]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported problem breakdown %s - use %s or %s", breakdown, problemBreakdownSeverityLevel, problemBreakdownImpactLevel)
+	}
+
+	sliResults := []*keptnv2.SLIResult{}
+	sliQueries := map[string]string{}
+	sloDefinitions := []*keptncommon.SLO{}
+	for _, level := range levels {
+		indicatorName := "problems_" + level[1]
+		levelProblemSelector := fmt.Sprintf("%s(\"%s\")", breakdown, level[0])
+		if problemSelector != "" {
+			levelProblemSelector = problemSelector + "," + levelProblemSelector
+		}
+
+		sliResult, sliIndicator, sliQuery, sloDefinition, err := ph.processOpenProblemTile(indicatorName, fmt.Sprintf("sli=%s;pass=<=0", indicatorName), levelProblemSelector, entitySelector, startUnix, endUnix)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		sliResults = append(sliResults, sliResult)
+		sliQueries[sliIndicator] = sliQuery
+		sloDefinitions = append(sloDefinitions, sloDefinition)
+	}
+
+	return sliResults, sliQueries, sloDefinitions, nil
+}
+
+func (ph *Handler) processOpenProblemTile(indicatorName string, sloString string, problemSelector string, entitySelector string, startUnix time.Time, endUnix time.Time) (*keptnv2.SLIResult, string, string, *keptncommon.SLO, error) {
+	logger := logging.FromContext(ph.EventContext)
 
 	problemQuery := ""
 	separator := ""
@@ -1125,7 +1857,6 @@ func (ph *Handler) ProcessOpenProblemTile(problemSelector string, entitySelector
 	// Step 2: As we have the SLO Result including SLO Definition we add it to the SLI & SLO objects
 	// IndicatorName is based on the slo Name
 	// the value defaults to the E
-	indicatorName := "problems"
 	value := float64(problemQueryResult.TotalCount)
 	sliResult := &keptnv2.SLIResult{
 		Metric:  indicatorName,
@@ -1133,7 +1864,7 @@ func (ph *Handler) ProcessOpenProblemTile(problemSelector string, entitySelector
 		Success: true,
 	}
 
-	log.WithFields(
+	logger.WithFields(
 		log.Fields{
 			"indicatorName": indicatorName,
 			"value":         value,
@@ -1145,7 +1876,6 @@ func (ph *Handler) ProcessOpenProblemTile(problemSelector string, entitySelector
 
 	// lets add the SLO definitin in case we need to generate an SLO.yaml
 	// we normally parse these values from the tile name. In this case we just build that tile name -> maybe in the future we will allow users to add additional SLO defs via the Tile Name, e.g: weight or KeySli
-	sloString := fmt.Sprintf("sli=%s;pass=<=0;key=true", indicatorName)
 	_, passSLOs, warningSLOs, weight, keySli := common_sli.ParsePassAndWarningFromString(sloString, []string{}, []string{})
 	sloDefinition := &keptncommon.SLO{
 		SLI:     indicatorName,
@@ -1163,6 +1893,7 @@ func (ph *Handler) ProcessOpenProblemTile(problemSelector string, entitySelector
  * If successful returns sliResult, sliIndicatorName, sliQuery & sloDefinition
  */
 func (ph *Handler) ProcessOpenSecurityProblemTile(securityProblemSelector string, startUnix time.Time, endUnix time.Time) (*keptnv2.SLIResult, string, string, *keptncommon.SLO, error) {
+	logger := logging.FromContext(ph.EventContext)
 
 	problemQuery := ""
 	if securityProblemSelector != "" {
@@ -1186,7 +1917,7 @@ func (ph *Handler) ProcessOpenSecurityProblemTile(securityProblemSelector string
 		Success: true,
 	}
 
-	log.WithFields(
+	logger.WithFields(
 		log.Fields{
 			"indicatorName": indicatorName,
 			"value":         value,
@@ -1222,11 +1953,12 @@ func (ph *Handler) ProcessOpenSecurityProblemTile(securityProblemSelector string
  * #6: filterSLIDefinitionAttregator, e.g: , filter(eq(Test Step,FILTERDIMENSIONVALUE))
  */
 func (ph *Handler) GenerateMetricQueryFromDataExplorer(dataQuery DataExplorerQuery, tileManagementZoneFilter string, startUnix time.Time, endUnix time.Time) (string, string, string, string, string, string, error) {
+	logger := logging.FromContext(ph.EventContext)
 
 	// Lets query the metric definition as we need to know how many dimension the metric has
 	metricDefinition, err := ph.ExecuteMetricAPIDescribe(dataQuery.Metric)
 	if err != nil {
-		log.WithError(err).WithField("metric", dataQuery.Metric).Debug("Error retrieving metric description")
+		logger.WithError(err).WithField("metric", dataQuery.Metric).Debug("Error retrieving metric description")
 		return "", "", "", "", "", "", err
 	}
 
@@ -1242,11 +1974,11 @@ func (ph *Handler) GenerateMetricQueryFromDataExplorer(dataQuery DataExplorerQue
 	// we need to merge all those dimensions based on the metric definition that are not included in the "splitBy"
 	// so - we iterate through the dimensions based on the metric definition from the back to front - and then merge those not included in splitBy
 	for metricDimIx := metricDimensionCount - 1; metricDimIx >= 0; metricDimIx-- {
-		log.WithField("metricDimIx", metricDimIx).Debug("Processing Dimension Ix")
+		logger.WithField("metricDimIx", metricDimIx).Debug("Processing Dimension Ix")
 
 		doMergeDimension := true
 		for _, splitDimension := range dataQuery.SplitBy {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"dimension1": splitDimension,
 					"dimension2": metricDefinition.DimensionDefinitions[metricDimIx].Key,
@@ -1259,7 +1991,7 @@ func (ph *Handler) GenerateMetricQueryFromDataExplorer(dataQuery DataExplorerQue
 
 		if doMergeDimension {
 			// this is a dimension we want to merge as it is not split by in the chart
-			log.WithField("dimension", metricDefinition.DimensionDefinitions[metricDimIx].Key).Debug("merging dimension")
+			logger.WithField("dimension", metricDefinition.DimensionDefinitions[metricDimIx].Key).Debug("merging dimension")
 			mergeAggregator = mergeAggregator + fmt.Sprintf(":merge(%d)", metricDimIx)
 		}
 	}
@@ -1277,7 +2009,7 @@ func (ph *Handler) GenerateMetricQueryFromDataExplorer(dataQuery DataExplorerQue
 				filterAggregator = fmt.Sprintf(":filter(%s(%s,%s))", dataQuery.FilterBy.NestedFilters[0].Criteria[0].Evaluator, dataQuery.FilterBy.NestedFilters[0].Filter, dataQuery.FilterBy.NestedFilters[0].Criteria[0].Value)
 			}
 		} else {
-			log.Debug("Code only supports a single filter for data explorer")
+			logger.Debug("Code only supports a single filter for data explorer")
 		}
 	}
 
@@ -1287,7 +2019,7 @@ func (ph *Handler) GenerateMetricQueryFromDataExplorer(dataQuery DataExplorerQue
 		if len(dataQuery.SplitBy) == 1 {
 			filterSLIDefinitionAggregator = fmt.Sprintf("%s:filter(eq(%s,FILTERDIMENSIONVALUE))", filterSLIDefinitionAggregator, dataQuery.SplitBy[0])
 		} else {
-			log.Debug("Code only supports a single splitby dimension for data explorer")
+			logger.Debug("Code only supports a single splitby dimension for data explorer")
 		}
 	}
 
@@ -1317,10 +2049,11 @@ func (ph *Handler) GenerateMetricQueryFromDataExplorer(dataQuery DataExplorerQue
  * #6: filterSLIDefinitionAttregator, e.g: , filter(eq(Test Step,FILTERDIMENSIONVALUE))
  */
 func (ph *Handler) GenerateMetricQueryFromChart(series ChartSeries, tileManagementZoneFilter string, filtersPerEntityType map[string]map[string][]string, startUnix time.Time, endUnix time.Time) (string, string, string, string, string, string, error) {
+	logger := logging.FromContext(ph.EventContext)
 	// Lets query the metric definition as we need to know how many dimension the metric has
 	metricDefinition, err := ph.ExecuteMetricAPIDescribe(series.Metric)
 	if err != nil {
-		log.WithError(err).WithField("metric", series.Metric).Debug("Error retrieving metric description")
+		logger.WithError(err).WithField("metric", series.Metric).Debug("Error retrieving metric description")
 		return "", "", "", "", "", "", err
 	}
 
@@ -1339,14 +2072,14 @@ func (ph *Handler) GenerateMetricQueryFromChart(series ChartSeries, tileManageme
 		metricDimIxAsString := strconv.Itoa(metricDimIx)
 		// lets check if this dimension is in the chart
 		for _, seriesDim := range series.Dimensions {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"seriesDim.id": seriesDim.ID,
 					"metricDimIx":  metricDimIxAsString,
 				}).Debug("check")
 			if strings.Compare(seriesDim.ID, metricDimIxAsString) == 0 {
 				// this is a dimension we want to keep and not merge
-				log.WithField("dimension", metricDefinition.DimensionDefinitions[metricDimIx].Name).Debug("not merging dimension")
+				logger.WithField("dimension", metricDefinition.DimensionDefinitions[metricDimIx].Name).Debug("not merging dimension")
 				doMergeDimension = false
 
 				// lets check if we need to apply a dimension filter
@@ -1367,7 +2100,7 @@ func (ph *Handler) GenerateMetricQueryFromChart(series ChartSeries, tileManageme
 
 		if doMergeDimension {
 			// this is a dimension we want to merge as it is not split by in the chart
-			log.WithField("dimension", metricDefinition.DimensionDefinitions[metricDimIx].Name).Debug("merging dimension")
+			logger.WithField("dimension", metricDefinition.DimensionDefinitions[metricDimIx].Name).Debug("merging dimension")
 			mergeAggregator = mergeAggregator + fmt.Sprintf(":merge(%d)", metricDimIx)
 		}
 	}
@@ -1422,15 +2155,17 @@ func (ph *Handler) GenerateMetricQueryFromChart(series ChartSeries, tileManageme
 /**
  * Generates the relvant SLIs & SLO definitions based on the metric query
  * noOfDimensionsInChart: how many dimensions did we have in the chart definition
+ * targetUnit: optional unit the values should be converted to, e.g: MilliSecond
  */
-func (ph *Handler) GenerateSLISLOFromMetricsAPIQuery(noOfDimensionsInChart int, baseIndicatorName string, passSLOs []*keptncommon.SLOCriteria, warningSLOs []*keptncommon.SLOCriteria, weight int, keySli bool, metricID string, metricUnit string, metricQuery string, fullMetricQuery string, filterSLIDefinitionAggregator string, entitySelectorSLIDefinition string, dashboardSLI *SLI, dashboardSLO *keptncommon.ServiceLevelObjectives) []*keptnv2.SLIResult {
+func (ph *Handler) GenerateSLISLOFromMetricsAPIQuery(noOfDimensionsInChart int, baseIndicatorName string, passSLOs []*keptncommon.SLOCriteria, warningSLOs []*keptncommon.SLOCriteria, weight int, keySli bool, metricID string, metricUnit string, targetUnit string, metricQuery string, fullMetricQuery string, filterSLIDefinitionAggregator string, entitySelectorSLIDefinition string, dashboardSLI *SLI, dashboardSLO *keptncommon.ServiceLevelObjectives) []*keptnv2.SLIResult {
+	logger := logging.FromContext(ph.EventContext)
 
 	var sliResults []*keptnv2.SLIResult
 
 	// Lets run the Query and iterate through all data per dimension. Each Dimension will become its own indicator
 	queryResult, err := ph.ExecuteMetricsAPIQuery(fullMetricQuery)
 	if err != nil {
-		log.WithError(err).Debug("No result for query")
+		logger.WithError(err).Debug("No result for query")
 
 		// ERROR-CASE: Metric API return no values or an error
 		// we couldnt query data - so - we return the error back as part of our SLIResults
@@ -1438,15 +2173,22 @@ func (ph *Handler) GenerateSLISLOFromMetricsAPIQuery(noOfDimensionsInChart int,
 			Metric:  baseIndicatorName,
 			Value:   0,
 			Success: false, // Mark as failure
-			Message: err.Error(),
+			Message: AppendQueriesToMessage(AppendDeepLinkToMessage(err.Error(), ph.getDataExplorerDeepLinkFromQueryURL(fullMetricQuery)), []string{fullMetricQuery}),
 		})
 
 		// add this to our SLI Indicator JSON in case we need to generate an SLI.yaml
 		dashboardSLI.Indicators[baseIndicatorName] = metricQuery
 	} else {
+		// we need the timeframe of the query to generate the deep links for each indicator
+		var from, to string
+		if u, err := url.Parse(fullMetricQuery); err == nil {
+			from = u.Query().Get("from")
+			to = u.Query().Get("to")
+		}
+
 		// SUCCESS-CASE: we retrieved values - now we interate through the results and create an indicator result for every dimension
 		for _, singleResult := range queryResult.Result {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"metricId":                      singleResult.MetricID,
 					"filterSLIDefinitionAggregator": filterSLIDefinitionAggregator,
@@ -1455,7 +2197,7 @@ func (ph *Handler) GenerateSLISLOFromMetricsAPIQuery(noOfDimensionsInChart int,
 			if ph.isMatchingMetricID(singleResult.MetricID, metricID) {
 				dataResultCount := len(singleResult.Data)
 				if dataResultCount == 0 {
-					log.Debug("No data for metric")
+					logger.Debug("No data for metric")
 				}
 				for _, singleDataEntry := range singleResult.Data {
 					//
@@ -1504,27 +2246,30 @@ func (ph *Handler) GenerateSLISLOFromMetricsAPIQuery(noOfDimensionsInChart int,
 					value = value / float64(len(singleDataEntry.Values))
 
 					// lets scale the metric
-					value = scaleData(metricID, metricUnit, value)
+					value = ph.scaleValue(metricID, metricUnit, targetUnit, value)
 
 					// we got our metric, slos and the value
 
-					log.WithFields(
+					logger.WithFields(
 						log.Fields{
 							"name":  indicatorName,
 							"value": value,
 						}).Debug("Got indicator value")
 
+					sliMetricQuery := strings.Replace(metricQueryForSLI, ":names", filterSLIDefinitionAggregatorValue, 1)
+
 					// lets add the value to our SLIResult array
 					sliResults = append(sliResults, &keptnv2.SLIResult{
 						Metric:  indicatorName,
 						Value:   value,
 						Success: true,
+						Message: AppendQueriesToMessage(AppendDeepLinkToMessage("", ph.getDataExplorerDeepLink(ph.replaceQueryParameters(sliMetricQuery), from, to)), []string{fullMetricQuery}),
 					})
 
 					// add this to our SLI Indicator JSON in case we need to generate an SLI.yaml
 					// we use ":names" to find the right spot to add our custom dimension filter
 					// we also "pre-pend" the metricDefinition.Unit - which allows us later on to do the scaling right
-					dashboardSLI.Indicators[indicatorName] = fmt.Sprintf("MV2;%s;%s", metricUnit, strings.Replace(metricQueryForSLI, ":names", filterSLIDefinitionAggregatorValue, 1))
+					dashboardSLI.Indicators[indicatorName] = fmt.Sprintf("MV2;%s;%s", buildMV2UnitDefinition(metricUnit, targetUnit), sliMetricQuery)
 
 					// lets add the SLO definitin in case we need to generate an SLO.yaml
 					sloDefinition := &keptncommon.SLO{
@@ -1537,7 +2282,7 @@ func (ph *Handler) GenerateSLISLOFromMetricsAPIQuery(noOfDimensionsInChart int,
 					dashboardSLO.Objectives = append(dashboardSLO.Objectives, sloDefinition)
 				}
 			} else {
-				log.WithFields(
+				logger.WithFields(
 					log.Fields{
 						"wantedMetricId": metricID,
 						"gotMetricId":    singleResult.MetricID,
@@ -1559,13 +2304,14 @@ func (ph *Handler) GenerateSLISLOFromMetricsAPIQuery(noOfDimensionsInChart int,
 //  #4: SLIResult
 //  #5: Error
 func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKeptnEvent, dashboard string, startUnix time.Time, endUnix time.Time) (string, *DynatraceDashboard, *SLI, *keptncommon.ServiceLevelObjectives, []*keptnv2.SLIResult, error) {
+	logger := logging.FromContext(ph.EventContext)
 
 	// Lets see if there is a dashboard.json already in the configuration repo - if so its an indicator that we should query the dashboard
 	// This check is espcially important for backward compatibilty as the new dynatrace.conf.yaml:dashboard property is changing the default behavior
 	// If a dashboard.json exists and dashboard property is empty we default to QUERY - which is the old default behavior
-	existingDashboardContent, err := common_sli.GetKeptnResource(keptnEvent, common_sli.DynatraceDashboardFilename)
+	existingDashboardContent, err := common_sli.GetKeptnResource(ph.EventContext, keptnEvent, common_sli.DynatraceDashboardFilename)
 	if err == nil && existingDashboardContent != "" && dashboard == "" {
-		log.Debug("Set dashboard=query for backward compatibility as dashboard.json was present!")
+		logger.Debug("Set dashboard=query for backward compatibility as dashboard.json was present!")
 		dashboard = common_sli.DynatraceConfigDashboardQUERY
 	}
 
@@ -1608,22 +2354,39 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 	// Lets validate if we really need to process this dashboard as it might be the same (without change) from the previous runs
 	// see https://github.com/keptn-contrib/dynatrace-sli-service/issues/92 for more details
 	if !ph.HasDashboardChanged(keptnEvent, dashboardJSON, existingDashboardContent) {
-		log.Debug("Dashboard hasn't changed: skipping parsing of dashboard")
+		logger.Debug("Dashboard hasn't changed: skipping parsing of dashboard")
 		return dashboardLinkAsLabel, nil, nil, nil, nil, nil
 	}
 
-	log.Debug("Dashboard has changed: reparsing it!")
+	logger.Debug("Dashboard has changed: reparsing it!")
+
+	// the report of how each tile of this dashboard was processed - the SLIs per tile are counted once all tiles are processed
+	var tileResults []*TileProcessingResult
 
 	//
 	// now lets iterate through the dashboard to find our SLIs
 	for _, tile := range dashboardJSON.Tiles {
+		// custom chart and usql have different ways to define their tile names - so - lets figure it out by looking at the potential values
+		tileTitle := tile.FilterConfig.CustomName // this is for all custom charts
+		if tileTitle == "" {
+			tileTitle = tile.CustomName
+		}
+		if tileTitle == "" {
+			tileTitle = tile.Name
+		}
+
+		tileResult := ph.startTileReport(dashboardJSON.ID, tileTitle, tile.TileType, len(sliResults))
+		tileResults = append(tileResults, tileResult)
+
 		if tile.TileType == "HEADER" {
 			// we dont do markdowns or synthetic tests
+			tileResult.skip(tileReasonUnsupportedType)
 			continue
 		}
 
 		if tile.TileType == "SYNTHETIC_TESTS" {
 			// we dont do markdowns or synthetic tests
+			tileResult.skip(tileReasonUnsupportedType)
 			continue
 		}
 
@@ -1632,6 +2395,9 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 			// if we find KQG. we process the markdown
 			if strings.Contains(tile.Markdown, "KQG.") {
 				common_sli.ParseMarkdownConfiguration(tile.Markdown, dashboardSLO)
+				tileResult.Included = true
+			} else {
+				tileResult.skip("markdown without KQG. configuration")
 			}
 
 			continue
@@ -1647,11 +2413,12 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 		if tile.TileType == "SLO" {
 			// we will take the SLO definition from Dynatrace
 			for _, sloEntity := range tile.AssignedEntities {
-				log.WithField("sloEntity", sloEntity).Debug("Processing SLO Definition")
+				logger.WithField("sloEntity", sloEntity).Debug("Processing SLO Definition")
 
 				sliResult, sliIndicator, sliQuery, sloDefinition, err := ph.ProcessSLOTile(sloEntity, startUnix, endUnix)
 				if err != nil {
-					log.WithError(err).Error("Error Processing SLO")
+					logger.WithError(err).Error("Error Processing SLO")
+					tileResult.addError(err)
 				} else {
 					sliResults = append(sliResults, sliResult)
 					dashboardSLI.Indicators[sliIndicator] = sliQuery
@@ -1675,12 +2442,28 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 
 			sliResult, sliIndicator, sliQuery, sloDefinition, err := ph.ProcessOpenProblemTile(problemSelector, entitySelector, startUnix, endUnix)
 			if err != nil {
-				log.WithError(err).Error("Error Processing OPEN_PROBLEMS")
+				logger.WithError(err).Error("Error Processing OPEN_PROBLEMS")
+				tileResult.addError(err)
 			} else {
 				sliResults = append(sliResults, sliResult)
 				dashboardSLI.Indicators[sliIndicator] = sliQuery
 				dashboardSLO.Objectives = append(dashboardSLO.Objectives, sloDefinition)
 			}
+
+			// optionally the problems are broken down into one indicator per severity or impact level, e.g: Problems;breakdown=severityLevel
+			if breakdown := common_sli.ParseTileSettingFromString(tile.Name, "breakdown"); breakdown != "" {
+				breakdownResults, breakdownQueries, breakdownDefinitions, err := ph.ProcessOpenProblemTileBreakdown(breakdown, problemSelector, entitySelector, startUnix, endUnix)
+				if err != nil {
+					logger.WithError(err).Error("Error Processing OPEN_PROBLEMS breakdown")
+					tileResult.addError(err)
+				} else {
+					sliResults = append(sliResults, breakdownResults...)
+					for sliIndicator, sliQuery := range breakdownQueries {
+						dashboardSLI.Indicators[sliIndicator] = sliQuery
+					}
+					dashboardSLO.Objectives = append(dashboardSLO.Objectives, breakdownDefinitions...)
+				}
+			}
 		}
 
 		if (tile.TileType == "OPEN_SECURITY_PROBLEMS") ||
@@ -1696,12 +2479,14 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 
 			sliResult, sliIndicator, sliQuery, sloDefinition, err := ph.ProcessOpenSecurityProblemTile(problemSelector, startUnix, endUnix)
 			if err != nil {
-				log.WithError(err).Error("Error Processing OPEN_SECURITY_PROBLEMS")
+				logger.WithError(err).Error("Error Processing OPEN_SECURITY_PROBLEMS")
+				tileResult.addError(err)
 			} else {
 				sliResults = append(sliResults, sliResult)
 				dashboardSLI.Indicators[sliIndicator] = sliQuery
 				dashboardSLO.Objectives = append(dashboardSLO.Objectives, sloDefinition)
 			}
+			continue
 		}
 
 		//
@@ -1711,21 +2496,25 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 			// first - lets figure out if this tile should be included in SLI validation or not - we parse the title and look for "sli=sliname"
 			baseIndicatorName, passSLOs, warningSLOs, weight, keySli := common_sli.ParsePassAndWarningFromString(tile.Name, []string{}, []string{})
 			if baseIndicatorName == "" {
-				log.WithField("tileName", tile.Name).Debug("Data explorer tile not included as name doesnt include sli=SLINAME")
+				logger.WithField("tileName", tile.Name).Debug("Data explorer tile not included as name doesnt include sli=SLINAME")
+				tileResult.skip(tileReasonNoSLIName)
 				continue
 			}
+			targetUnit := common_sli.ParseTargetUnitFromString(tile.Name)
 
 			// now lets process that tile - lets run through each query
 			for _, dataQuery := range tile.Queries {
-				log.WithField("metric", dataQuery.Metric).Debug("Processing data explorer query")
+				logger.WithField("metric", dataQuery.Metric).Debug("Processing data explorer query")
 
 				// First lets generate the query and extract all important metric information we need for generating SLIs & SLOs
 				metricID, metricUnit, metricQuery, fullMetricQuery, entitySelectorSLIDefinition, filterSLIDefinitionAggregator, err := ph.GenerateMetricQueryFromDataExplorer(dataQuery, tileManagementZoneFilter, startUnix, endUnix)
 
 				// if there was no error we generate the SLO & SLO definition
 				if err == nil {
-					newSliResults := ph.GenerateSLISLOFromMetricsAPIQuery(len(dataQuery.SplitBy), baseIndicatorName, passSLOs, warningSLOs, weight, keySli, metricID, metricUnit, metricQuery, fullMetricQuery, filterSLIDefinitionAggregator, entitySelectorSLIDefinition, dashboardSLI, dashboardSLO)
+					newSliResults := ph.GenerateSLISLOFromMetricsAPIQuery(len(dataQuery.SplitBy), baseIndicatorName, passSLOs, warningSLOs, weight, keySli, metricID, metricUnit, targetUnit, metricQuery, fullMetricQuery, filterSLIDefinitionAggregator, entitySelectorSLIDefinition, dashboardSLI, dashboardSLO)
 					sliResults = append(sliResults, newSliResults...)
+				} else {
+					tileResult.addError(err)
 				}
 
 			}
@@ -1733,25 +2522,18 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 
 		}
 
-		// custom chart and usql have different ways to define their tile names - so - lets figure it out by looking at the potential values
-		tileTitle := tile.FilterConfig.CustomName // this is for all custom charts
-		if tileTitle == "" {
-			tileTitle = tile.CustomName
-		}
-		if tileTitle == "" {
-			tileTitle = tile.Name
-		}
-
 		// first - lets figure out if this tile should be included in SLI validation or not - we parse the title and look for "sli=sliname"
 		baseIndicatorName, passSLOs, warningSLOs, weight, keySli := common_sli.ParsePassAndWarningFromString(tileTitle, []string{}, []string{})
 		if baseIndicatorName == "" {
-			log.WithField("tileTitle", tileTitle).Debug("Tile not included as name doesnt include sli=SLINAME")
+			logger.WithField("tileTitle", tileTitle).Debug("Tile not included as name doesnt include sli=SLINAME")
+			tileResult.skip(tileReasonNoSLIName)
 			continue
 		}
+		targetUnit := common_sli.ParseTargetUnitFromString(tileTitle)
 
 		// only interested in custom charts
 		if tile.TileType == "CUSTOM_CHARTING" {
-			log.WithFields(
+			logger.WithFields(
 				log.Fields{
 					"tileTitle":         tileTitle,
 					"baseIndicatorName": baseIndicatorName,
@@ -1765,10 +2547,13 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 
 				// if there was no error we generate the SLO & SLO definition
 				if err == nil {
-					newSliResults := ph.GenerateSLISLOFromMetricsAPIQuery(len(series.Dimensions), baseIndicatorName, passSLOs, warningSLOs, weight, keySli, metricID, metricUnit, metricQuery, fullMetricQuery, filterSLIDefinitionAggregator, entitySelectorSLIDefinition, dashboardSLI, dashboardSLO)
+					newSliResults := ph.GenerateSLISLOFromMetricsAPIQuery(len(series.Dimensions), baseIndicatorName, passSLOs, warningSLOs, weight, keySli, metricID, metricUnit, targetUnit, metricQuery, fullMetricQuery, filterSLIDefinitionAggregator, entitySelectorSLIDefinition, dashboardSLI, dashboardSLO)
 					sliResults = append(sliResults, newSliResults...)
+				} else {
+					tileResult.addError(err)
 				}
 			}
+			continue
 		}
 
 		// Dynatrace Query Language
@@ -1779,30 +2564,26 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 			// PIE_CHART, COLUMN_CHART: we assume the first column is the dimension and the second column is the value column
 			// TABLE: we assume the first column is the dimension and the last is the value
 
+			// the value column can also be selected by name, e.g: sli=rt;valueColumn=avg(duration)
+			valueColumn := common_sli.ParseTileSettingFromString(tileTitle, "valueColumn")
+
 			usql := ph.BuildDynatraceUSQLQuery(tile.Query, startUnix, endUnix)
 			usqlResult, err := ph.ExecuteUSQLQuery(usql)
 
-			if err != nil {
+			var valueColumnIndex int
+			if err == nil {
+				valueColumnIndex, err = getUSQLValueColumnIndex(tile.Type, usqlResult, valueColumn)
+			}
 
+			if err != nil {
+				logger.WithError(err).WithField("tileTitle", tileTitle).Error("Error Processing USQL tile")
+				tileResult.addError(err)
 			} else {
 
 				for _, rowValue := range usqlResult.Values {
-					dimensionName := ""
-					dimensionValue := 0.0
-
-					if tile.Type == "SINGLE_VALUE" {
-						dimensionValue = rowValue[0].(float64)
-					} else if tile.Type == "PIE_CHART" {
-						dimensionName = rowValue[0].(string)
-						dimensionValue = rowValue[1].(float64)
-					} else if tile.Type == "COLUMN_CHART" {
-						dimensionName = rowValue[0].(string)
-						dimensionValue = rowValue[1].(float64)
-					} else if tile.Type == "TABLE" {
-						dimensionName = rowValue[0].(string)
-						dimensionValue = rowValue[len(rowValue)-1].(float64)
-					} else {
-						log.WithField("tileType", tile.Type).Debug("Unsupport USQL tile type")
+					dimensionName, dimensionValue, err := getUSQLDimensionAndValue(tile.Type, rowValue, valueColumnIndex)
+					if err != nil {
+						logger.WithError(err).WithField("tileType", tile.Type).Debug("Skipping USQL result row")
 						continue
 					}
 
@@ -1815,7 +2596,7 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 						indicatorName = indicatorName + "_" + dimensionName
 					}
 
-					log.WithFields(
+					logger.WithFields(
 						log.Fields{
 							"name":           indicatorName,
 							"dimensionValue": dimensionValue,
@@ -1830,7 +2611,11 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 
 					// add this to our SLI Indicator JSON in case we need to generate an SLI.yaml
 					// in that case we also need to mask it with USQL, TITLE_TYPE, DIMENSIONNAME
-					dashboardSLI.Indicators[indicatorName] = fmt.Sprintf("USQL;%s;%s;%s", tile.Type, dimensionName, tile.Query)
+					if valueColumn != "" {
+						dashboardSLI.Indicators[indicatorName] = fmt.Sprintf("USQL;%s;%s;%s%s;%s", tile.Type, dimensionName, USQLValueColumnPrefix, valueColumn, tile.Query)
+					} else {
+						dashboardSLI.Indicators[indicatorName] = fmt.Sprintf("USQL;%s;%s;%s", tile.Type, dimensionName, tile.Query)
+					}
 
 					// lets add the SLO definitin in case we need to generate an SLO.yaml
 					sloDefinition := &keptncommon.SLO{
@@ -1843,29 +2628,138 @@ func (ph *Handler) QueryDynatraceDashboardForSLIs(keptnEvent *common_sli.BaseKep
 					dashboardSLO.Objectives = append(dashboardSLO.Objectives, sloDefinition)
 				}
 			}
+			continue
 		}
+
+		tileResult.skip(tileReasonUnsupportedType)
 	}
 
+	finishTileReport(tileResults, len(sliResults))
+	ph.recordTileExecutedQueries(tileResults, sliResults)
+
 	return dashboardLinkAsLabel, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, nil
 }
 
+/**
+ * QueryDynatraceDashboardsForSLIs
+ * Same as QueryDynatraceDashboardForSLIs but processes all passed dashboards and merges their SLIs, SLOs and SLIResults into a single evaluation
+ * If an SLI is defined on several dashboards the definition of the first dashboard is used. The SLO scores and comparison are taken from the first dashboard
+ * Returns the dashboard links of all processed dashboards and the JSON of the first dashboard
+ */
+func (ph *Handler) QueryDynatraceDashboardsForSLIs(keptnEvent *common_sli.BaseKeptnEvent, dashboards []string, startUnix time.Time, endUnix time.Time) ([]string, *DynatraceDashboard, *SLI, *keptncommon.ServiceLevelObjectives, []*keptnv2.SLIResult, error) {
+	logger := logging.FromContext(ph.EventContext)
+	if len(dashboards) <= 1 {
+		dashboard := ""
+		if len(dashboards) == 1 {
+			dashboard = dashboards[0]
+		}
+		dashboardLinkAsLabel, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err := ph.QueryDynatraceDashboardForSLIs(keptnEvent, dashboard, startUnix, endUnix)
+		if dashboardLinkAsLabel == "" {
+			return nil, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err
+		}
+		return []string{dashboardLinkAsLabel}, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err
+	}
+
+	// the stored dashboard.json can only reflect one dashboard - therefore we always parse all dashboards
+	forceDashboardParsing := ph.ForceDashboardParsing
+	ph.ForceDashboardParsing = true
+	defer func() { ph.ForceDashboardParsing = forceDashboardParsing }()
+
+	var dashboardLinks []string
+	var firstDashboardJSON *DynatraceDashboard
+	var mergedSLI *SLI
+	var mergedSLO *keptncommon.ServiceLevelObjectives
+	var mergedSLIResults []*keptnv2.SLIResult
+
+	for _, dashboard := range dashboards {
+		dashboardLinkAsLabel, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err := ph.QueryDynatraceDashboardForSLIs(keptnEvent, dashboard, startUnix, endUnix)
+		if err != nil {
+			return dashboardLinks, firstDashboardJSON, mergedSLI, mergedSLO, mergedSLIResults, fmt.Errorf("could not process dashboard %s: %v", dashboard, err)
+		}
+		if dashboardJSON == nil {
+			logger.WithField("dashboard", dashboard).Info("No dashboard found, skipping it")
+			continue
+		}
+
+		dashboardLinks = append(dashboardLinks, dashboardLinkAsLabel)
+		if firstDashboardJSON == nil {
+			firstDashboardJSON = dashboardJSON
+			mergedSLI = dashboardSLI
+			mergedSLO = dashboardSLO
+			mergedSLIResults = sliResults
+			continue
+		}
+
+		mergedSLIResults = mergeDashboardSLIs(ph.EventContext, dashboardJSON.ID, mergedSLI, mergedSLO, mergedSLIResults, dashboardSLI, dashboardSLO, sliResults)
+	}
+
+	return dashboardLinks, firstDashboardJSON, mergedSLI, mergedSLO, mergedSLIResults, nil
+}
+
+/**
+ * Adds the SLIs, SLOs and SLIResults of a dashboard to the merged ones - SLIs that are already defined are skipped
+ * Returns the merged SLIResults
+ */
+func mergeDashboardSLIs(ctx context.Context, dashboardID string, mergedSLI *SLI, mergedSLO *keptncommon.ServiceLevelObjectives, mergedSLIResults []*keptnv2.SLIResult, dashboardSLI *SLI, dashboardSLO *keptncommon.ServiceLevelObjectives, sliResults []*keptnv2.SLIResult) []*keptnv2.SLIResult {
+	skippedIndicators := map[string]bool{}
+
+	if dashboardSLI != nil && mergedSLI != nil {
+		for indicatorName, query := range dashboardSLI.Indicators {
+			if _, exists := mergedSLI.Indicators[indicatorName]; exists {
+				logging.FromContext(ctx).WithFields(log.Fields{
+					"dashboard": dashboardID,
+					"indicator": indicatorName,
+				}).Warn("SLI is already defined on a previous dashboard, skipping it")
+				skippedIndicators[indicatorName] = true
+				continue
+			}
+			mergedSLI.Indicators[indicatorName] = query
+		}
+	}
+
+	if dashboardSLO != nil && mergedSLO != nil {
+		for _, objective := range dashboardSLO.Objectives {
+			if !skippedIndicators[objective.SLI] {
+				mergedSLO.Objectives = append(mergedSLO.Objectives, objective)
+			}
+		}
+	}
+
+	for _, sliResult := range sliResults {
+		if !skippedIndicators[sliResult.Metric] {
+			mergedSLIResults = append(mergedSLIResults, sliResult)
+		}
+	}
+
+	return mergedSLIResults
+}
+
 /**
  * GetSLIValue queries a single metric value from Dynatrace API
  * Can handle both Metric Queries as well as USQL
  */
 func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.Time) (float64, error) {
+	logger := logging.FromContext(ph.EventContext)
 
 	// first we get the query from the SLI configuration based on its logical name
 	metricsQuery, err := ph.getTimeseriesConfig(metric)
 	if err != nil {
 		return 0, fmt.Errorf("Error when fetching SLI config for %s %s.", metric, err.Error())
 	}
-	log.WithFields(
+	logger.WithFields(
 		log.Fields{
 			"metric": metric,
 			"query":  metricsQuery,
 		}).Debug("Retrieved SLI config")
 
+	// synthetic SLIs are translated into a regular metrics query
+	if strings.HasPrefix(metricsQuery, "SYNTHETIC;") {
+		metricsQuery, err = buildSyntheticMetricsQuery(metricsQuery)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	var (
 		metricIDExists    = false
 		actualMetricValue = 0.0
@@ -1874,15 +2768,19 @@ func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.
 	//
 	// USQL: lets check whether this is USQL or regular Metric Query
 	if strings.HasPrefix(metricsQuery, "USQL;") {
-		// In this case we need to parse USQL;TILE_TYPE;DIMENSION;QUERY
+		// In this case we need to parse USQL;TILE_TYPE;DIMENSION;QUERY or USQL;TILE_TYPE;DIMENSION;valueColumn=COLUMN;QUERY
 		querySplits := strings.Split(metricsQuery, ";")
-		if len(querySplits) != 4 {
+		if len(querySplits) != 4 && (len(querySplits) != 5 || !strings.HasPrefix(querySplits[3], USQLValueColumnPrefix)) {
 			return 0, fmt.Errorf("USQL Query incorrect format: %s", metricsQuery)
 		}
 
 		tileName := querySplits[1]
 		requestedDimensionName := querySplits[2]
-		usqlRawQuery := querySplits[3]
+		usqlRawQuery := querySplits[len(querySplits)-1]
+		valueColumn := ""
+		if len(querySplits) == 5 {
+			valueColumn = strings.TrimPrefix(querySplits[3], USQLValueColumnPrefix)
+		}
 
 		usql := ph.BuildDynatraceUSQLQuery(usqlRawQuery, startUnix, endUnix)
 		usqlResult, err := ph.ExecuteUSQLQuery(usql)
@@ -1891,23 +2789,15 @@ func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.
 			return 0, fmt.Errorf("Error executing USQL Query %v", err)
 		}
 
+		valueColumnIndex, err := getUSQLValueColumnIndex(tileName, usqlResult, valueColumn)
+		if err != nil {
+			return 0, err
+		}
+
 		for _, rowValue := range usqlResult.Values {
-			dimensionName := ""
-			dimensionValue := 0.0
-
-			if tileName == "SINGLE_VALUE" {
-				dimensionValue = rowValue[0].(float64)
-			} else if tileName == "PIE_CHART" {
-				dimensionName = rowValue[0].(string)
-				dimensionValue = rowValue[1].(float64)
-			} else if tileName == "COLUMN_CHART" {
-				dimensionName = rowValue[0].(string)
-				dimensionValue = rowValue[1].(float64)
-			} else if tileName == "TABLE" {
-				dimensionName = rowValue[0].(string)
-				dimensionValue = rowValue[len(rowValue)-1].(float64)
-			} else {
-				log.WithField("tileName", tileName).Debug("Unsupported USQL Tile Type")
+			dimensionName, dimensionValue, err := getUSQLDimensionAndValue(tileName, rowValue, valueColumnIndex)
+			if err != nil {
+				logger.WithError(err).WithField("tileName", tileName).Debug("Skipping USQL result row")
 				continue
 			}
 
@@ -1921,19 +2811,28 @@ func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.
 		// We query Dynatrace SLO Definitions
 	} else if strings.HasPrefix(metricsQuery, "SLO;") {
 		// we query a specific SLO
+		// optionally another value than the evaluated percentage can be requested, e.g: SLO;<SLID>;errorBudget
 		querySplits := strings.Split(metricsQuery, ";")
-		if len(querySplits) != 2 {
-			return 0, fmt.Errorf("SLO Indicator query has wrong format. Should be SLO;<SLID> but is: %s", metricsQuery)
+		if len(querySplits) != 2 && len(querySplits) != 3 {
+			return 0, fmt.Errorf("SLO Indicator query has wrong format. Should be SLO;<SLID>[;evaluatedPercentage|errorBudget|burnRate] but is: %s", metricsQuery)
+		}
+
+		sloID := ph.replaceQueryParameters(querySplits[1])
+		sloValueName := ""
+		if len(querySplits) == 3 {
+			sloValueName = querySplits[2]
 		}
 
-		sloID := querySplits[1]
 		sloResult, err := ph.ExecuteGetDynatraceSLO(sloID, startUnix, endUnix)
 		if err != nil {
 			return 0, fmt.Errorf("Error executing SLO Dynatrace Query %v", err)
 		}
 
+		actualMetricValue, err = sloResult.getValue(sloValueName)
+		if err != nil {
+			return 0, err
+		}
 		metricIDExists = true
-		actualMetricValue = sloResult.EvaluatedPercentage
 		//
 		// We query Dynatrace PRoblem APIv2 for number of problems
 	} else if strings.HasPrefix(metricsQuery, "PV2;") {
@@ -1943,7 +2842,7 @@ func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.
 			return 0, fmt.Errorf("Problemv2 Indicator query has wrong format. Should be PV2;entitySelectory=selector&problemSelector=selector but is: %s", metricsQuery)
 		}
 
-		problemQuery := querySplits[1]
+		problemQuery := ph.addManagementZoneFilter(buildProblemQuery(ph.replaceQueryParameters(querySplits[1])), "problemSelector")
 		problemQueryResult, err := ph.ExecuteGetDynatraceProblems(problemQuery, startUnix, endUnix)
 		if err != nil {
 			return 0, fmt.Errorf("Error executing Dynatrace Problem v2 Query %v", err)
@@ -1951,6 +2850,58 @@ func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.
 
 		metricIDExists = true
 		actualMetricValue = float64(problemQueryResult.TotalCount)
+	} else if strings.HasPrefix(metricsQuery, "ENTITYCOUNT;") {
+		// we query the number of entities, e.g: ENTITYCOUNT;entitySelector=type(HOST),healthState(UNHEALTHY)
+		querySplits := strings.Split(metricsQuery, ";")
+		if len(querySplits) != 2 || !strings.HasPrefix(querySplits[1], "entitySelector=") {
+			return 0, fmt.Errorf("Entity count Indicator query has wrong format. Should be ENTITYCOUNT;entitySelector=selector but is: %s", metricsQuery)
+		}
+
+		entityQuery := ph.addManagementZoneFilter(ph.replaceQueryParameters(querySplits[1]), "entitySelector")
+		entityQueryResult, err := ph.ExecuteGetDynatraceEntities(entityQuery, startUnix, endUnix)
+		if err != nil {
+			return 0, fmt.Errorf("Error executing Dynatrace Entities Query %v", err)
+		}
+
+		metricIDExists = true
+		actualMetricValue = float64(entityQueryResult.TotalCount)
+	} else if strings.HasPrefix(metricsQuery, "LOG;") {
+		// we query the number of log records matching a log query, e.g: LOG;query=status="ERROR"
+		logQuery := strings.TrimPrefix(metricsQuery, "LOG;")
+		if !strings.HasPrefix(logQuery, "query=") {
+			return 0, fmt.Errorf("Log Indicator query has wrong format. Should be LOG;query=<logquery> but is: %s", metricsQuery)
+		}
+		logQuery = strings.TrimPrefix(logQuery, "query=")
+
+		logCount, err := ph.ExecuteGetDynatraceLogCount(ph.replaceQueryParametersUnescaped(logQuery), startUnix, endUnix)
+		if err != nil {
+			return 0, fmt.Errorf("Error executing Dynatrace Log Query %v", err)
+		}
+
+		metricIDExists = true
+		actualMetricValue = logCount
+	} else if strings.HasPrefix(metricsQuery, "DQL;") {
+		// we query Grail via the Dynatrace Query Language, e.g: DQL;fetch logs | summarize count()
+		// or a record of a table result via DQL;TABLE;<dimension>;[valueColumn=<field>;]<query>
+		dqlQuery, err := ParseDQLIndicatorQuery(metricsQuery)
+		if err != nil {
+			return 0, err
+		}
+
+		dqlResult, err := ph.ExecuteDQLQuery(ph.replaceQueryParametersUnescaped(dqlQuery.Query), startUnix, endUnix)
+		if err != nil {
+			return 0, fmt.Errorf("Error executing DQL Query %v", err)
+		}
+
+		if dqlQuery.IsTable {
+			actualMetricValue, err = getTableValueFromDQLResult(dqlResult, ph.replaceQueryParametersUnescaped(dqlQuery.Dimension), dqlQuery.ValueColumn)
+		} else {
+			actualMetricValue, err = getSingleValueFromDQLResult(dqlResult)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("DQL Query %s returned an unexpected result: %v", dqlQuery.Query, err)
+		}
+		metricIDExists = true
 	} else if strings.HasPrefix(metricsQuery, "SECPV2;") {
 		// we query number of problems
 		querySplits := strings.Split(metricsQuery, ";")
@@ -1958,31 +2909,61 @@ func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.
 			return 0, fmt.Errorf("Security Problemv2 Indicator query has wrong format. Should be SECPV2;securityProblemSelector=selector but is: %s", metricsQuery)
 		}
 
-		problemQuery := querySplits[1]
-		problemQueryResult, err := ph.ExecuteGetDynatraceSecurityProblems(problemQuery, startUnix, endUnix)
+		problemQuery, valueType, err := buildSecurityProblemQuery(ph.replaceQueryParameters(querySplits[1]))
 		if err != nil {
-			return 0, fmt.Errorf("Error executing Dynatrace Security Problem v2 Query %v", err)
+			return 0, fmt.Errorf("Security Problemv2 Indicator query %s is invalid: %v", metricsQuery, err)
+		}
+		problemQuery = ph.addManagementZoneFilter(problemQuery, "securityProblemSelector")
+
+		if valueType == securityProblemValueRiskScore {
+			actualMetricValue, err = ph.ExecuteGetDynatraceSecurityProblemsRiskScore(problemQuery, startUnix, endUnix)
+			if err != nil {
+				return 0, fmt.Errorf("Error executing Dynatrace Security Problem v2 Query %v", err)
+			}
+		} else {
+			problemQueryResult, err := ph.ExecuteGetDynatraceSecurityProblems(problemQuery, startUnix, endUnix)
+			if err != nil {
+				return 0, fmt.Errorf("Error executing Dynatrace Security Problem v2 Query %v", err)
+			}
+			actualMetricValue = float64(problemQueryResult.TotalCount)
 		}
 
 		metricIDExists = true
-		actualMetricValue = float64(problemQueryResult.TotalCount)
 	} else {
 		metricUnit := ""
+		targetUnit := ""
+		settings := mv2QuerySettings{resolution: defaultMetricsResolution}
 
 		//
 		// lets first start to query for the MV2 prefix, e.g: MV2;byte;actualQuery
 		// if it starts with MV2 we extract metric unit and the actual query
+		// the unit can optionally contain a target unit, e.g: MV2;MicroSecond->MilliSecond;actualQuery
+		// and can optionally be followed by resolution and aggregation, e.g: MV2;MicroSecond;resolution=1m;agg=max;actualQuery
 		if strings.HasPrefix(metricsQuery, "MV2;") {
 			metricsQuery = metricsQuery[4:]
 			queryStartIndex := strings.Index(metricsQuery, ";")
-			metricUnit = metricsQuery[:queryStartIndex]
+			if queryStartIndex < 0 {
+				return 0, fmt.Errorf("MV2 Indicator query has wrong format. Should be MV2;<unit>;<query> but is: MV2;%s", metricsQuery)
+			}
+			metricUnit, targetUnit = parseMV2UnitDefinition(metricsQuery[:queryStartIndex])
 			metricsQuery = metricsQuery[queryStartIndex+1:]
+
+			var err error
+			settings, metricsQuery, err = parseMV2QuerySettings(metricsQuery)
+			if err != nil {
+				return 0, fmt.Errorf("MV2 indicator query %s is invalid: %v", metricsQuery, err)
+			}
+		}
+
+		// only queries with an entitySelector can be filtered by management zone as the entitySelector requires an entity type
+		if strings.Contains(metricsQuery, "entitySelector=") {
+			metricsQuery = ph.addManagementZoneFilter(metricsQuery, "entitySelector")
 		}
 
 		//
 		// In this case we are querying regular MEtrics
 		// now we are enriching it with all the additonal parameters, e.g: time, filters ...
-		metricsQuery, metricID, err := ph.BuildDynatraceMetricsQuery(metricsQuery, startUnix, endUnix)
+		metricsQuery, metricID, err := ph.buildDynatraceMetricsQueryWithResolution(metricsQuery, startUnix, endUnix, settings.resolution)
 		if err != nil {
 			return 0, err
 		}
@@ -2003,13 +2984,27 @@ func (ph *Handler) GetSLIValue(metric string, startUnix time.Time, endUnix time.
 						return 0, fmt.Errorf("Dynatrace Metrics API returned %d result values, expected 1 for query: %s.\nPlease ensure the response contains exactly one value (e.g., by using :merge(0):avg for the metric). Here is the output for troubleshooting: %s", len(i.Data), metricsQuery, string(jsonString))
 					}
 
-					actualMetricValue = i.Data[0].Values[0]
+					if len(i.Data[0].Values) == 0 {
+						return 0, fmt.Errorf("Dynatrace Metrics API returned no values for query: %s", metricsQuery)
+					}
+
+					if settings.hasOverrides() {
+						// a custom resolution can return several data points that are aggregated into one value
+						actualMetricValue = aggregateValues(i.Data[0].Values, settings.aggregation)
+					} else {
+						actualMetricValue = i.Data[0].Values[0]
+					}
 					break
 				}
 			}
 		}
 
-		actualMetricValue = scaleData(metricID, metricUnit, actualMetricValue)
+		// for queries without MV2 prefix we try to find out the unit from the metric definition
+		if metricUnit == "" && ph.DetectMetricUnits {
+			metricUnit = ph.detectMetricUnit(metricID)
+		}
+
+		actualMetricValue = ph.scaleValue(metricID, metricUnit, targetUnit, actualMetricValue)
 	}
 
 	if !metricIDExists {
@@ -2044,6 +3039,16 @@ func scaleData(metricID string, unit string, value float64) float64 {
 }
 
 func (ph *Handler) replaceQueryParameters(query string) string {
+	return common_sli.ReplaceKeptnPlaceholders(ph.EventContext, ph.replaceCustomFilters(query), ph.KeptnEvent)
+}
+
+// replaceQueryParametersUnescaped replaces the same placeholders as replaceQueryParameters but doesn't URL escape the values
+// it has to be used for queries that get escaped as a whole, e.g: USQL, log or DQL queries
+func (ph *Handler) replaceQueryParametersUnescaped(query string) string {
+	return common_sli.ReplaceKeptnPlaceholdersUnescaped(ph.EventContext, ph.replaceCustomFilters(query), ph.KeptnEvent)
+}
+
+func (ph *Handler) replaceCustomFilters(query string) string {
 	// apply customfilters
 	for _, filter := range ph.CustomFilters {
 		filter.Value = strings.Replace(filter.Value, "'", "", -1)
@@ -2060,18 +3065,17 @@ func (ph *Handler) replaceQueryParameters(query string) string {
 	query = strings.Replace(query, "$SERVICE", ph.Service, -1)
 	query = strings.Replace(query, "$DEPLOYMENT", ph.Deployment, -1)*/
 
-	query = common_sli.ReplaceKeptnPlaceholders(query, ph.KeptnEvent)
-
 	return query
 }
 
 // based on the requested metric a dynatrace timeseries with its aggregation type is returned
 func (ph *Handler) getTimeseriesConfig(metric string) (string, error) {
+	logger := logging.FromContext(ph.EventContext)
 	if val, ok := ph.CustomQueries[metric]; ok {
 		return val, nil
 	}
 
-	log.WithField("metric", metric).Debug("No custom SLI found - Looking in defaults")
+	logger.WithField("metric", metric).Debug("No custom SLI found - Looking in defaults")
 
 	// default SLI configs
 	// Switched to new metric v2 query language as discussed here: https://github.com/keptn-contrib/dynatrace-sli-service/issues/91
@@ -1,7 +1,9 @@
 package dynatrace
 
 import (
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/common_sli"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
 )
@@ -156,6 +159,126 @@ func TestGetSLIValueWithEmptyResult(t *testing.T) {
 	assert.EqualValues(t, 0.0, value)
 }
 
+// Tests GetSLIValue to retry the metrics query until data points are available
+func TestGetSLIValueWaitForData(t *testing.T) {
+
+	emptyResponse := `{
+		"totalCount": 0,
+		"nextPageKey": null,
+		"result": [
+			{
+				"metricId": "builtin:service.response.time:merge(0):percentile(50)",
+				"data": [
+					{
+						"dimensions": [],
+						"timestamps": [],
+						"values": []
+					}
+				]
+			}
+		]
+	}`
+
+	okResponse := `{
+		"totalCount": 1,
+		"nextPageKey": null,
+		"result": [
+			{
+				"metricId": "builtin:service.response.time:merge(0):percentile(50)",
+				"data": [
+					{
+						"dimensions": [],
+						"timestamps": [
+							1579097520000
+						],
+						"values": [
+							8433.40
+						]
+					}
+				]
+			}
+		]
+	}`
+
+	tests := []struct {
+		name           string
+		emptyResponses int
+		timeout        time.Duration
+		cancelled      bool
+		wantRequests   int
+		wantErr        bool
+		want           float64
+	}{
+		{
+			name:           "data available after retries",
+			emptyResponses: 2,
+			timeout:        time.Second,
+			wantRequests:   3,
+			want:           8.43340,
+		},
+		{
+			name:           "no retries without timeout",
+			emptyResponses: 2,
+			wantRequests:   1,
+			wantErr:        true,
+		},
+		{
+			name:           "timeout reached",
+			emptyResponses: 1000,
+			timeout:        50 * time.Millisecond,
+			wantErr:        true,
+		},
+		{
+			name:           "event processing cancelled",
+			emptyResponses: 2,
+			timeout:        time.Minute,
+			cancelled:      true,
+			wantRequests:   1,
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.emptyResponses {
+					w.Write([]byte(emptyResponse))
+					return
+				}
+				w.Write([]byte(okResponse))
+			})
+
+			httpClient, teardown := testingHTTPClient(h)
+			defer teardown()
+
+			dh := NewDynatraceHandler("http://dynatrace", &common_sli.BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}, nil, nil, "", "")
+			dh.HTTPClient = httpClient
+			dh.WaitForDataTimeout = tt.timeout
+			dh.WaitForDataInterval = 10 * time.Millisecond
+			dh.DetectMetricUnits = false
+			if tt.cancelled {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				dh.EventContext = ctx
+			}
+
+			value, err := dh.GetSLIValue(ResponseTimeP50, time.Unix(1571649084, 0).UTC(), time.Unix(1571649085, 0).UTC())
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.InDelta(t, tt.want, value, 0.001)
+			}
+			if tt.wantRequests > 0 {
+				assert.EqualValues(t, tt.wantRequests, requests)
+			}
+			assert.EqualValues(t, 1, len(dh.GetExecutedQueries()))
+		})
+	}
+}
+
 // Tests GetSLIValue without the expected metric in it
 func TestGetSLIValueWithoutExpectedMetric(t *testing.T) {
 
@@ -213,6 +336,332 @@ func runGetSLIValueTest(okResponse string) (float64, error) {
 	return dh.GetSLIValue(ResponseTimeP50, start, end)
 }
 
+// Tests GetSLIValue with a DQL query - including a query that has to be polled until it is finished
+func TestGetSLIValueWithDQLPrefix(t *testing.T) {
+	executeCalls := 0
+	pollCalls := 0
+	var executedQuery []byte
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Grail only accepts queries on the platform URL with a platform token
+		if r.Host != "abc12345.apps.dynatrace.com" || r.Header.Get("Authorization") != "Bearer my-platform-token" {
+			t.Errorf("DQL request to host %s with authorization %s, want abc12345.apps.dynatrace.com with Bearer my-platform-token", r.Host, r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "query:execute") {
+			executeCalls++
+			executedQuery, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"state": "RUNNING", "requestToken": "my-token"}`))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "query:poll") && r.URL.Query().Get("request-token") == "my-token" {
+			pollCalls++
+			if strings.Contains(string(executedQuery), "by:{loglevel}") {
+				w.Write([]byte(`{"state": "SUCCEEDED", "result": {"records": [{"loglevel": "WARN", "count()": "13"}, {"loglevel": "ERROR", "count()": "42"}]}}`))
+				return
+			}
+			w.Write([]byte(`{"state": "SUCCEEDED", "result": {"records": [{"count()": "42"}]}}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	keptnEvent := &common_sli.BaseKeptnEvent{}
+	keptnEvent.Project = "sockshop"
+	keptnEvent.Stage = "dev"
+	keptnEvent.Service = "carts"
+
+	dh := NewDynatraceHandler("http://dynatrace", keptnEvent, map[string]string{"Authorization": "Api-Token my-api-token"}, nil, "", "")
+	dh.HTTPClient = httpClient
+	dh.PlatformURL = "http://abc12345.apps.dynatrace.com"
+	dh.PlatformToken = "my-platform-token"
+	dh.CustomQueries = map[string]string{
+		"log_errors":       "DQL;fetch logs | filter loglevel == \"ERROR\" | summarize count()",
+		"log_errors_table": "DQL;TABLE;ERROR;fetch logs | summarize count(), by:{loglevel}",
+	}
+
+	start := time.Unix(1571649084, 0).UTC()
+	end := time.Unix(1571649085, 0).UTC()
+	value, err := dh.GetSLIValue("log_errors", start, end)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 42.0, value)
+	assert.Equal(t, 1, executeCalls)
+	assert.Equal(t, 1, pollCalls)
+
+	value, err = dh.GetSLIValue("log_errors_table", start, end)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 42.0, value)
+
+	// without platform credentials the query fails before anything is sent to the classic tenant URL
+	dh.PlatformURL = ""
+	dh.PlatformToken = ""
+	_, err = dh.GetSLIValue("log_errors", start, end)
+
+	assert.Error(t, err)
+	assert.Equal(t, 2, executeCalls)
+}
+
+// Tests GetSLIValue with a LOG query - the counts of all status groups are summed up
+func TestGetSLIValueWithLOGPrefix(t *testing.T) {
+	var receivedQuery string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/logs/aggregate" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		receivedQuery = r.URL.Query().Get("query")
+		w.Write([]byte(`{"aggregationResult": {"status": {"ERROR": 7, "WARN": 3}}}`))
+	})
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	keptnEvent := &common_sli.BaseKeptnEvent{}
+	keptnEvent.Project = "sockshop"
+	keptnEvent.Stage = "dev"
+	keptnEvent.Service = "carts"
+
+	dh := NewDynatraceHandler("http://dynatrace", keptnEvent, nil, nil, "", "")
+	dh.HTTPClient = httpClient
+	dh.CustomQueries = map[string]string{
+		"server_errors": "LOG;query=status>=500 AND dt.process.name=\"$SERVICE\"",
+		"wrong_format":  "LOG;status>=500",
+	}
+
+	start := time.Unix(1571649084, 0).UTC()
+	end := time.Unix(1571649085, 0).UTC()
+	value, err := dh.GetSLIValue("server_errors", start, end)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10.0, value)
+	assert.Equal(t, "status>=500 AND dt.process.name=\"carts\"", receivedQuery)
+
+	_, err = dh.GetSLIValue("wrong_format", start, end)
+	assert.Error(t, err)
+}
+
+// Tests GetSLIValue with an ENTITYCOUNT query returning the totalCount of the entities API
+func TestGetSLIValueWithENTITYCOUNTPrefix(t *testing.T) {
+	var receivedSelector string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/entities" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		receivedSelector = r.URL.Query().Get("entitySelector")
+		w.Write([]byte(`{"totalCount": 3, "pageSize": 1, "nextPageKey": "key", "entities": [{"entityId": "HOST-1"}]}`))
+	})
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	keptnEvent := &common_sli.BaseKeptnEvent{}
+	keptnEvent.Project = "sockshop"
+	keptnEvent.Stage = "dev"
+	keptnEvent.Service = "carts"
+
+	dh := NewDynatraceHandler("http://dynatrace", keptnEvent, nil, nil, "", "")
+	dh.HTTPClient = httpClient
+	dh.CustomQueries = map[string]string{
+		"unhealthy_hosts": "ENTITYCOUNT;entitySelector=type(HOST),healthState(UNHEALTHY),mzName(keptn_$PROJECT_$STAGE)",
+		"wrong_format":    "ENTITYCOUNT;type(HOST)",
+	}
+
+	start := time.Unix(1571649084, 0).UTC()
+	end := time.Unix(1571649085, 0).UTC()
+	value, err := dh.GetSLIValue("unhealthy_hosts", start, end)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3.0, value)
+	assert.Equal(t, "type(HOST),healthState(UNHEALTHY),mzName(keptn_sockshop_dev)", receivedSelector)
+
+	_, err = dh.GetSLIValue("wrong_format", start, end)
+	assert.Error(t, err)
+}
+
+// Tests GetSLIValue with a SECPV2 query returning the sum of the risk scores over all pages
+func TestGetSLIValueWithSECPV2RiskScore(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/securityProblems" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("nextPageKey") == "page2" {
+			w.Write([]byte(`{"totalCount": 2, "securityProblems": [{"riskAssessment": {"riskScore": {"value": 8.5}}}]}`))
+			return
+		}
+		if r.URL.Query().Get("securityProblemSelector") != `status(open),riskLevel("HIGH")` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"totalCount": 2, "nextPageKey": "page2", "securityProblems": [{"riskAssessment": {"riskScore": {"value": 7}}}]}`))
+	})
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	keptnEvent := &common_sli.BaseKeptnEvent{}
+	keptnEvent.Project = "sockshop"
+	keptnEvent.Stage = "dev"
+	keptnEvent.Service = "carts"
+
+	dh := NewDynatraceHandler("http://dynatrace", keptnEvent, nil, nil, "", "")
+	dh.HTTPClient = httpClient
+	dh.CustomQueries = map[string]string{
+		"security_risk": "SECPV2;securityProblemSelector=status(open)&riskLevel=HIGH&value=riskScore",
+	}
+
+	start := time.Unix(1571649084, 0).UTC()
+	end := time.Unix(1571649085, 0).UTC()
+	value, err := dh.GetSLIValue("security_risk", start, end)
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 15.5, value)
+}
+
+func TestGetSingleValueFromDQLResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   []map[string]interface{}
+		want      float64
+		wantError bool
+	}{
+		{name: "single numeric field", records: []map[string]interface{}{{"count()": 5.0}}, want: 5.0},
+		{name: "numeric string field", records: []map[string]interface{}{{"count()": "12"}}, want: 12.0},
+		{name: "non numeric fields are ignored", records: []map[string]interface{}{{"host": "a", "avg": 1.5}}, want: 1.5},
+		{name: "no records", records: []map[string]interface{}{}, wantError: true},
+		{name: "multiple records", records: []map[string]interface{}{{"c": 1.0}, {"c": 2.0}}, wantError: true},
+		{name: "multiple numeric fields", records: []map[string]interface{}{{"a": 1.0, "b": 2.0}}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getSingleValueFromDQLResult(&DQLQueryResult{Records: tt.records})
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.EqualValues(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseDQLIndicatorQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		metricsQuery string
+		want         *DQLIndicatorQuery
+		wantError    bool
+	}{
+		{
+			name:         "single value",
+			metricsQuery: "DQL;fetch logs | summarize count()",
+			want:         &DQLIndicatorQuery{Query: "fetch logs | summarize count()"},
+		},
+		{
+			name:         "table",
+			metricsQuery: "DQL;TABLE;ERROR;fetch logs | summarize count(), by:{loglevel}",
+			want:         &DQLIndicatorQuery{Query: "fetch logs | summarize count(), by:{loglevel}", IsTable: true, Dimension: "ERROR"},
+		},
+		{
+			name:         "table with value column",
+			metricsQuery: "DQL;TABLE;carts;valueColumn=avg(duration);fetch spans | summarize count(), avg(duration), by:{service.name}",
+			want:         &DQLIndicatorQuery{Query: "fetch spans | summarize count(), avg(duration), by:{service.name}", IsTable: true, Dimension: "carts", ValueColumn: "avg(duration)"},
+		},
+		{name: "no query", metricsQuery: "DQL;", wantError: true},
+		{name: "table without dimension", metricsQuery: "DQL;TABLE;;fetch logs | summarize count(), by:{loglevel}", wantError: true},
+		{name: "table without query", metricsQuery: "DQL;TABLE;ERROR", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDQLIndicatorQuery(tt.metricsQuery)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetTableValueFromDQLResult(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     string
+		dimension   string
+		valueColumn string
+		want        float64
+		wantError   bool
+	}{
+		{
+			name:      "dimension and value",
+			records:   `[{"loglevel": "WARN", "count()": 3}, {"loglevel": "ERROR", "count()": "7"}]`,
+			dimension: "ERROR",
+			want:      7,
+		},
+		{
+			name:      "multiple dimensions in the order of the fields",
+			records:   `[{"service.name": "carts", "loglevel": "ERROR", "count()": 4}, {"service.name": "orders", "loglevel": "ERROR", "count()": 2}]`,
+			dimension: "orders_ERROR",
+			want:      2,
+		},
+		{
+			name:        "value column",
+			records:     `[{"service.name": "carts", "count()": 120, "avg(duration)": 250.5}]`,
+			dimension:   "carts",
+			valueColumn: "AVG(duration)",
+			want:        250.5,
+		},
+		{
+			name:      "records without value are skipped",
+			records:   `[{"loglevel": "WARN", "count()": null}, {"loglevel": "ERROR", "count()": 1}]`,
+			dimension: "ERROR",
+			want:      1,
+		},
+		{
+			name:        "unknown value column",
+			records:     `[{"service.name": "carts", "count()": 120}]`,
+			dimension:   "carts",
+			valueColumn: "avg(duration)",
+			wantError:   true,
+		},
+		{
+			name:      "unknown dimension",
+			records:   `[{"loglevel": "WARN", "count()": 3}]`,
+			dimension: "ERROR",
+			wantError: true,
+		},
+		{
+			name:      "no dimension",
+			records:   `[{"count()": 3}]`,
+			dimension: "ERROR",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &DQLQueryResult{}
+			if err := json.Unmarshal([]byte(`{"records": `+tt.records+`}`), result); err != nil {
+				t.Fatalf("could not decode DQL result: %v", err)
+			}
+			got, err := getTableValueFromDQLResult(result, tt.dimension, tt.valueColumn)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.EqualValues(t, tt.want, got)
+		})
+	}
+}
+
 func TestGetSLIValueWithMV2Prefix(t *testing.T) {
 
 	metricsQuery := "MV2;Percent;metricSelector=builtin:host.cpu.usage:merge(0):avg:names&entitySelector=type(HOST)"
@@ -230,6 +679,84 @@ func TestGetSLIValueWithMV2Prefix(t *testing.T) {
 
 /*
 // Tests what happens if the end-time is in the future
+// Tests GetSLIValue with an MV2 query that overrides resolution and aggregation
+func TestGetSLIValueWithMV2ResolutionAndAggregation(t *testing.T) {
+
+	okResponse := `{
+		"totalCount": 1,
+		"nextPageKey": null,
+		"result": [
+			{
+				"metricId": "builtin:service.response.time:merge(0):avg",
+				"data": [
+					{
+						"dimensions": [],
+						"timestamps": [
+							1579097520000,
+							1579097580000,
+							1579097640000
+						],
+						"values": [
+							1000,
+							3000,
+							2000
+						]
+					}
+				]
+			}
+		]
+	}`
+
+	resolution := ""
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resolution = r.URL.Query().Get("resolution")
+		w.Write([]byte(okResponse))
+	})
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	dh := NewDynatraceHandler("http://dynatrace", &common_sli.BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}, nil, nil, "", "")
+	dh.HTTPClient = httpClient
+	dh.CustomQueries = map[string]string{
+		"rt_max": "MV2;MicroSecond;resolution=1m;agg=max;metricSelector=builtin:service.response.time:merge(0):avg&entitySelector=type(SERVICE)",
+	}
+
+	value, err := dh.GetSLIValue("rt_max", time.Unix(1571649084, 0).UTC(), time.Unix(1571649085, 0).UTC())
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, "1m", resolution)
+	assert.InDelta(t, 3.0, value, 0.001)
+}
+
+// Tests that a MV2 query without the actual query after the unit returns an error instead of panicking
+func TestGetSLIValueWithMV2PrefixWithoutQuery(t *testing.T) {
+	requests := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	dh := NewDynatraceHandler("http://dynatrace", &common_sli.BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}, nil, nil, "", "")
+	dh.HTTPClient = httpClient
+	dh.CustomQueries = map[string]string{
+		"unit_only": "MV2;MicroSecond",
+		"empty":     "MV2;",
+	}
+
+	for _, indicator := range []string{"unit_only", "empty"} {
+		value, err := dh.GetSLIValue(indicator, time.Unix(1571649084, 0).UTC(), time.Unix(1571649085, 0).UTC())
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "MV2 Indicator query has wrong format")
+		assert.EqualValues(t, 0.0, value)
+	}
+	assert.Equal(t, 0, requests)
+}
+
 func TestGetSLIEndTimeFuture(t *testing.T) {
 	keptnEvent := &common_sli.BaseKeptnEvent{}
 	keptnEvent.Project = "sockshop"
@@ -353,3 +880,25 @@ func TestGetSLIValueWithErrorResponse(t *testing.T) {
 	assert.EqualValues(t, 0.0, value)
 	assert.NotNil(t, err, nil)
 }
+
+func TestIngestSLIMetrics(t *testing.T) {
+	var receivedBody string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.EqualValues(t, "/api/v2/metrics/ingest", r.URL.Path)
+		assert.EqualValues(t, "text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		receivedBody = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	dh := NewDynatraceHandler("http://dynatrace", &common_sli.BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}, nil, nil, "", "")
+	dh.HTTPClient = httpClient
+
+	err := dh.IngestSLIMetrics([]*keptnv2.SLIResult{{Metric: "response_time_p95", Value: 312.5, Success: true}}, time.Unix(1579097520, 0))
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, `keptn.sli.response_time_p95,project="sockshop",stage="dev",service="carts" 312.5 1579097520000`, receivedBody)
+}
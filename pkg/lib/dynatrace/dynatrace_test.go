@@ -2,9 +2,11 @@ package dynatrace
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"reflect"
 	"strconv"
@@ -358,6 +360,275 @@ func TestQueryDynatraceDashboardForSLIs(t *testing.T) {
 	}
 }
 
+func TestQueryDynatraceDashboardsForSLIs(t *testing.T) {
+	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+	dh, _, _, teardown := testingGetDynatraceHandler(keptnEvent)
+	defer teardown()
+
+	startTime := time.Unix(1571649084, 0).UTC()
+	endTime := time.Unix(1571649085, 0).UTC()
+
+	// both entries resolve to the same dashboard, so the SLIs of the second one are all skipped as duplicates
+	dashboardLinks, dashboardJSON, dashboardSLI, dashboardSLO, sliResults, err := dh.QueryDynatraceDashboardsForSLIs(keptnEvent, []string{common_sli.DynatraceConfigDashboardQUERY, QUALITYGATE_DASHBOARD_ID}, startTime, endTime)
+
+	if err != nil {
+		t.Error(err)
+	}
+	if len(dashboardLinks) != 2 {
+		t.Errorf("Expected 2 dashboard links but got %d", len(dashboardLinks))
+	}
+	if dashboardJSON == nil {
+		t.Errorf("No Dashboard JSON returned")
+	}
+
+	expectedSLOs := 14
+	if dashboardSLI == nil || len(dashboardSLI.Indicators) != expectedSLOs {
+		t.Errorf("Expected %d SLIs to come back", expectedSLOs)
+	}
+	if dashboardSLO == nil || len(dashboardSLO.Objectives) != expectedSLOs {
+		t.Errorf("Expected %d SLOs to come back", expectedSLOs)
+	}
+	if len(sliResults) != expectedSLOs {
+		t.Errorf("Expected %d SLI Results to come back but got %d", expectedSLOs, len(sliResults))
+	}
+	if dh.ForceDashboardParsing {
+		t.Errorf("ForceDashboardParsing should be restored after processing multiple dashboards")
+	}
+}
+
+func TestQueryDynatraceDashboardForSLIsTileReport(t *testing.T) {
+	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+	dh, _, _, teardown := testingGetDynatraceHandler(keptnEvent)
+	defer teardown()
+
+	startTime := time.Unix(1571649084, 0).UTC()
+	endTime := time.Unix(1571649085, 0).UTC()
+	_, dashboardJSON, _, _, sliResults, err := dh.QueryDynatraceDashboardForSLIs(keptnEvent, common_sli.DynatraceConfigDashboardQUERY, startTime, endTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tileReport := dh.GetTileReport()
+	if len(tileReport) != len(dashboardJSON.Tiles) {
+		t.Errorf("Expected a report entry for each of the %d tiles but got %d", len(dashboardJSON.Tiles), len(tileReport))
+	}
+
+	slis := 0
+	for _, tileResult := range tileReport {
+		slis += tileResult.SLIs
+		if tileResult.DashboardID != dashboardJSON.ID {
+			t.Errorf("Unexpected dashboard ID %s for tile %s", tileResult.DashboardID, tileResult.TileName)
+		}
+		if !tileResult.Included && tileResult.Reason == "" {
+			t.Errorf("Tile %s was skipped without a reason", tileResult.TileName)
+		}
+		if tileResult.SLIs > 0 && !tileResult.Included {
+			t.Errorf("Tile %s produced SLIs but is not included", tileResult.TileName)
+		}
+	}
+	if slis != len(sliResults) {
+		t.Errorf("Expected the SLIs of all tiles to add up to %d but got %d", len(sliResults), slis)
+	}
+}
+
+func TestGetTileReportSummary(t *testing.T) {
+	tileResults := []*TileProcessingResult{
+		{TileName: "Services", TileType: "HEADER", firstSLIIndex: 0},
+		{TileName: "sli=rt_svc_p95;pass=<+10%", TileType: "CUSTOM_CHARTING", firstSLIIndex: 0},
+		{TileName: "Throughput", TileType: "CUSTOM_CHARTING", firstSLIIndex: 2},
+		{TileName: "sli=usql", TileType: "DTAQL", firstSLIIndex: 2},
+	}
+	tileResults[0].skip(tileReasonUnsupportedType)
+	tileResults[2].skip(tileReasonNoSLIName)
+	tileResults[3].addError(fmt.Errorf("USQL API request was not successful"))
+
+	finishTileReport(tileResults, 2)
+
+	if tileResults[1].SLIs != 2 || !tileResults[1].Included {
+		t.Errorf("Expected the custom chart to be included with 2 SLIs but got %d", tileResults[1].SLIs)
+	}
+	if tileResults[3].Included || tileResults[3].Reason != "query error: USQL API request was not successful" {
+		t.Errorf("Unexpected result for failed tile: %v", tileResults[3])
+	}
+
+	want := "Dashboard tiles: 1 included, 3 skipped (HEADER 'Services': unsupported tile type, CUSTOM_CHARTING 'Throughput': no sli=<name> in tile name, DTAQL 'sli=usql': query error: USQL API request was not successful)"
+	if got := GetTileReportSummary(tileResults); got != want {
+		t.Errorf("GetTileReportSummary() = %v, want %v", got, want)
+	}
+
+	if got := GetTileReportSummary(nil); got != "" {
+		t.Errorf("GetTileReportSummary() = %v, want an empty summary", got)
+	}
+}
+
+func TestRecordTileExecutedQueries(t *testing.T) {
+	ph := &Handler{}
+	sliResults := []*keptnv2.SLIResult{{Metric: "rt_svc_p95_carts"}, {Metric: "rt_svc_p95_orders"}, {Metric: "usql"}}
+
+	ph.executedQueries = []string{"metricsQuery"}
+	tileResults := []*TileProcessingResult{ph.startTileReport("db", "sli=rt_svc_p95", "CUSTOM_CHARTING", 0)}
+	ph.recordExecutedQuery("metricsQuery2")
+	tileResults = append(tileResults, ph.startTileReport("db", "Services", "HEADER", 2))
+	tileResults = append(tileResults, ph.startTileReport("db", "sli=usql", "DTAQL", 2))
+	ph.recordExecutedQuery("usqlQuery")
+
+	finishTileReport(tileResults, len(sliResults))
+	ph.recordTileExecutedQueries(tileResults, sliResults)
+
+	// an SLI that is already known from a previous dashboard keeps its queries
+	otherTileResults := []*TileProcessingResult{ph.startTileReport("other-db", "sli=usql", "DTAQL", 0)}
+	ph.recordExecutedQuery("otherUSQLQuery")
+	finishTileReport(otherTileResults, 1)
+	ph.recordTileExecutedQueries(otherTileResults, []*keptnv2.SLIResult{{Metric: "usql"}})
+
+	want := map[string][]string{
+		"rt_svc_p95_carts":  {"metricsQuery2"},
+		"rt_svc_p95_orders": {"metricsQuery2"},
+		"usql":              {"usqlQuery"},
+	}
+	if got := ph.GetDashboardExecutedQueries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetDashboardExecutedQueries() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeDashboardSLIs(t *testing.T) {
+	mergedSLI := &SLI{Indicators: map[string]string{"response_time": "MV2;MicroSecond;metricSelector=builtin:service.response.time"}}
+	mergedSLO := &keptn.ServiceLevelObjectives{Objectives: []*keptn.SLO{{SLI: "response_time"}}}
+	mergedSLIResults := []*keptnv2.SLIResult{{Metric: "response_time", Value: 1, Success: true}}
+
+	dashboardSLI := &SLI{Indicators: map[string]string{
+		"response_time": "MV2;MicroSecond;metricSelector=builtin:service.response.time:percentile(90)",
+		"host_cpu":      "MV2;Percent;metricSelector=builtin:host.cpu.usage",
+	}}
+	dashboardSLO := &keptn.ServiceLevelObjectives{Objectives: []*keptn.SLO{{SLI: "response_time"}, {SLI: "host_cpu"}}}
+	sliResults := []*keptnv2.SLIResult{{Metric: "response_time", Value: 2, Success: true}, {Metric: "host_cpu", Value: 3, Success: true}}
+
+	mergedSLIResults = mergeDashboardSLIs(context.TODO(), "infrastructure", mergedSLI, mergedSLO, mergedSLIResults, dashboardSLI, dashboardSLO, sliResults)
+
+	if len(mergedSLI.Indicators) != 2 || mergedSLI.Indicators["response_time"] != "MV2;MicroSecond;metricSelector=builtin:service.response.time" {
+		t.Errorf("Unexpected merged SLIs: %v", mergedSLI.Indicators)
+	}
+	if len(mergedSLO.Objectives) != 2 || mergedSLO.Objectives[1].SLI != "host_cpu" {
+		t.Errorf("Unexpected merged SLOs")
+	}
+	if len(mergedSLIResults) != 2 || mergedSLIResults[0].Value != 1 || mergedSLIResults[1].Value != 3 {
+		t.Errorf("Unexpected merged SLI results")
+	}
+}
+
+func TestHasDashboardChanged(t *testing.T) {
+	dashboardJSON := &DynatraceDashboard{ID: QUALITYGATE_DASHBOARD_ID}
+	dashboardJSON.DashboardMetadata.Name = "KQG.QueryBehavior=ParseOnChange"
+	jsonAsByteArray, _ := json.MarshalIndent(dashboardJSON, "", "  ")
+	existingDashboardContent := string(jsonAsByteArray)
+
+	tests := []struct {
+		name                  string
+		labels                map[string]string
+		forceDashboardParsing bool
+		existingContent       string
+		want                  bool
+	}{
+		{
+			name:            "unchanged dashboard",
+			existingContent: existingDashboardContent,
+			want:            false,
+		},
+		{
+			name:            "changed dashboard",
+			existingContent: "{}",
+			want:            true,
+		},
+		{
+			name:            "unchanged dashboard with parse=always label",
+			labels:          map[string]string{"parse": "always"},
+			existingContent: existingDashboardContent,
+			want:            true,
+		},
+		{
+			name:                  "unchanged dashboard with forced parsing",
+			forceDashboardParsing: true,
+			existingContent:       existingDashboardContent,
+			want:                  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+			keptnEvent.Labels = tt.labels
+			dh := NewDynatraceHandler("http://dynatrace", keptnEvent, nil, nil, "", "")
+			// like the get-sli handler, the label is evaluated when the handler is set up
+			dh.ForceDashboardParsing = tt.forceDashboardParsing || common_sli.IsDashboardParsingForced(nil, keptnEvent)
+
+			if got := dh.HasDashboardChanged(keptnEvent, dashboardJSON, tt.existingContent); got != tt.want {
+				t.Errorf("HasDashboardChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSLIDeepLink(t *testing.T) {
+	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+	dh := NewDynatraceHandler("https://mytenant.live.dynatrace.com", keptnEvent, nil, nil, "", "")
+	dh.CustomQueries = map[string]string{
+		"response_time": "MV2;MicroSecond;metricSelector=builtin:service.response.time:merge(0):avg&entitySelector=type(SERVICE),tag(keptn_project:$PROJECT)",
+		"problems":      "PV2;problemSelector=status(open)",
+	}
+
+	startTime := time.Unix(1571649084, 0).UTC()
+	endTime := time.Unix(1571649085, 0).UTC()
+
+	expectedLink := "https://mytenant.live.dynatrace.com/ui/data-explorer?gtf=c_1571649084000_1571649085000&entitySelector=type%28SERVICE%29%2Ctag%28keptn_project%3Aqualitygate%29&metricSelector=builtin%3Aservice.response.time%3Amerge%280%29%3Aavg"
+	if link := dh.GetSLIDeepLink("response_time", startTime, endTime); link != expectedLink {
+		t.Errorf("GetSLIDeepLink() = %s, want %s", link, expectedLink)
+	}
+
+	expectedLink = "https://mytenant.live.dynatrace.com/#problems;gtf=c_1571649084000_1571649085000"
+	if link := dh.GetSLIDeepLink("problems", startTime, endTime); link != expectedLink {
+		t.Errorf("GetSLIDeepLink() = %s, want %s", link, expectedLink)
+	}
+
+	if link := dh.GetSLIDeepLink("unknown_sli", startTime, endTime); link != "" {
+		t.Errorf("GetSLIDeepLink() should not return a link for an unknown SLI but returned %s", link)
+	}
+}
+
+func TestGetExecutedQueries(t *testing.T) {
+	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+	dh, _, url, teardown := testingGetDynatraceHandler(keptnEvent)
+	defer teardown()
+
+	dh.CustomQueries = map[string]string{
+		"rt_faster_500ms": "SLO;524ca177-849b-3e8c-8175-42b93fbc33c5",
+	}
+
+	startTime := time.Unix(1571649084, 0).UTC()
+	endTime := time.Unix(1571649085, 0).UTC()
+
+	dh.ResetExecutedQueries()
+	if _, err := dh.GetSLIValue("rt_faster_500ms", startTime, endTime); err != nil {
+		t.Error(err)
+	}
+
+	expectedQuery := url + "/api/v2/slo/524ca177-849b-3e8c-8175-42b93fbc33c5?from=1571649084000&to=1571649085000"
+	executedQueries := dh.GetExecutedQueries()
+	if len(executedQueries) != 1 || executedQueries[0] != expectedQuery {
+		t.Errorf("GetExecutedQueries() = %v, want [%s]", executedQueries, expectedQuery)
+	}
+
+	dh.ResetExecutedQueries()
+	if len(dh.GetExecutedQueries()) != 0 {
+		t.Errorf("ResetExecutedQueries() should clear the executed queries")
+	}
+
+	if message := AppendQueriesToMessage("failed", []string{"a", "b"}); message != "failed - Dynatrace query: a, b" {
+		t.Errorf("AppendQueriesToMessage() = %s", message)
+	}
+	if message := AppendQueriesToMessage("failed", nil); message != "failed" {
+		t.Errorf("AppendQueriesToMessage() = %s", message)
+	}
+}
+
 func TestExecuteGetDynatraceSLO(t *testing.T) {
 	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
 	dh, _, _, teardown := testingGetDynatraceHandler(keptnEvent)
@@ -400,13 +671,50 @@ func TestGetSLIValueWithSLOPrefix(t *testing.T) {
 	}
 }
 
+func TestGetSLIValueWithSLOValueSuffix(t *testing.T) {
+	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+	dh, _, _, teardown := testingGetDynatraceHandler(keptnEvent)
+	defer teardown()
+
+	dh.CustomQueries = map[string]string{
+		"slo_percentage":   "SLO;524ca177-849b-3e8c-8175-42b93fbc33c5;evaluatedPercentage",
+		"slo_error_budget": "SLO;524ca177-849b-3e8c-8175-42b93fbc33c5;errorBudget",
+		"slo_burn_rate":    "SLO;524ca177-849b-3e8c-8175-42b93fbc33c5;burnRate",
+		"slo_unknown":      "SLO;524ca177-849b-3e8c-8175-42b93fbc33c5;budget",
+	}
+
+	startTime := time.Unix(1571649084, 0).UTC()
+	endTime := time.Unix(1571649085, 0).UTC()
+
+	// the test SLO does not return a burn rate, so it is calculated from evaluatedPercentage and target
+	expectedValues := map[string]float64{
+		"slo_percentage":   95.66405076939219,
+		"slo_error_budget": -4.3159492306078135,
+		"slo_burn_rate":    (100 - 95.66405076939219) / (100 - 99.98),
+	}
+
+	for sli, expectedValue := range expectedValues {
+		value, err := dh.GetSLIValue(sli, startTime, endTime)
+		if err != nil {
+			t.Error(err)
+		}
+		if math.Abs(value-expectedValue) > 0.0001 {
+			t.Errorf("GetSLIValue(%s) = %f, want %f", sli, value, expectedValue)
+		}
+	}
+
+	if _, err := dh.GetSLIValue("slo_unknown", startTime, endTime); err == nil {
+		t.Errorf("GetSLIValue should return an error for an unsupported SLO value")
+	}
+}
+
 func TestGetCustomQueries(t *testing.T) {
 	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
 	keptncommon.NewLogger("test-context", "test-event", "dynatrace-service-testing")
 
 	common_sli.RunLocal = true
 
-	customQueries, err := common_sli.GetCustomQueries(keptnEvent)
+	customQueries, err := common_sli.GetCustomQueries(context.TODO(), keptnEvent)
 
 	if err != nil {
 		t.Error(err)
@@ -501,6 +809,164 @@ func TestGetSLIValueWithSECPV2Prefix(t *testing.T) {
 	}
 }
 
+func TestBuildSecurityProblemQuery(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		wantQuery     string
+		wantValueType string
+		wantError     bool
+	}{
+		{
+			name:          "query without risk filters",
+			query:         "securityProblemSelector=status(open)",
+			wantQuery:     "securityProblemSelector=status(open)",
+			wantValueType: securityProblemValueCount,
+		},
+		{
+			name:          "risk filters are added to the existing selector",
+			query:         "securityProblemSelector=status(open)&riskLevel=critical&minRiskScore=8&fields=+riskAssessment",
+			wantQuery:     "securityProblemSelector=status(open),riskLevel(\"CRITICAL\"),minRiskScore(\"8\")&fields=+riskAssessment",
+			wantValueType: securityProblemValueCount,
+		},
+		{
+			name:          "risk filters without selector",
+			query:         "minRiskScore=7.5&value=riskScore",
+			wantQuery:     "securityProblemSelector=minRiskScore(\"7.5\")",
+			wantValueType: securityProblemValueRiskScore,
+		},
+		{
+			name:      "invalid risk score",
+			query:     "minRiskScore=high",
+			wantError: true,
+		},
+		{
+			name:      "invalid value",
+			query:     "securityProblemSelector=status(open)&value=sum",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotValueType, err := buildSecurityProblemQuery(tt.query)
+			if (err != nil) != tt.wantError {
+				t.Errorf("buildSecurityProblemQuery() error = %v, wantError %v", err, tt.wantError)
+				return
+			}
+			if gotQuery != tt.wantQuery {
+				t.Errorf("buildSecurityProblemQuery() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			if gotValueType != tt.wantValueType {
+				t.Errorf("buildSecurityProblemQuery() gotValueType = %v, want %v", gotValueType, tt.wantValueType)
+			}
+		})
+	}
+}
+
+func TestBuildProblemQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "problemSelector=status(open)", want: "problemSelector=status(open)"},
+		{query: "problemSelector=status(open)&severityLevel=availability", want: "problemSelector=status(open),severityLevel(\"AVAILABILITY\")"},
+		{query: "entitySelector=type(SERVICE)&impactLevel=SERVICE", want: "entitySelector=type(SERVICE)&problemSelector=impactLevel(\"SERVICE\")"},
+	}
+	for _, tt := range tests {
+		if got := buildProblemQuery(tt.query); got != tt.want {
+			t.Errorf("buildProblemQuery(%s) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestProcessOpenProblemTileBreakdown(t *testing.T) {
+	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+	dh, _, _, teardown := testingGetDynatraceHandler(keptnEvent)
+	defer teardown()
+
+	startTime := time.Unix(1571649084, 0).UTC()
+	endTime := time.Unix(1571649085, 0).UTC()
+
+	sliResults, sliQueries, sloDefinitions, err := dh.ProcessOpenProblemTileBreakdown("severityLevel", "status(open)", "", startTime, endTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sliResults) != 5 || len(sliQueries) != 5 || len(sloDefinitions) != 5 {
+		t.Errorf("ProcessOpenProblemTileBreakdown should return 5 indicators but returned %d", len(sliResults))
+	}
+
+	expectedQuery := "PV2;problemSelector=status(open),severityLevel(\"RESOURCE_CONTENTION\")"
+	if sliQueries["problems_resource"] != expectedQuery {
+		t.Errorf("problems_resource query = %s, want %s", sliQueries["problems_resource"], expectedQuery)
+	}
+
+	if _, _, _, err := dh.ProcessOpenProblemTileBreakdown("status", "status(open)", "", startTime, endTime); err == nil {
+		t.Errorf("ProcessOpenProblemTileBreakdown should return an error for an unsupported breakdown")
+	}
+}
+
+func TestGetUSQLDimensionAndValue(t *testing.T) {
+	tests := []struct {
+		name          string
+		tileType      string
+		rowValue      []interface{}
+		wantDimension string
+		wantValue     float64
+		valueColumn   int
+		wantError     bool
+	}{
+		{name: "single value", tileType: "SINGLE_VALUE", rowValue: []interface{}{12.5}, valueColumn: -1, wantValue: 12.5},
+		{name: "pie chart", tileType: "PIE_CHART", rowValue: []interface{}{"Chrome", 3.0}, valueColumn: -1, wantDimension: "Chrome", wantValue: 3.0},
+		{name: "pie chart uses second column as value", tileType: "PIE_CHART", rowValue: []interface{}{"Chrome", 3.0, 250.0}, valueColumn: -1, wantDimension: "Chrome", wantValue: 3.0},
+		{name: "column chart", tileType: "COLUMN_CHART", rowValue: []interface{}{"Chrome", 3.0}, valueColumn: -1, wantDimension: "Chrome", wantValue: 3.0},
+		{name: "column chart uses second column as value", tileType: "COLUMN_CHART", rowValue: []interface{}{"Chrome", 3.0, 250.0}, valueColumn: -1, wantDimension: "Chrome", wantValue: 3.0},
+		{name: "column chart with second dimension", tileType: "COLUMN_CHART", rowValue: []interface{}{"usa", "Chrome", 3.0}, valueColumn: -1, wantError: true},
+		{name: "single value uses first column", tileType: "SINGLE_VALUE", rowValue: []interface{}{12.5, 3.0}, valueColumn: -1, wantValue: 12.5},
+		{name: "table uses leading text columns as dimensions", tileType: "TABLE", rowValue: []interface{}{"usa", "Chrome", 10.0, 250.0}, valueColumn: -1, wantDimension: "usa_Chrome", wantValue: 250.0},
+		{name: "table without dimension", tileType: "TABLE", rowValue: []interface{}{10.0, 250.0}, valueColumn: -1, wantError: true},
+		{name: "value is not a number", tileType: "PIE_CHART", rowValue: []interface{}{"Chrome", "3"}, valueColumn: -1, wantError: true},
+		{name: "table with value column", tileType: "TABLE", rowValue: []interface{}{"usa", 10.0, 250.0}, valueColumn: 1, wantDimension: "usa", wantValue: 10.0},
+		{name: "value column is a dimension", tileType: "TABLE", rowValue: []interface{}{"usa", 10.0}, valueColumn: 0, wantError: true},
+		{name: "unsupported tile type", tileType: "LINE_CHART", rowValue: []interface{}{"Chrome", 3.0}, valueColumn: -1, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDimension, gotValue, err := getUSQLDimensionAndValue(tt.tileType, tt.rowValue, tt.valueColumn)
+			if (err != nil) != tt.wantError {
+				t.Errorf("getUSQLDimensionAndValue() error = %v, wantError %v", err, tt.wantError)
+				return
+			}
+			if gotDimension != tt.wantDimension {
+				t.Errorf("getUSQLDimensionAndValue() gotDimension = %v, want %v", gotDimension, tt.wantDimension)
+			}
+			if gotValue != tt.wantValue {
+				t.Errorf("getUSQLDimensionAndValue() gotValue = %v, want %v", gotValue, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestGetUSQLValueColumnIndex(t *testing.T) {
+	usqlResult := &DTUSQLResult{ColumnNames: []string{"city", "count(*)", "AVG(duration)"}}
+
+	if index, err := getUSQLValueColumnIndex("TABLE", usqlResult, ""); err != nil || index != -1 {
+		t.Errorf("getUSQLValueColumnIndex() without value column = %d, %v; want -1", index, err)
+	}
+	if index, err := getUSQLValueColumnIndex("TABLE", usqlResult, "avg(duration)"); err != nil || index != 2 {
+		t.Errorf("getUSQLValueColumnIndex() = %d, %v; want 2", index, err)
+	}
+	if _, err := getUSQLValueColumnIndex("TABLE", usqlResult, "max(duration)"); err == nil {
+		t.Errorf("getUSQLValueColumnIndex() should return an error for an unknown column")
+	}
+	if index, err := getUSQLValueColumnIndex("PIE_CHART", usqlResult, ""); err != nil || index != -1 {
+		t.Errorf("getUSQLValueColumnIndex() of pie chart without value column = %d, %v; want -1", index, err)
+	}
+	if _, err := getUSQLValueColumnIndex("COLUMN_CHART", usqlResult, "avg(duration)"); err == nil {
+		t.Errorf("getUSQLValueColumnIndex() should return an error for a value column of a column chart")
+	}
+}
+
 func TestCreateNewDynatraceHandler(t *testing.T) {
 	keptnEvent := testingGetKeptnEvent("sockshop", "dev", "carts", "direct", "")
 	dh, _, url, teardown := testingGetDynatraceHandler(keptnEvent)
@@ -726,6 +1192,151 @@ func TestScaleData(t *testing.T) {
 	}
 }
 
+func TestScaleDataToUnit(t *testing.T) {
+	tests := []struct {
+		name       string
+		metricID   string
+		unit       string
+		targetUnit string
+		value      float64
+		want       float64
+	}{
+		{name: "no target unit falls back to default scaling", unit: "MicroSecond", value: 1000000.0, want: 1000.0},
+		{name: "microseconds to seconds", unit: "MicroSecond", targetUnit: "Second", value: 2000000.0, want: 2.0},
+		{name: "microseconds to microseconds", unit: "MicroSecond", targetUnit: "us", value: 2000000.0, want: 2000000.0},
+		{name: "nanoseconds to ms", unit: "NanoSecond", targetUnit: "ms", value: 5000000.0, want: 5.0},
+		{name: "bytes to megabytes", unit: "Byte", targetUnit: "MB", value: 1024 * 1024 * 3, want: 3.0},
+		{name: "incompatible units fall back to default scaling", unit: "Byte", targetUnit: "ms", value: 1024.0, want: 1.0},
+		{name: "unknown unit falls back to default scaling", unit: "Percent", targetUnit: "ms", value: 50.0, want: 50.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scaleDataToUnit(context.TODO(), tt.metricID, tt.unit, tt.targetUnit, tt.value); got != tt.want {
+				t.Errorf("scaleDataToUnit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleValueWithUnitScalingRules(t *testing.T) {
+	dh := NewDynatraceHandler("http://dynatrace", nil, nil, nil, "", "")
+	dh.UnitScalingRules = []common_sli.UnitScalingRule{
+		{Unit: "NanoSecond", TargetUnit: "MilliSecond"},
+		{Unit: "Byte", TargetUnit: "MegaByte"},
+		{Unit: "Count", Factor: 0.001},
+		{Unit: "MicroSecond"},
+	}
+
+	tests := []struct {
+		name       string
+		metricID   string
+		unit       string
+		targetUnit string
+		value      float64
+		want       float64
+	}{
+		{name: "nanoseconds rule", unit: "NanoSecond", value: 3000000.0, want: 3.0},
+		{name: "bytes rule", unit: "Byte", value: 1024 * 1024, want: 1.0},
+		{name: "count rule with factor", unit: "Count", value: 2000.0, want: 2.0},
+		{name: "rule without conversion keeps microseconds", unit: "MicroSecond", value: 1000.0, want: 1000.0},
+		{name: "target unit wins over rule", unit: "Byte", targetUnit: "KiloByte", value: 2048.0, want: 2.0},
+		{name: "no rule uses default scaling", metricID: "builtin:service.response.time", value: 1000.0, want: 1.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dh.scaleValue(tt.metricID, tt.unit, tt.targetUnit, tt.value); got != tt.want {
+				t.Errorf("scaleValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMetricKeyFromSelector(t *testing.T) {
+	tests := []struct {
+		metricSelector string
+		want           string
+	}{
+		{metricSelector: "builtin:service.response.time:merge(0):percentile(90)", want: "builtin:service.response.time"},
+		{metricSelector: "builtin:host.cpu.usage:merge(0):avg:names", want: "builtin:host.cpu.usage"},
+		{metricSelector: "jmeter.usermetrics.transaction.meantime:avg", want: "jmeter.usermetrics.transaction.meantime"},
+		{metricSelector: "calc:service.teststepresponsetime", want: "calc:service.teststepresponsetime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metricSelector, func(t *testing.T) {
+			if got := getMetricKeyFromSelector(tt.metricSelector); got != tt.want {
+				t.Errorf("getMetricKeyFromSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectMetricUnit(t *testing.T) {
+	keptnEvent := testingGetKeptnEvent(QUALITYGATE_PROJECT, QUALITYGATE_STAGE, QUALTIYGATE_SERVICE, "", "")
+	dh, _, _, teardown := testingGetDynatraceHandler(keptnEvent)
+	defer teardown()
+
+	if unit := dh.detectMetricUnit("builtin:service.response.time:merge(0):avg"); unit != "MicroSecond" {
+		t.Errorf("detectMetricUnit returned %s instead of MicroSecond", unit)
+	}
+
+	if unit := dh.detectMetricUnit("builtin:unknown.metric:avg"); unit != "" {
+		t.Errorf("detectMetricUnit returned %s for an unknown metric", unit)
+	}
+}
+
+func TestDetectMetricUnit_DescribesMetricOnce(t *testing.T) {
+	describeRequests := map[string]int{}
+	httpClient, teardown := testingHTTPClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		describeRequests[r.URL.Path]++
+		if r.URL.Path != "/api/v2/metrics/builtin:service.response.time" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"metricId": "builtin:service.response.time", "unit": "MicroSecond"}`))
+	}))
+	defer teardown()
+
+	dh := NewDynatraceHandler("http://dynatrace", &common_sli.BaseKeptnEvent{Project: "sockshop", Stage: "dev", Service: "carts"}, nil, nil, "", "")
+	dh.HTTPClient = httpClient
+
+	for _, metricSelector := range []string{"builtin:service.response.time:merge(0):avg", "builtin:service.response.time:merge(0):percentile(90)", "builtin:unknown.metric:avg", "builtin:unknown.metric:max"} {
+		dh.detectMetricUnit(metricSelector)
+	}
+	if unit := dh.detectMetricUnit("builtin:service.response.time:avg"); unit != "MicroSecond" {
+		t.Errorf("detectMetricUnit returned %s instead of MicroSecond", unit)
+	}
+
+	for path, requests := range describeRequests {
+		if requests != 1 {
+			t.Errorf("detectMetricUnit requested %s %d times, want 1", path, requests)
+		}
+	}
+	if len(describeRequests) != 2 {
+		t.Errorf("detectMetricUnit requested %v, want the definitions of both metrics", describeRequests)
+	}
+}
+
+func TestParseMV2UnitDefinition(t *testing.T) {
+	unit, targetUnit := parseMV2UnitDefinition("MicroSecond->MilliSecond")
+	if unit != "MicroSecond" || targetUnit != "MilliSecond" {
+		t.Errorf("parseMV2UnitDefinition returned %s and %s", unit, targetUnit)
+	}
+
+	unit, targetUnit = parseMV2UnitDefinition("Byte")
+	if unit != "Byte" || targetUnit != "" {
+		t.Errorf("parseMV2UnitDefinition returned %s and %s", unit, targetUnit)
+	}
+}
+
+func TestParseTargetUnitFromString(t *testing.T) {
+	if unit := common_sli.ParseTargetUnitFromString("Response time;sli=rt;unit=ms;pass=<600"); unit != "ms" {
+		t.Errorf("ParseTargetUnitFromString returned %s instead of ms", unit)
+	}
+	if unit := common_sli.ParseTargetUnitFromString("Response time;sli=rt;pass=<600"); unit != "" {
+		t.Errorf("ParseTargetUnitFromString returned %s instead of an empty unit", unit)
+	}
+}
+
 func TestParsePassAndWarningFromString(t *testing.T) {
 	type args struct {
 		customName string
@@ -880,3 +1491,219 @@ func TestParseMarkdownConfiguration(t *testing.T) {
 	}
 
 }
+
+func TestBuildSyntheticMetricsQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		want      string
+		wantError bool
+	}{
+		{
+			name:  "browser monitor availability",
+			query: "SYNTHETIC;SYNTHETIC_TEST-1234",
+			want:  "MV2;Percent;metricSelector=builtin:synthetic.browser.availability.location.total:splitBy():avg&entitySelector=type(SYNTHETIC_TEST),entityId(SYNTHETIC_TEST-1234)",
+		},
+		{
+			name:  "http monitor performance",
+			query: "SYNTHETIC;HTTP_CHECK-1234;performance",
+			want:  "MV2;MilliSecond;metricSelector=builtin:synthetic.http.duration.geo:splitBy():avg&entitySelector=type(HTTP_CHECK),entityId(HTTP_CHECK-1234)",
+		},
+		{
+			name:  "tagged monitors for a single location",
+			query: "SYNTHETIC;app:carts;availability;SYNTHETIC_LOCATION-0001",
+			want:  "MV2;Percent;metricSelector=builtin:synthetic.browser.availability.location.total:filter(eq(\"dt.entity.synthetic_location\",\"SYNTHETIC_LOCATION-0001\")):splitBy():avg&entitySelector=type(SYNTHETIC_TEST),tag(app:carts)",
+		},
+		{
+			name:  "selector condition",
+			query: "SYNTHETIC;mzName(keptn_$PROJECT)",
+			want:  "MV2;Percent;metricSelector=builtin:synthetic.browser.availability.location.total:splitBy():avg&entitySelector=type(SYNTHETIC_TEST),mzName(keptn_$PROJECT)",
+		},
+		{
+			name:      "missing monitor",
+			query:     "SYNTHETIC;",
+			wantError: true,
+		},
+		{
+			name:      "unknown sli type",
+			query:     "SYNTHETIC;SYNTHETIC_TEST-1234;uptime",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildSyntheticMetricsQuery(tt.query)
+			if (err != nil) != tt.wantError {
+				t.Errorf("buildSyntheticMetricsQuery() error = %v, wantError %v", err, tt.wantError)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("buildSyntheticMetricsQuery() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMV2QuerySettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		want      mv2QuerySettings
+		wantQuery string
+		wantError bool
+	}{
+		{
+			name:      "no settings",
+			query:     "metricSelector=builtin:service.response.time:merge(0):avg&entitySelector=type(SERVICE)",
+			want:      mv2QuerySettings{resolution: "Inf"},
+			wantQuery: "metricSelector=builtin:service.response.time:merge(0):avg&entitySelector=type(SERVICE)",
+		},
+		{
+			name:      "resolution and aggregation",
+			query:     "resolution=1m;agg=max;metricSelector=builtin:service.response.time:merge(0):avg",
+			want:      mv2QuerySettings{resolution: "1m", aggregation: "max"},
+			wantQuery: "metricSelector=builtin:service.response.time:merge(0):avg",
+		},
+		{
+			name:      "aggregation only",
+			query:     "agg=MIN;metricSelector=builtin:service.response.time:merge(0):avg",
+			want:      mv2QuerySettings{resolution: "Inf", aggregation: "min"},
+			wantQuery: "metricSelector=builtin:service.response.time:merge(0):avg",
+		},
+		{
+			name:      "query with semicolon",
+			query:     "metricSelector=builtin:service.response.time:filter(eq(\"a\",\"b;c\"))",
+			want:      mv2QuerySettings{resolution: "Inf"},
+			wantQuery: "metricSelector=builtin:service.response.time:filter(eq(\"a\",\"b;c\"))",
+		},
+		{
+			name:      "unsupported aggregation",
+			query:     "agg=p90;metricSelector=builtin:service.response.time:merge(0):avg",
+			wantError: true,
+		},
+		{
+			name:      "empty resolution",
+			query:     "resolution=;metricSelector=builtin:service.response.time:merge(0):avg",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotQuery, err := parseMV2QuerySettings(tt.query)
+			if (err != nil) != tt.wantError {
+				t.Errorf("parseMV2QuerySettings() error = %v, wantError %v", err, tt.wantError)
+				return
+			}
+			if tt.wantError {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseMV2QuerySettings() got = %v, want %v", got, tt.want)
+			}
+			if gotQuery != tt.wantQuery {
+				t.Errorf("parseMV2QuerySettings() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestAggregateValues(t *testing.T) {
+	values := []float64{4, 1, 7, 2}
+
+	tests := []struct {
+		aggregation string
+		want        float64
+	}{
+		{aggregation: "", want: 3.5},
+		{aggregation: "avg", want: 3.5},
+		{aggregation: "min", want: 1},
+		{aggregation: "max", want: 7},
+		{aggregation: "sum", want: 14},
+		{aggregation: "count", want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.aggregation, func(t *testing.T) {
+			if got := aggregateValues(values, tt.aggregation); got != tt.want {
+				t.Errorf("aggregateValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddManagementZoneFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		managementZone string
+		query          string
+		selectorName   string
+		want           string
+	}{
+		{
+			name:         "no management zone configured",
+			query:        "metricSelector=builtin:service.requestCount.total:merge(0):count&entitySelector=type(SERVICE)",
+			selectorName: "entitySelector",
+			want:         "metricSelector=builtin:service.requestCount.total:merge(0):count&entitySelector=type(SERVICE)",
+		},
+		{
+			name:           "entity selector with management zone id",
+			managementZone: "-1234567",
+			query:          "metricSelector=builtin:service.requestCount.total:merge(0):count&entitySelector=type(SERVICE)",
+			selectorName:   "entitySelector",
+			want:           "metricSelector=builtin:service.requestCount.total:merge(0):count&entitySelector=type(SERVICE),mzId(-1234567)",
+		},
+		{
+			name:           "entity selector with management zone name",
+			managementZone: "keptn sockshop",
+			query:          "entitySelector=type(HOST)",
+			selectorName:   "entitySelector",
+			want:           "entitySelector=type(HOST),mzName(\"keptn+sockshop\")",
+		},
+		{
+			name:           "problem selector is added",
+			managementZone: "1234",
+			query:          "entitySelector=type(SERVICE)",
+			selectorName:   "problemSelector",
+			want:           "entitySelector=type(SERVICE)&problemSelector=managementZoneIds(1234)",
+		},
+		{
+			name:           "security problem selector with management zone name",
+			managementZone: "sockshop",
+			query:          "securityProblemSelector=status(\"OPEN\")",
+			selectorName:   "securityProblemSelector",
+			want:           "securityProblemSelector=status(\"OPEN\"),managementZones(\"sockshop\")",
+		},
+		{
+			name:           "selector already filtered by management zone",
+			managementZone: "1234",
+			query:          "entitySelector=type(SERVICE),mzName(\"other\")",
+			selectorName:   "entitySelector",
+			want:           "entitySelector=type(SERVICE),mzName(\"other\")",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ph := &Handler{ManagementZone: tt.managementZone}
+			if got := ph.addManagementZoneFilter(tt.query, tt.selectorName); got != tt.want {
+				t.Errorf("addManagementZoneFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSLIMetricLines(t *testing.T) {
+	sliResults := []*keptnv2.SLIResult{
+		{Metric: "response_time_p95", Value: 312.5, Success: true},
+		{Metric: "error rate", Value: 0.01, Success: true},
+		{Metric: "throughput", Value: 0, Success: false},
+	}
+
+	got := buildSLIMetricLines("sockshop", "staging", "carts \"v2\"", sliResults, time.Unix(1579097520, 0))
+	want := []string{
+		`keptn.sli.response_time_p95,project="sockshop",stage="staging",service="carts \"v2\"" 312.5 1579097520000`,
+		`keptn.sli.error_rate,project="sockshop",stage="staging",service="carts \"v2\"" 0.01 1579097520000`,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildSLIMetricLines() = %v, want %v", got, want)
+	}
+}
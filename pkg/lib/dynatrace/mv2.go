@@ -0,0 +1,103 @@
+package dynatrace
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const mv2SettingResolution = "resolution="
+const mv2SettingAggregation = "agg="
+
+// default resolution of metric queries - resolution=Inf means that we only get 1 datapoint (per service)
+const defaultMetricsResolution = "Inf"
+
+const mv2AggregationMin = "min"
+const mv2AggregationMax = "max"
+const mv2AggregationAvg = "avg"
+const mv2AggregationSum = "sum"
+const mv2AggregationCount = "count"
+
+// mv2QuerySettings are the optional settings of an MV2 query, e.g: MV2;MicroSecond;resolution=1m;agg=max;metricSelector=...
+type mv2QuerySettings struct {
+	resolution  string
+	aggregation string
+}
+
+// hasOverrides returns true if the MV2 query deviates from the default resolution
+func (s mv2QuerySettings) hasOverrides() bool {
+	return s.resolution != defaultMetricsResolution || s.aggregation != ""
+}
+
+/**
+ * Splits the optional resolution and aggregation settings from the query part of an MV2 query
+ * e.g: resolution=1m;agg=max;metricSelector=... returns the settings 1m and max and the query metricSelector=...
+ * Returns an error if an unsupported aggregation is specified
+ */
+func parseMV2QuerySettings(query string) (mv2QuerySettings, string, error) {
+	settings := mv2QuerySettings{resolution: defaultMetricsResolution}
+
+	for {
+		separatorIndex := strings.Index(query, ";")
+		if separatorIndex < 0 {
+			break
+		}
+
+		setting := query[:separatorIndex]
+		if strings.HasPrefix(setting, mv2SettingResolution) {
+			settings.resolution = strings.TrimPrefix(setting, mv2SettingResolution)
+		} else if strings.HasPrefix(setting, mv2SettingAggregation) {
+			settings.aggregation = strings.ToLower(strings.TrimPrefix(setting, mv2SettingAggregation))
+		} else {
+			break
+		}
+		query = query[separatorIndex+1:]
+	}
+
+	if settings.resolution == "" {
+		return settings, query, fmt.Errorf("MV2 resolution must not be empty")
+	}
+
+	switch settings.aggregation {
+	case "", mv2AggregationMin, mv2AggregationMax, mv2AggregationAvg, mv2AggregationSum, mv2AggregationCount:
+		return settings, query, nil
+	default:
+		return settings, query, fmt.Errorf("unsupported MV2 aggregation %s, expected one of min, max, avg, sum or count", settings.aggregation)
+	}
+}
+
+/**
+ * Aggregates the data points of a metric into a single value, e.g: the max of all values of resolution=1m
+ * Without an aggregation the average of the values is returned
+ */
+func aggregateValues(values []float64, aggregation string) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	switch aggregation {
+	case mv2AggregationMin:
+		min := math.Inf(1)
+		for _, value := range values {
+			min = math.Min(min, value)
+		}
+		return min
+	case mv2AggregationMax:
+		max := math.Inf(-1)
+		for _, value := range values {
+			max = math.Max(max, value)
+		}
+		return max
+	case mv2AggregationCount:
+		return float64(len(values))
+	}
+
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	if aggregation == mv2AggregationSum {
+		return sum
+	}
+	return sum / float64(len(values))
+}
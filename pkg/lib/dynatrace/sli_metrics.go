@@ -0,0 +1,76 @@
+package dynatrace
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const sliMetricPrefix = "keptn.sli."
+
+// characters that are not allowed in metric keys of the Dynatrace Metrics Ingest API
+var invalidMetricKeyCharacters = regexp.MustCompile(`[^a-zA-Z0-9_.\-]`)
+
+/**
+ * Returns the metric key an SLI is ingested with, e.g: response_time_p95 becomes keptn.sli.response_time_p95
+ * Characters that are not allowed in metric keys are replaced with _
+ */
+func getSLIMetricKey(indicator string) string {
+	return sliMetricPrefix + invalidMetricKeyCharacters.ReplaceAllString(indicator, "_")
+}
+
+// escapes a dimension value of the metric ingest line protocol
+func escapeDimensionValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+/**
+ * Builds the lines of the metric ingest line protocol for all successfully retrieved SLIResults, e.g:
+ * keptn.sli.response_time_p95,project="sockshop",stage="staging",service="carts" 312.5 1579097520000
+ */
+func buildSLIMetricLines(project string, stage string, service string, sliResults []*keptnv2.SLIResult, timestamp time.Time) []string {
+	dimensions := fmt.Sprintf("project=%s,stage=%s,service=%s", escapeDimensionValue(project), escapeDimensionValue(stage), escapeDimensionValue(service))
+
+	var lines []string
+	for _, sliResult := range sliResults {
+		if !sliResult.Success {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s,%s %s %d",
+			getSLIMetricKey(sliResult.Metric),
+			dimensions,
+			strconv.FormatFloat(sliResult.Value, 'f', -1, 64),
+			timestamp.UnixNano()/int64(time.Millisecond)))
+	}
+	return lines
+}
+
+/**
+ * Ingests the values of all successfully retrieved SLIResults as metrics keptn.sli.<indicator> with the dimensions project, stage and service
+ * The values are ingested with the passed timestamp, e.g: the end of the evaluation timeframe
+ */
+func (ph *Handler) IngestSLIMetrics(sliResults []*keptnv2.SLIResult, timestamp time.Time) error {
+	lines := buildSLIMetricLines(ph.KeptnEvent.Project, ph.KeptnEvent.Stage, ph.KeptnEvent.Service, sliResults, timestamp)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	targetURL := ph.ApiURL + "/api/v2/metrics/ingest"
+	resp, body, err := ph.executeDynatraceRESTWithBody("POST", targetURL, []byte(strings.Join(lines, "\n")), map[string]string{"Content-Type": "text/plain; charset=utf-8"})
+	if err != nil {
+		return err
+	}
+
+	// the Metrics Ingest API returns 202 if the lines were accepted
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+	return checkApiResponse(resp, body)
+}
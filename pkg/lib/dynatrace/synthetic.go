@@ -0,0 +1,67 @@
+package dynatrace
+
+import (
+	"fmt"
+	"strings"
+)
+
+const syntheticAvailability = "availability"
+const syntheticPerformance = "performance"
+
+// metric keys (and their units) used for synthetic SLIs by monitor type and SLI type
+var syntheticMetrics = map[string]map[string][2]string{
+	"SYNTHETIC_TEST": {
+		syntheticAvailability: {"builtin:synthetic.browser.availability.location.total", "Percent"},
+		syntheticPerformance:  {"builtin:synthetic.browser.totalDuration.geo", "MilliSecond"},
+	},
+	"HTTP_CHECK": {
+		syntheticAvailability: {"builtin:synthetic.http.availability.location.total", "Percent"},
+		syntheticPerformance:  {"builtin:synthetic.http.duration.geo", "MilliSecond"},
+	},
+}
+
+/**
+ * Translates a SYNTHETIC;<monitor>[;availability|performance][;<locationId>] query into an MV2 metrics query
+ * monitor is either the entity ID of a browser (SYNTHETIC_TEST-...) or HTTP monitor (HTTP_CHECK-...), a tag (e.g: app:carts) or an entity selector condition (e.g: tag(app:carts))
+ * tags and selector conditions are matched against browser monitors
+ */
+func buildSyntheticMetricsQuery(syntheticQuery string) (string, error) {
+	querySplits := strings.Split(strings.TrimPrefix(syntheticQuery, "SYNTHETIC;"), ";")
+	if len(querySplits) < 1 || len(querySplits) > 3 || querySplits[0] == "" {
+		return "", fmt.Errorf("Synthetic Indicator query has wrong format. Should be SYNTHETIC;<monitor>[;availability|performance][;<locationId>] but is: %s", syntheticQuery)
+	}
+
+	monitor := querySplits[0]
+	sliType := syntheticAvailability
+	if len(querySplits) > 1 && querySplits[1] != "" {
+		sliType = strings.ToLower(querySplits[1])
+	}
+	location := ""
+	if len(querySplits) > 2 {
+		location = querySplits[2]
+	}
+
+	monitorType := "SYNTHETIC_TEST"
+	monitorCondition := ""
+	if strings.HasPrefix(monitor, "SYNTHETIC_TEST-") || strings.HasPrefix(monitor, "HTTP_CHECK-") {
+		monitorType = monitor[:strings.Index(monitor, "-")]
+		monitorCondition = fmt.Sprintf("entityId(%s)", monitor)
+	} else if strings.Contains(monitor, "(") {
+		monitorCondition = monitor
+	} else {
+		monitorCondition = fmt.Sprintf("tag(%s)", monitor)
+	}
+
+	metric, ok := syntheticMetrics[monitorType][sliType]
+	if !ok {
+		return "", fmt.Errorf("unsupported synthetic SLI type %s - use %s or %s", sliType, syntheticAvailability, syntheticPerformance)
+	}
+
+	metricSelector := metric[0]
+	if location != "" {
+		metricSelector += fmt.Sprintf(":filter(eq(\"dt.entity.synthetic_location\",\"%s\"))", location)
+	}
+	metricSelector += ":splitBy():avg"
+
+	return fmt.Sprintf("MV2;%s;metricSelector=%s&entitySelector=type(%s),%s", metric[1], metricSelector, monitorType, monitorCondition), nil
+}
@@ -0,0 +1,139 @@
+package dynatrace
+
+import (
+	"fmt"
+	"strings"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const tileReasonUnsupportedType = "unsupported tile type"
+const tileReasonNoSLIName = "no sli=<name> in tile name"
+const tileReasonNoSLIs = "tile did not produce any SLI"
+
+// TileProcessingResult describes how a single dashboard tile was processed: whether it was included, why it was skipped and how many SLIs it produced
+type TileProcessingResult struct {
+	DashboardID string `json:"dashboardId" yaml:"dashboardId"`
+	TileName    string `json:"tileName" yaml:"tileName"`
+	TileType    string `json:"tileType" yaml:"tileType"`
+	Included    bool   `json:"included" yaml:"included"`
+	Reason      string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	SLIs        int    `json:"slis" yaml:"slis"`
+
+	// index of the first SLIResult of this tile - used to count the SLIs of the tile
+	firstSLIIndex int
+
+	// index of the first query the handler executed for this tile - used to assign the executed queries to the SLIs of the tile
+	firstQueryIndex int
+}
+
+// skip marks the tile as skipped for the passed reason
+func (r *TileProcessingResult) skip(reason string) {
+	r.Included = false
+	r.Reason = reason
+}
+
+// addError adds an error that occurred while querying the data of the tile to the reason
+func (r *TileProcessingResult) addError(err error) {
+	if r.Reason == "" {
+		r.Reason = "query error: " + err.Error()
+	} else {
+		r.Reason = r.Reason + "; query error: " + err.Error()
+	}
+}
+
+// GetTileReport returns how the tiles of all dashboards processed by this handler were processed
+func (ph *Handler) GetTileReport() []*TileProcessingResult {
+	return ph.tileReport
+}
+
+// startTileReport adds a new entry for a tile to the report - all SLIResults added after firstSLIIndex are counted for this tile
+func (ph *Handler) startTileReport(dashboardID string, tileName string, tileType string, firstSLIIndex int) *TileProcessingResult {
+	result := &TileProcessingResult{
+		DashboardID:     dashboardID,
+		TileName:        tileName,
+		TileType:        tileType,
+		firstSLIIndex:   firstSLIIndex,
+		firstQueryIndex: len(ph.executedQueries),
+	}
+	ph.tileReport = append(ph.tileReport, result)
+	return result
+}
+
+/**
+ * Counts the SLIs of the passed tile results based on the SLIResult index of the following tile and marks all tiles that produced SLIs as included
+ * sliResultCount is the number of SLIResults after processing the last tile
+ */
+func finishTileReport(tileResults []*TileProcessingResult, sliResultCount int) {
+	for i, tileResult := range tileResults {
+		nextSLIIndex := sliResultCount
+		if i+1 < len(tileResults) {
+			nextSLIIndex = tileResults[i+1].firstSLIIndex
+		}
+		tileResult.SLIs = nextSLIIndex - tileResult.firstSLIIndex
+
+		if tileResult.SLIs > 0 {
+			tileResult.Included = true
+		}
+		if !tileResult.Included && tileResult.Reason == "" {
+			tileResult.Reason = tileReasonNoSLIs
+		}
+	}
+}
+
+/**
+ * Assigns the queries the handler executed while processing each of the passed tiles to the SLIResults of the tile, e.g: for the export of the SLI results
+ * The queries of an SLI that was already produced by another dashboard are kept, as the SLI of the first dashboard is used
+ */
+func (ph *Handler) recordTileExecutedQueries(tileResults []*TileProcessingResult, sliResults []*keptnv2.SLIResult) {
+	if ph.dashboardExecutedQueries == nil {
+		ph.dashboardExecutedQueries = map[string][]string{}
+	}
+	for i, tileResult := range tileResults {
+		nextQueryIndex := len(ph.executedQueries)
+		if i+1 < len(tileResults) {
+			nextQueryIndex = tileResults[i+1].firstQueryIndex
+		}
+		if tileResult.SLIs <= 0 {
+			continue
+		}
+		queries := ph.executedQueries[tileResult.firstQueryIndex:nextQueryIndex]
+
+		for _, sliResult := range sliResults[tileResult.firstSLIIndex : tileResult.firstSLIIndex+tileResult.SLIs] {
+			if _, exists := ph.dashboardExecutedQueries[sliResult.Metric]; !exists {
+				ph.dashboardExecutedQueries[sliResult.Metric] = queries
+			}
+		}
+	}
+}
+
+// GetDashboardExecutedQueries returns the query URLs that were executed against the Dynatrace API for the SLIs of the processed dashboards by their name
+func (ph *Handler) GetDashboardExecutedQueries() map[string][]string {
+	return ph.dashboardExecutedQueries
+}
+
+/**
+ * Returns a short summary of the tile report that can be added to an event message, e.g:
+ * Dashboard tiles: 5 included, 2 skipped (CUSTOM_CHARTING 'Throughput': no sli=<name> in tile name, HEADER 'Services': unsupported tile type)
+ */
+func GetTileReportSummary(tileResults []*TileProcessingResult) string {
+	if len(tileResults) == 0 {
+		return ""
+	}
+
+	included := 0
+	var skipped []string
+	for _, tileResult := range tileResults {
+		if tileResult.Included {
+			included++
+			continue
+		}
+		skipped = append(skipped, fmt.Sprintf("%s '%s': %s", tileResult.TileType, tileResult.TileName, tileResult.Reason))
+	}
+
+	summary := fmt.Sprintf("Dashboard tiles: %d included, %d skipped", included, len(skipped))
+	if len(skipped) > 0 {
+		summary = summary + " (" + strings.Join(skipped, ", ") + ")"
+	}
+	return summary
+}
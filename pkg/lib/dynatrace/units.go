@@ -0,0 +1,205 @@
+package dynatrace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// UnitConversionSeparator separates the metric unit from the target unit in MV2 queries, e.g: MV2;MicroSecond->MilliSecond;metricSelector=...
+const UnitConversionSeparator = "->"
+
+const unitGroupTime = "time"
+const unitGroupData = "data"
+const unitGroupRatio = "ratio"
+
+type unitDefinition struct {
+	group  string
+	factor float64 // factor to the base unit of the group (MicroSecond for time, Byte for data)
+}
+
+// all supported units including their short names - keys are lower case
+var supportedUnits = map[string]unitDefinition{
+	"nanosecond":  {group: unitGroupTime, factor: 0.001},
+	"ns":          {group: unitGroupTime, factor: 0.001},
+	"microsecond": {group: unitGroupTime, factor: 1},
+	"us":          {group: unitGroupTime, factor: 1},
+	"µs":          {group: unitGroupTime, factor: 1},
+	"millisecond": {group: unitGroupTime, factor: 1000},
+	"ms":          {group: unitGroupTime, factor: 1000},
+	"second":      {group: unitGroupTime, factor: 1000 * 1000},
+	"s":           {group: unitGroupTime, factor: 1000 * 1000},
+	"minute":      {group: unitGroupTime, factor: 60 * 1000 * 1000},
+	"min":         {group: unitGroupTime, factor: 60 * 1000 * 1000},
+	"hour":        {group: unitGroupTime, factor: 60 * 60 * 1000 * 1000},
+	"h":           {group: unitGroupTime, factor: 60 * 60 * 1000 * 1000},
+	"byte":        {group: unitGroupData, factor: 1},
+	"b":           {group: unitGroupData, factor: 1},
+	"kilobyte":    {group: unitGroupData, factor: 1024},
+	"kb":          {group: unitGroupData, factor: 1024},
+	"megabyte":    {group: unitGroupData, factor: 1024 * 1024},
+	"mb":          {group: unitGroupData, factor: 1024 * 1024},
+	"gigabyte":    {group: unitGroupData, factor: 1024 * 1024 * 1024},
+	"gb":          {group: unitGroupData, factor: 1024 * 1024 * 1024},
+	"percent":     {group: unitGroupRatio, factor: 1},
+	"%":           {group: unitGroupRatio, factor: 1},
+	"ratio":       {group: unitGroupRatio, factor: 100},
+}
+
+/**
+ * Splits the unit part of an MV2 query into the metric unit and the optional target unit
+ * e.g: MicroSecond->MilliSecond returns MicroSecond, MilliSecond and MicroSecond returns MicroSecond and an empty target unit
+ */
+func parseMV2UnitDefinition(unitDefinition string) (string, string) {
+	separatorIndex := strings.Index(unitDefinition, UnitConversionSeparator)
+	if separatorIndex < 0 {
+		return unitDefinition, ""
+	}
+
+	return unitDefinition[:separatorIndex], unitDefinition[separatorIndex+len(UnitConversionSeparator):]
+}
+
+/**
+ * Returns the unit part of an MV2 query, e.g: MicroSecond or MicroSecond->MilliSecond if a target unit is given
+ */
+func buildMV2UnitDefinition(unit string, targetUnit string) string {
+	if targetUnit == "" {
+		return unit
+	}
+	return unit + UnitConversionSeparator + targetUnit
+}
+
+/**
+ * Converts a value from one unit into another unit, e.g: MicroSecond to MilliSecond
+ * Returns an error if one of the units is not supported or if the units can't be converted into each other
+ */
+func convertUnit(value float64, unit string, targetUnit string) (float64, error) {
+	from, ok := supportedUnits[strings.ToLower(unit)]
+	if !ok {
+		return value, fmt.Errorf("unsupported unit %s", unit)
+	}
+
+	to, ok := supportedUnits[strings.ToLower(targetUnit)]
+	if !ok {
+		return value, fmt.Errorf("unsupported target unit %s", targetUnit)
+	}
+
+	if from.group != to.group {
+		return value, fmt.Errorf("cannot convert %s to %s", unit, targetUnit)
+	}
+
+	return value * from.factor / to.factor, nil
+}
+
+/**
+ * Scales the value into the target unit. If no target unit is given the default scaling rules of scaleData are applied
+ */
+func scaleDataToUnit(ctx context.Context, metricID string, unit string, targetUnit string, value float64) float64 {
+	if targetUnit == "" {
+		return scaleData(metricID, unit, value)
+	}
+
+	convertedValue, err := convertUnit(value, unit, targetUnit)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithFields(
+			log.Fields{
+				"metricId":   metricID,
+				"unit":       unit,
+				"targetUnit": targetUnit,
+			}).Error("Could not convert value to target unit, falling back to default scaling")
+		return scaleData(metricID, unit, value)
+	}
+
+	return convertedValue
+}
+
+/**
+ * Scales the value based on the target unit, the unit scaling rules of the dynatrace.conf.yaml or the default scaling rules - in that order
+ */
+func (ph *Handler) scaleValue(metricID string, unit string, targetUnit string, value float64) float64 {
+	if targetUnit != "" {
+		return scaleDataToUnit(ph.EventContext, metricID, unit, targetUnit, value)
+	}
+
+	for _, rule := range ph.UnitScalingRules {
+		if !strings.EqualFold(rule.Unit, unit) {
+			continue
+		}
+
+		if rule.TargetUnit != "" {
+			return scaleDataToUnit(ph.EventContext, metricID, unit, rule.TargetUnit, value)
+		}
+
+		if rule.Factor != 0 {
+			return value * rule.Factor
+		}
+
+		// a rule without target unit and factor keeps the value as it is
+		return value
+	}
+
+	return scaleData(metricID, unit, value)
+}
+
+// transformations that can follow the metric key in a metric selector, e.g: builtin:service.response.time:merge(0):avg
+var metricSelectorTransformations = map[string]bool{
+	"avg": true, "count": true, "max": true, "min": true, "sum": true, "value": true, "median": true,
+	"names": true, "parents": true, "last": true, "lastreal": true, "splitby": true, "fold": true, "auto": true,
+}
+
+/**
+ * Returns the metric key of a metric selector by removing all transformations
+ * e.g: builtin:service.response.time:merge(0):percentile(90) returns builtin:service.response.time
+ */
+func getMetricKeyFromSelector(metricSelector string) string {
+	parts := strings.Split(metricSelector, ":")
+	keyParts := []string{}
+	for _, part := range parts {
+		if strings.Contains(part, "(") || metricSelectorTransformations[strings.ToLower(part)] {
+			break
+		}
+		keyParts = append(keyParts, part)
+	}
+
+	return strings.Join(keyParts, ":")
+}
+
+/**
+ * Detects the unit of the metric used in the metric selector by querying the metric definition
+ * Returns an empty string if the unit could not be detected. The result is kept per metric key - also if the unit could not be detected,
+ * so that the metric definition is only requested once for all SLIs of the same metric
+ */
+func (ph *Handler) detectMetricUnit(metricSelector string) string {
+	logger := logging.FromContext(ph.EventContext)
+	metricKey := getMetricKeyFromSelector(metricSelector)
+	if metricKey == "" {
+		return ""
+	}
+
+	if unit, ok := ph.detectedMetricUnits[metricKey]; ok {
+		return unit
+	}
+
+	if ph.detectedMetricUnits == nil {
+		ph.detectedMetricUnits = map[string]string{}
+	}
+
+	metricDefinition, err := ph.ExecuteMetricAPIDescribe(metricKey)
+	if err != nil {
+		logger.WithError(err).WithField("metricKey", metricKey).Debug("Could not detect unit of metric")
+		ph.detectedMetricUnits[metricKey] = ""
+		return ""
+	}
+	ph.detectedMetricUnits[metricKey] = metricDefinition.Unit
+
+	logger.WithFields(
+		log.Fields{
+			"metricKey": metricKey,
+			"unit":      metricDefinition.Unit,
+		}).Debug("Detected unit of metric")
+
+	return metricDefinition.Unit
+}
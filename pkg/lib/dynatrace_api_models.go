@@ -3,6 +3,7 @@ package lib
 import (
 	"errors"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"strconv"
 	"strings"
 )
 
@@ -62,6 +63,16 @@ type CustomEventFilter struct {
 	CustomTitleFilter CustomTitleFilter `json:"customTitleFilter"`
 }
 
+// SERVICE NAMING RULE TYPES
+type ServiceNamingRule struct {
+	ID          string       `json:"id,omitempty"`
+	Type        string       `json:"type"`
+	NameFormat  string       `json:"nameFormat"`
+	DisplayName string       `json:"displayName"`
+	Enabled     bool         `json:"enabled"`
+	Conditions  []Conditions `json:"conditions"`
+}
+
 // CALCULATED METRIC TYPES
 type CalculatedMetric struct {
 	TsmMetricKey        string                       `json:"tsmMetricKey"`
@@ -80,7 +91,7 @@ type MetricDefinition struct {
 type Value struct {
 	Context string `json:"context"`
 	Key     string `json:"key"`
-	Value   string `json:"value"`
+	Value   string `json:"value,omitempty"`
 }
 type CalculatedMetricConditions struct {
 	Attribute      string                         `json:"attribute"`
@@ -185,8 +196,10 @@ type Tiles struct {
 
 // MANAGEMENT ZONE TYPES
 type ManagementZone struct {
-	Name  string    `json:"name"`
-	Rules []MZRules `json:"rules"`
+	ID          string    `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Rules       []MZRules `json:"rules"`
 }
 
 type MZKey struct {
@@ -195,7 +208,7 @@ type MZKey struct {
 type MZValue struct {
 	Context string `json:"context"`
 	Key     string `json:"key"`
-	Value   string `json:"value"`
+	Value   string `json:"value,omitempty"`
 }
 type MZComparisonInfo struct {
 	Type     string  `json:"type"`
@@ -214,19 +227,71 @@ type MZRules struct {
 	Conditions       []MZConditions `json:"conditions"`
 }
 
+// MAINTENANCE WINDOW TYPES
+type MaintenanceWindow struct {
+	ID                                 string                    `json:"id,omitempty"`
+	Name                               string                    `json:"name"`
+	Description                        string                    `json:"description"`
+	Type                               string                    `json:"type"`
+	Suppression                        string                    `json:"suppression"`
+	SuppressSyntheticMonitorsExecution bool                      `json:"suppressSyntheticMonitorsExecution"`
+	Scope                              *MaintenanceWindowScope   `json:"scope"`
+	Schedule                           MaintenanceWindowSchedule `json:"schedule"`
+}
+type MaintenanceWindowScope struct {
+	Entities []string                 `json:"entities"`
+	Matches  []MaintenanceWindowMatch `json:"matches"`
+}
+type MaintenanceWindowMatch struct {
+	Type           string                 `json:"type"`
+	Tags           []MaintenanceWindowTag `json:"tags"`
+	TagCombination string                 `json:"tagCombination"`
+}
+type MaintenanceWindowTag struct {
+	Context string `json:"context"`
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+}
+type MaintenanceWindowSchedule struct {
+	RecurrenceType string `json:"recurrenceType"`
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	ZoneID         string `json:"zoneId"`
+}
+
+// SLO TYPES
+type SLO struct {
+	ID               string  `json:"id,omitempty"`
+	Name             string  `json:"name"`
+	Description      string  `json:"description"`
+	Enabled          bool    `json:"enabled"`
+	EvaluationType   string  `json:"evaluationType"`
+	Filter           string  `json:"filter"`
+	MetricExpression string  `json:"metricExpression"`
+	Target           float64 `json:"target"`
+	Warning          float64 `json:"warning"`
+	Timeframe        string  `json:"timeframe"`
+}
+type SLOListResponse struct {
+	SLOs        []SLO  `json:"slo"`
+	NextPageKey string `json:"nextPageKey"`
+}
+
 // AUTO TAGGING
 type DTTaggingRule struct {
-	Name  string  `json:"name"`
-	Rules []Rules `json:"rules"`
+	ID          string  `json:"id,omitempty"`
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Rules       []Rules `json:"rules"`
 }
 type DynamicKey struct {
 	Source string `json:"source"`
 	Key    string `json:"key"`
 }
 type Key struct {
-	Attribute  string     `json:"attribute"`
-	DynamicKey DynamicKey `json:"dynamicKey"`
-	Type       string     `json:"type"`
+	Attribute  string      `json:"attribute"`
+	DynamicKey *DynamicKey `json:"dynamicKey,omitempty"`
+	Type       string      `json:"type"`
 }
 type ComparisonInfo struct {
 	Type          string      `json:"type"`
@@ -274,6 +339,16 @@ type MetricEvent struct {
 	TagFilters        []METagFilter     `json:"tagFilters,omitempty"`
 	AlertingScope     []MEAlertingScope `json:"alertingScope"`
 	Unit              string            `json:"unit,omitempty"`
+	// MonitoringStrategy is only set for metric events that use an auto-adaptive baseline instead of the threshold
+	MonitoringStrategy *MEMonitoringStrategy `json:"monitoringStrategy,omitempty"`
+}
+type MEMonitoringStrategy struct {
+	Type                       string  `json:"type"`
+	AlertCondition             string  `json:"alertCondition"`
+	Samples                    int     `json:"samples"`
+	ViolatingSamples           int     `json:"violatingSamples"`
+	DealertingSamples          int     `json:"dealertingSamples"`
+	NumberOfSignalFluctuations float64 `json:"numberOfSignalFluctuations"`
 }
 type MEMetadata struct {
 	ConfigurationVersions []int  `json:"configurationVersions"`
@@ -283,7 +358,7 @@ type MEMetadata struct {
 type METagFilter struct {
 	Context string `json:"context"`
 	Key     string `json:"key"`
-	Value   string `json:"value"`
+	Value   string `json:"value,omitempty"`
 }
 type MEAlertingScope struct {
 	FilterType       string       `json:"filterType"`
@@ -510,7 +585,8 @@ func CreateKeptnAlertingProfile() *AlertingProfile {
 
 func CreateManagementZoneForProject(project string) *ManagementZone {
 	managementZone := &ManagementZone{
-		Name: "Keptn: " + project,
+		Name:        "Keptn: " + project,
+		Description: getManagementZoneOwnershipMarker(project, ""),
 		Rules: []MZRules{
 			{
 				Type:             "SERVICE",
@@ -542,7 +618,8 @@ func CreateManagementZoneForProject(project string) *ManagementZone {
 
 func CreateManagementZoneForStage(project string, stage string) *ManagementZone {
 	managementZone := &ManagementZone{
-		Name: "Keptn: " + project + " " + stage,
+		Name:        getManagementZoneNameForStage(project, stage),
+		Description: getManagementZoneOwnershipMarker(project, stage),
 		Rules: []MZRules{
 			{
 				Type:             "SERVICE",
@@ -800,8 +877,8 @@ func CreateCalculatedTestStepMetric(key string, name string, baseMetric string,
 			},
 		},
 		DimensionDefinition: DimensionDefinition{
-			Name:            "TestStep",
-			Dimension:       "{RequestAttribute:TSN}",
+			Name:            dimensionName,
+			Dimension:       dimensionDefinition,
 			Placeholders:    []string{},
 			TopX:            10,
 			TopXDirection:   "DESCENDING",
@@ -1118,3 +1195,296 @@ func createStageServicesTile(project string, stage string) Tiles {
 		Markdown:                  "",
 	}
 }
+
+// SETTINGS 2.0 TYPES
+type AutoTaggingSettings struct {
+	Name        string                    `json:"name"`
+	Description string                    `json:"description,omitempty"`
+	Rules       []AutoTaggingSettingsRule `json:"rules"`
+}
+type AutoTaggingSettingsRule struct {
+	Enabled            bool                          `json:"enabled"`
+	Type               string                        `json:"type"`
+	ValueFormat        string                        `json:"valueFormat"`
+	ValueNormalization string                        `json:"valueNormalization"`
+	AttributeRule      AutoTaggingSettingsAttributes `json:"attributeRule"`
+}
+type AutoTaggingSettingsAttributes struct {
+	EntityType               string                         `json:"entityType"`
+	ServiceToPGPropagation   bool                           `json:"serviceToPGPropagation"`
+	ServiceToHostPropagation bool                           `json:"serviceToHostPropagation"`
+	PGToServicePropagation   bool                           `json:"pgToServicePropagation"`
+	PGToHostPropagation      bool                           `json:"pgToHostPropagation"`
+	HostToPGPropagation      bool                           `json:"hostToPGPropagation"`
+	Conditions               []AutoTaggingSettingsCondition `json:"conditions"`
+}
+type AutoTaggingSettingsCondition struct {
+	Key              string `json:"key"`
+	DynamicKey       string `json:"dynamicKey,omitempty"`
+	DynamicKeySource string `json:"dynamicKeySource,omitempty"`
+	Operator         string `json:"operator"`
+	StringValue      string `json:"stringValue,omitempty"`
+	CaseSensitive    bool   `json:"caseSensitive,omitempty"`
+}
+
+type AlertingProfileSettings struct {
+	Name           string                                `json:"name"`
+	ManagementZone string                                `json:"managementZone,omitempty"`
+	SeverityRules  []AlertingProfileSettingsSeverityRule `json:"severityRules"`
+	EventFilters   []interface{}                         `json:"eventFilters"`
+}
+type AlertingProfileSettingsSeverityRule struct {
+	SeverityLevel        string   `json:"severityLevel"`
+	DelayInMinutes       int      `json:"delayInMinutes"`
+	TagFilterIncludeMode string   `json:"tagFilterIncludeMode"`
+	TagFilter            []string `json:"tagFilter,omitempty"`
+}
+
+type ProblemNotificationSettings struct {
+	Enabled             bool                               `json:"enabled"`
+	NotificationType    string                             `json:"notificationType"`
+	DisplayName         string                             `json:"displayName"`
+	AlertingProfile     string                             `json:"alertingProfile"`
+	WebHookNotification ProblemNotificationSettingsWebhook `json:"webHookNotification"`
+}
+type ProblemNotificationSettingsWebhook struct {
+	URL                      string                              `json:"url"`
+	AcceptAnyCertificate     bool                                `json:"acceptAnyCertificate"`
+	NotifyEventMergesEnabled bool                                `json:"notifyEventMergesEnabled"`
+	NotifyClosedProblems     bool                                `json:"notifyClosedProblems"`
+	Headers                  []ProblemNotificationSettingsHeader `json:"headers"`
+	Payload                  string                              `json:"payload"`
+}
+type ProblemNotificationSettingsHeader struct {
+	Name        string `json:"name"`
+	Secret      bool   `json:"secret"`
+	Value       string `json:"value,omitempty"`
+	SecretValue string `json:"secretValue,omitempty"`
+}
+
+type MetricEventSettings struct {
+	Enabled                 bool                               `json:"enabled"`
+	Summary                 string                             `json:"summary"`
+	QueryDefinition         MetricEventSettingsQueryDefinition `json:"queryDefinition"`
+	ModelProperties         MetricEventSettingsModelProperties `json:"modelProperties"`
+	EventTemplate           MetricEventSettingsEventTemplate   `json:"eventTemplate"`
+	EventEntityDimensionKey string                             `json:"eventEntityDimensionKey,omitempty"`
+}
+type MetricEventSettingsQueryDefinition struct {
+	Type            string                          `json:"type"`
+	MetricKey       string                          `json:"metricKey"`
+	Aggregation     string                          `json:"aggregation,omitempty"`
+	ManagementZone  string                          `json:"managementZone,omitempty"`
+	EntityFilter    MetricEventSettingsEntityFilter `json:"entityFilter"`
+	DimensionFilter []interface{}                   `json:"dimensionFilter"`
+}
+type MetricEventSettingsEntityFilter struct {
+	DimensionKey string                                     `json:"dimensionKey,omitempty"`
+	Conditions   []MetricEventSettingsEntityFilterCondition `json:"conditions"`
+}
+type MetricEventSettingsEntityFilterCondition struct {
+	Type     string `json:"type"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+type MetricEventSettingsModelProperties struct {
+	Type              string  `json:"type"`
+	Threshold         float64 `json:"threshold"`
+	AlertOnNoData     bool    `json:"alertOnNoData"`
+	AlertCondition    string  `json:"alertCondition"`
+	ViolatingSamples  int     `json:"violatingSamples"`
+	Samples           int     `json:"samples"`
+	DealertingSamples int     `json:"dealertingSamples"`
+	SignalFluctuation float64 `json:"signalFluctuation,omitempty"`
+}
+type MetricEventSettingsEventTemplate struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	EventType   string `json:"eventType"`
+	DavisMerge  bool   `json:"davisMerge"`
+}
+type ServiceAnomalyDetectionResponseTime struct {
+	Enabled        bool                                      `json:"enabled"`
+	DetectionMode  string                                    `json:"detectionMode,omitempty"`
+	AutoDetection  *ServiceAnomalyDetectionResponseTimeAuto  `json:"autoDetection,omitempty"`
+	FixedDetection *ServiceAnomalyDetectionResponseTimeFixed `json:"fixedDetection,omitempty"`
+}
+type ServiceAnomalyDetectionResponseTimeAuto struct {
+	ResponseTimeAll        ServiceAnomalyDetectionResponseTimeAll     `json:"responseTimeAll"`
+	ResponseTimeSlowest    ServiceAnomalyDetectionResponseTimeSlowest `json:"responseTimeSlowest"`
+	OverAlertingProtection ServiceAnomalyDetectionOverAlerting        `json:"overAlertingProtection"`
+}
+type ServiceAnomalyDetectionResponseTimeFixed struct {
+	ResponseTimeAll        ServiceAnomalyDetectionResponseTimeAll     `json:"responseTimeAll"`
+	ResponseTimeSlowest    ServiceAnomalyDetectionResponseTimeSlowest `json:"responseTimeSlowest"`
+	OverAlertingProtection ServiceAnomalyDetectionOverAlerting        `json:"overAlertingProtection"`
+	Sensitivity            string                                     `json:"sensitivity"`
+}
+type ServiceAnomalyDetectionResponseTimeAll struct {
+	DegradationMilliseconds float64 `json:"degradationMilliseconds"`
+	DegradationPercent      float64 `json:"degradationPercent,omitempty"`
+}
+type ServiceAnomalyDetectionResponseTimeSlowest struct {
+	SlowestDegradationMilliseconds float64 `json:"slowestDegradationMilliseconds"`
+	SlowestDegradationPercent      float64 `json:"slowestDegradationPercent,omitempty"`
+}
+type ServiceAnomalyDetectionOverAlerting struct {
+	RequestsPerMinute    float64 `json:"requestsPerMinute"`
+	MinutesAbnormalState int     `json:"minutesAbnormalState"`
+}
+type ServiceAnomalyDetectionFailureRate struct {
+	Enabled        bool                                     `json:"enabled"`
+	DetectionMode  string                                   `json:"detectionMode,omitempty"`
+	AutoDetection  *ServiceAnomalyDetectionFailureRateAuto  `json:"autoDetection,omitempty"`
+	FixedDetection *ServiceAnomalyDetectionFailureRateFixed `json:"fixedDetection,omitempty"`
+}
+type ServiceAnomalyDetectionFailureRateAuto struct {
+	AbsoluteIncrease       float64                             `json:"absoluteIncrease"`
+	RelativeIncrease       float64                             `json:"relativeIncrease"`
+	OverAlertingProtection ServiceAnomalyDetectionOverAlerting `json:"overAlertingProtection"`
+}
+type ServiceAnomalyDetectionFailureRateFixed struct {
+	Threshold              float64                             `json:"threshold"`
+	Sensitivity            string                              `json:"sensitivity"`
+	OverAlertingProtection ServiceAnomalyDetectionOverAlerting `json:"overAlertingProtection"`
+}
+
+// toSettings converts the tagging rule to the builtin:tags.auto-tagging schema of the Settings 2.0 API
+// valueFormats returns the tag values of the rules of the tagging rule
+func (rule *DTTaggingRule) valueFormats() []string {
+	var valueFormats []string
+	for _, r := range rule.Rules {
+		valueFormats = append(valueFormats, r.ValueFormat)
+	}
+	return valueFormats
+}
+
+// valueFormats returns the tag values of the rules of the tagging rule
+func (settings *AutoTaggingSettings) valueFormats() []string {
+	var valueFormats []string
+	for _, r := range settings.Rules {
+		valueFormats = append(valueFormats, r.ValueFormat)
+	}
+	return valueFormats
+}
+
+func (rule *DTTaggingRule) toSettings() *AutoTaggingSettings {
+	settings := &AutoTaggingSettings{
+		Name:        rule.Name,
+		Description: rule.Description,
+	}
+	for _, r := range rule.Rules {
+		settingsRule := AutoTaggingSettingsRule{
+			Enabled:            r.Enabled,
+			Type:               "ME",
+			ValueFormat:        r.ValueFormat,
+			ValueNormalization: "Leave text as-is",
+			AttributeRule: AutoTaggingSettingsAttributes{
+				EntityType:               r.Type,
+				ServiceToPGPropagation:   containsString(r.PropagationTypes, "SERVICE_TO_PROCESS_GROUP_LIKE"),
+				ServiceToHostPropagation: containsString(r.PropagationTypes, "SERVICE_TO_HOST_LIKE"),
+				PGToServicePropagation:   containsString(r.PropagationTypes, "PROCESS_GROUP_TO_SERVICE"),
+				PGToHostPropagation:      containsString(r.PropagationTypes, "PROCESS_GROUP_TO_HOST"),
+				HostToPGPropagation:      containsString(r.PropagationTypes, "HOST_TO_PROCESS_GROUP_INSTANCE"),
+			},
+		}
+		for _, condition := range r.Conditions {
+			settingsCondition := AutoTaggingSettingsCondition{
+				Key:      condition.Key.Attribute,
+				Operator: condition.ComparisonInfo.Operator,
+			}
+			if condition.Key.DynamicKey != nil {
+				settingsCondition.DynamicKey = condition.Key.DynamicKey.Key
+				settingsCondition.DynamicKeySource = condition.Key.DynamicKey.Source
+			}
+			if value, ok := condition.ComparisonInfo.Value.(string); ok {
+				settingsCondition.StringValue = value
+			}
+			if caseSensitive, ok := condition.ComparisonInfo.CaseSensitive.(bool); ok {
+				settingsCondition.CaseSensitive = caseSensitive
+			}
+			settingsRule.AttributeRule.Conditions = append(settingsRule.AttributeRule.Conditions, settingsCondition)
+		}
+		settings.Rules = append(settings.Rules, settingsRule)
+	}
+	return settings
+}
+
+// toSettings converts the alerting profile to the builtin:alerting.profile schema of the Settings 2.0 API
+func (profile *AlertingProfile) toSettings() *AlertingProfileSettings {
+	settings := &AlertingProfileSettings{
+		Name:         profile.DisplayName,
+		EventFilters: []interface{}{},
+	}
+	for _, rule := range profile.Rules {
+		severityLevel := rule.SeverityLevel
+		// the configuration API v1 calls the severity level ERROR while the Settings 2.0 API calls it ERRORS
+		if severityLevel == "ERROR" {
+			severityLevel = "ERRORS"
+		}
+		settings.SeverityRules = append(settings.SeverityRules, AlertingProfileSettingsSeverityRule{
+			SeverityLevel:        severityLevel,
+			DelayInMinutes:       rule.DelayInMinutes,
+			TagFilterIncludeMode: rule.TagFilter.IncludeMode,
+			TagFilter:            rule.TagFilter.TagFilters,
+		})
+	}
+	return settings
+}
+
+// toSettings converts the metric event to the builtin:anomaly-detection.metric-events schema of the Settings 2.0 API
+func (me *MetricEvent) toSettings() *MetricEventSettings {
+	settings := &MetricEventSettings{
+		Enabled: me.Enabled,
+		Summary: me.Name,
+		QueryDefinition: MetricEventSettingsQueryDefinition{
+			Type:        "METRIC_KEY",
+			MetricKey:   me.MetricID,
+			Aggregation: me.AggregationType,
+			EntityFilter: MetricEventSettingsEntityFilter{
+				Conditions: []MetricEventSettingsEntityFilterCondition{},
+			},
+			DimensionFilter: []interface{}{},
+		},
+		ModelProperties: MetricEventSettingsModelProperties{
+			Type:              "STATIC_THRESHOLD",
+			Threshold:         me.Threshold,
+			AlertCondition:    me.AlertCondition,
+			ViolatingSamples:  me.ViolatingSamples,
+			Samples:           me.Samples,
+			DealertingSamples: me.DealertingSamples,
+		},
+		EventTemplate: MetricEventSettingsEventTemplate{
+			Title:       me.Name,
+			Description: me.Description,
+			EventType:   me.EventType,
+		},
+	}
+
+	if me.MonitoringStrategy != nil && me.MonitoringStrategy.Type == metricEventAutoAdaptiveBaseline {
+		settings.ModelProperties.Type = "AUTO_ADAPTIVE_THRESHOLD"
+		settings.ModelProperties.SignalFluctuation = me.MonitoringStrategy.NumberOfSignalFluctuations
+	}
+
+	// the Settings 2.0 API calls the 90th percentile PERCENTILE90
+	if settings.QueryDefinition.Aggregation == "P90" {
+		settings.QueryDefinition.Aggregation = "PERCENTILE90"
+	}
+
+	for _, scope := range me.AlertingScope {
+		if scope.FilterType == "MANAGEMENT_ZONE" {
+			settings.QueryDefinition.ManagementZone = strconv.FormatInt(scope.ManagementZoneID, 10)
+		} else if scope.FilterType == "TAG" && scope.TagFilter != nil {
+			settings.QueryDefinition.EntityFilter.Conditions = append(settings.QueryDefinition.EntityFilter.Conditions, MetricEventSettingsEntityFilterCondition{
+				Type:     "TAG",
+				Operator: "EQUALS",
+				Value:    scope.TagFilter.Key + ":" + scope.TagFilter.Value,
+			})
+		}
+	}
+	if strings.HasPrefix(me.MetricID, "builtin:service.") {
+		settings.QueryDefinition.EntityFilter.DimensionKey = "dt.entity.service"
+		settings.EventEntityDimensionKey = "dt.entity.service"
+	}
+	return settings
+}
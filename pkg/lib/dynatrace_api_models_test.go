@@ -120,3 +120,20 @@ func Test_getMetricEventAggregation(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricEvent_toSettingsWithAutoAdaptiveBaseline(t *testing.T) {
+	metricEvent, err := CreateKeptnMetricEvent("sockshop", "dev", "carts", "response_time_p90", "metricSelector=builtin:service.response.time:merge(0):percentile(90)", "<=800", 800, 1234)
+	if err != nil {
+		t.Fatalf("CreateKeptnMetricEvent() error = %v", err)
+	}
+	useAutoAdaptiveBaseline(metricEvent, 0)
+
+	if metricEvent.MonitoringStrategy == nil || metricEvent.MonitoringStrategy.AlertCondition != "ABOVE" || metricEvent.MonitoringStrategy.NumberOfSignalFluctuations != 1 {
+		t.Errorf("useAutoAdaptiveBaseline() monitoringStrategy = %v, want an auto-adaptive baseline alerting above 1 signal fluctuation", metricEvent.MonitoringStrategy)
+	}
+
+	settings := metricEvent.toSettings()
+	if settings.ModelProperties.Type != "AUTO_ADAPTIVE_THRESHOLD" || settings.ModelProperties.SignalFluctuation != 1 {
+		t.Errorf("toSettings() modelProperties = %v, want an auto-adaptive threshold with a signal fluctuation of 1", settings.ModelProperties)
+	}
+}
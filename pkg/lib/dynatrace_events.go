@@ -2,26 +2,413 @@ package lib
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 	log "github.com/sirupsen/logrus"
 )
 
-// Sends an event to the Dynatrace events API
+/**
+ * Sends an event to the Dynatrace events API - if the tenant supports the Events API v2, the event is converted and sent to it, see sendEventV2
+ * For the events API v1, an entitySelector in the attachRules of the event is resolved to entity IDs before
+ * If the event is attached to more entity IDs than the configured batch size, it is sent in multiple requests and the results are reported together
+ * Failed requests are retried in the background
+ */
 func (dt *DynatraceHelper) SendEvent(dtEvent interface{}) {
-	log.Info("Sending event to Dynatrace API")
+	logger := logging.FromContext(dt.EventContext)
+	logger.Info("Sending event to Dynatrace API")
 
 	jsonString, err := json.Marshal(dtEvent)
 
 	if err != nil {
-		log.WithError(err).Error("Error while generating Dynatrace API Request payload.")
+		logger.WithError(err).Error("Error while generating Dynatrace API Request payload.")
 		return
 	}
 
-	body, err := dt.sendDynatraceAPIRequest("/api/v1/events", "POST", jsonString)
+	event := map[string]interface{}{}
+	if err := json.Unmarshal(jsonString, &event); err != nil {
+		logger.WithError(err).Error("Error while generating Dynatrace API Request payload.")
+		return
+	}
+
+	if dt.useEventsAPIv2() && dt.sendEventV2(event) {
+		return
+	}
+
+	if err := dt.resolveEntitySelector(event); err != nil {
+		logger.WithError(err).Error("Failed to resolve entitySelector of attachRules")
+		return
+	}
+
+	batches := splitEventIntoBatches(event, GetEventBatchSize(dt.EventContext))
+	var failedBatches []string
+	for i, batch := range batches {
+		jsonString, err := json.Marshal(batch)
+		if err != nil {
+			logger.WithError(err).Error("Error while generating Dynatrace API Request payload.")
+			return
+		}
+
+		err = dt.sendWithRetry("send event to Dynatrace", false, func() error {
+			body, err := dt.sendDynatraceAPIRequest("/api/v1/events", "POST", jsonString)
+			if err != nil {
+				return err
+			}
+			logger.WithField("body", body).Debug("Dynatrace API has accepted the event")
+			return nil
+		})
+		if err != nil {
+			failedBatches = append(failedBatches, fmt.Sprintf("%d: %s", i+1, err.Error()))
+		}
+	}
+
+	if len(failedBatches) > 0 {
+		logger.WithFields(
+			log.Fields{
+				"batches":       len(batches),
+				"failedBatches": failedBatches,
+			}).Error("Failed sending Dynatrace API request - failed batches will be retried")
+	} else if len(batches) > 1 {
+		logger.WithField("batches", len(batches)).Info("Dynatrace API has accepted all batches of the event")
+	}
+}
+
+/**
+ * Replaces the entitySelector of the attachRules of an event by the IDs of the matching entities, as the events API doesn't support entity selectors
+ * Events without entitySelector are not changed
+ */
+func (dt *DynatraceHelper) resolveEntitySelector(event map[string]interface{}) error {
+	attachRules, ok := event["attachRules"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	entitySelector, ok := attachRules["entitySelector"].(string)
+	if !ok {
+		return nil
+	}
+	delete(attachRules, "entitySelector")
+
+	// nothing is sent to Dynatrace when running locally
+	if entitySelector == "" || common.RunLocal || common.RunLocalTest {
+		return nil
+	}
+
+	entityIDs, err := dt.GetEntityIDs(entitySelector)
+	if err != nil {
+		return err
+	}
+	if len(entityIDs) > 0 {
+		existingIDs, _ := attachRules["entityIds"].([]interface{})
+		for _, entityID := range entityIDs {
+			existingIDs = append(existingIDs, entityID)
+		}
+		attachRules["entityIds"] = existingIDs
+	}
+	return nil
+}
+
+/**
+ * Splits an event that is attached to more entity IDs than the batch size into multiple events with at most batchSize entity IDs each
+ * Tag rules are only part of the first event, so that the entities matching them don't get the event multiple times
+ */
+func splitEventIntoBatches(event map[string]interface{}, batchSize int) []map[string]interface{} {
+	attachRules, ok := event["attachRules"].(map[string]interface{})
+	if !ok {
+		return []map[string]interface{}{event}
+	}
+	entityIDs, _ := attachRules["entityIds"].([]interface{})
+	if batchSize <= 0 || len(entityIDs) <= batchSize {
+		return []map[string]interface{}{event}
+	}
+
+	var batches []map[string]interface{}
+	for start := 0; start < len(entityIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(entityIDs) {
+			end = len(entityIDs)
+		}
+
+		batchAttachRules := map[string]interface{}{"entityIds": entityIDs[start:end]}
+		if tagRule, ok := attachRules["tagRule"]; ok && start == 0 {
+			batchAttachRules["tagRule"] = tagRule
+		}
+
+		batch := make(map[string]interface{}, len(event))
+		for key, value := range event {
+			batch[key] = value
+		}
+		batch["attachRules"] = batchAttachRules
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// eventsAPIv2Support caches per tenant whether it supports the Events API v2, so that the support is only detected once per dynatrace-service
+var eventsAPIv2Support = struct {
+	mutex   sync.Mutex
+	tenants map[string]bool
+}{tenants: map[string]bool{}}
+
+// getEventsAPIv2Support returns whether the tenant supports the Events API v2 and whether this has been detected already
+func getEventsAPIv2Support(tenant string) (bool, bool) {
+	eventsAPIv2Support.mutex.Lock()
+	defer eventsAPIv2Support.mutex.Unlock()
+	supported, detected := eventsAPIv2Support.tenants[tenant]
+	return supported, detected
+}
+
+func setEventsAPIv2Support(tenant string, supported bool) {
+	eventsAPIv2Support.mutex.Lock()
+	defer eventsAPIv2Support.mutex.Unlock()
+	eventsAPIv2Support.tenants[tenant] = supported
+}
+
+/**
+ * useEventsAPIv2 returns whether events are sent to the Events API v2
+ * With EVENTS_API set to auto, the Events API v2 is used until the first request shows that the tenant doesn't support it
+ */
+func (dt *DynatraceHelper) useEventsAPIv2() bool {
+	switch GetEventsAPI() {
+	case "v2":
+		return true
+	case "auto":
+		supported, detected := getEventsAPIv2Support(dt.DynatraceCreds.Tenant)
+		return !detected || supported
+	}
+	return false
+}
+
+/**
+ * Sends an event to the Events API v2 - it is converted into one event per entity selector of its attachRules, see convertEventToV2
+ * Returns false if the support of the tenant is detected with this event and it doesn't support the Events API v2, so that the event is sent to the events API v1 instead
+ */
+func (dt *DynatraceHelper) sendEventV2(event map[string]interface{}) bool {
+	logger := logging.FromContext(dt.EventContext)
+
+	events, err := convertEventToV2(event, GetEventBatchSize(dt.EventContext))
 	if err != nil {
-		log.WithError(err).Error("Failed sending Dynatrace API request")
-	} else {
-		log.WithField("body", body).Debug("Dynatrace API has accepted the event")
+		logger.WithError(err).Error("Error while generating Dynatrace API Request payload.")
+		return true
 	}
 
+	var failedEvents []string
+	for i, v2Event := range events {
+		jsonString, err := json.Marshal(v2Event)
+		if err != nil {
+			logger.WithError(err).Error("Error while generating Dynatrace API Request payload.")
+			return true
+		}
+
+		send := func() error {
+			body, err := dt.sendDynatraceAPIRequest("/api/v2/events/ingest", "POST", jsonString)
+			if err != nil {
+				return err
+			}
+			logger.WithField("body", body).Debug("Dynatrace API has accepted the event")
+			return nil
+		}
+
+		// the first request detects whether the tenant supports the Events API v2, its result is passed on as first attempt of the retries
+		if _, detected := getEventsAPIv2Support(dt.DynatraceCreds.Tenant); GetEventsAPI() == "auto" && !detected {
+			firstErr := send()
+			supported := !isEventsAPIv2UnavailableError(firstErr)
+			setEventsAPIv2Support(dt.DynatraceCreds.Tenant, supported)
+			if !supported {
+				logger.WithError(firstErr).Info("Events API v2 is not available - using events API v1")
+				return false
+			}
+
+			firstAttempt := true
+			nextSend := send
+			send = func() error {
+				if firstAttempt {
+					firstAttempt = false
+					return firstErr
+				}
+				return nextSend()
+			}
+		}
+
+		if err := dt.sendWithRetry("send event to Dynatrace", false, send); err != nil {
+			failedEvents = append(failedEvents, fmt.Sprintf("%d: %s", i+1, err.Error()))
+		}
+	}
+
+	if len(failedEvents) > 0 {
+		logger.WithFields(
+			log.Fields{
+				"events":       len(events),
+				"failedEvents": failedEvents,
+			}).Error("Failed sending Dynatrace API request - failed events will be retried")
+	} else if len(events) > 1 {
+		logger.WithField("events", len(events)).Info("Dynatrace API has accepted all events")
+	}
+	return true
+}
+
+// isEventsAPIv2UnavailableError returns whether the request failed because the tenant doesn't provide the Events API v2 - a missing events.ingest scope (403) is reported as error
+func isEventsAPIv2UnavailableError(err error) bool {
+	var requestErr *apiRequestError
+	return errors.As(err, &requestErr) && requestErr.statusCode == http.StatusNotFound
+}
+
+// eventV2PropertyKeys are the Events API v2 properties of the fields of the events API v1 that have a predefined property
+var eventV2PropertyKeys = map[string]string{
+	"deploymentName":    "dt.event.deployment.name",
+	"deploymentVersion": "dt.event.deployment.version",
+	"deploymentProject": "dt.event.deployment.project",
+	"ciBackLink":        "dt.event.deployment.ci_back_link",
+	"remediationAction": "dt.event.deployment.remediation_action_link",
+	"description":       "dt.event.description",
+}
+
+/**
+ * Converts an event of the events API v1 into events of the Events API v2, e.g:
+ * {"eventType": "CUSTOM_DEPLOYMENT", "deploymentName": "...", "attachRules": {...}, "customProperties": {...}} into
+ * {"eventType": "CUSTOM_DEPLOYMENT", "title": "...", "entitySelector": "...", "properties": {"dt.event.deployment.name": "...", ...}}
+ * The Events API v2 only accepts one entity selector per event, so one event is created for the entitySelector, each batch of at most batchSize entityIds
+ * and each tag rule and entity type of the attachRules
+ * The customProperties and all other fields of the event become properties - fields with a predefined property use it, see eventV2PropertyKeys
+ */
+func convertEventToV2(event map[string]interface{}, batchSize int) ([]map[string]interface{}, error) {
+	attachRules := config.DtAttachRules{}
+	if rules, ok := event["attachRules"]; ok {
+		jsonString, err := json.Marshal(rules)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(jsonString, &attachRules); err != nil {
+			return nil, fmt.Errorf("could not decode attachRules: %v", err)
+		}
+	}
+
+	properties := map[string]interface{}{}
+	if customProperties, ok := event["customProperties"].(map[string]interface{}); ok {
+		for key, value := range customProperties {
+			properties[key] = value
+		}
+	}
+	for key, value := range event {
+		switch key {
+		case "eventType", "title", "attachRules", "customProperties":
+			continue
+		}
+		if value == nil || value == "" {
+			continue
+		}
+		if propertyKey, ok := eventV2PropertyKeys[key]; ok {
+			key = propertyKey
+		}
+		properties[key] = value
+	}
+
+	base := map[string]interface{}{
+		"eventType":  event["eventType"],
+		"title":      getEventV2Title(event),
+		"properties": properties,
+	}
+
+	var selectors []string
+	if attachRules.EntitySelector != "" {
+		selectors = append(selectors, attachRules.EntitySelector)
+	}
+	for _, batch := range splitEntityIDsIntoBatches(attachRules.EntityIds, batchSize) {
+		selectors = append(selectors, getEntityIDSelector(batch))
+	}
+	selectors = append(selectors, GetAttachRuleSelectors(attachRules)...)
+	if len(selectors) == 0 {
+		return []map[string]interface{}{base}, nil
+	}
+
+	events := make([]map[string]interface{}, 0, len(selectors))
+	for _, selector := range selectors {
+		v2Event := make(map[string]interface{}, len(base)+1)
+		for key, value := range base {
+			v2Event[key] = value
+		}
+		v2Event["entitySelector"] = selector
+		events = append(events, v2Event)
+	}
+	return events, nil
+}
+
+// getEventV2Title returns the title of the event, which is required by the Events API v2 - events without title use their deployment name, annotation type or event type
+func getEventV2Title(event map[string]interface{}) string {
+	for _, key := range []string{"title", "deploymentName", "annotationType", "eventType"} {
+		if title, ok := event[key].(string); ok && title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// splitEntityIDsIntoBatches splits the entity IDs into batches of at most batchSize entity IDs like splitEventIntoBatches
+func splitEntityIDsIntoBatches(entityIDs []string, batchSize int) [][]string {
+	if len(entityIDs) == 0 {
+		return nil
+	}
+	if batchSize <= 0 || len(entityIDs) <= batchSize {
+		return [][]string{entityIDs}
+	}
+
+	var batches [][]string
+	for start := 0; start < len(entityIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(entityIDs) {
+			end = len(entityIDs)
+		}
+		batches = append(batches, entityIDs[start:end])
+	}
+	return batches
+}
+
+// getEntityIDSelector returns the entity selector of the entity IDs, e.g: entityId("SERVICE-1","SERVICE-2")
+func getEntityIDSelector(entityIDs []string) string {
+	return "entityId(\"" + strings.Join(entityIDs, "\",\"") + "\")"
+}
+
+/**
+ * Converts the tag rules of attachRules into entity selectors - one per tag rule and entity type, e.g:
+ * type(SERVICE),tag("keptn_project:sockshop"),tag("[Environment]keptn_stage:staging")
+ */
+func GetAttachRuleSelectors(attachRules config.DtAttachRules) []string {
+	var selectors []string
+	for _, tagRule := range attachRules.TagRule {
+		var tagConditions []string
+		for _, tag := range tagRule.Tags {
+			tagConditions = append(tagConditions, getTagCondition(tag))
+		}
+		for _, meType := range tagRule.MeTypes {
+			selectors = append(selectors, strings.Join(append([]string{"type(" + meType + ")"}, tagConditions...), ","))
+		}
+	}
+	return selectors
+}
+
+// contexts of tags as used in attachRules and how they are referenced in entity selectors
+var tagSelectorContexts = map[string]string{
+	"ENVIRONMENT":   "Environment",
+	"KUBERNETES":    "Kubernetes",
+	"AWS":           "AWS",
+	"AZURE":         "Azure",
+	"CLOUD_FOUNDRY": "CloudFoundry",
+	"GOOGLE_CLOUD":  "GoogleCloud",
+}
+
+// getTagCondition returns the entity selector condition of a tag, e.g: tag("[Environment]keptn_stage:staging")
+func getTagCondition(tag config.DtTag) string {
+	tagString := tag.Key
+	if tag.Value != "" {
+		tagString = tagString + ":" + tag.Value
+	}
+	if context, ok := tagSelectorContexts[tag.Context]; ok {
+		tagString = "[" + context + "]" + tagString
+	}
+	return "tag(\"" + strings.ReplaceAll(tagString, "\"", "\\\"") + "\")"
 }
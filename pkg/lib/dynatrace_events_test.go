@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitEventIntoBatches(t *testing.T) {
+	event := map[string]interface{}{
+		"eventType": "CUSTOM_INFO",
+		"attachRules": map[string]interface{}{
+			"entityIds": []interface{}{"SERVICE-1", "SERVICE-2", "SERVICE-3"},
+			"tagRule":   []interface{}{"rule"},
+		},
+	}
+
+	batches := splitEventIntoBatches(event, 2)
+	if len(batches) != 2 {
+		t.Errorf("splitEventIntoBatches() returned %d batches, want 2", len(batches))
+		return
+	}
+
+	want := []map[string]interface{}{
+		{"entityIds": []interface{}{"SERVICE-1", "SERVICE-2"}, "tagRule": []interface{}{"rule"}},
+		{"entityIds": []interface{}{"SERVICE-3"}},
+	}
+	for i, batch := range batches {
+		if batch["eventType"] != "CUSTOM_INFO" {
+			t.Errorf("splitEventIntoBatches() batch %d eventType = %v, want CUSTOM_INFO", i, batch["eventType"])
+		}
+		if !reflect.DeepEqual(batch["attachRules"], want[i]) {
+			t.Errorf("splitEventIntoBatches() batch %d attachRules = %v, want %v", i, batch["attachRules"], want[i])
+		}
+	}
+
+	if got := splitEventIntoBatches(event, 100); len(got) != 1 {
+		t.Errorf("splitEventIntoBatches() returned %d batches, want 1", len(got))
+	}
+}
+
+func TestConvertEventToV2(t *testing.T) {
+	event := map[string]interface{}{
+		"eventType": "CUSTOM_DEPLOYMENT",
+		"source":    "Keptn dynatrace-service",
+		"attachRules": map[string]interface{}{
+			"entityIds":      []interface{}{"SERVICE-1", "SERVICE-2", "SERVICE-3"},
+			"entitySelector": "type(SERVICE),entityName(carts)",
+			"tagRule": []interface{}{
+				map[string]interface{}{
+					"meTypes": []interface{}{"SERVICE", "PROCESS_GROUP"},
+					"tags":    []interface{}{map[string]interface{}{"context": "CONTEXTLESS", "key": "keptn_service", "value": "carts"}},
+				},
+			},
+		},
+		"customProperties":  map[string]interface{}{"Project": "sockshop"},
+		"deploymentName":    "Deploy carts",
+		"deploymentVersion": "0.12.1",
+		"ciBackLink":        "",
+	}
+
+	got, err := convertEventToV2(event, 2)
+	if err != nil {
+		t.Fatalf("convertEventToV2() error = %v", err)
+	}
+
+	wantSelectors := []string{
+		"type(SERVICE),entityName(carts)",
+		`entityId("SERVICE-1","SERVICE-2")`,
+		`entityId("SERVICE-3")`,
+		`type(SERVICE),tag("keptn_service:carts")`,
+		`type(PROCESS_GROUP),tag("keptn_service:carts")`,
+	}
+	if len(got) != len(wantSelectors) {
+		t.Fatalf("convertEventToV2() returned %d events, want %d", len(got), len(wantSelectors))
+	}
+	wantProperties := map[string]interface{}{
+		"Project":                     "sockshop",
+		"source":                      "Keptn dynatrace-service",
+		"dt.event.deployment.name":    "Deploy carts",
+		"dt.event.deployment.version": "0.12.1",
+	}
+	for i, v2Event := range got {
+		if v2Event["entitySelector"] != wantSelectors[i] {
+			t.Errorf("convertEventToV2() event %d entitySelector = %v, want %v", i, v2Event["entitySelector"], wantSelectors[i])
+		}
+		if v2Event["eventType"] != "CUSTOM_DEPLOYMENT" || v2Event["title"] != "Deploy carts" {
+			t.Errorf("convertEventToV2() event %d eventType = %v and title = %v, want CUSTOM_DEPLOYMENT and Deploy carts", i, v2Event["eventType"], v2Event["title"])
+		}
+		if !reflect.DeepEqual(v2Event["properties"], wantProperties) {
+			t.Errorf("convertEventToV2() event %d properties = %v, want %v", i, v2Event["properties"], wantProperties)
+		}
+	}
+
+	got, err = convertEventToV2(map[string]interface{}{"eventType": "CUSTOM_INFO"}, 2)
+	if err != nil {
+		t.Fatalf("convertEventToV2() error = %v", err)
+	}
+	if len(got) != 1 || got[0]["entitySelector"] != nil || got[0]["title"] != "CUSTOM_INFO" {
+		t.Errorf("convertEventToV2() = %v, want one event without entitySelector and the event type as title", got)
+	}
+}
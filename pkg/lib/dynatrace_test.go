@@ -3,7 +3,9 @@ package lib
 import (
 	"bytes"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
@@ -130,3 +132,70 @@ func TestDynatraceHelper_createClient(t *testing.T) {
 		})
 	}
 }
+
+func TestConfiguredEntities_GetResults(t *testing.T) {
+	entities := &ConfiguredEntities{
+		ManagementZonesEnabled: true,
+		ManagementZones: []ConfigResult{
+			{Name: "Keptn: sockshop", Success: true, Action: ConfigActionCreated},
+			{Name: "Keptn: sockshop dev", Success: false, Action: ConfigActionUpdated, Message: "Could not update management zone"},
+		},
+		ProblemNotificationsEnabled: true,
+		ProblemNotifications:        ConfigResult{Success: true, Message: "Successfully set up Keptn Alerting Profile and Problem Notifications"},
+		MetricEventsEnabled:         false,
+		MetricEvents:                []ConfigResult{{Name: "error_rate (Keptn.sockshop.dev.carts)", Success: true}},
+	}
+
+	want := []ConfiguredEntityResult{
+		{Type: "managementZone", Name: "Keptn: sockshop", Action: ConfigActionCreated, Success: true},
+		{Type: "managementZone", Name: "Keptn: sockshop dev", Action: ConfigActionUpdated, Success: false, Error: "Could not update management zone"},
+		{Type: "problemNotification", Name: "Keptn Problem Notification", Action: ConfigActionConfigured, Success: true, Message: "Successfully set up Keptn Alerting Profile and Problem Notifications"},
+	}
+	got := entities.GetResults()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetResults() = %v, want %v", got, want)
+	}
+}
+
+func TestDynatraceHelper_sendDynatraceAPIRequest_RotatedToken(t *testing.T) {
+	var receivedTokens []string
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedTokens = append(receivedTokens, request.Header.Get("Authorization"))
+		if request.Header.Get("Authorization") != "Api-Token new-token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.Write([]byte(`{}`))
+	}))
+	defer dtMockServer.Close()
+
+	currentToken := "old-token"
+	originalRefreshDynatraceCredentials := refreshDynatraceCredentials
+	refreshDynatraceCredentials = func(creds *credentials.DTCredentials) (*credentials.DTCredentials, error) {
+		return &credentials.DTCredentials{Tenant: creds.Tenant, ApiToken: currentToken, SecretName: creds.SecretName}, nil
+	}
+	defer func() { refreshDynatraceCredentials = originalRefreshDynatraceCredentials }()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL, ApiToken: "old-token", SecretName: "dynatrace"})
+
+	// the token in the secret hasn't changed yet, so the request must not be repeated
+	if _, err := dt.sendDynatraceAPIRequest("/api/v1/time", "GET", nil); err == nil {
+		t.Errorf("sendDynatraceAPIRequest() expected an error for a rejected token")
+	}
+	if len(receivedTokens) != 1 {
+		t.Errorf("sendDynatraceAPIRequest() sent %d requests, want 1", len(receivedTokens))
+	}
+
+	receivedTokens = nil
+	currentToken = "new-token"
+	if _, err := dt.sendDynatraceAPIRequest("/api/v1/time", "GET", nil); err != nil {
+		t.Errorf("sendDynatraceAPIRequest() error = %v", err)
+	}
+	wantTokens := []string{"Api-Token old-token", "Api-Token new-token"}
+	if !reflect.DeepEqual(receivedTokens, wantTokens) {
+		t.Errorf("sendDynatraceAPIRequest() sent tokens %v, want %v", receivedTokens, wantTokens)
+	}
+	if dt.DynatraceCreds.ApiToken != "new-token" {
+		t.Errorf("sendDynatraceAPIRequest() kept token %s, want new-token", dt.DynatraceCreds.ApiToken)
+	}
+}
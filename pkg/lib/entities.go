@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const entitiesPageSize = 500
+
+// GetEntityIDs returns the IDs of all entities matching the passed entity selector, e.g: type(SERVICE),tag(keptn_service:carts)
+func (dt *DynatraceHelper) GetEntityIDs(entitySelector string) ([]string, error) {
+	var entityIDs []string
+
+	query := "/api/v2/entities?entitySelector=" + url.QueryEscape(entitySelector) + "&pageSize=" + strconv.Itoa(entitiesPageSize)
+	for {
+		response, err := dt.sendDynatraceAPIRequest(query, http.MethodGet, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch entities for entity selector %s: %v", entitySelector, err)
+		}
+
+		dtEntities := &dtEntityListResponse{}
+		err = json.Unmarshal([]byte(response), dtEntities)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode response from Dynatrace API: %v", err)
+		}
+
+		for _, entity := range dtEntities.Entities {
+			entityIDs = append(entityIDs, entity.EntityID)
+		}
+
+		if dtEntities.NextPageKey == "" {
+			return entityIDs, nil
+		}
+		query = "/api/v2/entities?nextPageKey=" + url.QueryEscape(dtEntities.NextPageKey)
+	}
+}
+
+// GetEntityCount returns the number of entities matching the passed entity selector
+func (dt *DynatraceHelper) GetEntityCount(entitySelector string) (int, error) {
+	query := "/api/v2/entities?entitySelector=" + url.QueryEscape(entitySelector) + "&pageSize=1"
+	response, err := dt.sendDynatraceAPIRequest(query, http.MethodGet, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not fetch entities for entity selector %s: %v", entitySelector, err)
+	}
+
+	dtEntities := &dtEntityListResponse{}
+	err = json.Unmarshal([]byte(response), dtEntities)
+	if err != nil {
+		return 0, fmt.Errorf("could not decode response from Dynatrace API: %v", err)
+	}
+	return dtEntities.TotalCount, nil
+}
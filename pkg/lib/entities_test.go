@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_GetEntityIDs(t *testing.T) {
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(200)
+		if request.URL.Query().Get("nextPageKey") == "page2" {
+			writer.Write([]byte(`{"totalCount": 3, "pageSize": 2, "entities": [{"entityId": "SERVICE-3"}]}`))
+			return
+		}
+		if request.URL.Query().Get("entitySelector") != "type(SERVICE),tag(keptn_service:carts)" {
+			t.Errorf("GetEntityIDs(): unexpected entitySelector %s", request.URL.Query().Get("entitySelector"))
+		}
+		writer.Write([]byte(`{"totalCount": 3, "pageSize": 2, "nextPageKey": "page2", "entities": [{"entityId": "SERVICE-1"}, {"entityId": "SERVICE-2"}]}`))
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	got, err := dt.GetEntityIDs("type(SERVICE),tag(keptn_service:carts)")
+	if err != nil {
+		t.Errorf("GetEntityIDs() error = %v", err)
+		return
+	}
+
+	want := []string{"SERVICE-1", "SERVICE-2", "SERVICE-3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetEntityIDs() = %v, want %v", got, want)
+	}
+}
+
+func TestDynatraceHelper_GetEntityCount(t *testing.T) {
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("pageSize") != "1" {
+			t.Errorf("GetEntityCount(): unexpected pageSize %s", request.URL.Query().Get("pageSize"))
+		}
+		writer.WriteHeader(200)
+		writer.Write([]byte(`{"totalCount": 42, "pageSize": 1, "nextPageKey": "page2", "entities": [{"entityId": "SERVICE-1"}]}`))
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	got, err := dt.GetEntityCount("type(SERVICE)")
+	if err != nil {
+		t.Errorf("GetEntityCount() error = %v", err)
+		return
+	}
+	if got != 42 {
+		t.Errorf("GetEntityCount() = %v, want %v", got, 42)
+	}
+}
+
+func TestDynatraceHelper_SendEvent_ResolvesEntitySelector(t *testing.T) {
+	var sentAttachRules map[string]interface{}
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/api/v2/entities":
+			if request.URL.Query().Get("entitySelector") != "type(SERVICE),entityName(carts)" {
+				t.Errorf("SendEvent(): unexpected entitySelector %s", request.URL.Query().Get("entitySelector"))
+			}
+			writer.WriteHeader(200)
+			writer.Write([]byte(`{"totalCount": 1, "pageSize": 500, "entities": [{"entityId": "SERVICE-2"}]}`))
+		case "/api/v1/events":
+			body, _ := ioutil.ReadAll(request.Body)
+			event := map[string]interface{}{}
+			if err := json.Unmarshal(body, &event); err != nil {
+				t.Errorf("SendEvent(): could not parse event: %v", err)
+			}
+			sentAttachRules, _ = event["attachRules"].(map[string]interface{})
+			writer.WriteHeader(200)
+			writer.Write([]byte(`{"storedEventIds": [1]}`))
+		default:
+			t.Errorf("SendEvent(): unexpected path %s", request.URL.Path)
+		}
+	}))
+	defer dtMockServer.Close()
+
+	// only the events API v1 requires the entitySelector to be resolved
+	os.Setenv("EVENTS_API", "v1")
+	defer os.Unsetenv("EVENTS_API")
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	dt.SendEvent(struct {
+		EventType   string               `json:"eventType"`
+		AttachRules config.DtAttachRules `json:"attachRules"`
+	}{
+		EventType: "CUSTOM_INFO",
+		AttachRules: config.DtAttachRules{
+			EntityIds:      []string{"SERVICE-1"},
+			EntitySelector: "type(SERVICE),entityName(carts)",
+		},
+	})
+
+	if _, ok := sentAttachRules["entitySelector"]; ok {
+		t.Errorf("SendEvent(): entitySelector was sent to the events API")
+	}
+	want := []interface{}{"SERVICE-1", "SERVICE-2"}
+	if !reflect.DeepEqual(sentAttachRules["entityIds"], want) {
+		t.Errorf("SendEvent(): entityIds = %v, want %v", sentAttachRules["entityIds"], want)
+	}
+}
+
+func TestDynatraceHelper_SendEvent_EventsAPIv2(t *testing.T) {
+	tests := []struct {
+		name         string
+		eventsAPI    string
+		ingestStatus int
+		wantV2       int
+		wantV1       int
+	}{
+		{
+			name:         "tenant supports the Events API v2",
+			eventsAPI:    "auto",
+			ingestStatus: 201,
+			wantV2:       2,
+			wantV1:       0,
+		},
+		{
+			name:         "tenant doesn't support the Events API v2",
+			eventsAPI:    "auto",
+			ingestStatus: 404,
+			wantV2:       1,
+			wantV1:       2,
+		},
+		{
+			name:         "missing events.ingest scope is not a missing Events API v2",
+			eventsAPI:    "auto",
+			ingestStatus: 403,
+			wantV2:       2,
+			wantV1:       0,
+		},
+		{
+			name:         "events API v1 is used by default",
+			ingestStatus: 201,
+			wantV2:       0,
+			wantV1:       2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v2Requests := 0
+			v1Requests := 0
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				switch request.URL.Path {
+				case "/api/v2/events/ingest":
+					v2Requests++
+					body, _ := ioutil.ReadAll(request.Body)
+					event := map[string]interface{}{}
+					if err := json.Unmarshal(body, &event); err != nil {
+						t.Errorf("SendEvent(): could not parse event: %v", err)
+					}
+					if event["entitySelector"] != `entityId("SERVICE-1")` {
+						t.Errorf("SendEvent(): entitySelector = %v, want entityId(\"SERVICE-1\")", event["entitySelector"])
+					}
+					writer.WriteHeader(tt.ingestStatus)
+				case "/api/v1/events":
+					v1Requests++
+					writer.WriteHeader(200)
+					writer.Write([]byte(`{"storedEventIds": [1]}`))
+				default:
+					t.Errorf("SendEvent(): unexpected path %s", request.URL.Path)
+				}
+			}))
+			defer dtMockServer.Close()
+
+			os.Setenv("EVENTS_API", tt.eventsAPI)
+			defer os.Unsetenv("EVENTS_API")
+
+			os.Setenv("RETRY_ATTEMPTS", "0")
+			defer os.Unsetenv("RETRY_ATTEMPTS")
+
+			// the second event must use the API detected for the tenant, even though it is sent by another DynatraceHelper
+			for i := 0; i < 2; i++ {
+				dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+				dt.SendEvent(struct {
+					EventType   string               `json:"eventType"`
+					Title       string               `json:"title"`
+					AttachRules config.DtAttachRules `json:"attachRules"`
+				}{
+					EventType:   "CUSTOM_INFO",
+					Title:       "Keptn evaluation",
+					AttachRules: config.DtAttachRules{EntityIds: []string{"SERVICE-1"}},
+				})
+			}
+
+			if v2Requests != tt.wantV2 || v1Requests != tt.wantV1 {
+				t.Errorf("SendEvent() sent %d requests to the Events API v2 and %d to v1, want %d and %d", v2Requests, v1Requests, tt.wantV2, tt.wantV1)
+			}
+		})
+	}
+}
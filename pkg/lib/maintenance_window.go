@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+// maintenanceWindowTimeFormat is the format of the start and end of a maintenance window of the configuration API v1
+const maintenanceWindowTimeFormat = "2006-01-02 15:04"
+
+// CreateMaintenanceWindow creates a maintenance window that starts now and lasts for the given duration unless it's closed earlier
+func (dt *DynatraceHelper) CreateMaintenanceWindow(name string, description string, suppression string, scope *MaintenanceWindowScope, duration time.Duration) error {
+	logger := logging.FromContext(dt.EventContext)
+	start := time.Now().UTC().Truncate(time.Minute)
+	maintenanceWindow := &MaintenanceWindow{
+		Name:        name,
+		Description: description,
+		Type:        "PLANNED",
+		Suppression: suppression,
+		Scope:       scope,
+		Schedule: MaintenanceWindowSchedule{
+			RecurrenceType: "ONCE",
+			Start:          start.Format(maintenanceWindowTimeFormat),
+			End:            start.Add(duration).Format(maintenanceWindowTimeFormat),
+			ZoneID:         "UTC",
+		},
+	}
+
+	payload, err := json.Marshal(maintenanceWindow)
+	if err != nil {
+		return err
+	}
+
+	logger.WithField("name", name).Info("Creating maintenance window")
+	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/maintenanceWindows", "POST", payload)
+	if err != nil {
+		return fmt.Errorf("could not create maintenance window: %v", err)
+	}
+	return nil
+}
+
+/**
+ * CloseMaintenanceWindow ends the maintenance window with the given name now, i.e. problems are detected and alerted again
+ * The maintenance window is kept so that it's still visible in Dynatrace
+ */
+func (dt *DynatraceHelper) CloseMaintenanceWindow(name string) error {
+	logger := logging.FromContext(dt.EventContext)
+	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/maintenanceWindows", "GET", nil)
+	if err != nil {
+		return fmt.Errorf("could not retrieve maintenance windows: %v", err)
+	}
+	maintenanceWindows := &DTAPIListResponse{}
+	if err := json.Unmarshal([]byte(response), maintenanceWindows); err != nil {
+		return fmt.Errorf("could not parse maintenance windows: %v", err)
+	}
+
+	for _, mw := range maintenanceWindows.Values {
+		if mw.Name != name {
+			continue
+		}
+
+		response, err := dt.sendDynatraceAPIRequest("/api/config/v1/maintenanceWindows/"+mw.ID, "GET", nil)
+		if err != nil {
+			return fmt.Errorf("could not retrieve maintenance window: %v", err)
+		}
+		maintenanceWindow := &MaintenanceWindow{}
+		if err := json.Unmarshal([]byte(response), maintenanceWindow); err != nil {
+			return fmt.Errorf("could not parse maintenance window: %v", err)
+		}
+
+		// the end has to be after the start - both only have a precision of minutes
+		end := time.Now().UTC().Truncate(time.Minute).Add(time.Minute)
+		if start, err := time.Parse(maintenanceWindowTimeFormat, maintenanceWindow.Schedule.Start); err == nil && !end.After(start) {
+			end = start.Add(time.Minute)
+		}
+		maintenanceWindow.Schedule.End = end.Format(maintenanceWindowTimeFormat)
+		maintenanceWindow.Schedule.ZoneID = "UTC"
+		maintenanceWindow.ID = ""
+
+		payload, err := json.Marshal(maintenanceWindow)
+		if err != nil {
+			return err
+		}
+
+		logger.WithField("name", name).Info("Closing maintenance window")
+		_, err = dt.sendDynatraceAPIRequest("/api/config/v1/maintenanceWindows/"+mw.ID, "PUT", payload)
+		if err != nil {
+			return fmt.Errorf("could not close maintenance window: %v", err)
+		}
+		return nil
+	}
+
+	logger.WithField("name", name).Warn("Could not find maintenance window to close")
+	return nil
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_CreateMaintenanceWindow(t *testing.T) {
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost || request.URL.Path != "/api/config/v1/maintenanceWindows" {
+			t.Errorf("CreateMaintenanceWindow(): unexpected request %s %s", request.Method, request.URL.Path)
+		}
+
+		body, _ := ioutil.ReadAll(request.Body)
+		maintenanceWindow := &MaintenanceWindow{}
+		if err := json.Unmarshal(body, maintenanceWindow); err != nil {
+			t.Errorf("CreateMaintenanceWindow(): could not parse payload: %v", err)
+		}
+
+		start, _ := time.Parse(maintenanceWindowTimeFormat, maintenanceWindow.Schedule.Start)
+		end, _ := time.Parse(maintenanceWindowTimeFormat, maintenanceWindow.Schedule.End)
+		if end.Sub(start) != 30*time.Minute {
+			t.Errorf("CreateMaintenanceWindow(): duration = %v, want %v", end.Sub(start), 30*time.Minute)
+		}
+		if maintenanceWindow.Suppression != "DONT_DETECT_PROBLEMS" || maintenanceWindow.Schedule.RecurrenceType != "ONCE" {
+			t.Errorf("CreateMaintenanceWindow(): unexpected maintenance window %v", maintenanceWindow)
+		}
+		writer.WriteHeader(201)
+		writer.Write([]byte(`{"id": "mw-1", "name": "Keptn deployment"}`))
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	scope := &MaintenanceWindowScope{Entities: []string{"SERVICE-123"}, Matches: []MaintenanceWindowMatch{}}
+	if err := dt.CreateMaintenanceWindow("Keptn deployment", "deployment of carts", "DONT_DETECT_PROBLEMS", scope, 30*time.Minute); err != nil {
+		t.Errorf("CreateMaintenanceWindow() error = %v", err)
+	}
+}
+
+func TestDynatraceHelper_CloseMaintenanceWindow(t *testing.T) {
+	start := time.Now().UTC().Add(-10 * time.Minute).Format(maintenanceWindowTimeFormat)
+	closed := false
+
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method + " " + request.URL.Path {
+		case "GET /api/config/v1/maintenanceWindows":
+			writer.Write([]byte(`{"values": [{"id": "mw-0", "name": "other"}, {"id": "mw-1", "name": "Keptn deployment"}]}`))
+		case "GET /api/config/v1/maintenanceWindows/mw-1":
+			writer.Write([]byte(`{"id": "mw-1", "name": "Keptn deployment", "schedule": {"recurrenceType": "ONCE", "start": "` + start + `", "end": "2099-01-01 00:00", "zoneId": "UTC"}}`))
+		case "PUT /api/config/v1/maintenanceWindows/mw-1":
+			body, _ := ioutil.ReadAll(request.Body)
+			maintenanceWindow := &MaintenanceWindow{}
+			if err := json.Unmarshal(body, maintenanceWindow); err != nil {
+				t.Errorf("CloseMaintenanceWindow(): could not parse payload: %v", err)
+			}
+			end, _ := time.Parse(maintenanceWindowTimeFormat, maintenanceWindow.Schedule.End)
+			if end.After(time.Now().UTC().Add(2 * time.Minute)) {
+				t.Errorf("CloseMaintenanceWindow(): end = %s, want now", maintenanceWindow.Schedule.End)
+			}
+			closed = true
+			writer.WriteHeader(204)
+		default:
+			t.Errorf("CloseMaintenanceWindow(): unexpected request %s %s", request.Method, request.URL.Path)
+		}
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	if err := dt.CloseMaintenanceWindow("Keptn deployment"); err != nil {
+		t.Errorf("CloseMaintenanceWindow() error = %v", err)
+	}
+	if !closed {
+		t.Errorf("CloseMaintenanceWindow() did not update the maintenance window")
+	}
+}
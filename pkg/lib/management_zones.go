@@ -2,114 +2,382 @@ package lib
 
 import (
 	"encoding/json"
-	"fmt"
+	"strings"
 
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
-	log "github.com/sirupsen/logrus"
 )
 
-// CreateManagementZones creates a new management zone for the project
+// keptnOwnershipMarker is the prefix of the description of the configuration entities that are managed by the dynatrace-service
+const keptnOwnershipMarker = "Managed by Keptn dynatrace-service"
+
+// getKeptnProjects returns the names of all Keptn projects - it is a variable so that it can be replaced in tests
+var getKeptnProjects = func() ([]string, error) {
+	projects, err := keptnapi.NewProjectHandler(common.GetShipyardControllerURL()).GetAllProjects()
+	if err != nil {
+		return nil, err
+	}
+	var projectNames []string
+	for _, project := range projects {
+		projectNames = append(projectNames, project.ProjectName)
+	}
+	return projectNames, nil
+}
+
+/**
+ * CreateManagementZones creates or updates the management zones for the project and its stages
+ * The management zones are identified by the ownership marker in their description, so re-running configure monitoring converges the configuration:
+ * changed management zones are updated and management zones of stages or projects that no longer exist in Keptn are deleted
+ */
 func (dt *DynatraceHelper) CreateManagementZones(project string, shipyard keptnv2.Shipyard) {
-	if !IsManagementZonesGenerationEnabled() {
+	if !dt.isManagementZonesGenerationEnabled() {
 		return
 	}
 	// get existing management zones
-	mzs := dt.getManagementZones()
+	existingMZs := dt.getKeptnManagementZones()
 
-	found := false
-	for _, mz := range mzs {
-		if mz.Name == "Keptn: "+project {
-			found = true
+	projectManagementZone := CreateManagementZoneForProject(project)
+	projectManagementZone.Name = dt.getProjectManagementZoneName(project)
+	managementZones := []*ManagementZone{projectManagementZone}
+	for _, stage := range shipyard.Spec.Stages {
+		stageManagementZone := CreateManagementZoneForStage(project, stage.Name)
+		stageManagementZone.Name = dt.getStageManagementZoneName(project, stage.Name)
+		managementZones = append(managementZones, stageManagementZone)
+		if dt.managementZones == nil {
+			continue
+		}
+
+		for _, filter := range dt.managementZones.StageFilters {
+			if filter.Stage == "" || filter.Stage == stage.Name {
+				addManagementZoneTagConditions(stageManagementZone, filter.Tags)
+			}
+		}
+		for _, additionalMZ := range dt.managementZones.Additional {
+			if additionalMZ.Name == "" || (additionalMZ.Stage != "" && additionalMZ.Stage != stage.Name) {
+				continue
+			}
+			managementZone := CreateManagementZoneForStage(project, stage.Name)
+			managementZone.Name = stageManagementZone.Name + " " + additionalMZ.Name
+			managementZone.Description = getAdditionalManagementZoneOwnershipMarker(project, stage.Name, additionalMZ.Name)
+			// the conditions of the stage filters also apply to the additional management zones
+			managementZone.Rules[0].Conditions = append([]MZConditions{}, stageManagementZone.Rules[0].Conditions...)
+			addManagementZoneTagConditions(managementZone, additionalMZ.Tags)
+			managementZones = append(managementZones, managementZone)
 		}
 	}
 
-	if !found {
-		managementZone := CreateManagementZoneForProject(project)
-		mzPayload, err := json.Marshal(managementZone)
-		if err == nil {
-			_, err := dt.sendDynatraceAPIRequest("/api/config/v1/managementZones", "POST", mzPayload)
+	for _, managementZone := range managementZones {
+		dt.createOrUpdateManagementZone(managementZone, existingMZs)
+	}
 
-			if err != nil {
-				// Error occurred but continue
+	dt.deleteStaleManagementZones(project, managementZones, existingMZs)
+}
 
-				log.WithError(err).Error("Failed to create management zone")
+func (dt *DynatraceHelper) createOrUpdateManagementZone(managementZone *ManagementZone, existingMZs []*ManagementZone) {
+	logger := logging.FromContext(dt.EventContext)
+	mzPayload, err := json.Marshal(managementZone)
+	if err != nil {
+		logger.WithError(err).Error("Failed to marshal management zone")
+		dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
+			Name:    managementZone.Name,
+			Success: false,
+			Action:  ConfigActionCreated,
+			Message: "failed to marshal management zone: " + err.Error(),
+		})
+		return
+	}
 
-				dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
-					Name:    "Keptn: " + project,
-					Success: false,
-					Message: "failed to create management zone: " + err.Error(),
-				})
-			} else {
-				dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
-					Name:    "Keptn: " + project,
-					Success: true,
-				})
-			}
-		} else {
-			// TODO: Check what happens to this error?
+	existingMZ := findManagementZone(managementZone, existingMZs)
+	if existingMZ == nil {
+		_, err = dt.sendDynatraceAPIRequest("/api/config/v1/managementZones", "POST", mzPayload)
+		if err != nil {
 			// Error occurred but continue
-			fmt.Errorf("failed to marshal management zone: %v", err)
+			logger.WithError(err).Error("Could not create management zone")
+			dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
+				Name:    managementZone.Name,
+				Success: false,
+				Action:  ConfigActionCreated,
+				Message: "Could not create management zone: " + err.Error(),
+			})
+			return
 		}
-	} else {
 		dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
-			Name:    "Keptn: " + project,
+			Name:    managementZone.Name,
 			Success: true,
-			Message: "Management Zone 'Keptn:" + project + "' was already available in your Tenant",
+			Action:  ConfigActionCreated,
 		})
+		return
 	}
 
-	for _, stage := range shipyard.Spec.Stages {
-		found := false
-		for _, mz := range mzs {
-			if mz.Name == getManagementZoneNameForStage(project, stage.Name) {
-				found = true
-			}
+	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/managementZones/"+existingMZ.ID, "PUT", mzPayload)
+	if err != nil {
+		// Error occurred but continue
+		logger.WithError(err).Error("Could not update management zone")
+		dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
+			Name:    managementZone.Name,
+			Success: false,
+			Action:  ConfigActionUpdated,
+			Message: "Could not update management zone: " + err.Error(),
+		})
+		return
+	}
+	dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
+		Name:    managementZone.Name,
+		Success: true,
+		Action:  ConfigActionUpdated,
+		Message: "Management Zone '" + managementZone.Name + "' was already available in your Tenant and has been updated",
+	})
+}
+
+/**
+ * Deletes the management zones managed by this Keptn installation that belong to stages of the project that are no longer part of the shipyard.
+ * With CLEANUP_DELETED_PROJECTS enabled, the management zones of projects that no longer exist in Keptn are deleted as well, e.g: because the project was renamed
+ */
+func (dt *DynatraceHelper) deleteStaleManagementZones(project string, managementZones []*ManagementZone, existingMZs []*ManagementZone) {
+	logger := logging.FromContext(dt.EventContext)
+	var keptnProjects []string
+	projectsLoaded := false
+
+	for _, existingMZ := range existingMZs {
+		mzProject, _, isManagedByKeptn := parseManagementZoneOwnershipMarker(existingMZ.Description)
+		if !isManagedByKeptn || !isManagedByThisInstallation(existingMZ.Description) || findManagementZone(existingMZ, managementZones) != nil {
+			continue
 		}
 
-		if !found {
-			managementZone := CreateManagementZoneForStage(project, stage.Name)
-			mzPayload, _ := json.Marshal(managementZone)
-			_, err := dt.sendDynatraceAPIRequest("/api/config/v1/managementZones", "POST", mzPayload)
-			if err != nil {
-				log.WithError(err).Error("Could not create management zone")
-				dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
-					Name:    managementZone.Name,
-					Success: false,
-					Message: "Could not create management zone: " + err.Error(),
-				})
-			} else {
-				dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
-					Name:    managementZone.Name,
-					Success: true,
-				})
+		if mzProject != project {
+			if !IsDeletedProjectsCleanupEnabled(dt.EventContext) {
+				continue
 			}
-		} else {
+			if !projectsLoaded {
+				projects, err := getKeptnProjects()
+				if err != nil {
+					logger.WithError(err).Warn("Could not retrieve Keptn projects - management zones of other projects are not cleaned up")
+					return
+				}
+				keptnProjects = projects
+				projectsLoaded = true
+			}
+			if containsString(keptnProjects, mzProject) {
+				continue
+			}
+		}
+
+		_, err := dt.sendDynatraceAPIRequest("/api/config/v1/managementZones/"+existingMZ.ID, "DELETE", nil)
+		if err != nil {
+			// Error occurred but continue
+			logger.WithError(err).WithField("name", existingMZ.Name).Error("Could not delete stale management zone")
 			dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
-				Name:    "Keptn: " + project + " " + stage.Name,
-				Success: true,
-				Message: "Management Zone 'Keptn:" + project + " " + stage.Name + "' was already available in your Tenant",
+				Name:    existingMZ.Name,
+				Success: false,
+				Action:  ConfigActionDeleted,
+				Message: "Could not delete stale management zone: " + err.Error(),
 			})
+			continue
 		}
+		dt.configuredEntities.ManagementZones = append(dt.configuredEntities.ManagementZones, ConfigResult{
+			Name:    existingMZ.Name,
+			Success: true,
+			Action:  ConfigActionDeleted,
+			Message: "Management Zone '" + existingMZ.Name + "' was deleted as its project or stage no longer exists in Keptn",
+		})
 	}
+}
 
-	return
+/**
+ * findManagementZone returns the management zone with the same ownership marker or - for management zones created without a marker - with the same name
+ * Management zones with the marker of another project, stage or installation are never matched by their name, so that they aren't overwritten
+ */
+func findManagementZone(managementZone *ManagementZone, managementZones []*ManagementZone) *ManagementZone {
+	for _, mz := range managementZones {
+		if mz.Description != "" && mz.Description == managementZone.Description {
+			return mz
+		}
+	}
+	for _, mz := range managementZones {
+		if _, _, hasMarker := parseManagementZoneOwnershipMarker(mz.Description); hasMarker {
+			continue
+		}
+		if mz.Name == managementZone.Name {
+			return mz
+		}
+	}
+	return nil
 }
 
 func getManagementZoneNameForStage(project string, stage string) string {
 	return "Keptn: " + project + " " + stage
 }
 
+// getProjectManagementZoneName returns the name of the management zone of the project - Keptn: <project> unless managementZoneNames.project of the dynatrace.conf.yaml is set
+func (dt *DynatraceHelper) getProjectManagementZoneName(project string) string {
+	logger := logging.FromContext(dt.EventContext)
+	if dt.managementZoneNames == nil || dt.managementZoneNames.Project == "" {
+		return "Keptn: " + project
+	}
+	if !strings.Contains(dt.managementZoneNames.Project, "$PROJECT") {
+		logger.WithField("template", dt.managementZoneNames.Project).Warn("Management zone name template of projects doesn't contain $PROJECT - using the default name")
+		return "Keptn: " + project
+	}
+	return replaceManagementZoneNamePlaceholders(dt.managementZoneNames.Project, project, "")
+}
+
+// getStageManagementZoneName returns the name of the management zone of the stage - Keptn: <project> <stage> unless managementZoneNames.stage of the dynatrace.conf.yaml is set
+func (dt *DynatraceHelper) getStageManagementZoneName(project string, stage string) string {
+	logger := logging.FromContext(dt.EventContext)
+	if dt.managementZoneNames == nil || dt.managementZoneNames.Stage == "" {
+		return getManagementZoneNameForStage(project, stage)
+	}
+	if !strings.Contains(dt.managementZoneNames.Stage, "$PROJECT") || !strings.Contains(dt.managementZoneNames.Stage, "$STAGE") {
+		logger.WithField("template", dt.managementZoneNames.Stage).Warn("Management zone name template of stages doesn't contain $PROJECT and $STAGE - using the default name")
+		return getManagementZoneNameForStage(project, stage)
+	}
+	return replaceManagementZoneNamePlaceholders(dt.managementZoneNames.Stage, project, stage)
+}
+
+func replaceManagementZoneNamePlaceholders(template string, project string, stage string) string {
+	name := strings.ReplaceAll(template, "$PROJECT", project)
+	return strings.ReplaceAll(name, "$STAGE", stage)
+}
+
+/**
+ * isKeptnManagementZoneCandidate returns whether the management zone may have been created by Keptn, i.e. its name starts with Keptn:
+ * or with the text before the first placeholder of a configured name template - the ownership marker is checked afterwards
+ */
+func (dt *DynatraceHelper) isKeptnManagementZoneCandidate(name string) bool {
+	if strings.HasPrefix(name, "Keptn: ") {
+		return true
+	}
+	if dt.managementZoneNames == nil {
+		return false
+	}
+	for _, template := range []string{dt.managementZoneNames.Project, dt.managementZoneNames.Stage} {
+		if template == "" {
+			continue
+		}
+		if strings.HasPrefix(name, strings.SplitN(template, "$", 2)[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * getManagementZoneOwnershipMarker returns the description of a management zone managed by Keptn, e.g: Managed by Keptn dynatrace-service (project=sockshop, stage=dev).
+ * If KEPTN_INSTALLATION_ID is set, it is added as installation, e.g: Managed by Keptn dynatrace-service (project=sockshop, stage=dev, installation=staging)
+ */
+func getManagementZoneOwnershipMarker(project string, stage string) string {
+	marker := keptnOwnershipMarker + " (project=" + project
+	if stage != "" {
+		marker = marker + ", stage=" + stage
+	}
+	if installationID := GetInstallationID(); installationID != "" {
+		marker = marker + ", installation=" + installationID
+	}
+	return marker + ")"
+}
+
+// getAdditionalManagementZoneOwnershipMarker returns the description of an additional management zone of a stage, e.g: Managed by Keptn dynatrace-service (project=sockshop, stage=production, zone=primary)
+func getAdditionalManagementZoneOwnershipMarker(project string, stage string, zone string) string {
+	return strings.TrimSuffix(getManagementZoneOwnershipMarker(project, stage), ")") + ", zone=" + zone + ")"
+}
+
+// addManagementZoneTagConditions adds a condition per tag to the service rules of the management zone - tags are either key:value or a key
+func addManagementZoneTagConditions(managementZone *ManagementZone, tags []string) {
+	for i := range managementZone.Rules {
+		for _, tag := range tags {
+			condition := MZConditions{
+				Key: MZKey{
+					Attribute: "SERVICE_TAGS",
+				},
+				ComparisonInfo: MZComparisonInfo{
+					Type:     "TAG",
+					Operator: "EQUALS",
+					Value: MZValue{
+						Context: "CONTEXTLESS",
+					},
+					Negate: false,
+				},
+			}
+			keyValue := strings.SplitN(tag, ":", 2)
+			condition.ComparisonInfo.Value.Key = keyValue[0]
+			if len(keyValue) == 2 {
+				condition.ComparisonInfo.Value.Value = keyValue[1]
+			} else {
+				condition.ComparisonInfo.Operator = "TAG_KEY_EQUALS"
+			}
+			managementZone.Rules[i].Conditions = append(managementZone.Rules[i].Conditions, condition)
+		}
+	}
+}
+
+// parseManagementZoneOwnershipMarker returns the project and stage of a management zone managed by Keptn
+func parseManagementZoneOwnershipMarker(description string) (string, string, bool) {
+	project := getOwnershipMarkerField(description, "project")
+	return project, getOwnershipMarkerField(description, "stage"), project != ""
+}
+
+// isManagedByThisInstallation returns whether the installation of the ownership marker is the KEPTN_INSTALLATION_ID - markers without installation belong to installations without ID
+func isManagedByThisInstallation(description string) bool {
+	return getOwnershipMarkerField(description, "installation") == GetInstallationID()
+}
+
+// hasOwnershipMarker returns whether the description of a configuration entity starts with the ownership marker of the dynatrace-service
+func hasOwnershipMarker(description string) bool {
+	return strings.HasPrefix(description, keptnOwnershipMarker)
+}
+
+// getOwnershipMarkerField returns the value of a field of the ownership marker, e.g: dev for the field stage
+func getOwnershipMarkerField(description string, field string) string {
+	if !strings.HasPrefix(description, keptnOwnershipMarker+" (") || !strings.HasSuffix(description, ")") {
+		return ""
+	}
+	fields := strings.TrimSuffix(strings.TrimPrefix(description, keptnOwnershipMarker+" ("), ")")
+	for _, f := range strings.Split(fields, ", ") {
+		if strings.HasPrefix(f, field+"=") {
+			return strings.TrimPrefix(f, field+"=")
+		}
+	}
+	return ""
+}
+
+// getKeptnManagementZones returns the details of the management zones that were created by Keptn - either with an ownership marker or named Keptn: ...
+func (dt *DynatraceHelper) getKeptnManagementZones() []*ManagementZone {
+	logger := logging.FromContext(dt.EventContext)
+	var managementZones []*ManagementZone
+	for _, mz := range dt.getManagementZones() {
+		if !dt.isKeptnManagementZoneCandidate(mz.Name) {
+			continue
+		}
+		response, err := dt.sendDynatraceAPIRequest("/api/config/v1/managementZones/"+mz.ID, "GET", nil)
+		if err != nil {
+			logger.WithError(err).WithField("name", mz.Name).Error("Failed to retrieve management zone")
+			continue
+		}
+		managementZone := &ManagementZone{}
+		if err := json.Unmarshal([]byte(response), managementZone); err != nil {
+			logger.WithError(err).WithField("name", mz.Name).Error("Failed to parse management zone")
+			continue
+		}
+		managementZone.ID = mz.ID
+		managementZones = append(managementZones, managementZone)
+	}
+	return managementZones
+}
+
 func (dt *DynatraceHelper) getManagementZones() []Values {
+	logger := logging.FromContext(dt.EventContext)
 	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/managementZones", "GET", nil)
 	if err != nil {
-		log.WithError(err).Error("Failed to retrieve management zones")
+		logger.WithError(err).Error("Failed to retrieve management zones")
 		return nil
 	}
 	mzs := &DTAPIListResponse{}
 
 	err = json.Unmarshal([]byte(response), mzs)
 	if err != nil {
-		log.WithError(err).Error("Failed to parse management zones list")
+		logger.WithError(err).Error("Failed to parse management zones list")
 		return nil
 	}
 	return mzs.Values
@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestDynatraceHelper_CreateManagementZones(t *testing.T) {
+	tests := []struct {
+		name                   string
+		installationID         string
+		cleanupDeletedProjects string
+		wantRequests           []string
+		wantUntouched          []string
+	}{
+		{
+			name: "delete management zones of removed stages",
+			wantRequests: []string{
+				"DELETE /api/config/v1/managementZones/3",
+				"POST /api/config/v1/managementZones",
+				"PUT /api/config/v1/managementZones/1",
+				"PUT /api/config/v1/managementZones/2",
+			},
+		},
+		{
+			name:                   "delete management zones of deleted projects if enabled",
+			cleanupDeletedProjects: "true",
+			wantRequests: []string{
+				"DELETE /api/config/v1/managementZones/3",
+				"DELETE /api/config/v1/managementZones/4",
+				"POST /api/config/v1/managementZones",
+				"PUT /api/config/v1/managementZones/1",
+				"PUT /api/config/v1/managementZones/2",
+			},
+		},
+		{
+			name:                   "only delete management zones of the same installation",
+			installationID:         "staging",
+			cleanupDeletedProjects: "true",
+			wantRequests: []string{
+				"DELETE /api/config/v1/managementZones/7",
+				"POST /api/config/v1/managementZones",
+				"POST /api/config/v1/managementZones",
+				"PUT /api/config/v1/managementZones/1",
+			},
+			// the management zone of the dev stage belongs to the installation without ID
+			wantUntouched: []string{"2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existingMZs := map[string]string{
+				"1": `{"id": "1", "name": "Keptn: sockshop", "rules": []}`,
+				"2": `{"id": "2", "name": "Keptn: sockshop dev", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=dev)", "rules": []}`,
+				"3": `{"id": "3", "name": "Keptn: sockshop old", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=old)", "rules": []}`,
+				"4": `{"id": "4", "name": "Keptn: renamed", "description": "Managed by Keptn dynatrace-service (project=renamed)", "rules": []}`,
+				"5": `{"id": "5", "name": "Keptn: other", "description": "Managed by Keptn dynatrace-service (project=other)", "rules": []}`,
+				"7": `{"id": "7", "name": "Keptn: removed", "description": "Managed by Keptn dynatrace-service (project=removed, installation=staging)", "rules": []}`,
+			}
+
+			var requests []string
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method == http.MethodGet && request.URL.Path == "/api/config/v1/managementZones" {
+					writer.Write([]byte(`{"values": [{"id": "1", "name": "Keptn: sockshop"}, {"id": "2", "name": "Keptn: sockshop dev"}, {"id": "3", "name": "Keptn: sockshop old"}, {"id": "4", "name": "Keptn: renamed"}, {"id": "5", "name": "Keptn: other"}, {"id": "6", "name": "Production"}, {"id": "7", "name": "Keptn: removed"}]}`))
+					return
+				}
+				if request.Method == http.MethodGet {
+					mz, ok := existingMZs[strings.TrimPrefix(request.URL.Path, "/api/config/v1/managementZones/")]
+					if !ok {
+						t.Errorf("CreateManagementZones(): unexpected request of %s", request.URL.Path)
+					}
+					writer.Write([]byte(mz))
+					return
+				}
+				requests = append(requests, request.Method+" "+request.URL.Path)
+				writer.WriteHeader(204)
+			}))
+			defer dtMockServer.Close()
+
+			os.Setenv("GENERATE_MANAGEMENT_ZONES", "true")
+			defer os.Unsetenv("GENERATE_MANAGEMENT_ZONES")
+			os.Setenv("KEPTN_INSTALLATION_ID", tt.installationID)
+			defer os.Unsetenv("KEPTN_INSTALLATION_ID")
+			os.Setenv("CLEANUP_DELETED_PROJECTS", tt.cleanupDeletedProjects)
+			defer os.Unsetenv("CLEANUP_DELETED_PROJECTS")
+
+			originalGetKeptnProjects := getKeptnProjects
+			getKeptnProjects = func() ([]string, error) {
+				return []string{"sockshop", "other"}, nil
+			}
+			defer func() { getKeptnProjects = originalGetKeptnProjects }()
+
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+			dt.configuredEntities = &ConfiguredEntities{}
+
+			shipyard := keptnv2.Shipyard{}
+			shipyard.Spec.Stages = []keptnv2.Stage{{Name: "dev"}, {Name: "prod"}}
+
+			dt.CreateManagementZones("sockshop", shipyard)
+
+			sort.Strings(requests)
+			if strings.Join(requests, "\n") != strings.Join(tt.wantRequests, "\n") {
+				t.Errorf("CreateManagementZones() requests = %v, want %v", requests, tt.wantRequests)
+			}
+
+			for _, id := range tt.wantUntouched {
+				for _, request := range requests {
+					if strings.HasSuffix(request, "/api/config/v1/managementZones/"+id) {
+						t.Errorf("CreateManagementZones() sent %s, want management zone %s of another installation to be left alone", request, id)
+					}
+				}
+			}
+
+			for _, result := range dt.configuredEntities.ManagementZones {
+				if !result.Success {
+					t.Errorf("CreateManagementZones() failed for %s: %s", result.Name, result.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestParseManagementZoneOwnershipMarker(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		wantProject string
+		wantStage   string
+		wantOK      bool
+	}{
+		{
+			name:        "stage management zone",
+			description: getManagementZoneOwnershipMarker("sockshop", "dev"),
+			wantProject: "sockshop",
+			wantStage:   "dev",
+			wantOK:      true,
+		},
+		{
+			name:        "project management zone",
+			description: getManagementZoneOwnershipMarker("sockshop", ""),
+			wantProject: "sockshop",
+			wantOK:      true,
+		},
+		{
+			name:        "management zone of an installation",
+			description: "Managed by Keptn dynatrace-service (project=sockshop, stage=dev, installation=staging)",
+			wantProject: "sockshop",
+			wantStage:   "dev",
+			wantOK:      true,
+		},
+		{
+			name:        "management zone not managed by Keptn",
+			description: "created manually",
+			wantOK:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, stage, ok := parseManagementZoneOwnershipMarker(tt.description)
+			if project != tt.wantProject || stage != tt.wantStage || ok != tt.wantOK {
+				t.Errorf("parseManagementZoneOwnershipMarker() = %s, %s, %v, want %s, %s, %v", project, stage, ok, tt.wantProject, tt.wantStage, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_getManagementZoneNames(t *testing.T) {
+	tests := []struct {
+		name        string
+		templates   *config.DtManagementZoneNames
+		wantProject string
+		wantStage   string
+	}{
+		{
+			name:        "default names",
+			templates:   nil,
+			wantProject: "Keptn: sockshop",
+			wantStage:   "Keptn: sockshop dev",
+		},
+		{
+			name:        "name templates",
+			templates:   &config.DtManagementZoneNames{Project: "MZ-$PROJECT", Stage: "MZ-$PROJECT-$STAGE"},
+			wantProject: "MZ-sockshop",
+			wantStage:   "MZ-sockshop-dev",
+		},
+		{
+			name:        "name templates without placeholders",
+			templates:   &config.DtManagementZoneNames{Project: "MZ", Stage: "MZ-$PROJECT"},
+			wantProject: "Keptn: sockshop",
+			wantStage:   "Keptn: sockshop dev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{})
+			dt.managementZoneNames = tt.templates
+			if got := dt.getProjectManagementZoneName("sockshop"); got != tt.wantProject {
+				t.Errorf("getProjectManagementZoneName() = %s, want %s", got, tt.wantProject)
+			}
+			if got := dt.getStageManagementZoneName("sockshop", "dev"); got != tt.wantStage {
+				t.Errorf("getStageManagementZoneName() = %s, want %s", got, tt.wantStage)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_isKeptnManagementZoneCandidate(t *testing.T) {
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{})
+	dt.managementZoneNames = &config.DtManagementZoneNames{Stage: "MZ-$PROJECT-$STAGE"}
+
+	for name, want := range map[string]bool{
+		"Keptn: sockshop dev": true,
+		"MZ-sockshop-dev":     true,
+		"Production":          false,
+	} {
+		if got := dt.isKeptnManagementZoneCandidate(name); got != want {
+			t.Errorf("isKeptnManagementZoneCandidate(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDynatraceHelper_CreateManagementZonesWithScoping(t *testing.T) {
+	var createdMZs []*ManagementZone
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodGet {
+			writer.Write([]byte(`{"values": []}`))
+			return
+		}
+		managementZone := &ManagementZone{}
+		if err := json.NewDecoder(request.Body).Decode(managementZone); err != nil {
+			t.Errorf("CreateManagementZones(): invalid management zone: %v", err)
+		}
+		createdMZs = append(createdMZs, managementZone)
+		writer.Write([]byte(`{"id": "1"}`))
+	}))
+	defer dtMockServer.Close()
+
+	os.Setenv("GENERATE_MANAGEMENT_ZONES", "true")
+	defer os.Unsetenv("GENERATE_MANAGEMENT_ZONES")
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+	dt.configuredEntities = &ConfiguredEntities{}
+	dt.managementZones = &config.DtManagementZones{
+		StageFilters: []config.DtManagementZoneFilter{{Stage: "prod", Tags: []string{"owner:team-a"}}},
+		Additional:   []config.DtAdditionalManagementZone{{Name: "primary", Tags: []string{"keptn_deployment:primary"}}},
+	}
+
+	shipyard := keptnv2.Shipyard{}
+	shipyard.Spec.Stages = []keptnv2.Stage{{Name: "dev"}, {Name: "prod"}}
+
+	dt.CreateManagementZones("sockshop", shipyard)
+
+	wantConditions := map[string]int{
+		"Keptn: sockshop":              1,
+		"Keptn: sockshop dev":          2,
+		"Keptn: sockshop dev primary":  3,
+		"Keptn: sockshop prod":         3,
+		"Keptn: sockshop prod primary": 4,
+	}
+	if len(createdMZs) != len(wantConditions) {
+		t.Fatalf("CreateManagementZones() created %d management zones, want %d", len(createdMZs), len(wantConditions))
+	}
+	for _, mz := range createdMZs {
+		want, ok := wantConditions[mz.Name]
+		if !ok {
+			t.Errorf("CreateManagementZones() created unexpected management zone %s", mz.Name)
+			continue
+		}
+		if len(mz.Rules[0].Conditions) != want {
+			t.Errorf("CreateManagementZones() management zone %s has %d conditions, want %d", mz.Name, len(mz.Rules[0].Conditions), want)
+		}
+	}
+	if createdMZs[2].Description != "Managed by Keptn dynatrace-service (project=sockshop, stage=dev, zone=primary)" {
+		t.Errorf("CreateManagementZones() description = %s, want the ownership marker of the additional management zone", createdMZs[2].Description)
+	}
+}
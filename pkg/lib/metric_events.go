@@ -13,21 +13,23 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 
-	configutils "github.com/keptn/go-utils/pkg/api/utils"
 	keptn "github.com/keptn/go-utils/pkg/lib"
 )
 
 // CreateMetricEvents creates new metric events if SLOs are specified
 func (dt *DynatraceHelper) CreateMetricEvents(project string, stage string, service string) {
-	if !IsMetricEventsGenerationEnabled() {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isMetricEventsGenerationEnabled() {
 		return
 	}
 
-	log.Info("Creating custom metric events for project SLIs")
+	logger.Info("Creating custom metric events for project SLIs")
 	slos, err := retrieveSLOs(project, stage, service)
 	if err != nil {
-		log.WithError(err).WithFields(
+		logger.WithError(err).WithFields(
 			log.Fields{
 				"service": service,
 				"stage":   stage}).Info("No SLOs defined for service. Skipping creation of custom metric events.")
@@ -36,32 +38,47 @@ func (dt *DynatraceHelper) CreateMetricEvents(project string, stage string, serv
 	// get custom metrics for project
 	projectCustomQueries, err := dt.getCustomQueries(project, stage, service)
 	if err != nil {
-		log.WithError(err).WithField("project", project).Error("Failed to get custom queries for project")
+		logger.WithError(err).WithField("project", project).Error("Failed to get custom queries for project")
 		return
 	}
 
 	managementZones := dt.getManagementZones()
 	var mzId int64 = -1
 	for _, mz := range managementZones {
-		if mz.Name == getManagementZoneNameForStage(project, stage) {
+		if mz.Name == dt.getStageManagementZoneName(project, stage) {
 			mzId, _ = strconv.ParseInt(mz.ID, 10, 64)
 		}
 	}
 	if mzId < 0 {
-		log.WithFields(log.Fields{
-			"project": project,
-			"stage":   stage,
+		logger.WithFields(log.Fields{
+			"project":        project,
+			"stage":          stage,
+			"managementZone": dt.getStageManagementZoneName(project, stage),
 		}).Error("No management zone found")
 		return
 	}
 
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		logger.WithError(err).Error("Could not create metric events")
+		return
+	}
+	var existingMetricEvents []settingsObject
+	if useSettingsAPI {
+		existingMetricEvents, err = dt.getSettingsObjects(metricEventSchemaID, settingsEnvironmentScope)
+		if err != nil {
+			logger.WithError(err).Error("Could not retrieve list of existing Dynatrace metric events")
+			return
+		}
+	}
+
 	metricEventCreated := false
 	// try to create metric events using best effort.
 	for _, objective := range slos.Objectives {
-		config, err := getTimeseriesConfig(objective.SLI, projectCustomQueries)
+		query, err := getTimeseriesConfig(objective.SLI, projectCustomQueries)
 		if err != nil {
 			// Error occurred but continue
-			log.WithField("sli", objective.SLI).Error("Could not find query for SLI")
+			logger.WithField("sli", objective.SLI).Error("Could not find query for SLI")
 		}
 		for _, criteria := range objective.Pass {
 			for _, crit := range criteria.Criteria {
@@ -69,65 +86,41 @@ func (dt *DynatraceHelper) CreateMetricEvents(project string, stage string, serv
 				criteriaObject, err := parseCriteriaString(crit)
 				if err != nil {
 					// Error occurred but continue
-					log.WithError(err).WithField("criteria", crit).Error("Could not parse criteria")
+					logger.WithError(err).WithField("criteria", crit).Error("Could not parse criteria")
 					continue
 				}
 				if criteriaObject.IsComparison {
 					// comparison-based criteria cannot be mapped to alerts
 					continue
 				}
-				newMetricEvent, err := CreateKeptnMetricEvent(project, stage, service, objective.SLI, config, crit, criteriaObject.Value, mzId)
+				newMetricEvent, err := CreateKeptnMetricEvent(project, stage, service, objective.SLI, query, crit, criteriaObject.Value, mzId)
 				if err != nil {
 					// Error occurred but continue
-					log.WithError(err).WithFields(
+					logger.WithError(err).WithFields(
 						log.Fields{
 							"sli":      objective.SLI,
 							"criteria": crit,
 						}).Error("Could not create metric event definition for criteria")
 					continue
 				}
-
-				event, err := dt.GetMetricEvent(newMetricEvent.Name)
-				if err != nil {
-					// Error occurred but continue
-					log.WithError(err).Error("Could not get metric event")
-					continue
-				}
-
-				apiURL := "/api/config/v1/anomalyDetection/metricEvents"
-				apiMethod := "POST"
-
-				mePayload, err := json.Marshal(newMetricEvent)
-				if err != nil {
-					// Error occurred but continue
-					log.WithError(err).Error("Could not marshal metric event")
-					continue
+				if indicator := dt.getMetricEventIndicator(objective.SLI); indicator != nil && indicator.Model == config.MetricEventModelAutoAdaptive {
+					useAutoAdaptiveBaseline(newMetricEvent, indicator.SignalFluctuation)
 				}
 
-				if event != nil {
-					// adapt all properties that have initially been defaulted to some value from previous (potentially modified event)
-					event.Threshold = newMetricEvent.Threshold
-					event.TagFilters = nil
-					apiURL = apiURL + "/" + event.ID
-					apiMethod = "PUT"
-					mePayload, err = json.Marshal(event)
-					if err != nil {
-						// Error occurred but continue
-						log.WithError(err).Error("Could not marshal metric event")
-						continue
-					}
+				if useSettingsAPI {
+					err = dt.upsertMetricEventInSettings(newMetricEvent, existingMetricEvents)
+				} else {
+					err = dt.upsertMetricEvent(newMetricEvent)
 				}
-
-				_, err = dt.sendDynatraceAPIRequest(apiURL, apiMethod, mePayload)
 				if err != nil {
-					log.WithError(err).WithField("metricName", newMetricEvent.Name).Error("Could not create metric event")
+					logger.WithError(err).WithField("metricName", newMetricEvent.Name).Error("Could not create metric event")
 					continue
 				}
 				dt.configuredEntities.MetricEvents = append(dt.configuredEntities.MetricEvents, ConfigResult{
 					Name:    newMetricEvent.Name,
 					Success: true,
 				})
-				log.WithFields(
+				logger.WithFields(
 					log.Fields{
 						"name":     newMetricEvent.Name,
 						"criteria": crit,
@@ -139,11 +132,92 @@ func (dt *DynatraceHelper) CreateMetricEvents(project string, stage string, serv
 
 	if metricEventCreated {
 		// TODO: improve this?
-		log.Info("To review and enable the generated custom metric events, please go to: https://" + dt.DynatraceCreds.Tenant + "/#settings/anomalydetection/metricevents")
+		logger.Info("To review and enable the generated custom metric events, please go to: https://" + dt.DynatraceCreds.Tenant + "/#settings/anomalydetection/metricevents")
 	}
 	return
 }
 
+// upsertMetricEvent creates the metric event via the configuration API v1 or updates the threshold of an existing metric event with the same name
+func (dt *DynatraceHelper) upsertMetricEvent(newMetricEvent *MetricEvent) error {
+	event, err := dt.GetMetricEvent(newMetricEvent.Name)
+	if err != nil {
+		return fmt.Errorf("could not get metric event: %v", err)
+	}
+
+	apiURL := "/api/config/v1/anomalyDetection/metricEvents"
+	apiMethod := "POST"
+
+	mePayload, err := json.Marshal(newMetricEvent)
+	if err != nil {
+		return fmt.Errorf("could not marshal metric event: %v", err)
+	}
+
+	if event != nil {
+		// adapt all properties that have initially been defaulted to some value from previous (potentially modified event)
+		event.Threshold = newMetricEvent.Threshold
+		event.MonitoringStrategy = newMetricEvent.MonitoringStrategy
+		event.Description = newMetricEvent.Description
+		event.TagFilters = nil
+		apiURL = apiURL + "/" + event.ID
+		apiMethod = "PUT"
+		mePayload, err = json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("could not marshal metric event: %v", err)
+		}
+	}
+
+	_, err = dt.sendDynatraceAPIRequest(apiURL, apiMethod, mePayload)
+	return err
+}
+
+// upsertMetricEventInSettings creates the metric event via the Settings 2.0 API or updates an existing metric event with the same summary - it stays enabled if it was enabled by the user
+func (dt *DynatraceHelper) upsertMetricEventInSettings(newMetricEvent *MetricEvent, existingMetricEvents []settingsObject) error {
+	metricEvent := newMetricEvent.toSettings()
+
+	objectID := ""
+	if existingMetricEvent := findSettingsObject(existingMetricEvents, "summary", metricEvent.Summary); existingMetricEvent != nil {
+		objectID = existingMetricEvent.ObjectID
+		existingValue := &MetricEventSettings{}
+		if err := json.Unmarshal(existingMetricEvent.Value, existingValue); err == nil {
+			metricEvent.Enabled = existingValue.Enabled
+		}
+	}
+
+	_, err := dt.upsertSettingsObject(metricEventSchemaID, settingsEnvironmentScope, objectID, metricEvent)
+	return err
+}
+
+const metricEventAutoAdaptiveBaseline = "AUTO_ADAPTIVE_BASELINE"
+
+// getMetricEventIndicator returns the settings of the metricEvents of the dynatrace.conf.yaml for the SLI or nil if there are none
+func (dt *DynatraceHelper) getMetricEventIndicator(sli string) *config.DtMetricEventIndicator {
+	if dt.metricEvents == nil {
+		return nil
+	}
+	for i := range dt.metricEvents.Indicators {
+		if dt.metricEvents.Indicators[i].SLI == sli {
+			return &dt.metricEvents.Indicators[i]
+		}
+	}
+	return nil
+}
+
+// useAutoAdaptiveBaseline lets the metric event alert on deviations from the auto-adaptive baseline of Dynatrace instead of the threshold of the slo.yaml
+func useAutoAdaptiveBaseline(metricEvent *MetricEvent, signalFluctuation float64) {
+	if signalFluctuation <= 0 {
+		signalFluctuation = 1
+	}
+	metricEvent.Description = "Keptn SLI violated: The {metricname} value of {severity} was {alert_condition} the auto-adaptive baseline."
+	metricEvent.MonitoringStrategy = &MEMonitoringStrategy{
+		Type:                       metricEventAutoAdaptiveBaseline,
+		AlertCondition:             metricEvent.AlertCondition,
+		Samples:                    metricEvent.Samples,
+		ViolatingSamples:           metricEvent.ViolatingSamples,
+		DealertingSamples:          metricEvent.DealertingSamples,
+		NumberOfSignalFluctuations: signalFluctuation,
+	}
+}
+
 func (dt *DynatraceHelper) getCustomQueries(project string, stage string, service string) (map[string]string, error) {
 
 	if dt.KeptnHandler == nil {
@@ -158,9 +232,10 @@ func (dt *DynatraceHelper) getCustomQueries(project string, stage string, servic
 }
 
 func (dt *DynatraceHelper) GetMetricEvent(eventKey string) (*MetricEvent, error) {
+	logger := logging.FromContext(dt.EventContext)
 	res, err := dt.sendDynatraceAPIRequest("/api/config/v1/anomalyDetection/metricEvents", "GET", nil)
 	if err != nil {
-		log.WithError(err).Error("Could not retrieve list of existing Dynatrace metric events")
+		logger.WithError(err).Error("Could not retrieve list of existing Dynatrace metric events")
 		return nil, err
 	}
 
@@ -168,7 +243,7 @@ func (dt *DynatraceHelper) GetMetricEvent(eventKey string) (*MetricEvent, error)
 	err = json.Unmarshal([]byte(res), dtMetricEvents)
 
 	if err != nil {
-		log.WithError(err).Error("Could not parse list of existing Dynatrace metric events")
+		logger.WithError(err).Error("Could not parse list of existing Dynatrace metric events")
 		return nil, err
 	}
 
@@ -176,7 +251,7 @@ func (dt *DynatraceHelper) GetMetricEvent(eventKey string) (*MetricEvent, error)
 		if metricEvent.Name == eventKey {
 			res, err = dt.sendDynatraceAPIRequest("/api/config/v1/anomalyDetection/metricEvents/"+metricEvent.ID, "GET", nil)
 			if err != nil {
-				log.WithError(err).WithField("eventKey", eventKey).Error("Could not get existing metric event")
+				logger.WithError(err).WithField("eventKey", eventKey).Error("Could not get existing metric event")
 				return nil, err
 			}
 			retrievedMetricEvent := &MetricEvent{}
@@ -191,9 +266,10 @@ func (dt *DynatraceHelper) GetMetricEvent(eventKey string) (*MetricEvent, error)
 }
 
 func (dt *DynatraceHelper) DeleteExistingMetricEvent(eventKey string) error {
+	logger := logging.FromContext(dt.EventContext)
 	res, err := dt.sendDynatraceAPIRequest("/api/config/v1/anomalyDetection/metricEvents", "GET", nil)
 	if err != nil {
-		log.WithError(err).Error("Could not retrieve list of existing Dynatrace metric events")
+		logger.WithError(err).Error("Could not retrieve list of existing Dynatrace metric events")
 		return err
 	}
 
@@ -201,7 +277,7 @@ func (dt *DynatraceHelper) DeleteExistingMetricEvent(eventKey string) error {
 	err = json.Unmarshal([]byte(res), dtMetricEvents)
 
 	if err != nil {
-		log.WithError(err).Error("Could not parse list of existing Dynatrace metric events")
+		logger.WithError(err).Error("Could not parse list of existing Dynatrace metric events")
 		return err
 	}
 
@@ -209,7 +285,7 @@ func (dt *DynatraceHelper) DeleteExistingMetricEvent(eventKey string) error {
 		if metricEvent.Name == eventKey {
 			res, err = dt.sendDynatraceAPIRequest("/api/config/v1/anomalyDetection/metricEvents/"+metricEvent.ID, "DELETE", nil)
 			if err != nil {
-				log.WithError(err).WithField("eventKey", eventKey).Error("Could not delete existing metric event")
+				logger.WithError(err).WithField("eventKey", eventKey).Error("Could not delete existing metric event")
 				return err
 			}
 		}
@@ -218,7 +294,7 @@ func (dt *DynatraceHelper) DeleteExistingMetricEvent(eventKey string) error {
 }
 
 func retrieveSLOs(project string, stage string, service string) (*keptn.ServiceLevelObjectives, error) {
-	resourceHandler := configutils.NewResourceHandler(common.GetConfigurationServiceURL())
+	resourceHandler := common.NewResourceHandler()
 
 	resource, err := resourceHandler.GetServiceResource(project, stage, service, "slo.yaml")
 	if err != nil || resource.ResourceContent == "" {
@@ -254,7 +330,6 @@ func getTimeseriesConfig(metric string, customQueries map[string]string) (string
 	case ResponseTimeP95:
 		return "builtin:service.response.time:merge(0):percentile(95)?scope=tag(keptn_project:$PROJECT),tag(keptn_stage:$STAGE),tag(keptn_service:$SERVICE),tag(keptn_deployment:$DEPLOYMENT)", nil
 	default:
-		fmt.Sprintf("Unknown metric %s\n", metric)
 		return "", fmt.Errorf("unsupported SLI metric %s", metric)
 	}
 }
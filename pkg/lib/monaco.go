@@ -0,0 +1,428 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+// monacoFolder is the folder of the project resources that contains the Monitoring as Code (monaco) projects applied when configuring the monitoring
+const monacoFolder = "dynatrace/monaco/"
+
+// monacoAPI is an API of monaco, which is the name of the folder of its configurations, and the path of the corresponding configuration API
+type monacoAPI struct {
+	id   string
+	path string
+}
+
+// monacoAPIs are the APIs that are supported in the monaco projects, configurations are applied in this order unless they reference each other
+var monacoAPIs = []monacoAPI{
+	{id: "management-zone", path: "/api/config/v1/managementZones"},
+	{id: "auto-tag", path: "/api/config/v1/autoTags"},
+	{id: "request-attributes", path: "/api/config/v1/service/requestAttributes"},
+	{id: "calculated-metrics-service", path: "/api/config/v1/calculatedMetrics/service"},
+	{id: "conditional-naming-service", path: "/api/config/v1/conditionalNaming/service"},
+	{id: "conditional-naming-processgroup", path: "/api/config/v1/conditionalNaming/processGroup"},
+	{id: "application-web", path: "/api/config/v1/applications/web"},
+	{id: "alerting-profile", path: "/api/config/v1/alertingProfiles"},
+	{id: "notification", path: "/api/config/v1/notifications"},
+	{id: "maintenance-window", path: "/api/config/v1/maintenanceWindows"},
+	{id: "anomaly-detection-metrics", path: "/api/config/v1/anomalyDetection/metricEvents"},
+	{id: "dashboard", path: "/api/config/v1/dashboards"},
+}
+
+func getMonacoAPI(id string) *monacoAPI {
+	for i := range monacoAPIs {
+		if monacoAPIs[i].id == id {
+			return &monacoAPIs[i]
+		}
+	}
+	return nil
+}
+
+// getMonacoProjectResources returns the content of all resources of the project in the monaco folder by their URI, e.g: dynatrace/monaco/infrastructure/management-zone/zones.yaml
+var getMonacoProjectResources = func(project string) (map[string]string, error) {
+	resourceHandler := common.NewResourceHandler()
+	resourceURIs, err := common.GetAllProjectResourceURIs(resourceHandler, project)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := map[string]string{}
+	for _, resourceURI := range resourceURIs {
+		resourceURI = strings.TrimPrefix(resourceURI, "/")
+		if !strings.HasPrefix(resourceURI, monacoFolder) {
+			continue
+		}
+		resource, err := resourceHandler.GetProjectResource(project, resourceURI)
+		if err != nil {
+			return nil, fmt.Errorf("could not read resource %s: %v", resourceURI, err)
+		}
+		resources[resourceURI] = resource.ResourceContent
+	}
+	return resources, nil
+}
+
+/**
+ * monacoConfig is a configuration of a monaco project: the JSON template of the config referenced in the YAML file of its API folder is rendered with its properties, e.g:
+ *   config:
+ *     - zone: "zone.json"
+ *   zone:
+ *     - name: "Keptn: sockshop"
+ *     - tagRuleId: "/infrastructure/auto-tag/keptn.id"
+ * Properties that reference another configuration of the monaco projects with <project>/<api>/<config>.id or .name are replaced by the ID or name it was applied with
+ */
+type monacoConfig struct {
+	// key identifies the configuration by <project>/<api>/<config>, the project is empty for API folders placed directly into the monaco folder
+	key        string
+	api        *monacoAPI
+	template   string
+	properties map[string]string
+	references map[string]string
+}
+
+// monacoAppliedConfig is the ID and name of a configuration that has been applied to the tenant
+type monacoAppliedConfig struct {
+	id   string
+	name string
+}
+
+/**
+ * ApplyMonacoProjects applies the configurations of the monaco projects in the dynatrace/monaco folder of the project resources to the tenant.
+ * Configurations are created or updated by their name, so that they are kept in sync with the Keptn configuration repo every time the monitoring is configured.
+ * The monaco projects are only applied if APPLY_MONACO_PROJECTS is enabled and only configurations of the APIs in MONACO_ALLOWED_API_PATHS are applied
+ */
+func (dt *DynatraceHelper) ApplyMonacoProjects(project string) {
+	logger := logging.FromContext(dt.EventContext)
+	if !IsMonacoEnabled(dt.EventContext) {
+		return
+	}
+
+	resources, err := getMonacoProjectResources(project)
+	if err != nil {
+		logger.WithError(err).Error("Could not read the monaco projects")
+		dt.configuredEntities.MonacoConfigs = append(dt.configuredEntities.MonacoConfigs, ConfigResult{
+			Name:    strings.TrimSuffix(monacoFolder, "/"),
+			Success: false,
+			Message: "could not read the monaco projects: " + err.Error(),
+		})
+		return
+	}
+	if len(resources) == 0 {
+		return
+	}
+
+	configs, results := parseMonacoProjects(resources, GetMonacoAllowedAPIPaths())
+	dt.configuredEntities.MonacoConfigs = append(dt.configuredEntities.MonacoConfigs, results...)
+
+	appliedConfigs := map[string]monacoAppliedConfig{}
+	for len(configs) > 0 {
+		var pendingConfigs []*monacoConfig
+		for _, monacoConfig := range configs {
+			if !monacoConfig.hasAppliedReferences(appliedConfigs) {
+				pendingConfigs = append(pendingConfigs, monacoConfig)
+				continue
+			}
+			appliedConfig, result := dt.applyMonacoConfig(monacoConfig, appliedConfigs)
+			if result.Success {
+				appliedConfigs[monacoConfig.key] = *appliedConfig
+			} else {
+				logger.WithField("config", monacoConfig.key).Error(result.Message)
+			}
+			dt.configuredEntities.MonacoConfigs = append(dt.configuredEntities.MonacoConfigs, result)
+		}
+
+		if len(pendingConfigs) == len(configs) {
+			// none of the remaining configurations can be applied, as the configurations they reference failed or reference each other
+			for _, monacoConfig := range pendingConfigs {
+				dt.configuredEntities.MonacoConfigs = append(dt.configuredEntities.MonacoConfigs, ConfigResult{
+					Name:    monacoConfig.key,
+					Success: false,
+					Message: "references configurations that could not be applied: " + strings.Join(monacoConfig.getReferencedKeys(), ", "),
+				})
+			}
+			return
+		}
+		configs = pendingConfigs
+	}
+}
+
+// applyMonacoConfig renders the configuration and creates it or updates the existing configuration with the same name
+func (dt *DynatraceHelper) applyMonacoConfig(monacoConfig *monacoConfig, appliedConfigs map[string]monacoAppliedConfig) (*monacoAppliedConfig, ConfigResult) {
+	result := ConfigResult{Name: monacoConfig.key}
+
+	payload, err := monacoConfig.render(appliedConfigs)
+	if err != nil {
+		result.Message = err.Error()
+		return nil, result
+	}
+	name := getPlannedChangeEntityName(payload)
+	if name == "" {
+		result.Message = "the rendered configuration has no name"
+		return nil, result
+	}
+	result.Name = monacoConfig.key + " (" + name + ")"
+
+	existingID, err := dt.findMonacoConfigID(monacoConfig.api, name)
+	if err != nil {
+		result.Message = "could not retrieve the existing configurations: " + err.Error()
+		return nil, result
+	}
+
+	entity := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &entity); err != nil {
+		result.Message = "the rendered configuration is no JSON object: " + err.Error()
+		return nil, result
+	}
+	delete(entity, "id")
+	if existingID != "" {
+		entity["id"] = existingID
+	}
+	payload, err = json.Marshal(entity)
+	if err != nil {
+		result.Message = err.Error()
+		return nil, result
+	}
+
+	if existingID != "" {
+		if _, err := dt.sendDynatraceAPIRequest(monacoConfig.api.path+"/"+existingID, "PUT", payload); err != nil {
+			result.Message = "could not update configuration: " + err.Error()
+			return nil, result
+		}
+		result.Success = true
+		result.Action = ConfigActionUpdated
+		result.Message = "Updated successfully"
+		return &monacoAppliedConfig{id: existingID, name: name}, result
+	}
+
+	response, err := dt.sendDynatraceAPIRequest(monacoConfig.api.path, "POST", payload)
+	if err != nil {
+		result.Message = "could not create configuration: " + err.Error()
+		return nil, result
+	}
+	created := &Values{}
+	if err := json.Unmarshal([]byte(response), created); err != nil || created.ID == "" {
+		result.Message = "could not read the ID of the created configuration"
+		return nil, result
+	}
+	result.Success = true
+	result.Action = ConfigActionCreated
+	result.Message = "Created successfully"
+	return &monacoAppliedConfig{id: created.ID, name: name}, result
+}
+
+// findMonacoConfigID returns the ID of the configuration of the API with the name or an empty string if there is none
+func (dt *DynatraceHelper) findMonacoConfigID(api *monacoAPI, name string) (string, error) {
+	response, err := dt.sendDynatraceAPIRequest(api.path, "GET", nil)
+	if err != nil {
+		return "", err
+	}
+
+	existingConfigs := &struct {
+		Values     []Values `json:"values"`
+		Dashboards []Values `json:"dashboards"`
+	}{}
+	if err := json.Unmarshal([]byte(response), existingConfigs); err != nil {
+		return "", checkForUnexpectedHTMLResponseError(err)
+	}
+	for _, existingConfig := range append(existingConfigs.Values, existingConfigs.Dashboards...) {
+		if existingConfig.Name == name {
+			return existingConfig.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// parseMonacoProjects returns the configurations of the YAML files in the API folders of the monaco projects and the results of the files that couldn't be parsed or whose API path isn't allowed
+func parseMonacoProjects(resources map[string]string, allowedAPIPaths []string) ([]*monacoConfig, []ConfigResult) {
+	var resourceURIs []string
+	for resourceURI := range resources {
+		resourceURIs = append(resourceURIs, resourceURI)
+	}
+	sort.Strings(resourceURIs)
+
+	configs := []*monacoConfig{}
+	results := []ConfigResult{}
+	for _, resourceURI := range resourceURIs {
+		extension := path.Ext(resourceURI)
+		if extension != ".yaml" && extension != ".yml" {
+			continue
+		}
+		apiFolder := path.Dir(strings.TrimPrefix(resourceURI, monacoFolder))
+		apiID := path.Base(apiFolder)
+		projectPath := path.Dir(apiFolder)
+		if projectPath == "." {
+			projectPath = ""
+		}
+
+		api := getMonacoAPI(apiID)
+		if api == nil {
+			results = append(results, ConfigResult{
+				Name:    resourceURI,
+				Success: false,
+				Message: "unsupported API " + apiID,
+			})
+			continue
+		}
+		if !containsString(allowedAPIPaths, api.path) {
+			results = append(results, ConfigResult{
+				Name:    resourceURI,
+				Success: false,
+				Message: "API " + apiID + " is not allowed, its path " + api.path + " has to be added to MONACO_ALLOWED_API_PATHS",
+			})
+			continue
+		}
+
+		fileConfigs, err := parseMonacoConfigFile(resources, resourceURI, projectPath, api)
+		if err != nil {
+			results = append(results, ConfigResult{
+				Name:    resourceURI,
+				Success: false,
+				Message: err.Error(),
+			})
+			continue
+		}
+		configs = append(configs, fileConfigs...)
+	}
+
+	sort.SliceStable(configs, func(i, j int) bool {
+		return getMonacoAPIIndex(configs[i].api) < getMonacoAPIIndex(configs[j].api)
+	})
+	return configs, results
+}
+
+func getMonacoAPIIndex(api *monacoAPI) int {
+	for i := range monacoAPIs {
+		if monacoAPIs[i].id == api.id {
+			return i
+		}
+	}
+	return len(monacoAPIs)
+}
+
+// parseMonacoConfigFile returns the configurations of the YAML file with the templates of the same folder
+func parseMonacoConfigFile(resources map[string]string, resourceURI string, projectPath string, api *monacoAPI) ([]*monacoConfig, error) {
+	configFile := map[string][]map[string]string{}
+	if err := yaml.Unmarshal([]byte(resources[resourceURI]), &configFile); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", resourceURI, err)
+	}
+
+	keyPrefix := api.id + "/"
+	if projectPath != "" {
+		keyPrefix = projectPath + "/" + keyPrefix
+	}
+
+	configs := []*monacoConfig{}
+	for _, configTemplates := range configFile["config"] {
+		for configID, templateFile := range configTemplates {
+			templateURI := path.Join(path.Dir(resourceURI), templateFile)
+			template, ok := resources[templateURI]
+			if !ok {
+				return nil, fmt.Errorf("template %s of config %s is missing", templateFile, configID)
+			}
+
+			monacoConfig := &monacoConfig{
+				key:        keyPrefix + configID,
+				api:        api,
+				template:   template,
+				properties: map[string]string{},
+				references: map[string]string{},
+			}
+			for _, properties := range configFile[configID] {
+				for property, value := range properties {
+					if referencedKey, ok := parseMonacoReference(value, projectPath, resources); ok {
+						monacoConfig.references[property] = referencedKey
+						continue
+					}
+					monacoConfig.properties[property] = value
+				}
+			}
+			configs = append(configs, monacoConfig)
+		}
+	}
+	return configs, nil
+}
+
+// parseMonacoReference returns the key and field of the referenced configuration, e.g: infrastructure/management-zone/zone.id, if the value references a configuration of the monaco projects
+func parseMonacoReference(value string, projectPath string, resources map[string]string) (string, bool) {
+	if !strings.HasSuffix(value, ".id") && !strings.HasSuffix(value, ".name") {
+		return "", false
+	}
+	reference := strings.TrimPrefix(value, "/")
+	segments := strings.Split(reference, "/")
+	if len(segments) < 2 || getMonacoAPI(segments[len(segments)-2]) == nil {
+		return "", false
+	}
+	if len(segments) == 2 && projectPath != "" {
+		// api/config.id references a configuration of the same project
+		reference = projectPath + "/" + reference
+	}
+
+	// only references to API folders of the monaco projects are replaced, other values are used as they are
+	apiFolder := monacoFolder + path.Dir(reference) + "/"
+	for resourceURI := range resources {
+		if strings.HasPrefix(resourceURI, apiFolder) {
+			return reference, true
+		}
+	}
+	return "", false
+}
+
+func splitMonacoReference(reference string) (string, string) {
+	index := strings.LastIndex(reference, ".")
+	return reference[:index], reference[index+1:]
+}
+
+func (mc *monacoConfig) getReferencedKeys() []string {
+	keys := []string{}
+	for _, reference := range mc.references {
+		key, _ := splitMonacoReference(reference)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (mc *monacoConfig) hasAppliedReferences(appliedConfigs map[string]monacoAppliedConfig) bool {
+	for _, key := range mc.getReferencedKeys() {
+		if _, ok := appliedConfigs[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// render executes the template of the configuration with its properties and the resolved references
+func (mc *monacoConfig) render(appliedConfigs map[string]monacoAppliedConfig) ([]byte, error) {
+	properties := map[string]string{}
+	for property, value := range mc.properties {
+		properties[property] = value
+	}
+	for property, reference := range mc.references {
+		key, field := splitMonacoReference(reference)
+		appliedConfig := appliedConfigs[key]
+		properties[property] = appliedConfig.id
+		if field == "name" {
+			properties[property] = appliedConfig.name
+		}
+	}
+
+	tmpl, err := template.New(mc.key).Option("missingkey=error").Parse(mc.template)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %v", err)
+	}
+	rendered := &bytes.Buffer{}
+	if err := tmpl.Execute(rendered, properties); err != nil {
+		return nil, fmt.Errorf("could not render template: %v", err)
+	}
+	return rendered.Bytes(), nil
+}
@@ -0,0 +1,220 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_ApplyMonacoProjects(t *testing.T) {
+	os.Setenv("APPLY_MONACO_PROJECTS", "true")
+	defer os.Unsetenv("APPLY_MONACO_PROJECTS")
+	os.Setenv("MONACO_ALLOWED_API_PATHS", "/api/config/v1/managementZones, /api/config/v1/autoTags")
+	defer os.Unsetenv("MONACO_ALLOWED_API_PATHS")
+
+	originalGetMonacoProjectResources := getMonacoProjectResources
+	defer func() { getMonacoProjectResources = originalGetMonacoProjectResources }()
+	getMonacoProjectResources = func(project string) (map[string]string, error) {
+		return map[string]string{
+			"dynatrace/monaco/infrastructure/management-zone/zones.yaml": `
+config:
+  - zone: "zone.json"
+zone:
+  - name: "Keptn: sockshop"
+  - tagRuleId: "auto-tag/keptn.id"
+  - tagRuleName: "/infrastructure/auto-tag/keptn.name"
+`,
+			"dynatrace/monaco/infrastructure/management-zone/zone.json": `{"id": "ignored", "name": "{{ .name }}", "rules": [{"tagRuleId": "{{ .tagRuleId }}", "tagRuleName": "{{ .tagRuleName }}"}]}`,
+			"dynatrace/monaco/infrastructure/auto-tag/tags.yaml": `
+config:
+  - keptn: "tag.json"
+keptn:
+  - name: "keptn_managed"
+`,
+			"dynatrace/monaco/infrastructure/auto-tag/tag.json": `{"name": "{{ .name }}"}`,
+			"dynatrace/monaco/infrastructure/synthetic-monitor/monitors.yaml": `config: []`,
+		}, nil
+	}
+
+	var requests []string
+	var managementZone map[string]interface{}
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method + " " + request.URL.Path {
+		case "GET /api/config/v1/autoTags":
+			writer.Write([]byte(`{"values": [{"id": "other-tag", "name": "other"}]}`))
+		case "POST /api/config/v1/autoTags":
+			writer.Write([]byte(`{"id": "tag-1", "name": "keptn_managed"}`))
+		case "GET /api/config/v1/managementZones":
+			writer.Write([]byte(`{"values": [{"id": "mz-1", "name": "Keptn: sockshop"}]}`))
+		case "PUT /api/config/v1/managementZones/mz-1":
+			body, _ := ioutil.ReadAll(request.Body)
+			if err := json.Unmarshal(body, &managementZone); err != nil {
+				t.Errorf("ApplyMonacoProjects(): could not unmarshal management zone: %v", err)
+			}
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+		requests = append(requests, request.Method+" "+request.URL.Path)
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+	dt.configuredEntities = &ConfiguredEntities{}
+
+	dt.ApplyMonacoProjects("sockshop")
+
+	wantRequests := []string{
+		"GET /api/config/v1/autoTags",
+		"POST /api/config/v1/autoTags",
+		"GET /api/config/v1/managementZones",
+		"PUT /api/config/v1/managementZones/mz-1",
+	}
+	if len(requests) != len(wantRequests) {
+		t.Fatalf("ApplyMonacoProjects() requests = %v, want %v", requests, wantRequests)
+	}
+	for i := range wantRequests {
+		if requests[i] != wantRequests[i] {
+			t.Errorf("ApplyMonacoProjects() requests = %v, want %v", requests, wantRequests)
+		}
+	}
+
+	rules, _ := managementZone["rules"].([]interface{})
+	if managementZone["id"] != "mz-1" || len(rules) != 1 {
+		t.Fatalf("ApplyMonacoProjects() management zone = %v, want the ID of the existing management zone and one rule", managementZone)
+	}
+	if rule, _ := rules[0].(map[string]interface{}); rule["tagRuleId"] != "tag-1" || rule["tagRuleName"] != "keptn_managed" {
+		t.Errorf("ApplyMonacoProjects() management zone rule = %v, want the references resolved to tag-1 and keptn_managed", rule)
+	}
+
+	results := dt.configuredEntities.MonacoConfigs
+	if len(results) != 3 {
+		t.Fatalf("ApplyMonacoProjects() results = %+v, want 3 results", results)
+	}
+	if results[0].Success || results[0].Name != "dynatrace/monaco/infrastructure/synthetic-monitor/monitors.yaml" {
+		t.Errorf("ApplyMonacoProjects() result = %+v, want an error for the unsupported API", results[0])
+	}
+	if !results[1].Success || results[1].Action != ConfigActionCreated || results[1].Name != "infrastructure/auto-tag/keptn (keptn_managed)" {
+		t.Errorf("ApplyMonacoProjects() result = %+v, want the auto tag to be created", results[1])
+	}
+	if !results[2].Success || results[2].Action != ConfigActionUpdated || results[2].Name != "infrastructure/management-zone/zone (Keptn: sockshop)" {
+		t.Errorf("ApplyMonacoProjects() result = %+v, want the management zone to be updated", results[2])
+	}
+}
+
+func TestParseMonacoProjects(t *testing.T) {
+	configs, results := parseMonacoProjects(map[string]string{
+		"dynatrace/monaco/dashboard/dashboards.yaml": `
+config:
+  - overview: "overview.json"
+  - missing: "missing.json"
+`,
+		"dynatrace/monaco/dashboard/overview.json": `{"dashboardMetadata": {"name": "Overview"}}`,
+		"dynatrace/monaco/alerting-profile/profiles.yaml": `
+config:
+  - profile: "profile.json"
+profile:
+  - name: "Keptn"
+  - zoneId: "management-zone/zone.id"
+`,
+		"dynatrace/monaco/alerting-profile/profile.json": `{"displayName": "{{ .name }}", "managementZoneId": "{{ .zoneId }}"}`,
+	}, []string{"/api/config/v1/dashboards", "/api/config/v1/alertingProfiles"})
+
+	if len(results) != 1 || results[0].Success || results[0].Name != "dynatrace/monaco/dashboard/dashboards.yaml" {
+		t.Errorf("parseMonacoProjects() results = %+v, want an error for the missing template", results)
+	}
+	if len(configs) != 1 || configs[0].key != "alerting-profile/profile" {
+		t.Fatalf("parseMonacoProjects() configs = %+v, want alerting-profile/profile", configs)
+	}
+	if len(configs[0].references) != 0 || configs[0].properties["zoneId"] != "management-zone/zone.id" {
+		t.Errorf("parseMonacoProjects() properties = %v, want values that don't reference a monaco API folder to be kept", configs[0].properties)
+	}
+
+	rendered, err := configs[0].render(map[string]monacoAppliedConfig{})
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if got := getPlannedChangeEntityName(rendered); got != "Keptn" {
+		t.Errorf("render() name = %s, want Keptn", got)
+	}
+}
+
+func TestDynatraceHelper_ApplyMonacoProjects_NotAllowed(t *testing.T) {
+	originalGetMonacoProjectResources := getMonacoProjectResources
+	defer func() { getMonacoProjectResources = originalGetMonacoProjectResources }()
+	getMonacoProjectResources = func(project string) (map[string]string, error) {
+		return map[string]string{
+			"dynatrace/monaco/management-zone/zones.yaml": `
+config:
+  - zone: "zone.json"
+zone:
+  - name: "Keptn: sockshop"
+  - tagRuleId: "auto-tag/keptn.id"
+`,
+			"dynatrace/monaco/management-zone/zone.json": `{"name": "{{ .name }}", "rules": [{"tagRuleId": "{{ .tagRuleId }}"}]}`,
+			"dynatrace/monaco/auto-tag/tags.yaml": `
+config:
+  - keptn: "tag.json"
+keptn:
+  - name: "keptn_managed"
+`,
+			"dynatrace/monaco/auto-tag/tag.json": `{"name": "{{ .name }}"}`,
+		}, nil
+	}
+
+	tests := []struct {
+		name            string
+		enabled         string
+		allowedAPIPaths string
+		wantResults     []string
+	}{
+		{
+			name:            "disabled by default",
+			allowedAPIPaths: "/api/config/v1/managementZones,/api/config/v1/autoTags",
+		},
+		{
+			name:            "API path not allowed",
+			enabled:         "true",
+			allowedAPIPaths: "/api/config/v1/managementZones",
+			wantResults:     []string{"dynatrace/monaco/auto-tag/tags.yaml", "management-zone/zone"},
+		},
+		{
+			name:        "no API path allowed",
+			enabled:     "true",
+			wantResults: []string{"dynatrace/monaco/auto-tag/tags.yaml", "dynatrace/monaco/management-zone/zones.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("APPLY_MONACO_PROJECTS", tt.enabled)
+			defer os.Unsetenv("APPLY_MONACO_PROJECTS")
+			os.Setenv("MONACO_ALLOWED_API_PATHS", tt.allowedAPIPaths)
+			defer os.Unsetenv("MONACO_ALLOWED_API_PATHS")
+
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				t.Errorf("ApplyMonacoProjects(): unexpected request %s %s", request.Method, request.URL.Path)
+				writer.WriteHeader(http.StatusNotFound)
+			}))
+			defer dtMockServer.Close()
+
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+			dt.configuredEntities = &ConfiguredEntities{}
+
+			dt.ApplyMonacoProjects("sockshop")
+
+			results := dt.configuredEntities.MonacoConfigs
+			if len(results) != len(tt.wantResults) {
+				t.Fatalf("ApplyMonacoProjects() results = %+v, want %v", results, tt.wantResults)
+			}
+			for i, result := range results {
+				if result.Success || result.Name != tt.wantResults[i] {
+					t.Errorf("ApplyMonacoProjects() result = %+v, want an error for %s", result, tt.wantResults[i])
+				}
+			}
+		})
+	}
+}
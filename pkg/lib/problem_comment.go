@@ -3,25 +3,84 @@ package lib
 import (
 	"encoding/json"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
 )
 
+const problemKeptnLinkContext = "keptn-sequence"
+
+// problemRemediationContext is the context of the comments that report the progress of a remediation on a DT problem
+const problemRemediationContext = "keptn-remediation"
+
 // SendProblemComment sends a commont on a DT problem
 func (dt *DynatraceHelper) SendProblemComment(problemID string, comment string) error {
-	dtCommentPayload := map[string]string{"comment": comment, "user": "keptn", "context": "keptn-remediation"}
+	logger := logging.FromContext(dt.EventContext)
+	dtCommentPayload := map[string]string{"comment": comment, "user": "keptn", "context": problemRemediationContext}
 	jsonPayload, err := json.Marshal(dtCommentPayload)
 
 	if err != nil {
 		return err
 	}
 
-	log.WithField("jsonPayload", jsonPayload).Info("Sending problem event")
+	logger.WithField("jsonPayload", jsonPayload).Info("Sending problem event")
+
+	return dt.sendWithRetry("send comment to problem "+problemID, false, func() error {
+		resp, err := dt.sendDynatraceAPIRequest("/api/v1/problem/details/"+problemID+"/comments", "POST", jsonPayload)
+
+		logger.WithField("response", resp).Info("Received response from Dynatrace API")
+		return err
+	})
+}
+
+/**
+ * SendProblemKeptnLink posts a comment with the context keptn-sequence on a DT problem via the Problems API v2 that links the problem to the Keptn sequence, e.g:
+ * keptnContext: 08735340-6f9e-4b32-97ff-3b6c292bc509
+ * keptnBridge: https://keptn.mydomain.com/bridge/trace/08735340-6f9e-4b32-97ff-3b6c292bc509
+ * Dynatrace problems don't support custom properties - so tools can read the comments with this context to jump from the problem to Keptn
+ */
+func (dt *DynatraceHelper) SendProblemKeptnLink(problemID string, keptnContext string, bridgeURL string) error {
+	logger := logging.FromContext(dt.EventContext)
+	message := "keptnContext: " + keptnContext
+	if bridgeURL != "" {
+		message = message + "\nkeptnBridge: " + bridgeURL
+	}
+
+	jsonPayload, err := newProblemCommentPayload(message, problemKeptnLinkContext)
+	if err != nil {
+		return err
+	}
+
+	logger.WithField("jsonPayload", jsonPayload).Info("Sending problem link to Keptn")
+
+	return dt.sendWithRetry("send link to Keptn to problem "+problemID, false, func() error {
+		resp, err := dt.sendDynatraceAPIRequest("/api/v2/problems/"+problemID+"/comments", "POST", jsonPayload)
 
-	resp, err := dt.sendDynatraceAPIRequest("/api/v1/problem/details/"+problemID+"/comments", "POST", jsonPayload)
+		logger.WithField("response", resp).Info("Received response from Dynatrace API")
+		return err
+	})
+}
 
-	log.WithField("response", resp).Info("Received response from Dynatrace API")
+/**
+ * CloseProblem closes a DT problem with a closing comment via the Problems API v2 - the comment has the same context as the other comments of the remediation.
+ * Closing a problem that is already closed doesn't change it, so the request is idempotent and is retried if it fails
+ */
+func (dt *DynatraceHelper) CloseProblem(problemID string, comment string) error {
+	logger := logging.FromContext(dt.EventContext)
+	jsonPayload, err := newProblemCommentPayload(comment, problemRemediationContext)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	logger.WithField("problemID", problemID).Info("Closing problem")
+
+	return dt.sendWithRetry("close problem "+problemID, true, func() error {
+		resp, err := dt.sendDynatraceAPIRequest("/api/v2/problems/"+problemID+"/close", "POST", jsonPayload)
+
+		logger.WithField("response", resp).Info("Received response from Dynatrace API")
+		return err
+	})
+}
+
+// newProblemCommentPayload returns the payload of a comment of the Problems API v2 with the message and the context of the comment
+func newProblemCommentPayload(message string, context string) ([]byte, error) {
+	return json.Marshal(map[string]string{"message": message, "context": context})
 }
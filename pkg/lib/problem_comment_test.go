@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_SendProblemKeptnLink(t *testing.T) {
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/v2/problems/-123_456V2/comments" {
+			t.Errorf("SendProblemKeptnLink(): unexpected path %s", request.URL.Path)
+		}
+
+		body, _ := ioutil.ReadAll(request.Body)
+		payload := map[string]string{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("SendProblemKeptnLink(): could not parse payload: %v", err)
+		}
+
+		wantMessage := "keptnContext: my-context\nkeptnBridge: https://bridge/trace/my-context"
+		if payload["message"] != wantMessage {
+			t.Errorf("SendProblemKeptnLink(): message = %s, want %s", payload["message"], wantMessage)
+		}
+		if payload["context"] != "keptn-sequence" {
+			t.Errorf("SendProblemKeptnLink(): context = %s, want %s", payload["context"], "keptn-sequence")
+		}
+		writer.WriteHeader(201)
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	if err := dt.SendProblemKeptnLink("-123_456V2", "my-context", "https://bridge/trace/my-context"); err != nil {
+		t.Errorf("SendProblemKeptnLink() error = %v", err)
+	}
+}
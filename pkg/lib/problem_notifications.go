@@ -5,22 +5,77 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
 	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
-
-	log "github.com/sirupsen/logrus"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 )
 
+// getKeptnCredentials returns the Keptn API endpoint and token the problem notifications send the problems to - it is a variable so that it can be replaced in tests
+var getKeptnCredentials = credentials.GetKeptnCredentials
+
+// globalProblemNotificationName is the name of the problem notification that sends the problems of all projects of the tenant to Keptn
+const globalProblemNotificationName = "Keptn Problem Notification"
+
+// usesScopedProblemNotifications returns whether the problems of the project are sent by the problem notifications of its alerting profiles instead of the Keptn Problem Notification
+func (dt *DynatraceHelper) usesScopedProblemNotifications(project string, shipyard *keptnv2.Shipyard) bool {
+	return dt.alertingProfile != nil && project != "" && shipyard != nil
+}
+
+// skipProblemNotification doesn't set up the Keptn Problem Notification, as it would send the problems of a project with scoped problem notifications a second time
+func (dt *DynatraceHelper) skipProblemNotification() {
+	if !dt.isProblemNotificationsGenerationEnabled() {
+		return
+	}
+	logging.FromContext(dt.EventContext).Info("Skipping Keptn Problem Notification, as the alerting profiles of the project have their own problem notifications")
+	dt.configuredEntities.ProblemNotifications.Success = true
+	dt.configuredEntities.ProblemNotifications.Message = "Skipped Keptn Problem Notification, as the alerting profiles of the project have their own problem notifications"
+}
+
+// getProblemNotificationNames returns the names of the problem notifications that send the problems of the project to Keptn
+func (dt *DynatraceHelper) getProblemNotificationNames(project string, shipyard keptnv2.Shipyard) []string {
+	if !dt.usesScopedProblemNotifications(project, &shipyard) {
+		return []string{globalProblemNotificationName}
+	}
+	if dt.alertingProfile.Scope == config.AlertingProfileScopeProject {
+		return []string{getScopedProblemNotificationName(createProjectAlertingProfile(project, dt.alertingProfile).DisplayName)}
+	}
+	var names []string
+	for _, stage := range shipyard.Spec.Stages {
+		names = append(names, getScopedProblemNotificationName(createStageAlertingProfile(project, stage.Name, dt.alertingProfile).DisplayName))
+	}
+	return names
+}
+
+// getScopedProblemNotificationName returns the name of the problem notification of a scoped alerting profile, e.g: Keptn Problem Notification: sockshop dev
+func getScopedProblemNotificationName(alertingProfileName string) string {
+	return globalProblemNotificationName + ": " + strings.TrimPrefix(alertingProfileName, "Keptn: ")
+}
+
 // EnsureProblemNotificationsAreSetUp sets up/updates the DT problem notification
 func (dt *DynatraceHelper) EnsureProblemNotificationsAreSetUp() {
-	if !IsProblemNotificationsGenerationEnabled() {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isProblemNotificationsGenerationEnabled() {
 		return
 	}
 
-	log.Info("Setting up problem notifications in Dynatrace Tenant")
+	logger.Info("Setting up problem notifications in Dynatrace Tenant")
+
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		logger.WithError(err).Error("Failed to set up problem notification")
+		dt.configuredEntities.ProblemNotifications.Success = false
+		dt.configuredEntities.ProblemNotifications.Message = "failed to set up problem notification: " + err.Error()
+		return
+	}
+	if useSettingsAPI {
+		dt.ensureProblemNotificationInSettings()
+		return
+	}
 
 	alertingProfileId, err := dt.setupAlertingProfile()
 	if err != nil {
-		log.WithError(err).Error("Failed to set up problem notification")
+		logger.WithError(err).Error("Failed to set up problem notification")
 		dt.configuredEntities.ProblemNotifications.Success = false
 		dt.configuredEntities.ProblemNotifications.Message = "failed to set up problem notification: " + err.Error()
 		return
@@ -31,23 +86,23 @@ func (dt *DynatraceHelper) EnsureProblemNotificationsAreSetUp() {
 
 	err = json.Unmarshal([]byte(response), &existingNotifications)
 	if err != nil {
-		log.WithError(err).Error("Failed to unmarshal notifications")
+		logger.WithError(err).Error("Failed to unmarshal notifications")
 	}
 
 	for _, notification := range existingNotifications.Values {
-		if notification.Name == "Keptn Problem Notification" {
+		if notification.Name == globalProblemNotificationName {
 			_, err = dt.sendDynatraceAPIRequest("/api/config/v1/notifications/"+notification.ID, "DELETE", nil)
 			if err != nil {
 				// Error occurred but continue
-				log.WithError(err).WithField("notificationId", notification.ID).Error("Failed to delete notification")
+				logger.WithError(err).WithField("notificationId", notification.ID).Error("Failed to delete notification")
 			}
 		}
 	}
 	problemNotification := PROBLEM_NOTIFICATION_PAYLOAD
 
-	keptnCredentials, err := credentials.GetKeptnCredentials()
+	keptnCredentials, err := getKeptnCredentials()
 	if err != nil {
-		log.WithError(err).Error("Failed to retrieve Keptn API credentials")
+		logger.WithError(err).Error("Failed to retrieve Keptn API credentials")
 		dt.configuredEntities.ProblemNotifications.Success = false
 		dt.configuredEntities.ProblemNotifications.Message = "failed to retrieve Keptn API credentials: " + err.Error()
 		return
@@ -59,37 +114,39 @@ func (dt *DynatraceHelper) EnsureProblemNotificationsAreSetUp() {
 
 	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/notifications", "POST", []byte(problemNotification))
 	if err != nil {
-		log.WithError(err).Error("Failed to set up problem notification")
+		logger.WithError(err).Error("Failed to set up problem notification")
 		dt.configuredEntities.ProblemNotifications.Success = false
 		dt.configuredEntities.ProblemNotifications.Message = "failed to set up problem notification: " + err.Error()
+		return
 	}
 	dt.configuredEntities.ProblemNotifications.Success = true
 	dt.configuredEntities.ProblemNotifications.Message = "Successfully set up Keptn Alerting Profile and Problem Notifications"
 }
 
 func (dt *DynatraceHelper) setupAlertingProfile() (string, error) {
-	log.Info("Checking Keptn alerting profile availability")
+	logger := logging.FromContext(dt.EventContext)
+	logger.Info("Checking Keptn alerting profile availability")
 	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/alertingProfiles", "GET", nil)
 	if err != nil {
 		// Error occurred but continue
-		log.WithError(err).Debug("Could not get alerting profiles")
+		logger.WithError(err).Debug("Could not get alerting profiles")
 	} else {
 		existingAlertingProfiles := DTAPIListResponse{}
 
 		err = json.Unmarshal([]byte(response), &existingAlertingProfiles)
 		if err != nil {
 			// Error occurred but continue
-			log.WithError(err).Error("Failed to unmarshal alerting profiles")
+			logger.WithError(err).Error("Failed to unmarshal alerting profiles")
 		}
 		for _, ap := range existingAlertingProfiles.Values {
 			if ap.Name == "Keptn" {
-				log.Info("Keptn alerting profile available")
+				logger.Info("Keptn alerting profile available")
 				return ap.ID, nil
 			}
 		}
 	}
 
-	log.Info("Creating Keptn alerting profile.")
+	logger.Info("Creating Keptn alerting profile.")
 	alertingProfile := CreateKeptnAlertingProfile()
 	alertingProfilePayload, err := json.Marshal(alertingProfile)
 	if err != nil {
@@ -108,6 +165,149 @@ func (dt *DynatraceHelper) setupAlertingProfile() (string, error) {
 		err = checkForUnexpectedHTMLResponseError(err)
 		return "", fmt.Errorf("failed to unmarshal alerting profile: %v", err)
 	}
-	log.Info("Alerting profile created successfully.")
+	logger.Info("Alerting profile created successfully.")
 	return createdItem.ID, nil
 }
+
+// ensureProblemNotificationInSettings creates or updates the Keptn alerting profile and problem notification via the Settings 2.0 API
+func (dt *DynatraceHelper) ensureProblemNotificationInSettings() {
+	logger := logging.FromContext(dt.EventContext)
+	keptnCredentials, err := getKeptnCredentials()
+	if err != nil {
+		logger.WithError(err).Error("Failed to retrieve Keptn API credentials")
+		dt.configuredEntities.ProblemNotifications.Success = false
+		dt.configuredEntities.ProblemNotifications.Message = "failed to retrieve Keptn API credentials: " + err.Error()
+		return
+	}
+
+	alertingProfileID, err := dt.setupAlertingProfileInSettings()
+	if err != nil {
+		logger.WithError(err).Error("Failed to set up problem notification")
+		dt.configuredEntities.ProblemNotifications.Success = false
+		dt.configuredEntities.ProblemNotifications.Message = "failed to set up problem notification: " + err.Error()
+		return
+	}
+
+	notification, err := createProblemNotificationSettings(keptnCredentials.APIURL, keptnCredentials.APIToken, alertingProfileID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to set up problem notification")
+		dt.configuredEntities.ProblemNotifications.Success = false
+		dt.configuredEntities.ProblemNotifications.Message = "failed to set up problem notification: " + err.Error()
+		return
+	}
+
+	existingNotifications, err := dt.getSettingsObjects(problemNotificationSchemaID, settingsEnvironmentScope)
+	if err != nil {
+		// Error occurred but continue
+		logger.WithError(err).Error("Failed to retrieve notifications")
+	}
+	objectID := ""
+	if existingNotification := findSettingsObject(existingNotifications, "displayName", notification.DisplayName); existingNotification != nil {
+		objectID = existingNotification.ObjectID
+	}
+
+	_, err = dt.upsertSettingsObject(problemNotificationSchemaID, settingsEnvironmentScope, objectID, notification)
+	if err != nil {
+		logger.WithError(err).Error("Failed to set up problem notification")
+		dt.configuredEntities.ProblemNotifications.Success = false
+		dt.configuredEntities.ProblemNotifications.Message = "failed to set up problem notification: " + err.Error()
+		return
+	}
+	dt.configuredEntities.ProblemNotifications.Success = true
+	dt.configuredEntities.ProblemNotifications.Message = "Successfully set up Keptn Alerting Profile and Problem Notifications"
+}
+
+// setupAlertingProfileInSettings returns the ID of the Keptn alerting profile and creates it via the Settings 2.0 API if it doesn't exist
+func (dt *DynatraceHelper) setupAlertingProfileInSettings() (string, error) {
+	logger := logging.FromContext(dt.EventContext)
+	logger.Info("Checking Keptn alerting profile availability")
+	alertingProfile := CreateKeptnAlertingProfile().toSettings()
+
+	existingAlertingProfiles, err := dt.getSettingsObjects(alertingProfileSchemaID, settingsEnvironmentScope)
+	if err != nil {
+		// Error occurred but continue
+		logger.WithError(err).Debug("Could not get alerting profiles")
+	}
+	if existingAlertingProfile := findSettingsObject(existingAlertingProfiles, "name", alertingProfile.Name); existingAlertingProfile != nil {
+		logger.Info("Keptn alerting profile available")
+		return existingAlertingProfile.ObjectID, nil
+	}
+
+	logger.Info("Creating Keptn alerting profile.")
+	objectID, err := dt.upsertSettingsObject(alertingProfileSchemaID, settingsEnvironmentScope, "", alertingProfile)
+	if err != nil {
+		return "", fmt.Errorf("failed to setup alerting profile: %v", err)
+	}
+	logger.Info("Alerting profile created successfully.")
+	return objectID, nil
+}
+
+// createProblemNotificationSettings converts the PROBLEM_NOTIFICATION_PAYLOAD to the builtin:problem.notifications schema of the Settings 2.0 API
+func createProblemNotificationSettings(keptnAPIURL string, keptnAPIToken string, alertingProfileID string) (*ProblemNotificationSettings, error) {
+	problemNotification := PROBLEM_NOTIFICATION_PAYLOAD
+	problemNotification = strings.ReplaceAll(problemNotification, "$KEPTN_DNS", keptnAPIURL)
+	problemNotification = strings.ReplaceAll(problemNotification, "$ALERTING_PROFILE_ID", alertingProfileID)
+
+	notificationV1 := struct {
+		Name                 string `json:"name"`
+		URL                  string `json:"url"`
+		AcceptAnyCertificate bool   `json:"acceptAnyCertificate"`
+		Headers              []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		Payload string `json:"payload"`
+	}{}
+	if err := json.Unmarshal([]byte(problemNotification), &notificationV1); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal problem notification: %v", err)
+	}
+
+	notification := &ProblemNotificationSettings{
+		Enabled:          true,
+		NotificationType: "WEBHOOK",
+		DisplayName:      notificationV1.Name,
+		AlertingProfile:  alertingProfileID,
+		WebHookNotification: ProblemNotificationSettingsWebhook{
+			URL:                  notificationV1.URL,
+			AcceptAnyCertificate: notificationV1.AcceptAnyCertificate,
+			NotifyClosedProblems: true,
+			Payload:              notificationV1.Payload,
+		},
+	}
+	for _, header := range notificationV1.Headers {
+		if header.Value == "$KEPTN_TOKEN" {
+			// the Keptn API token is stored as secret so that it isn't returned by the Settings 2.0 API
+			notification.WebHookNotification.Headers = append(notification.WebHookNotification.Headers, ProblemNotificationSettingsHeader{
+				Name:        header.Name,
+				Secret:      true,
+				SecretValue: keptnAPIToken,
+			})
+			continue
+		}
+		notification.WebHookNotification.Headers = append(notification.WebHookNotification.Headers, ProblemNotificationSettingsHeader{
+			Name:  header.Name,
+			Value: header.Value,
+		})
+	}
+	return notification, nil
+}
+
+// createProblemNotificationPayload returns the PROBLEM_NOTIFICATION_PAYLOAD for the configuration API v1 with the given name
+func createProblemNotificationPayload(name string, keptnAPIURL string, keptnAPIToken string, alertingProfileID string) (string, error) {
+	problemNotification := PROBLEM_NOTIFICATION_PAYLOAD
+	problemNotification = strings.ReplaceAll(problemNotification, "$KEPTN_DNS", keptnAPIURL)
+	problemNotification = strings.ReplaceAll(problemNotification, "$KEPTN_TOKEN", keptnAPIToken)
+	problemNotification = strings.ReplaceAll(problemNotification, "$ALERTING_PROFILE_ID", alertingProfileID)
+
+	notification := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(problemNotification), &notification); err != nil {
+		return "", fmt.Errorf("failed to unmarshal problem notification: %v", err)
+	}
+	notification["name"] = name
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal problem notification: %v", err)
+	}
+	return string(payload), nil
+}
@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/config"
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestDynatraceHelper_GetProblemNotificationNames(t *testing.T) {
+	shipyard := keptnv2.Shipyard{Spec: keptnv2.ShipyardSpec{Stages: []keptnv2.Stage{{Name: "dev"}, {Name: "production"}}}}
+
+	tests := []struct {
+		name            string
+		alertingProfile *config.DtAlertingProfile
+		want            []string
+	}{
+		{
+			name: "global problem notification without alerting profile",
+			want: []string{"Keptn Problem Notification"},
+		},
+		{
+			name:            "problem notifications of the stages",
+			alertingProfile: &config.DtAlertingProfile{},
+			want:            []string{"Keptn Problem Notification: sockshop dev", "Keptn Problem Notification: sockshop production"},
+		},
+		{
+			name:            "problem notification of the project",
+			alertingProfile: &config.DtAlertingProfile{Scope: config.AlertingProfileScopeProject},
+			want:            []string{"Keptn Problem Notification: sockshop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := NewDynatraceHelper(nil, nil)
+			dt.alertingProfile = tt.alertingProfile
+
+			got := dt.getProblemNotificationNames("sockshop", shipyard)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("getProblemNotificationNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_SkipProblemNotification(t *testing.T) {
+	os.Setenv("GENERATE_PROBLEM_NOTIFICATIONS", "true")
+	defer os.Unsetenv("GENERATE_PROBLEM_NOTIFICATIONS")
+
+	dt := NewDynatraceHelper(nil, nil)
+	dt.alertingProfile = &config.DtAlertingProfile{}
+	dt.configuredEntities = &ConfiguredEntities{}
+
+	shipyard := &keptnv2.Shipyard{}
+	if !dt.usesScopedProblemNotifications("sockshop", shipyard) {
+		t.Fatalf("usesScopedProblemNotifications() = false, want true for a project with alerting profile")
+	}
+	if dt.usesScopedProblemNotifications("", nil) {
+		t.Errorf("usesScopedProblemNotifications() = true, want false without project")
+	}
+
+	dt.skipProblemNotification()
+	if !dt.configuredEntities.ProblemNotifications.Success || !strings.HasPrefix(dt.configuredEntities.ProblemNotifications.Message, "Skipped") {
+		t.Errorf("skipProblemNotification() result = %v, want a skipped problem notification", dt.configuredEntities.ProblemNotifications)
+	}
+}
+
+func TestDynatraceHelper_CreateAlertingProfiles_OneNotificationPerScope(t *testing.T) {
+	os.Setenv("GENERATE_PROBLEM_NOTIFICATIONS", "true")
+	defer os.Unsetenv("GENERATE_PROBLEM_NOTIFICATIONS")
+
+	getKeptnCredentialsBackup := getKeptnCredentials
+	defer func() { getKeptnCredentials = getKeptnCredentialsBackup }()
+	getKeptnCredentials = func() (*credentials.KeptnAPICredentials, error) {
+		return &credentials.KeptnAPICredentials{APIURL: "https://keptn", APIToken: "my-token"}, nil
+	}
+
+	// the mock tenant keeps the alerting profiles and notifications by ID, so that the result of several runs can be checked
+	entities := map[string]map[string]string{
+		"/api/config/v1/alertingProfiles": {},
+		"/api/config/v1/notifications":    {"n-0": "Keptn Problem Notification: other dev"},
+	}
+	nextID := 1
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/api/config/v1/managementZones" {
+			writer.Write([]byte(`{"values": [{"id": "1", "name": "Keptn: sockshop"}, {"id": "2", "name": "Keptn: sockshop dev"}, {"id": "3", "name": "Keptn: sockshop production"}]}`))
+			return
+		}
+		apiPath, id := request.URL.Path, ""
+		if _, ok := entities[apiPath]; !ok {
+			apiPath, id = path.Dir(request.URL.Path), path.Base(request.URL.Path)
+		}
+		existing, ok := entities[apiPath]
+		if !ok {
+			t.Errorf("CreateAlertingProfiles(): unexpected request %s %s", request.Method, request.URL.Path)
+			writer.WriteHeader(404)
+			return
+		}
+
+		switch request.Method {
+		case http.MethodGet:
+			list := DTAPIListResponse{}
+			for id, name := range existing {
+				list.Values = append(list.Values, Values{ID: id, Name: name})
+			}
+			response, _ := json.Marshal(list)
+			writer.Write(response)
+		case http.MethodPost, http.MethodPut:
+			entity := struct {
+				Name        string `json:"name"`
+				DisplayName string `json:"displayName"`
+			}{}
+			json.NewDecoder(request.Body).Decode(&entity)
+			if id == "" {
+				id = fmt.Sprintf("id-%d", nextID)
+				nextID++
+			}
+			existing[id] = entity.Name + entity.DisplayName
+			writer.Write([]byte(`{"id": "` + id + `"}`))
+		case http.MethodDelete:
+			delete(existing, id)
+			writer.WriteHeader(204)
+		}
+	}))
+	defer dtMockServer.Close()
+
+	shipyard := keptnv2.Shipyard{Spec: keptnv2.ShipyardSpec{Stages: []keptnv2.Stage{{Name: "dev"}, {Name: "production"}}}}
+	getNotificationNames := func() []string {
+		var names []string
+		for _, name := range entities["/api/config/v1/notifications"] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	tests := []struct {
+		name                  string
+		alertingProfileConfig *config.DtAlertingProfile
+		want                  []string
+	}{
+		{
+			name:                  "problem notifications of the stages",
+			alertingProfileConfig: &config.DtAlertingProfile{},
+			want:                  []string{"Keptn Problem Notification: other dev", "Keptn Problem Notification: sockshop dev", "Keptn Problem Notification: sockshop production"},
+		},
+		{
+			name:                  "configuring the stages again doesn't add notifications",
+			alertingProfileConfig: &config.DtAlertingProfile{},
+			want:                  []string{"Keptn Problem Notification: other dev", "Keptn Problem Notification: sockshop dev", "Keptn Problem Notification: sockshop production"},
+		},
+		{
+			name:                  "problem notification of the project replaces the ones of the stages",
+			alertingProfileConfig: &config.DtAlertingProfile{Scope: config.AlertingProfileScopeProject},
+			want:                  []string{"Keptn Problem Notification: other dev", "Keptn Problem Notification: sockshop"},
+		},
+		{
+			name:                  "problem notifications of the stages replace the one of the project",
+			alertingProfileConfig: &config.DtAlertingProfile{},
+			want:                  []string{"Keptn Problem Notification: other dev", "Keptn Problem Notification: sockshop dev", "Keptn Problem Notification: sockshop production"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+			settingsAPISupported := false
+			dt.settingsAPISupported = &settingsAPISupported
+			dt.configuredEntities = &ConfiguredEntities{}
+
+			dt.CreateAlertingProfiles("sockshop", shipyard, tt.alertingProfileConfig)
+
+			if got := getNotificationNames(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("CreateAlertingProfiles() left notifications %v, want %v", got, tt.want)
+			}
+			for _, result := range dt.configuredEntities.AlertingProfiles {
+				if !result.Success {
+					t.Errorf("CreateAlertingProfiles() failed for %s: %s", result.Name, result.Message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+/**
+ * DeleteProjectConfiguration removes the configuration the dynatrace-service created in Dynatrace for a project that was deleted in Keptn:
+ * alerting profiles and problem notifications of the project and its stages, metric events, SLOs, calculated service metrics, the dashboard and the management zones.
+ * The tagging rules are shared by all projects and are only removed with CLEANUP_TAGGING_RULES enabled once no Keptn project is left.
+ * Management zones and tagging rules are only removed if they carry the ownership marker of this installation, so that entities of users
+ * or of other Keptn installations with the same name are kept
+ */
+func (dt *DynatraceHelper) DeleteProjectConfiguration(project string) []ConfigResult {
+	logger := logging.FromContext(dt.EventContext)
+	var results []ConfigResult
+
+	stageEntityPrefix := getManagementZoneNameForStage(project, "")
+	notificationPrefix := "Keptn Problem Notification: " + project + " "
+	entityNameMarker := "(Keptn." + project + "."
+
+	// without knowing which API the tenant uses, the notifications, alerting profiles and metric events are kept rather than looked up in the wrong API
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		logger.WithError(err).Error("Could not delete problem notifications, alerting profiles and metric events")
+		results = append(results, ConfigResult{Name: project, Success: false, Message: "Could not delete problem notifications, alerting profiles and metric events: " + err.Error()})
+	} else if useSettingsAPI {
+		results = append(results, dt.deleteMatchingSettingsObjects(problemNotificationSchemaID, "displayName", nameHasPrefixOrEquals(notificationPrefix))...)
+		results = append(results, dt.deleteMatchingSettingsObjects(alertingProfileSchemaID, "name", nameHasPrefixOrEquals(stageEntityPrefix))...)
+		results = append(results, dt.deleteMatchingSettingsObjects(metricEventSchemaID, "summary", nameContains(entityNameMarker))...)
+	} else {
+		results = append(results, dt.deleteMatchingConfigEntities("/api/config/v1/notifications", nameHasPrefixOrEquals(notificationPrefix))...)
+		results = append(results, dt.deleteMatchingConfigEntities("/api/config/v1/alertingProfiles", nameHasPrefixOrEquals(stageEntityPrefix))...)
+		results = append(results, dt.deleteMatchingConfigEntities("/api/config/v1/anomalyDetection/metricEvents", nameContains(entityNameMarker))...)
+	}
+
+	results = append(results, dt.deleteProjectSLOs(entityNameMarker)...)
+
+	var calculatedMetricKeys []string
+	for _, metric := range testStepMetrics {
+		calculatedMetricKeys = append(calculatedMetricKeys, metric.keyPrefix+project)
+	}
+	results = append(results, dt.deleteMatchingConfigEntities("/api/config/v1/calculatedMetrics/service", func(name string, id string) bool {
+		return containsString(calculatedMetricKeys, id)
+	})...)
+
+	if err := dt.DeleteExistingDashboard(project); err != nil {
+		results = append(results, ConfigResult{Name: project + dashboardNameSuffix, Success: false, Message: err.Error()})
+	}
+
+	results = append(results, dt.deleteProjectManagementZones(project)...)
+
+	if !IsTaggingRulesCleanupEnabled(dt.EventContext) {
+		return results
+	}
+
+	projects, err := getKeptnProjects()
+	if err != nil {
+		logger.WithError(err).Warn("Could not retrieve Keptn projects - tagging rules are not cleaned up")
+	} else if len(projects) == 0 || (len(projects) == 1 && projects[0] == project) {
+		useSettingsAPI, err := dt.useSettingsAPI()
+		if err != nil {
+			logger.WithError(err).Error("Could not delete tagging rules")
+			results = append(results, ConfigResult{Name: strings.Join(taggingRuleNames, ", "), Success: false, Message: "Could not delete tagging rules: " + err.Error()})
+		} else if useSettingsAPI {
+			results = append(results, dt.deleteSettingsObjects(autoTaggingSchemaID, "name", func(fields map[string]interface{}, id string) bool {
+				name, _ := fields["name"].(string)
+				description, _ := fields["description"].(string)
+				return containsString(taggingRuleNames, name) && hasOwnershipMarker(description)
+			})...)
+		} else {
+			results = append(results, dt.deleteMatchingConfigEntities("/api/config/v1/autoTags", dt.isManagedTaggingRuleID)...)
+		}
+	}
+
+	return results
+}
+
+// deleteProjectManagementZones deletes the management zones whose ownership marker belongs to the project and this Keptn installation
+func (dt *DynatraceHelper) deleteProjectManagementZones(project string) []ConfigResult {
+	var results []ConfigResult
+	for _, mz := range dt.getKeptnManagementZones() {
+		mzProject, _, isManagedByKeptn := parseManagementZoneOwnershipMarker(mz.Description)
+		if !isManagedByKeptn || mzProject != project || !isManagedByThisInstallation(mz.Description) {
+			continue
+		}
+		results = append(results, dt.deleteConfigEntity("/api/config/v1/managementZones", mz.ID, mz.Name))
+	}
+	return results
+}
+
+/**
+ * GetProjectStages returns the stages of the project by the ownership markers of its management zones, as the stages of a deleted project
+ * can't be retrieved from Keptn anymore. The management zones of all stages are created with the credentials of the project
+ */
+func (dt *DynatraceHelper) GetProjectStages(project string) []string {
+	var stages []string
+	for _, mz := range dt.getKeptnManagementZones() {
+		mzProject, mzStage, isManagedByKeptn := parseManagementZoneOwnershipMarker(mz.Description)
+		if !isManagedByKeptn || mzProject != project || mzStage == "" || !isManagedByThisInstallation(mz.Description) {
+			continue
+		}
+		if !containsString(stages, mzStage) {
+			stages = append(stages, mzStage)
+		}
+	}
+	return stages
+}
+
+// isManagedTaggingRuleID returns whether the tagging rule with the ID is one of the tagging rules of Keptn and carries the ownership marker
+func (dt *DynatraceHelper) isManagedTaggingRuleID(name string, id string) bool {
+	if !containsString(taggingRuleNames, name) {
+		return false
+	}
+	rule, err := dt.getDTTaggingRule(id)
+	if err != nil {
+		logging.FromContext(dt.EventContext).WithError(err).WithField("ruleName", name).Error("Could not check tagging rule - it is not deleted")
+		return false
+	}
+	return hasOwnershipMarker(rule.Description)
+}
+
+// deleteProjectSLOs deletes the SLOs whose name contains the marker of the project, e.g: (Keptn.sockshop.
+func (dt *DynatraceHelper) deleteProjectSLOs(entityNameMarker string) []ConfigResult {
+	logger := logging.FromContext(dt.EventContext)
+	query := url.Values{}
+	query.Set("sloSelector", "text(\""+entityNameMarker+"\")")
+	query.Set("pageSize", "500")
+
+	response, err := dt.sendDynatraceAPIRequest("/api/v2/slo?"+query.Encode(), "GET", nil)
+	if err != nil {
+		logger.WithError(err).Error("Could not retrieve SLOs")
+		return nil
+	}
+	sloList := &SLOListResponse{}
+	if err := json.Unmarshal([]byte(response), sloList); err != nil {
+		logger.WithError(err).Error("Could not decode SLOs")
+		return nil
+	}
+
+	var results []ConfigResult
+	for _, slo := range sloList.SLOs {
+		if strings.Contains(slo.Name, entityNameMarker) {
+			results = append(results, dt.deleteConfigEntity("/api/v2/slo", slo.ID, slo.Name))
+		}
+	}
+	return results
+}
+
+// deleteMatchingConfigEntities deletes all entities of the configuration API v1 list endpoint whose name or ID matches
+func (dt *DynatraceHelper) deleteMatchingConfigEntities(apiPath string, matches func(name string, id string) bool) []ConfigResult {
+	logger := logging.FromContext(dt.EventContext)
+	response, err := dt.sendDynatraceAPIRequest(apiPath, "GET", nil)
+	if err != nil {
+		logger.WithError(err).WithField("apiPath", apiPath).Error("Could not retrieve configuration entities")
+		return nil
+	}
+	entities := &DTAPIListResponse{}
+	if err := json.Unmarshal([]byte(response), entities); err != nil {
+		logger.WithError(checkForUnexpectedHTMLResponseError(err)).WithField("apiPath", apiPath).Error("Could not parse configuration entities")
+		return nil
+	}
+
+	var results []ConfigResult
+	for _, entity := range entities.Values {
+		if matches(entity.Name, entity.ID) {
+			results = append(results, dt.deleteConfigEntity(apiPath, entity.ID, entity.Name))
+		}
+	}
+	return results
+}
+
+// deleteMatchingSettingsObjects deletes all settings objects of the schema whose field matches
+func (dt *DynatraceHelper) deleteMatchingSettingsObjects(schemaID string, field string, matches func(name string, id string) bool) []ConfigResult {
+	return dt.deleteSettingsObjects(schemaID, field, func(fields map[string]interface{}, id string) bool {
+		name, _ := fields[field].(string)
+		return matches(name, id)
+	})
+}
+
+// deleteSettingsObjects deletes all settings objects of the schema whose fields match, the field is used as name of the results
+func (dt *DynatraceHelper) deleteSettingsObjects(schemaID string, field string, matches func(fields map[string]interface{}, id string) bool) []ConfigResult {
+	logger := logging.FromContext(dt.EventContext)
+	objects, err := dt.getSettingsObjects(schemaID, settingsEnvironmentScope)
+	if err != nil {
+		logger.WithError(err).WithField("schemaId", schemaID).Error("Could not retrieve settings objects")
+		return nil
+	}
+
+	var results []ConfigResult
+	for _, object := range objects {
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(object.Value, &fields); err != nil {
+			continue
+		}
+		if !matches(fields, object.ObjectID) {
+			continue
+		}
+		name, _ := fields[field].(string)
+
+		result := ConfigResult{Name: name, Success: true}
+		if err := dt.deleteSettingsObject(object.ObjectID); err != nil {
+			// Error occurred but continue
+			logger.WithError(err).WithField("name", name).Error("Could not delete settings object")
+			result.Success = false
+			result.Message = fmt.Sprintf("could not delete %s: %v", name, err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (dt *DynatraceHelper) deleteConfigEntity(apiPath string, id string, name string) ConfigResult {
+	logger := logging.FromContext(dt.EventContext)
+	if _, err := dt.sendDynatraceAPIRequest(apiPath+"/"+id, "DELETE", nil); err != nil {
+		// Error occurred but continue
+		logger.WithError(err).WithField("name", name).Error("Could not delete configuration entity")
+		return ConfigResult{Name: name, Success: false, Message: fmt.Sprintf("could not delete %s: %v", name, err)}
+	}
+	return ConfigResult{Name: name, Success: true}
+}
+
+// nameHasPrefixOrEquals matches the names of the entities of the stages, e.g: Keptn: sockshop dev, and of the project itself, e.g: Keptn: sockshop
+func nameHasPrefixOrEquals(prefix string) func(name string, id string) bool {
+	return func(name string, id string) bool {
+		return strings.HasPrefix(name, prefix) || name == strings.TrimSuffix(prefix, " ")
+	}
+}
+
+func nameIsOneOf(names []string) func(name string, id string) bool {
+	return func(name string, id string) bool {
+		return containsString(names, name)
+	}
+}
+
+func nameContains(substring string) func(name string, id string) bool {
+	return func(name string, id string) bool {
+		return strings.Contains(name, substring)
+	}
+}
@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_DeleteProjectConfiguration(t *testing.T) {
+	getKeptnProjectsBackup := getKeptnProjects
+	defer func() { getKeptnProjects = getKeptnProjectsBackup }()
+	getKeptnProjects = func() ([]string, error) {
+		return []string{"other"}, nil
+	}
+
+	responses := map[string]string{
+		"/api/config/v1/notifications":                 `{"values": [{"id": "n-1", "name": "Keptn Problem Notification: sockshop dev"}, {"id": "n-2", "name": "Keptn Problem Notification: other dev"}, {"id": "n-3", "name": "Keptn Problem Notification"}, {"id": "n-4", "name": "Keptn Problem Notification: sockshop"}]}`,
+		"/api/config/v1/alertingProfiles":              `{"values": [{"id": "ap-1", "name": "Keptn: sockshop dev"}, {"id": "ap-2", "name": "Keptn: sockshop-two dev"}, {"id": "ap-3", "name": "Keptn"}, {"id": "ap-4", "name": "Keptn: sockshop"}]}`,
+		"/api/config/v1/anomalyDetection/metricEvents": `{"values": [{"id": "me-1", "name": "error_rate (Keptn.sockshop.dev.carts)"}, {"id": "me-2", "name": "error_rate (Keptn.other.dev.carts)"}]}`,
+		"/api/v2/slo": `{"slo": [{"id": "slo-1", "name": "error_rate (Keptn.sockshop.dev.carts)"}]}`,
+		"/api/config/v1/calculatedMetrics/service": `{"values": [{"id": "calc:service.teststepresponsetimesockshop", "name": "Test Step Response Time (sockshop)"}, {"id": "calc:service.teststepresponsetimeother", "name": "Test Step Response Time (other)"}]}`,
+		"/api/config/v1/dashboards":                `{"dashboards": [{"id": "db-1", "name": "sockshop@keptn: Digital Delivery & Operations Dashboard"}]}`,
+		"/api/config/v1/managementZones":           `{"values": [{"id": "1", "name": "Keptn: sockshop dev"}, {"id": "2", "name": "Keptn: other dev"}]}`,
+		"/api/config/v1/managementZones/1":         `{"name": "Keptn: sockshop dev", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=dev)"}`,
+		"/api/config/v1/managementZones/2":         `{"name": "Keptn: other dev", "description": "Managed by Keptn dynatrace-service (project=other, stage=dev)"}`,
+	}
+
+	var deleted []string
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodDelete {
+			deleted = append(deleted, request.URL.Path)
+			writer.WriteHeader(204)
+			return
+		}
+		response, ok := responses[request.URL.Path]
+		if !ok {
+			t.Errorf("DeleteProjectConfiguration(): unexpected request %s %s", request.Method, request.URL.Path)
+			writer.WriteHeader(404)
+			return
+		}
+		writer.Write([]byte(response))
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+	settingsAPISupported := false
+	dt.settingsAPISupported = &settingsAPISupported
+
+	results := dt.DeleteProjectConfiguration("sockshop")
+
+	want := []string{
+		"/api/config/v1/alertingProfiles/ap-1",
+		"/api/config/v1/alertingProfiles/ap-4",
+		"/api/config/v1/anomalyDetection/metricEvents/me-1",
+		"/api/config/v1/calculatedMetrics/service/calc:service.teststepresponsetimesockshop",
+		"/api/config/v1/dashboards/db-1",
+		"/api/config/v1/managementZones/1",
+		"/api/config/v1/notifications/n-1",
+		"/api/config/v1/notifications/n-4",
+		"/api/v2/slo/slo-1",
+	}
+	sort.Strings(deleted)
+	if strings.Join(deleted, ",") != strings.Join(want, ",") {
+		t.Errorf("DeleteProjectConfiguration() deleted %v, want %v", deleted, want)
+	}
+	for _, result := range results {
+		if !result.Success {
+			t.Errorf("DeleteProjectConfiguration() failed for %s: %s", result.Name, result.Message)
+		}
+	}
+}
+
+func TestDynatraceHelper_DeleteProjectConfiguration_SharedEntities(t *testing.T) {
+	tests := []struct {
+		name                string
+		cleanupTaggingRules string
+		installationID      string
+		wantDeleted         []string
+	}{
+		{
+			name:        "keep tagging rules by default",
+			wantDeleted: []string{"/api/config/v1/managementZones/1"},
+		},
+		{
+			name:                "delete tagging rules with the ownership marker with the last project if enabled",
+			cleanupTaggingRules: "true",
+			wantDeleted:         []string{"/api/config/v1/autoTags/t-1", "/api/config/v1/managementZones/1"},
+		},
+		{
+			name:           "only delete management zones with the ownership marker of the same installation",
+			installationID: "staging",
+			wantDeleted:    []string{"/api/config/v1/managementZones/2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getKeptnProjectsBackup := getKeptnProjects
+			defer func() { getKeptnProjects = getKeptnProjectsBackup }()
+			getKeptnProjects = func() ([]string, error) {
+				return []string{}, nil
+			}
+			os.Setenv("CLEANUP_TAGGING_RULES", tt.cleanupTaggingRules)
+			defer os.Unsetenv("CLEANUP_TAGGING_RULES")
+			os.Setenv("KEPTN_INSTALLATION_ID", tt.installationID)
+			defer os.Unsetenv("KEPTN_INSTALLATION_ID")
+
+			responses := map[string]string{
+				"/api/config/v1/autoTags":          `{"values": [{"id": "t-1", "name": "keptn_project"}, {"id": "t-2", "name": "owner"}, {"id": "t-3", "name": "keptn_stage"}]}`,
+				"/api/config/v1/autoTags/t-1":      `{"name": "keptn_project", "description": "Managed by Keptn dynatrace-service"}`,
+				"/api/config/v1/autoTags/t-3":      `{"name": "keptn_stage", "description": "Tagging rule of the platform team"}`,
+				"/api/config/v1/managementZones":   `{"values": [{"id": "1", "name": "Keptn: sockshop dev"}, {"id": "2", "name": "Keptn: sockshop prod"}, {"id": "3", "name": "Keptn: sockshop staging"}]}`,
+				"/api/config/v1/managementZones/1": `{"name": "Keptn: sockshop dev", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=dev)"}`,
+				"/api/config/v1/managementZones/2": `{"name": "Keptn: sockshop prod", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=prod, installation=staging)"}`,
+				"/api/config/v1/managementZones/3": `{"name": "Keptn: sockshop staging", "description": ""}`,
+			}
+
+			var deleted []string
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method == http.MethodDelete {
+					deleted = append(deleted, request.URL.Path)
+					writer.WriteHeader(204)
+					return
+				}
+				response, ok := responses[request.URL.Path]
+				if !ok {
+					writer.Write([]byte(`{"values": []}`))
+					return
+				}
+				writer.Write([]byte(response))
+			}))
+			defer dtMockServer.Close()
+
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+			settingsAPISupported := false
+			dt.settingsAPISupported = &settingsAPISupported
+
+			dt.DeleteProjectConfiguration("sockshop")
+
+			sort.Strings(deleted)
+			if strings.Join(deleted, ",") != strings.Join(tt.wantDeleted, ",") {
+				t.Errorf("DeleteProjectConfiguration() deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_GetProjectStages(t *testing.T) {
+	responses := map[string]string{
+		"/api/config/v1/managementZones":   `{"values": [{"id": "1", "name": "Keptn: sockshop"}, {"id": "2", "name": "Keptn: sockshop dev"}, {"id": "3", "name": "Keptn: sockshop production"}, {"id": "4", "name": "Keptn: sockshop production primary"}, {"id": "5", "name": "Keptn: other dev"}, {"id": "6", "name": "Keptn: sockshop staging"}]}`,
+		"/api/config/v1/managementZones/1": `{"name": "Keptn: sockshop", "description": "Managed by Keptn dynatrace-service (project=sockshop)"}`,
+		"/api/config/v1/managementZones/2": `{"name": "Keptn: sockshop dev", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=dev)"}`,
+		"/api/config/v1/managementZones/3": `{"name": "Keptn: sockshop production", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=production)"}`,
+		"/api/config/v1/managementZones/4": `{"name": "Keptn: sockshop production primary", "description": "Managed by Keptn dynatrace-service (project=sockshop, stage=production, zone=primary)"}`,
+		"/api/config/v1/managementZones/5": `{"name": "Keptn: other dev", "description": "Managed by Keptn dynatrace-service (project=other, stage=dev)"}`,
+		"/api/config/v1/managementZones/6": `{"name": "Keptn: sockshop staging", "description": ""}`,
+	}
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		response, ok := responses[request.URL.Path]
+		if !ok {
+			t.Errorf("GetProjectStages(): unexpected request %s %s", request.Method, request.URL.Path)
+			writer.WriteHeader(404)
+			return
+		}
+		writer.Write([]byte(response))
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	got := dt.GetProjectStages("sockshop")
+	want := []string{"dev", "production"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("GetProjectStages() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/keptnevents"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	"github.com/keptn-contrib/dynatrace-service/pkg/metrics"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxPendingRetries limits the number of requests that wait for a retry, so that an unavailable tenant doesn't fill up the memory
+const maxPendingRetries = 100
+
+// dynatraceRetryQueue retries the requests of all DynatraceHelpers
+var dynatraceRetryQueue = &retryQueue{
+	initialBackoff: 5 * time.Second,
+}
+
+/**
+ * retryQueue is a small in-memory queue that retries failed requests to the Dynatrace API with an exponential backoff
+ * Requests are lost when the dynatrace-service restarts
+ */
+type retryQueue struct {
+	mutex          sync.Mutex
+	pending        int
+	initialBackoff time.Duration
+}
+
+/**
+ * Schedules the retries of a failed request - the backoff doubles after each attempt, e.g: 5s, 10s, 20s
+ * onFailure is called with the last error if all attempts failed, an attempt failed with a permanentError or if too many requests are waiting for a retry
+ * The retries are logged with the logger of the event that sent the request
+ */
+func (q *retryQueue) add(logger *log.Entry, description string, maxAttempts int, send func() error, onFailure func(error)) {
+	q.mutex.Lock()
+	if q.pending >= maxPendingRetries {
+		q.mutex.Unlock()
+		logger.WithField("request", description).Error("Too many requests are waiting for a retry - dropping request")
+		metrics.ObserveRetry(metrics.RetryDropped)
+		onFailure(errTooManyRetries)
+		return
+	}
+	q.pending++
+	q.mutex.Unlock()
+
+	q.schedule(logger, description, 1, maxAttempts, q.initialBackoff, send, onFailure)
+}
+
+func (q *retryQueue) schedule(logger *log.Entry, description string, attempt int, maxAttempts int, backoff time.Duration, send func() error, onFailure func(error)) {
+	time.AfterFunc(backoff, func() {
+		err := send()
+		if err == nil {
+			metrics.ObserveRetry(metrics.RetrySucceeded)
+			logger.WithFields(
+				log.Fields{
+					"request": description,
+					"attempt": attempt,
+				}).Info("Retried request successfully")
+			q.done()
+			return
+		}
+
+		metrics.ObserveRetry(metrics.RetryFailed)
+		if attempt >= maxAttempts || isPermanentError(err) {
+			logger.WithError(err).WithFields(
+				log.Fields{
+					"request":  description,
+					"attempts": attempt,
+				}).Error("Giving up retrying request")
+			q.done()
+			onFailure(err)
+			return
+		}
+
+		logger.WithError(err).WithFields(
+			log.Fields{
+				"request": description,
+				"attempt": attempt,
+			}).Warn("Retry of request failed")
+		q.schedule(logger, description, attempt+1, maxAttempts, backoff*2, send, onFailure)
+	})
+}
+
+func (q *retryQueue) done() {
+	q.mutex.Lock()
+	q.pending--
+	q.mutex.Unlock()
+}
+
+var errTooManyRetries = errors.New("too many requests are waiting for a retry")
+
+// permanentError marks an error of a retried request that won't succeed with further attempts, so that the retries are stopped
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func isPermanentError(err error) bool {
+	var permanentErr *permanentError
+	return errors.As(err, &permanentErr)
+}
+
+/**
+ * isRetryableRequestError returns whether a failed request to the Dynatrace API may succeed if it is sent again: a 429 response has not been processed
+ * and can always be retried, 5xx responses and network errors only if the request is idempotent - otherwise it may have been processed already,
+ * e.g. a POST of an event that is retried would create the event twice
+ */
+func isRetryableRequestError(err error, idempotent bool) bool {
+	var requestErr *apiRequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.statusCode == http.StatusTooManyRequests || (idempotent && requestErr.statusCode >= 500)
+	}
+	var urlErr *url.Error
+	return idempotent && errors.As(err, &urlErr)
+}
+
+/**
+ * Sends a request to the Dynatrace API and queues it for retries if it fails with a retryable error, see isRetryableRequestError
+ * If the retries fail as well, the error is reported to Keptn as sh.keptn.log.error event so it shows up in the bridge
+ * Returns the error of the first attempt, the request is retried in the background
+ */
+func (dt *DynatraceHelper) sendWithRetry(description string, idempotent bool, send func() error) error {
+	logger := logging.FromContext(dt.EventContext)
+	err := send()
+	if err == nil {
+		return nil
+	}
+
+	maxAttempts := GetRetryAttempts(dt.EventContext)
+	if maxAttempts <= 0 || !isRetryableRequestError(err, idempotent) {
+		dt.reportErrorToKeptn(description, err)
+		return err
+	}
+
+	logger.WithError(err).WithField("request", description).Warn("Request to Dynatrace API failed - will be retried")
+	retry := func() error {
+		err := send()
+		if err != nil && !isRetryableRequestError(err, idempotent) {
+			return &permanentError{err: err}
+		}
+		return err
+	}
+	dynatraceRetryQueue.add(logger, description, maxAttempts, retry, func(err error) {
+		dt.reportErrorToKeptn(description, err)
+	})
+	return err
+}
+
+// RetryInBackground queues a request that failed with err, e.g. to a problem sink, for RETRY_ATTEMPTS retries - onFailure is called if they fail as well or no retries are configured
+func RetryInBackground(logger *log.Entry, description string, err error, send func() error, onFailure func(error)) {
+	maxAttempts := GetRetryAttempts(logging.NewContext(context.Background(), logger))
+	if maxAttempts <= 0 {
+		onFailure(err)
+		return
+	}
+	dynatraceRetryQueue.add(logger, description, maxAttempts, send, onFailure)
+}
+
+// reportErrorToKeptn sends a sh.keptn.log.error event for the Keptn event that is handled by the DynatraceHelper
+func (dt *DynatraceHelper) reportErrorToKeptn(description string, err error) {
+	logger := logging.FromContext(dt.EventContext)
+	if dt.KeptnHandler == nil || dt.KeptnHandler.CloudEvent == nil {
+		return
+	}
+
+	incomingEvent := dt.KeptnHandler.CloudEvent
+	ce, err := keptnevents.NewEvent(*incomingEvent, keptnv2.ErrorLogEventName, keptnv2.ErrorLogEvent{
+		Message: "dynatrace-service could not " + description + ": " + err.Error(),
+		Task:    incomingEvent.Type(),
+	})
+	if err == nil {
+		err = keptnevents.Send(dt.EventContext, ce)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Could not report error to Keptn")
+	}
+}
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRetryQueue_add(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		maxAttempts   int
+		wantAttempts  int
+		wantOnFailure bool
+	}{
+		{
+			name:          "succeeds on second retry",
+			failures:      1,
+			maxAttempts:   3,
+			wantAttempts:  2,
+			wantOnFailure: false,
+		},
+		{
+			name:          "gives up after max attempts",
+			failures:      5,
+			maxAttempts:   3,
+			wantAttempts:  3,
+			wantOnFailure: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &retryQueue{initialBackoff: time.Millisecond}
+
+			attempts := 0
+			finished := make(chan bool, 1)
+			send := func() error {
+				attempts++
+				if attempts <= tt.failures {
+					if attempts == tt.maxAttempts {
+						defer func() { finished <- true }()
+					}
+					return errors.New("tenant not available")
+				}
+				finished <- false
+				return nil
+			}
+
+			failed := make(chan error, 1)
+			q.add(log.NewEntry(log.StandardLogger()), "send event", tt.maxAttempts, send, func(err error) { failed <- err })
+
+			select {
+			case <-finished:
+			case <-time.After(time.Second):
+				t.Fatalf("retryQueue.add() did not finish retrying")
+			}
+
+			if tt.wantOnFailure {
+				select {
+				case <-failed:
+				case <-time.After(time.Second):
+					t.Errorf("retryQueue.add() did not call onFailure")
+				}
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("retryQueue.add() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestIsRetryableRequestError(t *testing.T) {
+	networkErr := fmt.Errorf("failed to do request: %w", &url.Error{Op: "Post", URL: "https://mytenant.live.dynatrace.com/api/v1/events", Err: errors.New("connection refused")})
+	tests := []struct {
+		name       string
+		err        error
+		idempotent bool
+		want       bool
+	}{
+		{
+			name: "too many requests",
+			err:  &apiRequestError{statusCode: http.StatusTooManyRequests},
+			want: true,
+		},
+		{
+			name:       "server error of idempotent request",
+			err:        &apiRequestError{statusCode: http.StatusServiceUnavailable},
+			idempotent: true,
+			want:       true,
+		},
+		{
+			name: "server error of request that isn't idempotent",
+			err:  &apiRequestError{statusCode: http.StatusServiceUnavailable},
+			want: false,
+		},
+		{
+			name:       "client error",
+			err:        &apiRequestError{statusCode: http.StatusBadRequest},
+			idempotent: true,
+			want:       false,
+		},
+		{
+			name:       "network error of idempotent request",
+			err:        networkErr,
+			idempotent: true,
+			want:       true,
+		},
+		{
+			name: "network error of request that isn't idempotent",
+			err:  networkErr,
+			want: false,
+		},
+		{
+			name:       "invalid client certificate",
+			err:        errors.New("failed to create client: invalid client certificate"),
+			idempotent: true,
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableRequestError(tt.err, tt.idempotent); got != tt.want {
+				t.Errorf("isRetryableRequestError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryQueue_add_PermanentError(t *testing.T) {
+	q := &retryQueue{initialBackoff: time.Millisecond}
+
+	attempts := 0
+	send := func() error {
+		attempts++
+		return &permanentError{err: errors.New("bad request")}
+	}
+
+	failed := make(chan error, 1)
+	q.add(log.NewEntry(log.StandardLogger()), "send event", 3, send, func(err error) { failed <- err })
+
+	select {
+	case err := <-failed:
+		if err.Error() != "bad request" {
+			t.Errorf("retryQueue.add() onFailure error = %v, want bad request", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("retryQueue.add() did not call onFailure")
+	}
+	if attempts != 1 {
+		t.Errorf("retryQueue.add() attempts = %d, want 1", attempts)
+	}
+}
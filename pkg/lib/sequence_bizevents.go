@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"encoding/json"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+// bizEventProvider is the event.provider of the business events of Keptn sequences, which identifies them in DQL queries
+const bizEventProvider = "keptn"
+
+/**
+ * Sends a business event to the Dynatrace bizevents ingest API, e.g: {"event.type": "sh.keptn.event.deployment.finished", "keptn.project": "sockshop", ...}
+ * Business events can be analyzed with DQL, e.g: fetch bizevents | filter event.provider == "keptn" | summarize avg(keptn.evaluation.score), by: {keptn.service}
+ * Failed requests are retried in the background
+ */
+func (dt *DynatraceHelper) SendBizEvent(bizEvent map[string]interface{}) {
+	logger := logging.FromContext(dt.EventContext)
+	logger.WithField("eventType", bizEvent["event.type"]).Info("Sending business event to Dynatrace API")
+
+	if _, ok := bizEvent["event.provider"]; !ok {
+		bizEvent["event.provider"] = bizEventProvider
+	}
+
+	jsonString, err := json.Marshal(bizEvent)
+	if err != nil {
+		logger.WithError(err).Error("Error while generating Dynatrace API Request payload.")
+		return
+	}
+
+	err = dt.sendWithRetry("send business event to Dynatrace", false, func() error {
+		body, err := dt.sendDynatraceAPIRequest("/api/v2/bizevents/ingest", "POST", jsonString)
+		if err != nil {
+			return err
+		}
+		logger.WithField("body", body).Debug("Dynatrace API has accepted the business event")
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed sending Dynatrace API request - the business event will be retried")
+	}
+}
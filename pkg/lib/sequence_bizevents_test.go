@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_SendBizEvent(t *testing.T) {
+	var sentBizEvent map[string]interface{}
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/v2/bizevents/ingest" {
+			t.Errorf("SendBizEvent(): unexpected path %s", request.URL.Path)
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		if err := json.Unmarshal(body, &sentBizEvent); err != nil {
+			t.Errorf("SendBizEvent(): could not parse business event: %v", err)
+		}
+		writer.WriteHeader(202)
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	dt.SendBizEvent(map[string]interface{}{
+		"event.type":             "sh.keptn.event.evaluation.finished",
+		"keptn.project":          "sockshop",
+		"keptn.evaluation.score": 87.5,
+	})
+
+	want := map[string]interface{}{
+		"event.type":             "sh.keptn.event.evaluation.finished",
+		"event.provider":         "keptn",
+		"keptn.project":          "sockshop",
+		"keptn.evaluation.score": 87.5,
+	}
+	if !reflect.DeepEqual(sentBizEvent, want) {
+		t.Errorf("SendBizEvent() sent %v, want %v", sentBizEvent, want)
+	}
+}
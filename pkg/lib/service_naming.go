@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+// serviceNamingRuleName is the display name of the service naming rule that is set up by the dynatrace-service
+const serviceNamingRuleName = "Keptn: service and stage"
+
+/**
+ * EnsureServiceNamingRulesAreSetUp creates or updates the service naming rule that names the services deployed by Keptn after
+ * their keptn_service and keptn_stage, e.g: carts (dev) - the rule only applies to process groups with both environment variables
+ */
+func (dt *DynatraceHelper) EnsureServiceNamingRulesAreSetUp() {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isServiceNamingRulesGenerationEnabled() {
+		return
+	}
+
+	logger.Info("Setting up service naming rules in Dynatrace Tenant")
+
+	namingRule := createServiceNamingRule()
+	result := ConfigResult{
+		Name:    namingRule.DisplayName,
+		Success: true,
+		Action:  ConfigActionCreated,
+	}
+
+	existingRule, err := dt.findServiceNamingRule(namingRule.DisplayName)
+	if err != nil {
+		// Error occurred but continue
+		logger.WithError(err).Error("Could not get existing service naming rules")
+	}
+	if existingRule != nil {
+		result.Action = ConfigActionUpdated
+		result.Message = "Service naming rule " + namingRule.DisplayName + " already exists and has been updated"
+	}
+
+	if err := dt.upsertServiceNamingRule(namingRule, existingRule); err != nil {
+		// Error occurred but continue
+		logger.WithError(err).Error("Could not create or update service naming rule")
+		result.Success = false
+		result.Message = "Could not create or update service naming rule: " + err.Error()
+	}
+	dt.configuredEntities.ServiceNamingRules = append(dt.configuredEntities.ServiceNamingRules, result)
+}
+
+// findServiceNamingRule returns the service naming rule with the passed display name or nil if it doesn't exist
+func (dt *DynatraceHelper) findServiceNamingRule(displayName string) (*Values, error) {
+	response, err := dt.sendDynatraceAPIRequest("/api/config/v1/conditionalNaming/service", "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	existingRules := &DTAPIListResponse{}
+	if err := json.Unmarshal([]byte(response), existingRules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal service naming rules: %v", err)
+	}
+	for i, rule := range existingRules.Values {
+		if rule.Name == displayName {
+			return &existingRules.Values[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// upsertServiceNamingRule creates the service naming rule or overwrites the existing one so that changes of the rule are applied to the tenant
+func (dt *DynatraceHelper) upsertServiceNamingRule(namingRule *ServiceNamingRule, existingRule *Values) error {
+	payload, err := json.Marshal(namingRule)
+	if err != nil {
+		return fmt.Errorf("could not marshal service naming rule: %v", err)
+	}
+
+	if existingRule == nil {
+		_, err = dt.sendDynatraceAPIRequest("/api/config/v1/conditionalNaming/service", "POST", payload)
+		return err
+	}
+	_, err = dt.sendDynatraceAPIRequest("/api/config/v1/conditionalNaming/service/"+existingRule.ID, "PUT", payload)
+	return err
+}
+
+// createServiceNamingRule returns the service naming rule that uses the keptn_service and keptn_stage environment variables of the process group
+func createServiceNamingRule() *ServiceNamingRule {
+	namingRule := &ServiceNamingRule{
+		Type:        "SERVICE",
+		NameFormat:  "{ProcessGroup:Environment:keptn_service} ({ProcessGroup:Environment:keptn_stage})",
+		DisplayName: serviceNamingRuleName,
+		Enabled:     true,
+	}
+	for _, key := range []string{"keptn_service", "keptn_stage"} {
+		namingRule.Conditions = append(namingRule.Conditions, Conditions{
+			Key: Key{
+				Attribute: "PROCESS_GROUP_CUSTOM_METADATA",
+				DynamicKey: &DynamicKey{
+					Source: "ENVIRONMENT",
+					Key:    key,
+				},
+				Type: "PROCESS_CUSTOM_METADATA_KEY",
+			},
+			ComparisonInfo: ComparisonInfo{
+				Type:          "STRING",
+				Operator:      "EXISTS",
+				Value:         nil,
+				Negate:        false,
+				CaseSensitive: nil,
+			},
+		})
+	}
+	return namingRule
+}
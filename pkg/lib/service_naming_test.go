@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_EnsureServiceNamingRulesAreSetUp(t *testing.T) {
+	tests := []struct {
+		name          string
+		existingRules string
+		wantRequest   string
+		wantAction    string
+	}{
+		{
+			name:          "create naming rule",
+			existingRules: `{"values": [{"id": "rule-1", "name": "other"}]}`,
+			wantRequest:   "POST /api/config/v1/conditionalNaming/service",
+			wantAction:    ConfigActionCreated,
+		},
+		{
+			name:          "update existing naming rule",
+			existingRules: `{"values": [{"id": "rule-1", "name": "other"}, {"id": "rule-2", "name": "Keptn: service and stage"}]}`,
+			wantRequest:   "PUT /api/config/v1/conditionalNaming/service/rule-2",
+			wantAction:    ConfigActionUpdated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			namingRule := &ServiceNamingRule{}
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method == http.MethodGet {
+					writer.Write([]byte(tt.existingRules))
+					return
+				}
+				requests = append(requests, request.Method+" "+request.URL.Path)
+				body, _ := ioutil.ReadAll(request.Body)
+				if err := json.Unmarshal(body, namingRule); err != nil {
+					t.Errorf("EnsureServiceNamingRulesAreSetUp(): could not unmarshal naming rule: %v", err)
+				}
+			}))
+			defer dtMockServer.Close()
+
+			os.Setenv("GENERATE_SERVICE_NAMING_RULES", "true")
+			defer os.Unsetenv("GENERATE_SERVICE_NAMING_RULES")
+
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+			dt.configuredEntities = &ConfiguredEntities{}
+
+			dt.EnsureServiceNamingRulesAreSetUp()
+
+			if len(requests) != 1 || requests[0] != tt.wantRequest {
+				t.Errorf("EnsureServiceNamingRulesAreSetUp() requests = %v, want %s", requests, tt.wantRequest)
+			}
+			if namingRule.NameFormat != "{ProcessGroup:Environment:keptn_service} ({ProcessGroup:Environment:keptn_stage})" || len(namingRule.Conditions) != 2 {
+				t.Errorf("EnsureServiceNamingRulesAreSetUp() naming rule = %+v", namingRule)
+			}
+			results := dt.configuredEntities.ServiceNamingRules
+			if len(results) != 1 || !results[0].Success || results[0].Action != tt.wantAction {
+				t.Errorf("EnsureServiceNamingRulesAreSetUp() results = %+v, want a successful %s result", results, tt.wantAction)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package lib
 
 import (
 	"bytes"
+	"context"
 	b64 "encoding/base64"
 	"encoding/json"
 	"errors"
@@ -144,17 +145,17 @@ func ActivateServiceSynchronizer(c *credentials.CredentialManager) *serviceSynch
 		serviceSynchronizerInstance.dtConfigGetter = &adapter.DynatraceConfigGetter{}
 		serviceSynchronizerInstance.DTHelper = NewDynatraceHelper(nil, nil)
 
-		configServiceBaseURL := common.GetConfigurationServiceURL()
+		resourceServiceBaseURL := common.GetResourceServiceURL()
 		shipyardControllerBaseURL := common.GetShipyardControllerURL()
 		log.WithFields(
 			log.Fields{
-				"configServiceBaseURL":      configServiceBaseURL,
+				"resourceServiceBaseURL":    resourceServiceBaseURL,
 				"shipyardControllerBaseURL": shipyardControllerBaseURL,
 			}).Debug("Initializing Service Synchronizer")
 
 		serviceSynchronizerInstance.projectsAPI = keptnapi.NewProjectHandler(shipyardControllerBaseURL)
 		serviceSynchronizerInstance.servicesAPI = keptnapi.NewServiceHandler(shipyardControllerBaseURL)
-		serviceSynchronizerInstance.resourcesAPI = keptnapi.NewResourceHandler(configServiceBaseURL)
+		serviceSynchronizerInstance.resourcesAPI = common.NewResourceHandler()
 
 		serviceSynchronizerInstance.initializeSynchronizationTimer()
 
@@ -163,7 +164,7 @@ func ActivateServiceSynchronizer(c *credentials.CredentialManager) *serviceSynch
 }
 
 func (s *serviceSynchronizer) initializeSynchronizationTimer() {
-	syncInterval := GetServiceSyncInterval()
+	syncInterval := GetServiceSyncInterval(context.Background())
 	log.WithField("syncInterval", syncInterval).Info("Service Synchronizer will sync periodically")
 	s.syncTimer = time.NewTicker(time.Duration(syncInterval) * time.Second)
 	go func() {
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+const settingsEnvironmentScope = "environment"
+
+const (
+	autoTaggingSchemaID             = "builtin:tags.auto-tagging"
+	alertingProfileSchemaID         = "builtin:alerting.profile"
+	problemNotificationSchemaID     = "builtin:problem.notifications"
+	metricEventSchemaID             = "builtin:anomaly-detection.metric-events"
+	serviceAnomalyDetectionSchemaID = "builtin:anomaly-detection.services"
+)
+
+// settingsObject is an object of the Dynatrace Settings 2.0 API
+type settingsObject struct {
+	ObjectID string          `json:"objectId,omitempty"`
+	SchemaID string          `json:"schemaId,omitempty"`
+	Scope    string          `json:"scope,omitempty"`
+	Value    json.RawMessage `json:"value"`
+}
+
+type settingsObjectsListResponse struct {
+	Items       []settingsObject `json:"items"`
+	NextPageKey string           `json:"nextPageKey"`
+}
+
+type settingsObjectCreateResponse struct {
+	Code     int    `json:"code"`
+	ObjectID string `json:"objectId"`
+}
+
+/**
+ * useSettingsAPI returns whether tagging rules, problem notifications and metric events are configured via the Settings 2.0 API
+ * Unless CONFIGURATION_API is set to settings or v1, the support of the tenant is detected once per DynatraceHelper via the schema of the auto-tagging rules.
+ * Only a tenant that doesn't know the API or the schema falls back to the configuration API v1 - other errors, e.g. timeouts or missing token scopes,
+ * are returned and not cached, so that a transient error doesn't create configuration API v1 entities next to existing settings objects
+ */
+func (dt *DynatraceHelper) useSettingsAPI() (bool, error) {
+	logger := logging.FromContext(dt.EventContext)
+	switch GetConfigurationAPI() {
+	case "settings":
+		return true, nil
+	case "v1":
+		return false, nil
+	}
+
+	if dt.settingsAPISupported == nil {
+		_, err := dt.sendDynatraceAPIRequest("/api/v2/settings/schemas/"+autoTaggingSchemaID, "GET", nil)
+		if err != nil && !isSettingsAPIUnsupportedError(err) {
+			return false, fmt.Errorf("could not determine whether the Settings 2.0 API is available: %w", err)
+		}
+		supported := err == nil
+		if !supported {
+			logger.WithError(err).Info("Settings 2.0 API is not available - using configuration API v1")
+		}
+		dt.settingsAPISupported = &supported
+	}
+	return *dt.settingsAPISupported, nil
+}
+
+// isSettingsAPIUnsupportedError returns whether the tenant responded that it doesn't know the Settings 2.0 API (404) or the schema (400)
+func isSettingsAPIUnsupportedError(err error) bool {
+	var requestErr *apiRequestError
+	return errors.As(err, &requestErr) && (requestErr.statusCode == http.StatusNotFound || requestErr.statusCode == http.StatusBadRequest)
+}
+
+// getSettingsObjects returns all settings objects of the schema in the scope
+func (dt *DynatraceHelper) getSettingsObjects(schemaID string, scope string) ([]settingsObject, error) {
+	query := url.Values{}
+	query.Set("schemaIds", schemaID)
+	query.Set("scopes", scope)
+	query.Set("fields", "objectId,value")
+	query.Set("pageSize", "500")
+
+	var objects []settingsObject
+	for {
+		response, err := dt.sendDynatraceAPIRequest("/api/v2/settings/objects?"+query.Encode(), "GET", nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve settings objects of %s: %v", schemaID, err)
+		}
+
+		list := &settingsObjectsListResponse{}
+		if err := json.Unmarshal([]byte(response), list); err != nil {
+			return nil, fmt.Errorf("could not decode settings objects of %s: %v", schemaID, err)
+		}
+		objects = append(objects, list.Items...)
+
+		if list.NextPageKey == "" {
+			return objects, nil
+		}
+		// the nextPageKey already contains all other query parameters
+		query = url.Values{}
+		query.Set("nextPageKey", list.NextPageKey)
+	}
+}
+
+/**
+ * upsertSettingsObject creates a new settings object if no objectID is passed and updates the existing object otherwise
+ * Returns the ID of the settings object
+ */
+func (dt *DynatraceHelper) upsertSettingsObject(schemaID string, scope string, objectID string, value interface{}) (string, error) {
+	rawValue, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	if objectID != "" {
+		payload, err := json.Marshal(settingsObject{Value: rawValue})
+		if err != nil {
+			return "", err
+		}
+		_, err = dt.sendDynatraceAPIRequest("/api/v2/settings/objects/"+objectID, "PUT", payload)
+		if err != nil {
+			return "", fmt.Errorf("could not update settings object of %s: %v", schemaID, err)
+		}
+		return objectID, nil
+	}
+
+	payload, err := json.Marshal([]settingsObject{{SchemaID: schemaID, Scope: scope, Value: rawValue}})
+	if err != nil {
+		return "", err
+	}
+	response, err := dt.sendDynatraceAPIRequest("/api/v2/settings/objects", "POST", payload)
+	if err != nil {
+		return "", fmt.Errorf("could not create settings object of %s: %v", schemaID, err)
+	}
+
+	created := []settingsObjectCreateResponse{}
+	if err := json.Unmarshal([]byte(response), &created); err != nil {
+		return "", fmt.Errorf("could not decode created settings object of %s: %v", schemaID, err)
+	}
+	if len(created) == 0 || created[0].ObjectID == "" {
+		return "", errors.New("no settings object of " + schemaID + " was created")
+	}
+	return created[0].ObjectID, nil
+}
+
+func (dt *DynatraceHelper) deleteSettingsObject(objectID string) error {
+	_, err := dt.sendDynatraceAPIRequest("/api/v2/settings/objects/"+objectID, "DELETE", nil)
+	return err
+}
+
+// findSettingsObject returns the first settings object whose value has the field with the given value, e.g: name=keptn_service
+func findSettingsObject(objects []settingsObject, field string, value string) *settingsObject {
+	for i, object := range objects {
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(object.Value, &fields); err != nil {
+			continue
+		}
+		if fieldValue, ok := fields[field].(string); ok && fieldValue == value {
+			return &objects[i]
+		}
+	}
+	return nil
+}
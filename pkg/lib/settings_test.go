@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_useSettingsAPI(t *testing.T) {
+	tests := []struct {
+		name               string
+		configurationAPI   string
+		schemaStatus       int
+		want               bool
+		wantErr            bool
+		wantSchemaRequests int
+	}{
+		{
+			name:               "tenant supports Settings 2.0",
+			schemaStatus:       200,
+			want:               true,
+			wantSchemaRequests: 1,
+		},
+		{
+			name:               "tenant doesn't support Settings 2.0",
+			schemaStatus:       404,
+			want:               false,
+			wantSchemaRequests: 1,
+		},
+		{
+			name:               "tenant doesn't know the schema",
+			schemaStatus:       400,
+			want:               false,
+			wantSchemaRequests: 1,
+		},
+		{
+			name:               "server error isn't cached",
+			schemaStatus:       503,
+			wantErr:            true,
+			wantSchemaRequests: 2,
+		},
+		{
+			name:               "token without settings.read isn't treated as unsupported",
+			schemaStatus:       403,
+			wantErr:            true,
+			wantSchemaRequests: 2,
+		},
+		{
+			name:               "configuration API v1 is forced",
+			configurationAPI:   "v1",
+			schemaStatus:       200,
+			want:               false,
+			wantSchemaRequests: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemaRequests := 0
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.URL.Path != "/api/v2/settings/schemas/builtin:tags.auto-tagging" {
+					t.Errorf("useSettingsAPI(): unexpected path %s", request.URL.Path)
+				}
+				schemaRequests++
+				writer.WriteHeader(tt.schemaStatus)
+			}))
+			defer dtMockServer.Close()
+
+			os.Setenv("CONFIGURATION_API", tt.configurationAPI)
+			defer os.Unsetenv("CONFIGURATION_API")
+
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+			// the second call must use the cached result unless the support couldn't be determined
+			for i := 0; i < 2; i++ {
+				got, err := dt.useSettingsAPI()
+				if (err != nil) != tt.wantErr {
+					t.Errorf("useSettingsAPI() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("useSettingsAPI() = %v, want %v", got, tt.want)
+				}
+			}
+			if schemaRequests != tt.wantSchemaRequests {
+				t.Errorf("useSettingsAPI() schema requests = %d, want %d", schemaRequests, tt.wantSchemaRequests)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_EnsureDTTaggingRulesAreSetUp_Settings(t *testing.T) {
+	var requests []string
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodGet && request.URL.Path == "/api/v2/settings/objects" {
+			if request.URL.Query().Get("schemaIds") != "builtin:tags.auto-tagging" {
+				t.Errorf("EnsureDTTaggingRulesAreSetUp(): unexpected schema %s", request.URL.Query().Get("schemaIds"))
+			}
+			// keptn_project is a rule of a user with the same name, which must not be overwritten
+			writer.Write([]byte(`{"items": [{"objectId": "obj-1", "value": {"name": "keptn_service", "description": "Managed by Keptn dynatrace-service", "rules": []}}, {"objectId": "obj-2", "value": {"name": "owner", "rules": []}}, {"objectId": "obj-3", "value": {"name": "keptn_project", "description": "Project tag of team A", "rules": []}}]}`))
+			return
+		}
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		if request.Method == http.MethodPost {
+			writer.Write([]byte(`[{"code": 200, "objectId": "new"}]`))
+		}
+	}))
+	defer dtMockServer.Close()
+
+	os.Setenv("GENERATE_TAGGING_RULES", "true")
+	defer os.Unsetenv("GENERATE_TAGGING_RULES")
+	os.Setenv("CONFIGURATION_API", "settings")
+	defer os.Unsetenv("CONFIGURATION_API")
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+	dt.configuredEntities = &ConfiguredEntities{}
+
+	dt.EnsureDTTaggingRulesAreSetUp()
+
+	wantRequests := []string{
+		"POST /api/v2/settings/objects",
+		"POST /api/v2/settings/objects",
+		"PUT /api/v2/settings/objects/obj-1",
+	}
+	sort.Strings(requests)
+	if strings.Join(requests, "\n") != strings.Join(wantRequests, "\n") {
+		t.Errorf("EnsureDTTaggingRulesAreSetUp() requests = %v, want %v", requests, wantRequests)
+	}
+	for _, result := range dt.configuredEntities.TaggingRules {
+		if result.Success == (result.Name == "keptn_project") {
+			t.Errorf("EnsureDTTaggingRulesAreSetUp() result of %s = %v: %s", result.Name, result.Success, result.Message)
+		}
+	}
+}
+
+func TestCreateProblemNotificationSettings(t *testing.T) {
+	notification, err := createProblemNotificationSettings("https://keptn", "my-token", "profile-id")
+	if err != nil {
+		t.Errorf("createProblemNotificationSettings() error = %v", err)
+		return
+	}
+
+	if notification.AlertingProfile != "profile-id" {
+		t.Errorf("createProblemNotificationSettings() alertingProfile = %s, want %s", notification.AlertingProfile, "profile-id")
+	}
+	if notification.WebHookNotification.URL != "https://keptn/v1/event" {
+		t.Errorf("createProblemNotificationSettings() url = %s, want %s", notification.WebHookNotification.URL, "https://keptn/v1/event")
+	}
+	if !strings.Contains(notification.WebHookNotification.Payload, "sh.keptn.events.problem") {
+		t.Errorf("createProblemNotificationSettings() payload = %s, want the Keptn problem event", notification.WebHookNotification.Payload)
+	}
+
+	for _, header := range notification.WebHookNotification.Headers {
+		if header.Name == "x-token" && (!header.Secret || header.SecretValue != "my-token" || header.Value != "") {
+			t.Errorf("createProblemNotificationSettings() x-token header = %v, want secret header", header)
+		}
+	}
+}
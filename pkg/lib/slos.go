@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+	keptn "github.com/keptn/go-utils/pkg/lib"
+	log "github.com/sirupsen/logrus"
+)
+
+const sloTimeframe = "-1w"
+
+// sloMetricExpressions contains the metric expressions of the SLIs that can be translated to Dynatrace SLOs - the expression must result in a percentage
+var sloMetricExpressions = map[string]string{
+	ErrorRate: "(100)*(builtin:service.errors.total.successCount:splitBy())/(builtin:service.requestCount.total:splitBy())",
+}
+
+/**
+ * CreateSLOs creates or updates a Dynatrace SLO for every objective of the slo.yaml of the service whose SLI is supported, so that the error
+ * budget is visible in Dynatrace while Keptn stays the source of truth. Only the default queries of the SLIs are supported, e.g: error_rate
+ */
+func (dt *DynatraceHelper) CreateSLOs(project string, stage string, service string) {
+	logger := logging.FromContext(dt.EventContext)
+	if !dt.isSLOsGenerationEnabled() {
+		return
+	}
+
+	slos, err := retrieveSLOs(project, stage, service)
+	if err != nil {
+		logger.WithError(err).WithFields(
+			log.Fields{
+				"service": service,
+				"stage":   stage}).Info("No SLOs defined for service. Skipping creation of Dynatrace SLOs.")
+		return
+	}
+	projectCustomQueries, err := dt.getCustomQueries(project, stage, service)
+	if err != nil {
+		logger.WithError(err).WithField("project", project).Error("Failed to get custom queries for project")
+		return
+	}
+
+	for _, objective := range slos.Objectives {
+		if _, isSupported := sloMetricExpressions[objective.SLI]; !isSupported {
+			continue
+		}
+		if _, isCustomQuery := projectCustomQueries[objective.SLI]; isCustomQuery {
+			logger.WithField("sli", objective.SLI).Info("SLI uses a custom query. Skipping creation of Dynatrace SLO.")
+			continue
+		}
+
+		slo, err := createDynatraceSLO(project, stage, service, objective)
+		if err != nil {
+			// Error occurred but continue
+			dt.configuredEntities.SLOs = append(dt.configuredEntities.SLOs, ConfigResult{
+				Name:    getSLOName(project, stage, service, objective.SLI),
+				Success: false,
+				Message: err.Error(),
+			})
+			continue
+		}
+
+		if err := dt.upsertSLO(slo); err != nil {
+			logger.WithError(err).WithField("name", slo.Name).Error("Could not create SLO")
+			dt.configuredEntities.SLOs = append(dt.configuredEntities.SLOs, ConfigResult{
+				Name:    slo.Name,
+				Success: false,
+				Message: err.Error(),
+			})
+			continue
+		}
+		dt.configuredEntities.SLOs = append(dt.configuredEntities.SLOs, ConfigResult{
+			Name:    slo.Name,
+			Success: true,
+		})
+	}
+}
+
+// upsertSLO creates the SLO or updates the existing SLO with the same name
+func (dt *DynatraceHelper) upsertSLO(slo *SLO) error {
+	payload, err := json.Marshal(slo)
+	if err != nil {
+		return fmt.Errorf("could not marshal SLO: %v", err)
+	}
+
+	existingSLO, err := dt.findSLO(slo.Name)
+	if err != nil {
+		return err
+	}
+	if existingSLO != nil {
+		_, err = dt.sendDynatraceAPIRequest("/api/v2/slo/"+existingSLO.ID, "PUT", payload)
+		return err
+	}
+	_, err = dt.sendDynatraceAPIRequest("/api/v2/slo", "POST", payload)
+	return err
+}
+
+// findSLO returns the SLO with the given name or nil if there is none
+func (dt *DynatraceHelper) findSLO(name string) (*SLO, error) {
+	query := url.Values{}
+	query.Set("sloSelector", "name(\""+name+"\")")
+	query.Set("pageSize", "100")
+
+	response, err := dt.sendDynatraceAPIRequest("/api/v2/slo?"+query.Encode(), "GET", nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve SLOs: %v", err)
+	}
+	sloList := &SLOListResponse{}
+	if err := json.Unmarshal([]byte(response), sloList); err != nil {
+		return nil, fmt.Errorf("could not decode SLOs: %v", err)
+	}
+	for i, slo := range sloList.SLOs {
+		if slo.Name == name {
+			return &sloList.SLOs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+/**
+ * createDynatraceSLO translates the objective to a Dynatrace SLO of the error free calls of the service.
+ * As the warning criteria of Keptn are weaker than the pass criteria, the warning criteria define the target of the SLO and the pass criteria its warning,
+ * e.g: pass <=1 and warning <=5 of the error_rate result in the target 95 and the warning 99
+ */
+func createDynatraceSLO(project string, stage string, service string, objective *keptn.SLO) (*SLO, error) {
+	passThreshold, err := getSLOThreshold(objective.Pass)
+	if err != nil {
+		return nil, fmt.Errorf("could not translate pass criteria: %v", err)
+	}
+
+	warningThreshold := passThreshold
+	if len(objective.Warning) > 0 {
+		warningThreshold, err = getSLOThreshold(objective.Warning)
+		if err != nil {
+			return nil, fmt.Errorf("could not translate warning criteria: %v", err)
+		}
+	}
+	if warningThreshold < passThreshold {
+		warningThreshold = passThreshold
+	}
+
+	return &SLO{
+		Name:             getSLOName(project, stage, service, objective.SLI),
+		Description:      "Keptn SLO " + objective.SLI + " of service " + service + " in stage " + stage + " of project " + project + ". Managed by Keptn dynatrace-service",
+		Enabled:          true,
+		EvaluationType:   "AGGREGATE",
+		Filter:           "type(SERVICE),tag(keptn_project:" + project + "),tag(keptn_stage:" + stage + "),tag(keptn_service:" + service + ")",
+		MetricExpression: sloMetricExpressions[objective.SLI],
+		Target:           100 - warningThreshold,
+		Warning:          100 - passThreshold,
+		Timeframe:        sloTimeframe,
+	}, nil
+}
+
+// getSLOThreshold returns the value of the first absolute upper bound of the criteria, e.g: 5 for <=5
+func getSLOThreshold(criteria []*keptn.SLOCriteria) (float64, error) {
+	for _, c := range criteria {
+		for _, crit := range c.Criteria {
+			criteriaObject, err := parseCriteriaString(crit)
+			if err != nil || criteriaObject.IsComparison || criteriaObject.CheckPercentage {
+				// relative criteria cannot be mapped to SLOs
+				continue
+			}
+			if criteriaObject.Operator == "<" || criteriaObject.Operator == "<=" {
+				return criteriaObject.Value, nil
+			}
+		}
+	}
+	return 0, errors.New("no absolute upper bound, e.g: <=5, is defined")
+}
+
+// getSLOName returns the name of the SLO, e.g: error_rate (Keptn.sockshop.production.carts)
+func getSLOName(project string, stage string, service string, sli string) string {
+	return sli + " (Keptn." + project + "." + stage + "." + service + ")"
+}
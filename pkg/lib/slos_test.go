@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+	keptn "github.com/keptn/go-utils/pkg/lib"
+)
+
+func TestCreateDynatraceSLO(t *testing.T) {
+	tests := []struct {
+		name        string
+		objective   *keptn.SLO
+		wantTarget  float64
+		wantWarning float64
+		wantErr     bool
+	}{
+		{
+			name: "pass and warning criteria",
+			objective: &keptn.SLO{
+				SLI:     ErrorRate,
+				Pass:    []*keptn.SLOCriteria{{Criteria: []string{"<=1"}}},
+				Warning: []*keptn.SLOCriteria{{Criteria: []string{"<=5"}}},
+			},
+			wantTarget:  95,
+			wantWarning: 99,
+		},
+		{
+			name: "relative criteria are ignored",
+			objective: &keptn.SLO{
+				SLI:  ErrorRate,
+				Pass: []*keptn.SLOCriteria{{Criteria: []string{"<=+10%", "<2"}}},
+			},
+			wantTarget:  98,
+			wantWarning: 98,
+		},
+		{
+			name: "no absolute upper bound",
+			objective: &keptn.SLO{
+				SLI:  ErrorRate,
+				Pass: []*keptn.SLOCriteria{{Criteria: []string{"<=+10%"}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createDynatraceSLO("sockshop", "production", "carts", tt.objective)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createDynatraceSLO() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Name != "error_rate (Keptn.sockshop.production.carts)" {
+				t.Errorf("createDynatraceSLO() name = %s, want %s", got.Name, "error_rate (Keptn.sockshop.production.carts)")
+			}
+			if got.Target != tt.wantTarget || got.Warning != tt.wantWarning {
+				t.Errorf("createDynatraceSLO() target = %v, warning = %v, want %v and %v", got.Target, got.Warning, tt.wantTarget, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_upsertSLO(t *testing.T) {
+	tests := []struct {
+		name         string
+		existingSLOs string
+		wantMethod   string
+		wantPath     string
+	}{
+		{
+			name:         "create new SLO",
+			existingSLOs: `{"slo": []}`,
+			wantMethod:   "POST",
+			wantPath:     "/api/v2/slo",
+		},
+		{
+			name:         "update existing SLO",
+			existingSLOs: `{"slo": [{"id": "slo-1", "name": "error_rate (Keptn.sockshop.production.carts)"}]}`,
+			wantMethod:   "PUT",
+			wantPath:     "/api/v2/slo/slo-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			written := false
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method == "GET" {
+					if request.URL.Query().Get("sloSelector") != `name("error_rate (Keptn.sockshop.production.carts)")` {
+						t.Errorf("upsertSLO(): unexpected sloSelector %s", request.URL.Query().Get("sloSelector"))
+					}
+					writer.Write([]byte(tt.existingSLOs))
+					return
+				}
+				if request.Method != tt.wantMethod || request.URL.Path != tt.wantPath {
+					t.Errorf("upsertSLO(): request = %s %s, want %s %s", request.Method, request.URL.Path, tt.wantMethod, tt.wantPath)
+				}
+				body, _ := ioutil.ReadAll(request.Body)
+				slo := &SLO{}
+				if err := json.Unmarshal(body, slo); err != nil || slo.MetricExpression == "" {
+					t.Errorf("upsertSLO(): invalid payload %s", body)
+				}
+				written = true
+				writer.WriteHeader(201)
+			}))
+			defer dtMockServer.Close()
+
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+			slo, _ := createDynatraceSLO("sockshop", "production", "carts", &keptn.SLO{
+				SLI:  ErrorRate,
+				Pass: []*keptn.SLOCriteria{{Criteria: []string{"<=1"}}},
+			})
+			if err := dt.upsertSLO(slo); err != nil {
+				t.Errorf("upsertSLO() error = %v", err)
+			}
+			if !written {
+				t.Errorf("upsertSLO() did not write the SLO")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type syntheticMonitorExecution struct {
+	MonitorID string `json:"monitorId"`
+}
+
+type syntheticExecutionGroup struct {
+	Tags []string `json:"tags"`
+}
+
+type syntheticExecutionRequest struct {
+	Monitors []syntheticMonitorExecution `json:"monitors,omitempty"`
+	Group    *syntheticExecutionGroup    `json:"group,omitempty"`
+}
+
+// SyntheticExecutionResult is the result of /api/v2/synthetic/executions/batch
+type SyntheticExecutionResult struct {
+	TriggeredCount            int `json:"triggeredCount"`
+	TriggeringProblemsCount   int `json:"triggeringProblemsCount"`
+	TriggeringProblemsDetails []struct {
+		EntityID string `json:"entityId"`
+		Cause    string `json:"cause"`
+		Details  string `json:"details"`
+	} `json:"triggeringProblemsDetails"`
+}
+
+/**
+ * TriggerSyntheticExecutions triggers an on-demand execution of synthetic monitors via the Dynatrace synthetic API v2
+ * The monitors are selected by their IDs, e.g: SYNTHETIC_TEST-1234567890ABCDEF and/or by their tags, e.g: keptn_service:carts
+ */
+func (dt *DynatraceHelper) TriggerSyntheticExecutions(monitorIDs []string, tags []string) (*SyntheticExecutionResult, error) {
+	if len(monitorIDs) == 0 && len(tags) == 0 {
+		return nil, errors.New("no synthetic monitor IDs or tags specified")
+	}
+
+	request := syntheticExecutionRequest{}
+	for _, monitorID := range monitorIDs {
+		request.Monitors = append(request.Monitors, syntheticMonitorExecution{MonitorID: monitorID})
+	}
+	if len(tags) > 0 {
+		request.Group = &syntheticExecutionGroup{Tags: tags}
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := dt.sendDynatraceAPIRequest("/api/v2/synthetic/executions/batch", http.MethodPost, payload)
+	if err != nil {
+		return nil, fmt.Errorf("could not trigger synthetic executions: %v", err)
+	}
+
+	result := &SyntheticExecutionResult{}
+	if err := json.Unmarshal([]byte(response), result); err != nil {
+		return nil, fmt.Errorf("could not decode response from Dynatrace API: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_TriggerSyntheticExecutions(t *testing.T) {
+	dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/v2/synthetic/executions/batch" {
+			t.Errorf("TriggerSyntheticExecutions(): unexpected path %s", request.URL.Path)
+		}
+
+		body, _ := ioutil.ReadAll(request.Body)
+		payload := syntheticExecutionRequest{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("TriggerSyntheticExecutions(): could not parse payload: %v", err)
+		}
+		if len(payload.Monitors) != 1 || payload.Monitors[0].MonitorID != "SYNTHETIC_TEST-1234" {
+			t.Errorf("TriggerSyntheticExecutions(): unexpected monitors %v", payload.Monitors)
+		}
+		if payload.Group == nil || len(payload.Group.Tags) != 1 || payload.Group.Tags[0] != "keptn_service:carts" {
+			t.Errorf("TriggerSyntheticExecutions(): unexpected group %v", payload.Group)
+		}
+
+		writer.WriteHeader(201)
+		writer.Write([]byte(`{"triggeredCount": 2, "triggeringProblemsCount": 0, "triggeringProblemsDetails": []}`))
+	}))
+	defer dtMockServer.Close()
+
+	dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL})
+
+	result, err := dt.TriggerSyntheticExecutions([]string{"SYNTHETIC_TEST-1234"}, []string{"keptn_service:carts"})
+	if err != nil {
+		t.Errorf("TriggerSyntheticExecutions() error = %v", err)
+		return
+	}
+	if result.TriggeredCount != 2 {
+		t.Errorf("TriggerSyntheticExecutions() triggeredCount = %d, want %d", result.TriggeredCount, 2)
+	}
+}
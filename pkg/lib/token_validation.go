@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/common"
+	"github.com/keptn-contrib/dynatrace-service/pkg/logging"
+)
+
+// credentialValidationTTL defines how long the result of the validation of an API token is cached, so that not every event validates it again
+const credentialValidationTTL = 5 * time.Minute
+
+// API token scopes required by the dynatrace-service
+const (
+	ScopeReadConfig                   = "ReadConfig"
+	ScopeWriteConfig                  = "WriteConfig"
+	ScopeExternalSyntheticIntegration = "ExternalSyntheticIntegration"
+	ScopeSettingsRead                 = "settings.read"
+	ScopeSettingsWrite                = "settings.write"
+)
+
+type credentialValidationResult struct {
+	err        error
+	validUntil time.Time
+}
+
+var credentialValidationCache = struct {
+	sync.Mutex
+	results map[string]credentialValidationResult
+}{results: map[string]credentialValidationResult{}}
+
+// apiTokenLookupResponse is the metadata of an API token returned by /api/v2/apiTokens/lookup
+type apiTokenLookupResponse struct {
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Scopes  []string `json:"scopes"`
+}
+
+// credentialsRejectedError is returned by the validation if the tenant rejected the API token or the token lacks scopes
+type credentialsRejectedError struct {
+	msg string
+}
+
+func (e *credentialsRejectedError) Error() string {
+	return e.msg
+}
+
+/**
+ * ValidateCredentials checks upfront whether the tenant accepts the API token and whether the token has the required scopes, so that the handler
+ * can report an actionable error instead of failing later, e.g: token for secret dynatrace rejected by tenant https://abc.live.dynatrace.com: missing scope WriteConfig
+ * Only definitive results are cached per tenant, token and scopes - a failed lookup, e.g. because of a timeout or a 5xx response, is tried again by the
+ * next event. If the tenant doesn't support the token lookup, the credentials are considered valid.
+ */
+func (dt *DynatraceHelper) ValidateCredentials(requiredScopes ...string) error {
+	logger := logging.FromContext(dt.EventContext)
+	if common.RunLocal || common.RunLocalTest {
+		return nil
+	}
+
+	creds := dt.getCredentials()
+	hash := sha256.Sum256([]byte(creds.Tenant + "\n" + creds.ApiToken + "\n" + strings.Join(requiredScopes, ",")))
+	cacheKey := hex.EncodeToString(hash[:])
+
+	credentialValidationCache.Lock()
+	cached, ok := credentialValidationCache.results[cacheKey]
+	credentialValidationCache.Unlock()
+	if ok && time.Now().Before(cached.validUntil) {
+		return cached.err
+	}
+
+	err := dt.validateCredentials(requiredScopes)
+	var rejectedErr *credentialsRejectedError
+	if err != nil && !errors.As(err, &rejectedErr) {
+		logger.WithError(err).Error("Could not validate Dynatrace credentials")
+		return err
+	}
+	if err != nil {
+		logger.WithError(err).Error("Dynatrace credentials are not valid")
+	}
+
+	credentialValidationCache.Lock()
+	credentialValidationCache.results[cacheKey] = credentialValidationResult{err: err, validUntil: time.Now().Add(credentialValidationTTL)}
+	credentialValidationCache.Unlock()
+	return err
+}
+
+func (dt *DynatraceHelper) validateCredentials(requiredScopes []string) error {
+	creds := dt.getCredentials()
+	secretName := creds.SecretName
+	if secretName == "" {
+		secretName = "dynatrace"
+	}
+	rejected := func(reason string) error {
+		return &credentialsRejectedError{msg: fmt.Sprintf("token for secret %s rejected by tenant %s: %s", secretName, creds.Tenant, reason)}
+	}
+
+	payload, err := json.Marshal(map[string]string{"token": creds.ApiToken})
+	if err != nil {
+		return err
+	}
+
+	// the lookup is sent directly, as it doesn't change the configuration of the tenant and must not be skipped in a dry run
+	req, err := dt.createRequest("/api/v2/apiTokens/lookup", http.MethodPost, payload)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	client, err := dt.createClient(req)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %v", err)
+	}
+
+	response, err := dt.doRequest(client, req)
+	var requestErr *apiRequestError
+	if errors.As(err, &requestErr) {
+		switch requestErr.statusCode {
+		case http.StatusUnauthorized:
+			return rejected("the token is invalid or has expired")
+		case http.StatusNotFound, http.StatusForbidden:
+			// the tenant doesn't support the lookup of tokens - the credentials are validated by the actual requests
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not validate token for secret %s at tenant %s: %v", secretName, creds.Tenant, err)
+	}
+
+	token := &apiTokenLookupResponse{}
+	if err := json.Unmarshal([]byte(response), token); err != nil {
+		return fmt.Errorf("could not validate token for secret %s at tenant %s: %v", secretName, creds.Tenant, err)
+	}
+	if !token.Enabled {
+		return rejected("the token is disabled")
+	}
+
+	var missingScopes []string
+	for _, scope := range requiredScopes {
+		if !containsString(token.Scopes, scope) {
+			missingScopes = append(missingScopes, scope)
+		}
+	}
+	if len(missingScopes) == 1 {
+		return rejected("missing scope " + missingScopes[0])
+	}
+	if len(missingScopes) > 1 {
+		sort.Strings(missingScopes)
+		return rejected("missing scopes " + strings.Join(missingScopes, ", "))
+	}
+	return nil
+}
+
+/**
+ * GetConfigurationScopes returns the scopes the API token needs to configure monitoring with the configuration API that is used for the tenant:
+ * settings.read and settings.write for the configuration that is stored as Settings 2.0 objects, ReadConfig and WriteConfig for the configuration API v1,
+ * which is also used for management zones, dashboards and calculated metrics on tenants with Settings 2.0. The write scopes are only required if the
+ * configuration is written, i.e. not in a dry run
+ */
+func (dt *DynatraceHelper) GetConfigurationScopes(write bool) ([]string, error) {
+	scopes := []string{ScopeReadConfig}
+	if write {
+		scopes = append(scopes, ScopeWriteConfig)
+	}
+
+	useSettingsAPI, err := dt.useSettingsAPI()
+	if err != nil {
+		return nil, err
+	}
+	if useSettingsAPI {
+		scopes = append(scopes, ScopeSettingsRead)
+		if write {
+			scopes = append(scopes, ScopeSettingsWrite)
+		}
+	}
+	return scopes, nil
+}
@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/keptn-contrib/dynatrace-service/pkg/credentials"
+)
+
+func TestDynatraceHelper_ValidateCredentials(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		response       string
+		requiredScopes []string
+		wantErr        string
+		// wantLookups is the number of lookups of two validations, results that aren't definitive are not cached
+		wantLookups int
+	}{
+		{
+			name:           "token has all scopes",
+			status:         http.StatusOK,
+			response:       `{"name": "keptn", "enabled": true, "scopes": ["ReadConfig", "WriteConfig", "DataExport"]}`,
+			requiredScopes: []string{ScopeReadConfig, ScopeWriteConfig},
+		},
+		{
+			name:           "token lacks a scope",
+			status:         http.StatusOK,
+			response:       `{"name": "keptn", "enabled": true, "scopes": ["ReadConfig", "DataExport"]}`,
+			requiredScopes: []string{ScopeReadConfig, ScopeWriteConfig},
+			wantErr:        "rejected by tenant TENANT: missing scope WriteConfig",
+		},
+		{
+			name:     "token is disabled",
+			status:   http.StatusOK,
+			response: `{"name": "keptn", "enabled": false, "scopes": []}`,
+			wantErr:  "rejected by tenant TENANT: the token is disabled",
+		},
+		{
+			name:    "token is invalid",
+			status:  http.StatusUnauthorized,
+			wantErr: "rejected by tenant TENANT: the token is invalid or has expired",
+		},
+		{
+			name:   "tenant doesn't support token lookup",
+			status: http.StatusNotFound,
+		},
+		{
+			name:        "tenant is unavailable",
+			status:      http.StatusServiceUnavailable,
+			wantErr:     "could not validate token for secret dynatrace-sockshop-production at tenant TENANT",
+			wantLookups: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups := 0
+			dtMockServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method != http.MethodPost || request.URL.Path != "/api/v2/apiTokens/lookup" {
+					t.Errorf("ValidateCredentials(): unexpected request %s %s", request.Method, request.URL.Path)
+				}
+				lookups++
+				writer.WriteHeader(tt.status)
+				writer.Write([]byte(tt.response))
+			}))
+			defer dtMockServer.Close()
+
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: dtMockServer.URL, ApiToken: "token", SecretName: "dynatrace-sockshop-production"})
+
+			// the second validation must use the cached result
+			for i := 0; i < 2; i++ {
+				err := dt.ValidateCredentials(tt.requiredScopes...)
+				if tt.wantErr == "" {
+					if err != nil {
+						t.Errorf("ValidateCredentials() error = %v", err)
+					}
+					continue
+				}
+				wantErr := strings.Replace(tt.wantErr, "TENANT", dtMockServer.URL, 1)
+				if !strings.HasPrefix(wantErr, "could not validate") {
+					wantErr = "token for secret dynatrace-sockshop-production " + wantErr
+				}
+				if err == nil || !strings.HasPrefix(err.Error(), wantErr) {
+					t.Errorf("ValidateCredentials() error = %v, want %s", err, wantErr)
+				}
+			}
+			wantLookups := tt.wantLookups
+			if wantLookups == 0 {
+				wantLookups = 1
+			}
+			if lookups != wantLookups {
+				t.Errorf("ValidateCredentials() lookups = %d, want %d", lookups, wantLookups)
+			}
+		})
+	}
+}
+
+func TestDynatraceHelper_GetConfigurationScopes(t *testing.T) {
+	tests := []struct {
+		name                 string
+		settingsAPISupported bool
+		write                bool
+		want                 []string
+	}{
+		{
+			name:  "configuration API v1",
+			write: true,
+			want:  []string{ScopeReadConfig, ScopeWriteConfig},
+		},
+		{
+			name:                 "Settings 2.0 API",
+			settingsAPISupported: true,
+			write:                true,
+			want:                 []string{ScopeReadConfig, ScopeWriteConfig, ScopeSettingsRead, ScopeSettingsWrite},
+		},
+		{
+			name:                 "dry run with Settings 2.0 API",
+			settingsAPISupported: true,
+			want:                 []string{ScopeReadConfig, ScopeSettingsRead},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := NewDynatraceHelper(nil, &credentials.DTCredentials{Tenant: "https://mytenant.live.dynatrace.com", ApiToken: "token"})
+			settingsAPISupported := tt.settingsAPISupported
+			dt.settingsAPISupported = &settingsAPISupported
+
+			got, err := dt.GetConfigurationScopes(tt.write)
+			if err != nil {
+				t.Fatalf("GetConfigurationScopes() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetConfigurationScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultLogLevel = log.InfoLevel
+
+// levelFileInterval is the time between two checks of the log level file for a changed level
+const levelFileInterval = 10 * time.Second
+
+type contextKey struct{}
+
+/**
+ * Configure sets up the logger from the environment:
+ * LOG_FORMAT is either text (default) or json, LOG_LEVEL is the initial level, e.g. debug,
+ * and LOG_LEVEL_FILE is a file, e.g. of a mounted ConfigMap, whose level is applied whenever it changes without restarting the service
+ */
+func Configure() {
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	}
+
+	log.SetLevel(parseLevel(os.Getenv("LOG_LEVEL")))
+
+	if levelFile := os.Getenv("LOG_LEVEL_FILE"); levelFile != "" {
+		applyLevelFile(levelFile)
+		go watchLevelFile(levelFile)
+	}
+}
+
+func parseLevel(level string) log.Level {
+	if level == "" {
+		return defaultLogLevel
+	}
+	parsedLevel, err := log.ParseLevel(strings.TrimSpace(level))
+	if err != nil {
+		log.WithField("level", level).Warn("Invalid log level - using info")
+		return defaultLogLevel
+	}
+	return parsedLevel
+}
+
+func watchLevelFile(levelFile string) {
+	for range time.Tick(levelFileInterval) {
+		applyLevelFile(levelFile)
+	}
+}
+
+// applyLevelFile sets the level of the file if it differs from the current one - the level is kept if the file can't be read
+func applyLevelFile(levelFile string) {
+	content, err := ioutil.ReadFile(levelFile)
+	if err != nil || strings.TrimSpace(string(content)) == "" {
+		return
+	}
+	level := parseLevel(string(content))
+	if level != log.GetLevel() {
+		log.WithField("level", level.String()).Info("Changing log level")
+		log.SetLevel(level)
+	}
+}
+
+/**
+ * FromEvent returns a logger whose lines carry the keptnContext and the project, stage and service of the event,
+ * e.g: level=info msg="Fetching indicator" event=sh.keptn.event.get-sli.triggered keptnContext=... project=sockshop stage=staging service=carts
+ */
+func FromEvent(event cloudevents.Event) *log.Entry {
+	fields := log.Fields{
+		"event":   event.Type(),
+		"eventId": event.ID(),
+	}
+
+	var keptnContext string
+	if err := event.Context.ExtensionAs("shkeptncontext", &keptnContext); err == nil && keptnContext != "" {
+		fields["keptnContext"] = keptnContext
+	}
+
+	eventData := &keptnv2.EventData{}
+	if err := event.DataAs(eventData); err == nil {
+		for key, value := range map[string]string{"project": eventData.Project, "stage": eventData.Stage, "service": eventData.Service} {
+			if value != "" {
+				fields[key] = value
+			}
+		}
+	}
+
+	return log.WithFields(fields)
+}
+
+// NewContext returns a context that carries the logger
+func NewContext(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of the context or the standard logger if the context doesn't carry one
+func FromContext(ctx context.Context) *log.Entry {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+			return logger
+		}
+	}
+	return log.NewEntry(log.StandardLogger())
+}
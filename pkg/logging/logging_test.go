@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestFromEvent(t *testing.T) {
+	event := cloudevents.NewEvent()
+	event.SetID("event-id")
+	event.SetType("sh.keptn.event.get-sli.triggered")
+	event.SetExtension("shkeptncontext", "my-keptn-context")
+	event.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"project": "sockshop", "stage": "staging", "service": "carts"})
+
+	got := FromEvent(event).Data
+	want := log.Fields{
+		"event":        "sh.keptn.event.get-sli.triggered",
+		"eventId":      "event-id",
+		"keptnContext": "my-keptn-context",
+		"project":      "sockshop",
+		"stage":        "staging",
+		"service":      "carts",
+	}
+	if len(got) != len(want) {
+		t.Errorf("FromEvent() fields = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("FromEvent() field %s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); len(got.Data) != 0 {
+		t.Errorf("FromContext() fields = %v, want none without a logger in the context", got.Data)
+	}
+
+	logger := log.WithField("keptnContext", "my-keptn-context")
+	if got := FromContext(NewContext(context.Background(), logger)); got != logger {
+		t.Errorf("FromContext() = %v, want the logger of the context", got)
+	}
+}
+
+func TestApplyLevelFile(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(log.InfoLevel)
+
+	levelFile := filepath.Join(t.TempDir(), "LOG_LEVEL")
+	applyLevelFile(levelFile)
+	if log.GetLevel() != log.InfoLevel {
+		t.Errorf("applyLevelFile() level = %v, want info to be kept for a missing file", log.GetLevel())
+	}
+
+	tests := []struct {
+		content string
+		want    log.Level
+	}{
+		{content: "debug\n", want: log.DebugLevel},
+		{content: "", want: log.DebugLevel},
+		{content: "WARN", want: log.WarnLevel},
+		{content: "verbose", want: log.InfoLevel},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(levelFile, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		applyLevelFile(levelFile)
+		if log.GetLevel() != tt.want {
+			t.Errorf("applyLevelFile(%q) level = %v, want %v", tt.content, log.GetLevel(), tt.want)
+		}
+	}
+}
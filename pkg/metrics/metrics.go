@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// ClientConfiguration labels requests of the DynatraceHelper, e.g. to configure the monitoring or to send events
+	ClientConfiguration = "configuration"
+	// ClientSLI labels requests of the Dynatrace handler that retrieves SLIs
+	ClientSLI = "sli"
+)
+
+const (
+	RetrySucceeded = "succeeded"
+	RetryFailed    = "failed"
+	RetryDropped   = "dropped"
+)
+
+var defaultRegistry = &registry{}
+
+var (
+	eventsTotal = newCounterVec(defaultRegistry, "dynatrace_service_events_total",
+		"Number of processed Keptn events by type and result", "type", "result")
+	eventDuration = newHistogramVec(defaultRegistry, "dynatrace_service_event_duration_seconds",
+		"Time to process a Keptn event by type", "type")
+	eventQueueWait = newHistogramVec(defaultRegistry, "dynatrace_service_event_queue_wait_seconds",
+		"Time a Keptn event waited for a worker by type", "type")
+	dynatraceAPIRequestsTotal = newCounterVec(defaultRegistry, "dynatrace_service_dynatrace_api_requests_total",
+		"Number of requests to the Dynatrace API by client, method and status code - the status code is error if no response was received", "client", "method", "status_code")
+	dynatraceAPIRequestDuration = newHistogramVec(defaultRegistry, "dynatrace_service_dynatrace_api_request_duration_seconds",
+		"Latency of requests to the Dynatrace API by client and method", "client", "method")
+	sliQueryDuration = newHistogramVec(defaultRegistry, "dynatrace_service_sli_query_duration_seconds",
+		"Time to retrieve the value of an SLI by result", "result")
+	dynatraceAPIRetriesTotal = newCounterVec(defaultRegistry, "dynatrace_service_dynatrace_api_retries_total",
+		"Number of retries of failed requests to the Dynatrace API by result", "result")
+)
+
+// ObserveEvent records a processed Keptn event
+func ObserveEvent(eventType string, duration time.Duration, err error) {
+	eventsTotal.inc(eventType, resultOf(err))
+	eventDuration.observe(duration.Seconds(), eventType)
+}
+
+// ObserveEventQueueWait records the time a Keptn event waited in the queue until a worker started to process it
+func ObserveEventQueueWait(eventType string, duration time.Duration) {
+	eventQueueWait.observe(duration.Seconds(), eventType)
+}
+
+// ObserveRejectedEvent records a Keptn event that wasn't processed because the queue was full
+func ObserveRejectedEvent(eventType string) {
+	eventsTotal.inc(eventType, "rejected")
+}
+
+// ObserveDuplicateEvent records a Keptn event that was skipped because it had already been received
+func ObserveDuplicateEvent(eventType string) {
+	eventsTotal.inc(eventType, "duplicate")
+}
+
+// ObserveDynatraceAPIRequest records a request to the Dynatrace API, the statusCode is ignored if the request failed with an error
+func ObserveDynatraceAPIRequest(client string, method string, statusCode int, duration time.Duration, err error) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(statusCode)
+	}
+	dynatraceAPIRequestsTotal.inc(client, method, status)
+	dynatraceAPIRequestDuration.observe(duration.Seconds(), client, method)
+}
+
+// ObserveSLIQuery records the retrieval of an SLI value
+func ObserveSLIQuery(duration time.Duration, err error) {
+	sliQueryDuration.observe(duration.Seconds(), resultOf(err))
+}
+
+// ObserveRetry records a retry of a failed request to the Dynatrace API with the result RetrySucceeded, RetryFailed or RetryDropped
+func ObserveRetry(result string) {
+	dynatraceAPIRetriesTotal.inc(result)
+}
+
+// Handler serves all metrics in the Prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		defaultRegistry.write(w)
+	})
+}
+
+func resultOf(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramVec_write(t *testing.T) {
+	r := &registry{}
+	h := newHistogramVec(r, "test_duration_seconds", "Test durations", "result")
+	h.buckets = []float64{0.1, 1}
+	h.observe(0.05, "success")
+	h.observe(0.5, "success")
+	h.observe(5, "success")
+
+	buf := &bytes.Buffer{}
+	r.write(buf)
+
+	want := `# HELP test_duration_seconds Test durations
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{result="success",le="0.1"} 1
+test_duration_seconds_bucket{result="success",le="1"} 2
+test_duration_seconds_bucket{result="success",le="+Inf"} 3
+test_duration_seconds_sum{result="success"} 5.55
+test_duration_seconds_count{result="success"} 3
+`
+	if buf.String() != want {
+		t.Errorf("histogramVec.write() = %s, want %s", buf.String(), want)
+	}
+}
+
+func TestCounterVec_write(t *testing.T) {
+	r := &registry{}
+	c := newCounterVec(r, "test_total", "Test counter", "type", "result")
+	c.inc("sh.keptn.event.get-sli.triggered", "success")
+	c.inc("sh.keptn.event.get-sli.triggered", "success")
+	c.inc(`with "quotes"`, "error")
+
+	buf := &bytes.Buffer{}
+	r.write(buf)
+
+	want := `# HELP test_total Test counter
+# TYPE test_total counter
+test_total{type="sh.keptn.event.get-sli.triggered",result="success"} 2
+test_total{type="with \"quotes\"",result="error"} 1
+`
+	if buf.String() != want {
+		t.Errorf("counterVec.write() = %s, want %s", buf.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ObserveEvent("sh.keptn.event.configure-monitoring.triggered", 2*time.Second, nil)
+	ObserveDynatraceAPIRequest(ClientConfiguration, http.MethodPost, http.StatusBadRequest, 100*time.Millisecond, nil)
+	ObserveDynatraceAPIRequest(ClientSLI, http.MethodGet, 0, time.Second, errors.New("connection refused"))
+	ObserveRetry(RetryFailed)
+	ObserveRejectedEvent("sh.keptn.event.get-sli.triggered")
+	ObserveEventQueueWait("sh.keptn.event.get-sli.triggered", 50*time.Millisecond)
+	ObserveDuplicateEvent("sh.keptn.event.problem.open")
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`dynatrace_service_events_total{type="sh.keptn.event.configure-monitoring.triggered",result="success"} 1`,
+		`dynatrace_service_dynatrace_api_requests_total{client="configuration",method="POST",status_code="400"} 1`,
+		`dynatrace_service_dynatrace_api_requests_total{client="sli",method="GET",status_code="error"} 1`,
+		`dynatrace_service_dynatrace_api_retries_total{result="failed"} 1`,
+		`dynatrace_service_events_total{type="sh.keptn.event.get-sli.triggered",result="rejected"} 1`,
+		`dynatrace_service_events_total{type="sh.keptn.event.problem.open",result="duplicate"} 1`,
+		`dynatrace_service_event_queue_wait_seconds_count{type="sh.keptn.event.get-sli.triggered"} 1`,
+		`# TYPE dynatrace_service_sli_query_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Handler() response doesn't contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultBuckets are the upper bounds in seconds of the histogram buckets, from quick API calls up to slow SLI retrievals
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metric is a metric family that can be written in the Prometheus text exposition format
+type metric interface {
+	write(w io.Writer)
+}
+
+// registry holds all metrics of the dynatrace-service
+type registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+func (r *registry) register(m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+func (r *registry) write(w io.Writer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, m := range r.metrics {
+		m.write(w)
+	}
+}
+
+// counterVec is a counter with a value per combination of label values
+type counterVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(r *registry, name string, help string, labelNames ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labelNames: labelNames, values: map[string]float64{}}
+	r.register(c)
+	return c
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[formatLabels(c.labelNames, labelValues)]++
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, labels := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, wrapLabels(labels), formatValue(c.values[labels]))
+	}
+}
+
+// histogramVec is a histogram with a series of buckets per combination of label values
+type histogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+func newHistogramVec(r *registry, name string, help string, labelNames ...string) *histogramVec {
+	h := &histogramVec{name: name, help: help, labelNames: labelNames, buckets: defaultBuckets, series: map[string]*histogram{}}
+	r.register(h)
+	return h
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	labels := formatLabels(h.labelNames, labelValues)
+	s, ok := h.series[labels]
+	if !ok {
+		s = &histogram{bucketCounts: make([]uint64, len(h.buckets))}
+		h.series[labels] = s
+	}
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, labels := range sortedKeys(h.series) {
+		s := h.series[labels]
+		for i, upperBound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, wrapLabels(joinLabels(labels, `le="`+formatValue(upperBound)+`"`)), s.bucketCounts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, wrapLabels(joinLabels(labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, wrapLabels(labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, wrapLabels(labels), s.count)
+	}
+}
+
+// formatLabels returns the labels in the format name1="value1",name2="value2" - missing values are empty
+func formatLabels(labelNames []string, labelValues []string) string {
+	labels := make([]string, len(labelNames))
+	for i, name := range labelNames {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		labels[i] = name + `="` + escapeLabelValue(value) + `"`
+	}
+	return strings.Join(labels, ",")
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func joinLabels(labels string, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch values := m.(type) {
+	case map[string]float64:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case map[string]*histogram:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
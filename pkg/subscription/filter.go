@@ -0,0 +1,77 @@
+package subscription
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+/**
+ * Filter restricts the events a dynatrace-service handles to the projects and stages it is subscribed to, e.g. so that
+ * instances for different Dynatrace tenants can share one Keptn installation. Projects and Stages are names or patterns, e.g: sockshop-*,
+ * an empty list matches all projects or stages
+ */
+type Filter struct {
+	Projects []string
+	Stages   []string
+}
+
+// NewFilterFromEnv creates a Filter of the comma-separated patterns of SUBSCRIBED_PROJECTS and SUBSCRIBED_STAGES
+func NewFilterFromEnv() *Filter {
+	return &Filter{
+		Projects: splitPatterns(os.Getenv("SUBSCRIBED_PROJECTS")),
+		Stages:   splitPatterns(os.Getenv("SUBSCRIBED_STAGES")),
+	}
+}
+
+/**
+ * Matches returns true if the project and stage of the event match the filter. An event without a project or stage,
+ * e.g. a configure-monitoring event, which doesn't have a stage, is only checked for the fields it has
+ */
+func (f *Filter) Matches(event cloudevents.Event) bool {
+	if f == nil || (len(f.Projects) == 0 && len(f.Stages) == 0) {
+		return true
+	}
+
+	eventData := &keptnv2.EventData{}
+	if err := event.DataAs(eventData); err != nil {
+		return true
+	}
+	return f.MatchesProjectAndStage(eventData.Project, eventData.Stage)
+}
+
+/**
+ * MatchesProjectAndStage returns true if the project and stage match the filter, e.g. for a problem event, whose project and stage
+ * are only known after they have been mapped from the tags of the problem. An empty project or stage isn't checked
+ */
+func (f *Filter) MatchesProjectAndStage(project string, stage string) bool {
+	if f == nil {
+		return true
+	}
+	return matchesAnyPattern(project, f.Projects) && matchesAnyPattern(stage, f.Stages)
+}
+
+func matchesAnyPattern(name string, patterns []string) bool {
+	if name == "" || len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
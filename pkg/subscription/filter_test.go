@@ -0,0 +1,64 @@
+package subscription
+
+import (
+	"os"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	os.Setenv("SUBSCRIBED_PROJECTS", "sockshop, carts-*")
+	defer os.Unsetenv("SUBSCRIBED_PROJECTS")
+	os.Setenv("SUBSCRIBED_STAGES", "staging,production")
+	defer os.Unsetenv("SUBSCRIBED_STAGES")
+
+	filter := NewFilterFromEnv()
+
+	tests := []struct {
+		name string
+		data map[string]string
+		want bool
+	}{
+		{
+			name: "project and stage match",
+			data: map[string]string{"project": "sockshop", "stage": "staging", "service": "carts"},
+			want: true,
+		},
+		{
+			name: "project matches pattern",
+			data: map[string]string{"project": "carts-team", "stage": "production"},
+			want: true,
+		},
+		{
+			name: "other project",
+			data: map[string]string{"project": "podtato-head", "stage": "staging"},
+			want: false,
+		},
+		{
+			name: "other stage",
+			data: map[string]string{"project": "sockshop", "stage": "dev"},
+			want: false,
+		},
+		{
+			name: "event without stage",
+			data: map[string]string{"project": "sockshop", "service": "carts"},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := cloudevents.NewEvent()
+			event.SetType("sh.keptn.event.get-sli.triggered")
+			event.SetData(cloudevents.ApplicationJSON, tt.data)
+
+			if got := filter.Matches(event); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !(&Filter{}).Matches(cloudevents.NewEvent()) {
+		t.Errorf("Matches() = false, want true for an empty filter")
+	}
+}
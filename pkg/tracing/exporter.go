@@ -0,0 +1,253 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBatchSize is the number of ended spans that triggers an export before the exportInterval has passed
+const maxBatchSize = 100
+
+// maxQueuedSpans limits the spans that wait for the export, so that an unavailable collector doesn't fill up the memory
+const maxQueuedSpans = 2000
+
+const exportInterval = 5 * time.Second
+
+/**
+ * exporter sends ended spans in batches to the traces endpoint of an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+ * It is configured by the standard environment variables OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+ * OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME
+ */
+type exporter struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+
+	mutex sync.Mutex
+	spans []*Span
+}
+
+var (
+	exporterOnce   sync.Once
+	activeExporter *exporter
+)
+
+// getExporter returns the exporter configured by the environment or nil if tracing is disabled
+func getExporter() *exporter {
+	exporterOnce.Do(func() {
+		activeExporter = newExporterFromEnv()
+		if activeExporter != nil {
+			log.WithField("url", activeExporter.url).Info("Exporting traces")
+			go activeExporter.run()
+		}
+	})
+	return activeExporter
+}
+
+func newExporterFromEnv() *exporter {
+	url := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if url == "" {
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			return nil
+		}
+		url = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "dynatrace-service"
+	}
+
+	return &exporter{
+		url:         url,
+		headers:     parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// parseHeaders parses headers in the format key1=value1,key2=value2, e.g: Authorization=Api-Token abc
+func parseHeaders(headers string) map[string]string {
+	parsedHeaders := map[string]string{}
+	for _, header := range strings.Split(headers, ",") {
+		keyAndValue := strings.SplitN(header, "=", 2)
+		if len(keyAndValue) == 2 && strings.TrimSpace(keyAndValue[0]) != "" {
+			parsedHeaders[strings.TrimSpace(keyAndValue[0])] = strings.TrimSpace(keyAndValue[1])
+		}
+	}
+	return parsedHeaders
+}
+
+func (e *exporter) run() {
+	for range time.Tick(exportInterval) {
+		e.flush()
+	}
+}
+
+func (e *exporter) add(span *Span) {
+	e.mutex.Lock()
+	if len(e.spans) >= maxQueuedSpans {
+		e.mutex.Unlock()
+		log.WithField("span", span.name).Warn("Too many spans are waiting for the export - dropping span")
+		return
+	}
+	e.spans = append(e.spans, span)
+	batchIsFull := len(e.spans) >= maxBatchSize
+	e.mutex.Unlock()
+
+	if batchIsFull {
+		go e.flush()
+	}
+}
+
+// flush exports all queued spans - spans of a failed export are dropped
+func (e *exporter) flush() {
+	e.mutex.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mutex.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(e.newExportRequest(spans))
+	if err != nil {
+		log.WithError(err).Error("Could not serialize spans")
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(payload))
+	if err != nil {
+		log.WithError(err).Error("Could not create request to export spans")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log.WithError(err).WithField("spans", len(spans)).Warn("Could not export spans")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.WithField("statusCode", resp.StatusCode).WithField("spans", len(spans)).Warn("Could not export spans")
+	}
+}
+
+// the types below are the JSON encoding of the ExportTraceServiceRequest of OTLP
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *exporter) newExportRequest(spans []*Span) *otlpExportRequest {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, newOTLPSpan(span))
+	}
+
+	return &otlpExportRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpAttribute{newOTLPAttribute("service.name", e.serviceName), newOTLPAttribute("service.version", os.Getenv("version"))},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: "github.com/keptn-contrib/dynatrace-service"},
+						Spans: otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func newOTLPSpan(span *Span) otlpSpan {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	s := otlpSpan{
+		TraceID:           hex.EncodeToString(span.traceID[:]),
+		SpanID:            hex.EncodeToString(span.spanID[:]),
+		Name:              span.name,
+		Kind:              span.kind,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		Status:            otlpStatus{Code: 1},
+	}
+	if span.parentSpanID != [8]byte{} {
+		s.ParentSpanID = hex.EncodeToString(span.parentSpanID[:])
+	}
+	if span.keptnContext != "" {
+		s.Attributes = append(s.Attributes, newOTLPAttribute(keptnContextAttribute, span.keptnContext))
+	}
+	for _, attribute := range span.attributes {
+		s.Attributes = append(s.Attributes, newOTLPAttribute(attribute.Key, attribute.Value))
+	}
+	if span.err != nil {
+		s.Status = otlpStatus{Code: 2, Message: span.err.Error()}
+	}
+	return s
+}
+
+func newOTLPAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
@@ -0,0 +1,201 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// span kinds as defined by OpenTelemetry
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+)
+
+// keptnContextAttribute is added to all spans of a trace, so that the spans of a Keptn sequence can be found by its keptnContext
+const keptnContextAttribute = "keptn.context"
+
+// Attribute is a key value pair that describes a span
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Attr returns an Attribute, e.g: tracing.Attr("keptn.project", "sockshop")
+func Attr(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+/**
+ * Span is an operation of a trace that is exported to an OpenTelemetry collector when it ends.
+ * All methods can be called on a nil Span, which is returned if tracing is disabled
+ */
+type Span struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte
+	name         string
+	kind         int
+	keptnContext string
+	start        time.Time
+
+	mutex      sync.Mutex
+	attributes []Attribute
+	end        time.Time
+	err        error
+	ended      bool
+	exporter   *exporter
+}
+
+type contextKey struct{}
+
+// StartSpan starts a span that is a child of the span of the context, or the root of a new trace if the context doesn't have a span
+func StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return startSpan(ctx, name, spanKindInternal, attributes)
+}
+
+// StartClientSpan starts a span for a request to another service, e.g. to the Dynatrace API
+func StartClientSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return startSpan(ctx, name, spanKindClient, attributes)
+}
+
+/**
+ * StartEventSpan starts the span of processing a CloudEvent. If the event has a traceparent extension, as defined by the distributed tracing extension
+ * of CloudEvents, the span continues that trace
+ */
+func StartEventSpan(ctx context.Context, event cloudevents.Event) (context.Context, *Span) {
+	var keptnContext, triggeredID, traceParent string
+	event.Context.ExtensionAs("shkeptncontext", &keptnContext)
+	event.Context.ExtensionAs("triggeredid", &triggeredID)
+	event.Context.ExtensionAs("traceparent", &traceParent)
+
+	if parent := parseTraceParent(traceParent); parent != nil && SpanFromContext(ctx) == nil {
+		ctx = context.WithValue(ctx, contextKey{}, parent)
+	}
+	ctx, span := startSpan(ctx, event.Type(), spanKindServer, []Attribute{
+		Attr("cloudevents.event_id", event.ID()),
+		Attr("cloudevents.event_type", event.Type()),
+		Attr("cloudevents.event_source", event.Source()),
+		Attr("keptn.triggered_id", triggeredID),
+	})
+	if span != nil && keptnContext != "" {
+		span.keptnContext = keptnContext
+	}
+	return ctx, span
+}
+
+// SpanFromContext returns the span of the context or nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// Inject adds the traceparent header of the span of the context to the request, so that the called service can continue the trace
+func Inject(ctx context.Context, req *http.Request) {
+	if span := SpanFromContext(ctx); span != nil {
+		req.Header.Set("traceparent", span.TraceParent())
+	}
+}
+
+func startSpan(ctx context.Context, name string, kind int, attributes []Attribute) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	e := getExporter()
+	if e == nil {
+		return ctx, nil
+	}
+
+	span := &Span{name: name, kind: kind, start: time.Now(), exporter: e}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentSpanID = parent.spanID
+		span.keptnContext = parent.keptnContext
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+
+	for _, attribute := range attributes {
+		span.SetAttribute(attribute.Key, attribute.Value)
+	}
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// SetAttribute adds an attribute to the span - empty values are ignored
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil || value == "" {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes = append(s.attributes, Attribute{Key: key, Value: value})
+}
+
+// End ends the span and queues it for the export - an error marks the span as failed
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mutex.Unlock()
+
+	if s.exporter != nil {
+		s.exporter.add(s)
+	}
+}
+
+// TraceParent returns the W3C traceparent header of the span, e.g: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// TraceID returns the hex encoded ID of the trace of the span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// parseTraceParent returns a remote parent span from a W3C traceparent header or nil if the header is invalid
+func parseTraceParent(traceParent string) *Span {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil
+	}
+
+	span := &Span{}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return nil
+	}
+	copy(span.traceID[:], traceID)
+	copy(span.spanID[:], spanID)
+	return span
+}
@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestStartSpan_Disabled(t *testing.T) {
+	useExporter(nil)
+
+	ctx, span := StartSpan(context.Background(), "disabled")
+	if span != nil {
+		t.Errorf("StartSpan() = %v, want nil if tracing is disabled", span)
+	}
+	span.SetAttribute("key", "value")
+	span.End(nil)
+	if got := span.TraceParent(); got != "" {
+		t.Errorf("TraceParent() = %s, want empty string", got)
+	}
+	if SpanFromContext(ctx) != nil {
+		t.Errorf("SpanFromContext() expected no span")
+	}
+}
+
+func TestStartEventSpan_ExportsTrace(t *testing.T) {
+	var received otlpExportRequest
+	var authorization string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer collector.Close()
+
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL+"/")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Api-Token abc")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_HEADERS")
+	e := newExporterFromEnv()
+	useExporter(e)
+	defer useExporter(nil)
+
+	event := cloudevents.NewEvent()
+	event.SetID("event-id")
+	event.SetType("sh.keptn.event.get-sli.triggered")
+	event.SetSource("lighthouse-service")
+	event.SetExtension("shkeptncontext", "my-keptn-context")
+	event.SetExtension("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, eventSpan := StartEventSpan(context.Background(), event)
+	_, querySpan := StartClientSpan(ctx, "HTTP GET", Attr("http.method", "GET"), Attr("http.url", ""))
+	querySpan.End(errors.New("Dynatrace API returned status code 400"))
+	eventSpan.End(nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	Inject(ctx, req)
+	if got := req.Header.Get("traceparent"); got != eventSpan.TraceParent() {
+		t.Errorf("Inject() traceparent = %s, want %s", got, eventSpan.TraceParent())
+	}
+
+	e.flush()
+
+	if authorization != "Api-Token abc" {
+		t.Errorf("flush() Authorization = %s, want Api-Token abc", authorization)
+	}
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("flush() exported %v, want one resource and scope", received)
+	}
+	if got := received.ResourceSpans[0].Resource.Attributes[0]; got.Key != "service.name" || got.Value.StringValue != "dynatrace-service" {
+		t.Errorf("flush() resource attribute = %v, want service.name dynatrace-service", got)
+	}
+
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("flush() exported %d spans, want 2", len(spans))
+	}
+	query, evt := spans[0], spans[1]
+
+	if evt.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || evt.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("event span trace = %s, parent = %s, want the trace of the traceparent extension", evt.TraceID, evt.ParentSpanID)
+	}
+	if evt.Kind != spanKindServer || evt.Name != "sh.keptn.event.get-sli.triggered" || evt.Status.Code != 1 {
+		t.Errorf("event span = %v, want successful server span named after the event type", evt)
+	}
+	if query.TraceID != evt.TraceID || query.ParentSpanID != evt.SpanID || query.Kind != spanKindClient {
+		t.Errorf("query span = %v, want client span as child of the event span", query)
+	}
+	if query.Status.Code != 2 || query.Status.Message != "Dynatrace API returned status code 400" {
+		t.Errorf("query span status = %v, want error", query.Status)
+	}
+
+	wantAttributes := map[string]string{keptnContextAttribute: "my-keptn-context", "http.method": "GET"}
+	gotAttributes := map[string]string{}
+	for _, attribute := range query.Attributes {
+		gotAttributes[attribute.Key] = attribute.Value.StringValue
+	}
+	if len(gotAttributes) != len(wantAttributes) {
+		t.Errorf("query span attributes = %v, want %v", gotAttributes, wantAttributes)
+	}
+	for key, value := range wantAttributes {
+		if gotAttributes[key] != value {
+			t.Errorf("query span attribute %s = %s, want %s", key, gotAttributes[key], value)
+		}
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceParent string
+		wantValid   bool
+	}{
+		{name: "valid", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantValid: true},
+		{name: "empty", traceParent: ""},
+		{name: "missing flags", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+		{name: "invalid trace ID", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTraceParent(tt.traceParent)
+			if (got != nil) != tt.wantValid {
+				t.Fatalf("parseTraceParent() = %v, want valid %v", got, tt.wantValid)
+			}
+			if got != nil && got.TraceParent() != tt.traceParent {
+				t.Errorf("TraceParent() = %s, want %s", got.TraceParent(), tt.traceParent)
+			}
+		})
+	}
+}
+
+func useExporter(e *exporter) {
+	exporterOnce.Do(func() {})
+	activeExporter = e
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrQueueFull is returned by Submit if all workers are busy and the queue is full
+var ErrQueueFull = errors.New("too many events are waiting to be processed")
+
+// ErrPanic is wrapped by the error Recover returns for a panic
+var ErrPanic = errors.New("panic while processing event")
+
+/**
+ * Pool processes jobs with a fixed number of workers. Jobs wait in a queue of limited length until a worker is available,
+ * so that a burst of events, e.g. many parallel evaluations, can neither exhaust the resources of the service nor the rate limits of the Dynatrace API
+ */
+type Pool struct {
+	jobs chan func()
+	// capacity is the number of jobs that can be processed or wait at the same time
+	capacity int32
+	// pending is the number of submitted jobs that haven't finished yet
+	pending int32
+}
+
+// NewPool starts a pool with concurrency workers and a queue for queueLength waiting jobs
+func NewPool(concurrency int, queueLength int) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if queueLength < 0 {
+		queueLength = 0
+	}
+
+	p := &Pool{
+		jobs:     make(chan func(), concurrency+queueLength),
+		capacity: int32(concurrency + queueLength),
+	}
+	for i := 0; i < concurrency; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues the job or returns ErrQueueFull without blocking if the pool is overloaded
+func (p *Pool) Submit(job func()) error {
+	if atomic.AddInt32(&p.pending, 1) > p.capacity {
+		atomic.AddInt32(&p.pending, -1)
+		return ErrQueueFull
+	}
+	p.jobs <- job
+	return nil
+}
+
+// QueueLength returns the number of jobs that are waiting for a worker
+func (p *Pool) QueueLength() int {
+	return len(p.jobs)
+}
+
+func (p *Pool) work() {
+	for job := range p.jobs {
+		run(job)
+		atomic.AddInt32(&p.pending, -1)
+	}
+}
+
+// run executes the job and makes sure a panic that the job doesn't handle with Recover only fails the job instead of stopping the worker
+func run(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithField("stack", string(debug.Stack())).Errorf("Recovered from panic while processing event: %v", r)
+		}
+	}()
+	job()
+}
+
+/**
+ * Recover calls fn and turns a panic into an error wrapping ErrPanic, so that a job can treat a panic like any other failure,
+ * e.g. store the event as dead letter and respond to Keptn instead of leaving the sequence waiting
+ */
+func Recover(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithField("stack", string(debug.Stack())).Errorf("Recovered from panic while processing event: %v", r)
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return fn()
+}
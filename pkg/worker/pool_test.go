@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool_Submit(t *testing.T) {
+	p := NewPool(2, 1)
+
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	var done sync.WaitGroup
+	started.Add(2)
+	done.Add(3)
+	for i := 0; i < 2; i++ {
+		if err := p.Submit(func() {
+			started.Done()
+			<-release
+			done.Done()
+		}); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+	started.Wait()
+
+	// both workers are busy, so the next job has to wait in the queue
+	if err := p.Submit(func() { done.Done() }); err != nil {
+		t.Fatalf("Submit() error = %v, want the job to be queued", err)
+	}
+	if got := p.QueueLength(); got != 1 {
+		t.Errorf("QueueLength() = %d, want 1", got)
+	}
+	if err := p.Submit(func() {}); err != ErrQueueFull {
+		t.Errorf("Submit() error = %v, want %v if the queue is full", err, ErrQueueFull)
+	}
+
+	close(release)
+	waitFor(t, &done)
+}
+
+func TestPool_RecoversFromPanic(t *testing.T) {
+	p := NewPool(1, 1)
+
+	var done sync.WaitGroup
+	done.Add(1)
+	p.Submit(func() { panic("unexpected") })
+	if err := p.Submit(func() { done.Done() }); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	waitFor(t, &done)
+}
+
+func TestPool_RecoverTurnsPanicIntoError(t *testing.T) {
+	p := NewPool(1, 1)
+
+	// the job continues after the panic of the handler, e.g. to store a dead letter, observe the metrics and end the span
+	var done sync.WaitGroup
+	done.Add(1)
+	var jobErr error
+	if err := p.Submit(func() {
+		defer done.Done()
+		jobErr = Recover(func() error { panic("unexpected") })
+	}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	waitFor(t, &done)
+
+	if !errors.Is(jobErr, ErrPanic) {
+		t.Errorf("Recover() error = %v, want an error wrapping %v", jobErr, ErrPanic)
+	}
+	if err := Recover(func() error { return nil }); err != nil {
+		t.Errorf("Recover() error = %v, want no error if the function doesn't panic", err)
+	}
+}
+
+func waitFor(t *testing.T, wg *sync.WaitGroup) {
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("jobs were not processed")
+	}
+}